@@ -101,6 +101,9 @@ func (hs *HTTPServer) registerRoutes() {
 	r.Post("/api/user/password/send-reset-email", bind(dtos.SendResetPasswordEmailForm{}), Wrap(SendResetPasswordEmail))
 	r.Post("/api/user/password/reset", bind(dtos.ResetUserPasswordForm{}), Wrap(ResetPassword))
 
+	// LDAP change notifications, authenticated with the secret shared with the directory
+	r.Post("/api/ldap/notifications", Wrap(hs.PostLDAPChangeNotification))
+
 	// dashboard snapshots
 	r.Get("/dashboard/snapshot/*", hs.Index)
 	r.Get("/dashboard/snapshots/", reqSignedIn, hs.Index)
@@ -394,9 +397,35 @@ func (hs *HTTPServer) registerRoutes() {
 		adminRoute.Post("/provisioning/dashboards/reload", Wrap(hs.AdminProvisioningReloadDasboards))
 		adminRoute.Post("/provisioning/datasources/reload", Wrap(hs.AdminProvisioningReloadDatasources))
 		adminRoute.Post("/provisioning/notifications/reload", Wrap(hs.AdminProvisioningReloadNotifications))
-		adminRoute.Post("/ldap/reload", Wrap(hs.ReloadLDAPCfg))
-		adminRoute.Get("/ldap/:username", Wrap(hs.GetUserFromLDAP))
-		adminRoute.Get("/ldap/status", Wrap(hs.GetLDAPStatus))
+
+		// the LDAP routes querying the directory are rate limited, the jobs only report their state
+		adminRoute.Group("/ldap", func(ldapRoute routing.RouteRegister) {
+			ldapRoute.Post("/reload", Wrap(hs.ReloadLDAPCfg))
+			ldapRoute.Post("/sync", Wrap(hs.PostSyncAllUsersWithLDAP))
+			ldapRoute.Post("/sync/preflight", Wrap(hs.PostPreflightLDAPSync))
+			ldapRoute.Get("/sync/history", Wrap(hs.GetLDAPSyncHistory))
+			ldapRoute.Get("/sync-log", Wrap(hs.GetLDAPSyncLog))
+			ldapRoute.Post("/sync/:id", Wrap(hs.PostSyncUserWithLDAP))
+			ldapRoute.Post("/test-login", bind(LDAPTestLoginCommand{}), Wrap(hs.PostTestLoginWithLDAP))
+			ldapRoute.Post("/test-search", bind(LDAPTestSearchCommand{}), Wrap(hs.PostTestSearchWithLDAP))
+			ldapRoute.Get("/compare/:first/:second", Wrap(hs.CompareLDAPUsers))
+			ldapRoute.Get("/groups/:groupDN", Wrap(hs.GetGroupFromLDAP))
+			ldapRoute.Get("/:username", Wrap(hs.GetUserFromLDAP))
+			ldapRoute.Get("/:username/photo", Wrap(hs.GetLDAPUserPhoto))
+			ldapRoute.Get("/status", Wrap(hs.GetLDAPStatus))
+			ldapRoute.Get("/config", Wrap(hs.GetLDAPConfig))
+			ldapRoute.Get("/config/hash", Wrap(hs.GetLDAPConfigHash))
+			ldapRoute.Get("/config/coverage", Wrap(hs.GetLDAPConfigCoverage))
+			ldapRoute.Get("/config/dangling-groups", Wrap(hs.GetLDAPDanglingGroups))
+			ldapRoute.Post("/config/impact", bind(LDAPConfigImpactCommand{}), Wrap(hs.PostLDAPConfigImpact))
+			ldapRoute.Get("/settings", Wrap(hs.GetLDAPSettings))
+			ldapRoute.Put("/settings", bind(UpdateLDAPSettingsCommand{}), Wrap(hs.PutLDAPSettings))
+			ldapRoute.Delete("/settings", Wrap(hs.DeleteLDAPSettings))
+			ldapRoute.Get("/users", Wrap(hs.GetAllUsersFromLDAP))
+			ldapRoute.Get("/reconciliation", Wrap(hs.GetLDAPReconciliation))
+		}, ldapRateLimit)
+		adminRoute.Get("/ldap/jobs/:id", Wrap(hs.GetLDAPJobStatus))
+		adminRoute.Get("/ldap/jobs/:id/events", Wrap(hs.GetLDAPJobEvents))
 	}, reqGrafanaAdmin)
 
 	// rendering
@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
 
 	m "github.com/grafana/grafana/pkg/models"
@@ -67,6 +68,44 @@ func (r *NormalResponse) Header(key, value string) *NormalResponse {
 	return r
 }
 
+// StreamResponse is a response which writes its body straight to the client
+// instead of buffering it in memory first
+type StreamResponse struct {
+	status int
+	header http.Header
+	write  func(w io.Writer) error
+}
+
+func (r *StreamResponse) Header(key, value string) *StreamResponse {
+	r.header.Set(key, value)
+	return r
+}
+
+func (r *StreamResponse) WriteTo(ctx *m.ReqContext) {
+	header := ctx.Resp.Header()
+	for k, v := range r.header {
+		header[k] = v
+	}
+	ctx.Resp.WriteHeader(r.status)
+
+	// Headers are already sent at this point, so all we can do is to log the error
+	if err := r.write(ctx.Resp); err != nil {
+		ctx.Logger.Error("Failed to stream the response", "error", err)
+	}
+}
+
+// Stream create a response which body is written by the write function
+func Stream(status int, contentType string, write func(w io.Writer) error) *StreamResponse {
+	header := make(http.Header)
+	header.Set("Content-Type", contentType)
+
+	return &StreamResponse{
+		status: status,
+		header: header,
+		write:  write,
+	}
+}
+
 // Empty create an empty response
 func Empty(status int) *NormalResponse {
 	return Respond(status, nil)
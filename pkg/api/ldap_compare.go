@@ -0,0 +1,240 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+)
+
+// LDAPComparedUserDTO is a user of a comparison, with the LDAP groups it is member of
+type LDAPComparedUserDTO struct {
+	*LDAPUserDTO
+	Groups []string `json:"groups"`
+}
+
+// LDAPOrgRoleDiffDTO is an org where the compared users get different roles, an empty role means no role
+type LDAPOrgRoleDiffDTO struct {
+	OrgId      int64           `json:"orgId"`
+	OrgName    string          `json:"orgName"`
+	FirstRole  models.RoleType `json:"firstRole"`
+	SecondRole models.RoleType `json:"secondRole"`
+}
+
+// LDAPTeamsDiffDTO lists the teams only one of the compared users is member of
+type LDAPTeamsDiffDTO struct {
+	OnlyFirst  []models.TeamOrgGroupDTO `json:"onlyFirst"`
+	OnlySecond []models.TeamOrgGroupDTO `json:"onlySecond"`
+}
+
+// LDAPGroupsDiffDTO lists the LDAP groups only one of the compared users is member of
+type LDAPGroupsDiffDTO struct {
+	OnlyFirst  []string `json:"onlyFirst"`
+	OnlySecond []string `json:"onlySecond"`
+}
+
+// LDAPAdminDiffDTO is the Grafana admin status of the compared users, when it differs
+type LDAPAdminDiffDTO struct {
+	First  *bool `json:"first"`
+	Second *bool `json:"second"`
+}
+
+// LDAPUserDiffDTO is what differs between the mappings of the compared users
+type LDAPUserDiffDTO struct {
+	OrgRoles       []LDAPOrgRoleDiffDTO `json:"orgRoles"`
+	Teams          LDAPTeamsDiffDTO     `json:"teams"`
+	Groups         LDAPGroupsDiffDTO    `json:"groups"`
+	IsGrafanaAdmin *LDAPAdminDiffDTO    `json:"isGrafanaAdmin,omitempty"`
+}
+
+// LDAPUserComparisonDTO is a serializer for the comparison of two users mapped from LDAP, see CompareLDAPUsers
+type LDAPUserComparisonDTO struct {
+	First  *LDAPComparedUserDTO `json:"first"`
+	Second *LDAPComparedUserDTO `json:"second"`
+	Diff   *LDAPUserDiffDTO     `json:"diff"`
+}
+
+// CompareLDAPUsers maps two users from LDAP, like GetUserFromLDAP does, and reports side by side
+// how their org roles, teams, groups and Grafana admin status differ.
+func (server *HTTPServer) CompareLDAPUsers(c *models.ReqContext) Response {
+	if !ldap.IsEnabled() {
+		return ldapDisabledError()
+	}
+
+	ldapConfig, err := getLDAPConfig()
+
+	if err != nil {
+		return ldapConfigError("Failed to obtain the LDAP configuration", err)
+	}
+
+	ldapServer := newLDAP(ldapConfig.Servers)
+	defer ldapServer.Close()
+
+	first, resp := lookupComparedLDAPUser(ldapServer, c.Params(":first"))
+	if resp != nil {
+		return resp
+	}
+
+	second, resp := lookupComparedLDAPUser(ldapServer, c.Params(":second"))
+	if resp != nil {
+		return resp
+	}
+
+	return JSON(http.StatusOK, &LDAPUserComparisonDTO{
+		First:  first,
+		Second: second,
+		Diff:   diffLDAPUsers(first, second),
+	})
+}
+
+// lookupComparedLDAPUser maps the user from LDAP with its orgs and teams, or returns the error response
+func lookupComparedLDAPUser(ldapServer multildap.IMultiLDAP, username string) (*LDAPComparedUserDTO, Response) {
+	if len(username) == 0 {
+		return nil, Error(http.StatusBadRequest, "Validation error. You must specify two usernames", nil)
+	}
+
+	user, serverConfig, err := ldapServer.User(username)
+
+	if err == multildap.ErrUnreachable {
+		return nil, Error(http.StatusServiceUnavailable, "None of the LDAP servers are reachable", err)
+	}
+
+	if err == ldap.ErrAmbiguousUser {
+		return nil, Error(http.StatusConflict, fmt.Sprintf("The user search matched several LDAP entries for %s - Please verify the search filter", username), err)
+	}
+
+	if user == nil {
+		return nil, Error(http.StatusNotFound, fmt.Sprintf("No user %s was found on the LDAP server(s)", username), err)
+	}
+
+	u := newLDAPUserDTO(user, serverConfig)
+
+	if err := u.FetchOrgs(); err != nil {
+		return nil, Error(http.StatusBadRequest, "An oganization was not found - Please verify your LDAP configuration", err)
+	}
+
+	if err := u.FetchTeams(user, serverConfig); err != nil {
+		return nil, Error(http.StatusBadRequest, "Unable to find the teams for this user - Please verify your LDAP configuration", err)
+	}
+
+	groups := user.Groups
+	if groups == nil {
+		groups = []string{}
+	}
+
+	return &LDAPComparedUserDTO{LDAPUserDTO: u, Groups: groups}, nil
+}
+
+// diffLDAPUsers compares the mappings of the two users, the orgs are sorted by id
+func diffLDAPUsers(first *LDAPComparedUserDTO, second *LDAPComparedUserDTO) *LDAPUserDiffDTO {
+	diff := &LDAPUserDiffDTO{
+		OrgRoles: []LDAPOrgRoleDiffDTO{},
+	}
+
+	firstRoles, secondRoles := matchedRoles(first.OrgRoles), matchedRoles(second.OrgRoles)
+
+	orgIds := []int64{}
+	for orgId := range firstRoles {
+		orgIds = append(orgIds, orgId)
+	}
+	for orgId := range secondRoles {
+		if _, ok := firstRoles[orgId]; !ok {
+			orgIds = append(orgIds, orgId)
+		}
+	}
+	sort.Slice(orgIds, func(i, j int) bool { return orgIds[i] < orgIds[j] })
+
+	for _, orgId := range orgIds {
+		firstRole, secondRole := firstRoles[orgId], secondRoles[orgId]
+		if firstRole.OrgRole == secondRole.OrgRole {
+			continue
+		}
+
+		orgName := firstRole.OrgName
+		if orgName == "" {
+			orgName = secondRole.OrgName
+		}
+
+		diff.OrgRoles = append(diff.OrgRoles, LDAPOrgRoleDiffDTO{
+			OrgId:      orgId,
+			OrgName:    orgName,
+			FirstRole:  firstRole.OrgRole,
+			SecondRole: secondRole.OrgRole,
+		})
+	}
+
+	diff.Teams.OnlyFirst, diff.Teams.OnlySecond = teamsOnlyIn(first.Teams, second.Teams), teamsOnlyIn(second.Teams, first.Teams)
+	diff.Groups.OnlyFirst, diff.Groups.OnlySecond = groupsOnlyIn(first.Groups, second.Groups), groupsOnlyIn(second.Groups, first.Groups)
+
+	if !sameAdminStatus(first.IsGrafanaAdmin, second.IsGrafanaAdmin) {
+		diff.IsGrafanaAdmin = &LDAPAdminDiffDTO{First: first.IsGrafanaAdmin, Second: second.IsGrafanaAdmin}
+	}
+
+	return diff
+}
+
+// matchedRoles keys the roles the user actually gets by org id
+func matchedRoles(roles []RoleDTO) map[int64]RoleDTO {
+	matched := map[int64]RoleDTO{}
+
+	for _, role := range roles {
+		if _, decided := matched[role.OrgId]; role.OrgRole != "" && !decided {
+			matched[role.OrgId] = role
+		}
+	}
+
+	return matched
+}
+
+// teamsOnlyIn returns the teams which aren't in others, the org of a team is either known by id or by name
+func teamsOnlyIn(teams []models.TeamOrgGroupDTO, others []models.TeamOrgGroupDTO) []models.TeamOrgGroupDTO {
+	type teamKey struct {
+		orgId    int64
+		orgName  string
+		teamName string
+	}
+
+	known := map[teamKey]bool{}
+	for _, team := range others {
+		known[teamKey{team.OrgId, team.OrgName, team.TeamName}] = true
+	}
+
+	result := []models.TeamOrgGroupDTO{}
+	for _, team := range teams {
+		if !known[teamKey{team.OrgId, team.OrgName, team.TeamName}] {
+			result = append(result, team)
+		}
+	}
+
+	return result
+}
+
+// groupsOnlyIn returns the groups which aren't in others, the DNs are compared case insensitively
+func groupsOnlyIn(groups []string, others []string) []string {
+	known := map[string]bool{}
+	for _, group := range others {
+		known[strings.ToLower(group)] = true
+	}
+
+	result := []string{}
+	for _, group := range groups {
+		if !known[strings.ToLower(group)] {
+			result = append(result, group)
+		}
+	}
+
+	return result
+}
+
+// sameAdminStatus compares the Grafana admin status of the users, nil when LDAP doesn't decide it
+func sameAdminStatus(first *bool, second *bool) bool {
+	if first == nil || second == nil {
+		return first == second
+	}
+
+	return *first == *second
+}
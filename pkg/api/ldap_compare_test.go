@@ -0,0 +1,170 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// compareLDAPMock finds the users by login
+type compareLDAPMock struct {
+	LDAPMock
+	users map[string]*models.ExternalUserInfo
+}
+
+func (m *compareLDAPMock) User(login string) (*models.ExternalUserInfo, ldap.ServerConfig, error) {
+	return m.users[login], userSearchConfig, nil
+}
+
+//***
+// CompareLDAPUsers tests
+//***
+
+func compareLDAPUsersContext(t *testing.T, requestURL string) *scenarioContext {
+	t.Helper()
+
+	sc := setupScenarioContext(requestURL)
+
+	ldap := setting.LDAPEnabled
+	setting.LDAPEnabled = true
+	defer func() { setting.LDAPEnabled = ldap }()
+
+	hs := &HTTPServer{Cfg: setting.NewCfg()}
+
+	sc.defaultHandler = Wrap(func(c *models.ReqContext) Response {
+		sc.context = c
+		return hs.CompareLDAPUsers(c)
+	})
+
+	sc.m.Get("/api/admin/ldap/compare/:first/:second", sc.defaultHandler)
+
+	sc.resp = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, requestURL, nil)
+	sc.req = req
+	sc.exec()
+
+	return sc
+}
+
+func TestCompareLDAPUsersAPIEndpoint(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	searchConfig := userSearchConfig
+	defer func() { userSearchConfig = searchConfig }()
+
+	isAdmin, isNotAdmin := true, false
+
+	mock := &compareLDAPMock{users: map[string]*models.ExternalUserInfo{
+		"alice": {
+			Login:          "alice",
+			Groups:         []string{"cn=admins,ou=groups,dc=grafana,dc=org", "cn=editors,ou=groups,dc=grafana,dc=org"},
+			OrgRoles:       map[int64]models.RoleType{1: models.ROLE_ADMIN},
+			IsGrafanaAdmin: &isAdmin,
+		},
+		"bob": {
+			Login:          "bob",
+			Groups:         []string{"cn=editors,ou=groups,dc=grafana,dc=org"},
+			OrgRoles:       map[int64]models.RoleType{1: models.ROLE_EDITOR},
+			IsGrafanaAdmin: &isNotAdmin,
+		},
+	}}
+
+	userSearchConfig = ldap.ServerConfig{
+		Groups: []*ldap.GroupToOrgRole{
+			{GroupDN: "cn=admins,ou=groups,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_ADMIN},
+			{GroupDN: "cn=editors,ou=groups,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_EDITOR},
+		},
+	}
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return mock
+	}
+
+	bus.AddHandler("test", func(query *models.SearchOrgsQuery) error {
+		query.Result = []*models.OrgDTO{{Id: 1, Name: "Main Org."}}
+		return nil
+	})
+
+	bus.AddHandler("test", func(cmd *models.GetTeamsForLDAPGroupCommand) error {
+		cmd.Result = []models.TeamOrgGroupDTO{}
+		for _, group := range cmd.Groups {
+			if group == "cn=admins,ou=groups,dc=grafana,dc=org" {
+				cmd.Result = append(cmd.Result, models.TeamOrgGroupDTO{TeamName: "Ops", OrgId: 1, OrgName: "Main Org.", GroupDN: group})
+			}
+		}
+		return nil
+	})
+
+	t.Run("diffs the users differing in one group", func(t *testing.T) {
+		closeCalledTimes = 0
+
+		sc := compareLDAPUsersContext(t, "/api/admin/ldap/compare/alice/bob")
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+
+		var response map[string]json.RawMessage
+		require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+
+		assert.JSONEq(t, `{
+			"orgRoles": [
+				{ "orgId": 1, "orgName": "Main Org.", "firstRole": "Admin", "secondRole": "Editor" }
+			],
+			"teams": {
+				"onlyFirst": [
+					{ "teamName": "Ops", "orgId": 1, "orgName": "Main Org.", "groupDN": "cn=admins,ou=groups,dc=grafana,dc=org" }
+				],
+				"onlySecond": []
+			},
+			"groups": {
+				"onlyFirst": ["cn=admins,ou=groups,dc=grafana,dc=org"],
+				"onlySecond": []
+			},
+			"isGrafanaAdmin": { "first": true, "second": false }
+		}`, string(response["diff"]))
+
+		var first, second LDAPComparedUserDTO
+		require.Nil(t, json.Unmarshal(response["first"], &first))
+		require.Nil(t, json.Unmarshal(response["second"], &second))
+
+		assert.Equal(t, "alice", first.Username.LDAPAttributeValue)
+		assert.Equal(t, "bob", second.Username.LDAPAttributeValue)
+		assert.Equal(t, []string{"cn=editors,ou=groups,dc=grafana,dc=org"}, second.Groups)
+
+		// both lookups share the session
+		assert.Equal(t, 1, closeCalledTimes)
+	})
+
+	t.Run("reports no difference for the same user", func(t *testing.T) {
+		sc := compareLDAPUsersContext(t, "/api/admin/ldap/compare/bob/bob")
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+
+		var response map[string]json.RawMessage
+		require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+
+		assert.JSONEq(t, `{
+			"orgRoles": [],
+			"teams": { "onlyFirst": [], "onlySecond": [] },
+			"groups": { "onlyFirst": [], "onlySecond": [] }
+		}`, string(response["diff"]))
+	})
+
+	t.Run("returns not found when a user is missing", func(t *testing.T) {
+		sc := compareLDAPUsersContext(t, "/api/admin/ldap/compare/alice/carol")
+
+		assert.Equal(t, http.StatusNotFound, sc.resp.Code)
+		assert.Contains(t, sc.resp.Body.String(), "No user carol was found on the LDAP server(s)")
+	})
+}
@@ -0,0 +1,351 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+)
+
+// redactedLDAPPassword replaces the passwords and the client keys of the LDAP configuration returned by the API
+const redactedLDAPPassword = "************"
+
+// LDAPConfigDTO is a serializer for the LDAP configuration, it mirrors the structure and the keys of the TOML file
+type LDAPConfigDTO struct {
+	Servers []*LDAPServerConfigDTO `json:"servers"`
+
+	// Source isn't part of the TOML file, it tells where the loaded configuration comes from
+	Source *LDAPConfigSourceDTO `json:"source,omitempty"`
+}
+
+// LDAPConfigSourceDTO is a serializer for the source of the loaded LDAP configuration
+type LDAPConfigSourceDTO struct {
+	// File is empty for the configuration stored in the database, which has a DatabaseVersion instead
+	File            string    `json:"file,omitempty"`
+	IncludedFiles   []string  `json:"includedFiles"`
+	DatabaseVersion int64     `json:"databaseVersion,omitempty"`
+	LoadedAt        time.Time `json:"loadedAt"`
+}
+
+// LDAPServerConfigDTO is a serializer for the configuration of an LDAP server
+type LDAPServerConfigDTO struct {
+	Host          string `json:"host"`
+	Port          int    `json:"port"`
+	UseSSL        bool   `json:"use_ssl"`
+	StartTLS      bool   `json:"start_tls"`
+	SkipVerifySSL bool   `json:"ssl_skip_verify"`
+	RootCACert    string `json:"root_ca_cert"`
+	ClientCert    string `json:"client_cert"`
+	BindDN        string `json:"bind_dn"`
+
+	// ClientKey is redacted like BindPassword
+	ClientKey string `json:"client_key"`
+
+	// BindPassword is redacted, it is only empty when no password is configured
+	BindPassword string `json:"bind_password"`
+
+	Attr LDAPAttributeMapDTO `json:"attributes"`
+
+	DialTimeout   int    `json:"dial_timeout"`
+	BindTimeout   int    `json:"bind_timeout"`
+	SearchTimeout int    `json:"search_timeout"`
+	BindMethod    string `json:"bind_method"`
+	PageSize      int    `json:"page_size"`
+
+	FollowReferrals bool   `json:"follow_referrals"`
+	ReferralMaxHops int    `json:"referral_max_hops"`
+	ReferralBind    string `json:"referral_bind"`
+
+	NormalizeEmail bool   `json:"normalize_email"`
+	InvalidEmail   string `json:"invalid_email"`
+
+	SearchFilter  string   `json:"search_filter"`
+	SearchBaseDNs []string `json:"search_base_dns"`
+
+	GroupSearchFilter              string   `json:"group_search_filter"`
+	GroupSearchFilterUserAttribute string   `json:"group_search_filter_user_attribute"`
+	GroupSearchBaseDNs             []string `json:"group_search_base_dns"`
+	GroupMembership                string   `json:"group_membership"`
+
+	NestedGroups                string `json:"nested_groups"`
+	NestedGroupsMaxDepth        int    `json:"nested_groups_max_depth"`
+	NestedGroupsMemberAttribute string `json:"nested_groups_member_attribute"`
+
+	ActiveDirectoryGroups bool `json:"active_directory_groups"`
+
+	Groups []*LDAPGroupMappingDTO `json:"group_mappings"`
+
+	RoleConflict string `json:"role_conflict"`
+
+	AllowTeamsWithoutRole bool            `json:"allow_teams_without_role"`
+	OrgID                 int64           `json:"org_id"`
+	DefaultOrgID          int64           `json:"default_org_id"`
+	DefaultOrgRole        models.RoleType `json:"default_org_role"`
+	StaleOrgRoles         string          `json:"stale_org_roles"`
+
+	DefaultTeams []*LDAPDefaultTeamDTO `json:"default_teams"`
+
+	TeamMappings []*LDAPTeamMappingDTO `json:"team_mappings"`
+
+	FolderMappings []*LDAPFolderMappingDTO `json:"folder_mappings"`
+
+	RoleOverrides []*LDAPRoleOverrideDTO `json:"role_overrides"`
+
+	MetadataMappings []*LDAPMetadataMappingDTO `json:"metadata_mappings"`
+
+	ReplicaGroup        string `json:"replica_group"`
+	ReplicaLoginInOrder bool   `json:"replica_login_in_order"`
+	ReplicaStrategy     string `json:"replica_strategy"`
+
+	QuarantineAfter    int `json:"quarantine_after"`
+	QuarantineDuration int `json:"quarantine_duration"`
+}
+
+// LDAPAttributeMapDTO is a serializer for the "attributes" section of an LDAP server
+type LDAPAttributeMapDTO struct {
+	Username string `json:"username"`
+	Name     string `json:"name"`
+	Surname  string `json:"surname"`
+	Email    string `json:"email"`
+	MemberOf string `json:"member_of"`
+	Phone    string `json:"phone"`
+	Title    string `json:"title"`
+	Teams    string `json:"teams"`
+
+	UpdatedAt    string `json:"updated_at"`
+	ChangeMarker string `json:"change_marker"`
+	Photo        string `json:"photo"`
+
+	Theme         string `json:"theme"`
+	Timezone      string `json:"timezone"`
+	HomeDashboard string `json:"home_dashboard"`
+}
+
+// LDAPGroupMappingDTO is a serializer for a "group_mappings" section of an LDAP server
+type LDAPGroupMappingDTO struct {
+	GroupDN        string          `json:"group_dn"`
+	OrgID          int64           `json:"org_id"`
+	MatchType      string          `json:"match_type"`
+	IsGrafanaAdmin *bool           `json:"grafana_admin"`
+	OrgRole        models.RoleType `json:"org_role"`
+}
+
+// LDAPDefaultTeamDTO is a serializer for a "default_teams" section of an LDAP server
+type LDAPDefaultTeamDTO struct {
+	OrgID  int64 `json:"org_id"`
+	TeamID int64 `json:"team_id"`
+}
+
+// LDAPTeamMappingDTO is a serializer for a "team_mappings" section of an LDAP server
+type LDAPTeamMappingDTO struct {
+	GroupDN string `json:"group_dn"`
+	OrgID   int64  `json:"org_id"`
+	TeamID  int64  `json:"team_id"`
+}
+
+// LDAPFolderMappingDTO is a serializer for a "folder_mappings" section of an LDAP server
+type LDAPFolderMappingDTO struct {
+	GroupDN    string `json:"group_dn"`
+	OrgID      int64  `json:"org_id"`
+	FolderID   int64  `json:"folder_id"`
+	Permission string `json:"permission"`
+}
+
+// LDAPMetadataMappingDTO is a serializer for a "metadata_mappings" section of an LDAP server
+type LDAPMetadataMappingDTO struct {
+	Key       string `json:"key"`
+	Attribute string `json:"attribute"`
+}
+
+// LDAPRoleOverrideDTO is a serializer for a "role_overrides" section of an LDAP server
+type LDAPRoleOverrideDTO struct {
+	Attribute string          `json:"attribute"`
+	Value     string          `json:"value"`
+	OrgID     int64           `json:"org_id"`
+	OrgRole   models.RoleType `json:"org_role"`
+}
+
+// GetLDAPConfig returns the parsed LDAP configuration currently loaded, without its passwords and client keys,
+// and where it was loaded from
+func (server *HTTPServer) GetLDAPConfig(c *models.ReqContext) Response {
+	if !ldap.IsEnabled() {
+		return ldapDisabledError()
+	}
+
+	ldapConfig, err := getLDAPConfig()
+
+	if err != nil {
+		return ldapConfigError("Failed to obtain the LDAP configuration. Please verify the configuration and try again.", err)
+	}
+
+	return JSON(http.StatusOK, newLDAPConfigDTO(ldapConfig))
+}
+
+// newLDAPConfigDTO copies the LDAP configuration field by field,
+// so that a new sensitive field isn't exposed until it is added here
+func newLDAPConfigDTO(config *ldap.Config) *LDAPConfigDTO {
+	result := &LDAPConfigDTO{Servers: []*LDAPServerConfigDTO{}}
+
+	for _, server := range config.Servers {
+		dto := &LDAPServerConfigDTO{
+			Host:          server.Host,
+			Port:          server.Port,
+			UseSSL:        server.UseSSL,
+			StartTLS:      server.StartTLS,
+			SkipVerifySSL: server.SkipVerifySSL,
+			RootCACert:    server.RootCACert,
+			ClientCert:    server.ClientCert,
+			BindDN:        server.BindDN,
+
+			Attr: LDAPAttributeMapDTO{
+				Username: server.Attr.Username,
+				Name:     server.Attr.Name,
+				Surname:  server.Attr.Surname,
+				Email:    server.Attr.Email,
+				MemberOf: server.Attr.MemberOf,
+				Phone:    server.Attr.Phone,
+				Title:    server.Attr.Title,
+				Teams:    server.Attr.Teams,
+
+				UpdatedAt:    server.Attr.UpdatedAt,
+				ChangeMarker: server.Attr.ChangeMarker,
+				Photo:        server.Attr.Photo,
+
+				Theme:         server.Attr.Theme,
+				Timezone:      server.Attr.Timezone,
+				HomeDashboard: server.Attr.HomeDashboard,
+			},
+
+			DialTimeout:   server.DialTimeout,
+			BindTimeout:   server.BindTimeout,
+			SearchTimeout: server.SearchTimeout,
+			BindMethod:    server.BindMethod,
+			PageSize:      server.PageSize,
+
+			FollowReferrals: server.FollowReferrals,
+			ReferralMaxHops: server.ReferralMaxHops,
+			ReferralBind:    server.ReferralBind,
+
+			NormalizeEmail: server.NormalizeEmail,
+			InvalidEmail:   server.InvalidEmail,
+
+			SearchFilter:  server.SearchFilter,
+			SearchBaseDNs: server.SearchBaseDNs,
+
+			GroupSearchFilter:              server.GroupSearchFilter,
+			GroupSearchFilterUserAttribute: server.GroupSearchFilterUserAttribute,
+			GroupSearchBaseDNs:             server.GroupSearchBaseDNs,
+			GroupMembership:                server.GroupMembership,
+
+			NestedGroups:                server.NestedGroups,
+			NestedGroupsMaxDepth:        server.NestedGroupsMaxDepth,
+			NestedGroupsMemberAttribute: server.NestedGroupsMemberAttribute,
+			ActiveDirectoryGroups:       server.ActiveDirectoryGroups,
+
+			Groups:       []*LDAPGroupMappingDTO{},
+			RoleConflict: server.RoleConflict,
+
+			AllowTeamsWithoutRole: server.AllowTeamsWithoutRole,
+			OrgID:                 server.OrgID,
+			DefaultOrgID:          server.DefaultOrgID,
+			DefaultOrgRole:        server.DefaultOrgRole,
+			StaleOrgRoles:         server.StaleOrgRoles,
+
+			DefaultTeams: []*LDAPDefaultTeamDTO{},
+
+			TeamMappings: []*LDAPTeamMappingDTO{},
+
+			FolderMappings: []*LDAPFolderMappingDTO{},
+
+			RoleOverrides: []*LDAPRoleOverrideDTO{},
+
+			MetadataMappings: []*LDAPMetadataMappingDTO{},
+
+			ReplicaGroup:        server.ReplicaGroup,
+			ReplicaLoginInOrder: server.ReplicaLoginInOrder,
+			ReplicaStrategy:     server.ReplicaStrategy,
+			QuarantineAfter:     server.QuarantineAfter,
+			QuarantineDuration:  server.QuarantineDuration,
+		}
+
+		if server.BindPassword != "" {
+			dto.BindPassword = redactedLDAPPassword
+		}
+
+		if server.ClientKey != "" {
+			dto.ClientKey = redactedLDAPPassword
+		}
+
+		for _, group := range server.Groups {
+			dto.Groups = append(dto.Groups, newLDAPGroupMappingDTO(group))
+		}
+
+		for _, team := range server.DefaultTeams {
+			dto.DefaultTeams = append(dto.DefaultTeams, &LDAPDefaultTeamDTO{
+				OrgID:  team.OrgID,
+				TeamID: team.TeamID,
+			})
+		}
+
+		for _, team := range server.TeamMappings {
+			dto.TeamMappings = append(dto.TeamMappings, &LDAPTeamMappingDTO{
+				GroupDN: team.GroupDN,
+				OrgID:   team.OrgID,
+				TeamID:  team.TeamID,
+			})
+		}
+
+		for _, folder := range server.FolderMappings {
+			dto.FolderMappings = append(dto.FolderMappings, &LDAPFolderMappingDTO{
+				GroupDN:    folder.GroupDN,
+				OrgID:      folder.OrgID,
+				FolderID:   folder.FolderID,
+				Permission: folder.Permission,
+			})
+		}
+
+		for _, mapping := range server.MetadataMappings {
+			dto.MetadataMappings = append(dto.MetadataMappings, &LDAPMetadataMappingDTO{
+				Key:       mapping.Key,
+				Attribute: mapping.Attribute,
+			})
+		}
+
+		for _, override := range server.RoleOverrides {
+			dto.RoleOverrides = append(dto.RoleOverrides, &LDAPRoleOverrideDTO{
+				Attribute: override.Attribute,
+				Value:     override.Value,
+				OrgID:     override.OrgID,
+				OrgRole:   override.OrgRole,
+			})
+		}
+
+		result.Servers = append(result.Servers, dto)
+	}
+
+	if source := config.Source; source != nil {
+		result.Source = &LDAPConfigSourceDTO{
+			File:            source.File,
+			IncludedFiles:   source.IncludedFiles,
+			DatabaseVersion: source.DatabaseVersion,
+			LoadedAt:        source.LoadedAt,
+		}
+
+		if result.Source.IncludedFiles == nil {
+			result.Source.IncludedFiles = []string{}
+		}
+	}
+
+	return result
+}
+
+func newLDAPGroupMappingDTO(group *ldap.GroupToOrgRole) *LDAPGroupMappingDTO {
+	return &LDAPGroupMappingDTO{
+		GroupDN:        group.GroupDN,
+		OrgID:          group.OrgID,
+		MatchType:      group.MatchType,
+		IsGrafanaAdmin: group.IsGrafanaAdmin,
+		OrgRole:        group.OrgRole,
+	}
+}
@@ -0,0 +1,281 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//***
+// GetLDAPConfig tests
+//***
+
+func getLDAPConfigContext(t *testing.T) *scenarioContext {
+	t.Helper()
+
+	requestURL := "/api/admin/ldap/config"
+	sc := setupScenarioContext(requestURL)
+
+	ldap := setting.LDAPEnabled
+	setting.LDAPEnabled = true
+	defer func() { setting.LDAPEnabled = ldap }()
+
+	hs := &HTTPServer{Cfg: setting.NewCfg()}
+
+	sc.defaultHandler = Wrap(func(c *models.ReqContext) Response {
+		sc.context = c
+		return hs.GetLDAPConfig(c)
+	})
+
+	sc.m.Get(requestURL, sc.defaultHandler)
+
+	sc.resp = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, requestURL, nil)
+	sc.req = req
+	sc.exec()
+
+	return sc
+}
+
+func TestGetLDAPConfigAPIEndpoint(t *testing.T) {
+	isGrafanaAdmin := true
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{
+			Servers: []*ldap.ServerConfig{
+				{
+					Host:         "ldap.example.org",
+					Port:         636,
+					UseSSL:       true,
+					RootCACert:   "/etc/ssl/ca.pem",
+					ClientCert:   "/etc/ssl/grafana.pem",
+					ClientKey:    "/etc/ssl/private/grafana-key.pem",
+					BindDN:       "cn=admin,dc=grafana,dc=org",
+					BindPassword: "s3cr3t-bind-password",
+					Attr: ldap.AttributeMap{
+						Username: "uid",
+						Name:     "givenName",
+						Surname:  "sn",
+						Email:    "mail",
+						MemberOf: "memberOf",
+					},
+					SearchFilter:  "(uid=%s)",
+					SearchBaseDNs: []string{"ou=users,dc=grafana,dc=org"},
+					Groups: []*ldap.GroupToOrgRole{
+						{GroupDN: "cn=admins,ou=groups,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_ADMIN, IsGrafanaAdmin: &isGrafanaAdmin},
+						{GroupDN: "cn=proj-*", OrgID: 2, OrgRole: models.ROLE_VIEWER, MatchType: ldap.GroupMatchGlob},
+					},
+					DefaultOrgID: 2,
+					DefaultTeams: []*ldap.DefaultTeam{{OrgID: 2, TeamID: 5}},
+					TeamMappings: []*ldap.GroupToTeam{
+						{GroupDN: "cn=ops,ou=groups,dc=grafana,dc=org", OrgID: 1, TeamID: 7},
+					},
+					FolderMappings: []*ldap.GroupToFolderPermission{
+						{GroupDN: "cn=ops,ou=groups,dc=grafana,dc=org", OrgID: 1, FolderID: 10, Permission: "Edit"},
+					},
+					RoleOverrides: []*ldap.RoleOverride{
+						{Attribute: "departmentNumber", Value: "contractors", OrgID: 1, OrgRole: models.ROLE_VIEWER},
+					},
+					MetadataMappings: []*ldap.MetadataMapping{
+						{Key: "department", Attribute: "department"},
+					},
+				},
+				{
+					Host:          "ldap-anonymous.example.org",
+					Port:          389,
+					SearchFilter:  "(cn=%s)",
+					SearchBaseDNs: []string{"dc=grafana,dc=org"},
+				},
+			},
+			Source: &ldap.ConfigSource{
+				File:          "/etc/grafana/ldap.toml",
+				IncludedFiles: []string{"/etc/grafana/ldap.d/teams.toml"},
+				LoadedAt:      time.Date(2019, 10, 1, 12, 30, 0, 0, time.UTC),
+			},
+		}, nil
+	}
+
+	sc := getLDAPConfigContext(t)
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+	assert.NotContains(t, sc.resp.Body.String(), "s3cr3t-bind-password")
+	assert.NotContains(t, sc.resp.Body.String(), "grafana-key.pem")
+
+	expected := `
+	{
+		"servers": [
+			{
+				"host": "ldap.example.org",
+				"port": 636,
+				"use_ssl": true,
+				"start_tls": false,
+				"ssl_skip_verify": false,
+				"root_ca_cert": "/etc/ssl/ca.pem",
+				"client_cert": "/etc/ssl/grafana.pem",
+				"client_key": "************",
+				"bind_dn": "cn=admin,dc=grafana,dc=org",
+				"bind_password": "************",
+				"attributes": {
+					"username": "uid",
+					"name": "givenName",
+					"surname": "sn",
+					"email": "mail",
+					"member_of": "memberOf",
+					"phone": "",
+					"title": "",
+					"teams": "",
+					"updated_at": "",
+					"change_marker": "",
+					"photo": "",
+					"theme": "",
+					"timezone": "",
+					"home_dashboard": ""
+				},
+				"dial_timeout": 0,
+				"bind_timeout": 0,
+				"search_timeout": 0,
+				"bind_method": "",
+				"page_size": 0,
+				"follow_referrals": false,
+				"referral_max_hops": 0,
+				"referral_bind": "",
+				"normalize_email": false,
+				"invalid_email": "",
+				"search_filter": "(uid=%s)",
+				"search_base_dns": ["ou=users,dc=grafana,dc=org"],
+				"group_search_filter": "",
+				"group_search_filter_user_attribute": "",
+				"group_search_base_dns": null,
+				"group_membership": "",
+				"nested_groups": "",
+				"nested_groups_max_depth": 0,
+				"nested_groups_member_attribute": "",
+				"active_directory_groups": false,
+				"group_mappings": [
+					{"group_dn": "cn=admins,ou=groups,dc=grafana,dc=org", "org_id": 1, "match_type": "", "grafana_admin": true, "org_role": "Admin"},
+					{"group_dn": "cn=proj-*", "org_id": 2, "match_type": "glob", "grafana_admin": null, "org_role": "Viewer"}
+				],
+				"role_conflict": "",
+				"allow_teams_without_role": false,
+				"org_id": 0,
+				"default_org_id": 2,
+				"default_org_role": "",
+				"stale_org_roles": "",
+				"default_teams": [{"org_id": 2, "team_id": 5}],
+				"team_mappings": [{"group_dn": "cn=ops,ou=groups,dc=grafana,dc=org", "org_id": 1, "team_id": 7}],
+				"folder_mappings": [{"group_dn": "cn=ops,ou=groups,dc=grafana,dc=org", "org_id": 1, "folder_id": 10, "permission": "Edit"}],
+				"role_overrides": [{"attribute": "departmentNumber", "value": "contractors", "org_id": 1, "org_role": "Viewer"}],
+				"metadata_mappings": [{"key": "department", "attribute": "department"}],
+				"replica_group": "",
+				"replica_login_in_order": false,
+				"replica_strategy": "",
+				"quarantine_after": 0,
+				"quarantine_duration": 0
+			},
+			{
+				"host": "ldap-anonymous.example.org",
+				"port": 389,
+				"use_ssl": false,
+				"start_tls": false,
+				"ssl_skip_verify": false,
+				"root_ca_cert": "",
+				"client_cert": "",
+				"client_key": "",
+				"bind_dn": "",
+				"bind_password": "",
+				"attributes": {
+					"username": "",
+					"name": "",
+					"surname": "",
+					"email": "",
+					"member_of": "",
+					"phone": "",
+					"title": "",
+					"teams": "",
+					"updated_at": "",
+					"change_marker": "",
+					"photo": "",
+					"theme": "",
+					"timezone": "",
+					"home_dashboard": ""
+				},
+				"dial_timeout": 0,
+				"bind_timeout": 0,
+				"search_timeout": 0,
+				"bind_method": "",
+				"page_size": 0,
+				"follow_referrals": false,
+				"referral_max_hops": 0,
+				"referral_bind": "",
+				"normalize_email": false,
+				"invalid_email": "",
+				"search_filter": "(cn=%s)",
+				"search_base_dns": ["dc=grafana,dc=org"],
+				"group_search_filter": "",
+				"group_search_filter_user_attribute": "",
+				"group_search_base_dns": null,
+				"group_membership": "",
+				"nested_groups": "",
+				"nested_groups_max_depth": 0,
+				"nested_groups_member_attribute": "",
+				"active_directory_groups": false,
+				"group_mappings": [],
+				"role_conflict": "",
+				"allow_teams_without_role": false,
+				"org_id": 0,
+				"default_org_id": 0,
+				"default_org_role": "",
+				"stale_org_roles": "",
+				"default_teams": [],
+				"team_mappings": [],
+				"folder_mappings": [],
+				"role_overrides": [],
+				"metadata_mappings": [],
+				"replica_group": "",
+				"replica_login_in_order": false,
+				"replica_strategy": "",
+				"quarantine_after": 0,
+				"quarantine_duration": 0
+			}
+		],
+		"source": {
+			"file": "/etc/grafana/ldap.toml",
+			"includedFiles": ["/etc/grafana/ldap.d/teams.toml"],
+			"loadedAt": "2019-10-01T12:30:00Z"
+		}
+	}
+	`
+
+	assert.JSONEq(t, expected, sc.resp.Body.String())
+}
+
+// TestLDAPServerConfigDTOFields makes sure a new field of the server configuration
+// is deliberately added to the API representation, or deliberately left out of it
+func TestLDAPServerConfigDTOFields(t *testing.T) {
+	fieldNames := func(value interface{}) []string {
+		names := []string{}
+		valueType := reflect.TypeOf(value)
+		for i := 0; i < valueType.NumField(); i++ {
+			if field := valueType.Field(i); field.PkgPath == "" {
+				names = append(names, field.Name)
+			}
+		}
+		return names
+	}
+
+	assert.ElementsMatch(t, fieldNames(ldap.ServerConfig{}), fieldNames(LDAPServerConfigDTO{}))
+	assert.ElementsMatch(t, fieldNames(ldap.AttributeMap{}), fieldNames(LDAPAttributeMapDTO{}))
+	assert.ElementsMatch(t, fieldNames(ldap.GroupToOrgRole{}), fieldNames(LDAPGroupMappingDTO{}))
+	assert.ElementsMatch(t, fieldNames(ldap.DefaultTeam{}), fieldNames(LDAPDefaultTeamDTO{}))
+	assert.ElementsMatch(t, fieldNames(ldap.GroupToTeam{}), fieldNames(LDAPTeamMappingDTO{}))
+	assert.ElementsMatch(t, fieldNames(ldap.GroupToFolderPermission{}), fieldNames(LDAPFolderMappingDTO{}))
+	assert.ElementsMatch(t, fieldNames(ldap.RoleOverride{}), fieldNames(LDAPRoleOverrideDTO{}))
+}
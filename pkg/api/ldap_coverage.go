@@ -0,0 +1,83 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+)
+
+// LDAPRoleCoverageDTO is a serializer for the groups mapped to a role of an organization
+type LDAPRoleCoverageDTO struct {
+	Role    models.RoleType `json:"role"`
+	Covered bool            `json:"covered"`
+	Groups  []string        `json:"groups"`
+}
+
+// LDAPOrgCoverageDTO is a serializer for the coverage of the roles of an organization by the group mappings
+type LDAPOrgCoverageDTO struct {
+	OrgId   int64                  `json:"orgId"`
+	OrgName string                 `json:"orgName"`
+	Roles   []*LDAPRoleCoverageDTO `json:"roles"`
+}
+
+// LDAPCoverageDTO is a serializer for the coverage of the roles of every organization by the group mappings
+type LDAPCoverageDTO struct {
+	Covered bool                  `json:"covered"`
+	Gaps    []string              `json:"gaps"`
+	Orgs    []*LDAPOrgCoverageDTO `json:"orgs"`
+}
+
+// GetLDAPConfigCoverage reports, for every organization, whether a group is mapped to each of its roles.
+// An organization without any group mapped to Admin is left without LDAP admin.
+// It is derived from the loaded config and read-only.
+func (server *HTTPServer) GetLDAPConfigCoverage(c *models.ReqContext) Response {
+	if !ldap.IsEnabled() {
+		return ldapDisabledError()
+	}
+
+	ldapConfig, err := getLDAPConfig()
+
+	if err != nil {
+		return ldapConfigError("Failed to obtain the LDAP configuration. Please verify the configuration and try again.", err)
+	}
+
+	orgsQuery := &models.SearchOrgsQuery{}
+
+	if err := bus.Dispatch(orgsQuery); err != nil {
+		return Error(http.StatusInternalServerError, "Failed to get the organizations", err)
+	}
+
+	orgIDs := []int64{}
+	orgNames := map[int64]string{}
+	for _, org := range orgsQuery.Result {
+		orgIDs = append(orgIDs, org.Id)
+		orgNames[org.Id] = org.Name
+	}
+
+	result := &LDAPCoverageDTO{Covered: true, Gaps: []string{}, Orgs: []*LDAPOrgCoverageDTO{}}
+
+	for _, coverage := range ldapConfig.RoleCoverage(orgIDs) {
+		org := &LDAPOrgCoverageDTO{OrgId: coverage.OrgID, OrgName: orgNames[coverage.OrgID]}
+
+		for _, role := range ldap.CoveredRoles {
+			groups := coverage.Groups[role]
+			if groups == nil {
+				groups = []string{}
+			}
+
+			org.Roles = append(org.Roles, &LDAPRoleCoverageDTO{Role: role, Covered: len(groups) > 0, Groups: groups})
+		}
+
+		for _, role := range coverage.Gaps() {
+			result.Covered = false
+			result.Gaps = append(result.Gaps, fmt.Sprintf("org %d has no group mapped to %s", coverage.OrgID, role))
+		}
+
+		result.Orgs = append(result.Orgs, org)
+	}
+
+	return JSON(http.StatusOK, result)
+}
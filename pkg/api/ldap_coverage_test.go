@@ -0,0 +1,132 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//***
+// GetLDAPConfigCoverage tests
+//***
+
+func getLDAPConfigCoverageContext(t *testing.T) *scenarioContext {
+	t.Helper()
+
+	requestURL := "/api/admin/ldap/config/coverage"
+	sc := setupScenarioContext(requestURL)
+
+	ldap := setting.LDAPEnabled
+	setting.LDAPEnabled = true
+	defer func() { setting.LDAPEnabled = ldap }()
+
+	hs := &HTTPServer{Cfg: setting.NewCfg()}
+
+	sc.defaultHandler = Wrap(func(c *models.ReqContext) Response {
+		sc.context = c
+		return hs.GetLDAPConfigCoverage(c)
+	})
+
+	sc.m.Get(requestURL, sc.defaultHandler)
+
+	sc.resp = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, requestURL, nil)
+	sc.req = req
+	sc.exec()
+
+	return sc
+}
+
+func mockLDAPCoverageConfig(t *testing.T, groups ...*ldap.GroupToOrgRole) {
+	t.Helper()
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{
+			Servers: []*ldap.ServerConfig{{Host: "ldap.example.org", Groups: groups}},
+		}, nil
+	}
+
+	bus.AddHandler("test", func(q *models.SearchOrgsQuery) error {
+		q.Result = []*models.OrgDTO{{Id: 1, Name: "Main Org."}, {Id: 3, Name: "Ops"}}
+		return nil
+	})
+}
+
+func TestGetLDAPConfigCoverageAPIEndpoint_FullCoverage(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	mockLDAPCoverageConfig(t,
+		&ldap.GroupToOrgRole{GroupDN: "cn=admins", OrgID: 1, OrgRole: models.ROLE_ADMIN},
+		&ldap.GroupToOrgRole{GroupDN: "cn=editors", OrgID: 1, OrgRole: models.ROLE_EDITOR},
+		&ldap.GroupToOrgRole{GroupDN: "*", OrgID: 1, OrgRole: models.ROLE_VIEWER},
+		&ldap.GroupToOrgRole{GroupDN: "cn=ops-admins", OrgID: 3, OrgRole: models.ROLE_ADMIN},
+		&ldap.GroupToOrgRole{GroupDN: "cn=ops", OrgID: 3, OrgRole: models.ROLE_EDITOR},
+		&ldap.GroupToOrgRole{GroupDN: "cn=ops-viewers", OrgID: 3, OrgRole: models.ROLE_VIEWER},
+	)
+
+	sc := getLDAPConfigCoverageContext(t)
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+
+	expected := `
+		{
+			"covered": true,
+			"gaps": [],
+			"orgs": [
+				{
+					"orgId": 1,
+					"orgName": "Main Org.",
+					"roles": [
+						{ "role": "Admin", "covered": true, "groups": ["cn=admins"] },
+						{ "role": "Editor", "covered": true, "groups": ["cn=editors"] },
+						{ "role": "Viewer", "covered": true, "groups": ["*"] }
+					]
+				},
+				{
+					"orgId": 3,
+					"orgName": "Ops",
+					"roles": [
+						{ "role": "Admin", "covered": true, "groups": ["cn=ops-admins"] },
+						{ "role": "Editor", "covered": true, "groups": ["cn=ops"] },
+						{ "role": "Viewer", "covered": true, "groups": ["cn=ops-viewers"] }
+					]
+				}
+			]
+		}
+	`
+	assert.JSONEq(t, expected, sc.resp.Body.String())
+}
+
+func TestGetLDAPConfigCoverageAPIEndpoint_Gap(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	mockLDAPCoverageConfig(t,
+		&ldap.GroupToOrgRole{GroupDN: "cn=admins", OrgID: 1, OrgRole: models.ROLE_ADMIN},
+		&ldap.GroupToOrgRole{GroupDN: "cn=editors", OrgID: 1, OrgRole: models.ROLE_EDITOR},
+		&ldap.GroupToOrgRole{GroupDN: "*", OrgID: 1, OrgRole: models.ROLE_VIEWER},
+		&ldap.GroupToOrgRole{GroupDN: "cn=ops", OrgID: 3, OrgRole: models.ROLE_EDITOR},
+		&ldap.GroupToOrgRole{GroupDN: "cn=ops-viewers", OrgID: 3, OrgRole: models.ROLE_VIEWER},
+	)
+
+	sc := getLDAPConfigCoverageContext(t)
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+
+	var result LDAPCoverageDTO
+	require.NoError(t, json.Unmarshal(sc.resp.Body.Bytes(), &result))
+
+	assert.False(t, result.Covered)
+	assert.Equal(t, []string{"org 3 has no group mapped to Admin"}, result.Gaps)
+	require.Len(t, result.Orgs, 2)
+	assert.Equal(t, &LDAPRoleCoverageDTO{Role: models.ROLE_ADMIN, Covered: false, Groups: []string{}}, result.Orgs[1].Roles[0])
+}
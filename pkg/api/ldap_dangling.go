@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+)
+
+// LDAPGroupMappingsCheckDTO is a serializer for the lookup of the groups mapped by an LDAP server
+type LDAPGroupMappingsCheckDTO struct {
+	Host      string                 `json:"host"`
+	Port      int                    `json:"port"`
+	Available bool                   `json:"available"`
+	Error     string                 `json:"error,omitempty"`
+	Missing   []*LDAPGroupMappingDTO `json:"missing"`
+	Unchecked []*LDAPGroupMappingDTO `json:"unchecked"`
+}
+
+// GetLDAPDanglingGroups looks up the group DNs of the group mappings in the directory of every server,
+// and lists the mappings whose group doesn't exist anymore, for example after a reorganization of the directory.
+// The patterns can't be looked up, they are listed as unchecked.
+func (server *HTTPServer) GetLDAPDanglingGroups(c *models.ReqContext) Response {
+	if !ldap.IsEnabled() {
+		return ldapDisabledError()
+	}
+
+	ldapConfig, err := getLDAPConfig()
+
+	if err != nil {
+		return ldapConfigError("Failed to obtain the LDAP configuration. Please verify the configuration and try again.", err)
+	}
+
+	ldapServer := newLDAP(ldapConfig.Servers)
+	defer ldapServer.Close()
+
+	checks, err := ldapServer.DanglingGroupMappings()
+
+	if err != nil {
+		return Error(http.StatusBadRequest, "Failed to look up the groups in the LDAP server(s)", err)
+	}
+
+	available := false
+	result := []*LDAPGroupMappingsCheckDTO{}
+	for _, check := range checks {
+		available = available || check.Available
+
+		dto := &LDAPGroupMappingsCheckDTO{
+			Host:      check.Host,
+			Port:      check.Port,
+			Available: check.Available,
+			Missing:   []*LDAPGroupMappingDTO{},
+			Unchecked: []*LDAPGroupMappingDTO{},
+		}
+
+		if check.Error != nil {
+			dto.Error = check.Error.Error()
+		}
+
+		for _, group := range check.Missing {
+			dto.Missing = append(dto.Missing, newLDAPGroupMappingDTO(group))
+		}
+
+		for _, group := range check.Unchecked {
+			dto.Unchecked = append(dto.Unchecked, newLDAPGroupMappingDTO(group))
+		}
+
+		result = append(result, dto)
+	}
+
+	// Like the status of the servers, nothing could be checked when none of the servers are available
+	if !available {
+		return JSON(http.StatusServiceUnavailable, result)
+	}
+
+	return JSON(http.StatusOK, result)
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//***
+// GetLDAPDanglingGroups tests
+//***
+
+func getLDAPDanglingGroupsContext(t *testing.T) *scenarioContext {
+	t.Helper()
+
+	requestURL := "/api/admin/ldap/config/dangling-groups"
+	sc := setupScenarioContext(requestURL)
+
+	ldap := setting.LDAPEnabled
+	setting.LDAPEnabled = true
+	defer func() { setting.LDAPEnabled = ldap }()
+
+	hs := &HTTPServer{Cfg: setting.NewCfg()}
+
+	sc.defaultHandler = Wrap(func(c *models.ReqContext) Response {
+		sc.context = c
+		return hs.GetLDAPDanglingGroups(c)
+	})
+
+	sc.m.Get(requestURL, sc.defaultHandler)
+
+	sc.resp = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, requestURL, nil)
+	sc.req = req
+	sc.exec()
+
+	return sc
+}
+
+func mockLDAPDanglingGroups(checks []*multildap.GroupMappingsCheck) {
+	danglingResult = checks
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+}
+
+func TestGetLDAPDanglingGroupsApiEndpoint(t *testing.T) {
+	defer func() { danglingResult = nil }()
+
+	mockLDAPDanglingGroups([]*multildap.GroupMappingsCheck{
+		{
+			Host:      "ldap.example.org",
+			Port:      389,
+			Available: true,
+			Missing: []*ldap.GroupToOrgRole{
+				{GroupDN: "cn=old-admins,ou=groups,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_ADMIN},
+			},
+			Unchecked: []*ldap.GroupToOrgRole{
+				{GroupDN: "cn=proj-*", OrgID: 2, MatchType: ldap.GroupMatchGlob, OrgRole: models.ROLE_VIEWER},
+			},
+		},
+		{
+			Host:      "ldap-replica.example.org",
+			Port:      389,
+			Available: false,
+			Error:     errors.New("dial tcp: connection refused"),
+		},
+	})
+
+	sc := getLDAPDanglingGroupsContext(t)
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+
+	expected := `
+	[
+		{
+			"host": "ldap.example.org",
+			"port": 389,
+			"available": true,
+			"missing": [
+				{"group_dn": "cn=old-admins,ou=groups,dc=grafana,dc=org", "org_id": 1, "match_type": "", "grafana_admin": null, "org_role": "Admin"}
+			],
+			"unchecked": [
+				{"group_dn": "cn=proj-*", "org_id": 2, "match_type": "glob", "grafana_admin": null, "org_role": "Viewer"}
+			]
+		},
+		{
+			"host": "ldap-replica.example.org",
+			"port": 389,
+			"available": false,
+			"error": "dial tcp: connection refused",
+			"missing": [],
+			"unchecked": []
+		}
+	]
+	`
+
+	assert.JSONEq(t, expected, sc.resp.Body.String())
+}
+
+func TestGetLDAPDanglingGroupsApiEndpoint_AllUnavailable(t *testing.T) {
+	defer func() { danglingResult = nil }()
+
+	mockLDAPDanglingGroups([]*multildap.GroupMappingsCheck{
+		{Host: "ldap.example.org", Port: 389, Error: errors.New("dial tcp: connection refused")},
+	})
+
+	sc := getLDAPDanglingGroupsContext(t)
+
+	require.Equal(t, http.StatusServiceUnavailable, sc.resp.Code)
+	assert.Contains(t, sc.resp.Body.String(), "connection refused")
+}
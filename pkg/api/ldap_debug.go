@@ -3,18 +3,25 @@ package api
 import (
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/grafana/grafana/pkg/bus"
 	"github.com/grafana/grafana/pkg/infra/log"
 	"github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/ldapsync"
 	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
 	"github.com/grafana/grafana/pkg/util"
 )
 
 var (
-	getLDAPConfig = multildap.GetConfig
-	newLDAP       = multildap.New
+	getLDAPConfig      = multildap.GetConfig
+	newLDAP            = multildap.NewSession
+	getLDAPSyncHistory = ldapsync.SyncHistory
+	reloadLDAPConfig   = ldap.ReloadConfig
 
 	logger = log.New("LDAP.debug")
 
@@ -35,6 +42,59 @@ type RoleDTO struct {
 	OrgName string          `json:"orgName"`
 	OrgRole models.RoleType `json:"orgRole"`
 	GroupDN string          `json:"groupDN"`
+
+	// MatchedGroupDN is the group of the user matched by a glob or regex GroupDN
+	MatchedGroupDN string `json:"matchedGroupDN,omitempty"`
+
+	// Server is the host of the LDAP server whose default org gave the role, if no group did
+	Server string `json:"server,omitempty"`
+
+	// Contributors lists, on the role which won, every matched group of the org with the role it confers,
+	// when several groups matched. The role_conflict policy of the server decides which one wins.
+	Contributors []RoleDTO `json:"contributors,omitempty"`
+
+	// Override is the rule of the role_overrides which replaced the role given by the groups, if any
+	Override *LDAPRoleOverrideAppliedDTO `json:"override,omitempty"`
+
+	// Won flags the contributor whose role won
+	Won bool `json:"won,omitempty"`
+}
+
+// FolderPermissionDTO is a serializer for the folder permissions mapped from LDAP
+type FolderPermissionDTO struct {
+	OrgId      int64  `json:"orgId"`
+	FolderId   int64  `json:"folderId"`
+	Permission string `json:"permission"`
+	GroupDN    string `json:"groupDN"`
+}
+
+// LDAPUserSearchDTO is a serializer for the searches of an LDAP user, with the filters as they were sent to the server
+type LDAPUserSearchDTO struct {
+	// Server is the "host:port" of the server which answered
+	Server string `json:"server"`
+
+	BaseDNs []string `json:"baseDns"`
+	Filter  string   `json:"filter"`
+
+	// GroupBaseDNs and GroupFilter are only reported when the groups of the user are searched, see group_search_filter
+	GroupBaseDNs []string `json:"groupBaseDns,omitempty"`
+	GroupFilter  string   `json:"groupFilter,omitempty"`
+}
+
+// newLDAPUserSearchDTO reports the search of the user by the login on the server, and the search of its groups
+func newLDAPUserSearchDTO(login string, user *models.ExternalUserInfo, serverConfig ldap.ServerConfig) *LDAPUserSearchDTO {
+	dto := &LDAPUserSearchDTO{
+		Server:  fmt.Sprintf("%s:%d", serverConfig.Host, serverConfig.Port),
+		BaseDNs: serverConfig.SearchBaseDNs,
+		Filter:  ldap.UserSearchFilter(&serverConfig, []string{login}),
+	}
+
+	if user.GroupSearchFilter != "" {
+		dto.GroupBaseDNs = serverConfig.GroupSearchBaseDNs
+		dto.GroupFilter = user.GroupSearchFilter
+	}
+
+	return dto
 }
 
 // LDAPUserDTO is a serializer for users mapped from LDAP
@@ -43,17 +103,145 @@ type LDAPUserDTO struct {
 	Surname        *LDAPAttribute           `json:"surname"`
 	Email          *LDAPAttribute           `json:"email"`
 	Username       *LDAPAttribute           `json:"login"`
+	Phone          *LDAPAttribute           `json:"phone"`
+	Title          *LDAPAttribute           `json:"title"`
 	IsGrafanaAdmin *bool                    `json:"isGrafanaAdmin"`
 	IsDisabled     bool                     `json:"isDisabled"`
 	OrgRoles       []RoleDTO                `json:"roles"`
 	Teams          []models.TeamOrgGroupDTO `json:"teams"`
+
+	// Metadata are the attributes of the metadata mappings by their key, only reported when the server has some
+	Metadata map[string]*LDAPAttribute `json:"metadata,omitempty"`
+
+	// Preferences are the mapped theme, timezone and homeDashboard, by the UID of the dashboard, only reported when they're mapped
+	Preferences map[string]*LDAPAttribute `json:"preferences,omitempty"`
+
+	// FolderPermissions is only reported when the server has folder mappings
+	FolderPermissions []FolderPermissionDTO `json:"folderPermissions,omitempty"`
+
+	// EmailValidation is only reported for an email which isn't a valid address, when the server validates them
+	EmailValidation *LDAPEmailValidationDTO `json:"emailValidation,omitempty"`
+
+	// Server is the host of the LDAP server the user was found on, whose attributes and group mappings are reported
+	Server string `json:"server,omitempty"`
+
+	// RequestedAttributes lists the attributes requested from the LDAP server by the user search
+	RequestedAttributes []string `json:"requestedAttributes,omitempty"`
+
+	// Search reports the searches which found the user and its groups, it's only reported by GetUserFromLDAP
+	Search *LDAPUserSearchDTO `json:"search,omitempty"`
+
+	// Timings is only reported when asked for with "?timings=true"
+	Timings *LDAPTimingsDTO `json:"timings,omitempty"`
+
+	// CachedAt is only reported for a user served from the cache of the LDAP lookups, see the user_cache_ttl setting
+	CachedAt *time.Time `json:"cachedAt,omitempty"`
+
+	// LastSyncedAt is the time of the last successful sync of the Grafana user of the LDAP user, by its DN.
+	// It isn't reported for a user who was never synced.
+	LastSyncedAt *time.Time `json:"lastSyncedAt,omitempty"`
+
+	// MatchCount is the number of entries matched by the user search on the server the user was found on.
+	// It isn't reported with "?timings=true" nor for a cached user, and Warning is only reported when the search matched several entries.
+	MatchCount int    `json:"matchCount,omitempty"`
+	Warning    string `json:"warning,omitempty"`
+
+	// OrgCount is the number of orgs the user gets a role in, only reported when the roles are filtered with "?orgIds="
+	OrgCount *int `json:"orgCount,omitempty"`
+
+	// GrafanaState is only reported when asked for with "?withGrafanaState=true"
+	GrafanaState *LDAPGrafanaStateDTO `json:"grafanaState,omitempty"`
+
+	// RawAttributes are the attributes of the LDAP entry of the user, by name, without the sensitive ones like the passwords.
+	// They are only reported when asked for with "?raw=true".
+	RawAttributes map[string][]string `json:"rawAttributes,omitempty"`
+}
+
+// LDAPGrafanaStateDTO is a serializer for the state of the Grafana account of an LDAP user. StateMismatch flags
+// an account whose disabled state differs from the LDAP one, the next sync of the user reconciles it.
+type LDAPGrafanaStateDTO struct {
+	Exists        bool  `json:"exists"`
+	UserId        int64 `json:"userId,omitempty"`
+	IsDisabled    bool  `json:"isDisabled"`
+	StateMismatch bool  `json:"stateMismatch"`
+}
+
+// LDAPRoleOverrideAppliedDTO is a serializer for the rule of the role_overrides which overrode the role of the user in an org
+type LDAPRoleOverrideAppliedDTO struct {
+	Rule         int             `json:"rule"`
+	Attribute    string          `json:"attribute"`
+	Value        string          `json:"value"`
+	OriginalRole models.RoleType `json:"originalRole"`
+}
+
+// LDAPUserMapDTO is a serializer for users mapped from LDAP with their roles keyed by org id, see GetUserFromLDAP
+type LDAPUserMapDTO struct {
+	*LDAPUserDTO
+	OrgRoles map[int64]RoleDTO `json:"roles"`
+}
+
+// newLDAPUserMapDTO keys the roles of the user by org id. The role matched in an org wins over
+// the group mappings which didn't match, as in the sync.
+func newLDAPUserMapDTO(user *LDAPUserDTO) *LDAPUserMapDTO {
+	roles := map[int64]RoleDTO{}
+
+	for _, role := range user.OrgRoles {
+		if existing, ok := roles[role.OrgId]; ok && (existing.OrgRole != "" || role.OrgRole == "") {
+			continue
+		}
+
+		roles[role.OrgId] = role
+	}
+
+	return &LDAPUserMapDTO{LDAPUserDTO: user, OrgRoles: roles}
+}
+
+// LDAPServerAttemptDTO is a serializer for the outcome of a user lookup on an LDAP server
+type LDAPServerAttemptDTO struct {
+	Host    string `json:"host"`
+	Port    int    `json:"port"`
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+
+	// MatchCount is only reported when the user search of the server matched entries
+	MatchCount int `json:"matchCount,omitempty"`
+
+	// SearchFilter is the filter of the user search, only reported for the servers which were searched
+	SearchFilter string `json:"searchFilter,omitempty"`
+}
+
+// LDAPLookupErrorDTO is a serializer for a failed user lookup, with the LDAP servers it attempted
+type LDAPLookupErrorDTO struct {
+	Message          string                  `json:"message"`
+	Error            string                  `json:"error,omitempty"`
+	AttemptedServers []*LDAPServerAttemptDTO `json:"attemptedServers,omitempty"`
+}
+
+// LDAPEmailValidationDTO is a serializer for an invalid email and the invalid_email policy applied to it
+type LDAPEmailValidationDTO struct {
+	Policy string `json:"policy"`
+	Error  string `json:"error"`
+}
+
+// LDAPTimingsDTO is a serializer for the time spent in each step of the user lookup, in milliseconds
+type LDAPTimingsDTO struct {
+	ConnectMs   float64 `json:"connectMs"`
+	BindMs      float64 `json:"bindMs"`
+	SearchMs    float64 `json:"searchMs"`
+	OrgFetchMs  float64 `json:"orgFetchMs"`
+	TeamFetchMs float64 `json:"teamFetchMs"`
 }
 
 // FetchOrgs fetches the organization(s) information by executing a single query to the database. Then, populating the DTO with the information retrieved.
 func (user *LDAPUserDTO) FetchOrgs() error {
+	return fetchOrgNames(user.OrgRoles)
+}
+
+// fetchOrgNames sets the names of the organizations of the roles and of their contributors, with a single query
+func fetchOrgNames(roles []RoleDTO) error {
 	orgIds := []int64{}
 
-	for _, or := range user.OrgRoles {
+	for _, or := range roles {
 		orgIds = append(orgIds, or.OrgId)
 	}
 
@@ -69,11 +257,15 @@ func (user *LDAPUserDTO) FetchOrgs() error {
 		orgNamesById[org.Id] = org.Name
 	}
 
-	for i, orgDTO := range user.OrgRoles {
+	for i, orgDTO := range roles {
 		orgName := orgNamesById[orgDTO.OrgId]
 
 		if orgName != "" {
-			user.OrgRoles[i].OrgName = orgName
+			roles[i].OrgName = orgName
+
+			for j := range orgDTO.Contributors {
+				roles[i].Contributors[j].OrgName = orgName
+			}
 		} else {
 			return errOrganizationNotFound(orgDTO.OrgId)
 		}
@@ -82,148 +274,1333 @@ func (user *LDAPUserDTO) FetchOrgs() error {
 	return nil
 }
 
+// FetchGrafanaState fetches the Grafana account of the LDAP user, by its DN or else by its login, and compares
+// its disabled state with the LDAP one. A user who never logged in has no account yet.
+func (user *LDAPUserDTO) FetchGrafanaState(extUser *models.ExternalUserInfo) error {
+	account, err := grafanaAccountOf(extUser)
+
+	if err == models.ErrUserNotFound {
+		user.GrafanaState = &LDAPGrafanaStateDTO{}
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	user.GrafanaState = &LDAPGrafanaStateDTO{
+		Exists:        true,
+		UserId:        account.Id,
+		IsDisabled:    account.IsDisabled,
+		StateMismatch: account.IsDisabled != user.IsDisabled,
+	}
+
+	return nil
+}
+
+// grafanaAccountOf finds the Grafana user of the LDAP user, by its DN, the auth id of the LDAP users,
+// or else by its login only, see grafanaUserByLogin
+func grafanaAccountOf(extUser *models.ExternalUserInfo) (*models.User, error) {
+	authQuery := &models.GetAuthInfoQuery{AuthModule: models.AuthModuleLDAP, AuthId: extUser.AuthId}
+	err := bus.Dispatch(authQuery)
+
+	if err == nil {
+		query := &models.GetUserByIdQuery{Id: authQuery.Result.UserId}
+		if err := bus.Dispatch(query); err != nil {
+			return nil, err
+		}
+
+		return query.Result, nil
+	}
+
+	if err != models.ErrUserNotFound {
+		return nil, err
+	}
+
+	return grafanaUserByLogin(extUser.Login)
+}
+
+// lastLDAPSyncOf returns the time of the last successful sync of the Grafana user of the LDAP user, found by its DN.
+// It's only informative, nil is returned when the user was never synced or the auth info can't be fetched.
+func lastLDAPSyncOf(extUser *models.ExternalUserInfo) *time.Time {
+	authQuery := &models.GetAuthInfoQuery{AuthModule: models.AuthModuleLDAP, AuthId: extUser.AuthId}
+	if err := bus.Dispatch(authQuery); err != nil {
+		if err != models.ErrUserNotFound {
+			logger.Debug("Failed to get the last sync of the user", "dn", extUser.AuthId, "error", err)
+		}
+		return nil
+	}
+
+	if authQuery.Result.LastSyncedAt.IsZero() {
+		return nil
+	}
+
+	return &authQuery.Result.LastSyncedAt
+}
+
 // LDAPServerDTO is a serializer for LDAP server statuses
 type LDAPServerDTO struct {
 	Host      string `json:"host"`
 	Port      int    `json:"port"`
 	Available bool   `json:"available"`
 	Error     string `json:"error"`
+
+	// ErrorCategory is "dns", "connection_refused", "timeout" or "other" for the unavailable servers,
+	// UnresolvedHost is the hostname which couldn't be resolved for the "dns" category
+	ErrorCategory  string `json:"errorCategory,omitempty"`
+	UnresolvedHost string `json:"unresolvedHost,omitempty"`
+
+	// ExceededTimeout is "dial_timeout" for the unavailable servers which didn't answer the dial in time,
+	// or "bind_timeout" and "search_timeout" for the available servers which didn't answer the bind or the search in time
+	ExceededTimeout string `json:"exceededTimeout,omitempty"`
+
+	// BindStatus is "ok", "timeout" or "failed", the bind is only attempted with the available servers
+	BindStatus    string  `json:"bindStatus,omitempty"`
+	BindLatencyMs float64 `json:"bindLatencyMs,omitempty"`
+	BindError     string  `json:"bindError,omitempty"`
+
+	// BindMethod is "simple" or "sasl_external" when the bind is done with the client certificate
+	BindMethod string `json:"bindMethod,omitempty"`
+
+	// SearchStatus is "ok", "timeout" or "failed", the search is only attempted once the bind succeeded
+	SearchStatus    string  `json:"searchStatus,omitempty"`
+	SearchLatencyMs float64 `json:"searchLatencyMs,omitempty"`
+	SearchError     string  `json:"searchError,omitempty"`
+
+	// LatencyMs is how long the dial and the bind with the available servers took
+	LatencyMs float64 `json:"latencyMs,omitempty"`
+
+	// TLSInsecure is set when the TLS certificate of the server isn't verified
+	TLSInsecure bool `json:"tlsInsecure,omitempty"`
+
+	// Certificate is the TLS certificate of the server, CertificateExpiring is set when it expires soon
+	Certificate         *LDAPCertificateDTO `json:"certificate,omitempty"`
+	CertificateExpiring bool                `json:"certificateExpiring,omitempty"`
+
+	// QuarantinedUntil is the end of the quarantine of a server failing repeatedly, which the lookups don't dial
+	QuarantinedUntil *time.Time `json:"quarantinedUntil,omitempty"`
+}
+
+// LDAPCertificateDTO is a serializer for the TLS certificates of the LDAP servers
+type LDAPCertificateDTO struct {
+	Subject  string    `json:"subject"`
+	Issuer   string    `json:"issuer"`
+	NotAfter time.Time `json:"notAfter"`
 }
 
-// ReloadLDAPCfg reloads the LDAP configuration
+// ReloadLDAPCfg reloads the LDAP configuration, and reports the servers, group mappings and attributes it changed.
+// The pooled connections are cycled, so a rotated TLS certificate is used without a restart.
 func (server *HTTPServer) ReloadLDAPCfg() Response {
 	if !ldap.IsEnabled() {
-		return Error(http.StatusBadRequest, "LDAP is not enabled", nil)
+		return ldapDisabledError()
+	}
+
+	return ldapReloadResponse(reloadLDAPConfig())
+}
+
+// ldapReloadResponse reports the changes of the reloaded LDAP config, or why it couldn't be reloaded
+func ldapReloadResponse(changes *ldap.ConfigDiff, err error) Response {
+	if conflictErr, ok := err.(*ldap.ConfigConflictError); ok {
+		resp := JSON(http.StatusInternalServerError, &LDAPReloadConflictsDTO{
+			Message:   "Failed to reload ldap config, the included config files conflict.",
+			Conflicts: conflictErr.Conflicts,
+		})
+		resp.errMessage = "Failed to reload ldap config."
+		resp.err = err
+
+		return resp
+	}
+
+	if err == ldap.ErrNoServersConfigured {
+		return ldapConfigError("Failed to reload ldap config.", err)
 	}
 
-	err := ldap.ReloadConfig()
 	if err != nil {
 		return Error(http.StatusInternalServerError, "Failed to reload ldap config.", err)
 	}
-	return Success("LDAP config reloaded")
+
+	// the pooled connections of the previous config may be secured with rotated certificates
+	multildap.CycleConnections()
+
+	if changes.IsEmpty() {
+		logger.Info("LDAP config reloaded, nothing changed")
+	} else {
+		logger.Info(
+			"LDAP config reloaded",
+			"serversAdded", len(changes.ServersAdded),
+			"serversRemoved", len(changes.ServersRemoved),
+			"groupMappingsAdded", len(changes.GroupMappingsAdded),
+			"groupMappingsRemoved", len(changes.GroupMappingsRemoved),
+			"groupMappingsChanged", len(changes.GroupMappingsChanged),
+			"attributesChanged", len(changes.AttributesChanged),
+		)
+	}
+
+	return JSON(http.StatusOK, &LDAPReloadResultDTO{
+		Message: "LDAP config reloaded",
+		Changes: changes,
+	})
 }
 
-// GetLDAPStatus attempts to connect to all the configured LDAP servers and returns information on whenever they're availabe or not.
-func (server *HTTPServer) GetLDAPStatus(c *models.ReqContext) Response {
+// LDAPReloadResultDTO is a serializer for the result of a reload of the LDAP config, with what it changed
+type LDAPReloadResultDTO struct {
+	Message string           `json:"message"`
+	Changes *ldap.ConfigDiff `json:"changes"`
+}
+
+// LDAPReloadConflictsDTO is a serializer for the conflicts between the included LDAP config files
+type LDAPReloadConflictsDTO struct {
+	Message   string   `json:"message"`
+	Conflicts []string `json:"conflicts"`
+}
+
+// LDAPConfigHashDTO is a serializer for the hash of the loaded LDAP config
+type LDAPConfigHashDTO struct {
+	ConfigHash string `json:"configHash"`
+}
+
+// LDAPSyncResultDTO is a serializer for the result of a user sync with LDAP
+type LDAPSyncResultDTO struct {
+	Message string            `json:"message"`
+	Changes *ldapsync.Changes `json:"changes"`
+
+	// UserId is only reported for the user created by the sync of a login, see syncNewLDAPUser
+	UserId int64 `json:"userId,omitempty"`
+}
+
+// LDAPSyncPreviewDTO is the response of a dry run of the sync of a user, see ldapsync.Preview
+type LDAPSyncPreviewDTO struct {
+	Message string `json:"message"`
+	DryRun  bool   `json:"dryRun"`
+
+	*ldapsync.Preview
+}
+
+// PostSyncUserWithLDAP enables a single Grafana user to be synchronized against LDAP. It returns the changes actually applied to the user.
+// With the dryRun query parameter, it returns what the sync would apply to the user instead, without changing anything.
+// The user is identified by its id, or by its login with POST /api/admin/ldap/sync?login=. A login without
+// Grafana user is looked up in LDAP and its user is created, see ldapsync.SyncNewUser.
+func (server *HTTPServer) PostSyncUserWithLDAP(c *models.ReqContext) Response {
+	// a dry run changes nothing, there's no need to guard it against the retries
+	if c.QueryBool("dryRun") {
+		return server.syncUserWithLDAP(c)
+	}
+
+	return withIdempotencyKey(c, func() Response {
+		return server.syncUserWithLDAP(c)
+	})
+}
+
+func (server *HTTPServer) syncUserWithLDAP(c *models.ReqContext) Response {
 	if !ldap.IsEnabled() {
-		return Error(http.StatusBadRequest, "LDAP is not enabled", nil)
+		return ldapDisabledError()
 	}
 
 	ldapConfig, err := getLDAPConfig()
 
 	if err != nil {
-		return Error(http.StatusBadRequest, "Failed to obtain the LDAP configuration. Please verify the configuration and try again.", err)
+		return ldapConfigError("Failed to obtain the LDAP configuration. Please verify the configuration and try again.", err)
 	}
 
-	ldap := newLDAP(ldapConfig.Servers)
+	login := strings.TrimSpace(c.Query("login"))
+	user, err := ldapSyncedUser(c.ParamsInt64(":id"), login)
 
-	statuses, err := ldap.Ping()
+	if err == models.ErrUserNotFound && login != "" {
+		return syncNewLDAPUser(c, ldapConfig, login)
+	}
 
 	if err != nil {
-		return Error(http.StatusBadRequest, "Failed to connect to the LDAP server(s)", err)
+		if err == models.ErrUserNotFound {
+			return Error(http.StatusNotFound, models.ErrUserNotFound.Error(), nil)
+		}
+
+		return Error(http.StatusInternalServerError, "Failed to get user", err)
 	}
 
-	serverDTOs := []*LDAPServerDTO{}
-	for _, status := range statuses {
-		s := &LDAPServerDTO{
-			Host:      status.Host,
-			Available: status.Available,
-			Port:      status.Port,
-		}
+	if c.QueryBool("dryRun") {
+		return previewLDAPUserSync(ldapConfig, user)
+	}
 
-		if status.Error != nil {
-			s.Error = status.Error.Error()
-		}
+	return server.syncLDAPUser(c, ldapConfig, user)
+}
 
-		serverDTOs = append(serverDTOs, s)
+// ldapSyncedUser finds the Grafana user to sync, by its login when there's one, else by its id
+func ldapSyncedUser(userId int64, login string) (*models.User, error) {
+	if login != "" {
+		return grafanaUserByLogin(login)
 	}
 
-	return JSON(http.StatusOK, serverDTOs)
+	query := &models.GetUserByIdQuery{Id: userId}
+	if err := bus.Dispatch(query); err != nil {
+		return nil, err
+	}
+
+	return query.Result, nil
 }
 
-// GetUserFromLDAP finds an user based on a username in LDAP. This helps illustrate how would the particular user be mapped in Grafana when synced.
-func (server *HTTPServer) GetUserFromLDAP(c *models.ReqContext) Response {
-	if !ldap.IsEnabled() {
-		return Error(http.StatusBadRequest, "LDAP is not enabled", nil)
+// grafanaUserByLogin finds the Grafana user with the login. Unlike GetUserByLoginQuery, it doesn't fall back
+// to the emails, which would find another user whose email is the login.
+func grafanaUserByLogin(login string) (*models.User, error) {
+	query := &models.GetUserByLoginQuery{LoginOrEmail: login}
+	if err := bus.Dispatch(query); err != nil {
+		return nil, err
 	}
 
-	ldapConfig, err := getLDAPConfig()
+	if !strings.EqualFold(query.Result.Login, login) {
+		return nil, models.ErrUserNotFound
+	}
 
-	if err != nil {
-		return Error(http.StatusBadRequest, "Failed to obtain the LDAP configuration", err)
+	return query.Result, nil
+}
+
+// syncNewLDAPUser creates the Grafana user of the LDAP user with the given login, which never logged in.
+// A dry run only checks the user is in LDAP.
+func syncNewLDAPUser(c *models.ReqContext, ldapConfig *ldap.Config, login string) Response {
+	ldapServer := newLDAP(ldapConfig.Servers)
+	defer ldapServer.Close()
+
+	if c.QueryBool("dryRun") {
+		_, _, err := ldapServer.User(login)
+
+		if resp := ldapSyncError(&models.User{Login: login}, err); resp != nil {
+			return resp
+		}
+
+		return JSON(http.StatusOK, &LDAPSyncPreviewDTO{
+			Message: "Dry run, the user would be created as it has no Grafana user yet",
+			DryRun:  true,
+		})
 	}
 
-	ldap := newLDAP(ldapConfig.Servers)
+	user, changes, err := ldapsync.SyncNewUser(ldapServer, login)
 
-	username := c.Params(":username")
+	if resp := ldapSyncError(&models.User{Login: login}, err); resp != nil {
+		return resp
+	}
 
-	if len(username) == 0 {
-		return Error(http.StatusBadRequest, "Validation error. You must specify an username", nil)
+	return JSON(http.StatusOK, &LDAPSyncResultDTO{
+		Message: "User created and synced successfully",
+		Changes: changes,
+		UserId:  user.Id,
+	})
+}
+
+// previewLDAPUserSync returns what the sync of the Grafana user with LDAP would apply, see ldapsync.PreviewSync
+func previewLDAPUserSync(ldapConfig *ldap.Config, user *models.User) Response {
+	if resp := checkLDAPUser(user); resp != nil {
+		return resp
 	}
 
-	user, serverConfig, err := ldap.User(username)
+	ldapServer := newLDAP(ldapConfig.Servers)
+	defer ldapServer.Close()
 
-	if user == nil {
-		return Error(http.StatusNotFound, "No user was found on the LDAP server(s)", err)
+	preview, err := ldapsync.PreviewSync(ldapServer, user)
+
+	if resp := ldapSyncError(user, err); resp != nil {
+		return resp
 	}
 
-	logger.Debug("user found", "user", user)
+	message := "Dry run, the user would be synced"
+	if preview.Changes.Action == ldapsync.ActionDisabled {
+		message = "Dry run, the user would be disabled as it isn't found in LDAP"
+	}
 
-	name, surname := splitName(user.Name)
+	return JSON(http.StatusOK, &LDAPSyncPreviewDTO{
+		Message: message,
+		DryRun:  true,
+		Preview: preview,
+	})
+}
 
-	u := &LDAPUserDTO{
-		Name:           &LDAPAttribute{serverConfig.Attr.Name, name},
-		Surname:        &LDAPAttribute{serverConfig.Attr.Surname, surname},
-		Email:          &LDAPAttribute{serverConfig.Attr.Email, user.Email},
-		Username:       &LDAPAttribute{serverConfig.Attr.Username, user.Login},
-		IsGrafanaAdmin: user.IsGrafanaAdmin,
-		IsDisabled:     user.IsDisabled,
+// checkLDAPUser checks the Grafana user is authenticated with LDAP, it returns the error response if not
+func checkLDAPUser(user *models.User) Response {
+	authModuleQuery := &models.GetAuthInfoQuery{UserId: user.Id, AuthModule: models.AuthModuleLDAP}
+
+	if err := bus.Dispatch(authModuleQuery); err != nil {
+		if err == models.ErrUserNotFound {
+			return Error(http.StatusBadRequest, "User is not an LDAP user", nil)
+		}
+
+		return Error(http.StatusInternalServerError, "Failed to get user auth info", err)
 	}
 
-	orgRoles := []RoleDTO{}
+	return nil
+}
 
-	for _, g := range serverConfig.Groups {
-		role := &RoleDTO{}
+// ldapSyncError returns the error response of a failed sync of the user, nil if it didn't fail
+func ldapSyncError(user *models.User, err error) Response {
+	switch {
+	case err == nil:
+		return nil
+	case err == ldapsync.ErrGrafanaAdmin:
+		return Error(http.StatusBadRequest, fmt.Sprintf("Refusing to sync grafana super admin \"%s\" - it would be disabled", user.Login), err)
+	case err == ldapsync.ErrUserFiltered:
+		return Error(http.StatusBadRequest, fmt.Sprintf("User \"%s\" is excluded from the LDAP sync by the sync_allowlist or sync_denylist settings", user.Login), err)
+	case err == multildap.ErrUnreachable:
+		return Error(http.StatusServiceUnavailable, "None of the LDAP servers are reachable", err)
+	case err == ldapsync.ErrPartialOutage:
+		return Error(http.StatusServiceUnavailable, "User not found while some of the LDAP servers are unreachable, it wasn't disabled", err)
+	case err == multildap.ErrDidNotFindUser:
+		return Error(http.StatusNotFound, fmt.Sprintf("User \"%s\" was found neither in Grafana nor in LDAP", user.Login), err)
+	case err == ldapsync.ErrSignupNotAllowed:
+		return Error(http.StatusBadRequest, fmt.Sprintf("User \"%s\" has no Grafana user yet and allow_sign_up is disabled", user.Login), err)
+	default:
+		return Error(http.StatusInternalServerError, "Failed to sync the user with LDAP", err)
+	}
+}
 
-		if isMatchToLDAPGroup(user, g) {
-			role.OrgId = g.OrgID
-			role.OrgRole = user.OrgRoles[g.OrgID]
-			role.GroupDN = g.GroupDN
+// syncLDAPUser syncs the Grafana user with LDAP and revokes the sessions of the user when it's disabled.
+// It's the core of the single user syncs, whichever way the user is identified.
+func (server *HTTPServer) syncLDAPUser(c *models.ReqContext, ldapConfig *ldap.Config, user *models.User) Response {
+	if resp := checkLDAPUser(user); resp != nil {
+		return resp
+	}
 
-			orgRoles = append(orgRoles, *role)
-		} else {
-			role.OrgId = g.OrgID
-			role.GroupDN = g.GroupDN
+	ldapServer := newLDAP(ldapConfig.Servers)
+	defer ldapServer.Close()
 
-			orgRoles = append(orgRoles, *role)
+	changes, err := ldapsync.SyncUser(ldapServer, user)
+
+	if resp := ldapSyncError(user, err); resp != nil {
+		return resp
+	}
+
+	if changes.Action == ldapsync.ActionDisabled {
+		if err := server.AuthTokenService.RevokeAllUserTokens(c.Req.Context(), user.Id); err != nil {
+			return Error(http.StatusInternalServerError, "Failed to revoke the tokens of the disabled user", err)
 		}
+
+		return JSON(http.StatusOK, &LDAPSyncResultDTO{
+			Message: "User not found in LDAP. Disabled the user without updating information",
+			Changes: changes,
+		})
 	}
 
-	u.OrgRoles = orgRoles
+	return JSON(http.StatusOK, &LDAPSyncResultDTO{
+		Message: "User synced successfully",
+		Changes: changes,
+	})
+}
 
-	logger.Debug("mapping org roles", "orgsRoles", u.OrgRoles)
-	err = u.FetchOrgs()
+// GetLDAPSyncHistory returns the last user syncs, the most recent first. Their number and retention are set by the [auth.ldap] settings.
+func (server *HTTPServer) GetLDAPSyncHistory(c *models.ReqContext) Response {
+	if !ldap.IsEnabled() {
+		return ldapDisabledError()
+	}
 
-	if err != nil {
-		return Error(http.StatusBadRequest, "An oganization was not found - Please verify your LDAP configuration", err)
+	return JSON(http.StatusOK, getLDAPSyncHistory().Entries())
+}
+
+// LDAPPreflightDTO is a serializer for the result of the pre-flight checks of the LDAP sync
+type LDAPPreflightDTO struct {
+	Valid         bool    `json:"valid"`
+	MissingOrgIds []int64 `json:"missingOrgIds"`
+}
+
+// PostPreflightLDAPSync checks the LDAP configuration can be used to sync the users. It lists the organizations referenced by the group mappings which don't exist.
+func (server *HTTPServer) PostPreflightLDAPSync(c *models.ReqContext) Response {
+	if !ldap.IsEnabled() {
+		return ldapDisabledError()
 	}
 
-	cmd := &models.GetTeamsForLDAPGroupCommand{Groups: user.Groups}
-	err = bus.Dispatch(cmd)
+	ldapConfig, err := getLDAPConfig()
 
-	if err != bus.ErrHandlerNotFound && err != nil {
-		return Error(http.StatusBadRequest, "Unable to find the teams for this user", err)
+	if err != nil {
+		return ldapConfigError("Failed to obtain the LDAP configuration. Please verify the configuration and try again.", err)
 	}
 
-	u.Teams = cmd.Result
+	missing, err := ldapsync.MissingOrgs(ldapConfig)
 
-	return JSON(200, u)
+	if err != nil {
+		return Error(http.StatusInternalServerError, "Failed to verify the organizations of the LDAP configuration", err)
+	}
+
+	return JSON(http.StatusOK, &LDAPPreflightDTO{
+		Valid:         len(missing) == 0,
+		MissingOrgIds: missing,
+	})
 }
 
-// isMatchToLDAPGroup determines if we were able to match an LDAP group to an organization+role.
-// Since we allow one role per organization. If it's set, we were able to match it.
-func isMatchToLDAPGroup(user *models.ExternalUserInfo, groupConfig *ldap.GroupToOrgRole) bool {
-	return user.OrgRoles[groupConfig.OrgID] == groupConfig.OrgRole
+// GetLDAPStatus attempts to connect to all the configured LDAP servers and returns information on whenever they're availabe or not.
+// Only the servers of an org are checked with "?orgId=".
+func (server *HTTPServer) GetLDAPStatus(c *models.ReqContext) Response {
+	if !ldap.IsEnabled() {
+		return ldapDisabledError()
+	}
+
+	ldapConfig, err := getLDAPConfig()
+
+	if err != nil {
+		return ldapConfigError("Failed to obtain the LDAP configuration. Please verify the configuration and try again.", err)
+	}
+
+	servers, resp := scopeLDAPServers(c, ldapConfig)
+	if resp != nil {
+		return resp
+	}
+
+	ldapServer := newLDAP(servers)
+	defer ldapServer.Close()
+
+	statuses, err := ldapServer.Ping()
+
+	if err != nil {
+		return Error(http.StatusBadRequest, "Failed to connect to the LDAP server(s)", err)
+	}
+
+	available := false
+	serverDTOs := []*LDAPServerDTO{}
+	for _, status := range statuses {
+		available = available || status.Available
+
+		s := &LDAPServerDTO{
+			Host:            status.Host,
+			Available:       status.Available,
+			Port:            status.Port,
+			TLSInsecure:     status.TLSInsecure,
+			ExceededTimeout: status.ExceededTimeout,
+		}
+
+		if status.Error != nil {
+			s.Error = status.Error.Error()
+			s.ErrorCategory = status.ErrorCategory
+			s.UnresolvedHost = status.UnresolvedHost
+		}
+
+		if status.BindStatus != "" {
+			s.BindStatus = status.BindStatus
+			s.BindLatencyMs = milliseconds(status.BindLatency)
+			s.BindMethod = status.BindMethod
+			s.LatencyMs = milliseconds(status.Latency)
+		}
+
+		if status.BindError != nil {
+			s.BindError = status.BindError.Error()
+		}
+
+		if status.SearchStatus != "" {
+			s.SearchStatus = status.SearchStatus
+			s.SearchLatencyMs = milliseconds(status.SearchLatency)
+		}
+
+		if status.SearchError != nil {
+			s.SearchError = status.SearchError.Error()
+		}
+
+		if status.Certificate != nil {
+			s.Certificate = &LDAPCertificateDTO{
+				Subject:  status.Certificate.Subject,
+				Issuer:   status.Certificate.Issuer,
+				NotAfter: status.Certificate.NotAfter,
+			}
+			s.CertificateExpiring = status.CertificateExpiring
+		}
+
+		if !status.QuarantinedUntil.IsZero() {
+			quarantinedUntil := status.QuarantinedUntil
+			s.QuarantinedUntil = &quarantinedUntil
+		}
+
+		serverDTOs = append(serverDTOs, s)
+	}
+
+	// The LDAP logins are failing (or falling through, see the "on_unreachable" setting) when none of the servers are available
+	if !available {
+		return JSON(http.StatusServiceUnavailable, serverDTOs)
+	}
+
+	return JSON(http.StatusOK, serverDTOs)
+}
+
+// GetLDAPConfigHash returns the hash of the LDAP config currently loaded by this instance. Comparing the hashes across the instances reveals config drifts.
+func (server *HTTPServer) GetLDAPConfigHash(c *models.ReqContext) Response {
+	if !ldap.IsEnabled() {
+		return ldapDisabledError()
+	}
+
+	ldapConfig, err := getLDAPConfig()
+
+	if err != nil {
+		return ldapConfigError("Failed to obtain the LDAP configuration. Please verify the configuration and try again.", err)
+	}
+
+	hash, err := ldapConfig.Hash()
+
+	if err != nil {
+		return Error(http.StatusInternalServerError, "Failed to compute the hash of the LDAP configuration", err)
+	}
+
+	return JSON(http.StatusOK, &LDAPConfigHashDTO{ConfigHash: hash})
+}
+
+// Shapes of the roles returned by GetUserFromLDAP
+const (
+	// ldapUserShapeList returns the roles as a list, the default
+	ldapUserShapeList = "list"
+
+	// ldapUserShapeMap returns the roles keyed by org id
+	ldapUserShapeMap = "map"
+)
+
+// ldapAttributeOverrides are the query params of GetUserFromLDAP overriding the attributes of the servers
+var ldapAttributeOverrides = map[string]func(attr *ldap.AttributeMap, value string){
+	"loginAttr":    func(attr *ldap.AttributeMap, value string) { attr.Username = value },
+	"emailAttr":    func(attr *ldap.AttributeMap, value string) { attr.Email = value },
+	"nameAttr":     func(attr *ldap.AttributeMap, value string) { attr.Name = value },
+	"surnameAttr":  func(attr *ldap.AttributeMap, value string) { attr.Surname = value },
+	"memberOfAttr": func(attr *ldap.AttributeMap, value string) { attr.MemberOf = value },
+}
+
+// overrideLDAPAttributes returns copies of the server configs with the attributes overridden by the query params,
+// so the loaded config, shared with the other requests, is left untouched. The connections to the servers of the
+// copies aren't pooled, see ldap.ServerConfig.Copy.
+func overrideLDAPAttributes(c *models.ReqContext, servers []*ldap.ServerConfig) []*ldap.ServerConfig {
+	overridden := false
+	for param := range ldapAttributeOverrides {
+		overridden = overridden || c.Query(param) != ""
+	}
+
+	if !overridden {
+		return servers
+	}
+
+	result := make([]*ldap.ServerConfig, 0, len(servers))
+	for _, server := range servers {
+		copied := server.Copy()
+
+		for param, override := range ldapAttributeOverrides {
+			if value := c.Query(param); value != "" {
+				override(&copied.Attr, value)
+			}
+		}
+
+		result = append(result, copied)
+	}
+
+	return result
+}
+
+// scopeLDAPServers returns the servers serving the org of the "?orgId=" query param, see ldap.Config.ServersOfOrg.
+// It returns all of them without the param, and an error response when the org has no server.
+func scopeLDAPServers(c *models.ReqContext, config *ldap.Config) ([]*ldap.ServerConfig, Response) {
+	value := c.Query("orgId")
+	if value == "" {
+		return config.Servers, nil
+	}
+
+	orgId, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || orgId <= 0 {
+		return nil, Error(http.StatusBadRequest, "Validation error. The orgId must be an org id", err)
+	}
+
+	servers := config.ServersOfOrg(orgId)
+	if len(servers) == 0 {
+		return nil, Error(http.StatusNotFound, fmt.Sprintf("No LDAP server serves the organization %d", orgId), nil)
+	}
+
+	return servers, nil
+}
+
+// parseOrgIdsFilter parses the org ids of the "?orgIds=" query param, either comma separated or repeated.
+// It returns nil without the param.
+func parseOrgIdsFilter(c *models.ReqContext) (map[int64]bool, error) {
+	values := c.QueryStrings("orgIds")
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	orgIds := map[int64]bool{}
+	for _, value := range values {
+		for _, id := range strings.Split(value, ",") {
+			orgId, err := strconv.ParseInt(strings.TrimSpace(id), 10, 64)
+			if err != nil {
+				return nil, err
+			}
+
+			orgIds[orgId] = true
+		}
+	}
+
+	return orgIds, nil
+}
+
+// filterOrgRoles keeps only the roles of the given orgs, the number of orgs the user gets a role in
+// is reported beforehand in OrgCount
+func (user *LDAPUserDTO) filterOrgRoles(orgIds map[int64]bool) {
+	withRole := map[int64]bool{}
+	filtered := []RoleDTO{}
+
+	for _, role := range user.OrgRoles {
+		if role.OrgRole != "" {
+			withRole[role.OrgId] = true
+		}
+
+		if orgIds[role.OrgId] {
+			filtered = append(filtered, role)
+		}
+	}
+
+	count := len(withRole)
+	user.OrgCount = &count
+	user.OrgRoles = filtered
+}
+
+// GetUserFromLDAP finds an user based on a username in LDAP. This helps illustrate how would the particular user be mapped in Grafana when synced.
+// The roles are keyed by org id with "?shape=map".
+// The attributes of the servers are overridden for this lookup only with "?loginAttr=", "?emailAttr=", "?nameAttr=",
+// "?surnameAttr=" and "?memberOfAttr=", to try another mapping without editing the configuration.
+// The roles are only returned for some orgs with "?orgIds=1,2,3", the total number of orgs is still reported.
+// The state of the Grafana account is compared with the LDAP one with "?withGrafanaState=true".
+// The attributes of the LDAP entry of the user are attached with "?raw=true", to debug the attribute mapping.
+// The user is served from the cache of the lookups when it is cached, unless bypassed with "?noCache=true".
+// Only the servers of an org are queried with "?orgId=".
+func (server *HTTPServer) GetUserFromLDAP(c *models.ReqContext) Response {
+	if !ldap.IsEnabled() {
+		return ldapDisabledError()
+	}
+
+	ldapConfig, err := getLDAPConfig()
+
+	if err != nil {
+		return ldapConfigError("Failed to obtain the LDAP configuration", err)
+	}
+
+	servers, resp := scopeLDAPServers(c, ldapConfig)
+	if resp != nil {
+		return resp
+	}
+
+	ldapServer := newLDAP(overrideLDAPAttributes(c, servers))
+	defer ldapServer.Close()
+
+	username := c.Params(":username")
+
+	if len(username) == 0 {
+		return Error(http.StatusBadRequest, "Validation error. You must specify an username", nil)
+	}
+
+	shape := c.Query("shape")
+	if shape != "" && shape != ldapUserShapeList && shape != ldapUserShapeMap {
+		return Error(http.StatusBadRequest, "Validation error. The shape must be either \"list\" or \"map\"", nil)
+	}
+
+	orgIds, err := parseOrgIdsFilter(c)
+	if err != nil {
+		return Error(http.StatusBadRequest, "Validation error. The orgIds must be a comma separated list of org ids", err)
+	}
+
+	var user *models.ExternalUserInfo
+	var serverConfig ldap.ServerConfig
+	var timings *multildap.Timings
+	var attempts []*multildap.ServerAttempt
+
+	withTimings := c.QueryBool("timings")
+
+	// the cache is bypassed to measure the lookup, the overridden attributes never hit it as they replace the configs
+	var cached *multildap.CachedUser
+	if !withTimings && !c.QueryBool("noCache") {
+		cached = ldapServer.CachedUser(username)
+	}
+
+	if cached != nil {
+		user, serverConfig = cached.User, cached.Config
+	} else if withTimings {
+		user, serverConfig, timings, err = ldapServer.UserWithTimings(username)
+	} else {
+		user, serverConfig, attempts, err = ldapServer.UserWithAttempts(username)
+	}
+
+	if err == multildap.ErrUnreachable {
+		return ldapLookupError(http.StatusServiceUnavailable, "None of the LDAP servers are reachable", err, attempts)
+	}
+
+	if err == ldap.ErrAmbiguousUser {
+		return ldapLookupError(http.StatusConflict, "The user search matched several LDAP entries - Please verify the search filter", err, attempts)
+	}
+
+	if user == nil {
+		return ldapLookupError(http.StatusNotFound, "No user was found on the LDAP server(s)", err, attempts)
+	}
+
+	logger.Debug("user found", "user", user)
+
+	u := newLDAPUserDTO(user, serverConfig)
+	u.Search = newLDAPUserSearchDTO(username, user, serverConfig)
+
+	if cached != nil {
+		u.CachedAt = &cached.CachedAt
+	}
+
+	for _, attempt := range attempts {
+		if attempt.Outcome != multildap.AttemptFound {
+			continue
+		}
+
+		u.MatchCount = attempt.MatchCount
+		if attempt.MatchCount > 1 {
+			u.Warning = fmt.Sprintf(
+				"The user search matched %d entries, %s was picked as the first one by DN - Please verify the search filter",
+				attempt.MatchCount, user.AuthId,
+			)
+		}
+	}
+
+	u.LastSyncedAt = lastLDAPSyncOf(user)
+
+	if orgIds != nil {
+		u.filterOrgRoles(orgIds)
+	}
+
+	logger.Debug("mapping org roles", "orgsRoles", u.OrgRoles)
+	orgFetchStart := time.Now()
+	err = u.FetchOrgs()
+	orgFetchDuration := time.Since(orgFetchStart)
+
+	if err != nil {
+		return Error(http.StatusBadRequest, "An oganization was not found - Please verify your LDAP configuration", err)
+	}
+
+	teamFetchStart := time.Now()
+	err = u.FetchTeams(user, serverConfig)
+	teamFetchDuration := time.Since(teamFetchStart)
+
+	if err != nil {
+		return Error(http.StatusBadRequest, "Unable to find the teams for this user - Please verify your LDAP configuration", err)
+	}
+
+	if c.QueryBool("withGrafanaState") {
+		if err := u.FetchGrafanaState(user); err != nil {
+			return Error(http.StatusInternalServerError, "Failed to get the Grafana user", err)
+		}
+	}
+
+	if c.QueryBool("raw") {
+		attributes, err := ldapServer.UserAttributes(username)
+		if err != nil {
+			return Error(http.StatusInternalServerError, "Failed to get the LDAP attributes of the user", err)
+		}
+
+		u.RawAttributes = attributes
+	}
+
+	if withTimings {
+		u.Timings = &LDAPTimingsDTO{
+			ConnectMs:   milliseconds(timings.Connect),
+			BindMs:      milliseconds(timings.Bind),
+			SearchMs:    milliseconds(timings.Search),
+			OrgFetchMs:  milliseconds(orgFetchDuration),
+			TeamFetchMs: milliseconds(teamFetchDuration),
+		}
+	}
+
+	if shape == ldapUserShapeMap {
+		return JSON(200, newLDAPUserMapDTO(u))
+	}
+
+	return JSON(200, u)
+}
+
+// LDAPGroupDTO is a serializer for an LDAP group and what its members get in Grafana, see GetGroupFromLDAP
+type LDAPGroupDTO struct {
+	GroupDN string                `json:"groupDN"`
+	Servers []*LDAPGroupServerDTO `json:"servers"`
+
+	// Teams are the teams synced with the group
+	Teams []models.TeamOrgGroupDTO `json:"teams"`
+}
+
+// LDAPGroupServerDTO is a serializer for the lookup of a group on an LDAP server, with the roles and folder permissions
+// its group mappings give to the members of the group. Found is only reported when the group could be looked up.
+type LDAPGroupServerDTO struct {
+	Host      string `json:"host"`
+	Port      int    `json:"port"`
+	Available bool   `json:"available"`
+	Error     string `json:"error,omitempty"`
+	Found     *bool  `json:"found,omitempty"`
+
+	IsGrafanaAdmin    *bool                 `json:"isGrafanaAdmin"`
+	OrgRoles          []RoleDTO             `json:"roles"`
+	FolderPermissions []FolderPermissionDTO `json:"folderPermissions,omitempty"`
+}
+
+// GetGroupFromLDAP looks up a group DN on the LDAP servers and shows what its members would get in Grafana when synced:
+// the roles and folder permissions of the group mappings of each server, and the teams synced with the group.
+// Like for the users, the role_conflict policy of the server decides which group mapping of an org wins,
+// the other mappings matching the group are its contributors. Only the servers of an org are queried with "?orgId=".
+func (server *HTTPServer) GetGroupFromLDAP(c *models.ReqContext) Response {
+	if !ldap.IsEnabled() {
+		return ldapDisabledError()
+	}
+
+	ldapConfig, err := getLDAPConfig()
+
+	if err != nil {
+		return ldapConfigError("Failed to obtain the LDAP configuration", err)
+	}
+
+	groupDN := c.Params(":groupDN")
+
+	if len(groupDN) == 0 {
+		return Error(http.StatusBadRequest, "Validation error. You must specify a group DN", nil)
+	}
+
+	servers, resp := scopeLDAPServers(c, ldapConfig)
+	if resp != nil {
+		return resp
+	}
+
+	ldapServer := newLDAP(servers)
+	defer ldapServer.Close()
+
+	lookups, err := ldapServer.FindGroup(groupDN)
+
+	if err != nil {
+		return Error(http.StatusBadRequest, "Failed to look up the group in the LDAP server(s)", err)
+	}
+
+	available := false
+	result := &LDAPGroupDTO{GroupDN: groupDN, Servers: []*LDAPGroupServerDTO{}}
+
+	for _, lookup := range lookups {
+		available = available || lookup.Available
+
+		dto := newLDAPGroupServerDTO(groupDN, lookup.Config)
+		dto.Host = lookup.Host
+		dto.Port = lookup.Port
+		dto.Available = lookup.Available
+
+		if lookup.Error != nil {
+			dto.Error = lookup.Error.Error()
+		}
+
+		if lookup.Checked {
+			found := lookup.Found
+			dto.Found = &found
+		}
+
+		if err := fetchOrgNames(dto.OrgRoles); err != nil {
+			return Error(http.StatusBadRequest, "An oganization was not found - Please verify your LDAP configuration", err)
+		}
+
+		result.Servers = append(result.Servers, dto)
+	}
+
+	cmd := &models.GetTeamsForLDAPGroupCommand{Groups: []string{groupDN}}
+	if err := bus.Dispatch(cmd); err != bus.ErrHandlerNotFound && err != nil {
+		return Error(http.StatusBadRequest, "Unable to find the teams for this group - Please verify your LDAP configuration", err)
+	}
+
+	result.Teams = cmd.Result
+
+	// Like the status of the servers, nothing could be looked up when none of the servers are available
+	if !available {
+		return JSON(http.StatusServiceUnavailable, result)
+	}
+
+	return JSON(http.StatusOK, result)
+}
+
+// newLDAPGroupServerDTO maps the group to the roles and folder permissions of the group mappings of the server,
+// as the sync does for the members of the group
+func newLDAPGroupServerDTO(groupDN string, serverConfig *ldap.ServerConfig) *LDAPGroupServerDTO {
+	dto := &LDAPGroupServerDTO{OrgRoles: []RoleDTO{}}
+	memberOf := []string{groupDN}
+
+	// indexes are the indexes of the role of each org, contributors are all the group mappings of each org
+	// matching the group, winners the index of the winning one among them and winnerGroups the winning mappings
+	indexes := map[int64]int{}
+	contributors := map[int64][]RoleDTO{}
+	winners := map[int64]int{}
+	winnerGroups := map[int64]*ldap.GroupToOrgRole{}
+
+	for _, g := range serverConfig.Groups {
+		matched, member := g.MatchedGroup(memberOf)
+		if !member {
+			continue
+		}
+
+		role := RoleDTO{OrgId: g.OrgID, OrgRole: g.OrgRole, GroupDN: g.GroupDN}
+		if g.IsPattern() {
+			role.MatchedGroupDN = matched
+		}
+
+		index, decided := indexes[g.OrgID]
+		if !decided {
+			indexes[g.OrgID] = len(dto.OrgRoles)
+			dto.OrgRoles = append(dto.OrgRoles, role)
+			winnerGroups[g.OrgID] = g
+		} else if serverConfig.RoleWins(role.OrgRole, dto.OrgRoles[index].OrgRole) {
+			dto.OrgRoles[index] = role
+			winners[g.OrgID] = len(contributors[g.OrgID])
+			winnerGroups[g.OrgID] = g
+		}
+
+		contributors[g.OrgID] = append(contributors[g.OrgID], role)
+	}
+
+	for orgID, index := range indexes {
+		if len(contributors[orgID]) > 1 {
+			contributors[orgID][winners[orgID]].Won = true
+			dto.OrgRoles[index].Contributors = contributors[orgID]
+		}
+	}
+
+	// the Grafana admin flag comes from the winning group mappings, as in the sync
+	for _, g := range serverConfig.Groups {
+		if winnerGroups[g.OrgID] != g {
+			continue
+		}
+
+		if dto.IsGrafanaAdmin == nil || !*dto.IsGrafanaAdmin {
+			dto.IsGrafanaAdmin = g.IsGrafanaAdmin
+		}
+	}
+
+	for _, mapping := range serverConfig.FolderMappings {
+		if !mapping.Matches(memberOf) {
+			continue
+		}
+
+		dto.FolderPermissions = append(dto.FolderPermissions, FolderPermissionDTO{
+			OrgId:      mapping.OrgID,
+			FolderId:   mapping.FolderID,
+			Permission: mapping.Permission,
+			GroupDN:    mapping.GroupDN,
+		})
+	}
+
+	return dto
+}
+
+// newLDAPUserDTO maps the LDAP user to its attributes and the organization roles of the group mappings
+func newLDAPUserDTO(user *models.ExternalUserInfo, serverConfig ldap.ServerConfig) *LDAPUserDTO {
+	name, surname := splitName(user.Name)
+
+	u := &LDAPUserDTO{
+		Name:           &LDAPAttribute{serverConfig.Attr.Name, name},
+		Surname:        &LDAPAttribute{serverConfig.Attr.Surname, surname},
+		Email:          &LDAPAttribute{serverConfig.Attr.Email, user.Email},
+		Username:       &LDAPAttribute{serverConfig.Attr.Username, user.Login},
+		Phone:          &LDAPAttribute{serverConfig.Attr.Phone, user.Phone},
+		Title:          &LDAPAttribute{serverConfig.Attr.Title, user.Title},
+		IsGrafanaAdmin: user.IsGrafanaAdmin,
+		IsDisabled:     user.IsDisabled,
+		Server:         serverConfig.Host,
+
+		RequestedAttributes: ldap.SearchAttributes(&serverConfig),
+	}
+
+	for _, mapping := range serverConfig.MetadataMappings {
+		if u.Metadata == nil {
+			u.Metadata = map[string]*LDAPAttribute{}
+		}
+
+		u.Metadata[mapping.Key] = &LDAPAttribute{mapping.Attribute, user.Metadata[mapping.Key]}
+	}
+
+	if user.Preferences != nil {
+		u.Preferences = map[string]*LDAPAttribute{}
+
+		for key, preference := range map[string]*LDAPAttribute{
+			"theme":         {serverConfig.Attr.Theme, user.Preferences.Theme},
+			"timezone":      {serverConfig.Attr.Timezone, user.Preferences.Timezone},
+			"homeDashboard": {serverConfig.Attr.HomeDashboard, user.Preferences.HomeDashboardUID},
+		} {
+			if preference.ConfigAttributeValue != "" {
+				u.Preferences[key] = preference
+			}
+		}
+	}
+
+	if err := serverConfig.ValidateEmail(user.Email); err != nil {
+		u.EmailValidation = &LDAPEmailValidationDTO{
+			Policy: serverConfig.InvalidEmail,
+			Error:  err.Error(),
+		}
+	}
+
+	orgRoles := []RoleDTO{}
+
+	// winners are the indexes of the roles of the winning group of the user in each org, see role_conflict,
+	// contributors are all the groups of the user in each org, with the role they confer, and the winning one.
+	// Each group mapping has its role, at the same index.
+	winners := map[int64]int{}
+	contributors := map[int64][]RoleDTO{}
+	wonContributors := map[int64]int{}
+
+	for _, g := range serverConfig.Groups {
+		role := &RoleDTO{}
+
+		if matched, member := g.MatchedGroup(user.Groups); member {
+			index, decided := winners[g.OrgID]
+			if !decided || serverConfig.RoleWins(g.OrgRole, serverConfig.Groups[index].OrgRole) {
+				winners[g.OrgID] = len(orgRoles)
+				wonContributors[g.OrgID] = len(contributors[g.OrgID])
+			}
+
+			contributor := RoleDTO{OrgId: g.OrgID, OrgRole: g.OrgRole, GroupDN: g.GroupDN}
+			if g.IsPattern() {
+				contributor.MatchedGroupDN = matched
+			}
+
+			contributors[g.OrgID] = append(contributors[g.OrgID], contributor)
+		}
+
+		if isMatchToLDAPGroup(user, g) {
+			role.OrgId = g.OrgID
+			role.OrgRole = user.OrgRoles[g.OrgID]
+			role.GroupDN = g.GroupDN
+
+			if matched, ok := g.MatchedGroup(user.Groups); ok && g.IsPattern() {
+				role.MatchedGroupDN = matched
+			}
+
+			orgRoles = append(orgRoles, *role)
+		} else {
+			role.OrgId = g.OrgID
+			role.GroupDN = g.GroupDN
+
+			orgRoles = append(orgRoles, *role)
+		}
+	}
+
+	for orgID, index := range winners {
+		if len(contributors[orgID]) > 1 {
+			contributors[orgID][wonContributors[orgID]].Won = true
+			orgRoles[index].Contributors = contributors[orgID]
+		}
+	}
+
+	if orgID := serverConfig.DefaultOrgID; orgID > 0 && !hasGroupRole(orgRoles, orgID) && user.OrgRoles[orgID] != "" {
+		orgRoles = append(orgRoles, RoleDTO{
+			OrgId:   orgID,
+			OrgRole: user.OrgRoles[orgID],
+			Server:  serverConfig.Host,
+		})
+	}
+
+	for _, override := range user.RoleOverrides {
+		for i := range orgRoles {
+			if orgRoles[i].OrgId != override.OrgId || orgRoles[i].OrgRole == "" {
+				continue
+			}
+
+			orgRoles[i].Override = &LDAPRoleOverrideAppliedDTO{
+				Rule:         override.Rule,
+				Attribute:    override.Attribute,
+				Value:        override.Value,
+				OriginalRole: override.OriginalRole,
+			}
+		}
+	}
+
+	u.OrgRoles = orgRoles
+
+	for _, mapping := range serverConfig.FolderMappings {
+		permission := FolderPermissionDTO{
+			OrgId:    mapping.OrgID,
+			FolderId: mapping.FolderID,
+			GroupDN:  mapping.GroupDN,
+		}
+
+		if isMatchToLDAPFolder(user, mapping) {
+			permission.Permission = mapping.Permission
+		}
+
+		u.FolderPermissions = append(u.FolderPermissions, permission)
+	}
+
+	return u
+}
+
+// FetchTeams fetches the teams of the user, the ones synced with its LDAP groups,
+// the ones listed by its teams attribute and the default ones
+func (user *LDAPUserDTO) FetchTeams(extUser *models.ExternalUserInfo, serverConfig ldap.ServerConfig) error {
+	cmd := &models.GetTeamsForLDAPGroupCommand{Groups: extUser.Groups}
+	err := bus.Dispatch(cmd)
+
+	if err != bus.ErrHandlerNotFound && err != nil {
+		return err
+	}
+
+	user.Teams = cmd.Result
+
+	if !serverConfig.AllowTeamsWithoutRole {
+		user.Teams = scopeTeamsToRoles(user.Teams, user.OrgRoles)
+	}
+
+	externalTeams, err := fetchExternalTeams(extUser)
+	if err != nil {
+		return err
+	}
+
+	user.Teams = append(user.Teams, externalTeams...)
+
+	return nil
+}
+
+// scopeTeamsToRoles keeps only the teams of the organizations where the user has a matched role,
+// so a group referenced by teams of several organizations doesn't leak teams into the other ones.
+func scopeTeamsToRoles(teams []models.TeamOrgGroupDTO, roles []RoleDTO) []models.TeamOrgGroupDTO {
+	if teams == nil {
+		return nil
+	}
+
+	orgIds := map[int64]bool{}
+	orgNames := map[string]bool{}
+
+	for _, role := range roles {
+		if role.OrgRole == "" {
+			continue
+		}
+
+		orgIds[role.OrgId] = true
+		orgNames[role.OrgName] = true
+	}
+
+	scoped := []models.TeamOrgGroupDTO{}
+	for _, team := range teams {
+		// The organization id isn't always known, fall back to its name
+		if orgIds[team.OrgId] || (team.OrgId == 0 && orgNames[team.OrgName]) {
+			scoped = append(scoped, team)
+		}
+	}
+
+	return scoped
+}
+
+// fetchExternalTeams fetches the information about the teams the LDAP user is directly member of,
+// the ones listed by its teams attribute and the default ones every LDAP user is member of.
+func fetchExternalTeams(user *models.ExternalUserInfo) ([]models.TeamOrgGroupDTO, error) {
+	teams := []models.TeamOrgGroupDTO{}
+
+	for _, team := range user.Teams {
+		provenance := models.TeamProvenanceDefault
+		if team.IsFromAttribute {
+			provenance = models.TeamProvenanceAttribute
+		} else if team.IsFromGroup {
+			provenance = models.TeamProvenanceMapping
+		} else if !team.IsDefault {
+			continue
+		}
+
+		teamQuery := &models.GetTeamByIdQuery{OrgId: team.OrgId, Id: team.TeamId}
+		if err := bus.Dispatch(teamQuery); err != nil {
+			return nil, err
+		}
+
+		orgQuery := &models.GetOrgByIdQuery{Id: team.OrgId}
+		if err := bus.Dispatch(orgQuery); err != nil {
+			return nil, err
+		}
+
+		teams = append(teams, models.TeamOrgGroupDTO{
+			TeamName:   teamQuery.Result.Name,
+			OrgId:      team.OrgId,
+			OrgName:    orgQuery.Result.Name,
+			Provenance: provenance,
+		})
+	}
+
+	return teams, nil
+}
+
+// hasGroupRole checks if one of the group mappings gave the user a role in the org
+func hasGroupRole(roles []RoleDTO, orgID int64) bool {
+	for _, role := range roles {
+		if role.OrgId == orgID && role.OrgRole != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// milliseconds converts the duration to milliseconds
+func milliseconds(duration time.Duration) float64 {
+	return float64(duration) / float64(time.Millisecond)
+}
+
+// isMatchToLDAPGroup determines if we were able to match an LDAP group to an organization+role.
+// Since we allow one role per organization. If it's set, we were able to match it.
+func isMatchToLDAPGroup(user *models.ExternalUserInfo, groupConfig *ldap.GroupToOrgRole) bool {
+	return groupOrgRole(user, groupConfig.OrgID) == groupConfig.OrgRole
+}
+
+// groupOrgRole returns the role of the user in the org before the role_overrides, the one its groups gave
+func groupOrgRole(user *models.ExternalUserInfo, orgID int64) models.RoleType {
+	for _, override := range user.RoleOverrides {
+		if override.OrgId == orgID {
+			return override.OriginalRole
+		}
+	}
+
+	return user.OrgRoles[orgID]
+}
+
+// ldapDisabledError is the response of the LDAP endpoints when LDAP is disabled by the enabled setting of [auth.ldap]
+func ldapDisabledError() Response {
+	return Error(http.StatusBadRequest, "LDAP integration disabled by setting", nil)
+}
+
+// ldapConfigError is the response to a failure to obtain the LDAP config. LDAP enabled without any server configured
+// is told apart from an invalid config, with its own message and status.
+func ldapConfigError(message string, err error) Response {
+	if err == ldap.ErrNoServersConfigured {
+		return Error(http.StatusServiceUnavailable, "LDAP enabled but no servers configured", err)
+	}
+
+	return Error(http.StatusBadRequest, message, err)
+}
+
+// ldapLookupError is the response to a failed user lookup, listing the LDAP servers it attempted.
+// The error is only reported outside of production, like Error() does.
+func ldapLookupError(status int, message string, err error, attempts []*multildap.ServerAttempt) Response {
+	body := &LDAPLookupErrorDTO{Message: message}
+
+	if err != nil && setting.Env != setting.PROD {
+		body.Error = err.Error()
+	}
+
+	for _, attempt := range attempts {
+		dto := &LDAPServerAttemptDTO{
+			Host:         attempt.Host,
+			Port:         attempt.Port,
+			Outcome:      attempt.Outcome,
+			MatchCount:   attempt.MatchCount,
+			SearchFilter: attempt.SearchFilter,
+		}
+
+		if attempt.Error != nil {
+			dto.Error = attempt.Error.Error()
+		}
+
+		body.AttemptedServers = append(body.AttemptedServers, dto)
+	}
+
+	resp := JSON(status, body)
+
+	if err != nil {
+		resp.errMessage = message
+		resp.err = err
+	}
+
+	return resp
+}
+
+// isMatchToLDAPFolder checks if the folder mapping gave its permission to the user, in the org of the mapping
+func isMatchToLDAPFolder(user *models.ExternalUserInfo, mapping *ldap.GroupToFolderPermission) bool {
+	for _, permission := range user.FolderPermissions {
+		if permission.OrgId != mapping.OrgID {
+			continue
+		}
+
+		if permission.FolderId == mapping.FolderID && permission.Permission == mapping.PermissionType() {
+			return true
+		}
+	}
+
+	return false
 }
 
 // splitName receives the full name of a user and splits it into two parts: A name and a surname.
@@ -3,13 +3,19 @@ package api
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"path"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/grafana/grafana/pkg/bus"
 	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/auth"
 	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/ldapsync"
 	"github.com/grafana/grafana/pkg/services/multildap"
 	"github.com/grafana/grafana/pkg/setting"
 	"github.com/stretchr/testify/assert"
@@ -22,8 +28,34 @@ type LDAPMock struct {
 
 var userSearchResult *models.ExternalUserInfo
 var userSearchConfig ldap.ServerConfig
+var userSearchError error
+var allUsersResult []*models.ExternalUserInfo
+var userSearchAttempts []*multildap.ServerAttempt
+var userCached *multildap.CachedUser
+var allUsersTruncated bool
+var matchingUsersQuery string
 var pingResult []*multildap.ServerStatus
 var pingError error
+var danglingResult []*multildap.GroupMappingsCheck
+var findGroupResult []*multildap.GroupLookup
+var findGroupDN string
+var closeCalledTimes int
+var modifiedUsersResult []*models.ExternalUserInfo
+var modifiedUsersError error
+var modifiedUsersSince time.Time
+var userPhotoResult []byte
+var userPhotoError error
+var userAttributesResult map[string][]string
+var userAttributesError error
+var loginResult *models.ExternalUserInfo
+var loginConfig ldap.ServerConfig
+var loginTrace *ldap.Trace
+var loginError error
+var searchResult *multildap.SearchResult
+var searchError error
+var searchHost, searchBaseDN, searchFilter string
+var searchAttributes []string
+var searchSizeLimit int
 
 func (m *LDAPMock) Ping() ([]*multildap.ServerStatus, error) {
 	return pingResult, pingError
@@ -33,13 +65,102 @@ func (m *LDAPMock) Login(query *models.LoginUserQuery) (*models.ExternalUserInfo
 	return &models.ExternalUserInfo{}, nil
 }
 
+func (m *LDAPMock) LoginWithTrace(query *models.LoginUserQuery) (*models.ExternalUserInfo, ldap.ServerConfig, *ldap.Trace, error) {
+	return loginResult, loginConfig, loginTrace, loginError
+}
+
 func (m *LDAPMock) Users(logins []string) ([]*models.ExternalUserInfo, error) {
 	s := []*models.ExternalUserInfo{}
 	return s, nil
 }
 
+func (m *LDAPMock) AllUsers() ([]*models.ExternalUserInfo, bool, error) {
+	return allUsersResult, allUsersTruncated, nil
+}
+
+// MatchingUsers returns the users of allUsersResult whose login matches the query
+func (m *LDAPMock) MatchingUsers(query string) ([]*models.ExternalUserInfo, bool, error) {
+	matchingUsersQuery = query
+
+	users := []*models.ExternalUserInfo{}
+	for _, user := range allUsersResult {
+		if matched, _ := path.Match(query, user.Login); matched {
+			users = append(users, user)
+		}
+	}
+
+	return users, allUsersTruncated, nil
+}
+
+// UsersPage pages through allUsersResult, the cookie of the cursor is the offset of the page
+func (m *LDAPMock) UsersPage(cursor *multildap.UsersCursor, limit int) ([]*models.ExternalUserInfo, *multildap.UsersCursor, error) {
+	offset := 0
+	if cursor != nil {
+		offset, _ = strconv.Atoi(string(cursor.Cookie))
+	}
+
+	if offset > len(allUsersResult) {
+		return nil, nil, multildap.ErrInvalidCursor
+	}
+
+	end := offset + limit
+	if end >= len(allUsersResult) {
+		return allUsersResult[offset:], nil, nil
+	}
+
+	return allUsersResult[offset:end], &multildap.UsersCursor{Cookie: []byte(strconv.Itoa(end))}, nil
+}
+
+func (m *LDAPMock) ModifiedUsers(since time.Time) ([]*models.ExternalUserInfo, bool, error) {
+	modifiedUsersSince = since
+	return modifiedUsersResult, false, modifiedUsersError
+}
+
+func (m *LDAPMock) ChangedUsers(markers map[string]string) ([]*models.ExternalUserInfo, map[string]string, bool, error) {
+	return modifiedUsersResult, markers, false, modifiedUsersError
+}
+
+func (m *LDAPMock) UserPhoto(login string) ([]byte, error) {
+	return userPhotoResult, userPhotoError
+}
+
+func (m *LDAPMock) UserAttributes(login string) (map[string][]string, error) {
+	return userAttributesResult, userAttributesError
+}
+
+func (m *LDAPMock) DanglingGroupMappings() ([]*multildap.GroupMappingsCheck, error) {
+	return danglingResult, nil
+}
+
+func (m *LDAPMock) FindGroup(dn string) ([]*multildap.GroupLookup, error) {
+	findGroupDN = dn
+	return findGroupResult, nil
+}
+
+func (m *LDAPMock) Search(host, baseDN, filter string, attributes []string, sizeLimit int) (*multildap.SearchResult, error) {
+	searchHost, searchBaseDN, searchFilter, searchAttributes, searchSizeLimit = host, baseDN, filter, attributes, sizeLimit
+	return searchResult, searchError
+}
+
+func (m *LDAPMock) Close() {
+	closeCalledTimes++
+}
+
 func (m *LDAPMock) User(login string) (*models.ExternalUserInfo, ldap.ServerConfig, error) {
-	return userSearchResult, userSearchConfig, nil
+	return userSearchResult, userSearchConfig, userSearchError
+}
+
+func (m *LDAPMock) UserWithTimings(login string) (*models.ExternalUserInfo, ldap.ServerConfig, *multildap.Timings, error) {
+	timings := &multildap.Timings{Connect: time.Millisecond, Bind: 2 * time.Millisecond, Search: 3 * time.Millisecond}
+	return userSearchResult, userSearchConfig, timings, userSearchError
+}
+
+func (m *LDAPMock) CachedUser(login string) *multildap.CachedUser {
+	return userCached
+}
+
+func (m *LDAPMock) UserWithAttempts(login string) (*models.ExternalUserInfo, ldap.ServerConfig, []*multildap.ServerAttempt, error) {
+	return userSearchResult, userSearchConfig, userSearchAttempts, userSearchError
 }
 
 //***
@@ -92,6 +213,24 @@ func TestGetUserFromLDAPApiEndpoint_UserNotFound(t *testing.T) {
 	assert.Equal(t, "{\"message\":\"No user was found on the LDAP server(s)\"}", responseString)
 }
 
+func TestGetUserFromLDAPApiEndpoint_ClosesSession(t *testing.T) {
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	userSearchResult = nil
+	closeCalledTimes = 0
+
+	sc := getUserFromLDAPContext(t, "/api/admin/ldap/user-that-does-not-exist")
+
+	require.Equal(t, http.StatusNotFound, sc.resp.Code)
+	assert.Equal(t, 1, closeCalledTimes)
+}
+
 func TestGetUserFromLDAPApiEndpoint_OrgNotfound(t *testing.T) {
 	isAdmin := true
 	userSearchResult = &models.ExternalUserInfo{
@@ -170,6 +309,10 @@ func TestGetUserFromLDAPApiEndpoint(t *testing.T) {
 	}
 
 	userSearchConfig = ldap.ServerConfig{
+		Host:          "ldap.example.org",
+		Port:          389,
+		SearchFilter:  "(uid=%s)",
+		SearchBaseDNs: []string{"dc=grafana,dc=org"},
 		Attr: ldap.AttributeMap{
 			Name:     "ldap-name",
 			Surname:  "ldap-surname",
@@ -223,11 +366,20 @@ func TestGetUserFromLDAPApiEndpoint(t *testing.T) {
 			"login": {
 				"cfgAttrValue": "ldap-username", "ldapValue": "johndoe"
 			},
+			"phone": {
+				"cfgAttrValue": "", "ldapValue": ""
+			},
+			"title": {
+				"cfgAttrValue": "", "ldapValue": ""
+			},
 			"isGrafanaAdmin": true,
 			"isDisabled": false,
 			"roles": [
 				{ "orgId": 1, "orgRole": "Admin", "orgName": "Main Org.", "groupDN": "cn=admins,ou=groups,dc=grafana,dc=org" }
 			],
+			"requestedAttributes": ["ldap-username", "ldap-surname", "ldap-email", "ldap-name"],
+			"server": "ldap.example.org",
+			"search": {"server": "ldap.example.org:389", "baseDns": ["dc=grafana,dc=org"], "filter": "(|(uid=johndoe))"},
 			"teams": null
 		}
 	`
@@ -237,6 +389,436 @@ func TestGetUserFromLDAPApiEndpoint(t *testing.T) {
 	assert.Equal(t, expectedJSON, jsonResponse)
 }
 
+func TestGetUserFromLDAPApiEndpoint_Shapes(t *testing.T) {
+	userSearchResult = &models.ExternalUserInfo{
+		Name:     "John Doe",
+		Email:    "john.doe@example.com",
+		Login:    "johndoe",
+		Groups:   []string{"cn=admins,ou=groups,dc=grafana,dc=org"},
+		OrgRoles: map[int64]models.RoleType{1: models.ROLE_ADMIN},
+	}
+
+	userSearchConfig = ldap.ServerConfig{
+		Attr: ldap.AttributeMap{
+			Username: "ldap-username",
+		},
+		Groups: []*ldap.GroupToOrgRole{
+			{GroupDN: "cn=editors,ou=groups,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_EDITOR},
+			{GroupDN: "cn=admins,ou=groups,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_ADMIN},
+			{GroupDN: "cn=viewers,ou=groups,dc=grafana,dc=org", OrgID: 2, OrgRole: models.ROLE_VIEWER},
+		},
+	}
+
+	bus.AddHandler("test", func(query *models.SearchOrgsQuery) error {
+		query.Result = []*models.OrgDTO{{Id: 1, Name: "Main Org."}, {Id: 2, Name: "Second Org."}}
+		return nil
+	})
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	getShape := func(shape string) map[string]interface{} {
+		sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe?shape="+shape)
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+
+		var response map[string]interface{}
+		require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+
+		return response
+	}
+
+	list := getShape("list")
+	keyed := getShape("map")
+
+	expectedRoles := map[string]interface{}{
+		"1": map[string]interface{}{
+			"orgId": float64(1), "orgName": "Main Org.", "orgRole": "Admin", "groupDN": "cn=admins,ou=groups,dc=grafana,dc=org",
+		},
+		"2": map[string]interface{}{
+			"orgId": float64(2), "orgName": "Second Org.", "orgRole": "", "groupDN": "cn=viewers,ou=groups,dc=grafana,dc=org",
+		},
+	}
+	assert.Equal(t, expectedRoles, keyed["roles"])
+
+	// every role of the list is found in the map, unless another one matched in the same org
+	for _, role := range list["roles"].([]interface{}) {
+		role := role.(map[string]interface{})
+		key := fmt.Sprintf("%v", role["orgId"])
+
+		require.Contains(t, keyed["roles"], key)
+		if role["orgRole"] != "" {
+			assert.Equal(t, role, keyed["roles"].(map[string]interface{})[key])
+		}
+	}
+
+	// the other fields are identical
+	delete(list, "roles")
+	delete(keyed, "roles")
+	assert.Equal(t, list, keyed)
+}
+
+func TestGetUserFromLDAPApiEndpoint_InvalidShape(t *testing.T) {
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe?shape=tree")
+
+	assert.Equal(t, http.StatusBadRequest, sc.resp.Code)
+}
+
+func TestGetUserFromLDAPApiEndpoint_OrgIdsFilter(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	searchConfig := userSearchConfig
+	defer func() { userSearchConfig = searchConfig }()
+
+	userSearchResult = &models.ExternalUserInfo{
+		Name:     "John Doe",
+		Email:    "john.doe@example.com",
+		Login:    "johndoe",
+		Groups:   []string{"cn=admins,ou=groups,dc=grafana,dc=org", "cn=editors,ou=groups,dc=grafana,dc=org"},
+		OrgRoles: map[int64]models.RoleType{1: models.ROLE_ADMIN, 2: models.ROLE_EDITOR, 3: models.ROLE_ADMIN},
+	}
+
+	userSearchConfig = ldap.ServerConfig{
+		Groups: []*ldap.GroupToOrgRole{
+			{GroupDN: "cn=admins,ou=groups,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_ADMIN},
+			{GroupDN: "cn=editors,ou=groups,dc=grafana,dc=org", OrgID: 2, OrgRole: models.ROLE_EDITOR},
+			{GroupDN: "cn=admins,ou=groups,dc=grafana,dc=org", OrgID: 3, OrgRole: models.ROLE_ADMIN},
+			{GroupDN: "cn=viewers,ou=groups,dc=grafana,dc=org", OrgID: 4, OrgRole: models.ROLE_VIEWER},
+		},
+	}
+
+	var fetchedOrgIds []int64
+	bus.AddHandler("test", func(query *models.SearchOrgsQuery) error {
+		fetchedOrgIds = query.Ids
+		query.Result = []*models.OrgDTO{
+			{Id: 1, Name: "Main Org."}, {Id: 2, Name: "Second Org."}, {Id: 3, Name: "Third Org."}, {Id: 4, Name: "Fourth Org."},
+		}
+		return nil
+	})
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	t.Run("returns only the roles of the requested orgs", func(t *testing.T) {
+		sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe?orgIds=1,3")
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+
+		var response struct {
+			OrgCount int               `json:"orgCount"`
+			OrgRoles []json.RawMessage `json:"roles"`
+		}
+		require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+
+		assert.Equal(t, 3, response.OrgCount)
+		require.Len(t, response.OrgRoles, 2)
+		assert.JSONEq(t, `{"orgId": 1, "orgName": "Main Org.", "orgRole": "Admin", "groupDN": "cn=admins,ou=groups,dc=grafana,dc=org"}`, string(response.OrgRoles[0]))
+		assert.JSONEq(t, `{"orgId": 3, "orgName": "Third Org.", "orgRole": "Admin", "groupDN": "cn=admins,ou=groups,dc=grafana,dc=org"}`, string(response.OrgRoles[1]))
+		assert.Equal(t, []int64{1, 3}, fetchedOrgIds)
+	})
+
+	t.Run("accepts the repeated param and the orgs without a role", func(t *testing.T) {
+		sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe?orgIds=4&orgIds=5&shape=map")
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+
+		var response struct {
+			OrgCount int                        `json:"orgCount"`
+			OrgRoles map[string]json.RawMessage `json:"roles"`
+		}
+		require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+
+		assert.Equal(t, 3, response.OrgCount)
+		require.Len(t, response.OrgRoles, 1)
+		assert.JSONEq(t, `{"orgId": 4, "orgName": "Fourth Org.", "orgRole": "", "groupDN": "cn=viewers,ou=groups,dc=grafana,dc=org"}`, string(response.OrgRoles["4"]))
+	})
+
+	t.Run("doesn't report the org count without filter", func(t *testing.T) {
+		sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe")
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+		assert.NotContains(t, sc.resp.Body.String(), "orgCount")
+	})
+
+	t.Run("rejects the invalid org ids", func(t *testing.T) {
+		sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe?orgIds=1,main")
+
+		assert.Equal(t, http.StatusBadRequest, sc.resp.Code)
+	})
+}
+
+func TestGetUserFromLDAPApiEndpoint_WithGrafanaState(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	searchConfig := userSearchConfig
+	defer func() { userSearchConfig = searchConfig }()
+
+	userSearchConfig = ldap.ServerConfig{}
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	bus.AddHandler("test", func(query *models.SearchOrgsQuery) error {
+		query.Result = []*models.OrgDTO{}
+		return nil
+	})
+
+	// the Grafana accounts, by id
+	accounts := map[int64]*models.User{
+		10: {Id: 10, Login: "johndoe", IsDisabled: false},
+		11: {Id: 11, Login: "janedoe", IsDisabled: true},
+		12: {Id: 12, Login: "jane", Email: "jane@grafana.org", IsDisabled: true},
+	}
+
+	bus.AddHandler("test", func(query *models.GetAuthInfoQuery) error {
+		if query.AuthId == "cn=johndoe,ou=users,dc=grafana,dc=org" {
+			query.Result = &models.UserAuth{UserId: 10, AuthModule: models.AuthModuleLDAP, AuthId: query.AuthId}
+			return nil
+		}
+		return models.ErrUserNotFound
+	})
+
+	bus.AddHandler("test", func(query *models.GetUserByIdQuery) error {
+		query.Result = accounts[query.Id]
+		return nil
+	})
+
+	// like the store, the users are found by their email too
+	bus.AddHandler("test", func(query *models.GetUserByLoginQuery) error {
+		for _, account := range accounts {
+			if account.Login == query.LoginOrEmail || account.Email == query.LoginOrEmail {
+				query.Result = account
+				return nil
+			}
+		}
+		return models.ErrUserNotFound
+	})
+
+	grafanaState := func(t *testing.T, requestURL string) string {
+		t.Helper()
+
+		sc := getUserFromLDAPContext(t, requestURL)
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+
+		var response map[string]json.RawMessage
+		require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+
+		return string(response["grafanaState"])
+	}
+
+	t.Run("reports matching states", func(t *testing.T) {
+		userSearchResult = &models.ExternalUserInfo{AuthId: "cn=johndoe,ou=users,dc=grafana,dc=org", Login: "johndoe"}
+
+		assert.JSONEq(t,
+			`{"exists": true, "userId": 10, "isDisabled": false, "stateMismatch": false}`,
+			grafanaState(t, "/api/admin/ldap/johndoe?withGrafanaState=true"),
+		)
+	})
+
+	t.Run("flags mismatching states", func(t *testing.T) {
+		userSearchResult = &models.ExternalUserInfo{AuthId: "cn=johndoe,ou=users,dc=grafana,dc=org", Login: "johndoe", IsDisabled: true}
+
+		assert.JSONEq(t,
+			`{"exists": true, "userId": 10, "isDisabled": false, "stateMismatch": true}`,
+			grafanaState(t, "/api/admin/ldap/johndoe?withGrafanaState=true"),
+		)
+	})
+
+	t.Run("falls back to the login without auth info", func(t *testing.T) {
+		userSearchResult = &models.ExternalUserInfo{AuthId: "cn=janedoe,ou=users,dc=grafana,dc=org", Login: "janedoe"}
+
+		assert.JSONEq(t,
+			`{"exists": true, "userId": 11, "isDisabled": true, "stateMismatch": true}`,
+			grafanaState(t, "/api/admin/ldap/janedoe?withGrafanaState=true"),
+		)
+	})
+
+	t.Run("reports the users without Grafana account", func(t *testing.T) {
+		userSearchResult = &models.ExternalUserInfo{AuthId: "cn=newbie,ou=users,dc=grafana,dc=org", Login: "newbie", IsDisabled: true}
+
+		assert.JSONEq(t,
+			`{"exists": false, "isDisabled": false, "stateMismatch": false}`,
+			grafanaState(t, "/api/admin/ldap/newbie?withGrafanaState=true"),
+		)
+	})
+
+	t.Run("doesn't report the account whose email is the login", func(t *testing.T) {
+		userSearchResult = &models.ExternalUserInfo{AuthId: "cn=jane,ou=users,dc=grafana,dc=org", Login: "jane@grafana.org"}
+
+		assert.JSONEq(t,
+			`{"exists": false, "isDisabled": false, "stateMismatch": false}`,
+			grafanaState(t, "/api/admin/ldap/jane@grafana.org?withGrafanaState=true"),
+		)
+	})
+
+	t.Run("doesn't report the Grafana state unless asked for", func(t *testing.T) {
+		userSearchResult = &models.ExternalUserInfo{AuthId: "cn=johndoe,ou=users,dc=grafana,dc=org", Login: "johndoe"}
+
+		assert.Equal(t, "", grafanaState(t, "/api/admin/ldap/johndoe"))
+	})
+}
+
+func TestGetUserFromLDAPApiEndpoint_LastSyncedAt(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	searchConfig := userSearchConfig
+	defer func() { userSearchConfig = searchConfig }()
+
+	userSearchConfig = ldap.ServerConfig{}
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	bus.AddHandler("test", func(query *models.SearchOrgsQuery) error {
+		query.Result = []*models.OrgDTO{}
+		return nil
+	})
+
+	bus.AddHandler("test", func(query *models.GetAuthInfoQuery) error {
+		if query.AuthId == "cn=johndoe,ou=users,dc=grafana,dc=org" {
+			syncedAt := time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)
+			query.Result = &models.UserAuth{UserId: 10, AuthModule: models.AuthModuleLDAP, AuthId: query.AuthId, LastSyncedAt: syncedAt}
+			return nil
+		}
+		return models.ErrUserNotFound
+	})
+
+	lastSyncedAt := func(t *testing.T, requestURL string) string {
+		t.Helper()
+
+		sc := getUserFromLDAPContext(t, requestURL)
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+
+		var response map[string]json.RawMessage
+		require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+
+		return string(response["lastSyncedAt"])
+	}
+
+	t.Run("reports the last sync of the user", func(t *testing.T) {
+		userSearchResult = &models.ExternalUserInfo{AuthId: "cn=johndoe,ou=users,dc=grafana,dc=org", Login: "johndoe"}
+
+		assert.Equal(t, `"2019-10-01T12:00:00Z"`, lastSyncedAt(t, "/api/admin/ldap/johndoe"))
+	})
+
+	t.Run("doesn't report the users never synced", func(t *testing.T) {
+		userSearchResult = &models.ExternalUserInfo{AuthId: "cn=newbie,ou=users,dc=grafana,dc=org", Login: "newbie"}
+
+		assert.Equal(t, "", lastSyncedAt(t, "/api/admin/ldap/newbie"))
+	})
+}
+
+func TestGetUserFromLDAPApiEndpoint_AttributeOverrides(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	searchConfig := userSearchConfig
+	defer func() { userSearchConfig = searchConfig }()
+
+	userSearchResult = &models.ExternalUserInfo{
+		Name:     "John Doe",
+		Email:    "john.doe@example.com",
+		Login:    "johndoe",
+		OrgRoles: map[int64]models.RoleType{},
+	}
+
+	config := &ldap.ServerConfig{
+		Host: "ldap.example.org",
+		Attr: ldap.AttributeMap{
+			Name:     "givenName",
+			Surname:  "sn",
+			Email:    "email",
+			Username: "cn",
+			MemberOf: "memberOf",
+		},
+	}
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{Servers: []*ldap.ServerConfig{config}}, nil
+	}
+
+	var servers []*ldap.ServerConfig
+	newLDAP = func(configs []*ldap.ServerConfig) multildap.IMultiLDAP {
+		servers = configs
+		userSearchConfig = *configs[0]
+		return &LDAPMock{}
+	}
+
+	bus.AddHandler("test", func(query *models.SearchOrgsQuery) error {
+		query.Result = []*models.OrgDTO{}
+		return nil
+	})
+
+	t.Run("overrides the attributes for the request", func(t *testing.T) {
+		sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe?loginAttr=sAMAccountName&emailAttr=mail")
+
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+
+		require.Len(t, servers, 1)
+		assert.True(t, config != servers[0])
+		assert.True(t, servers[0].IsCopy())
+		assert.Equal(t, "ldap.example.org", servers[0].Host)
+		assert.Equal(t, ldap.AttributeMap{
+			Name:     "givenName",
+			Surname:  "sn",
+			Email:    "mail",
+			Username: "sAMAccountName",
+			MemberOf: "memberOf",
+		}, servers[0].Attr)
+
+		var response LDAPUserDTO
+		require.NoError(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+		assert.Equal(t, "sAMAccountName", response.Username.ConfigAttributeValue)
+		assert.Equal(t, "mail", response.Email.ConfigAttributeValue)
+		assert.Equal(t, "givenName", response.Name.ConfigAttributeValue)
+
+		// The loaded config is shared with the other requests
+		assert.Equal(t, "cn", config.Attr.Username)
+		assert.Equal(t, "email", config.Attr.Email)
+	})
+
+	t.Run("falls back to the config without overrides", func(t *testing.T) {
+		sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe")
+
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+
+		require.Len(t, servers, 1)
+		assert.True(t, config == servers[0])
+
+		var response LDAPUserDTO
+		require.NoError(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+		assert.Equal(t, "cn", response.Username.ConfigAttributeValue)
+		assert.Equal(t, "email", response.Email.ConfigAttributeValue)
+	})
+}
+
 func TestGetUserFromLDAPApiEndpoint_WithTeamHandler(t *testing.T) {
 	isAdmin := true
 	userSearchResult = &models.ExternalUserInfo{
@@ -248,6 +830,10 @@ func TestGetUserFromLDAPApiEndpoint_WithTeamHandler(t *testing.T) {
 	}
 
 	userSearchConfig = ldap.ServerConfig{
+		Host:          "ldap.example.org",
+		Port:          389,
+		SearchFilter:  "(uid=%s)",
+		SearchBaseDNs: []string{"dc=grafana,dc=org"},
 		Attr: ldap.AttributeMap{
 			Name:     "ldap-name",
 			Surname:  "ldap-surname",
@@ -306,11 +892,20 @@ func TestGetUserFromLDAPApiEndpoint_WithTeamHandler(t *testing.T) {
 			"login": {
 				"cfgAttrValue": "ldap-username", "ldapValue": "johndoe"
 			},
+			"phone": {
+				"cfgAttrValue": "", "ldapValue": ""
+			},
+			"title": {
+				"cfgAttrValue": "", "ldapValue": ""
+			},
 			"isGrafanaAdmin": true,
 			"isDisabled": false,
 			"roles": [
 				{ "orgId": 1, "orgRole": "Admin", "orgName": "Main Org.", "groupDN": "cn=admins,ou=groups,dc=grafana,dc=org" }
 			],
+			"requestedAttributes": ["ldap-username", "ldap-surname", "ldap-email", "ldap-name"],
+			"server": "ldap.example.org",
+			"search": {"server": "ldap.example.org:389", "baseDns": ["dc=grafana,dc=org"], "filter": "(|(uid=johndoe))"},
 			"teams": []
 		}
 	`
@@ -320,14 +915,1958 @@ func TestGetUserFromLDAPApiEndpoint_WithTeamHandler(t *testing.T) {
 	assert.Equal(t, expectedJSON, jsonResponse)
 }
 
-//***
-// GetLDAPStatus tests
-//***
+func TestGetUserFromLDAPApiEndpoint_TeamsScopedToRoles(t *testing.T) {
+	userSearchResult = &models.ExternalUserInfo{
+		Name:     "John Doe",
+		Email:    "john.doe@example.com",
+		Login:    "johndoe",
+		Groups:   []string{"cn=devs,ou=groups,dc=grafana,dc=org"},
+		OrgRoles: map[int64]models.RoleType{1: models.ROLE_EDITOR},
+	}
+
+	bus.AddHandler("test", func(query *models.SearchOrgsQuery) error {
+		query.Result = []*models.OrgDTO{{Id: 1, Name: "Main Org."}, {Id: 2, Name: "Other Org."}}
+		return nil
+	})
+
+	bus.AddHandler("test", func(cmd *models.GetTeamsForLDAPGroupCommand) error {
+		cmd.Result = []models.TeamOrgGroupDTO{
+			{TeamName: "devs", OrgId: 1, OrgName: "Main Org.", GroupDN: "cn=devs,ou=groups,dc=grafana,dc=org"},
+			{TeamName: "devs", OrgId: 2, OrgName: "Other Org.", GroupDN: "cn=devs,ou=groups,dc=grafana,dc=org"},
+		}
+		return nil
+	})
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	for _, tc := range []struct {
+		desc                  string
+		allowTeamsWithoutRole bool
+		expectedOrgs          []int64
+	}{
+		{desc: "scoped to the orgs with a role", expectedOrgs: []int64{1}},
+		{desc: "explicitly unscoped", allowTeamsWithoutRole: true, expectedOrgs: []int64{1, 2}},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			userSearchConfig = ldap.ServerConfig{
+				Attr: ldap.AttributeMap{
+					Username: "ldap-username",
+				},
+				Groups: []*ldap.GroupToOrgRole{
+					{GroupDN: "cn=devs,ou=groups,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_EDITOR},
+					{GroupDN: "cn=admins,ou=groups,dc=grafana,dc=org", OrgID: 2, OrgRole: models.ROLE_ADMIN},
+				},
+				AllowTeamsWithoutRole: tc.allowTeamsWithoutRole,
+			}
+
+			sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe")
+
+			require.Equal(t, http.StatusOK, sc.resp.Code)
+
+			var response LDAPUserDTO
+			require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+
+			orgs := []int64{}
+			for _, team := range response.Teams {
+				orgs = append(orgs, team.OrgId)
+			}
+
+			assert.Equal(t, tc.expectedOrgs, orgs)
+		})
+	}
+}
+
+func TestGetUserFromLDAPApiEndpoint_WithDefaultTeam(t *testing.T) {
+	userSearchResult = &models.ExternalUserInfo{
+		Name:     "John Doe",
+		Email:    "john.doe@example.com",
+		Login:    "johndoe",
+		OrgRoles: map[int64]models.RoleType{},
+		Teams:    []models.ExternalTeam{{OrgId: 1, TeamId: 2, IsDefault: true}},
+	}
+
+	userSearchConfig = ldap.ServerConfig{
+		Attr: ldap.AttributeMap{
+			Username: "ldap-username",
+		},
+	}
+
+	bus.AddHandler("test", func(query *models.SearchOrgsQuery) error {
+		query.Result = []*models.OrgDTO{}
+		return nil
+	})
+
+	bus.AddHandler("test", func(cmd *models.GetTeamsForLDAPGroupCommand) error {
+		cmd.Result = []models.TeamOrgGroupDTO{}
+		return nil
+	})
+
+	bus.AddHandler("test", func(query *models.GetTeamByIdQuery) error {
+		query.Result = &models.TeamDTO{Id: query.Id, OrgId: query.OrgId, Name: "all-staff"}
+		return nil
+	})
+
+	bus.AddHandler("test", func(query *models.GetOrgByIdQuery) error {
+		query.Result = &models.Org{Id: query.Id, Name: "Main Org."}
+		return nil
+	})
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe")
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+
+	var response struct {
+		Teams []models.TeamOrgGroupDTO `json:"teams"`
+	}
+	require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+
+	assert.Equal(t, []models.TeamOrgGroupDTO{
+		{TeamName: "all-staff", OrgId: 1, OrgName: "Main Org.", Provenance: "default"},
+	}, response.Teams)
+}
+
+func TestGetUserFromLDAPApiEndpoint_WithAttributeTeams(t *testing.T) {
+	userSearchResult = &models.ExternalUserInfo{
+		Name:     "John Doe",
+		Email:    "john.doe@example.com",
+		Login:    "johndoe",
+		Groups:   []string{"cn=devs,ou=groups,dc=grafana,dc=org"},
+		OrgRoles: map[int64]models.RoleType{1: models.ROLE_EDITOR},
+		Teams: []models.ExternalTeam{
+			{OrgId: 1, TeamId: 2, IsDefault: true},
+			{OrgId: 1, TeamId: 3, IsFromAttribute: true},
+			{OrgId: 1, TeamId: 4, IsFromGroup: true},
+		},
+	}
+
+	userSearchConfig = ldap.ServerConfig{
+		Attr: ldap.AttributeMap{
+			Username: "ldap-username",
+			Teams:    "grafanaTeam",
+		},
+		Groups: []*ldap.GroupToOrgRole{
+			{GroupDN: "cn=devs,ou=groups,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_EDITOR},
+		},
+	}
+
+	bus.AddHandler("test", func(query *models.SearchOrgsQuery) error {
+		query.Result = []*models.OrgDTO{{Id: 1, Name: "Main Org."}}
+		return nil
+	})
+
+	bus.AddHandler("test", func(cmd *models.GetTeamsForLDAPGroupCommand) error {
+		cmd.Result = []models.TeamOrgGroupDTO{
+			{TeamName: "devs", OrgId: 1, OrgName: "Main Org.", GroupDN: "cn=devs,ou=groups,dc=grafana,dc=org"},
+		}
+		return nil
+	})
+
+	teamNames := map[int64]string{2: "all-staff", 3: "on-call", 4: "ops"}
+	bus.AddHandler("test", func(query *models.GetTeamByIdQuery) error {
+		query.Result = &models.TeamDTO{Id: query.Id, OrgId: query.OrgId, Name: teamNames[query.Id]}
+		return nil
+	})
+
+	bus.AddHandler("test", func(query *models.GetOrgByIdQuery) error {
+		query.Result = &models.Org{Id: query.Id, Name: "Main Org."}
+		return nil
+	})
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe")
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+
+	var response struct {
+		Teams []models.TeamOrgGroupDTO `json:"teams"`
+	}
+	require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+
+	assert.Equal(t, []models.TeamOrgGroupDTO{
+		{TeamName: "devs", OrgId: 1, OrgName: "Main Org.", GroupDN: "cn=devs,ou=groups,dc=grafana,dc=org"},
+		{TeamName: "all-staff", OrgId: 1, OrgName: "Main Org.", Provenance: "default"},
+		{TeamName: "on-call", OrgId: 1, OrgName: "Main Org.", Provenance: "attribute"},
+		{TeamName: "ops", OrgId: 1, OrgName: "Main Org.", Provenance: "mapping"},
+	}, response.Teams)
+}
+
+func TestGetUserFromLDAPApiEndpoint_WithFolderPermissions(t *testing.T) {
+	userSearchResult = &models.ExternalUserInfo{
+		Name:     "John Doe",
+		Email:    "john.doe@example.com",
+		Login:    "johndoe",
+		Groups:   []string{"cn=ops,ou=groups,dc=grafana,dc=org"},
+		OrgRoles: map[int64]models.RoleType{},
+		FolderPermissions: []models.ExternalFolderPermission{
+			{OrgId: 1, FolderId: 10, Permission: models.PERMISSION_EDIT},
+		},
+	}
+
+	userSearchConfig = ldap.ServerConfig{
+		Attr: ldap.AttributeMap{
+			Username: "ldap-username",
+		},
+		FolderMappings: []*ldap.GroupToFolderPermission{
+			{GroupDN: "cn=ops,ou=groups,dc=grafana,dc=org", OrgID: 1, FolderID: 10, Permission: "Edit"},
+			{GroupDN: "cn=admins,ou=groups,dc=grafana,dc=org", OrgID: 1, FolderID: 20, Permission: "Admin"},
+			// the folder id mapped in another org, where the sync gives no permission
+			{GroupDN: "cn=ops,ou=groups,dc=grafana,dc=org", OrgID: 2, FolderID: 10, Permission: "Edit"},
+		},
+	}
+
+	bus.AddHandler("test", func(query *models.SearchOrgsQuery) error {
+		query.Result = []*models.OrgDTO{}
+		return nil
+	})
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe")
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+
+	var response struct {
+		FolderPermissions []FolderPermissionDTO `json:"folderPermissions"`
+	}
+	require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+
+	assert.Equal(t, []FolderPermissionDTO{
+		{OrgId: 1, FolderId: 10, Permission: "Edit", GroupDN: "cn=ops,ou=groups,dc=grafana,dc=org"},
+		{OrgId: 1, FolderId: 20, GroupDN: "cn=admins,ou=groups,dc=grafana,dc=org"},
+		{OrgId: 2, FolderId: 10, GroupDN: "cn=ops,ou=groups,dc=grafana,dc=org"},
+	}, response.FolderPermissions)
+}
+
+func TestGetUserFromLDAPApiEndpoint_WithPhoneAndTitle(t *testing.T) {
+	userSearchResult = &models.ExternalUserInfo{
+		Name:     "John Doe",
+		Email:    "john.doe@example.com",
+		Login:    "johndoe",
+		Phone:    "+1 555 0100",
+		Title:    "Engineer",
+		OrgRoles: map[int64]models.RoleType{},
+	}
+
+	userSearchConfig = ldap.ServerConfig{
+		Attr: ldap.AttributeMap{
+			Username: "ldap-username",
+			Phone:    "ldap-phone",
+			Title:    "ldap-title",
+		},
+	}
+
+	bus.AddHandler("test", func(query *models.SearchOrgsQuery) error {
+		query.Result = []*models.OrgDTO{}
+		return nil
+	})
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe")
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+
+	var response LDAPUserDTO
+	require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+
+	assert.Equal(t, &LDAPAttribute{"ldap-phone", "+1 555 0100"}, response.Phone)
+	assert.Equal(t, &LDAPAttribute{"ldap-title", "Engineer"}, response.Title)
+}
+
+func TestGetUserFromLDAPApiEndpoint_WithPreferences(t *testing.T) {
+	userSearchResult = &models.ExternalUserInfo{
+		Name:        "John Doe",
+		Email:       "john.doe@example.com",
+		Login:       "johndoe",
+		OrgRoles:    map[int64]models.RoleType{},
+		Preferences: &models.ExternalPreferences{Timezone: "utc", HomeDashboardUID: "ops-overview"},
+	}
+
+	userSearchConfig = ldap.ServerConfig{
+		Attr: ldap.AttributeMap{
+			Username:      "ldap-username",
+			Timezone:      "grafanaTimezone",
+			HomeDashboard: "grafanaHomeDashboard",
+		},
+	}
+
+	bus.AddHandler("test", func(query *models.SearchOrgsQuery) error {
+		query.Result = []*models.OrgDTO{}
+		return nil
+	})
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe")
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+
+	var response LDAPUserDTO
+	require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+
+	assert.Equal(t, map[string]*LDAPAttribute{
+		"timezone":      {"grafanaTimezone", "utc"},
+		"homeDashboard": {"grafanaHomeDashboard", "ops-overview"},
+	}, response.Preferences)
+}
+
+func TestGetUserFromLDAPApiEndpoint_WithGroupPattern(t *testing.T) {
+	userSearchResult = &models.ExternalUserInfo{
+		Name:     "John Doe",
+		Email:    "john.doe@example.com",
+		Login:    "johndoe",
+		Groups:   []string{"cn=proj-apollo-viewers,ou=groups,dc=grafana,dc=org"},
+		OrgRoles: map[int64]models.RoleType{2: models.ROLE_VIEWER},
+	}
+
+	userSearchConfig = ldap.ServerConfig{
+		Attr: ldap.AttributeMap{
+			Username: "ldap-username",
+		},
+		Groups: []*ldap.GroupToOrgRole{
+			{
+				GroupDN:   "cn=proj-*-viewers,ou=groups,dc=grafana,dc=org",
+				MatchType: ldap.GroupMatchGlob,
+				OrgID:     2,
+				OrgRole:   models.ROLE_VIEWER,
+			},
+		},
+	}
+
+	bus.AddHandler("test", func(query *models.SearchOrgsQuery) error {
+		query.Result = []*models.OrgDTO{{Id: 2, Name: "Projects"}}
+		return nil
+	})
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe")
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+
+	var response LDAPUserDTO
+	require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+
+	assert.Equal(t, []RoleDTO{
+		{
+			OrgId:          2,
+			OrgName:        "Projects",
+			OrgRole:        models.ROLE_VIEWER,
+			GroupDN:        "cn=proj-*-viewers,ou=groups,dc=grafana,dc=org",
+			MatchedGroupDN: "cn=proj-apollo-viewers,ou=groups,dc=grafana,dc=org",
+		},
+	}, response.OrgRoles)
+}
+
+func TestGetUserFromLDAPApiEndpoint_RoleContributors(t *testing.T) {
+	// the user is an editor and an admin of the same org, the editors group comes first so it wins
+	userSearchResult = &models.ExternalUserInfo{
+		Login: "johndoe",
+		Groups: []string{
+			"cn=editors,ou=groups,dc=grafana,dc=org",
+			"cn=admins,ou=groups,dc=grafana,dc=org",
+			"cn=staff,ou=groups,dc=grafana,dc=org",
+		},
+		OrgRoles: map[int64]models.RoleType{1: models.ROLE_EDITOR, 2: models.ROLE_VIEWER},
+	}
+
+	userSearchConfig = ldap.ServerConfig{
+		Attr: ldap.AttributeMap{
+			Username: "ldap-username",
+		},
+		Groups: []*ldap.GroupToOrgRole{
+			{GroupDN: "cn=editors,ou=groups,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_EDITOR},
+			{GroupDN: "cn=admins,ou=groups,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_ADMIN},
+			{GroupDN: "cn=viewers,ou=groups,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_VIEWER},
+			{GroupDN: "cn=staff,ou=groups,dc=grafana,dc=org", OrgID: 2, OrgRole: models.ROLE_VIEWER},
+		},
+	}
+
+	bus.AddHandler("test", func(query *models.SearchOrgsQuery) error {
+		query.Result = []*models.OrgDTO{{Id: 1, Name: "Main Org."}, {Id: 2, Name: "Staff"}}
+		return nil
+	})
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe")
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+
+	var response struct {
+		Roles json.RawMessage `json:"roles"`
+	}
+	require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+
+	// the staff group is the only group of its org, there's no conflict to report
+	expected := `
+	[
+		{
+			"orgId": 1, "orgName": "Main Org.", "orgRole": "Editor", "groupDN": "cn=editors,ou=groups,dc=grafana,dc=org",
+			"contributors": [
+				{ "orgId": 1, "orgName": "Main Org.", "orgRole": "Editor", "groupDN": "cn=editors,ou=groups,dc=grafana,dc=org", "won": true },
+				{ "orgId": 1, "orgName": "Main Org.", "orgRole": "Admin", "groupDN": "cn=admins,ou=groups,dc=grafana,dc=org" }
+			]
+		},
+		{ "orgId": 1, "orgName": "Main Org.", "orgRole": "", "groupDN": "cn=admins,ou=groups,dc=grafana,dc=org" },
+		{ "orgId": 1, "orgName": "Main Org.", "orgRole": "", "groupDN": "cn=viewers,ou=groups,dc=grafana,dc=org" },
+		{ "orgId": 2, "orgName": "Staff", "orgRole": "Viewer", "groupDN": "cn=staff,ou=groups,dc=grafana,dc=org" }
+	]
+	`
+
+	assert.JSONEq(t, expected, string(response.Roles))
+}
+
+func TestGetUserFromLDAPApiEndpoint_RoleConflict(t *testing.T) {
+	searchResult, searchConfig := userSearchResult, userSearchConfig
+	defer func() { userSearchResult, userSearchConfig = searchResult, searchConfig }()
+
+	// the user is an editor and an admin of the same org, the highest role wins whatever the order of the groups
+	userSearchResult = &models.ExternalUserInfo{
+		Login: "johndoe",
+		Groups: []string{
+			"cn=editors,ou=groups,dc=grafana,dc=org",
+			"cn=admins,ou=groups,dc=grafana,dc=org",
+		},
+		OrgRoles: map[int64]models.RoleType{1: models.ROLE_ADMIN},
+	}
+
+	userSearchConfig = ldap.ServerConfig{
+		Attr: ldap.AttributeMap{
+			Username: "ldap-username",
+		},
+		Groups: []*ldap.GroupToOrgRole{
+			{GroupDN: "cn=editors,ou=groups,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_EDITOR},
+			{GroupDN: "cn=admins,ou=groups,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_ADMIN},
+		},
+		RoleConflict: ldap.RoleConflictHighestRole,
+	}
+
+	bus.AddHandler("test", func(query *models.SearchOrgsQuery) error {
+		query.Result = []*models.OrgDTO{{Id: 1, Name: "Main Org."}}
+		return nil
+	})
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe")
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+
+	var response struct {
+		Roles json.RawMessage `json:"roles"`
+	}
+	require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+
+	expected := `
+	[
+		{ "orgId": 1, "orgName": "Main Org.", "orgRole": "", "groupDN": "cn=editors,ou=groups,dc=grafana,dc=org" },
+		{
+			"orgId": 1, "orgName": "Main Org.", "orgRole": "Admin", "groupDN": "cn=admins,ou=groups,dc=grafana,dc=org",
+			"contributors": [
+				{ "orgId": 1, "orgName": "Main Org.", "orgRole": "Editor", "groupDN": "cn=editors,ou=groups,dc=grafana,dc=org" },
+				{ "orgId": 1, "orgName": "Main Org.", "orgRole": "Admin", "groupDN": "cn=admins,ou=groups,dc=grafana,dc=org", "won": true }
+			]
+		}
+	]
+	`
+
+	assert.JSONEq(t, expected, string(response.Roles))
+}
+
+func TestGetUserFromLDAPApiEndpoint_RoleOverrides(t *testing.T) {
+	searchResult, searchConfig := userSearchResult, userSearchConfig
+	defer func() { userSearchResult, userSearchConfig = searchResult, searchConfig }()
+
+	// the admins group gives the admin role in both orgs, the contractors are overridden to viewers in the main org only
+	userSearchResult = &models.ExternalUserInfo{
+		Login:    "johndoe",
+		Groups:   []string{"cn=admins,ou=groups,dc=grafana,dc=org"},
+		OrgRoles: map[int64]models.RoleType{1: models.ROLE_VIEWER, 2: models.ROLE_ADMIN},
+		RoleOverrides: []models.ExternalRoleOverride{{
+			OrgId:        1,
+			Role:         models.ROLE_VIEWER,
+			OriginalRole: models.ROLE_ADMIN,
+			Rule:         0,
+			Attribute:    "departmentNumber",
+			Value:        "contractors",
+		}},
+	}
+
+	userSearchConfig = ldap.ServerConfig{
+		Attr: ldap.AttributeMap{
+			Username: "ldap-username",
+		},
+		Groups: []*ldap.GroupToOrgRole{
+			{GroupDN: "cn=admins,ou=groups,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_ADMIN},
+			{GroupDN: "cn=admins,ou=groups,dc=grafana,dc=org", OrgID: 2, OrgRole: models.ROLE_ADMIN},
+		},
+		RoleOverrides: []*ldap.RoleOverride{
+			{Attribute: "departmentNumber", Value: "contractors", OrgID: 1, OrgRole: models.ROLE_VIEWER},
+		},
+	}
+
+	bus.AddHandler("test", func(query *models.SearchOrgsQuery) error {
+		query.Result = []*models.OrgDTO{{Id: 1, Name: "Main Org."}, {Id: 2, Name: "Staff"}}
+		return nil
+	})
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe")
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+
+	var response struct {
+		Roles json.RawMessage `json:"roles"`
+	}
+	require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+
+	expected := `
+	[
+		{
+			"orgId": 1, "orgName": "Main Org.", "orgRole": "Viewer", "groupDN": "cn=admins,ou=groups,dc=grafana,dc=org",
+			"override": { "rule": 0, "attribute": "departmentNumber", "value": "contractors", "originalRole": "Admin" }
+		},
+		{ "orgId": 2, "orgName": "Staff", "orgRole": "Admin", "groupDN": "cn=admins,ou=groups,dc=grafana,dc=org" }
+	]
+	`
+
+	assert.JSONEq(t, expected, string(response.Roles))
+}
+
+func TestGetUserFromLDAPApiEndpoint_FoundOnSecondServer(t *testing.T) {
+	first := &ldap.ServerConfig{
+		Host: "ldap-1.example.com",
+		Attr: ldap.AttributeMap{
+			Username: "uid",
+			Name:     "givenName",
+			Surname:  "sn",
+			Email:    "mail",
+			MemberOf: "memberOf",
+		},
+	}
+
+	second := &ldap.ServerConfig{
+		Host: "ad.example.com",
+		Attr: ldap.AttributeMap{
+			Username: "sAMAccountName",
+			Name:     "displayName",
+			Surname:  "surname",
+			Email:    "userPrincipalName",
+			MemberOf: "memberOf",
+		},
+		Groups: []*ldap.GroupToOrgRole{
+			{GroupDN: "cn=admins,ou=groups,dc=ad,dc=example,dc=com", OrgID: 1, OrgRole: models.ROLE_ADMIN},
+		},
+	}
+
+	userSearchResult = &models.ExternalUserInfo{
+		Name:     "John Doe",
+		Email:    "john.doe@example.com",
+		Login:    "johndoe",
+		Groups:   []string{"cn=admins,ou=groups,dc=ad,dc=example,dc=com"},
+		OrgRoles: map[int64]models.RoleType{1: models.ROLE_ADMIN},
+	}
+
+	// the user is only found on the second server
+	userSearchConfig = *second
+
+	bus.AddHandler("test", func(query *models.SearchOrgsQuery) error {
+		query.Result = []*models.OrgDTO{{Id: 1, Name: "Main Org."}}
+		return nil
+	})
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{Servers: []*ldap.ServerConfig{first, second}}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe")
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+
+	var response LDAPUserDTO
+	require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+
+	assert.Equal(t, "ad.example.com", response.Server)
+	assert.Equal(t, &LDAPAttribute{"sAMAccountName", "johndoe"}, response.Username)
+	assert.Equal(t, &LDAPAttribute{"displayName", "John"}, response.Name)
+	assert.Equal(t, &LDAPAttribute{"surname", "Doe"}, response.Surname)
+	assert.Equal(t, &LDAPAttribute{"userPrincipalName", "john.doe@example.com"}, response.Email)
+	assert.Equal(t, []string{"sAMAccountName", "surname", "userPrincipalName", "displayName", "memberOf"}, response.RequestedAttributes)
+	require.Len(t, response.OrgRoles, 1)
+	assert.Equal(t, "cn=admins,ou=groups,dc=ad,dc=example,dc=com", response.OrgRoles[0].GroupDN)
+	assert.Equal(t, models.ROLE_ADMIN, response.OrgRoles[0].OrgRole)
+}
+
+func TestGetUserFromLDAPApiEndpoint_WithInvalidEmail(t *testing.T) {
+	userSearchResult = &models.ExternalUserInfo{
+		Name:     "John Doe",
+		Email:    "john.doe.example.com",
+		Login:    "johndoe",
+		OrgRoles: map[int64]models.RoleType{},
+	}
+
+	bus.AddHandler("test", func(query *models.SearchOrgsQuery) error {
+		query.Result = []*models.OrgDTO{}
+		return nil
+	})
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	for _, policy := range []string{"", ldap.InvalidEmailWarn, ldap.InvalidEmailReject} {
+		t.Run(fmt.Sprintf("policy %q", policy), func(t *testing.T) {
+			userSearchConfig = ldap.ServerConfig{
+				Attr: ldap.AttributeMap{
+					Username: "ldap-username",
+					Email:    "ldap-email",
+				},
+				NormalizeEmail: true,
+				InvalidEmail:   policy,
+			}
+
+			sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe")
+
+			require.Equal(t, http.StatusOK, sc.resp.Code)
+
+			var response LDAPUserDTO
+			require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+
+			if policy == "" {
+				assert.Nil(t, response.EmailValidation)
+				return
+			}
+
+			assert.Equal(t, &LDAPEmailValidationDTO{
+				Policy: policy,
+				Error:  "LDAP email is not a valid address",
+			}, response.EmailValidation)
+		})
+	}
+}
+
+func TestGetUserFromLDAPApiEndpoint_WithDefaultOrg(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	bus.AddHandler("test", func(query *models.SearchOrgsQuery) error {
+		query.Result = []*models.OrgDTO{
+			{Id: 1, Name: "Tenant A"},
+			{Id: 2, Name: "Tenant B"},
+			{Id: 3, Name: "Shared"},
+		}
+		return nil
+	})
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	tests := []struct {
+		host         string
+		defaultOrgID int64
+	}{
+		{host: "ldap-a.example.org", defaultOrgID: 1},
+		{host: "ldap-b.example.org", defaultOrgID: 2},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.host, func(t *testing.T) {
+			userSearchResult = &models.ExternalUserInfo{
+				Name:  "John Doe",
+				Email: "john.doe@example.com",
+				Login: "johndoe",
+				OrgRoles: map[int64]models.RoleType{
+					tc.defaultOrgID: models.ROLE_VIEWER,
+				},
+			}
+
+			userSearchConfig = ldap.ServerConfig{
+				Host: tc.host,
+				Attr: ldap.AttributeMap{
+					Username: "ldap-username",
+				},
+				Groups: []*ldap.GroupToOrgRole{
+					{GroupDN: "cn=admins,ou=groups,dc=grafana,dc=org", OrgID: 3, OrgRole: models.ROLE_ADMIN},
+				},
+				DefaultOrgID: tc.defaultOrgID,
+			}
+
+			sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe")
+
+			require.Equal(t, http.StatusOK, sc.resp.Code)
+
+			var response LDAPUserDTO
+			require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+
+			require.Len(t, response.OrgRoles, 2)
+			assert.Equal(t, int64(3), response.OrgRoles[0].OrgId)
+			assert.Equal(t, "cn=admins,ou=groups,dc=grafana,dc=org", response.OrgRoles[0].GroupDN)
+			assert.Empty(t, response.OrgRoles[0].Server)
+			assert.Equal(t, tc.defaultOrgID, response.OrgRoles[1].OrgId)
+			assert.Equal(t, models.ROLE_VIEWER, response.OrgRoles[1].OrgRole)
+			assert.Equal(t, tc.host, response.OrgRoles[1].Server)
+			assert.Empty(t, response.OrgRoles[1].GroupDN)
+		})
+	}
+}
+
+func TestGetUserFromLDAPApiEndpoint_WithTimings(t *testing.T) {
+	userSearchResult = &models.ExternalUserInfo{
+		Name:     "John Doe",
+		Email:    "john.doe@example.com",
+		Login:    "johndoe",
+		OrgRoles: map[int64]models.RoleType{1: models.ROLE_ADMIN},
+	}
+
+	userSearchConfig = ldap.ServerConfig{
+		Attr: ldap.AttributeMap{
+			Username: "ldap-username",
+		},
+		Groups: []*ldap.GroupToOrgRole{
+			{GroupDN: "cn=admins,ou=groups,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_ADMIN},
+		},
+	}
+
+	bus.AddHandler("test", func(query *models.SearchOrgsQuery) error {
+		query.Result = []*models.OrgDTO{{Id: 1, Name: "Main Org."}}
+		return nil
+	})
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	t.Run("with timings", func(t *testing.T) {
+		sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe?timings=true")
+
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+
+		var response LDAPUserDTO
+		require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+		require.NotNil(t, response.Timings)
+
+		assert.Equal(t, float64(1), response.Timings.ConnectMs)
+		assert.Equal(t, float64(2), response.Timings.BindMs)
+		assert.Equal(t, float64(3), response.Timings.SearchMs)
+		assert.True(t, response.Timings.OrgFetchMs >= 0)
+		assert.True(t, response.Timings.TeamFetchMs >= 0)
+	})
+
+	t.Run("without timings", func(t *testing.T) {
+		sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe")
+
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+
+		var response map[string]interface{}
+		require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+		assert.NotContains(t, response, "timings")
+	})
+}
+
+func TestGetUserFromLDAPApiEndpoint_Unreachable(t *testing.T) {
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	userSearchResult = nil
+	userSearchError = multildap.ErrUnreachable
+	defer func() { userSearchError = nil }()
+
+	sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe")
+
+	require.Equal(t, http.StatusServiceUnavailable, sc.resp.Code)
+}
+
+func TestGetUserFromLDAPApiEndpoint_UnreachableWithAttempts(t *testing.T) {
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	userSearchResult = nil
+	userSearchError = multildap.ErrUnreachable
+	userSearchAttempts = []*multildap.ServerAttempt{
+		{Host: "ldap1.example.org", Port: 389, Outcome: multildap.AttemptUnreachable, Error: errors.New("connection refused")},
+		{Host: "ldap2.example.org", Port: 636, Outcome: multildap.AttemptUnreachable, Error: errors.New("i/o timeout")},
+	}
+	defer func() {
+		userSearchError = nil
+		userSearchAttempts = nil
+	}()
+
+	sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe")
+
+	require.Equal(t, http.StatusServiceUnavailable, sc.resp.Code)
+
+	expected := `
+		{
+			"message": "None of the LDAP servers are reachable",
+			"error": "None of the LDAP servers are reachable",
+			"attemptedServers": [
+				{ "host": "ldap1.example.org", "port": 389, "outcome": "unreachable", "error": "connection refused" },
+				{ "host": "ldap2.example.org", "port": 636, "outcome": "unreachable", "error": "i/o timeout" }
+			]
+		}
+	`
+	assert.JSONEq(t, expected, sc.resp.Body.String())
+}
+
+func TestGetUserFromLDAPApiEndpoint_UserNotFoundWithAttempts(t *testing.T) {
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	// the first server is down, the lookup fails over to the second which doesn't know the user
+	userSearchResult = nil
+	userSearchError = multildap.ErrDidNotFindUser
+	userSearchAttempts = []*multildap.ServerAttempt{
+		{Host: "ldap1.example.org", Port: 389, Outcome: multildap.AttemptUnreachable, Error: errors.New("connection refused")},
+		{Host: "ldap2.example.org", Port: 389, Outcome: multildap.AttemptNotFound, SearchFilter: "(|(uid=johndoe))"},
+	}
+	defer func() {
+		userSearchError = nil
+		userSearchAttempts = nil
+	}()
+
+	sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe")
+
+	require.Equal(t, http.StatusNotFound, sc.resp.Code)
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(sc.resp.Body.Bytes(), &body))
+
+	assert.Equal(t, "No user was found on the LDAP server(s)", body["message"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"host": "ldap1.example.org", "port": float64(389), "outcome": "unreachable", "error": "connection refused"},
+		map[string]interface{}{"host": "ldap2.example.org", "port": float64(389), "outcome": "not_found", "searchFilter": "(|(uid=johndoe))"},
+	}, body["attemptedServers"])
+}
+
+func TestGetUserFromLDAPApiEndpoint_SeveralMatches(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	searchConfig := userSearchConfig
+	userSearchConfig = ldap.ServerConfig{Host: "ldap.example.org"}
+	defer func() { userSearchConfig = searchConfig }()
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	bus.AddHandler("test", func(query *models.SearchOrgsQuery) error {
+		query.Result = []*models.OrgDTO{}
+		return nil
+	})
+
+	// the search filter matched two entries, the first one by DN was picked
+	userSearchResult = &models.ExternalUserInfo{
+		AuthId:   "cn=johndoe,ou=engineering,dc=grafana,dc=org",
+		Login:    "johndoe",
+		OrgRoles: map[int64]models.RoleType{},
+	}
+	userSearchAttempts = []*multildap.ServerAttempt{
+		{Host: "ldap.example.org", Port: 389, Outcome: multildap.AttemptFound, MatchCount: 2},
+	}
+	defer func() { userSearchAttempts = nil }()
+
+	sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe")
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(sc.resp.Body.Bytes(), &body))
+
+	assert.Equal(t, float64(2), body["matchCount"])
+	assert.Equal(t, "The user search matched 2 entries, cn=johndoe,ou=engineering,dc=grafana,dc=org was picked "+
+		"as the first one by DN - Please verify the search filter", body["warning"])
+}
+
+func TestGetUserFromLDAPApiEndpoint_SingleMatch(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	searchConfig := userSearchConfig
+	userSearchConfig = ldap.ServerConfig{Host: "ldap.example.org"}
+	defer func() { userSearchConfig = searchConfig }()
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	bus.AddHandler("test", func(query *models.SearchOrgsQuery) error {
+		query.Result = []*models.OrgDTO{}
+		return nil
+	})
+
+	userSearchResult = &models.ExternalUserInfo{Login: "johndoe", OrgRoles: map[int64]models.RoleType{}}
+	userSearchAttempts = []*multildap.ServerAttempt{
+		{Host: "ldap.example.org", Port: 389, Outcome: multildap.AttemptFound, MatchCount: 1},
+	}
+	defer func() { userSearchAttempts = nil }()
+
+	sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe")
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(sc.resp.Body.Bytes(), &body))
+
+	assert.Equal(t, float64(1), body["matchCount"])
+	assert.NotContains(t, body, "warning")
+}
+
+func TestGetUserFromLDAPApiEndpoint_AmbiguousUser(t *testing.T) {
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	// the reject policy refused the two entries matched by the search filter
+	userSearchResult = nil
+	userSearchError = ldap.ErrAmbiguousUser
+	userSearchAttempts = []*multildap.ServerAttempt{
+		{Host: "ldap.example.org", Port: 389, Outcome: multildap.AttemptAmbiguous, Error: ldap.ErrAmbiguousUser, MatchCount: 2},
+	}
+	defer func() {
+		userSearchError = nil
+		userSearchAttempts = nil
+	}()
+
+	sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe")
+
+	require.Equal(t, http.StatusConflict, sc.resp.Code)
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(sc.resp.Body.Bytes(), &body))
+
+	assert.Equal(t, "The user search matched several LDAP entries - Please verify the search filter", body["message"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{
+			"host": "ldap.example.org", "port": float64(389), "outcome": "ambiguous",
+			"error": ldap.ErrAmbiguousUser.Error(), "matchCount": float64(2),
+		},
+	}, body["attemptedServers"])
+}
+
+func TestGetUserFromLDAPApiEndpoint_OrgServers(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	bus.AddHandler("test", func(query *models.SearchOrgsQuery) error {
+		query.Result = []*models.OrgDTO{}
+		return nil
+	})
+
+	searchConfig := userSearchConfig
+	userSearchConfig = ldap.ServerConfig{Host: "ldap.example.org"}
+	defer func() { userSearchConfig = searchConfig }()
+
+	userSearchResult = &models.ExternalUserInfo{Login: "johndoe", OrgRoles: map[int64]models.RoleType{}}
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{Servers: []*ldap.ServerConfig{
+			{Host: "ldap.example.org"},
+			{Host: "ldap.tenant-a.org", OrgID: 2},
+			{Host: "ldap.tenant-b.org", OrgID: 3},
+		}}, nil
+	}
+
+	var queried []string
+	newLDAP = func(servers []*ldap.ServerConfig) multildap.IMultiLDAP {
+		queried = []string{}
+		for _, server := range servers {
+			queried = append(queried, server.Host)
+		}
+
+		return &LDAPMock{}
+	}
+
+	t.Run("queries every server without orgId", func(t *testing.T) {
+		sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe")
+
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+		assert.Equal(t, []string{"ldap.example.org", "ldap.tenant-a.org", "ldap.tenant-b.org"}, queried)
+	})
+
+	t.Run("only queries the servers of the org", func(t *testing.T) {
+		sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe?orgId=2")
+
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+		assert.Equal(t, []string{"ldap.example.org", "ldap.tenant-a.org"}, queried)
+	})
+
+	t.Run("refuses an invalid orgId", func(t *testing.T) {
+		sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe?orgId=tenant-a")
+
+		require.Equal(t, http.StatusBadRequest, sc.resp.Code)
+	})
+
+	t.Run("fails for an org without server", func(t *testing.T) {
+		getLDAPConfig = func() (*ldap.Config, error) {
+			return &ldap.Config{Servers: []*ldap.ServerConfig{{Host: "ldap.tenant-a.org", OrgID: 2}}}, nil
+		}
+
+		sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe?orgId=3")
+
+		require.Equal(t, http.StatusNotFound, sc.resp.Code)
+
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(sc.resp.Body.Bytes(), &body))
+		assert.Equal(t, "No LDAP server serves the organization 3", body["message"])
+	})
+}
+
+func TestGetUserFromLDAPApiEndpoint_CachedUser(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	bus.AddHandler("test", func(query *models.SearchOrgsQuery) error {
+		query.Result = []*models.OrgDTO{}
+		return nil
+	})
+
+	searchConfig := userSearchConfig
+	userSearchConfig = ldap.ServerConfig{Host: "ldap.example.org"}
+	defer func() { userSearchConfig = searchConfig }()
+
+	userSearchResult = &models.ExternalUserInfo{Login: "johndoe", OrgRoles: map[int64]models.RoleType{}}
+
+	cachedAt := time.Date(2019, 10, 15, 10, 0, 0, 0, time.UTC)
+	userCached = &multildap.CachedUser{
+		User:     &models.ExternalUserInfo{Login: "johndoe", Name: "John Cached", OrgRoles: map[int64]models.RoleType{}},
+		Config:   ldap.ServerConfig{Host: "ldap.replica.org"},
+		CachedAt: cachedAt,
+	}
+	defer func() { userCached = nil }()
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{Servers: []*ldap.ServerConfig{{Host: "ldap.example.org"}}}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	t.Run("serves the cached user", func(t *testing.T) {
+		sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe")
+
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(sc.resp.Body.Bytes(), &body))
+		assert.Equal(t, "ldap.replica.org", body["server"])
+		assert.Equal(t, "2019-10-15T10:00:00Z", body["cachedAt"])
+	})
+
+	for _, query := range []string{"noCache=true", "timings=true"} {
+		t.Run("searches the user with "+query, func(t *testing.T) {
+			sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe?"+query)
+
+			require.Equal(t, http.StatusOK, sc.resp.Code)
+
+			var body map[string]interface{}
+			require.NoError(t, json.Unmarshal(sc.resp.Body.Bytes(), &body))
+			assert.Equal(t, "ldap.example.org", body["server"])
+			assert.NotContains(t, body, "cachedAt")
+		})
+	}
+}
+
+//***
+// GetLDAPStatus tests
+//***
+
+func getLDAPStatusContext(t *testing.T) *scenarioContext {
+	t.Helper()
+
+	requestURL := "/api/admin/ldap/status"
+	sc := setupScenarioContext(requestURL)
+
+	ldap := setting.LDAPEnabled
+	setting.LDAPEnabled = true
+	defer func() { setting.LDAPEnabled = ldap }()
+
+	hs := &HTTPServer{Cfg: setting.NewCfg()}
+
+	sc.defaultHandler = Wrap(func(c *models.ReqContext) Response {
+		sc.context = c
+		return hs.GetLDAPStatus(c)
+	})
+
+	sc.m.Get("/api/admin/ldap/status", sc.defaultHandler)
+
+	sc.resp = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, requestURL, nil)
+	sc.req = req
+	sc.exec()
+
+	return sc
+}
+
+func TestGetLDAPStatusApiEndpoint(t *testing.T) {
+	pingResult = []*multildap.ServerStatus{
+		{Host: "10.0.0.3", Port: 361, Available: true, Error: nil},
+		{Host: "10.0.0.3", Port: 362, Available: true, Error: nil},
+		{Host: "10.0.0.5", Port: 361, Available: false, Error: errors.New("something is awfully wrong")},
+	}
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	sc := getLDAPStatusContext(t)
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+	jsonResponse, err := getJSONbody(sc.resp)
+	assert.Nil(t, err)
+
+	expected := `
+	[
+		{ "host": "10.0.0.3", "port": 361, "available": true, "error": "" },
+		{ "host": "10.0.0.3", "port": 362, "available": true, "error": "" },
+		{ "host": "10.0.0.5", "port": 361, "available": false, "error": "something is awfully wrong" }
+	]
+	`
+	var expectedJSON interface{}
+	_ = json.Unmarshal([]byte(expected), &expectedJSON)
+
+	assert.Equal(t, expectedJSON, jsonResponse)
+}
+
+func TestGetLDAPStatusApiEndpoint_WithBind(t *testing.T) {
+	pingResult = []*multildap.ServerStatus{
+		{Host: "10.0.0.3", Port: 361, Available: true, BindStatus: multildap.BindStatusOK, BindLatency: 12 * time.Millisecond, BindMethod: ldap.BindMethodSASLExternal, Latency: 20 * time.Millisecond, SearchStatus: multildap.SearchStatusOK, SearchLatency: 3 * time.Millisecond},
+		{Host: "10.0.0.6", Port: 361, Available: true, BindStatus: multildap.BindStatusOK, BindLatency: 12 * time.Millisecond, BindMethod: ldap.BindMethodSimple, Latency: 20 * time.Millisecond, SearchStatus: multildap.SearchStatusFailed, SearchLatency: 2 * time.Millisecond, SearchError: errors.New("LDAP Result Code 50 \"Insufficient Access Rights\": password expired")},
+		{Host: "10.0.0.4", Port: 361, Available: true, BindStatus: multildap.BindStatusTimeout, BindLatency: 5 * time.Second, BindError: ldap.ErrBindTimeout, BindMethod: ldap.BindMethodSimple, Latency: 5010 * time.Millisecond, ExceededTimeout: multildap.TimeoutBind},
+		{Host: "10.0.0.5", Port: 361, Available: false, Error: errors.New("something is awfully wrong")},
+	}
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	sc := getLDAPStatusContext(t)
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+
+	expected := `
+	[
+		{ "host": "10.0.0.3", "port": 361, "available": true, "error": "", "bindStatus": "ok", "bindLatencyMs": 12, "bindMethod": "sasl_external", "latencyMs": 20, "searchStatus": "ok", "searchLatencyMs": 3 },
+		{ "host": "10.0.0.6", "port": 361, "available": true, "error": "", "bindStatus": "ok", "bindLatencyMs": 12, "bindMethod": "simple", "latencyMs": 20, "searchStatus": "failed", "searchLatencyMs": 2, "searchError": "LDAP Result Code 50 \"Insufficient Access Rights\": password expired" },
+		{ "host": "10.0.0.4", "port": 361, "available": true, "error": "", "bindStatus": "timeout", "bindLatencyMs": 5000, "bindError": "LDAP bind timed out", "bindMethod": "simple", "latencyMs": 5010, "exceededTimeout": "bind_timeout" },
+		{ "host": "10.0.0.5", "port": 361, "available": false, "error": "something is awfully wrong" }
+	]
+	`
+
+	assert.JSONEq(t, expected, sc.resp.Body.String())
+}
+
+func TestGetLDAPStatusApiEndpoint_TLSInsecure(t *testing.T) {
+	pingResult = []*multildap.ServerStatus{
+		{Host: "10.0.0.3", Port: 636, Available: true, TLSInsecure: true},
+		{Host: "10.0.0.4", Port: 636, Available: true},
+	}
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	sc := getLDAPStatusContext(t)
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+
+	expected := `
+	[
+		{ "host": "10.0.0.3", "port": 636, "available": true, "error": "", "tlsInsecure": true },
+		{ "host": "10.0.0.4", "port": 636, "available": true, "error": "" }
+	]
+	`
+
+	assert.JSONEq(t, expected, sc.resp.Body.String())
+}
+
+func TestGetLDAPStatusApiEndpoint_Certificate(t *testing.T) {
+	notAfter := time.Date(2019, 11, 1, 0, 0, 0, 0, time.UTC)
+	pingResult = []*multildap.ServerStatus{
+		{
+			Host: "10.0.0.3", Port: 636, Available: true,
+			Certificate:         &ldap.Certificate{Subject: "CN=ldap.example.org", Issuer: "CN=Example CA", NotAfter: notAfter},
+			CertificateExpiring: true,
+		},
+		{Host: "10.0.0.4", Port: 389, Available: true},
+	}
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	sc := getLDAPStatusContext(t)
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+
+	expected := `
+	[
+		{
+			"host": "10.0.0.3", "port": 636, "available": true, "error": "",
+			"certificate": { "subject": "CN=ldap.example.org", "issuer": "CN=Example CA", "notAfter": "2019-11-01T00:00:00Z" },
+			"certificateExpiring": true
+		},
+		{ "host": "10.0.0.4", "port": 389, "available": true, "error": "" }
+	]
+	`
+
+	assert.JSONEq(t, expected, sc.resp.Body.String())
+}
+
+func TestGetLDAPStatusApiEndpoint_DialErrorCategories(t *testing.T) {
+	pingResult = []*multildap.ServerStatus{
+		{Host: "10.0.0.3", Port: 389, Available: true},
+		{
+			Host: "ldap.example.invalid", Port: 389, Available: false,
+			Error:         errors.New("dial tcp: lookup ldap.example.invalid: no such host"),
+			ErrorCategory: multildap.DialErrorDNS, UnresolvedHost: "ldap.example.invalid",
+		},
+		{
+			Host: "10.0.0.5", Port: 389, Available: false,
+			Error:         errors.New("dial tcp 10.0.0.5:389: connect: connection refused"),
+			ErrorCategory: multildap.DialErrorRefused,
+		},
+	}
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	sc := getLDAPStatusContext(t)
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+
+	expected := `
+	[
+		{ "host": "10.0.0.3", "port": 389, "available": true, "error": "" },
+		{
+			"host": "ldap.example.invalid", "port": 389, "available": false,
+			"error": "dial tcp: lookup ldap.example.invalid: no such host",
+			"errorCategory": "dns", "unresolvedHost": "ldap.example.invalid"
+		},
+		{
+			"host": "10.0.0.5", "port": 389, "available": false,
+			"error": "dial tcp 10.0.0.5:389: connect: connection refused",
+			"errorCategory": "connection_refused"
+		}
+	]
+	`
+
+	assert.JSONEq(t, expected, sc.resp.Body.String())
+}
+
+func TestGetLDAPStatusApiEndpoint_AllUnavailable(t *testing.T) {
+	pingResult = []*multildap.ServerStatus{
+		{Host: "10.0.0.3", Port: 361, Available: false, Error: errors.New("something is awfully wrong")},
+		{Host: "10.0.0.5", Port: 361, Available: false, Error: errors.New("something is awfully wrong")},
+	}
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	sc := getLDAPStatusContext(t)
+
+	require.Equal(t, http.StatusServiceUnavailable, sc.resp.Code)
+
+	jsonResponse, err := getJSONbody(sc.resp)
+	assert.Nil(t, err)
+	assert.Len(t, jsonResponse, 2)
+}
+
+//***
+// PostSyncUserWithLDAP tests
+//***
+
+type syncUserState struct {
+	isDisabled bool
+	orgs       []*models.UserOrgDTO
+	teams      []*models.TeamMemberDTO
+}
+
+func postSyncUserWithLDAPContext(t *testing.T, requestURL string, state *syncUserState) *scenarioContext {
+	t.Helper()
+
+	sc := setupScenarioContext(requestURL)
+
+	ldap := setting.LDAPEnabled
+	setting.LDAPEnabled = true
+	defer func() { setting.LDAPEnabled = ldap }()
+
+	hs := &HTTPServer{
+		Cfg:              setting.NewCfg(),
+		AuthTokenService: auth.NewFakeUserAuthTokenService(),
+	}
+
+	sc.defaultHandler = Wrap(func(c *models.ReqContext) Response {
+		sc.context = c
+		return hs.PostSyncUserWithLDAP(c)
+	})
+
+	sc.m.Post("/api/admin/ldap/sync/:id", sc.defaultHandler)
+
+	bus.AddHandler("test", func(q *models.GetUserByIdQuery) error {
+		q.Result = &models.User{Id: q.Id, Login: "johndoe", IsDisabled: state.isDisabled}
+		return nil
+	})
+
+	bus.AddHandler("test", func(q *models.GetAuthInfoQuery) error {
+		q.Result = &models.UserAuth{UserId: q.UserId, AuthModule: models.AuthModuleLDAP}
+		return nil
+	})
+
+	bus.AddHandler("test", func(q *models.GetUserOrgListQuery) error {
+		q.Result = state.orgs
+		return nil
+	})
+
+	bus.AddHandler("test", func(q *models.GetTeamMembersQuery) error {
+		q.Result = state.teams
+		return nil
+	})
+
+	sc.resp = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, requestURL, nil)
+	sc.req = req
+	sc.exec()
+
+	return sc
+}
+
+func TestPostSyncUserWithLDAPAPIEndpoint_Filtered(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	denylist := setting.LDAPSyncDenylist
+	defer func() { setting.LDAPSyncDenylist = denylist }()
+	setting.LDAPSyncDenylist = []string{"john*"}
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	upserted := false
+	bus.AddHandler("test", func(cmd *models.UpsertUserCommand) error {
+		upserted = true
+		return nil
+	})
+
+	sc := postSyncUserWithLDAPContext(t, "/api/admin/ldap/sync/34", &syncUserState{})
+
+	assert.Equal(t, http.StatusBadRequest, sc.resp.Code)
+	assert.Contains(t, sc.resp.Body.String(), `User \"johndoe\" is excluded from the LDAP sync`)
+	assert.False(t, upserted)
+}
+
+func TestPostSyncUserWithLDAPAPIEndpoint_Changes(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	userSearchResult = &models.ExternalUserInfo{
+		Login:    "johndoe",
+		OrgRoles: map[int64]models.RoleType{1: models.ROLE_ADMIN, 2: models.ROLE_EDITOR, 4: models.ROLE_VIEWER},
+	}
+
+	state := &syncUserState{
+		orgs: []*models.UserOrgDTO{
+			{OrgId: 1, Role: models.ROLE_VIEWER},
+			{OrgId: 2, Role: models.ROLE_EDITOR},
+			{OrgId: 3, Role: models.ROLE_ADMIN},
+		},
+		teams: []*models.TeamMemberDTO{
+			{OrgId: 1, TeamId: 10},
+			{OrgId: 1, TeamId: 11},
+		},
+	}
+
+	upserted := false
+	bus.AddHandler("test", func(cmd *models.UpsertUserCommand) error {
+		upserted = true
+		assert.Equal(t, userSearchResult, cmd.ExternalUser)
+
+		state.orgs = []*models.UserOrgDTO{
+			{OrgId: 1, Role: models.ROLE_ADMIN},
+			{OrgId: 2, Role: models.ROLE_EDITOR},
+			{OrgId: 4, Role: models.ROLE_VIEWER},
+		}
+		state.teams = []*models.TeamMemberDTO{
+			{OrgId: 1, TeamId: 10},
+			{OrgId: 1, TeamId: 12},
+		}
+		return nil
+	})
+
+	sc := postSyncUserWithLDAPContext(t, "/api/admin/ldap/sync/34", state)
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+	assert.True(t, upserted)
+
+	expected := `
+	{
+		"message": "User synced successfully",
+		"changes": {
+			"orgRolesAdded": [{"orgId": 4, "role": "Viewer"}],
+			"orgRolesChanged": [{"orgId": 1, "role": "Admin", "previousRole": "Viewer"}],
+			"orgRolesRemoved": [{"orgId": 3, "previousRole": "Admin"}],
+			"teamsAdded": [{"orgId": 1, "teamId": 12}],
+			"teamsRemoved": [{"orgId": 1, "teamId": 11}],
+			"action": "none",
+			"blockedDowngrades": []
+		}
+	}
+	`
+
+	assert.JSONEq(t, expected, sc.resp.Body.String())
+}
+
+func TestPostSyncUserWithLDAPAPIEndpoint_DryRun(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	userSearchResult = &models.ExternalUserInfo{
+		Login:    "johndoe",
+		Email:    "john.doe@example.org",
+		OrgRoles: map[int64]models.RoleType{1: models.ROLE_ADMIN, 2: models.ROLE_EDITOR},
+	}
+
+	state := &syncUserState{
+		orgs: []*models.UserOrgDTO{
+			{OrgId: 1, Role: models.ROLE_VIEWER},
+			{OrgId: 3, Role: models.ROLE_ADMIN},
+		},
+		teams: []*models.TeamMemberDTO{},
+	}
+
+	bus.AddHandler("test", func(cmd *models.UpsertUserCommand) error {
+		t.Error("the user was upserted by a dry run")
+		return nil
+	})
+
+	sc := postSyncUserWithLDAPContext(t, "/api/admin/ldap/sync/34?dryRun=true", state)
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+
+	expected := `
+	{
+		"message": "Dry run, the user would be synced",
+		"dryRun": true,
+		"email": {"value": "john.doe@example.org", "previous": ""},
+		"changes": {
+			"orgRolesAdded": [{"orgId": 2, "role": "Editor"}],
+			"orgRolesChanged": [{"orgId": 1, "role": "Admin", "previousRole": "Viewer"}],
+			"orgRolesRemoved": [{"orgId": 3, "previousRole": "Admin"}],
+			"teamsAdded": [],
+			"teamsRemoved": [],
+			"action": "none",
+			"blockedDowngrades": []
+		}
+	}
+	`
+
+	assert.JSONEq(t, expected, sc.resp.Body.String())
+}
+
+func TestPostSyncUserWithLDAPAPIEndpoint_UserNotFoundInLDAP(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	userSearchResult = nil
+	userSearchError = multildap.ErrDidNotFindUser
+	defer func() { userSearchError = nil }()
+
+	state := &syncUserState{
+		orgs: []*models.UserOrgDTO{{OrgId: 1, Role: models.ROLE_VIEWER}},
+	}
+
+	bus.AddHandler("test", func(q *models.GetExternalUserInfoByLoginQuery) error {
+		q.Result = &models.ExternalUserInfo{UserId: 34, Login: q.LoginOrEmail}
+		return nil
+	})
+
+	bus.AddHandler("test", func(cmd *models.DisableUserCommand) error {
+		assert.Equal(t, int64(34), cmd.UserId)
+		state.isDisabled = cmd.IsDisabled
+		return nil
+	})
+
+	sc := postSyncUserWithLDAPContext(t, "/api/admin/ldap/sync/34", state)
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+
+	expected := `
+	{
+		"message": "User not found in LDAP. Disabled the user without updating information",
+		"changes": {
+			"orgRolesAdded": [],
+			"orgRolesChanged": [],
+			"orgRolesRemoved": [],
+			"teamsAdded": [],
+			"teamsRemoved": [],
+			"action": "disabled",
+			"blockedDowngrades": []
+		}
+	}
+	`
+
+	assert.JSONEq(t, expected, sc.resp.Body.String())
+}
+
+func TestPostSyncUserWithLDAPAPIEndpoint_PartialOutage(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	policy := setting.LDAPDisableMissingUsers
+	setting.LDAPDisableMissingUsers = setting.LDAPDisableMissingUnanimous
+	defer func() { setting.LDAPDisableMissingUsers = policy }()
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	userSearchResult = nil
+	userSearchError = multildap.ErrDidNotFindUser
+	userSearchAttempts = []*multildap.ServerAttempt{
+		{Host: "ldap.example.org", Port: 389, Outcome: multildap.AttemptUnreachable},
+		{Host: "ldap-replica.example.org", Port: 389, Outcome: multildap.AttemptNotFound},
+	}
+	defer func() {
+		userSearchError = nil
+		userSearchAttempts = nil
+	}()
+
+	state := &syncUserState{}
+
+	bus.AddHandler("test", func(cmd *models.DisableUserCommand) error {
+		state.isDisabled = cmd.IsDisabled
+		return nil
+	})
+
+	sc := postSyncUserWithLDAPContext(t, "/api/admin/ldap/sync/34", state)
+
+	require.Equal(t, http.StatusServiceUnavailable, sc.resp.Code)
+	assert.False(t, state.isDisabled)
+	assert.Contains(t, sc.resp.Body.String(), "it wasn't disabled")
+}
+
+func TestPostSyncUserWithLDAPAPIEndpoint_GrafanaAdmin(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	adminUser := setting.AdminUser
+	setting.AdminUser = "johndoe"
+	defer func() { setting.AdminUser = adminUser }()
+
+	userSearchResult = nil
+	userSearchError = multildap.ErrDidNotFindUser
+	defer func() { userSearchError = nil }()
+
+	sc := postSyncUserWithLDAPContext(t, "/api/admin/ldap/sync/34", &syncUserState{})
+
+	require.Equal(t, http.StatusBadRequest, sc.resp.Code)
+	assert.JSONEq(t, `{"message": "Refusing to sync grafana super admin \"johndoe\" - it would be disabled", "error": "Refusing to sync grafana super admin - it would be disabled"}`, sc.resp.Body.String())
+}
+
+func postSyncUserByLoginContext(t *testing.T, requestURL string, existing *models.User) *scenarioContext {
+	t.Helper()
+
+	sc := setupScenarioContext(requestURL)
+
+	ldap := setting.LDAPEnabled
+	setting.LDAPEnabled = true
+	defer func() { setting.LDAPEnabled = ldap }()
+
+	hs := &HTTPServer{
+		Cfg:              setting.NewCfg(),
+		AuthTokenService: auth.NewFakeUserAuthTokenService(),
+	}
+
+	sc.defaultHandler = Wrap(func(c *models.ReqContext) Response {
+		sc.context = c
+		return hs.PostSyncAllUsersWithLDAP(c)
+	})
+
+	sc.m.Post("/api/admin/ldap/sync", sc.defaultHandler)
+
+	// like the store, the users are found by their email too
+	bus.AddHandler("test", func(q *models.GetUserByLoginQuery) error {
+		if existing == nil || (q.LoginOrEmail != existing.Login && q.LoginOrEmail != existing.Email) {
+			return models.ErrUserNotFound
+		}
+		q.Result = existing
+		return nil
+	})
+
+	bus.AddHandler("test", func(q *models.GetUserByIdQuery) error {
+		q.Result = &models.User{Id: q.Id, Login: "johndoe"}
+		return nil
+	})
+
+	bus.AddHandler("test", func(q *models.GetAuthInfoQuery) error {
+		q.Result = &models.UserAuth{UserId: q.UserId, AuthModule: models.AuthModuleLDAP}
+		return nil
+	})
+
+	bus.AddHandler("test", func(q *models.GetUserOrgListQuery) error {
+		q.Result = []*models.UserOrgDTO{{OrgId: 1, Role: models.ROLE_EDITOR}}
+		return nil
+	})
+
+	bus.AddHandler("test", func(q *models.GetTeamMembersQuery) error {
+		q.Result = []*models.TeamMemberDTO{}
+		return nil
+	})
+
+	sc.resp = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, requestURL, nil)
+	sc.req = req
+	sc.exec()
+
+	return sc
+}
+
+func TestPostSyncUserWithLDAPAPIEndpoint_ByLogin(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	allowSignup := setting.LDAPAllowSignup
+	defer func() { setting.LDAPAllowSignup = allowSignup }()
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	defer func() { userSearchError = nil }()
+
+	// setup mocks the LDAP user, and returns the users upserted by the sync
+	setup := func(err error) *[]*models.ExternalUserInfo {
+		bus.ClearBusHandlers()
+		setting.LDAPAllowSignup = true
+
+		userSearchResult, userSearchError = nil, err
+		if err == nil {
+			userSearchResult = &models.ExternalUserInfo{Login: "johndoe", OrgRoles: map[int64]models.RoleType{1: models.ROLE_EDITOR}}
+		}
+
+		upserted := []*models.ExternalUserInfo{}
+		bus.AddHandler("test", func(cmd *models.UpsertUserCommand) error {
+			upserted = append(upserted, cmd.ExternalUser)
+			cmd.Result = &models.User{Id: 34, Login: cmd.ExternalUser.Login}
+			return nil
+		})
+
+		return &upserted
+	}
+
+	t.Run("syncs the existing user with the login", func(t *testing.T) {
+		upserted := setup(nil)
+
+		sc := postSyncUserByLoginContext(t, "/api/admin/ldap/sync?login=johndoe", &models.User{Id: 34, Login: "johndoe"})
+
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+		assert.Len(t, *upserted, 1)
+
+		assert.Contains(t, sc.resp.Body.String(), `"message":"User synced successfully"`)
+	})
+
+	t.Run("creates the user which never logged in", func(t *testing.T) {
+		upserted := setup(nil)
+
+		sc := postSyncUserByLoginContext(t, "/api/admin/ldap/sync?login=johndoe", nil)
+
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+		assert.Len(t, *upserted, 1)
+
+		expected := `
+		{
+			"message": "User created and synced successfully",
+			"userId": 34,
+			"changes": {
+				"orgRolesAdded": [{"orgId": 1, "role": "Editor"}],
+				"orgRolesChanged": [],
+				"orgRolesRemoved": [],
+				"teamsAdded": [],
+				"teamsRemoved": [],
+				"action": "created",
+				"blockedDowngrades": []
+			}
+		}
+		`
+
+		assert.JSONEq(t, expected, sc.resp.Body.String())
+	})
+
+	t.Run("doesn't sync another user whose email is the login", func(t *testing.T) {
+		upserted := setup(nil)
+
+		sc := postSyncUserByLoginContext(t, "/api/admin/ldap/sync?login=johndoe", &models.User{Id: 35, Login: "jane", Email: "johndoe"})
+
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+		require.Len(t, *upserted, 1)
+		assert.Equal(t, "johndoe", (*upserted)[0].Login)
+		assert.Contains(t, sc.resp.Body.String(), `"message":"User created and synced successfully"`)
+	})
+
+	t.Run("doesn't create the user on a dry run", func(t *testing.T) {
+		upserted := setup(nil)
+
+		sc := postSyncUserByLoginContext(t, "/api/admin/ldap/sync?login=johndoe&dryRun=true", nil)
+
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+		assert.Empty(t, *upserted)
+		assert.JSONEq(t, `{"message": "Dry run, the user would be created as it has no Grafana user yet", "dryRun": true}`, sc.resp.Body.String())
+	})
+
+	t.Run("doesn't create the user missing from LDAP", func(t *testing.T) {
+		upserted := setup(multildap.ErrDidNotFindUser)
+
+		sc := postSyncUserByLoginContext(t, "/api/admin/ldap/sync?login=johndoe", nil)
+
+		assert.Equal(t, http.StatusNotFound, sc.resp.Code)
+		assert.Contains(t, sc.resp.Body.String(), `User \"johndoe\" was found neither in Grafana nor in LDAP`)
+		assert.Empty(t, *upserted)
+	})
+
+	t.Run("doesn't create the user without allow_sign_up", func(t *testing.T) {
+		upserted := setup(nil)
+		setting.LDAPAllowSignup = false
+
+		sc := postSyncUserByLoginContext(t, "/api/admin/ldap/sync?login=johndoe", nil)
+
+		assert.Equal(t, http.StatusBadRequest, sc.resp.Code)
+		assert.Contains(t, sc.resp.Body.String(), "allow_sign_up is disabled")
+		assert.Empty(t, *upserted)
+	})
+}
+
+//***
+// GetLDAPConfigHash tests
+//***
+
+func TestGetLDAPConfigHashAPIEndpoint(t *testing.T) {
+	config := &ldap.Config{
+		Servers: []*ldap.ServerConfig{
+			{Host: "10.0.0.1", Port: 389},
+		},
+	}
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return config, nil
+	}
 
-func getLDAPStatusContext(t *testing.T) *scenarioContext {
+	sc := setupScenarioContext("/api/admin/ldap/config/hash")
+
+	ldap := setting.LDAPEnabled
+	setting.LDAPEnabled = true
+	defer func() { setting.LDAPEnabled = ldap }()
+
+	hs := &HTTPServer{Cfg: setting.NewCfg()}
+
+	sc.defaultHandler = Wrap(func(c *models.ReqContext) Response {
+		sc.context = c
+		return hs.GetLDAPConfigHash(c)
+	})
+
+	sc.m.Get("/api/admin/ldap/config/hash", sc.defaultHandler)
+
+	sc.resp = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/admin/ldap/config/hash", nil)
+	sc.req = req
+	sc.exec()
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+
+	expected, err := config.Hash()
+	require.Nil(t, err)
+
+	assert.JSONEq(t, fmt.Sprintf(`{"configHash": "%s"}`, expected), sc.resp.Body.String())
+}
+
+//***
+// PostPreflightLDAPSync tests
+//***
+
+func postPreflightLDAPSyncContext(t *testing.T) *scenarioContext {
 	t.Helper()
 
-	requestURL := "/api/admin/ldap/status"
+	requestURL := "/api/admin/ldap/sync/preflight"
 	sc := setupScenarioContext(requestURL)
 
 	ldap := setting.LDAPEnabled
@@ -338,26 +2877,462 @@ func getLDAPStatusContext(t *testing.T) *scenarioContext {
 
 	sc.defaultHandler = Wrap(func(c *models.ReqContext) Response {
 		sc.context = c
-		return hs.GetLDAPStatus(c)
+		return hs.PostPreflightLDAPSync(c)
 	})
 
-	sc.m.Get("/api/admin/ldap/status", sc.defaultHandler)
+	sc.m.Post("/api/admin/ldap/sync/preflight", sc.defaultHandler)
+
+	sc.resp = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, requestURL, nil)
+	sc.req = req
+	sc.exec()
+
+	return sc
+}
+
+func TestPostPreflightLDAPSyncAPIEndpoint(t *testing.T) {
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{
+			Servers: []*ldap.ServerConfig{
+				{
+					Groups: []*ldap.GroupToOrgRole{
+						{GroupDN: "cn=admins,ou=groups,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_ADMIN},
+						{GroupDN: "cn=editors,ou=groups,dc=grafana,dc=org", OrgID: 2, OrgRole: models.ROLE_EDITOR},
+					},
+				},
+			},
+		}, nil
+	}
+
+	for _, tc := range []struct {
+		desc     string
+		orgs     []*models.OrgDTO
+		expected string
+	}{
+		{
+			desc:     "valid config",
+			orgs:     []*models.OrgDTO{{Id: 1}, {Id: 2}},
+			expected: `{"valid": true, "missingOrgIds": []}`,
+		},
+		{
+			desc:     "invalid config",
+			orgs:     []*models.OrgDTO{{Id: 1}},
+			expected: `{"valid": false, "missingOrgIds": [2]}`,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			bus.ClearBusHandlers()
+			defer bus.ClearBusHandlers()
+
+			bus.AddHandler("test", func(query *models.SearchOrgsQuery) error {
+				query.Result = tc.orgs
+				return nil
+			})
+
+			sc := postPreflightLDAPSyncContext(t)
+
+			require.Equal(t, http.StatusOK, sc.resp.Code)
+			assert.JSONEq(t, tc.expected, sc.resp.Body.String())
+		})
+	}
+}
+
+//***
+// GetLDAPSyncHistory tests
+//***
+
+func TestGetLDAPSyncHistoryAPIEndpoint(t *testing.T) {
+	history := ldapsync.NewHistory(2, 0)
+	history.Record("jdoe", 2, &ldapsync.Changes{Action: ldapsync.ActionNone}, nil)
+	history.Record("asmith", 3, nil, errors.New("None of the LDAP servers are reachable"))
+	history.Record("bwayne", 4, &ldapsync.Changes{Action: ldapsync.ActionDisabled}, nil)
+
+	getLDAPSyncHistory = func() *ldapsync.History {
+		return history
+	}
+	defer func() { getLDAPSyncHistory = ldapsync.SyncHistory }()
+
+	requestURL := "/api/admin/ldap/sync/history"
+	sc := setupScenarioContext(requestURL)
+
+	ldap := setting.LDAPEnabled
+	setting.LDAPEnabled = true
+	defer func() { setting.LDAPEnabled = ldap }()
+
+	hs := &HTTPServer{Cfg: setting.NewCfg()}
+
+	sc.defaultHandler = Wrap(func(c *models.ReqContext) Response {
+		sc.context = c
+		return hs.GetLDAPSyncHistory(c)
+	})
+
+	sc.m.Get(requestURL, sc.defaultHandler)
 
 	sc.resp = httptest.NewRecorder()
 	req, _ := http.NewRequest(http.MethodGet, requestURL, nil)
 	sc.req = req
 	sc.exec()
 
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+
+	var response []struct {
+		Login   string            `json:"login"`
+		Changes *ldapsync.Changes `json:"changes"`
+		Error   string            `json:"error"`
+	}
+	require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+
+	require.Len(t, response, 2)
+	assert.Equal(t, "bwayne", response[0].Login)
+	assert.Equal(t, ldapsync.ActionDisabled, response[0].Changes.Action)
+	assert.Equal(t, "asmith", response[1].Login)
+	assert.Equal(t, "None of the LDAP servers are reachable", response[1].Error)
+}
+
+//***
+// ReloadLDAPCfg tests
+//***
+
+func reloadLDAPCfgContext(t *testing.T) *scenarioContext {
+	t.Helper()
+
+	requestURL := "/api/admin/ldap/reload"
+	sc := setupScenarioContext(requestURL)
+
+	ldap := setting.LDAPEnabled
+	setting.LDAPEnabled = true
+	defer func() { setting.LDAPEnabled = ldap }()
+
+	hs := &HTTPServer{Cfg: setting.NewCfg()}
+
+	sc.defaultHandler = Wrap(hs.ReloadLDAPCfg)
+
+	sc.m.Post("/api/admin/ldap/reload", sc.defaultHandler)
+
+	sc.resp = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, requestURL, nil)
+	sc.req = req
+	sc.exec()
+
 	return sc
 }
 
-func TestGetLDAPStatusApiEndpoint(t *testing.T) {
-	pingResult = []*multildap.ServerStatus{
-		{Host: "10.0.0.3", Port: 361, Available: true, Error: nil},
-		{Host: "10.0.0.3", Port: 362, Available: true, Error: nil},
-		{Host: "10.0.0.5", Port: 361, Available: false, Error: errors.New("something is awfully wrong")},
+func TestReloadLDAPCfg_Conflicts(t *testing.T) {
+	reloadLDAPConfig = func() (*ldap.ConfigDiff, error) {
+		return nil, &ldap.ConfigConflictError{Conflicts: []string{
+			"server ldap.example.org:389 of /etc/grafana/ldap.d/b.toml is already defined in the main config file",
+		}}
+	}
+	defer func() { reloadLDAPConfig = ldap.ReloadConfig }()
+
+	sc := reloadLDAPCfgContext(t)
+
+	require.Equal(t, http.StatusInternalServerError, sc.resp.Code)
+
+	expected := `
+		{
+			"message": "Failed to reload ldap config, the included config files conflict.",
+			"conflicts": [
+				"server ldap.example.org:389 of /etc/grafana/ldap.d/b.toml is already defined in the main config file"
+			]
+		}
+	`
+	assert.JSONEq(t, expected, sc.resp.Body.String())
+}
+
+func TestReloadLDAPCfg_Changes(t *testing.T) {
+	reloadLDAPConfig = func() (*ldap.ConfigDiff, error) {
+		previous := &ldap.Config{Servers: []*ldap.ServerConfig{{
+			Host:   "ldap.example.org",
+			Port:   389,
+			Groups: []*ldap.GroupToOrgRole{{GroupDN: "cn=admins,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_ADMIN}},
+		}}}
+
+		current := &ldap.Config{Servers: []*ldap.ServerConfig{
+			{
+				Host:   "ldap.example.org",
+				Port:   389,
+				Groups: []*ldap.GroupToOrgRole{{GroupDN: "cn=admins,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_EDITOR}},
+			},
+			{Host: "ad.example.org", Port: 636},
+		}}
+
+		return ldap.DiffConfigs(previous, current), nil
+	}
+	defer func() { reloadLDAPConfig = ldap.ReloadConfig }()
+
+	sc := reloadLDAPCfgContext(t)
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+
+	expected := `
+		{
+			"message": "LDAP config reloaded",
+			"changes": {
+				"serversAdded": ["ad.example.org:636"],
+				"serversRemoved": [],
+				"groupMappingsAdded": [],
+				"groupMappingsRemoved": [],
+				"groupMappingsChanged": [
+					{
+						"server": "ldap.example.org:389",
+						"groupDN": "cn=admins,dc=grafana,dc=org",
+						"orgId": 1,
+						"orgRole": "Editor",
+						"grafanaAdmin": null,
+						"matchType": "",
+						"previous": {"orgRole": "Admin", "grafanaAdmin": null, "matchType": ""}
+					}
+				],
+				"attributesChanged": []
+			}
+		}
+	`
+	assert.JSONEq(t, expected, sc.resp.Body.String())
+}
+
+//***
+// GetGroupFromLDAP tests
+//***
+
+func getGroupFromLDAPContext(t *testing.T, requestURL string) *scenarioContext {
+	t.Helper()
+
+	sc := setupScenarioContext(requestURL)
+
+	ldap := setting.LDAPEnabled
+	setting.LDAPEnabled = true
+	defer func() { setting.LDAPEnabled = ldap }()
+
+	hs := &HTTPServer{Cfg: setting.NewCfg()}
+
+	sc.defaultHandler = Wrap(hs.GetGroupFromLDAP)
+
+	sc.m.Get("/api/admin/ldap/groups/:groupDN", sc.defaultHandler)
+
+	sc.resp = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, requestURL, nil)
+	sc.req = req
+	sc.exec()
+
+	return sc
+}
+
+func TestGetGroupFromLDAPApiEndpoint(t *testing.T) {
+	defer func() {
+		getLDAPConfig = multildap.GetConfig
+		newLDAP = multildap.NewSession
+		findGroupResult = nil
+	}()
+
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	isAdmin := true
+	admins := "cn=admins,ou=groups,dc=grafana,dc=org"
+
+	serverConfig := &ldap.ServerConfig{
+		Host: "ldap.example.org",
+		Port: 389,
+		Groups: []*ldap.GroupToOrgRole{
+			{GroupDN: "cn=editors,ou=groups,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_EDITOR},
+			{GroupDN: "CN=Admins,OU=Groups,DC=Grafana,DC=Org", OrgID: 1, OrgRole: models.ROLE_ADMIN, IsGrafanaAdmin: &isAdmin},
+			{GroupDN: "*", OrgID: 1, OrgRole: models.ROLE_VIEWER},
+			{GroupDN: "*", OrgID: 2, OrgRole: models.ROLE_VIEWER},
+		},
+		FolderMappings: []*ldap.GroupToFolderPermission{
+			{GroupDN: admins, OrgID: 1, FolderID: 7, Permission: "Admin"},
+			{GroupDN: "cn=editors,ou=groups,dc=grafana,dc=org", OrgID: 1, FolderID: 8, Permission: "Edit"},
+		},
+	}
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{Servers: []*ldap.ServerConfig{serverConfig}}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	bus.AddHandler("test", func(query *models.SearchOrgsQuery) error {
+		query.Result = []*models.OrgDTO{{Id: 1, Name: "Main Org."}, {Id: 2, Name: "Other Org."}}
+		return nil
+	})
+
+	bus.AddHandler("test", func(cmd *models.GetTeamsForLDAPGroupCommand) error {
+		assert.Equal(t, []string{admins}, cmd.Groups)
+		cmd.Result = []models.TeamOrgGroupDTO{{TeamName: "Admins", OrgId: 1, OrgName: "Main Org."}}
+		return nil
+	})
+
+	t.Run("shows what the members of the group get", func(t *testing.T) {
+		findGroupResult = []*multildap.GroupLookup{
+			{Host: "ldap.example.org", Port: 389, Available: true, Checked: true, Found: true, Config: serverConfig},
+		}
+
+		sc := getGroupFromLDAPContext(t, "/api/admin/ldap/groups/"+admins)
+
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+		assert.Equal(t, admins, findGroupDN)
+
+		expected := `
+			{
+				"groupDN": "cn=admins,ou=groups,dc=grafana,dc=org",
+				"servers": [
+					{
+						"host": "ldap.example.org",
+						"port": 389,
+						"available": true,
+						"found": true,
+						"isGrafanaAdmin": true,
+						"roles": [
+							{
+								"orgId": 1,
+								"orgName": "Main Org.",
+								"orgRole": "Admin",
+								"groupDN": "CN=Admins,OU=Groups,DC=Grafana,DC=Org",
+								"contributors": [
+									{"orgId": 1, "orgName": "Main Org.", "orgRole": "Admin", "groupDN": "CN=Admins,OU=Groups,DC=Grafana,DC=Org", "won": true},
+									{"orgId": 1, "orgName": "Main Org.", "orgRole": "Viewer", "groupDN": "*"}
+								]
+							},
+							{"orgId": 2, "orgName": "Other Org.", "orgRole": "Viewer", "groupDN": "*"}
+						],
+						"folderPermissions": [
+							{"orgId": 1, "folderId": 7, "permission": "Admin", "groupDN": "cn=admins,ou=groups,dc=grafana,dc=org"}
+						]
+					}
+				],
+				"teams": [
+					{"orgId": 1, "orgName": "Main Org.", "teamName": "Admins", "groupDN": ""}
+				]
+			}
+		`
+		assert.JSONEq(t, expected, sc.resp.Body.String())
+	})
+
+	t.Run("reports the servers which couldn't look up the group", func(t *testing.T) {
+		findGroupResult = []*multildap.GroupLookup{
+			{Host: "ldap.example.org", Port: 389, Error: errors.New("Dial error"), Config: serverConfig},
+		}
+
+		sc := getGroupFromLDAPContext(t, "/api/admin/ldap/groups/"+admins)
+
+		require.Equal(t, http.StatusServiceUnavailable, sc.resp.Code)
+
+		var response LDAPGroupDTO
+		require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+		require.Len(t, response.Servers, 1)
+		assert.False(t, response.Servers[0].Available)
+		assert.Nil(t, response.Servers[0].Found)
+		assert.Equal(t, "Dial error", response.Servers[0].Error)
+		assert.Len(t, response.Servers[0].OrgRoles, 2)
+	})
+}
+
+//***
+// LDAP disabled or not configured tests
+//***
+
+func ldapEndpointContext(t *testing.T, enabled bool, method string, requestURL string) *scenarioContext {
+	t.Helper()
+
+	sc := setupScenarioContext(requestURL)
+
+	ldap := setting.LDAPEnabled
+	setting.LDAPEnabled = enabled
+	defer func() { setting.LDAPEnabled = ldap }()
+
+	hs := &HTTPServer{
+		Cfg:              setting.NewCfg(),
+		AuthTokenService: auth.NewFakeUserAuthTokenService(),
+	}
+
+	sc.m.Get("/api/admin/ldap/status", Wrap(hs.GetLDAPStatus))
+	sc.m.Get("/api/admin/ldap/:username", Wrap(hs.GetUserFromLDAP))
+	sc.m.Get("/api/admin/ldap/groups/:groupDN", Wrap(hs.GetGroupFromLDAP))
+	sc.m.Post("/api/admin/ldap/sync/:id", Wrap(hs.PostSyncUserWithLDAP))
+	sc.m.Post("/api/admin/ldap/reload", Wrap(hs.ReloadLDAPCfg))
+
+	sc.resp = httptest.NewRecorder()
+	req, _ := http.NewRequest(method, requestURL, nil)
+	sc.req = req
+	sc.exec()
+
+	return sc
+}
+
+func TestLDAPEndpoints_DisabledOrNotConfigured(t *testing.T) {
+	defer func() {
+		getLDAPConfig = multildap.GetConfig
+		reloadLDAPConfig = ldap.ReloadConfig
+	}()
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return nil, ldap.ErrNoServersConfigured
+	}
+
+	reloadLDAPConfig = func() (*ldap.ConfigDiff, error) {
+		return nil, ldap.ErrNoServersConfigured
+	}
+
+	endpoints := []struct {
+		method string
+		url    string
+	}{
+		{http.MethodGet, "/api/admin/ldap/status"},
+		{http.MethodGet, "/api/admin/ldap/johndoe"},
+		{http.MethodGet, "/api/admin/ldap/groups/cn=admins,dc=grafana,dc=org"},
+		{http.MethodPost, "/api/admin/ldap/sync/34"},
+		{http.MethodPost, "/api/admin/ldap/reload"},
+	}
+
+	for _, endpoint := range endpoints {
+		t.Run(endpoint.method+" "+endpoint.url, func(t *testing.T) {
+			t.Run("tells LDAP is disabled by setting", func(t *testing.T) {
+				sc := ldapEndpointContext(t, false, endpoint.method, endpoint.url)
+
+				assert.Equal(t, http.StatusBadRequest, sc.resp.Code)
+				assert.JSONEq(t, `{"message": "LDAP integration disabled by setting"}`, sc.resp.Body.String())
+			})
+
+			t.Run("tells LDAP is enabled without servers", func(t *testing.T) {
+				sc := ldapEndpointContext(t, true, endpoint.method, endpoint.url)
+
+				assert.Equal(t, http.StatusServiceUnavailable, sc.resp.Code)
+
+				var response map[string]string
+				require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+				assert.Equal(t, "LDAP enabled but no servers configured", response["message"])
+			})
+		})
+	}
+}
+
+func TestGetUserFromLDAPApiEndpoint_WithRawAttributes(t *testing.T) {
+	userSearchResult = &models.ExternalUserInfo{
+		Name:  "John Doe",
+		Email: "john.doe@example.com",
+		Login: "johndoe",
+	}
+
+	userSearchConfig = ldap.ServerConfig{
+		Attr: ldap.AttributeMap{
+			Username: "ldap-username",
+		},
 	}
 
+	userAttributesResult = map[string][]string{
+		"mail":              {"john.doe@example.com"},
+		"userPrincipalName": {"jdoe@corp.example.com"},
+	}
+	userAttributesError = nil
+
+	bus.AddHandler("test", func(query *models.SearchOrgsQuery) error {
+		query.Result = []*models.OrgDTO{}
+		return nil
+	})
+
 	getLDAPConfig = func() (*ldap.Config, error) {
 		return &ldap.Config{}, nil
 	}
@@ -366,21 +3341,32 @@ func TestGetLDAPStatusApiEndpoint(t *testing.T) {
 		return &LDAPMock{}
 	}
 
-	sc := getLDAPStatusContext(t)
+	t.Run("with raw attributes", func(t *testing.T) {
+		sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe?raw=true")
 
-	require.Equal(t, http.StatusOK, sc.resp.Code)
-	jsonResponse, err := getJSONbody(sc.resp)
-	assert.Nil(t, err)
+		require.Equal(t, http.StatusOK, sc.resp.Code)
 
-	expected := `
-	[
-		{ "host": "10.0.0.3", "port": 361, "available": true, "error": "" },
-		{ "host": "10.0.0.3", "port": 362, "available": true, "error": "" },
-		{ "host": "10.0.0.5", "port": 361, "available": false, "error": "something is awfully wrong" }
-	]
-	`
-	var expectedJSON interface{}
-	_ = json.Unmarshal([]byte(expected), &expectedJSON)
+		var response LDAPUserDTO
+		require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+		assert.Equal(t, userAttributesResult, response.RawAttributes)
+	})
 
-	assert.Equal(t, expectedJSON, jsonResponse)
+	t.Run("without raw attributes", func(t *testing.T) {
+		sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe")
+
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+
+		var response map[string]interface{}
+		require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+		assert.NotContains(t, response, "rawAttributes")
+	})
+
+	t.Run("fails when the attributes can't be fetched", func(t *testing.T) {
+		userAttributesError = errors.New("search failed")
+		defer func() { userAttributesError = nil }()
+
+		sc := getUserFromLDAPContext(t, "/api/admin/ldap/johndoe?raw=true")
+
+		assert.Equal(t, http.StatusInternalServerError, sc.resp.Code)
+	})
 }
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/localcache"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// idempotencyKeyHeader is the header used by the clients to identify the retries of a request
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// ldapIdempotencyTTL is how long the response to a request with an idempotency key is replayed
+const ldapIdempotencyTTL = time.Hour
+
+var ldapIdempotencyKeys = localcache.New(ldapIdempotencyTTL, 2*ldapIdempotencyTTL)
+
+// withIdempotencyKey replays the response to a prior request with the same
+// Idempotency-Key header instead of running the handler again.
+// Server errors aren't stored, so that a retry can succeed.
+func withIdempotencyKey(c *models.ReqContext, handler func() Response) Response {
+	key := c.Req.Header.Get(idempotencyKeyHeader)
+	if key == "" {
+		return handler()
+	}
+
+	// the same key may be used for different endpoints or users
+	cacheKey := c.Req.Method + " " + c.Req.URL.Path + " " + key
+
+	if cached, ok := ldapIdempotencyKeys.Get(cacheKey); ok {
+		logger.Debug("Replaying the response to a prior request", "key", key)
+		return cached.(Response)
+	}
+
+	response := handler()
+
+	if normal, ok := response.(*NormalResponse); ok && normal.status < http.StatusInternalServerError {
+		ldapIdempotencyKeys.Set(cacheKey, response, ldapIdempotencyTTL)
+	}
+
+	return response
+}
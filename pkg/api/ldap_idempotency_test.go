@@ -0,0 +1,95 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/infra/localcache"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+//***
+// withIdempotencyKey tests
+//***
+
+func idempotencyContext(t *testing.T, requestURL string, key string, handler func() Response) *scenarioContext {
+	t.Helper()
+
+	sc := setupScenarioContext(requestURL)
+
+	sc.m.Post("/api/admin/ldap/sync/:id", Wrap(func(c *models.ReqContext) Response {
+		sc.context = c
+		return withIdempotencyKey(c, handler)
+	}))
+
+	sc.resp = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, requestURL, nil)
+	if key != "" {
+		req.Header.Set(idempotencyKeyHeader, key)
+	}
+	sc.req = req
+	sc.exec()
+
+	return sc
+}
+
+func TestWithIdempotencyKey(t *testing.T) {
+	ldapIdempotencyKeys = localcache.New(ldapIdempotencyTTL, 2*ldapIdempotencyTTL)
+
+	runs := 0
+	handler := func() Response {
+		runs++
+		return JSON(http.StatusOK, map[string]int{"run": runs})
+	}
+
+	t.Run("a duplicate key replays the prior response", func(t *testing.T) {
+		sc := idempotencyContext(t, "/api/admin/ldap/sync/34", "key-1", handler)
+		assert.Equal(t, http.StatusOK, sc.resp.Code)
+		assert.JSONEq(t, `{"run": 1}`, sc.resp.Body.String())
+
+		sc = idempotencyContext(t, "/api/admin/ldap/sync/34", "key-1", handler)
+		assert.Equal(t, http.StatusOK, sc.resp.Code)
+		assert.JSONEq(t, `{"run": 1}`, sc.resp.Body.String())
+		assert.Equal(t, 1, runs)
+	})
+
+	t.Run("a new key runs the handler", func(t *testing.T) {
+		sc := idempotencyContext(t, "/api/admin/ldap/sync/34", "key-2", handler)
+		assert.JSONEq(t, `{"run": 2}`, sc.resp.Body.String())
+		assert.Equal(t, 2, runs)
+	})
+
+	t.Run("the same key for another user runs the handler", func(t *testing.T) {
+		sc := idempotencyContext(t, "/api/admin/ldap/sync/35", "key-1", handler)
+		assert.JSONEq(t, `{"run": 3}`, sc.resp.Body.String())
+		assert.Equal(t, 3, runs)
+	})
+
+	t.Run("requests without a key always run the handler", func(t *testing.T) {
+		idempotencyContext(t, "/api/admin/ldap/sync/34", "", handler)
+		idempotencyContext(t, "/api/admin/ldap/sync/34", "", handler)
+		assert.Equal(t, 5, runs)
+	})
+}
+
+func TestWithIdempotencyKey_ServerError(t *testing.T) {
+	ldapIdempotencyKeys = localcache.New(ldapIdempotencyTTL, 2*ldapIdempotencyTTL)
+
+	runs := 0
+	handler := func() Response {
+		runs++
+		if runs == 1 {
+			return Error(http.StatusServiceUnavailable, "None of the LDAP servers are reachable", nil)
+		}
+		return JSON(http.StatusOK, map[string]int{"run": runs})
+	}
+
+	sc := idempotencyContext(t, "/api/admin/ldap/sync/34", "key-1", handler)
+	assert.Equal(t, http.StatusServiceUnavailable, sc.resp.Code)
+
+	sc = idempotencyContext(t, "/api/admin/ldap/sync/34", "key-1", handler)
+	assert.Equal(t, http.StatusOK, sc.resp.Code)
+	assert.Equal(t, 2, runs)
+}
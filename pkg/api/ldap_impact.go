@@ -0,0 +1,52 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/ldapsync"
+)
+
+// LDAPConfigImpactCommand holds the proposed LDAP config, in the TOML format of the config file
+type LDAPConfigImpactCommand struct {
+	Config string `json:"config" binding:"Required"`
+}
+
+// PostLDAPConfigImpact maps the existing LDAP users with both the current and the proposed config,
+// and reports which of them would gain or lose organizations, change roles or become disabled.
+// It is read-only, neither the users nor the loaded config are changed.
+func (server *HTTPServer) PostLDAPConfigImpact(c *models.ReqContext, cmd LDAPConfigImpactCommand) Response {
+	if !ldap.IsEnabled() {
+		return ldapDisabledError()
+	}
+
+	ldapConfig, err := getLDAPConfig()
+
+	if err != nil {
+		return ldapConfigError("Failed to obtain the LDAP configuration. Please verify the configuration and try again.", err)
+	}
+
+	proposedConfig, err := ldap.ParseConfig(cmd.Config)
+
+	if err != nil {
+		return Error(http.StatusBadRequest, "Failed to parse the proposed LDAP configuration", err)
+	}
+
+	// the proposed servers are only used by this request, their connections aren't pooled
+	for i, server := range proposedConfig.Servers {
+		proposedConfig.Servers[i] = server.Copy()
+	}
+
+	current, proposed := newLDAP(ldapConfig.Servers), newLDAP(proposedConfig.Servers)
+	defer current.Close()
+	defer proposed.Close()
+
+	report, err := ldapsync.ConfigImpact(current, proposed)
+
+	if err != nil {
+		return Error(http.StatusInternalServerError, "Failed to evaluate the impact of the proposed LDAP configuration", err)
+	}
+
+	return JSON(http.StatusOK, report)
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//***
+// PostLDAPConfigImpact tests
+//***
+
+const proposedLDAPConfig = `
+[[servers]]
+host = "proposed.example.org"
+search_filter = "(cn=%s)"
+search_base_dns = ["dc=grafana,dc=org"]
+
+[[servers.group_mappings]]
+group_dn = "cn=editors,dc=grafana,dc=org"
+org_role = "Viewer"
+`
+
+func postLDAPConfigImpactContext(t *testing.T, cmd LDAPConfigImpactCommand) *scenarioContext {
+	t.Helper()
+
+	requestURL := "/api/admin/ldap/config/impact"
+	sc := setupScenarioContext(requestURL)
+
+	ldap := setting.LDAPEnabled
+	setting.LDAPEnabled = true
+	defer func() { setting.LDAPEnabled = ldap }()
+
+	hs := &HTTPServer{Cfg: setting.NewCfg()}
+
+	sc.defaultHandler = Wrap(func(c *models.ReqContext) Response {
+		sc.context = c
+		return hs.PostLDAPConfigImpact(c, cmd)
+	})
+
+	sc.m.Post(requestURL, sc.defaultHandler)
+
+	sc.resp = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, requestURL, nil)
+	sc.req = req
+	sc.exec()
+
+	return sc
+}
+
+func TestPostLDAPConfigImpactAPIEndpoint(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{
+			Servers: []*ldap.ServerConfig{{Host: "current.example.org"}},
+		}, nil
+	}
+
+	roles := map[string]models.RoleType{
+		"current.example.org":  models.ROLE_EDITOR,
+		"proposed.example.org": models.ROLE_VIEWER,
+	}
+
+	newLDAP = func(servers []*ldap.ServerConfig) multildap.IMultiLDAP {
+		host := servers[0].Host
+
+		return &multildap.MockMultiLDAP{
+			UserProvider: func(login string) (*models.ExternalUserInfo, ldap.ServerConfig, error) {
+				if login != "jdoe" {
+					return nil, ldap.ServerConfig{}, multildap.ErrDidNotFindUser
+				}
+
+				return &models.ExternalUserInfo{
+					Login:    login,
+					OrgRoles: map[int64]models.RoleType{1: roles[host]},
+				}, *servers[0], nil
+			},
+		}
+	}
+
+	bus.AddHandler("test", func(query *models.SearchUsersQuery) error {
+		query.Result = models.SearchUserQueryResult{Users: []*models.UserSearchHitDTO{
+			{Id: 2, Login: "jdoe"},
+			{Id: 3, Login: "gone"},
+		}}
+		return nil
+	})
+
+	sc := postLDAPConfigImpactContext(t, LDAPConfigImpactCommand{Config: proposedLDAPConfig})
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+
+	expected := `
+	{
+		"evaluated": 2,
+		"affected": 1,
+		"gainingOrgs": 0,
+		"losingOrgs": 0,
+		"changingRoles": 1,
+		"becomingDisabled": 0,
+		"becomingEnabled": 0,
+		"failed": 0,
+		"users": [
+			{
+				"userId": 2,
+				"login": "jdoe",
+				"changes": {
+					"orgRolesAdded": [],
+					"orgRolesChanged": [{"orgId": 1, "role": "Viewer", "previousRole": "Editor", "downgrade": true}],
+					"orgRolesRemoved": [],
+					"teamsAdded": [],
+					"teamsRemoved": [],
+					"action": "none",
+					"blockedDowngrades": []
+				}
+			}
+		]
+	}
+	`
+
+	assert.JSONEq(t, expected, sc.resp.Body.String())
+}
+
+func TestPostLDAPConfigImpactAPIEndpoint_InvalidConfig(t *testing.T) {
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	sc := postLDAPConfigImpactContext(t, LDAPConfigImpactCommand{Config: `[[servers]]
+host = "proposed.example.org"
+`})
+
+	assert.Equal(t, http.StatusBadRequest, sc.resp.Code)
+}
@@ -0,0 +1,209 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/ldapsync"
+)
+
+// ldapJobs are shared with the scheduled syncs, see ldapsync.SchedulerService
+var ldapJobs = ldapsync.SyncJobs
+
+// LDAPJobDTO is a serializer for a submitted LDAP job
+type LDAPJobDTO struct {
+	JobId string `json:"jobId"`
+}
+
+// PostSyncAllUsersWithLDAP starts the sync of every LDAP user in the background. The progress of the job is reported by GetLDAPJobStatus.
+// Only the users modified in LDAP since a time are synced with "?since=" and a RFC 3339 time, see ldapsync.SyncUsersModifiedSince,
+// or since the last sync without failure with "?incremental=true", see ldapsync.SyncUsersIncrementally.
+// The users missing from LDAP are disabled beyond the disable threshold with "?force=true", see ldapsync.DisableThreshold.
+// With "?login=", only the user with that login is synced, as by PostSyncUserWithLDAP.
+func (server *HTTPServer) PostSyncAllUsersWithLDAP(c *models.ReqContext) Response {
+	if c.Query("login") != "" {
+		return server.PostSyncUserWithLDAP(c)
+	}
+
+	return withIdempotencyKey(c, func() Response {
+		return server.syncAllUsersWithLDAP(c)
+	})
+}
+
+func (server *HTTPServer) syncAllUsersWithLDAP(c *models.ReqContext) Response {
+	if !ldap.IsEnabled() {
+		return ldapDisabledError()
+	}
+
+	since, err := parseSyncSince(c)
+	if err != nil {
+		return Error(http.StatusBadRequest, "Validation error. The since time must be formatted as RFC 3339", err)
+	}
+
+	ldapConfig, err := getLDAPConfig()
+
+	if err != nil {
+		return ldapConfigError("Failed to obtain the LDAP configuration. Please verify the configuration and try again.", err)
+	}
+
+	ldapServer := newLDAP(ldapConfig.Servers)
+	force := c.QueryBool("force")
+	incremental := since.IsZero() && c.QueryBool("incremental")
+
+	job, err := ldapJobs.Submit(func(progress ldapsync.ProgressFunc) (*ldapsync.Summary, error) {
+		// the job outlives the request, it closes the connections itself
+		defer ldapServer.Close()
+
+		var summary *ldapsync.Summary
+		var err error
+
+		switch {
+		case incremental:
+			summary, err = ldapsync.SyncUsersIncrementally(ldapConfig, ldapServer, progress, force)
+		case since.IsZero():
+			summary, err = ldapsync.SyncAllUsers(ldapConfig, ldapServer, progress, force)
+		default:
+			summary, err = ldapsync.SyncUsersModifiedSince(ldapConfig, ldapServer, since, progress, force)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		ldapsync.RevokeDisabledUsersTokens(server.AuthTokenService, summary)
+
+		return summary, nil
+	})
+
+	if err != nil {
+		ldapServer.Close()
+	}
+
+	if err == ldapsync.ErrJobRunning {
+		return Error(http.StatusConflict, "Another LDAP job is already running", err)
+	}
+
+	if err != nil {
+		return Error(http.StatusInternalServerError, "Failed to start the LDAP sync", err)
+	}
+
+	return JSON(http.StatusAccepted, &LDAPJobDTO{JobId: job.Id})
+}
+
+// parseSyncSince returns the time the users to sync must have been modified since, the zero time without "?since="
+func parseSyncSince(c *models.ReqContext) (time.Time, error) {
+	if value := c.Query("since"); value != "" {
+		return time.Parse(time.RFC3339, value)
+	}
+
+	return time.Time{}, nil
+}
+
+// GetLDAPJobStatus reports the status, the progress and the final summary of an LDAP job
+func (server *HTTPServer) GetLDAPJobStatus(c *models.ReqContext) Response {
+	job, err := ldapJobs.Get(c.Params(":id"))
+
+	if err == ldapsync.ErrJobNotFound {
+		return Error(http.StatusNotFound, "LDAP job not found", nil)
+	}
+
+	if err != nil {
+		return Error(http.StatusInternalServerError, "Failed to get the LDAP job", err)
+	}
+
+	return JSON(http.StatusOK, job)
+}
+
+// ldapJobHeartbeat is how often a comment is sent to the clients of the job events while no user is synced,
+// so the proxies don't close the idle stream
+const ldapJobHeartbeat = 15 * time.Second
+
+// GetLDAPJobEvents streams the progress of an LDAP job as server-sent events: a "progress" event after the sync of each user,
+// with the result of its sync, then a "done" event with the final state of the job, after which the stream ends.
+// Every progress event has an id, the stream resumes after the one of the "Last-Event-ID" header when reconnecting.
+// The events of a finished job are streamed until the job is forgotten.
+func (server *HTTPServer) GetLDAPJobEvents(c *models.ReqContext) Response {
+	id := c.Params(":id")
+
+	from := 0
+	if lastEventId := c.Req.Header.Get("Last-Event-ID"); lastEventId != "" {
+		var err error
+		if from, err = strconv.Atoi(lastEventId); err != nil || from < 0 {
+			return Error(http.StatusBadRequest, "Validation error. The Last-Event-ID must be the id of a progress event", err)
+		}
+	}
+
+	if _, err := ldapJobs.Get(id); err == ldapsync.ErrJobNotFound {
+		return Error(http.StatusNotFound, "LDAP job not found", nil)
+	}
+
+	return Stream(http.StatusOK, "text/event-stream", func(w io.Writer) error {
+		return streamLDAPJobEvents(c, w, id, from)
+	}).Header("Cache-Control", "no-cache").Header("X-Accel-Buffering", "no")
+}
+
+// streamLDAPJobEvents writes the events of the job from the given one on, until the job is done or the client leaves
+func streamLDAPJobEvents(c *models.ReqContext, w io.Writer, id string, from int) error {
+	heartbeat := time.NewTicker(ldapJobHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		events, job, changed, err := ldapJobs.Events(id, from)
+		if err != nil {
+			return err
+		}
+
+		for _, event := range events {
+			from++
+			if err := writeServerSentEvent(w, strconv.Itoa(from), "progress", event); err != nil {
+				return err
+			}
+		}
+
+		if job.Status != ldapsync.JobRunning {
+			return writeServerSentEvent(w, "", "done", job)
+		}
+
+		flushEvents(w)
+
+		select {
+		case <-changed:
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return err
+			}
+		case <-c.Req.Context().Done():
+			return nil
+		}
+	}
+}
+
+// writeServerSentEvent writes the event with its JSON data, the id is omitted when empty
+func writeServerSentEvent(w io.Writer, id string, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
+
+// flush sends the events written so far to the client
+func flushEvents(w io.Writer) {
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
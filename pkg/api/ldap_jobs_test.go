@@ -0,0 +1,380 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/infra/localcache"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/auth"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/ldapsync"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//***
+// PostSyncAllUsersWithLDAP, GetLDAPJobStatus and GetLDAPJobEvents tests
+//***
+
+func ldapJobsContext(t *testing.T, method string, requestURL string) *scenarioContext {
+	t.Helper()
+
+	req, _ := http.NewRequest(method, requestURL, nil)
+
+	return ldapJobsRequest(t, req)
+}
+
+func ldapJobsRequest(t *testing.T, req *http.Request) *scenarioContext {
+	t.Helper()
+
+	sc := setupScenarioContext(req.URL.Path)
+
+	ldap := setting.LDAPEnabled
+	setting.LDAPEnabled = true
+	defer func() { setting.LDAPEnabled = ldap }()
+
+	hs := &HTTPServer{
+		Cfg:              setting.NewCfg(),
+		AuthTokenService: auth.NewFakeUserAuthTokenService(),
+	}
+
+	sc.m.Post("/api/admin/ldap/sync", Wrap(func(c *models.ReqContext) Response {
+		sc.context = c
+		return hs.PostSyncAllUsersWithLDAP(c)
+	}))
+
+	sc.m.Get("/api/admin/ldap/jobs/:id", Wrap(func(c *models.ReqContext) Response {
+		sc.context = c
+		return hs.GetLDAPJobStatus(c)
+	}))
+
+	sc.m.Get("/api/admin/ldap/jobs/:id/events", Wrap(func(c *models.ReqContext) Response {
+		sc.context = c
+		return hs.GetLDAPJobEvents(c)
+	}))
+
+	sc.resp = httptest.NewRecorder()
+	sc.req = req
+	sc.exec()
+
+	return sc
+}
+
+// waitLDAPJob polls the status of the job until it is done. The tests wait for their jobs before clearing
+// the bus handlers, which the jobs still use while they run.
+func waitLDAPJob(t *testing.T, jobId string) ldapsync.Job {
+	t.Helper()
+
+	var job ldapsync.Job
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		sc := ldapJobsContext(t, http.MethodGet, "/api/admin/ldap/jobs/"+jobId)
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+		require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &job))
+
+		if job.Status != ldapsync.JobRunning {
+			break
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	require.NotEqual(t, ldapsync.JobRunning, job.Status, "the LDAP job is still running")
+
+	return job
+}
+
+func TestPostSyncAllUsersWithLDAPAPIEndpoint(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	ldapJobs = ldapsync.NewJobs(time.Hour)
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	userSearchResult = &models.ExternalUserInfo{Login: "johndoe"}
+
+	bus.AddHandler("test", func(q *models.SearchUsersQuery) error {
+		q.Result = models.SearchUserQueryResult{
+			Users: []*models.UserSearchHitDTO{{Id: 34, Login: "johndoe"}},
+		}
+		return nil
+	})
+
+	bus.AddHandler("test", func(q *models.GetUserByIdQuery) error {
+		q.Result = &models.User{Id: q.Id, Login: "johndoe"}
+		return nil
+	})
+
+	bus.AddHandler("test", func(q *models.GetUserOrgListQuery) error {
+		q.Result = []*models.UserOrgDTO{}
+		return nil
+	})
+
+	bus.AddHandler("test", func(q *models.GetTeamMembersQuery) error {
+		q.Result = []*models.TeamMemberDTO{}
+		return nil
+	})
+
+	bus.AddHandler("test", func(cmd *models.UpsertUserCommand) error {
+		return nil
+	})
+
+	sc := ldapJobsContext(t, http.MethodPost, "/api/admin/ldap/sync")
+	require.Equal(t, http.StatusAccepted, sc.resp.Code)
+
+	var submitted LDAPJobDTO
+	require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &submitted))
+	require.NotEmpty(t, submitted.JobId)
+
+	job := waitLDAPJob(t, submitted.JobId)
+
+	assert.Equal(t, ldapsync.JobCompleted, job.Status)
+	assert.Equal(t, ldapsync.JobProgress{Done: 1, Total: 1}, job.Progress)
+	require.NotNil(t, job.Summary)
+	assert.Equal(t, 1, job.Summary.Synced)
+}
+
+func TestPostSyncAllUsersWithLDAPAPIEndpoint_JobRunning(t *testing.T) {
+	ldapJobs = ldapsync.NewJobs(time.Hour)
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	proceed := make(chan bool)
+	defer close(proceed)
+
+	_, err := ldapJobs.Submit(func(progress ldapsync.ProgressFunc) (*ldapsync.Summary, error) {
+		<-proceed
+		return &ldapsync.Summary{}, nil
+	})
+	require.Nil(t, err)
+
+	sc := ldapJobsContext(t, http.MethodPost, "/api/admin/ldap/sync")
+
+	assert.Equal(t, http.StatusConflict, sc.resp.Code)
+}
+
+func TestGetLDAPJobStatusAPIEndpoint_NotFound(t *testing.T) {
+	ldapJobs = ldapsync.NewJobs(time.Hour)
+
+	sc := ldapJobsContext(t, http.MethodGet, "/api/admin/ldap/jobs/unknown")
+
+	assert.Equal(t, http.StatusNotFound, sc.resp.Code)
+}
+
+func TestPostSyncAllUsersWithLDAPAPIEndpoint_IdempotencyKey(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	ldapJobs = ldapsync.NewJobs(time.Hour)
+	ldapIdempotencyKeys = localcache.New(ldapIdempotencyTTL, 2*ldapIdempotencyTTL)
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	var first LDAPJobDTO
+
+	proceed := make(chan bool)
+	defer func() {
+		close(proceed)
+		waitLDAPJob(t, first.JobId)
+	}()
+
+	bus.AddHandler("test", func(q *models.SearchUsersQuery) error {
+		<-proceed
+		return nil
+	})
+
+	sync := func(key string) *scenarioContext {
+		req, _ := http.NewRequest(http.MethodPost, "/api/admin/ldap/sync", nil)
+		req.Header.Set(idempotencyKeyHeader, key)
+		return ldapJobsRequest(t, req)
+	}
+
+	sc := sync("deploy-1")
+	require.Equal(t, http.StatusAccepted, sc.resp.Code)
+
+	require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &first))
+
+	// the retry gets the job started by the first request instead of a conflict
+	sc = sync("deploy-1")
+	require.Equal(t, http.StatusAccepted, sc.resp.Code)
+
+	var retry LDAPJobDTO
+	require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &retry))
+	assert.Equal(t, first.JobId, retry.JobId)
+
+	// a new key runs fresh and conflicts with the running job
+	sc = sync("deploy-2")
+	assert.Equal(t, http.StatusConflict, sc.resp.Code)
+}
+
+func TestPostSyncAllUsersWithLDAPAPIEndpoint_Since(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	userSearchResult = &models.ExternalUserInfo{Login: "johndoe"}
+	modifiedUsersResult = []*models.ExternalUserInfo{{Login: "johndoe"}}
+	modifiedUsersError = nil
+
+	bus.AddHandler("test", func(q *models.SearchUsersQuery) error {
+		q.Result = models.SearchUserQueryResult{
+			Users: []*models.UserSearchHitDTO{{Id: 34, Login: "johndoe"}, {Id: 35, Login: "janedoe"}},
+		}
+		return nil
+	})
+
+	bus.AddHandler("test", func(q *models.GetUserByIdQuery) error {
+		q.Result = &models.User{Id: q.Id}
+		return nil
+	})
+
+	bus.AddHandler("test", func(q *models.GetUserOrgListQuery) error {
+		q.Result = []*models.UserOrgDTO{}
+		return nil
+	})
+
+	bus.AddHandler("test", func(q *models.GetTeamMembersQuery) error {
+		q.Result = []*models.TeamMemberDTO{}
+		return nil
+	})
+
+	bus.AddHandler("test", func(cmd *models.UpsertUserCommand) error {
+		return nil
+	})
+
+	submit := func(t *testing.T, requestURL string) ldapsync.Job {
+		t.Helper()
+
+		sc := ldapJobsContext(t, http.MethodPost, requestURL)
+		require.Equal(t, http.StatusAccepted, sc.resp.Code)
+
+		var submitted LDAPJobDTO
+		require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &submitted))
+
+		return waitLDAPJob(t, submitted.JobId)
+	}
+
+	t.Run("only syncs the users modified since the time", func(t *testing.T) {
+		ldapJobs = ldapsync.NewJobs(time.Hour)
+
+		job := submit(t, "/api/admin/ldap/sync?since=2019-10-15T12:00:00Z")
+
+		assert.Equal(t, ldapsync.JobCompleted, job.Status)
+		require.NotNil(t, job.Summary)
+		assert.Equal(t, 1, job.Summary.Synced)
+		assert.True(t, time.Date(2019, 10, 15, 12, 0, 0, 0, time.UTC).Equal(modifiedUsersSince))
+	})
+
+	t.Run("syncs the users modified since the last sync with incremental", func(t *testing.T) {
+		ldapJobs = ldapsync.NewJobs(time.Hour)
+
+		// the previous syncs set the watermark
+		watermark := ldapsync.LastSyncWatermark()
+		require.False(t, watermark.IsZero())
+
+		job := submit(t, "/api/admin/ldap/sync?incremental=true")
+
+		require.NotNil(t, job.Summary)
+		assert.Equal(t, 1, job.Summary.Synced)
+		assert.True(t, watermark.Equal(modifiedUsersSince))
+	})
+
+	t.Run("rejects an invalid time", func(t *testing.T) {
+		ldapJobs = ldapsync.NewJobs(time.Hour)
+
+		sc := ldapJobsContext(t, http.MethodPost, "/api/admin/ldap/sync?since=yesterday")
+
+		assert.Equal(t, http.StatusBadRequest, sc.resp.Code)
+	})
+}
+
+func TestGetLDAPJobEventsAPIEndpoint(t *testing.T) {
+	ldapJobs = ldapsync.NewJobs(time.Hour)
+
+	proceed := make(chan bool)
+	job, err := ldapJobs.Submit(func(progress ldapsync.ProgressFunc) (*ldapsync.Summary, error) {
+		progress(1, 2, &ldapsync.UserResult{UserId: 34, Login: "johndoe"})
+		<-proceed
+		progress(2, 2, &ldapsync.UserResult{UserId: 35, Login: "janedoe", Error: "Invalid Username or Password"})
+
+		return &ldapsync.Summary{Synced: 1, Failed: 1}, nil
+	})
+	require.Nil(t, err)
+
+	// the stream waits for the running job, until it's done
+	go func() { proceed <- true }()
+
+	t.Run("streams the progress of every user, then the job", func(t *testing.T) {
+		sc := ldapJobsContext(t, http.MethodGet, "/api/admin/ldap/jobs/"+job.Id+"/events")
+
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+		assert.Equal(t, "text/event-stream", sc.resp.Header().Get("Content-Type"))
+
+		body := sc.resp.Body.String()
+		assert.Contains(t, body, "id: 1\nevent: progress\ndata: {\"done\":1,\"total\":2,\"user\":{\"userId\":34,\"login\":\"johndoe\"}}\n\n")
+		assert.Contains(t, body, "id: 2\nevent: progress\ndata: {\"done\":2,\"total\":2,\"user\":{\"userId\":35,\"login\":\"janedoe\",\"error\":\"Invalid Username or Password\"}}\n\n")
+		assert.Contains(t, body, "event: done\ndata: {\"id\":\""+job.Id+"\",\"status\":\"completed\"")
+	})
+
+	t.Run("resumes after the last event id", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/api/admin/ldap/jobs/"+job.Id+"/events", nil)
+		req.Header.Set("Last-Event-ID", "1")
+
+		sc := ldapJobsRequest(t, req)
+
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+
+		body := sc.resp.Body.String()
+		assert.NotContains(t, body, "id: 1\n")
+		assert.Contains(t, body, "id: 2\n")
+		assert.Contains(t, body, "event: done\n")
+	})
+
+	t.Run("rejects an invalid last event id", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/api/admin/ldap/jobs/"+job.Id+"/events", nil)
+		req.Header.Set("Last-Event-ID", "johndoe")
+
+		sc := ldapJobsRequest(t, req)
+
+		assert.Equal(t, http.StatusBadRequest, sc.resp.Code)
+	})
+
+	t.Run("fails for an unknown job", func(t *testing.T) {
+		sc := ldapJobsContext(t, http.MethodGet, "/api/admin/ldap/jobs/unknown/events")
+
+		assert.Equal(t, http.StatusNotFound, sc.resp.Code)
+	})
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+)
+
+const (
+	// traceStepOrgMapping is the lookup of the organizations the user gets a role in
+	traceStepOrgMapping = "org mapping"
+
+	// traceStepTeamMapping is the lookup of the teams the user is synced to
+	traceStepTeamMapping = "team mapping"
+)
+
+// LDAPTestLoginCommand holds the credentials of the user to test the LDAP login with
+type LDAPTestLoginCommand struct {
+	Username string `json:"username" binding:"Required"`
+	Password string `json:"password" binding:"Required"`
+}
+
+// LDAPTestLoginDTO is a serializer for the result of a test LDAP login
+type LDAPTestLoginDTO struct {
+	Success bool             `json:"success"`
+	Error   string           `json:"error,omitempty"`
+	User    *LDAPUserDTO     `json:"user,omitempty"`
+	Trace   []ldap.TraceStep `json:"trace"`
+}
+
+// PostTestLoginWithLDAP runs the whole LDAP login of the user, from the search to the mapping of its organizations and teams,
+// without creating a session. It returns the mapped user and the trace of each step, to find out why a user can't log in.
+// Only the servers of an org are tried with "?orgId=".
+func (server *HTTPServer) PostTestLoginWithLDAP(c *models.ReqContext, cmd LDAPTestLoginCommand) Response {
+	if !ldap.IsEnabled() {
+		return ldapDisabledError()
+	}
+
+	ldapConfig, err := getLDAPConfig()
+
+	if err != nil {
+		return ldapConfigError("Failed to obtain the LDAP configuration. Please verify the configuration and try again.", err)
+	}
+
+	servers, resp := scopeLDAPServers(c, ldapConfig)
+	if resp != nil {
+		return resp
+	}
+
+	ldapServer := newLDAP(servers)
+	defer ldapServer.Close()
+
+	user, serverConfig, trace, err := ldapServer.LoginWithTrace(&models.LoginUserQuery{
+		Username:  cmd.Username,
+		Password:  cmd.Password,
+		IpAddress: c.Req.RemoteAddr,
+	})
+
+	if trace == nil {
+		trace = ldap.NewTrace()
+	}
+
+	result := &LDAPTestLoginDTO{}
+
+	if err == nil {
+		result.User = newLDAPUserDTO(user, serverConfig)
+		err = mapTestLoginUser(result.User, user, serverConfig, trace)
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	result.Success = err == nil
+	result.Trace = trace.Steps
+
+	return JSON(http.StatusOK, result)
+}
+
+// mapTestLoginUser fetches the organizations and the teams of the user, recording both steps in the trace
+func mapTestLoginUser(u *LDAPUserDTO, user *models.ExternalUserInfo, serverConfig ldap.ServerConfig, trace *ldap.Trace) error {
+	err := u.FetchOrgs()
+	trace.Add(serverConfig.Host, traceStepOrgMapping, fmt.Sprintf("Fetch the %d organization(s) of the group mappings", len(u.OrgRoles)), err)
+	if err != nil {
+		return err
+	}
+
+	err = u.FetchTeams(user, serverConfig)
+	trace.Add(serverConfig.Host, traceStepTeamMapping, fmt.Sprintf("Fetch the teams of the %d group(s) of the user", len(user.Groups)), err)
+
+	return err
+}
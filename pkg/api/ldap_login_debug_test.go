@@ -0,0 +1,213 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//***
+// PostTestLoginWithLDAP tests
+//***
+
+func testLoginWithLDAPContext(t *testing.T, cmd LDAPTestLoginCommand) (*scenarioContext, *LDAPTestLoginDTO) {
+	t.Helper()
+
+	requestURL := "/api/admin/ldap/test-login"
+	sc := setupScenarioContext(requestURL)
+
+	ldap := setting.LDAPEnabled
+	setting.LDAPEnabled = true
+	defer func() { setting.LDAPEnabled = ldap }()
+
+	hs := &HTTPServer{Cfg: setting.NewCfg()}
+
+	sc.defaultHandler = Wrap(func(c *models.ReqContext) Response {
+		sc.context = c
+		return hs.PostTestLoginWithLDAP(c, cmd)
+	})
+
+	sc.m.Post(requestURL, sc.defaultHandler)
+
+	sc.resp = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, requestURL, nil)
+	sc.req = req
+	sc.exec()
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+
+	var result LDAPTestLoginDTO
+	require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &result))
+
+	return sc, &result
+}
+
+func setupTestLoginWithLDAP(t *testing.T) {
+	t.Helper()
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	loginResult = &models.ExternalUserInfo{
+		Name:     "John Doe",
+		Login:    "johndoe",
+		Groups:   []string{"cn=admins,ou=groups,dc=grafana,dc=org"},
+		OrgRoles: map[int64]models.RoleType{1: models.ROLE_ADMIN},
+	}
+
+	loginConfig = ldap.ServerConfig{
+		Host: "ldap.example.org",
+		Attr: ldap.AttributeMap{
+			Username: "uid",
+		},
+		Groups: []*ldap.GroupToOrgRole{
+			{GroupDN: "cn=admins,ou=groups,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_ADMIN},
+		},
+	}
+
+	loginTrace = ldap.NewTrace()
+	loginTrace.Add("ldap.example.org", ldap.TraceStepConnect, "Connect to ldap.example.org:389", nil)
+	loginTrace.Add("ldap.example.org", ldap.TraceStepBind, "Bind anonymously", nil)
+
+	loginError = nil
+}
+
+func traceSteps(trace []ldap.TraceStep) []string {
+	steps := []string{}
+	for _, step := range trace {
+		steps = append(steps, step.Step)
+	}
+	return steps
+}
+
+func TestPostTestLoginWithLDAPAPIEndpoint_Success(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	setupTestLoginWithLDAP(t)
+
+	bus.AddHandler("test", func(q *models.SearchOrgsQuery) error {
+		q.Result = []*models.OrgDTO{{Id: 1, Name: "Main Org."}}
+		return nil
+	})
+
+	bus.AddHandler("test", func(cmd *models.GetTeamsForLDAPGroupCommand) error {
+		cmd.Result = []models.TeamOrgGroupDTO{
+			{TeamName: "Admins", OrgId: 1, OrgName: "Main Org.", GroupDN: "cn=admins,ou=groups,dc=grafana,dc=org"},
+		}
+		return nil
+	})
+
+	_, result := testLoginWithLDAPContext(t, LDAPTestLoginCommand{Username: "johndoe", Password: "secret"})
+
+	assert.True(t, result.Success)
+	assert.Empty(t, result.Error)
+
+	require.NotNil(t, result.User)
+	assert.Equal(t, "johndoe", result.User.Username.LDAPAttributeValue)
+	require.Len(t, result.User.OrgRoles, 1)
+	assert.Equal(t, "Main Org.", result.User.OrgRoles[0].OrgName)
+	assert.Equal(t, models.ROLE_ADMIN, result.User.OrgRoles[0].OrgRole)
+	require.Len(t, result.User.Teams, 1)
+	assert.Equal(t, "Admins", result.User.Teams[0].TeamName)
+
+	assert.Equal(t, []string{
+		ldap.TraceStepConnect, ldap.TraceStepBind, traceStepOrgMapping, traceStepTeamMapping,
+	}, traceSteps(result.Trace))
+
+	for _, step := range result.Trace {
+		assert.True(t, step.Success, step.Step)
+	}
+}
+
+func TestPostTestLoginWithLDAPAPIEndpoint_LoginFailure(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	setupTestLoginWithLDAP(t)
+
+	loginResult = nil
+	loginError = multildap.ErrInvalidCredentials
+	loginTrace.Add("ldap.example.org", ldap.TraceStepSearch, `Search for the user "johndoe" found cn=johndoe`, nil)
+	loginTrace.Add("ldap.example.org", ldap.TraceStepUserBind, "Bind as the user cn=johndoe", ldap.ErrInvalidCredentials)
+
+	_, result := testLoginWithLDAPContext(t, LDAPTestLoginCommand{Username: "johndoe", Password: "wrong"})
+
+	assert.False(t, result.Success)
+	assert.Equal(t, multildap.ErrInvalidCredentials.Error(), result.Error)
+	assert.Nil(t, result.User)
+
+	require.Len(t, result.Trace, 4)
+	failed := result.Trace[3]
+	assert.Equal(t, ldap.TraceStepUserBind, failed.Step)
+	assert.False(t, failed.Success)
+	assert.Equal(t, ldap.ErrInvalidCredentials.Error(), failed.Error)
+}
+
+func TestPostTestLoginWithLDAPAPIEndpoint_OrgMappingFailure(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	setupTestLoginWithLDAP(t)
+
+	bus.AddHandler("test", func(q *models.SearchOrgsQuery) error {
+		q.Result = []*models.OrgDTO{}
+		return nil
+	})
+
+	_, result := testLoginWithLDAPContext(t, LDAPTestLoginCommand{Username: "johndoe", Password: "secret"})
+
+	assert.False(t, result.Success)
+	assert.Equal(t, "Unable to find organization with ID '1'", result.Error)
+
+	assert.Equal(t, []string{
+		ldap.TraceStepConnect, ldap.TraceStepBind, traceStepOrgMapping,
+	}, traceSteps(result.Trace))
+
+	failed := result.Trace[2]
+	assert.False(t, failed.Success)
+	assert.Equal(t, "ldap.example.org", failed.Server)
+	assert.Equal(t, "Unable to find organization with ID '1'", failed.Error)
+}
+
+func TestPostTestLoginWithLDAPAPIEndpoint_TeamMappingFailure(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	setupTestLoginWithLDAP(t)
+
+	bus.AddHandler("test", func(q *models.SearchOrgsQuery) error {
+		q.Result = []*models.OrgDTO{{Id: 1, Name: "Main Org."}}
+		return nil
+	})
+
+	bus.AddHandler("test", func(cmd *models.GetTeamsForLDAPGroupCommand) error {
+		return errors.New("Team sync is not available")
+	})
+
+	_, result := testLoginWithLDAPContext(t, LDAPTestLoginCommand{Username: "johndoe", Password: "secret"})
+
+	assert.False(t, result.Success)
+	assert.Equal(t, "Team sync is not available", result.Error)
+
+	assert.Equal(t, []string{
+		ldap.TraceStepConnect, ldap.TraceStepBind, traceStepOrgMapping, traceStepTeamMapping,
+	}, traceSteps(result.Trace))
+	assert.True(t, result.Trace[2].Success)
+	assert.False(t, result.Trace[3].Success)
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// ldapNotificationSecretHeader is the header holding the secret shared with the directory
+const ldapNotificationSecretHeader = "X-Grafana-LDAP-Secret"
+
+// LDAPChangeNotificationCommand is the change notification posted by the directory,
+// identifying the changed user either by login or by DN
+type LDAPChangeNotificationCommand struct {
+	Login string `json:"login"`
+	DN    string `json:"dn"`
+}
+
+// PostLDAPChangeNotification syncs the user changed in the directory, as notified by the directory itself.
+// The notifications aren't authenticated as a Grafana user, they carry the change_notification_secret
+// of the [auth.ldap] section in the X-Grafana-LDAP-Secret header instead.
+func (server *HTTPServer) PostLDAPChangeNotification(c *models.ReqContext) Response {
+	if !ldap.IsEnabled() {
+		return ldapDisabledError()
+	}
+
+	if setting.LDAPChangeNotificationSecret == "" {
+		return Error(http.StatusNotFound, "LDAP change notifications are not enabled", nil)
+	}
+
+	secret := c.Req.Header.Get(ldapNotificationSecretHeader)
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(setting.LDAPChangeNotificationSecret)) != 1 {
+		return Error(http.StatusUnauthorized, "Invalid LDAP change notification secret", nil)
+	}
+
+	var cmd LDAPChangeNotificationCommand
+	if err := json.NewDecoder(c.Req.Request.Body).Decode(&cmd); err != nil {
+		return Error(http.StatusBadRequest, "Validation error. The notification must be a JSON object", err)
+	}
+
+	cmd.Login = strings.TrimSpace(cmd.Login)
+	cmd.DN = strings.TrimSpace(cmd.DN)
+
+	if (cmd.Login == "") == (cmd.DN == "") {
+		return Error(http.StatusBadRequest, "Validation error. The notification must identify the user by either login or dn", nil)
+	}
+
+	ldapConfig, err := getLDAPConfig()
+
+	if err != nil {
+		return ldapConfigError("Failed to obtain the LDAP configuration. Please verify the configuration and try again.", err)
+	}
+
+	user, err := notifiedLDAPUser(&cmd)
+
+	if err == models.ErrUserNotFound {
+		// The user will be created on the first login, there's nothing to sync yet
+		return Error(http.StatusNotFound, models.ErrUserNotFound.Error(), nil)
+	}
+
+	if err != nil {
+		return Error(http.StatusInternalServerError, "Failed to get user", err)
+	}
+
+	return server.syncLDAPUser(c, ldapConfig, user)
+}
+
+// notifiedLDAPUser finds the Grafana user of a change notification, by its login only, see grafanaUserByLogin,
+// or by its DN, the DN is the auth id of the LDAP users
+func notifiedLDAPUser(cmd *LDAPChangeNotificationCommand) (*models.User, error) {
+	if cmd.Login != "" {
+		return grafanaUserByLogin(cmd.Login)
+	}
+
+	authQuery := &models.GetAuthInfoQuery{AuthModule: models.AuthModuleLDAP, AuthId: cmd.DN}
+	if err := bus.Dispatch(authQuery); err != nil {
+		return nil, err
+	}
+
+	query := &models.GetUserByIdQuery{Id: authQuery.Result.UserId}
+	if err := bus.Dispatch(query); err != nil {
+		return nil, err
+	}
+
+	return query.Result, nil
+}
@@ -0,0 +1,234 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/auth"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//***
+// PostLDAPChangeNotification tests
+//***
+
+func postLDAPChangeNotificationContext(t *testing.T, secret string, body string) *scenarioContext {
+	t.Helper()
+
+	requestURL := "/api/ldap/notifications"
+	sc := setupScenarioContext(requestURL)
+
+	ldap := setting.LDAPEnabled
+	setting.LDAPEnabled = true
+	defer func() { setting.LDAPEnabled = ldap }()
+
+	hs := &HTTPServer{
+		Cfg:              setting.NewCfg(),
+		AuthTokenService: auth.NewFakeUserAuthTokenService(),
+	}
+
+	sc.defaultHandler = Wrap(func(c *models.ReqContext) Response {
+		sc.context = c
+		return hs.PostLDAPChangeNotification(c)
+	})
+
+	sc.m.Post(requestURL, sc.defaultHandler)
+
+	sc.resp = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, requestURL, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set("X-Grafana-LDAP-Secret", secret)
+	}
+	sc.req = req
+	sc.exec()
+
+	return sc
+}
+
+// mockLDAPChangeNotification mocks the user "johndoe" with the DN "cn=johndoe,dc=grafana,dc=org",
+// and returns whether the user was upserted by the sync
+func mockLDAPChangeNotification(t *testing.T) *bool {
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	userSearchResult = &models.ExternalUserInfo{
+		AuthId:   "cn=johndoe,dc=grafana,dc=org",
+		Login:    "johndoe",
+		OrgRoles: map[int64]models.RoleType{1: models.ROLE_VIEWER},
+	}
+
+	johndoe := &models.User{Id: 34, Login: "johndoe", Email: "john.doe@grafana.org"}
+
+	// like the store, the users are found by their email too
+	bus.AddHandler("test", func(q *models.GetUserByLoginQuery) error {
+		if q.LoginOrEmail != johndoe.Login && q.LoginOrEmail != johndoe.Email {
+			return models.ErrUserNotFound
+		}
+		q.Result = johndoe
+		return nil
+	})
+
+	bus.AddHandler("test", func(q *models.GetUserByIdQuery) error {
+		if q.Id != johndoe.Id {
+			return models.ErrUserNotFound
+		}
+		q.Result = johndoe
+		return nil
+	})
+
+	bus.AddHandler("test", func(q *models.GetAuthInfoQuery) error {
+		if q.AuthId != "" && q.AuthId != userSearchResult.AuthId {
+			return models.ErrUserNotFound
+		}
+		q.Result = &models.UserAuth{UserId: johndoe.Id, AuthModule: models.AuthModuleLDAP, AuthId: userSearchResult.AuthId}
+		return nil
+	})
+
+	bus.AddHandler("test", func(q *models.GetUserOrgListQuery) error {
+		q.Result = []*models.UserOrgDTO{}
+		return nil
+	})
+
+	bus.AddHandler("test", func(q *models.GetTeamMembersQuery) error {
+		q.Result = []*models.TeamMemberDTO{}
+		return nil
+	})
+
+	upserted := false
+	bus.AddHandler("test", func(cmd *models.UpsertUserCommand) error {
+		assert.Equal(t, userSearchResult, cmd.ExternalUser)
+		upserted = true
+		return nil
+	})
+
+	return &upserted
+}
+
+func TestPostLDAPChangeNotificationAPIEndpoint(t *testing.T) {
+	secret := setting.LDAPChangeNotificationSecret
+	setting.LDAPChangeNotificationSecret = "s3cr3t"
+	defer func() { setting.LDAPChangeNotificationSecret = secret }()
+
+	t.Run("syncs the user notified by login", func(t *testing.T) {
+		bus.ClearBusHandlers()
+		defer bus.ClearBusHandlers()
+
+		upserted := mockLDAPChangeNotification(t)
+
+		sc := postLDAPChangeNotificationContext(t, "s3cr3t", `{"login": "johndoe"}`)
+
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+		assert.True(t, *upserted)
+		assert.Contains(t, sc.resp.Body.String(), "User synced successfully")
+	})
+
+	t.Run("doesn't sync another user whose email is the notified login", func(t *testing.T) {
+		bus.ClearBusHandlers()
+		defer bus.ClearBusHandlers()
+
+		upserted := mockLDAPChangeNotification(t)
+
+		sc := postLDAPChangeNotificationContext(t, "s3cr3t", `{"login": "john.doe@grafana.org"}`)
+
+		assert.Equal(t, http.StatusNotFound, sc.resp.Code)
+		assert.False(t, *upserted)
+	})
+
+	t.Run("syncs the user notified by DN", func(t *testing.T) {
+		bus.ClearBusHandlers()
+		defer bus.ClearBusHandlers()
+
+		upserted := mockLDAPChangeNotification(t)
+
+		sc := postLDAPChangeNotificationContext(t, "s3cr3t", `{"dn": "cn=johndoe,dc=grafana,dc=org"}`)
+
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+		assert.True(t, *upserted)
+	})
+
+	t.Run("rejects an invalid secret", func(t *testing.T) {
+		bus.ClearBusHandlers()
+		defer bus.ClearBusHandlers()
+
+		upserted := mockLDAPChangeNotification(t)
+
+		sc := postLDAPChangeNotificationContext(t, "wrong", `{"login": "johndoe"}`)
+
+		assert.Equal(t, http.StatusUnauthorized, sc.resp.Code)
+		assert.False(t, *upserted)
+	})
+
+	t.Run("rejects a missing secret", func(t *testing.T) {
+		bus.ClearBusHandlers()
+		defer bus.ClearBusHandlers()
+
+		upserted := mockLDAPChangeNotification(t)
+
+		sc := postLDAPChangeNotificationContext(t, "", `{"login": "johndoe"}`)
+
+		assert.Equal(t, http.StatusUnauthorized, sc.resp.Code)
+		assert.False(t, *upserted)
+	})
+
+	t.Run("rejects the invalid payloads", func(t *testing.T) {
+		bus.ClearBusHandlers()
+		defer bus.ClearBusHandlers()
+
+		upserted := mockLDAPChangeNotification(t)
+
+		for _, body := range []string{
+			`not json`,
+			`{}`,
+			`{"login": "  "}`,
+			`{"login": "johndoe", "dn": "cn=johndoe,dc=grafana,dc=org"}`,
+		} {
+			sc := postLDAPChangeNotificationContext(t, "s3cr3t", body)
+
+			assert.Equal(t, http.StatusBadRequest, sc.resp.Code, body)
+		}
+
+		assert.False(t, *upserted)
+	})
+
+	t.Run("returns not found for an unknown user", func(t *testing.T) {
+		bus.ClearBusHandlers()
+		defer bus.ClearBusHandlers()
+
+		upserted := mockLDAPChangeNotification(t)
+
+		sc := postLDAPChangeNotificationContext(t, "s3cr3t", `{"dn": "cn=janedoe,dc=grafana,dc=org"}`)
+
+		assert.Equal(t, http.StatusNotFound, sc.resp.Code)
+		assert.False(t, *upserted)
+	})
+}
+
+func TestPostLDAPChangeNotificationAPIEndpoint_Disabled(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	secret := setting.LDAPChangeNotificationSecret
+	setting.LDAPChangeNotificationSecret = ""
+	defer func() { setting.LDAPChangeNotificationSecret = secret }()
+
+	upserted := mockLDAPChangeNotification(t)
+
+	sc := postLDAPChangeNotificationContext(t, "", `{"login": "johndoe"}`)
+
+	assert.Equal(t, http.StatusNotFound, sc.resp.Code)
+	assert.False(t, *upserted)
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+)
+
+// GetLDAPUserPhoto returns the photo of the user, the raw bytes of the "photo" attribute of the LDAP server
+// the user is found on, with the content type detected from them.
+func (server *HTTPServer) GetLDAPUserPhoto(c *models.ReqContext) Response {
+	if !ldap.IsEnabled() {
+		return ldapDisabledError()
+	}
+
+	ldapConfig, err := getLDAPConfig()
+
+	if err != nil {
+		return ldapConfigError("Failed to obtain the LDAP configuration. Please verify the configuration and try again.", err)
+	}
+
+	ldapServer := newLDAP(ldapConfig.Servers)
+	defer ldapServer.Close()
+
+	username := c.Params(":username")
+
+	photo, err := ldapServer.UserPhoto(username)
+
+	if err == multildap.ErrUnreachable {
+		return Error(http.StatusServiceUnavailable, "None of the LDAP servers are reachable", err)
+	}
+
+	if err == ldap.ErrAmbiguousUser {
+		return Error(http.StatusConflict, "The user search matched several LDAP entries - Please verify the search filter", err)
+	}
+
+	if err == multildap.ErrDidNotFindUser {
+		return Error(http.StatusNotFound, fmt.Sprintf("No user %s was found on the LDAP server(s)", username), nil)
+	}
+
+	if err != nil {
+		return Error(http.StatusInternalServerError, "Failed to get the photo of the LDAP user", err)
+	}
+
+	if photo == nil {
+		return Error(http.StatusNotFound, fmt.Sprintf("The LDAP user %s has no photo", username), nil)
+	}
+
+	return Respond(http.StatusOK, photo).Header("Content-Type", http.DetectContentType(photo))
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/assert"
+)
+
+//***
+// GetLDAPUserPhoto tests
+//***
+
+func getLDAPUserPhotoContext(t *testing.T, requestURL string) *scenarioContext {
+	t.Helper()
+
+	sc := setupScenarioContext(requestURL)
+
+	ldap := setting.LDAPEnabled
+	setting.LDAPEnabled = true
+	defer func() { setting.LDAPEnabled = ldap }()
+
+	hs := &HTTPServer{Cfg: setting.NewCfg()}
+
+	sc.defaultHandler = Wrap(func(c *models.ReqContext) Response {
+		sc.context = c
+		return hs.GetLDAPUserPhoto(c)
+	})
+
+	sc.m.Get("/api/admin/ldap/:username/photo", sc.defaultHandler)
+
+	sc.resp = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, requestURL, nil)
+	sc.req = req
+	sc.exec()
+
+	return sc
+}
+
+func TestGetLDAPUserPhotoAPIEndpoint(t *testing.T) {
+	defer func() {
+		userPhotoResult = nil
+		userPhotoError = nil
+	}()
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	t.Run("returns the raw bytes of the photo", func(t *testing.T) {
+		// the start of a JPEG file, which isn't valid UTF-8
+		userPhotoResult = []byte{0xff, 0xd8, 0xff, 0xe0, 0x00, 0x10, 'J', 'F', 'I', 'F', 0x00, 0x80, 0xfe}
+		userPhotoError = nil
+
+		sc := getLDAPUserPhotoContext(t, "/api/admin/ldap/johndoe/photo")
+
+		assert.Equal(t, http.StatusOK, sc.resp.Code)
+		assert.Equal(t, "image/jpeg", sc.resp.Header().Get("Content-Type"))
+		assert.Equal(t, userPhotoResult, sc.resp.Body.Bytes())
+	})
+
+	t.Run("returns not found when the user has no photo", func(t *testing.T) {
+		userPhotoResult = nil
+		userPhotoError = nil
+
+		sc := getLDAPUserPhotoContext(t, "/api/admin/ldap/johndoe/photo")
+
+		assert.Equal(t, http.StatusNotFound, sc.resp.Code)
+		assert.Contains(t, sc.resp.Body.String(), "The LDAP user johndoe has no photo")
+	})
+
+	t.Run("returns not found when the user is missing", func(t *testing.T) {
+		userPhotoResult = nil
+		userPhotoError = multildap.ErrDidNotFindUser
+
+		sc := getLDAPUserPhotoContext(t, "/api/admin/ldap/johndoe/photo")
+
+		assert.Equal(t, http.StatusNotFound, sc.resp.Code)
+		assert.Contains(t, sc.resp.Body.String(), "No user johndoe was found on the LDAP server(s)")
+	})
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// ldapLimiter guards the directory from the LDAP admin API, see ldapRateLimit
+var ldapLimiter = newLDAPRateLimiter()
+
+// ldapRateLimit refuses the requests to the LDAP admin API with 429 Too Many Requests when the admin exceeds the
+// api_rate_limit requests per minute, or when api_concurrency_limit requests are already in flight, whoever sent them.
+// The refused requests tell when to retry with the Retry-After header.
+func ldapRateLimit(c *models.ReqContext) {
+	if wait := ldapLimiter.allow(c.UserId); wait > 0 {
+		c.Resp.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.JsonApiErr(http.StatusTooManyRequests, "Too many requests to the LDAP API, retry later", nil)
+		return
+	}
+
+	if !ldapLimiter.acquire() {
+		c.Resp.Header().Set("Retry-After", "1")
+		c.JsonApiErr(http.StatusTooManyRequests, "Too many concurrent requests to the LDAP API, retry later", nil)
+		return
+	}
+
+	defer ldapLimiter.release()
+
+	c.Next()
+}
+
+// ldapRateLimiter is a token bucket per admin, refilled with setting.LDAPAPIRateLimit tokens per minute,
+// alongside the count of the requests in flight
+type ldapRateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[int64]*ldapTokenBucket
+	inFlight  int
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// ldapTokenBucket holds the requests an admin can still send right away
+type ldapTokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+func newLDAPRateLimiter() *ldapRateLimiter {
+	return &ldapRateLimiter{
+		buckets: map[int64]*ldapTokenBucket{},
+		now:     time.Now,
+	}
+}
+
+// allow takes a token from the bucket of the admin, it returns how long to wait for the next token when it's empty
+func (limiter *ldapRateLimiter) allow(userID int64) time.Duration {
+	limit := setting.LDAPAPIRateLimit
+	if limit <= 0 {
+		return 0
+	}
+
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	now := limiter.now()
+	perToken := time.Minute / time.Duration(limit)
+
+	// the buckets idle for a minute are full again, they're dropped rather than kept for every admin
+	if now.Sub(limiter.lastSweep) >= time.Minute {
+		for id, bucket := range limiter.buckets {
+			if now.Sub(bucket.updatedAt) >= time.Minute {
+				delete(limiter.buckets, id)
+			}
+		}
+
+		limiter.lastSweep = now
+	}
+
+	bucket, ok := limiter.buckets[userID]
+	if !ok {
+		bucket = &ldapTokenBucket{tokens: float64(limit), updatedAt: now}
+		limiter.buckets[userID] = bucket
+	}
+
+	bucket.tokens = math.Min(float64(limit), bucket.tokens+float64(now.Sub(bucket.updatedAt))/float64(perToken))
+	bucket.updatedAt = now
+
+	if bucket.tokens < 1 {
+		return time.Duration((1 - bucket.tokens) * float64(perToken))
+	}
+
+	bucket.tokens--
+	return 0
+}
+
+// acquire counts the request in flight, unless setting.LDAPAPIConcurrencyLimit are already
+func (limiter *ldapRateLimiter) acquire() bool {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	if max := setting.LDAPAPIConcurrencyLimit; max > 0 && limiter.inFlight >= max {
+		return false
+	}
+
+	limiter.inFlight++
+	return true
+}
+
+// release uncounts a request acquired before
+func (limiter *ldapRateLimiter) release() {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	limiter.inFlight--
+}
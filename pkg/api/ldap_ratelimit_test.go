@@ -0,0 +1,123 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//***
+// ldapRateLimit tests
+//***
+
+// ldapRateLimitContext serves the handler behind the rate limit, the requests are sent by the admin of the "X-User-Id" header
+func ldapRateLimitContext(handler func(c *models.ReqContext) Response) *scenarioContext {
+	sc := setupScenarioContext("/api/admin/ldap/status")
+
+	signIn := func(c *models.ReqContext) {
+		userID, _ := strconv.ParseInt(c.Req.Header.Get("X-User-Id"), 10, 64)
+		c.SignedInUser = &models.SignedInUser{UserId: userID}
+	}
+
+	sc.m.Get("/api/admin/ldap/status", signIn, ldapRateLimit, Wrap(handler))
+
+	return sc
+}
+
+// serveAs sends a request to the rate limited handler as the admin
+func (sc *scenarioContext) serveAs(userID int64) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodGet, "/api/admin/ldap/status", nil)
+	req.Header.Set("X-User-Id", strconv.FormatInt(userID, 10))
+
+	resp := httptest.NewRecorder()
+	sc.m.ServeHTTP(resp, req)
+
+	return resp
+}
+
+func TestLDAPRateLimit(t *testing.T) {
+	rateLimit, concurrencyLimit := setting.LDAPAPIRateLimit, setting.LDAPAPIConcurrencyLimit
+	defer func() {
+		setting.LDAPAPIRateLimit, setting.LDAPAPIConcurrencyLimit = rateLimit, concurrencyLimit
+		ldapLimiter = newLDAPRateLimiter()
+	}()
+
+	ok := func(c *models.ReqContext) Response {
+		return Success("ok")
+	}
+
+	t.Run("limits the requests per minute of each admin", func(t *testing.T) {
+		setting.LDAPAPIRateLimit, setting.LDAPAPIConcurrencyLimit = 2, 0
+
+		clock := time.Date(2019, 10, 15, 10, 0, 0, 0, time.UTC)
+		ldapLimiter = newLDAPRateLimiter()
+		ldapLimiter.now = func() time.Time { return clock }
+
+		sc := ldapRateLimitContext(ok)
+
+		assert.Equal(t, http.StatusOK, sc.serveAs(1).Code)
+		assert.Equal(t, http.StatusOK, sc.serveAs(1).Code)
+
+		refused := sc.serveAs(1)
+		require.Equal(t, http.StatusTooManyRequests, refused.Code)
+		assert.Equal(t, "30", refused.Header().Get("Retry-After"))
+
+		// the other admins have their own limit
+		assert.Equal(t, http.StatusOK, sc.serveAs(2).Code)
+
+		clock = clock.Add(30 * time.Second)
+		assert.Equal(t, http.StatusOK, sc.serveAs(1).Code)
+		assert.Equal(t, http.StatusTooManyRequests, sc.serveAs(1).Code)
+	})
+
+	t.Run("limits the requests in flight", func(t *testing.T) {
+		setting.LDAPAPIRateLimit, setting.LDAPAPIConcurrencyLimit = 0, 1
+		ldapLimiter = newLDAPRateLimiter()
+
+		started := make(chan bool)
+		proceed := make(chan bool)
+		sc := ldapRateLimitContext(func(c *models.ReqContext) Response {
+			started <- true
+			<-proceed
+			return Success("ok")
+		})
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Equal(t, http.StatusOK, sc.serveAs(1).Code)
+		}()
+
+		<-started
+
+		refused := sc.serveAs(2)
+		assert.Equal(t, http.StatusTooManyRequests, refused.Code)
+		assert.Equal(t, "1", refused.Header().Get("Retry-After"))
+
+		proceed <- true
+		wg.Wait()
+
+		go func() { <-started; proceed <- true }()
+		assert.Equal(t, http.StatusOK, sc.serveAs(2).Code)
+	})
+
+	t.Run("doesn't limit anything by default", func(t *testing.T) {
+		setting.LDAPAPIRateLimit, setting.LDAPAPIConcurrencyLimit = 0, 0
+		ldapLimiter = newLDAPRateLimiter()
+
+		sc := ldapRateLimitContext(ok)
+
+		for i := 0; i < 100; i++ {
+			require.Equal(t, http.StatusOK, sc.serveAs(1).Code)
+		}
+	})
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/ldapsync"
+)
+
+// GetLDAPReconciliation compares every user of the directory with the Grafana users authenticated with LDAP,
+// and lists the users missing from LDAP, candidates to be disabled, and the ones missing from Grafana,
+// candidates to be provisioned. It is read-only, see ldapsync.Reconcile.
+func (server *HTTPServer) GetLDAPReconciliation(c *models.ReqContext) Response {
+	if !ldap.IsEnabled() {
+		return ldapDisabledError()
+	}
+
+	ldapConfig, err := getLDAPConfig()
+
+	if err != nil {
+		return ldapConfigError("Failed to obtain the LDAP configuration. Please verify the configuration and try again.", err)
+	}
+
+	ldapServer := newLDAP(ldapConfig.Servers)
+	defer ldapServer.Close()
+
+	report, err := ldapsync.Reconcile(ldapServer)
+
+	if err != nil {
+		return Error(http.StatusBadRequest, "Failed to reconcile the users with the LDAP server(s)", err)
+	}
+
+	resp := JSON(http.StatusOK, report)
+	if report.Truncated {
+		resp.Header(ldapTruncatedResultsHeader, "true")
+	}
+
+	return resp
+}
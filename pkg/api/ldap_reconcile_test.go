@@ -0,0 +1,121 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//***
+// GetLDAPReconciliation tests
+//***
+
+func getLDAPReconciliationContext(t *testing.T) *scenarioContext {
+	t.Helper()
+
+	requestURL := "/api/admin/ldap/reconciliation"
+	sc := setupScenarioContext(requestURL)
+
+	ldap := setting.LDAPEnabled
+	setting.LDAPEnabled = true
+	defer func() { setting.LDAPEnabled = ldap }()
+
+	hs := &HTTPServer{Cfg: setting.NewCfg()}
+
+	sc.defaultHandler = Wrap(func(c *models.ReqContext) Response {
+		sc.context = c
+		return hs.GetLDAPReconciliation(c)
+	})
+
+	sc.m.Get(requestURL, sc.defaultHandler)
+
+	sc.resp = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, requestURL, nil)
+	sc.req = req
+	sc.exec()
+
+	return sc
+}
+
+func mockLDAPReconciliation(ldapUsers []*models.ExternalUserInfo, truncated bool, grafanaUsers []*models.UserSearchHitDTO) {
+	allUsersResult = ldapUsers
+	allUsersTruncated = truncated
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	bus.AddHandler("test", func(query *models.SearchUsersQuery) error {
+		query.Result = models.SearchUserQueryResult{Users: grafanaUsers}
+		return nil
+	})
+}
+
+func TestGetLDAPReconciliationApiEndpoint(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+	defer func() { allUsersResult, allUsersTruncated = nil, false }()
+
+	mockLDAPReconciliation(
+		[]*models.ExternalUserInfo{
+			{Login: "alice", Email: "alice@example.org", Name: "Alice"},
+			{Login: "newcomer", Email: "newcomer@example.org", Name: "Newcomer"},
+		},
+		false,
+		[]*models.UserSearchHitDTO{
+			{Id: 1, Login: "alice", Email: "alice@example.org", Name: "Alice"},
+			{Id: 2, Login: "leaver", Email: "leaver@example.org", Name: "Leaver"},
+		},
+	)
+
+	sc := getLDAPReconciliationContext(t)
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+
+	expected := `
+	{
+		"grafanaUsers": 2,
+		"ldapUsers": 2,
+		"truncated": false,
+		"missingFromLDAP": [
+			{"userId": 2, "login": "leaver", "email": "leaver@example.org", "name": "Leaver", "isDisabled": false}
+		],
+		"missingFromGrafana": [
+			{"login": "newcomer", "email": "newcomer@example.org", "name": "Newcomer", "isDisabled": false}
+		]
+	}
+	`
+
+	assert.JSONEq(t, expected, sc.resp.Body.String())
+	assert.Empty(t, sc.resp.Header().Get(ldapTruncatedResultsHeader))
+}
+
+func TestGetLDAPReconciliationApiEndpoint_Truncated(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+	defer func() { allUsersResult, allUsersTruncated = nil, false }()
+
+	mockLDAPReconciliation(
+		[]*models.ExternalUserInfo{{Login: "alice"}},
+		true,
+		[]*models.UserSearchHitDTO{{Id: 1, Login: "alice"}, {Id: 2, Login: "leaver"}},
+	)
+
+	sc := getLDAPReconciliationContext(t)
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+	assert.Equal(t, "true", sc.resp.Header().Get(ldapTruncatedResultsHeader))
+	assert.Contains(t, sc.resp.Body.String(), `"missingFromLDAP":[]`)
+}
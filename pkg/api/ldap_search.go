@@ -0,0 +1,87 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+)
+
+const (
+	// ldapTestSearchSizeLimit is the number of entries returned by a test search by default
+	ldapTestSearchSizeLimit = 100
+
+	// ldapTestSearchMaxSizeLimit bounds the number of entries returned by a test search
+	ldapTestSearchMaxSizeLimit = 1000
+)
+
+// LDAPTestSearchCommand holds the search to test on a LDAP server
+type LDAPTestSearchCommand struct {
+	// Server is the host of the server, either "host" or "host:port", the first server if empty
+	Server string `json:"server"`
+
+	BaseDN string `json:"baseDN" binding:"Required"`
+	Filter string `json:"filter" binding:"Required"`
+
+	// Attributes are the attributes returned, all of them if empty
+	Attributes []string `json:"attributes"`
+
+	// SizeLimit is the number of entries returned at most, ldapTestSearchSizeLimit if 0
+	SizeLimit int `json:"sizeLimit"`
+}
+
+// LDAPTestSearchDTO is a serializer for the result of a test LDAP search
+type LDAPTestSearchDTO struct {
+	Host      string              `json:"host"`
+	Port      int                 `json:"port"`
+	Truncated bool                `json:"truncated"`
+	Entries   []*ldap.SearchEntry `json:"entries"`
+}
+
+// PostTestSearchWithLDAP runs the search on a LDAP server and returns the entries found, with the values of the
+// sensitive attributes like the passwords redacted, to try out search filters without changing the configuration.
+func (server *HTTPServer) PostTestSearchWithLDAP(c *models.ReqContext, cmd LDAPTestSearchCommand) Response {
+	if !ldap.IsEnabled() {
+		return ldapDisabledError()
+	}
+
+	if cmd.SizeLimit == 0 {
+		cmd.SizeLimit = ldapTestSearchSizeLimit
+	}
+
+	if cmd.SizeLimit < 0 || cmd.SizeLimit > ldapTestSearchMaxSizeLimit {
+		return Error(http.StatusBadRequest, fmt.Sprintf("Validation error. The size limit must be between 1 and %d", ldapTestSearchMaxSizeLimit), nil)
+	}
+
+	ldapConfig, err := getLDAPConfig()
+
+	if err != nil {
+		return ldapConfigError("Failed to obtain the LDAP configuration. Please verify the configuration and try again.", err)
+	}
+
+	ldapServer := newLDAP(ldapConfig.Servers)
+	defer ldapServer.Close()
+
+	result, err := ldapServer.Search(cmd.Server, cmd.BaseDN, cmd.Filter, cmd.Attributes, cmd.SizeLimit)
+
+	if err == multildap.ErrUnknownServer {
+		return Error(http.StatusNotFound, "No LDAP server matches the host", err)
+	}
+
+	if err == multildap.ErrUnreachable {
+		return Error(http.StatusServiceUnavailable, "Failed to connect to the LDAP server", err)
+	}
+
+	if err != nil {
+		return Error(http.StatusBadRequest, "Failed to search the LDAP server", err)
+	}
+
+	return JSON(http.StatusOK, &LDAPTestSearchDTO{
+		Host:      result.Host,
+		Port:      result.Port,
+		Truncated: result.Truncated,
+		Entries:   result.Entries,
+	})
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//***
+// PostTestSearchWithLDAP tests
+//***
+
+func testSearchWithLDAPContext(t *testing.T, cmd LDAPTestSearchCommand) *scenarioContext {
+	t.Helper()
+
+	requestURL := "/api/admin/ldap/test-search"
+	sc := setupScenarioContext(requestURL)
+
+	ldap := setting.LDAPEnabled
+	setting.LDAPEnabled = true
+	defer func() { setting.LDAPEnabled = ldap }()
+
+	hs := &HTTPServer{Cfg: setting.NewCfg()}
+
+	sc.defaultHandler = Wrap(func(c *models.ReqContext) Response {
+		sc.context = c
+		return hs.PostTestSearchWithLDAP(c, cmd)
+	})
+
+	sc.m.Post(requestURL, sc.defaultHandler)
+
+	sc.resp = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, requestURL, nil)
+	sc.req = req
+	sc.exec()
+
+	return sc
+}
+
+func setupTestSearchWithLDAP(t *testing.T) {
+	t.Helper()
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+
+	searchResult = &multildap.SearchResult{
+		Host: "ldap.example.org",
+		Port: 389,
+		Entries: []*ldap.SearchEntry{
+			{DN: "cn=admins,ou=groups,dc=grafana,dc=org", Attributes: map[string][]string{"member": {"uid=johndoe,ou=users,dc=grafana,dc=org"}}},
+		},
+		Truncated: true,
+	}
+	searchError = nil
+}
+
+func TestPostTestSearchWithLDAPAPIEndpoint(t *testing.T) {
+	cmd := LDAPTestSearchCommand{
+		Server:     "ldap.example.org",
+		BaseDN:     "ou=groups,dc=grafana,dc=org",
+		Filter:     "(member=uid=johndoe,ou=users,dc=grafana,dc=org)",
+		Attributes: []string{"member"},
+	}
+
+	t.Run("returns the entries found", func(t *testing.T) {
+		setupTestSearchWithLDAP(t)
+
+		sc := testSearchWithLDAPContext(t, cmd)
+
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+
+		assert.Equal(t, "ldap.example.org", searchHost)
+		assert.Equal(t, cmd.BaseDN, searchBaseDN)
+		assert.Equal(t, cmd.Filter, searchFilter)
+		assert.Equal(t, cmd.Attributes, searchAttributes)
+		assert.Equal(t, ldapTestSearchSizeLimit, searchSizeLimit)
+
+		expected := `
+		{
+			"host": "ldap.example.org",
+			"port": 389,
+			"truncated": true,
+			"entries": [
+				{ "dn": "cn=admins,ou=groups,dc=grafana,dc=org", "attributes": { "member": ["uid=johndoe,ou=users,dc=grafana,dc=org"] } }
+			]
+		}
+		`
+		assert.JSONEq(t, expected, sc.resp.Body.String())
+	})
+
+	t.Run("refuses a size limit above the maximum", func(t *testing.T) {
+		setupTestSearchWithLDAP(t)
+
+		tooMany := cmd
+		tooMany.SizeLimit = ldapTestSearchMaxSizeLimit + 1
+
+		sc := testSearchWithLDAPContext(t, tooMany)
+
+		assert.Equal(t, http.StatusBadRequest, sc.resp.Code)
+	})
+
+	t.Run("reports the unknown servers", func(t *testing.T) {
+		setupTestSearchWithLDAP(t)
+		searchError = multildap.ErrUnknownServer
+
+		sc := testSearchWithLDAPContext(t, cmd)
+
+		assert.Equal(t, http.StatusNotFound, sc.resp.Code)
+	})
+
+	t.Run("reports the unreachable servers", func(t *testing.T) {
+		setupTestSearchWithLDAP(t)
+		searchError = multildap.ErrUnreachable
+
+		sc := testSearchWithLDAPContext(t, cmd)
+
+		assert.Equal(t, http.StatusServiceUnavailable, sc.resp.Code)
+	})
+
+	t.Run("reports the failed searches", func(t *testing.T) {
+		setupTestSearchWithLDAP(t)
+		searchError = errors.New("LDAP Result Code 87 \"Filter Error\"")
+
+		sc := testSearchWithLDAPContext(t, cmd)
+
+		require.Equal(t, http.StatusBadRequest, sc.resp.Code)
+
+		var response map[string]interface{}
+		require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+		assert.Equal(t, "Failed to search the LDAP server", response["message"])
+	})
+}
@@ -0,0 +1,273 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// Sources of the LDAP config
+const (
+	// LDAPSettingsSourceDatabase is the source of the config stored in the database by the settings API
+	LDAPSettingsSourceDatabase = "database"
+
+	// LDAPSettingsSourceFile is the source of the config file, used when no config is stored in the database
+	LDAPSettingsSourceFile = "file"
+)
+
+// applyLDAPConfig stores and loads the LDAP config of the settings API, it's replaced by the tests
+var applyLDAPConfig = ldap.ApplyConfig
+
+// ldapSecretSettings are the settings of the servers of the LDAP config redacted by the settings API
+var ldapSecretSettings = []string{"bind_password", "client_key"}
+
+// ldapSettingsTree is the LDAP config decoded as is, without the types of ldap.Config,
+// so it's re-emitted with all of its settings
+type ldapSettingsTree map[string]interface{}
+
+// LDAPSettingsDTO is the LDAP config used by Grafana, in the TOML format of the config file. Its bind passwords
+// and client keys are redacted, see redactLDAPSecrets.
+type LDAPSettingsDTO struct {
+	// Source is either LDAPSettingsSourceDatabase or LDAPSettingsSourceFile
+	Source string `json:"source"`
+	Config string `json:"config"`
+
+	// File is the path of the config file, when it's the source
+	File string `json:"file,omitempty"`
+
+	// Version, Updated and UpdatedBy describe the last update of the config stored in the database
+	Version   int64      `json:"version,omitempty"`
+	Updated   *time.Time `json:"updated,omitempty"`
+	UpdatedBy int64      `json:"updatedBy,omitempty"`
+}
+
+// UpdateLDAPSettingsCommand holds the LDAP config to store, in the TOML format of the config file
+type UpdateLDAPSettingsCommand struct {
+	Config string `json:"config" binding:"Required"`
+}
+
+// GetLDAPSettings returns the LDAP config stored in the database, or else the content of the config file
+func (server *HTTPServer) GetLDAPSettings(c *models.ReqContext) Response {
+	if !ldap.IsEnabled() {
+		return ldapDisabledError()
+	}
+
+	settings, err := currentLDAPSettings()
+	if err != nil {
+		return Error(http.StatusInternalServerError, "Failed to get the LDAP settings", err)
+	}
+
+	settings.Config, err = redactLDAPSecrets(settings.Config)
+	if err != nil {
+		return Error(http.StatusInternalServerError, "Failed to redact the secrets of the LDAP settings", err)
+	}
+
+	return JSON(http.StatusOK, settings)
+}
+
+// currentLDAPSettings returns the LDAP config stored in the database, or else the content of the config file, unredacted
+func currentLDAPSettings() (*LDAPSettingsDTO, error) {
+	query := &models.GetLDAPSettingsQuery{}
+	err := bus.Dispatch(query)
+
+	if err == models.ErrLDAPSettingsNotFound {
+		data, err := ioutil.ReadFile(setting.LDAPConfigFile)
+		if err != nil {
+			return nil, err
+		}
+
+		return &LDAPSettingsDTO{
+			Source: LDAPSettingsSourceFile,
+			Config: string(data),
+			File:   setting.LDAPConfigFile,
+		}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &LDAPSettingsDTO{
+		Source:    LDAPSettingsSourceDatabase,
+		Config:    query.Result.Config,
+		Version:   query.Result.Version,
+		Updated:   &query.Result.Updated,
+		UpdatedBy: query.Result.UpdatedBy,
+	}, nil
+}
+
+// PutLDAPSettings stores the LDAP config in the database, where it replaces the config file, and loads it.
+// The config is validated first, an invalid config is refused without being stored, and it's only loaded once stored.
+// The redacted secrets keep their current value, see restoreLDAPSecrets.
+func (server *HTTPServer) PutLDAPSettings(c *models.ReqContext, cmd UpdateLDAPSettingsCommand) Response {
+	if !ldap.IsEnabled() {
+		return ldapDisabledError()
+	}
+
+	tree, err := decodeLDAPSettings(cmd.Config)
+	if err != nil {
+		return Error(http.StatusBadRequest, "Failed to parse the LDAP configuration", err)
+	}
+
+	data := cmd.Config
+	if tree.secretsRedacted() {
+		current, err := currentLDAPSettings()
+		if err != nil {
+			return Error(http.StatusInternalServerError, "Failed to get the LDAP settings", err)
+		}
+
+		currentTree, err := decodeLDAPSettings(current.Config)
+		if err != nil {
+			return Error(http.StatusInternalServerError, "Failed to parse the current LDAP settings", err)
+		}
+
+		if err := tree.restoreSecrets(currentTree); err != nil {
+			return Error(http.StatusBadRequest, "Failed to restore the redacted LDAP secrets", err)
+		}
+
+		if data, err = tree.encode(); err != nil {
+			return Error(http.StatusInternalServerError, "Failed to encode the LDAP configuration", err)
+		}
+	}
+
+	config, err := ldap.ParseConfig(data)
+	if err != nil {
+		return Error(http.StatusBadRequest, "Failed to parse the LDAP configuration", err)
+	}
+
+	var storeErr error
+	changes, err := applyLDAPConfig(config, func() (int64, error) {
+		save := &models.SaveLDAPSettingsCommand{Config: data, UserId: c.UserId}
+		if storeErr = bus.Dispatch(save); storeErr != nil {
+			return 0, storeErr
+		}
+
+		logger.Info("LDAP settings saved", "version", save.Result.Version, "userId", c.UserId)
+
+		return save.Result.Version, nil
+	})
+
+	if storeErr != nil {
+		return Error(http.StatusInternalServerError, "Failed to save the LDAP settings", storeErr)
+	}
+
+	if err != nil {
+		return Error(http.StatusBadRequest, "Failed to load the TLS certificates of the LDAP configuration", err)
+	}
+
+	// the pooled connections of the previous config may be secured with rotated certificates
+	multildap.CycleConnections()
+
+	return ldapReloadResponse(changes, nil)
+}
+
+// redactLDAPSecrets replaces the values of the bind passwords and the client keys of the LDAP config,
+// like newLDAPConfigDTO does. The secrets are redacted in the decoded config, which is re-emitted, so they are
+// whatever the TOML syntax of their setting. The config without secrets is returned as is, with its comments.
+func redactLDAPSecrets(config string) (string, error) {
+	tree, err := decodeLDAPSettings(config)
+	if err != nil {
+		return "", err
+	}
+
+	redacted := false
+	for _, server := range tree.servers() {
+		for _, name := range ldapSecretSettings {
+			if value, ok := server[name]; ok && value != "" {
+				server[name] = redactedLDAPPassword
+				redacted = true
+			}
+		}
+	}
+
+	if !redacted {
+		return config, nil
+	}
+
+	return tree.encode()
+}
+
+// decodeLDAPSettings decodes the LDAP config in the TOML format of the config file
+func decodeLDAPSettings(config string) (ldapSettingsTree, error) {
+	tree := ldapSettingsTree{}
+	if _, err := toml.Decode(config, &tree); err != nil {
+		return nil, err
+	}
+
+	return tree, nil
+}
+
+// servers returns the settings of the servers of the config
+func (tree ldapSettingsTree) servers() []map[string]interface{} {
+	servers, _ := tree["servers"].([]map[string]interface{})
+	return servers
+}
+
+// encode re-emits the config in the TOML format of the config file
+func (tree ldapSettingsTree) encode() (string, error) {
+	var buffer bytes.Buffer
+	if err := toml.NewEncoder(&buffer).Encode(map[string]interface{}(tree)); err != nil {
+		return "", err
+	}
+
+	return buffer.String(), nil
+}
+
+// secretsRedacted tells whether the config has secrets redacted by redactLDAPSecrets
+func (tree ldapSettingsTree) secretsRedacted() bool {
+	for _, server := range tree.servers() {
+		for _, name := range ldapSecretSettings {
+			if server[name] == redactedLDAPPassword {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// restoreSecrets replaces the redacted secrets of the config by their value in the current config,
+// the secrets of the nth server take the value of the ones of the nth server of the current config
+func (tree ldapSettingsTree) restoreSecrets(current ldapSettingsTree) error {
+	currentServers := current.servers()
+
+	for i, server := range tree.servers() {
+		for _, name := range ldapSecretSettings {
+			if server[name] != redactedLDAPPassword {
+				continue
+			}
+
+			if i >= len(currentServers) || currentServers[i][name] == nil {
+				return fmt.Errorf("the redacted %s of the server number %d has no value in the current configuration", name, i+1)
+			}
+
+			server[name] = currentServers[i][name]
+		}
+	}
+
+	return nil
+}
+
+// DeleteLDAPSettings deletes the LDAP config stored in the database, and reloads the config file instead
+func (server *HTTPServer) DeleteLDAPSettings(c *models.ReqContext) Response {
+	if !ldap.IsEnabled() {
+		return ldapDisabledError()
+	}
+
+	if err := bus.Dispatch(&models.DeleteLDAPSettingsCommand{}); err != nil {
+		return Error(http.StatusInternalServerError, "Failed to delete the LDAP settings", err)
+	}
+
+	logger.Info("LDAP settings deleted, using the config file", "userId", c.UserId)
+
+	return server.ReloadLDAPCfg()
+}
@@ -0,0 +1,384 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/macaron.v1"
+)
+
+//***
+// LDAP settings tests
+//***
+
+func ldapSettingsContext(t *testing.T, method string, handler func(hs *HTTPServer, c *models.ReqContext) Response) *scenarioContext {
+	t.Helper()
+
+	requestURL := "/api/admin/ldap/settings"
+	sc := setupScenarioContext(requestURL)
+
+	ldap := setting.LDAPEnabled
+	setting.LDAPEnabled = true
+	defer func() { setting.LDAPEnabled = ldap }()
+
+	hs := &HTTPServer{Cfg: setting.NewCfg()}
+
+	sc.defaultHandler = Wrap(func(c *models.ReqContext) Response {
+		c.SignedInUser = &models.SignedInUser{UserId: 7}
+		sc.context = c
+		return handler(hs, c)
+	})
+
+	sc.m.Handle(method, requestURL, []macaron.Handler{sc.defaultHandler})
+
+	sc.resp = httptest.NewRecorder()
+	req, _ := http.NewRequest(method, requestURL, nil)
+	sc.req = req
+	sc.exec()
+
+	return sc
+}
+
+func TestGetLDAPSettingsAPIEndpoint(t *testing.T) {
+	get := func(hs *HTTPServer, c *models.ReqContext) Response { return hs.GetLDAPSettings(c) }
+
+	t.Run("returns the config stored in the database", func(t *testing.T) {
+		bus.ClearBusHandlers()
+		defer bus.ClearBusHandlers()
+
+		updated := time.Date(2019, 10, 15, 10, 0, 0, 0, time.UTC)
+		bus.AddHandler("test", func(query *models.GetLDAPSettingsQuery) error {
+			query.Result = &models.LDAPSettings{Config: proposedLDAPConfig, Version: 3, Updated: updated, UpdatedBy: 7}
+			return nil
+		})
+
+		sc := ldapSettingsContext(t, http.MethodGet, get)
+
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+
+		var response LDAPSettingsDTO
+		require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+
+		assert.Equal(t, LDAPSettingsSourceDatabase, response.Source)
+		assert.Equal(t, proposedLDAPConfig, response.Config)
+		assert.Empty(t, response.File)
+		assert.Equal(t, int64(3), response.Version)
+		assert.True(t, updated.Equal(*response.Updated))
+		assert.Equal(t, int64(7), response.UpdatedBy)
+	})
+
+	t.Run("returns the config file without stored config", func(t *testing.T) {
+		bus.ClearBusHandlers()
+		defer bus.ClearBusHandlers()
+
+		bus.AddHandler("test", func(query *models.GetLDAPSettingsQuery) error {
+			return models.ErrLDAPSettingsNotFound
+		})
+
+		dir, err := ioutil.TempDir("", "ldap")
+		require.Nil(t, err)
+		defer os.RemoveAll(dir)
+
+		configFile := setting.LDAPConfigFile
+		defer func() { setting.LDAPConfigFile = configFile }()
+
+		setting.LDAPConfigFile = filepath.Join(dir, "ldap.toml")
+		require.Nil(t, ioutil.WriteFile(setting.LDAPConfigFile, []byte(proposedLDAPConfig), 0644))
+
+		sc := ldapSettingsContext(t, http.MethodGet, get)
+
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+
+		var response LDAPSettingsDTO
+		require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+
+		assert.Equal(t, LDAPSettingsSourceFile, response.Source)
+		assert.Equal(t, proposedLDAPConfig, response.Config)
+		assert.Equal(t, setting.LDAPConfigFile, response.File)
+		assert.Nil(t, response.Updated)
+	})
+
+	t.Run("redacts the bind passwords and the client keys", func(t *testing.T) {
+		bus.ClearBusHandlers()
+		defer bus.ClearBusHandlers()
+
+		bus.AddHandler("test", func(query *models.GetLDAPSettingsQuery) error {
+			query.Result = &models.LDAPSettings{Config: securedLDAPConfig, Version: 3}
+			return nil
+		})
+
+		sc := ldapSettingsContext(t, http.MethodGet, get)
+
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+
+		var response LDAPSettingsDTO
+		require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+
+		assert.NotContains(t, response.Config, "grafana-secret")
+		assert.NotContains(t, response.Config, "client.key")
+		assert.Contains(t, response.Config, `bind_password = "************"`)
+		assert.Contains(t, response.Config, `client_key = "************"`)
+		assert.Contains(t, response.Config, `bind_dn = "cn=admin,dc=grafana,dc=org"`)
+	})
+
+	t.Run("redacts the secrets whatever their TOML syntax", func(t *testing.T) {
+		for _, secret := range []string{
+			`bind_password = """grafana-secret"""`,
+			`bind_password = '''grafana-secret'''`,
+			`"bind_password" = "grafana-secret"`,
+			`'bind_password' = 'grafana-secret'`,
+			"bind_password = \"\"\"\ngrafana-secret\"\"\"",
+		} {
+			config := `
+[[servers]]
+host = "proposed.example.org"
+` + secret + `
+search_filter = "(cn=%s)"
+search_base_dns = ["dc=grafana,dc=org"]
+`
+
+			redacted, err := redactLDAPSecrets(config)
+			require.Nil(t, err, secret)
+
+			assert.NotContains(t, redacted, "grafana-secret", secret)
+
+			parsed, err := ldap.ParseConfig(redacted)
+			require.Nil(t, err, secret)
+			assert.Equal(t, redactedLDAPPassword, parsed.Servers[0].BindPassword, secret)
+		}
+	})
+}
+
+// securedLDAPConfig has a bind password and a client key, redacted by the settings API
+const securedLDAPConfig = `
+[[servers]]
+host = "proposed.example.org"
+bind_dn = "cn=admin,dc=grafana,dc=org"
+bind_password = "grafana-secret"
+client_key = '/etc/grafana/client.key'
+search_filter = "(cn=%s)"
+search_base_dns = ["dc=grafana,dc=org"]
+`
+
+func TestPutLDAPSettingsAPIEndpoint(t *testing.T) {
+	defer func() { applyLDAPConfig = ldap.ApplyConfig }()
+
+	put := func(config string) func(hs *HTTPServer, c *models.ReqContext) Response {
+		return func(hs *HTTPServer, c *models.ReqContext) Response {
+			return hs.PutLDAPSettings(c, UpdateLDAPSettingsCommand{Config: config})
+		}
+	}
+
+	// applied stubs the loading of the config, which is stored first
+	applied := func() *bool {
+		loaded := false
+		applyLDAPConfig = func(_ *ldap.Config, store func() (int64, error)) (*ldap.ConfigDiff, error) {
+			if _, err := store(); err != nil {
+				return nil, err
+			}
+
+			loaded = true
+			return &ldap.ConfigDiff{}, nil
+		}
+
+		return &loaded
+	}
+
+	t.Run("stores the config and loads it", func(t *testing.T) {
+		bus.ClearBusHandlers()
+		defer bus.ClearBusHandlers()
+
+		var saved *models.SaveLDAPSettingsCommand
+		bus.AddHandler("test", func(cmd *models.SaveLDAPSettingsCommand) error {
+			saved = cmd
+			cmd.Result = &models.LDAPSettings{Config: cmd.Config, Version: 1}
+			return nil
+		})
+
+		loaded := applied()
+
+		sc := ldapSettingsContext(t, http.MethodPut, put(proposedLDAPConfig))
+
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+		require.NotNil(t, saved)
+		assert.Equal(t, proposedLDAPConfig, saved.Config)
+		assert.Equal(t, int64(7), saved.UserId)
+		assert.True(t, *loaded)
+	})
+
+	t.Run("keeps the value of the redacted secrets", func(t *testing.T) {
+		bus.ClearBusHandlers()
+		defer bus.ClearBusHandlers()
+
+		bus.AddHandler("test", func(query *models.GetLDAPSettingsQuery) error {
+			query.Result = &models.LDAPSettings{Config: securedLDAPConfig, Version: 3}
+			return nil
+		})
+
+		var saved *models.SaveLDAPSettingsCommand
+		bus.AddHandler("test", func(cmd *models.SaveLDAPSettingsCommand) error {
+			saved = cmd
+			cmd.Result = &models.LDAPSettings{Config: cmd.Config, Version: 4}
+			return nil
+		})
+
+		applied()
+
+		redacted, err := redactLDAPSecrets(securedLDAPConfig)
+		require.Nil(t, err)
+
+		sc := ldapSettingsContext(t, http.MethodPut, put(strings.Replace(redacted, "(cn=%s)", "(uid=%s)", 1)))
+
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+		require.NotNil(t, saved)
+
+		stored, err := ldap.ParseConfig(saved.Config)
+		require.Nil(t, err)
+		assert.Equal(t, "grafana-secret", stored.Servers[0].BindPassword)
+		assert.Equal(t, "/etc/grafana/client.key", stored.Servers[0].ClientKey)
+		assert.Equal(t, "(uid=%s)", stored.Servers[0].SearchFilter)
+	})
+
+	t.Run("refuses a redacted secret without current value", func(t *testing.T) {
+		bus.ClearBusHandlers()
+		defer bus.ClearBusHandlers()
+
+		bus.AddHandler("test", func(query *models.GetLDAPSettingsQuery) error {
+			query.Result = &models.LDAPSettings{Config: proposedLDAPConfig, Version: 3}
+			return nil
+		})
+
+		saved := false
+		bus.AddHandler("test", func(cmd *models.SaveLDAPSettingsCommand) error {
+			saved = true
+			return nil
+		})
+
+		redacted, err := redactLDAPSecrets(securedLDAPConfig)
+		require.Nil(t, err)
+
+		sc := ldapSettingsContext(t, http.MethodPut, put(redacted))
+
+		assert.Equal(t, http.StatusBadRequest, sc.resp.Code)
+		assert.False(t, saved)
+	})
+
+	t.Run("refuses a config including files without storing it", func(t *testing.T) {
+		bus.ClearBusHandlers()
+		defer bus.ClearBusHandlers()
+
+		saved := false
+		bus.AddHandler("test", func(cmd *models.SaveLDAPSettingsCommand) error {
+			saved = true
+			return nil
+		})
+
+		applied()
+
+		sc := ldapSettingsContext(t, http.MethodPut, put(`include = ["/etc/*/*.toml"]
+`+proposedLDAPConfig))
+
+		assert.Equal(t, http.StatusBadRequest, sc.resp.Code)
+		assert.False(t, saved)
+	})
+
+	t.Run("refuses an invalid config without storing it", func(t *testing.T) {
+		bus.ClearBusHandlers()
+		defer bus.ClearBusHandlers()
+
+		saved := false
+		bus.AddHandler("test", func(cmd *models.SaveLDAPSettingsCommand) error {
+			saved = true
+			return nil
+		})
+
+		sc := ldapSettingsContext(t, http.MethodPut, put(`[[servers]]
+host = "proposed.example.org"
+`))
+
+		assert.Equal(t, http.StatusBadRequest, sc.resp.Code)
+		assert.False(t, saved)
+	})
+
+	t.Run("refuses a config whose certificates can't be loaded without storing it", func(t *testing.T) {
+		bus.ClearBusHandlers()
+		defer bus.ClearBusHandlers()
+
+		saved := false
+		bus.AddHandler("test", func(cmd *models.SaveLDAPSettingsCommand) error {
+			saved = true
+			return nil
+		})
+
+		applyLDAPConfig = ldap.ApplyConfig
+
+		sc := ldapSettingsContext(t, http.MethodPut, put(`
+[[servers]]
+host = "proposed.example.org"
+port = 636
+use_ssl = true
+root_ca_cert = "/nonexistent/ca.crt"
+search_filter = "(cn=%s)"
+search_base_dns = ["dc=grafana,dc=org"]
+`))
+
+		assert.Equal(t, http.StatusBadRequest, sc.resp.Code)
+		assert.False(t, saved)
+	})
+
+	t.Run("fails when the config can't be stored", func(t *testing.T) {
+		bus.ClearBusHandlers()
+		defer bus.ClearBusHandlers()
+
+		bus.AddHandler("test", func(cmd *models.SaveLDAPSettingsCommand) error {
+			return errors.New("database is locked")
+		})
+
+		loaded := applied()
+
+		sc := ldapSettingsContext(t, http.MethodPut, put(proposedLDAPConfig))
+
+		assert.Equal(t, http.StatusInternalServerError, sc.resp.Code)
+		assert.False(t, *loaded)
+	})
+}
+
+func TestDeleteLDAPSettingsAPIEndpoint(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	deleted := false
+	bus.AddHandler("test", func(cmd *models.DeleteLDAPSettingsCommand) error {
+		deleted = true
+		return nil
+	})
+
+	reloaded := false
+	reloadLDAPConfig = func() (*ldap.ConfigDiff, error) {
+		reloaded = true
+		return &ldap.ConfigDiff{}, nil
+	}
+	defer func() { reloadLDAPConfig = ldap.ReloadConfig }()
+
+	sc := ldapSettingsContext(t, http.MethodDelete, func(hs *HTTPServer, c *models.ReqContext) Response {
+		return hs.DeleteLDAPSettings(c)
+	})
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+	assert.True(t, deleted)
+	assert.True(t, reloaded)
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+)
+
+// Limits of the pages of the LDAP sync audit trail
+const (
+	defaultLDAPSyncLogPerPage = 100
+	maxLDAPSyncLogPerPage     = 1000
+)
+
+// LDAPSyncLogEntryDTO is a serializer for a change recorded in the audit trail of the LDAP syncs
+type LDAPSyncLogEntryDTO struct {
+	Id            int64     `json:"id"`
+	UserId        int64     `json:"userId"`
+	Login         string    `json:"login"`
+	Source        string    `json:"source"`
+	Action        string    `json:"action"`
+	OrgId         int64     `json:"orgId,omitempty"`
+	PreviousValue string    `json:"previousValue"`
+	NewValue      string    `json:"newValue"`
+	Reason        string    `json:"reason"`
+	Created       time.Time `json:"created"`
+}
+
+// LDAPSyncLogDTO is a serializer for a page of the audit trail of the LDAP syncs
+type LDAPSyncLogDTO struct {
+	TotalCount int64                  `json:"totalCount"`
+	Entries    []*LDAPSyncLogEntryDTO `json:"entries"`
+	Page       int                    `json:"page"`
+	PerPage    int                    `json:"perPage"`
+}
+
+// GetLDAPSyncLog returns the audit trail of the LDAP syncs, the most recent changes first: the users disabled or enabled,
+// and their role and Grafana admin changes, made at login or by the syncs. The trail is filtered with "?userId=", "?login="
+// and "?action=", and paged with "?perpage=" and "?page=".
+func (server *HTTPServer) GetLDAPSyncLog(c *models.ReqContext) Response {
+	if !ldap.IsEnabled() {
+		return ldapDisabledError()
+	}
+
+	perPage := c.QueryInt("perpage")
+	if perPage <= 0 {
+		perPage = defaultLDAPSyncLogPerPage
+	}
+
+	if perPage > maxLDAPSyncLogPerPage {
+		perPage = maxLDAPSyncLogPerPage
+	}
+
+	page := c.QueryInt("page")
+	if page < 1 {
+		page = 1
+	}
+
+	query := &models.SearchLDAPSyncAuditQuery{
+		UserId: c.QueryInt64("userId"),
+		Login:  c.Query("login"),
+		Action: c.Query("action"),
+		Page:   page,
+		Limit:  perPage,
+	}
+
+	if err := bus.Dispatch(query); err != nil {
+		return Error(http.StatusInternalServerError, "Failed to search the LDAP sync audit", err)
+	}
+
+	result := &LDAPSyncLogDTO{
+		TotalCount: query.Result.TotalCount,
+		Entries:    []*LDAPSyncLogEntryDTO{},
+		Page:       page,
+		PerPage:    perPage,
+	}
+
+	for _, entry := range query.Result.Entries {
+		result.Entries = append(result.Entries, &LDAPSyncLogEntryDTO{
+			Id:            entry.Id,
+			UserId:        entry.UserId,
+			Login:         entry.Login,
+			Source:        entry.Source,
+			Action:        entry.Action,
+			OrgId:         entry.OrgId,
+			PreviousValue: entry.PreviousValue,
+			NewValue:      entry.NewValue,
+			Reason:        entry.Reason,
+			Created:       entry.Created,
+		})
+	}
+
+	return JSON(http.StatusOK, result)
+}
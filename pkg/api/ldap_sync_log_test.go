@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//***
+// GetLDAPSyncLog tests
+//***
+
+func getLDAPSyncLogContext(t *testing.T, requestURL string) *scenarioContext {
+	t.Helper()
+
+	sc := setupScenarioContext(requestURL)
+
+	ldap := setting.LDAPEnabled
+	setting.LDAPEnabled = true
+	defer func() { setting.LDAPEnabled = ldap }()
+
+	hs := &HTTPServer{Cfg: setting.NewCfg()}
+
+	sc.defaultHandler = Wrap(func(c *models.ReqContext) Response {
+		sc.context = c
+		return hs.GetLDAPSyncLog(c)
+	})
+
+	sc.m.Get("/api/admin/ldap/sync-log", sc.defaultHandler)
+
+	sc.resp = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, requestURL, nil)
+	sc.req = req
+	sc.exec()
+
+	return sc
+}
+
+func TestGetLDAPSyncLogAPIEndpoint(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	var searched *models.SearchLDAPSyncAuditQuery
+	bus.AddHandler("test", func(query *models.SearchLDAPSyncAuditQuery) error {
+		searched = query
+		query.Result = models.SearchLDAPSyncAuditResult{
+			TotalCount: 3,
+			Entries: []*models.LDAPSyncAuditEntry{
+				{
+					Id:            3,
+					UserId:        2,
+					Login:         "jdoe",
+					Source:        models.LDAPSyncSourceSync,
+					Action:        models.LDAPSyncAuditRoleChange,
+					OrgId:         1,
+					PreviousValue: "Viewer",
+					NewValue:      "Editor",
+					Reason:        "Role mapped from the LDAP groups",
+				},
+			},
+		}
+		return nil
+	})
+
+	t.Run("filters and pages the audit trail", func(t *testing.T) {
+		sc := getLDAPSyncLogContext(t, "/api/admin/ldap/sync-log?userId=2&action=role_change&perpage=1&page=3")
+
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+		assert.Equal(t, int64(2), searched.UserId)
+		assert.Equal(t, models.LDAPSyncAuditRoleChange, searched.Action)
+		assert.Equal(t, 1, searched.Limit)
+		assert.Equal(t, 3, searched.Page)
+
+		var response LDAPSyncLogDTO
+		require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &response))
+
+		assert.Equal(t, int64(3), response.TotalCount)
+		assert.Equal(t, 3, response.Page)
+		require.Len(t, response.Entries, 1)
+		assert.Equal(t, "Viewer", response.Entries[0].PreviousValue)
+		assert.Equal(t, "Editor", response.Entries[0].NewValue)
+		assert.Equal(t, models.LDAPSyncSourceSync, response.Entries[0].Source)
+	})
+
+	t.Run("caps the pages at 1000 entries, 100 by default", func(t *testing.T) {
+		sc := getLDAPSyncLogContext(t, "/api/admin/ldap/sync-log?perpage=5000")
+
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+		assert.Equal(t, 1000, searched.Limit)
+		assert.Equal(t, 1, searched.Page)
+
+		sc = getLDAPSyncLogContext(t, "/api/admin/ldap/sync-log")
+
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+		assert.Equal(t, 100, searched.Limit)
+	})
+}
@@ -0,0 +1,313 @@
+package api
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+)
+
+// ldapUsersCSVHeader is the header row of the CSV export of the LDAP users
+var ldapUsersCSVHeader = []string{"login", "name", "email", "grafana_admin", "disabled", "roles"}
+
+// ldapTruncatedResultsHeader is set when the size limit of a LDAP server truncated the listed users
+const ldapTruncatedResultsHeader = "X-LDAP-Truncated-Results"
+
+// Limits of the pages of LDAP users listed with a cursor
+const (
+	defaultLDAPUsersLimit = 100
+	maxLDAPUsersLimit     = 1000
+)
+
+// ldapUsersCSVPageSize is the size of the pages of users listed while exporting them as CSV
+var ldapUsersCSVPageSize = maxLDAPUsersLimit
+
+// csvFormulaPrefixes are the first characters which make a spreadsheet read a cell as a formula,
+// the tab and the carriage return being skipped by some spreadsheets before a formula
+const csvFormulaPrefixes = "=+-@\t\r"
+
+// LDAPUserSummaryDTO is a serializer for the users listed from LDAP
+type LDAPUserSummaryDTO struct {
+	Login          string                    `json:"login"`
+	Name           string                    `json:"name"`
+	Email          string                    `json:"email"`
+	IsGrafanaAdmin *bool                     `json:"isGrafanaAdmin"`
+	IsDisabled     bool                      `json:"isDisabled"`
+	OrgRoles       map[int64]models.RoleType `json:"roles"`
+}
+
+// LDAPUsersCursorPageDTO is a serializer for a page of the users listed from LDAP with a cursor,
+// the next page is listed by passing back the cursor, which is empty after the last page
+type LDAPUsersCursorPageDTO struct {
+	Users      []*LDAPUserSummaryDTO `json:"users"`
+	NextCursor string                `json:"nextCursor,omitempty"`
+}
+
+// LDAPUsersOffsetPageDTO is a serializer for a page of the users listed from LDAP by offset
+type LDAPUsersOffsetPageDTO struct {
+	TotalCount int                   `json:"totalCount"`
+	Users      []*LDAPUserSummaryDTO `json:"users"`
+	Page       int                   `json:"page"`
+	PerPage    int                   `json:"perPage"`
+}
+
+// GetAllUsersFromLDAP lists all of the users found on the LDAP server(s) alongside how they would be mapped in Grafana.
+// The list is returned as CSV when asked for with either "?format=csv" or the "Accept: text/csv" header,
+// see streamLDAPUsersCSV.
+// A list truncated by the size limit of a server is still returned, with the "X-LDAP-Truncated-Results: true" header.
+// The JSON list is paged with either "?limit=" and the "?cursor=" of the previous page, see getLDAPUsersPage,
+// or "?perpage=" and "?page=", which pages the whole list by offset.
+// The users are filtered by login with "?query=", in which "*" is a wildcard, i.e. "?query=jo*".
+// The filtered list can only be paged by offset.
+func (server *HTTPServer) GetAllUsersFromLDAP(c *models.ReqContext) Response {
+	if !ldap.IsEnabled() {
+		return ldapDisabledError()
+	}
+
+	ldapConfig, err := getLDAPConfig()
+	if err != nil {
+		return ldapConfigError("Failed to obtain the LDAP configuration", err)
+	}
+
+	query := c.Query("query")
+	paged := c.Query("cursor") != "" || c.QueryInt("limit") > 0
+
+	if query != "" && paged {
+		return Error(http.StatusBadRequest, "The users matching a query are paged with perpage and page, not with a cursor", nil)
+	}
+
+	if !wantsCSV(c) && paged {
+		return getLDAPUsersPage(c, ldapConfig)
+	}
+
+	if wantsCSV(c) && query == "" {
+		return streamLDAPUsersCSV(ldapConfig)
+	}
+
+	ldapServer := newLDAP(ldapConfig.Servers)
+	defer ldapServer.Close()
+
+	var users []*models.ExternalUserInfo
+	var truncatedResults bool
+	if query != "" {
+		users, truncatedResults, err = ldapServer.MatchingUsers(query)
+	} else {
+		users, truncatedResults, err = ldapServer.AllUsers()
+	}
+
+	if err != nil {
+		return Error(http.StatusBadRequest, "Failed to list the users from the LDAP server(s)", err)
+	}
+
+	if truncatedResults {
+		logger.Warn("The LDAP users are truncated by the size limit of the server(s)", "count", len(users))
+	}
+
+	if wantsCSV(c) {
+		resp := Stream(http.StatusOK, "text/csv; charset=utf-8", func(w io.Writer) error {
+			writer := csv.NewWriter(w)
+			if err := writer.Write(ldapUsersCSVHeader); err != nil {
+				return err
+			}
+
+			return writeLDAPUsersCSV(writer, users)
+		})
+
+		if truncatedResults {
+			resp.Header(ldapTruncatedResultsHeader, "true")
+		}
+
+		return resp
+	}
+
+	var result interface{} = newLDAPUserSummaryDTOs(users)
+
+	if perPage := c.QueryInt("perpage"); perPage > 0 {
+		page := c.QueryInt("page")
+		if page < 1 {
+			page = 1
+		}
+
+		start := (page - 1) * perPage
+		if start > len(users) {
+			start = len(users)
+		}
+
+		end := start + perPage
+		if end > len(users) {
+			end = len(users)
+		}
+
+		result = &LDAPUsersOffsetPageDTO{
+			TotalCount: len(users),
+			Users:      newLDAPUserSummaryDTOs(users[start:end]),
+			Page:       page,
+			PerPage:    perPage,
+		}
+	}
+
+	resp := JSON(http.StatusOK, result)
+	if truncatedResults {
+		resp.Header(ldapTruncatedResultsHeader, "true")
+	}
+
+	return resp
+}
+
+// getLDAPUsersPage lists a page of the users with the paged results control of the LDAP servers.
+// Unlike offsets, the cursors neither repeat nor skip users when the directory changes between the pages.
+// A page can hold fewer users than the limit, the listing is over once the next cursor is empty.
+func getLDAPUsersPage(c *models.ReqContext, ldapConfig *ldap.Config) Response {
+	var cursor *multildap.UsersCursor
+	if encoded := c.Query("cursor"); encoded != "" {
+		var err error
+		if cursor, err = multildap.DecodeUsersCursor(encoded); err != nil {
+			return Error(http.StatusBadRequest, "Invalid cursor", err)
+		}
+	}
+
+	limit := c.QueryInt("limit")
+	if limit <= 0 {
+		limit = defaultLDAPUsersLimit
+	}
+
+	if limit > maxLDAPUsersLimit {
+		limit = maxLDAPUsersLimit
+	}
+
+	ldapServer := newLDAP(ldapConfig.Servers)
+	defer ldapServer.Close()
+
+	users, next, err := ldapServer.UsersPage(cursor, limit)
+	if err == multildap.ErrInvalidCursor {
+		return Error(http.StatusBadRequest, "Invalid cursor", err)
+	}
+
+	if err != nil {
+		return Error(http.StatusBadRequest, "Failed to list the users from the LDAP server(s)", err)
+	}
+
+	result := &LDAPUsersCursorPageDTO{Users: newLDAPUserSummaryDTOs(users)}
+	if next != nil {
+		result.NextCursor = next.Encode()
+	}
+
+	return JSON(http.StatusOK, result)
+}
+
+// streamLDAPUsersCSV exports all the users as CSV, page by page with the paged results control of the LDAP servers,
+// so the whole set is never held in memory. The first page is listed before answering, a failure to list it is
+// still answered with an error, while a failure to list a later page can only end the export early, and is logged.
+func streamLDAPUsersCSV(ldapConfig *ldap.Config) Response {
+	ldapServer := newLDAP(ldapConfig.Servers)
+
+	users, next, err := ldapServer.UsersPage(nil, ldapUsersCSVPageSize)
+	if err != nil {
+		ldapServer.Close()
+		return Error(http.StatusBadRequest, "Failed to list the users from the LDAP server(s)", err)
+	}
+
+	return Stream(http.StatusOK, "text/csv; charset=utf-8", func(w io.Writer) error {
+		defer ldapServer.Close()
+
+		writer := csv.NewWriter(w)
+		if err := writer.Write(ldapUsersCSVHeader); err != nil {
+			return err
+		}
+
+		for {
+			if err := writeLDAPUsersCSV(writer, users); err != nil {
+				return err
+			}
+
+			if next == nil {
+				return nil
+			}
+
+			if users, next, err = ldapServer.UsersPage(next, ldapUsersCSVPageSize); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+func newLDAPUserSummaryDTOs(users []*models.ExternalUserInfo) []*LDAPUserSummaryDTO {
+	result := []*LDAPUserSummaryDTO{}
+	for _, user := range users {
+		result = append(result, &LDAPUserSummaryDTO{
+			Login:          user.Login,
+			Name:           user.Name,
+			Email:          user.Email,
+			IsGrafanaAdmin: user.IsGrafanaAdmin,
+			IsDisabled:     user.IsDisabled,
+			OrgRoles:       user.OrgRoles,
+		})
+	}
+
+	return result
+}
+
+// wantsCSV checks if the client asked for a CSV response
+func wantsCSV(c *models.ReqContext) bool {
+	if c.Query("format") == "csv" {
+		return true
+	}
+
+	return strings.Contains(c.Req.Header.Get("Accept"), "text/csv")
+}
+
+// writeLDAPUsersCSV writes the users as CSV rows, and flushes them to the client
+func writeLDAPUsersCSV(writer *csv.Writer, users []*models.ExternalUserInfo) error {
+	for _, user := range users {
+		isGrafanaAdmin := user.IsGrafanaAdmin != nil && *user.IsGrafanaAdmin
+
+		err := writer.Write([]string{
+			escapeCSVFormula(user.Login),
+			escapeCSVFormula(user.Name),
+			escapeCSVFormula(user.Email),
+			strconv.FormatBool(isGrafanaAdmin),
+			strconv.FormatBool(user.IsDisabled),
+			flattenOrgRoles(user.OrgRoles),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// escapeCSVFormula prefixes the values a spreadsheet would run as a formula with a quote, so they are read as text,
+// i.e. a name such as "=HYPERLINK(...)" set by whoever can edit its LDAP entry
+func escapeCSVFormula(value string) string {
+	if value != "" && strings.ContainsRune(csvFormulaPrefixes, rune(value[0])) {
+		return "'" + value
+	}
+
+	return value
+}
+
+// flattenOrgRoles serializes the org roles into a single column, i.e. "1:Admin;2:Viewer"
+func flattenOrgRoles(orgRoles map[int64]models.RoleType) string {
+	orgIds := []int64{}
+	for orgId := range orgRoles {
+		orgIds = append(orgIds, orgId)
+	}
+
+	sort.Slice(orgIds, func(i, j int) bool { return orgIds[i] < orgIds[j] })
+
+	roles := []string{}
+	for _, orgId := range orgIds {
+		roles = append(roles, fmt.Sprintf("%d:%s", orgId, orgRoles[orgId]))
+	}
+
+	return strings.Join(roles, ";")
+}
@@ -0,0 +1,266 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//***
+// GetAllUsersFromLDAP tests
+//***
+
+func getAllUsersFromLDAPContext(t *testing.T, requestURL string, header http.Header) *scenarioContext {
+	t.Helper()
+
+	sc := setupScenarioContext(requestURL)
+
+	ldap := setting.LDAPEnabled
+	setting.LDAPEnabled = true
+	defer func() { setting.LDAPEnabled = ldap }()
+
+	hs := &HTTPServer{Cfg: setting.NewCfg()}
+
+	sc.defaultHandler = Wrap(func(c *models.ReqContext) Response {
+		sc.context = c
+		return hs.GetAllUsersFromLDAP(c)
+	})
+
+	sc.m.Get("/api/admin/ldap/users", sc.defaultHandler)
+
+	sc.resp = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, requestURL, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	sc.req = req
+	sc.exec()
+
+	return sc
+}
+
+func setupAllUsersFromLDAP() {
+	isAdmin := true
+	allUsersResult = []*models.ExternalUserInfo{
+		{
+			Name:           `John "Johnny" Doe, Jr.`,
+			Email:          "john.doe@example.com",
+			Login:          "johndoe",
+			OrgRoles:       map[int64]models.RoleType{2: models.ROLE_VIEWER, 1: models.ROLE_ADMIN},
+			IsGrafanaAdmin: &isAdmin,
+		},
+		{
+			Name:       "Jane Doe",
+			Email:      "jane.doe@example.com",
+			Login:      "janedoe",
+			OrgRoles:   map[int64]models.RoleType{},
+			IsDisabled: true,
+		},
+	}
+
+	getLDAPConfig = func() (*ldap.Config, error) {
+		return &ldap.Config{}, nil
+	}
+
+	newLDAP = func(_ []*ldap.ServerConfig) multildap.IMultiLDAP {
+		return &LDAPMock{}
+	}
+}
+
+func TestGetAllUsersFromLDAPApiEndpoint_JSON(t *testing.T) {
+	setupAllUsersFromLDAP()
+
+	sc := getAllUsersFromLDAPContext(t, "/api/admin/ldap/users", nil)
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+	assert.Equal(t, "application/json", sc.resp.Header().Get("Content-Type"))
+
+	jsonResponse, err := getJSONbody(sc.resp)
+	require.Nil(t, err)
+
+	users := jsonResponse.([]interface{})
+	require.Len(t, users, 2)
+	assert.Equal(t, "johndoe", users[0].(map[string]interface{})["login"])
+}
+
+func TestGetAllUsersFromLDAPApiEndpoint_TruncatedResults(t *testing.T) {
+	setupAllUsersFromLDAP()
+	defer func() { allUsersTruncated = false }()
+
+	sc := getAllUsersFromLDAPContext(t, "/api/admin/ldap/users", nil)
+
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+	assert.Empty(t, sc.resp.Header().Get("X-LDAP-Truncated-Results"))
+
+	allUsersTruncated = true
+
+	for _, url := range []string{"/api/admin/ldap/users", "/api/admin/ldap/users?format=csv&query=j*"} {
+		sc := getAllUsersFromLDAPContext(t, url, nil)
+
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+		assert.Equal(t, "true", sc.resp.Header().Get("X-LDAP-Truncated-Results"))
+		assert.Contains(t, sc.resp.Body.String(), "johndoe")
+	}
+}
+
+func TestGetAllUsersFromLDAPApiEndpoint_CSV(t *testing.T) {
+	setupAllUsersFromLDAP()
+
+	for _, tc := range []struct {
+		desc   string
+		url    string
+		header http.Header
+	}{
+		{desc: "format query parameter", url: "/api/admin/ldap/users?format=csv"},
+		{desc: "accept header", url: "/api/admin/ldap/users", header: http.Header{"Accept": {"text/csv"}}},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			sc := getAllUsersFromLDAPContext(t, tc.url, tc.header)
+
+			require.Equal(t, http.StatusOK, sc.resp.Code)
+			assert.Equal(t, "text/csv; charset=utf-8", sc.resp.Header().Get("Content-Type"))
+			assert.Contains(t, sc.resp.Body.String(), `"John ""Johnny"" Doe, Jr."`)
+
+			records, err := csv.NewReader(strings.NewReader(sc.resp.Body.String())).ReadAll()
+			require.Nil(t, err)
+
+			assert.Equal(t, [][]string{
+				{"login", "name", "email", "grafana_admin", "disabled", "roles"},
+				{"johndoe", `John "Johnny" Doe, Jr.`, "john.doe@example.com", "true", "false", "1:Admin;2:Viewer"},
+				{"janedoe", "Jane Doe", "jane.doe@example.com", "false", "true", ""},
+			}, records)
+		})
+	}
+}
+
+func TestGetAllUsersFromLDAPApiEndpoint_CSVPages(t *testing.T) {
+	setupAllUsersFromLDAP()
+
+	ldapUsersCSVPageSize = 1
+	defer func() { ldapUsersCSVPageSize = maxLDAPUsersLimit }()
+
+	sc := getAllUsersFromLDAPContext(t, "/api/admin/ldap/users?format=csv", nil)
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+
+	records, err := csv.NewReader(strings.NewReader(sc.resp.Body.String())).ReadAll()
+	require.Nil(t, err)
+
+	require.Len(t, records, 3)
+	assert.Equal(t, "johndoe", records[1][0])
+	assert.Equal(t, "janedoe", records[2][0])
+}
+
+func TestGetAllUsersFromLDAPApiEndpoint_CSVFormulas(t *testing.T) {
+	setupAllUsersFromLDAP()
+
+	allUsersResult = []*models.ExternalUserInfo{
+		{Login: "=cmd", Name: "+SUM(A1:A2)", Email: "@evil", OrgRoles: map[int64]models.RoleType{}},
+		{Login: "-jane", Name: "Jane - Doe", Email: "jane@example.com", OrgRoles: map[int64]models.RoleType{}},
+		{Login: "tab", Name: "\t=HYPERLINK(\"http://evil\", \"Doe, Jr.\")", Email: "\r=cmd", OrgRoles: map[int64]models.RoleType{}},
+	}
+
+	sc := getAllUsersFromLDAPContext(t, "/api/admin/ldap/users?format=csv", nil)
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+
+	records, err := csv.NewReader(strings.NewReader(sc.resp.Body.String())).ReadAll()
+	require.Nil(t, err)
+
+	require.Len(t, records, 4)
+	assert.Equal(t, []string{"'=cmd", "'+SUM(A1:A2)", "'@evil"}, records[1][:3])
+	assert.Equal(t, []string{"'-jane", "Jane - Doe", "jane@example.com"}, records[2][:3])
+	assert.Equal(t, []string{"tab", "'\t=HYPERLINK(\"http://evil\", \"Doe, Jr.\")", "'\r=cmd"}, records[3][:3])
+}
+
+func TestGetAllUsersFromLDAPApiEndpoint_Cursor(t *testing.T) {
+	setupAllUsersFromLDAP()
+
+	logins := []string{}
+	url := "/api/admin/ldap/users?limit=1"
+	pages := 0
+
+	for url != "" {
+		sc := getAllUsersFromLDAPContext(t, url, nil)
+		require.Equal(t, http.StatusOK, sc.resp.Code)
+
+		page := LDAPUsersCursorPageDTO{}
+		require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &page))
+		require.Len(t, page.Users, 1)
+
+		pages++
+		for _, user := range page.Users {
+			logins = append(logins, user.Login)
+		}
+
+		url = ""
+		if page.NextCursor != "" {
+			url = "/api/admin/ldap/users?limit=1&cursor=" + page.NextCursor
+		}
+	}
+
+	assert.Equal(t, 2, pages)
+	assert.Equal(t, []string{"johndoe", "janedoe"}, logins)
+}
+
+func TestGetAllUsersFromLDAPApiEndpoint_InvalidCursor(t *testing.T) {
+	setupAllUsersFromLDAP()
+
+	cursor := (&multildap.UsersCursor{Cookie: []byte("10")}).Encode()
+
+	for _, url := range []string{"/api/admin/ldap/users?cursor=not-a-cursor", "/api/admin/ldap/users?cursor=" + cursor} {
+		sc := getAllUsersFromLDAPContext(t, url, nil)
+
+		require.Equal(t, http.StatusBadRequest, sc.resp.Code)
+		assert.Contains(t, sc.resp.Body.String(), "Invalid cursor")
+	}
+}
+
+func TestGetAllUsersFromLDAPApiEndpoint_Offset(t *testing.T) {
+	setupAllUsersFromLDAP()
+
+	sc := getAllUsersFromLDAPContext(t, "/api/admin/ldap/users?perpage=1&page=2", nil)
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+
+	page := LDAPUsersOffsetPageDTO{}
+	require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &page))
+
+	assert.Equal(t, 2, page.TotalCount)
+	assert.Equal(t, 2, page.Page)
+	assert.Equal(t, 1, page.PerPage)
+	require.Len(t, page.Users, 1)
+	assert.Equal(t, "janedoe", page.Users[0].Login)
+}
+
+func TestGetAllUsersFromLDAPApiEndpoint_Query(t *testing.T) {
+	setupAllUsersFromLDAP()
+	defer func() { matchingUsersQuery = "" }()
+
+	sc := getAllUsersFromLDAPContext(t, "/api/admin/ldap/users?query=jo*&perpage=10", nil)
+	require.Equal(t, http.StatusOK, sc.resp.Code)
+
+	page := LDAPUsersOffsetPageDTO{}
+	require.Nil(t, json.Unmarshal(sc.resp.Body.Bytes(), &page))
+
+	assert.Equal(t, "jo*", matchingUsersQuery)
+	assert.Equal(t, 1, page.TotalCount)
+	require.Len(t, page.Users, 1)
+	assert.Equal(t, "johndoe", page.Users[0].Login)
+	assert.Equal(t, models.ROLE_ADMIN, page.Users[0].OrgRoles[1])
+}
+
+func TestGetAllUsersFromLDAPApiEndpoint_QueryWithCursor(t *testing.T) {
+	setupAllUsersFromLDAP()
+
+	sc := getAllUsersFromLDAPContext(t, "/api/admin/ldap/users?query=jo*&limit=1", nil)
+
+	assert.Equal(t, http.StatusBadRequest, sc.resp.Code)
+}
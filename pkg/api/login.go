@@ -126,6 +126,10 @@ func (hs *HTTPServer) LoginPost(c *models.ReqContext, cmd dtos.LoginCommand) Res
 			return e401
 		}
 
+		if err == login.ErrLDAPUnreachable {
+			return Error(503, "Authentication service is unavailable", err)
+		}
+
 		return Error(500, "Error while trying to authenticate user", err)
 	}
 
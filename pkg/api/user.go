@@ -1,6 +1,8 @@
 package api
 
 import (
+	"fmt"
+
 	"github.com/grafana/grafana/pkg/api/dtos"
 	"github.com/grafana/grafana/pkg/bus"
 	m "github.com/grafana/grafana/pkg/models"
@@ -34,6 +36,15 @@ func getUserUserProfile(userID int64) Response {
 		authLabel := GetAuthProviderLabel(getAuthQuery.Result.AuthModule)
 		query.Result.AuthLabels = append(query.Result.AuthLabels, authLabel)
 		query.Result.IsExternal = true
+		query.Result.LockedFields = getAuthQuery.Result.GetLockedFields()
+
+		if syncedAt := getAuthQuery.Result.LastSyncedAt; !syncedAt.IsZero() {
+			query.Result.LastSyncedAt = &syncedAt
+		}
+
+		if metadata := getAuthQuery.Result.GetMetadata(); len(metadata) > 0 {
+			query.Result.Metadata = metadata
+		}
 	}
 
 	return JSON(200, query.Result)
@@ -71,6 +82,24 @@ func UpdateSignedInUser(c *m.ReqContext, cmd m.UpdateUserCommand) Response {
 			return Error(400, "Not allowed to change username when auth proxy is using username property", nil)
 		}
 	}
+
+	// the fields locked by the auth module are overwritten by its next sync
+	getAuthQuery := m.GetAuthInfoQuery{UserId: c.UserId}
+	if err := bus.Dispatch(&getAuthQuery); err == nil {
+		authInfo := getAuthQuery.Result
+		authLabel := GetAuthProviderLabel(authInfo.AuthModule)
+
+		if authInfo.IsLocked(m.UserFieldLogin) && cmd.Login != c.Login {
+			return Error(400, fmt.Sprintf("Not allowed to change username, it is managed by %s", authLabel), nil)
+		}
+		if authInfo.IsLocked(m.UserFieldEmail) && cmd.Email != c.Email {
+			return Error(400, fmt.Sprintf("Not allowed to change email, it is managed by %s", authLabel), nil)
+		}
+		if authInfo.IsLocked(m.UserFieldName) && cmd.Name != c.Name {
+			return Error(400, fmt.Sprintf("Not allowed to change name, it is managed by %s", authLabel), nil)
+		}
+	}
+
 	cmd.UserId = c.UserId
 	return handleUpdateUser(cmd)
 }
@@ -2,6 +2,7 @@ package api
 
 import (
 	"testing"
+	"time"
 
 	"github.com/grafana/grafana/pkg/models"
 
@@ -107,3 +108,79 @@ func TestUserApiEndpoint(t *testing.T) {
 		})
 	})
 }
+
+func TestUpdateSignedInUserLockedFields(t *testing.T) {
+	Convey("Given a user synced from LDAP with locked fields", t, func() {
+		defer bus.ClearBusHandlers()
+
+		updated := false
+		bus.AddHandler("test", func(query *models.GetAuthInfoQuery) error {
+			query.Result = &models.UserAuth{UserId: 1, AuthModule: models.AuthModuleLDAP, LockedFields: "email,name"}
+			return nil
+		})
+		bus.AddHandler("test", func(cmd *models.UpdateUserCommand) error {
+			updated = true
+			return nil
+		})
+		bus.AddHandler("test", func(query *models.GetUserProfileQuery) error {
+			query.Result = models.UserProfileDTO{Id: 1, Login: "jdoe"}
+			return nil
+		})
+
+		c := &models.ReqContext{
+			SignedInUser: &models.SignedInUser{UserId: 1, Login: "jdoe", Email: "jdoe@example.org", Name: "John Doe"},
+		}
+
+		Convey("Should not allow changing a locked field", func() {
+			resp := UpdateSignedInUser(c, models.UpdateUserCommand{Login: "jdoe", Email: "john@example.org", Name: "John Doe"})
+
+			So(resp.(*NormalResponse).status, ShouldEqual, 400)
+			So(string(resp.(*NormalResponse).body), ShouldContainSubstring, "Not allowed to change email, it is managed by LDAP")
+			So(updated, ShouldBeFalse)
+		})
+
+		Convey("Should allow changing the fields which aren't locked", func() {
+			resp := UpdateSignedInUser(c, models.UpdateUserCommand{Login: "johndoe", Email: "jdoe@example.org", Name: "John Doe"})
+
+			So(resp.(*NormalResponse).status, ShouldEqual, 200)
+			So(updated, ShouldBeTrue)
+		})
+
+		Convey("Should report the locked fields in the profile", func() {
+			resp := getUserUserProfile(1)
+
+			respJSON, err := simplejson.NewJson(resp.(*NormalResponse).body)
+			So(err, ShouldBeNil)
+			So(respJSON.Get("isExternal").MustBool(), ShouldBeTrue)
+			So(respJSON.Get("lockedFields").MustStringArray(), ShouldResemble, []string{"email", "name"})
+			So(respJSON.Get("lastSyncedAt").Interface(), ShouldBeNil)
+		})
+
+		Convey("Should report the last sync in the profile", func() {
+			bus.AddHandler("test", func(query *models.GetAuthInfoQuery) error {
+				syncedAt := time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)
+				query.Result = &models.UserAuth{UserId: 1, AuthModule: models.AuthModuleLDAP, LastSyncedAt: syncedAt}
+				return nil
+			})
+
+			resp := getUserUserProfile(1)
+
+			respJSON, err := simplejson.NewJson(resp.(*NormalResponse).body)
+			So(err, ShouldBeNil)
+			So(respJSON.Get("lastSyncedAt").MustString(), ShouldEqual, "2019-10-01T12:00:00Z")
+		})
+
+		Convey("Should report the metadata in the profile", func() {
+			bus.AddHandler("test", func(query *models.GetAuthInfoQuery) error {
+				query.Result = &models.UserAuth{UserId: 1, AuthModule: models.AuthModuleLDAP, Metadata: `{"department":"Engineering"}`}
+				return nil
+			})
+
+			resp := getUserUserProfile(1)
+
+			respJSON, err := simplejson.NewJson(resp.(*NormalResponse).body)
+			So(err, ShouldBeNil)
+			So(respJSON.Get("metadata").MustMap(), ShouldResemble, map[string]interface{}{"department": "Engineering"})
+		})
+	})
+}
@@ -17,6 +17,7 @@ var (
 	ErrTooManyLoginAttempts  = errors.New("Too many consecutive incorrect login attempts for user. Login for user temporarily blocked")
 	ErrPasswordEmpty         = errors.New("No password provided")
 	ErrUserDisabled          = errors.New("User is disabled")
+	ErrLDAPUnreachable       = errors.New("None of the LDAP servers are reachable")
 )
 
 func Init() {
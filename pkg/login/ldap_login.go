@@ -40,17 +40,22 @@ var loginUsingLDAP = func(query *models.LoginUserQuery) (bool, error) {
 	if err != nil {
 		if err == ldap.ErrCouldNotFindUser {
 			// Ignore the error since user might not be present anyway
-			disableExternalUser(query.Username)
+			DisableExternalUser(query.Username, models.LDAPSyncSourceLogin)
 
 			return true, ldap.ErrInvalidCredentials
 		}
 
+		if err == multildap.ErrUnreachable {
+			return onUnreachableLDAP(query)
+		}
+
 		return true, err
 	}
 
 	upsert := &models.UpsertUserCommand{
-		ExternalUser:  externalUser,
-		SignupAllowed: setting.LDAPAllowSignup,
+		ExternalUser:   externalUser,
+		SignupAllowed:  setting.LDAPAllowSignup,
+		LDAPSyncSource: models.LDAPSyncSourceLogin,
 	}
 	err = bus.Dispatch(upsert)
 	if err != nil {
@@ -61,8 +66,28 @@ var loginUsingLDAP = func(query *models.LoginUserQuery) (bool, error) {
 	return true, nil
 }
 
-// disableExternalUser marks external user as disabled in Grafana db
-func disableExternalUser(username string) error {
+// onUnreachableLDAP applies the configured policy for the login when none of the LDAP servers are reachable
+func onUnreachableLDAP(query *models.LoginUserQuery) (bool, error) {
+	if setting.LDAPOnUnreachable == setting.LDAPOnUnreachableFallthrough {
+		logger.Warn(
+			"None of the LDAP servers are reachable, falling through to the other authentication methods",
+			"username", query.Username,
+		)
+
+		return false, nil
+	}
+
+	logger.Error(
+		"None of the LDAP servers are reachable, denying the login",
+		"username", query.Username,
+	)
+
+	return true, ErrLDAPUnreachable
+}
+
+// DisableExternalUser marks external user as disabled in Grafana db,
+// and records it in the audit trail of the LDAP syncs with the source of the sync
+func DisableExternalUser(username string, source string) error {
 	// Check if external user exist in Grafana
 	userQuery := &models.GetExternalUserInfoByLoginQuery{
 		LoginOrEmail: username,
@@ -97,6 +122,28 @@ func disableExternalUser(username string) error {
 			)
 			return err
 		}
+
+		recordDisabledUser(userInfo, source)
 	}
 	return nil
 }
+
+// recordDisabledUser records the disabled user in the audit trail of the LDAP syncs,
+// a failure is only logged since the user is already disabled
+func recordDisabledUser(userInfo *models.ExternalUserInfo, source string) {
+	cmd := &models.AddLDAPSyncAuditEntriesCommand{
+		Entries: []*models.LDAPSyncAuditEntry{{
+			UserId:        userInfo.UserId,
+			Login:         userInfo.Login,
+			Source:        source,
+			Action:        models.LDAPSyncAuditDisable,
+			PreviousValue: "enabled",
+			NewValue:      "disabled",
+			Reason:        "Not found in LDAP",
+		}},
+	}
+
+	if err := bus.Dispatch(cmd); err != nil {
+		logger.Warn("Failed to record the disabled user in the LDAP sync audit", "user", userInfo.Login, "error", err)
+	}
+}
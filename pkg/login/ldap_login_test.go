@@ -3,6 +3,7 @@ package login
 import (
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/services/ldap"
@@ -44,6 +45,38 @@ func TestLDAPLogin(t *testing.T) {
 			})
 		})
 
+		Convey("Given none of the LDAP servers are reachable", func() {
+			setting.LDAPEnabled = true
+			defer func() { setting.LDAPOnUnreachable = setting.LDAPOnUnreachableDeny }()
+
+			LDAPLoginScenario("When login with the deny policy", func(sc *LDAPLoginScenarioContext) {
+				setting.LDAPOnUnreachable = setting.LDAPOnUnreachableDeny
+				sc.LDAPAuthenticatorMock.loginErr = multildap.ErrUnreachable
+
+				enabled, err := loginUsingLDAP(sc.loginUserQuery)
+
+				Convey("it should return true", func() {
+					So(enabled, ShouldBeTrue)
+				})
+
+				Convey("it should deny the login", func() {
+					So(err, ShouldEqual, ErrLDAPUnreachable)
+				})
+			})
+
+			LDAPLoginScenario("When login with the fallthrough policy", func(sc *LDAPLoginScenarioContext) {
+				setting.LDAPOnUnreachable = setting.LDAPOnUnreachableFallthrough
+				sc.LDAPAuthenticatorMock.loginErr = multildap.ErrUnreachable
+
+				enabled, err := loginUsingLDAP(sc.loginUserQuery)
+
+				Convey("it should fall through to the other authentication methods", func() {
+					So(enabled, ShouldBeFalse)
+					So(err, ShouldBeNil)
+				})
+			})
+		})
+
 		Convey("Given ldap disabled", func() {
 			setting.LDAPEnabled = false
 
@@ -74,6 +107,7 @@ type mockAuth struct {
 	validLogin  bool
 	loginCalled bool
 	pingCalled  bool
+	loginErr    error
 }
 
 func (auth *mockAuth) Ping() ([]*multildap.ServerStatus, error) {
@@ -88,6 +122,10 @@ func (auth *mockAuth) Login(query *models.LoginUserQuery) (
 ) {
 	auth.loginCalled = true
 
+	if auth.loginErr != nil {
+		return nil, auth.loginErr
+	}
+
 	if !auth.validLogin {
 		return nil, errTest
 	}
@@ -95,6 +133,16 @@ func (auth *mockAuth) Login(query *models.LoginUserQuery) (
 	return nil, nil
 }
 
+func (auth *mockAuth) LoginWithTrace(query *models.LoginUserQuery) (
+	*models.ExternalUserInfo,
+	ldap.ServerConfig,
+	*ldap.Trace,
+	error,
+) {
+	user, err := auth.Login(query)
+	return user, ldap.ServerConfig{}, ldap.NewTrace(), err
+}
+
 func (auth *mockAuth) Users(logins []string) (
 	[]*models.ExternalUserInfo,
 	error,
@@ -110,6 +158,92 @@ func (auth *mockAuth) User(login string) (
 	return nil, ldap.ServerConfig{}, nil
 }
 
+func (auth *mockAuth) UserWithTimings(login string) (
+	*models.ExternalUserInfo,
+	ldap.ServerConfig,
+	*multildap.Timings,
+	error,
+) {
+	return nil, ldap.ServerConfig{}, &multildap.Timings{}, nil
+}
+
+func (auth *mockAuth) UserWithAttempts(login string) (
+	*models.ExternalUserInfo,
+	ldap.ServerConfig,
+	[]*multildap.ServerAttempt,
+	error,
+) {
+	return nil, ldap.ServerConfig{}, []*multildap.ServerAttempt{}, nil
+}
+
+func (auth *mockAuth) CachedUser(login string) *multildap.CachedUser {
+	return nil
+}
+
+func (auth *mockAuth) AllUsers() (
+	[]*models.ExternalUserInfo,
+	bool,
+	error,
+) {
+	return nil, false, nil
+}
+
+func (auth *mockAuth) MatchingUsers(query string) (
+	[]*models.ExternalUserInfo,
+	bool,
+	error,
+) {
+	return nil, false, nil
+}
+
+func (auth *mockAuth) UsersPage(cursor *multildap.UsersCursor, limit int) (
+	[]*models.ExternalUserInfo,
+	*multildap.UsersCursor,
+	error,
+) {
+	return nil, nil, nil
+}
+
+func (auth *mockAuth) UserPhoto(login string) ([]byte, error) {
+	return nil, nil
+}
+
+func (auth *mockAuth) UserAttributes(login string) (map[string][]string, error) {
+	return nil, nil
+}
+
+func (auth *mockAuth) ModifiedUsers(since time.Time) (
+	[]*models.ExternalUserInfo,
+	bool,
+	error,
+) {
+	return nil, false, nil
+}
+
+func (auth *mockAuth) ChangedUsers(markers map[string]string) (
+	[]*models.ExternalUserInfo,
+	map[string]string,
+	bool,
+	error,
+) {
+	return nil, nil, false, nil
+}
+
+func (auth *mockAuth) DanglingGroupMappings() ([]*multildap.GroupMappingsCheck, error) {
+	return nil, nil
+}
+
+func (auth *mockAuth) FindGroup(dn string) ([]*multildap.GroupLookup, error) {
+	return nil, nil
+}
+
+func (auth *mockAuth) Search(host, baseDN, filter string, attributes []string, sizeLimit int) (*multildap.SearchResult, error) {
+	return nil, nil
+}
+
+func (auth *mockAuth) Close() {
+}
+
 func (auth *mockAuth) Add(dn string, values map[string][]string) error {
 	return nil
 }
@@ -28,6 +28,7 @@ var (
 	ErrDashboardPermissionDashboardEmpty = errors.New("Dashboard Id must be greater than zero for a dashboard permission")
 	ErrFolderAclInfoMissing              = errors.New("User id and team id cannot both be empty for a folder permission")
 	ErrFolderPermissionFolderEmpty       = errors.New("Folder Id must be greater than zero for a folder permission")
+	ErrDashboardAclManualPermission      = errors.New("The user has a manual permission on the dashboard, it isn't replaced by an external one")
 )
 
 // Dashboard ACL model
@@ -41,6 +42,9 @@ type DashboardAcl struct {
 	Role       *RoleType // pointer to be nullable
 	Permission PermissionType
 
+	// External marks the permissions of the users synced from an external auth provider, like LDAP
+	External bool
+
 	Created time.Time
 	Updated time.Time
 }
@@ -70,6 +74,7 @@ type DashboardAclInfoDTO struct {
 	IsFolder       bool           `json:"isFolder"`
 	Url            string         `json:"url"`
 	Inherited      bool           `json:"inherited"`
+	External       bool           `json:"external"`
 }
 
 func (dto *DashboardAclInfoDTO) hasSameRoleAs(other *DashboardAclInfoDTO) bool {
@@ -102,6 +107,16 @@ type UpdateDashboardAclCommand struct {
 	Items       []*DashboardAcl
 }
 
+// SetExternalDashboardAclCommand sets the external permission of the user on the dashboard, or removes it when the
+// permission is 0, the other permissions of the dashboard are kept. It fails with ErrDashboardAclManualPermission
+// when the user has a manual permission on the dashboard.
+type SetExternalDashboardAclCommand struct {
+	OrgId       int64
+	DashboardId int64
+	UserId      int64
+	Permission  PermissionType
+}
+
 //
 // QUERIES
 //
@@ -110,3 +125,9 @@ type GetDashboardAclInfoListQuery struct {
 	OrgId       int64
 	Result      []*DashboardAclInfoDTO
 }
+
+// GetUserExternalAclQuery lists the external permissions of the user, see DashboardAcl.External
+type GetUserExternalAclQuery struct {
+	UserId int64
+	Result []*DashboardAcl
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrLDAPSettingsNotFound = errors.New("LDAP settings not found")
+)
+
+// LDAPSettings is the LDAP config stored in the database, which replaces the config file.
+// The config is in the TOML format of the config file, it's encrypted in the database since it holds the bind passwords.
+type LDAPSettings struct {
+	Id        int64
+	Config    string
+	Version   int64
+	Created   time.Time
+	Updated   time.Time
+	UpdatedBy int64
+}
+
+func (settings LDAPSettings) TableName() string {
+	return "ldap_settings"
+}
+
+// ---------------------
+// QUERIES
+
+type GetLDAPSettingsQuery struct {
+	Result *LDAPSettings
+}
+
+// ----------------------
+// COMMANDS
+
+// SaveLDAPSettingsCommand stores the LDAP config, replacing the stored one if any
+type SaveLDAPSettingsCommand struct {
+	Config string
+	UserId int64
+
+	Result *LDAPSettings
+}
+
+// DeleteLDAPSettingsCommand deletes the stored LDAP config, the config file is used again
+type DeleteLDAPSettingsCommand struct{}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+)
+
+// Sources of the LDAP syncs recorded in the audit trail
+const (
+	// LDAPSyncSourceLogin is the sync of the user when it logs in
+	LDAPSyncSourceLogin = "login"
+
+	// LDAPSyncSourceSync is the sync of the user by the sync endpoints or the scheduled sync
+	LDAPSyncSourceSync = "sync"
+)
+
+// Actions of the LDAP syncs recorded in the audit trail
+const (
+	LDAPSyncAuditDisable     = "disable"
+	LDAPSyncAuditEnable      = "enable"
+	LDAPSyncAuditRoleChange  = "role_change"
+	LDAPSyncAuditAdminChange = "admin_change"
+)
+
+// LDAPSyncAuditEntry records a change the LDAP sync made to a user, with the values before and after it.
+// The role changes are per organization, a role added or removed has an empty previous or new value.
+type LDAPSyncAuditEntry struct {
+	Id            int64
+	UserId        int64
+	Login         string
+	Source        string
+	Action        string
+	OrgId         int64
+	PreviousValue string
+	NewValue      string
+	Reason        string
+	Created       time.Time
+}
+
+func (entry LDAPSyncAuditEntry) TableName() string {
+	return "ldap_sync_audit"
+}
+
+// ---------------------
+// QUERIES
+
+// SearchLDAPSyncAuditQuery searches the audit trail of the LDAP syncs, the most recent entries first.
+// The empty filters match every entry.
+type SearchLDAPSyncAuditQuery struct {
+	UserId int64
+	Login  string
+	Action string
+	Page   int
+	Limit  int
+
+	Result SearchLDAPSyncAuditResult
+}
+
+type SearchLDAPSyncAuditResult struct {
+	TotalCount int64
+	Entries    []*LDAPSyncAuditEntry
+}
+
+// ----------------------
+// COMMANDS
+
+// AddLDAPSyncAuditEntriesCommand records the changes made by a LDAP sync in the audit trail
+type AddLDAPSyncAuditEntriesCommand struct {
+	Entries []*LDAPSyncAuditEntry
+}
@@ -225,6 +225,13 @@ type UserProfileDTO struct {
 	IsDisabled     bool     `json:"isDisabled"`
 	IsExternal     bool     `json:"isExternal"`
 	AuthLabels     []string `json:"authLabels"`
+	LockedFields   []string `json:"lockedFields,omitempty"`
+
+	// LastSyncedAt is the time of the last successful sync of an external user, not reported before the first one
+	LastSyncedAt *time.Time `json:"lastSyncedAt,omitempty"`
+
+	// Metadata are the values of the attributes of an external user mapped by its auth module, like its department
+	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
 type UserSearchHitDTO struct {
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"encoding/json"
+	"strings"
 	"time"
 
 	"golang.org/x/oauth2"
@@ -10,6 +12,13 @@ const (
 	AuthModuleLDAP = "ldap"
 )
 
+// The fields of a user an auth module can lock, as they're overwritten by every sync
+const (
+	UserFieldLogin = "login"
+	UserFieldEmail = "email"
+	UserFieldName  = "name"
+)
+
 type UserAuth struct {
 	Id                int64
 	UserId            int64
@@ -20,6 +29,50 @@ type UserAuth struct {
 	OAuthRefreshToken string
 	OAuthTokenType    string
 	OAuthExpiry       time.Time
+
+	// LockedFields is the comma separated list of the user fields managed by the auth module,
+	// which the user can't edit
+	LockedFields string
+
+	// LastSyncedAt is the time of the last successful sync of the user with the auth module, zero before the first one
+	LastSyncedAt time.Time
+
+	// Metadata is the JSON object of the values of the attributes of the user mapped by the auth module, like its department
+	Metadata string
+}
+
+// GetLockedFields returns the user fields managed by the auth module
+func (auth *UserAuth) GetLockedFields() []string {
+	if auth.LockedFields == "" {
+		return []string{}
+	}
+
+	return strings.Split(auth.LockedFields, ",")
+}
+
+// IsLocked returns true if the user field is managed by the auth module
+func (auth *UserAuth) IsLocked(field string) bool {
+	for _, locked := range auth.GetLockedFields() {
+		if locked == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetMetadata returns the metadata of the user mapped by the auth module, an empty map if there's none
+func (auth *UserAuth) GetMetadata() map[string]string {
+	metadata := map[string]string{}
+	if auth.Metadata == "" {
+		return metadata
+	}
+
+	if err := json.Unmarshal([]byte(auth.Metadata), &metadata); err != nil {
+		return map[string]string{}
+	}
+
+	return metadata
 }
 
 type ExternalUserInfo struct {
@@ -34,6 +87,51 @@ type ExternalUserInfo struct {
 	OrgRoles       map[int64]RoleType
 	IsGrafanaAdmin *bool // This is a pointer to know if we should sync this or not (nil = ignore sync)
 	IsDisabled     bool
+	Teams          []ExternalTeam // nil = ignore sync
+	Phone          string         // only displayed, not synced
+	Title          string         // only displayed, not synced
+	UpdatedAt      time.Time      // last change in the directory, only used to skip the unchanged users on sync
+
+	FolderPermissions []ExternalFolderPermission // nil = ignore sync
+	StaleOrgRole      *RoleType                  // role kept in the orgs left out of OrgRoles, "" = remove, nil = ignore sync when OrgRoles is empty
+	LockedFields      []string                   // user fields the user can't edit, nil = ignore sync
+	RoleOverrides     []ExternalRoleOverride     // only displayed, the OrgRoles are already overridden
+	Metadata          map[string]string          // values of the mapped attributes by their key, nil = ignore sync
+	Preferences       *ExternalPreferences       // preferences set in the orgs of the user, nil = ignore sync
+	GroupSearchFilter string                     // only displayed, the filter of the search of the groups when they're searched
+}
+
+// ExternalPreferences are the preferences of the external user mapped by the auth module, the empty ones are left unchanged
+type ExternalPreferences struct {
+	Theme            string
+	Timezone         string
+	HomeDashboardUID string // resolved in each org of the user, left unchanged in the orgs without this dashboard
+}
+
+// ExternalRoleOverride is an org role of the external user overridden by a rule on its attributes
+type ExternalRoleOverride struct {
+	OrgId        int64
+	Role         RoleType // the role given by the rule
+	OriginalRole RoleType // the role the rule overrode
+	Rule         int      // index of the rule in the config of the server
+	Attribute    string
+	Value        string
+}
+
+// ExternalFolderPermission is a permission the external user should have on a folder
+type ExternalFolderPermission struct {
+	OrgId      int64
+	FolderId   int64
+	Permission PermissionType
+}
+
+// ExternalTeam is a team the external user should be a member of
+type ExternalTeam struct {
+	OrgId           int64
+	TeamId          int64
+	IsDefault       bool // Every user is a member of the default teams, regardless of their groups
+	IsFromAttribute bool // The team is listed by the teams attribute of the external user
+	IsFromGroup     bool // The team is mapped to a group of the external user by the team mappings
 }
 
 // ---------------------
@@ -44,21 +142,35 @@ type UpsertUserCommand struct {
 	ExternalUser  *ExternalUserInfo
 	SignupAllowed bool
 
+	// LDAPSyncSource is recorded in the audit trail of the LDAP syncs, LDAPSyncSourceLogin when empty
+	LDAPSyncSource string
+
 	Result *User
 }
 
 type SetAuthInfoCommand struct {
-	AuthModule string
-	AuthId     string
-	UserId     int64
-	OAuthToken *oauth2.Token
+	AuthModule   string
+	AuthId       string
+	UserId       int64
+	OAuthToken   *oauth2.Token
+	LockedFields []string
+	Metadata     map[string]string
 }
 
 type UpdateAuthInfoCommand struct {
-	AuthModule string
-	AuthId     string
+	AuthModule   string
+	AuthId       string
+	UserId       int64
+	OAuthToken   *oauth2.Token
+	LockedFields []string          // nil = unchanged
+	Metadata     map[string]string // nil = unchanged
+}
+
+// UpdateAuthSyncedAtCommand records the time of the last successful sync of the user with the auth module
+type UpdateAuthSyncedAtCommand struct {
 	UserId     int64
-	OAuthToken *oauth2.Token
+	AuthModule string
+	SyncedAt   time.Time
 }
 
 type DeleteAuthInfoCommand struct {
@@ -101,11 +213,22 @@ type GetAuthInfoQuery struct {
 }
 
 type TeamOrgGroupDTO struct {
-	TeamName string `json:"teamName"`
-	OrgName  string `json:"orgName"`
-	GroupDN  string `json:"groupDN"`
+	TeamName   string `json:"teamName"`
+	OrgId      int64  `json:"orgId,omitempty"`
+	OrgName    string `json:"orgName"`
+	GroupDN    string `json:"groupDN"`
+	Provenance string `json:"provenance,omitempty"`
 }
 
+// TeamProvenanceDefault marks the teams every external user is member of
+const TeamProvenanceDefault = "default"
+
+// TeamProvenanceAttribute marks the teams listed by the teams attribute of the external user
+const TeamProvenanceAttribute = "attribute"
+
+// TeamProvenanceMapping marks the teams mapped to the groups of the external user by the team mappings
+const TeamProvenanceMapping = "mapping"
+
 type GetTeamsForLDAPGroupCommand struct {
 	Groups []string
 	Result []TeamOrgGroupDTO
@@ -0,0 +1,103 @@
+package ldap
+
+import (
+	"strings"
+
+	"gopkg.in/ldap.v3"
+)
+
+// redactedAttributeValue replaces the values of the sensitive attributes returned by the ad hoc searches
+const redactedAttributeValue = "************"
+
+// sensitiveAttributes are the attributes holding passwords or keys, whose values are never returned by the
+// ad hoc searches, keyed by their lowercased name and by their OID, which the servers accept as well
+var sensitiveAttributes = map[string]bool{
+	"userpassword":                   true,
+	"2.5.4.35":                       true,
+	"authpassword":                   true,
+	"1.3.6.1.4.1.4203.1.3.4":         true,
+	"unicodepwd":                     true,
+	"1.2.840.113556.1.4.90":          true,
+	"dbcspwd":                        true,
+	"1.2.840.113556.1.4.55":          true,
+	"ntpwdhistory":                   true,
+	"1.2.840.113556.1.4.94":          true,
+	"lmpwdhistory":                   true,
+	"1.2.840.113556.1.4.160":         true,
+	"supplementalcredentials":        true,
+	"1.2.840.113556.1.4.125":         true,
+	"sambantpassword":                true,
+	"1.3.6.1.4.1.7165.2.1.25":        true,
+	"sambalmpassword":                true,
+	"1.3.6.1.4.1.7165.2.1.24":        true,
+	"krbprincipalkey":                true,
+	"2.16.840.1.113719.1.301.4.27.1": true,
+	"userpkcs12":                     true,
+	"2.16.840.1.113730.3.1.216":      true,
+}
+
+// isSensitiveAttribute checks if the attribute description is one of the sensitiveAttributes,
+// whatever its options, like "userPassword;binary"
+func isSensitiveAttribute(description string) bool {
+	name := strings.SplitN(description, ";", 2)[0]
+
+	return sensitiveAttributes[strings.ToLower(strings.TrimSpace(name))]
+}
+
+// SearchEntry is an entry returned by an ad hoc search, with the values of its attributes by name
+type SearchEntry struct {
+	DN         string              `json:"dn"`
+	Attributes map[string][]string `json:"attributes"`
+}
+
+// Search runs an ad hoc search of the subtree of the base DN, returning at most sizeLimit entries with the attributes,
+// all the attributes of the entries if none. The sensitive attributes, like the passwords, can't be asked for,
+// ErrSensitiveAttribute is returned, and their values are redacted when all the attributes are returned.
+// It also returns true when the entries are truncated by the size limit.
+func (server *Server) Search(baseDN, filter string, attributes []string, sizeLimit int) ([]*SearchEntry, bool, error) {
+	for _, attribute := range attributes {
+		if isSensitiveAttribute(attribute) {
+			return nil, false, ErrSensitiveAttribute
+		}
+	}
+
+	request := &ldap.SearchRequest{
+		BaseDN:       baseDN,
+		Scope:        ldap.ScopeWholeSubtree,
+		DerefAliases: ldap.NeverDerefAliases,
+		SizeLimit:    sizeLimit,
+		Attributes:   attributes,
+		Filter:       filter,
+	}
+
+	result, truncated, err := server.search(request)
+	if err != nil {
+		return nil, false, err
+	}
+
+	entries := []*SearchEntry{}
+	for _, entry := range result.Entries {
+		entries = append(entries, newSearchEntry(entry))
+	}
+
+	return entries, truncated, nil
+}
+
+// newSearchEntry copies the attributes of the entry, redacting the values of the sensitive ones
+func newSearchEntry(entry *ldap.Entry) *SearchEntry {
+	searchEntry := &SearchEntry{DN: entry.DN, Attributes: map[string][]string{}}
+
+	for _, attribute := range entry.Attributes {
+		values := attribute.Values
+		if isSensitiveAttribute(attribute.Name) {
+			values = make([]string, len(values))
+			for i := range values {
+				values[i] = redactedAttributeValue
+			}
+		}
+
+		searchEntry.Attributes[attribute.Name] = values
+	}
+
+	return searchEntry
+}
@@ -0,0 +1,91 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+)
+
+func TestSearch(t *testing.T) {
+	Convey("Search()", t, func() {
+		connection := &MockConnection{
+			SearchResult: &ldap.SearchResult{
+				Entries: []*ldap.Entry{{
+					DN: "uid=johndoe,ou=users,dc=grafana,dc=org",
+					Attributes: []*ldap.EntryAttribute{
+						{Name: "uid", Values: []string{"johndoe"}},
+						{Name: "userPassword", Values: []string{"{SSHA}secret", "{SHA}secret"}},
+					},
+				}},
+			},
+		}
+
+		server := &Server{
+			Config:     &ServerConfig{},
+			Connection: connection,
+			log:        log.New("test-logger"),
+		}
+
+		Convey("Should search the subtree with the size limit", func() {
+			entries, truncated, err := server.Search("dc=grafana,dc=org", "(uid=johndoe)", []string{"uid"}, 10)
+
+			So(err, ShouldBeNil)
+			So(truncated, ShouldBeFalse)
+			So(len(entries), ShouldEqual, 1)
+			So(entries[0].DN, ShouldEqual, "uid=johndoe,ou=users,dc=grafana,dc=org")
+			So(entries[0].Attributes["uid"], ShouldResemble, []string{"johndoe"})
+
+			request := connection.SearchRequests[0]
+			So(request.BaseDN, ShouldEqual, "dc=grafana,dc=org")
+			So(request.Scope, ShouldEqual, ldap.ScopeWholeSubtree)
+			So(request.SizeLimit, ShouldEqual, 10)
+			So(request.Attributes, ShouldResemble, []string{"uid"})
+		})
+
+		Convey("Should redact the sensitive attributes", func() {
+			entries, _, err := server.Search("dc=grafana,dc=org", "(uid=johndoe)", nil, 10)
+
+			So(err, ShouldBeNil)
+			So(entries[0].Attributes["userPassword"], ShouldResemble, []string{redactedAttributeValue, redactedAttributeValue})
+		})
+
+		Convey("Should redact the sensitive attributes with options or by OID", func() {
+			connection.SearchResult.Entries[0].Attributes = []*ldap.EntryAttribute{
+				{Name: "userPassword;binary", Values: []string{"{SSHA}secret"}},
+				{Name: "2.5.4.35", Values: []string{"{SHA}secret"}},
+			}
+
+			entries, _, err := server.Search("dc=grafana,dc=org", "(uid=johndoe)", nil, 10)
+
+			So(err, ShouldBeNil)
+			So(entries[0].Attributes["userPassword;binary"], ShouldResemble, []string{redactedAttributeValue})
+			So(entries[0].Attributes["2.5.4.35"], ShouldResemble, []string{redactedAttributeValue})
+		})
+
+		Convey("Should refuse to search the sensitive attributes", func() {
+			for _, attribute := range []string{"userPassword", "UserPassword;binary", "2.5.4.35", "unicodePwd;range=0-*"} {
+				_, _, err := server.Search("dc=grafana,dc=org", "(uid=johndoe)", []string{"uid", attribute}, 10)
+
+				So(err, ShouldEqual, ErrSensitiveAttribute)
+			}
+
+			So(connection.SearchRequests, ShouldBeEmpty)
+		})
+
+		Convey("Should flag the entries truncated by the size limit", func() {
+			result := connection.SearchResult
+			connection.SearchProvider = func(*ldap.SearchRequest) (*ldap.SearchResult, error) {
+				return result, ldap.NewError(ldap.LDAPResultSizeLimitExceeded, nil)
+			}
+
+			entries, truncated, err := server.Search("dc=grafana,dc=org", "(uid=*)", nil, 1)
+
+			So(err, ShouldBeNil)
+			So(truncated, ShouldBeTrue)
+			So(len(entries), ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,47 @@
+package ldap
+
+import (
+	"gopkg.in/ldap.v3"
+)
+
+// UserAttributes returns every attribute of the user entry returned by the server, with their values by name.
+// The sensitive attributes, like the passwords, are stripped. The entry is picked like PickUser does
+// when the search matches several ones.
+func (server *Server) UserAttributes(login string) (map[string][]string, error) {
+	entry, err := server.findUserEntry(login, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := map[string][]string{}
+	for _, attribute := range entry.Attributes {
+		if isSensitiveAttribute(attribute.Name) {
+			continue
+		}
+
+		attributes[attribute.Name] = attribute.Values
+	}
+
+	return attributes, nil
+}
+
+// findUserEntry searches the user in the search base DNs with the attributes, all the attributes of the entry if none
+func (server *Server) findUserEntry(login string, attributes []string) (*ldap.Entry, error) {
+	for _, base := range server.Config.SearchBaseDNs {
+		request := server.getSearchRequest(base, []string{login})
+		request.Attributes = attributes
+
+		result, _, err := server.search(request)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(result.Entries) == 0 {
+			continue
+		}
+
+		return pickEntry(result.Entries)
+	}
+
+	return nil, ErrCouldNotFindUser
+}
@@ -0,0 +1,49 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"time"
+)
+
+// Certificate describes the TLS certificate presented by a LDAP server
+type Certificate struct {
+	Subject  string
+	Issuer   string
+	NotAfter time.Time
+}
+
+// NewCertificate describes the x509 certificate
+func NewCertificate(cert *x509.Certificate) *Certificate {
+	return &Certificate{
+		Subject:  cert.Subject.String(),
+		Issuer:   cert.Issuer.String(),
+		NotAfter: cert.NotAfter,
+	}
+}
+
+// ExpiresWithin checks if the certificate is expired, or expires before the end of the window
+func (cert *Certificate) ExpiresWithin(window time.Duration) bool {
+	return time.Now().Add(window).After(cert.NotAfter)
+}
+
+// tlsConnection is implemented by the connections able to report their TLS state
+type tlsConnection interface {
+	TLSConnectionState() (tls.ConnectionState, bool)
+}
+
+// Certificate returns the certificate the server presented when the connection was secured,
+// either over LDAPS or with StartTLS. It is nil when the connection isn't over TLS.
+func (server *Server) Certificate() *Certificate {
+	conn, ok := server.Connection.(tlsConnection)
+	if !ok {
+		return nil
+	}
+
+	state, ok := conn.TLSConnectionState()
+	if !ok || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+
+	return NewCertificate(state.PeerCertificates[0])
+}
@@ -0,0 +1,59 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// mockTLSConnection is a connection secured with the certificate
+type mockTLSConnection struct {
+	MockConnection
+	cert *x509.Certificate
+}
+
+func (c *mockTLSConnection) TLSConnectionState() (tls.ConnectionState, bool) {
+	if c.cert == nil {
+		return tls.ConnectionState{}, false
+	}
+
+	return tls.ConnectionState{PeerCertificates: []*x509.Certificate{c.cert}}, true
+}
+
+func TestCertificate(t *testing.T) {
+	Convey("Certificate()", t, func() {
+		notAfter := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+		cert := &x509.Certificate{
+			Subject:  pkix.Name{CommonName: "ldap.example.org"},
+			Issuer:   pkix.Name{CommonName: "Example CA", Organization: []string{"Example"}},
+			NotAfter: notAfter,
+		}
+
+		Convey("Should describe the certificate of the TLS connection", func() {
+			server := &Server{Connection: &mockTLSConnection{cert: cert}}
+
+			So(server.Certificate(), ShouldResemble, &Certificate{
+				Subject:  "CN=ldap.example.org",
+				Issuer:   "CN=Example CA,O=Example",
+				NotAfter: notAfter,
+			})
+		})
+
+		Convey("Should be nil without TLS", func() {
+			So((&Server{Connection: &mockTLSConnection{}}).Certificate(), ShouldBeNil)
+			So((&Server{Connection: &MockConnection{}}).Certificate(), ShouldBeNil)
+		})
+	})
+
+	Convey("ExpiresWithin()", t, func() {
+		cert := &Certificate{NotAfter: time.Now().Add(10 * 24 * time.Hour)}
+
+		So(cert.ExpiresWithin(30*24*time.Hour), ShouldBeTrue)
+		So(cert.ExpiresWithin(time.Hour), ShouldBeFalse)
+		So((&Certificate{NotAfter: time.Now().Add(-time.Hour)}).ExpiresWithin(0), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,98 @@
+package ldap
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// ErrChangeMarkerUnsupported is returned when the changed users are searched on a server without "change_marker" attribute
+var ErrChangeMarkerUnsupported = errors.New("LDAP server has no change_marker attribute to search the changed users")
+
+// ChangedUsers searches the users whose entry changed since the given change marker of the server, by their "change_marker"
+// attribute, like "uSNChanged" with Active Directory or "entryCSN" with OpenLDAP. Every user is returned without marker.
+// It also returns the highest marker of the returned entries, the given one when none is higher, and true when the size
+// limit of the server truncated the users.
+func (server *Server) ChangedUsers(marker string) (
+	[]*models.ExternalUserInfo, string, bool, error,
+) {
+	attribute := server.Config.Attr.ChangeMarker
+	if attribute == "" {
+		return nil, "", false, ErrChangeMarkerUnsupported
+	}
+
+	var users []*ldap.Entry
+	truncatedResults := false
+	highest := marker
+
+	for _, base := range server.Config.SearchBaseDNs {
+		request := server.getAllUsersSearchRequest(base)
+		if marker != "" {
+			request.Filter = changedSinceFilter(request.Filter, attribute, marker)
+		}
+
+		result, truncated, err := server.search(request)
+		if err != nil {
+			return nil, "", false, err
+		}
+
+		truncatedResults = truncatedResults || truncated
+		users = append(users, result.Entries...)
+	}
+
+	for _, user := range users {
+		if value := getAttribute(attribute, user); compareChangeMarkers(value, highest) > 0 {
+			highest = value
+		}
+	}
+
+	if len(users) == 0 {
+		return []*models.ExternalUserInfo{}, highest, truncatedResults, nil
+	}
+
+	serializedUsers, err := server.serializeUsers(users)
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	return serializedUsers, highest, truncatedResults, nil
+}
+
+// changedSinceFilter restricts the filter to the entries whose change marker is at least the given one.
+// The entries of the marker itself are searched again, as several entries can share an entryCSN second.
+func changedSinceFilter(filter string, attribute string, marker string) string {
+	return "(&" + filter + "(" + attribute + ">=" + ldap.EscapeFilter(marker) + "))"
+}
+
+// compareChangeMarkers compares the update sequence numbers, like uSNChanged, as numbers,
+// and the other markers, like the timestamps of entryCSN, as strings. The empty marker is the lowest.
+func compareChangeMarkers(a, b string) int {
+	if a == b {
+		return 0
+	}
+
+	if a == "" {
+		return -1
+	}
+
+	if b == "" {
+		return 1
+	}
+
+	first, firstErr := strconv.ParseUint(a, 10, 64)
+	second, secondErr := strconv.ParseUint(b, 10, 64)
+
+	if firstErr == nil && secondErr == nil {
+		if first < second {
+			return -1
+		}
+
+		return 1
+	}
+
+	return strings.Compare(a, b)
+}
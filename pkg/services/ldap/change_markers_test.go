@@ -0,0 +1,89 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+)
+
+func TestChangedUsers(t *testing.T) {
+	Convey("ChangedUsers()", t, func() {
+		connection := &MockConnection{}
+		connection.setSearchResult(&ldap.SearchResult{Entries: []*ldap.Entry{
+			{DN: "cn=alice,ou=one", Attributes: []*ldap.EntryAttribute{
+				{Name: "username", Values: []string{"alice"}},
+				{Name: "uSNChanged", Values: []string{"12345"}},
+			}},
+			{DN: "cn=bob,ou=one", Attributes: []*ldap.EntryAttribute{
+				{Name: "username", Values: []string{"bob"}},
+				{Name: "uSNChanged", Values: []string{"9876"}},
+			}},
+		}})
+
+		server := &Server{
+			Config: &ServerConfig{
+				Attr: AttributeMap{
+					Username:     "username",
+					ChangeMarker: "uSNChanged",
+				},
+				SearchFilter:  "(uid=%s)",
+				SearchBaseDNs: []string{"ou=one"},
+			},
+			Connection: connection,
+			log:        log.New("test-logger"),
+		}
+
+		Convey("Should restrict the search to the entries changed since the marker", func() {
+			users, highest, truncated, err := server.ChangedUsers("9000")
+
+			So(err, ShouldBeNil)
+			So(truncated, ShouldBeFalse)
+			So(users, ShouldHaveLength, 2)
+			So(connection.SearchRequests[0].Filter, ShouldEqual, "(&(uid=*)(uSNChanged>=9000))")
+			So(connection.SearchAttributes, ShouldContain, "uSNChanged")
+
+			// the numbers are compared as numbers, "9876" being lower than "12345"
+			So(highest, ShouldEqual, "12345")
+		})
+
+		Convey("Should search every user without marker", func() {
+			_, highest, _, err := server.ChangedUsers("")
+
+			So(err, ShouldBeNil)
+			So(connection.SearchRequests[0].Filter, ShouldEqual, "(uid=*)")
+			So(highest, ShouldEqual, "12345")
+		})
+
+		Convey("Should keep the marker when no entry changed", func() {
+			connection.setSearchResult(&ldap.SearchResult{})
+
+			users, highest, _, err := server.ChangedUsers("12345")
+
+			So(err, ShouldBeNil)
+			So(users, ShouldBeEmpty)
+			So(highest, ShouldEqual, "12345")
+		})
+
+		Convey("Should refuse a server without change_marker attribute", func() {
+			server.Config.Attr.ChangeMarker = ""
+
+			_, _, _, err := server.ChangedUsers("")
+
+			So(err, ShouldEqual, ErrChangeMarkerUnsupported)
+			So(connection.SearchCalled, ShouldBeFalse)
+		})
+	})
+
+	Convey("compareChangeMarkers()", t, func() {
+		So(compareChangeMarkers("9876", "12345"), ShouldEqual, -1)
+		So(compareChangeMarkers("12345", "12345"), ShouldEqual, 0)
+		So(compareChangeMarkers("", "1"), ShouldEqual, -1)
+		So(compareChangeMarkers(
+			"20191015120000.000001Z#000000#000#000000",
+			"20191015120000.000000Z#000000#000#000000",
+		), ShouldEqual, 1)
+	})
+}
@@ -0,0 +1,88 @@
+package ldap
+
+import (
+	"sort"
+	"strings"
+
+	m "github.com/grafana/grafana/pkg/models"
+)
+
+// CoveredRoles are the roles every organization should have a group mapped to, from the highest
+var CoveredRoles = []m.RoleType{m.ROLE_ADMIN, m.ROLE_EDITOR, m.ROLE_VIEWER}
+
+// OrgRoleCoverage lists the groups mapped to each role of an organization, across all the servers
+type OrgRoleCoverage struct {
+	OrgID  int64
+	Groups map[m.RoleType][]string
+}
+
+// Gaps lists the roles of the organization no group is mapped to, from the highest
+func (coverage *OrgRoleCoverage) Gaps() []m.RoleType {
+	gaps := []m.RoleType{}
+
+	for _, role := range CoveredRoles {
+		if len(coverage.Groups[role]) == 0 {
+			gaps = append(gaps, role)
+		}
+	}
+
+	return gaps
+}
+
+// RoleCoverage lists the groups mapped to each role of the organizations, sorted by id.
+// Both the organizations of the group mappings and the given ones are listed,
+// so an organization without any mapping shows up with all its roles uncovered.
+func (config *Config) RoleCoverage(orgIDs []int64) []*OrgRoleCoverage {
+	coverages := map[int64]*OrgRoleCoverage{}
+
+	coverage := func(orgID int64) *OrgRoleCoverage {
+		if coverages[orgID] == nil {
+			coverages[orgID] = &OrgRoleCoverage{OrgID: orgID, Groups: map[m.RoleType][]string{}}
+		}
+
+		return coverages[orgID]
+	}
+
+	for _, orgID := range orgIDs {
+		coverage(orgID)
+	}
+
+	for _, server := range config.Servers {
+		for _, group := range server.Groups {
+			if group.OrgRole == "" {
+				continue
+			}
+
+			orgID := group.OrgID
+			if orgID == 0 {
+				orgID = 1
+			}
+
+			groups := coverage(orgID).Groups
+			if !containsFold(groups[group.OrgRole], group.GroupDN) {
+				groups[group.OrgRole] = append(groups[group.OrgRole], group.GroupDN)
+			}
+		}
+	}
+
+	result := make([]*OrgRoleCoverage, 0, len(coverages))
+	for _, coverage := range coverages {
+		result = append(result, coverage)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].OrgID < result[j].OrgID
+	})
+
+	return result
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,55 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestRoleCoverage(t *testing.T) {
+	Convey("RoleCoverage()", t, func() {
+		config := &Config{
+			Servers: []*ServerConfig{
+				{
+					Groups: []*GroupToOrgRole{
+						{GroupDN: "cn=admins", OrgID: 1, OrgRole: models.ROLE_ADMIN},
+						{GroupDN: "cn=editors", OrgID: 1, OrgRole: models.ROLE_EDITOR},
+						{GroupDN: "cn=superadmins", OrgID: 1, IsGrafanaAdmin: new(bool)},
+					},
+				},
+				{
+					Groups: []*GroupToOrgRole{
+						{GroupDN: "*", OrgID: 1, OrgRole: models.ROLE_VIEWER},
+						{GroupDN: "CN=Admins", OrgID: 1, OrgRole: models.ROLE_ADMIN},
+						{GroupDN: "cn=ops", OrgID: 2, OrgRole: models.ROLE_EDITOR},
+					},
+				},
+			},
+		}
+
+		Convey("Should list the groups mapped to each role across the servers", func() {
+			coverage := config.RoleCoverage(nil)
+
+			So(coverage, ShouldHaveLength, 2)
+			So(coverage[0].OrgID, ShouldEqual, 1)
+			So(coverage[0].Groups, ShouldResemble, map[models.RoleType][]string{
+				models.ROLE_ADMIN:  {"cn=admins"},
+				models.ROLE_EDITOR: {"cn=editors"},
+				models.ROLE_VIEWER: {"*"},
+			})
+			So(coverage[0].Gaps(), ShouldBeEmpty)
+		})
+
+		Convey("Should flag the roles without group", func() {
+			coverage := config.RoleCoverage([]int64{3, 1})
+
+			So(coverage, ShouldHaveLength, 3)
+			So(coverage[1].OrgID, ShouldEqual, 2)
+			So(coverage[1].Gaps(), ShouldResemble, []models.RoleType{models.ROLE_ADMIN, models.ROLE_VIEWER})
+			So(coverage[2].OrgID, ShouldEqual, 3)
+			So(coverage[2].Gaps(), ShouldResemble, []models.RoleType{models.ROLE_ADMIN, models.ROLE_EDITOR, models.ROLE_VIEWER})
+		})
+	})
+}
@@ -0,0 +1,86 @@
+package ldap
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Credentials are the DN and the password used to bind with the LDAP server
+type Credentials struct {
+	BindDN       string
+	BindPassword string
+}
+
+// CredentialProvider supplies the bind credentials of a server on demand,
+// which allows to rotate them without reloading the LDAP configuration
+type CredentialProvider interface {
+	Credentials(config *ServerConfig) (*Credentials, error)
+}
+
+// ConfigCredentialProvider is the default credential provider,
+// it reads the bind credentials from the server configuration
+type ConfigCredentialProvider struct{}
+
+// Credentials returns the bind credentials of the server configuration
+func (provider *ConfigCredentialProvider) Credentials(config *ServerConfig) (*Credentials, error) {
+	return &Credentials{
+		BindDN:       config.BindDN,
+		BindPassword: config.BindPassword,
+	}, nil
+}
+
+var (
+	credentialProvider     CredentialProvider = &ConfigCredentialProvider{}
+	credentialProviderLock sync.RWMutex
+)
+
+// SetCredentialProvider replaces the provider of the bind credentials used by the LDAP servers,
+// passing nil restores the default provider which reads them from the configuration
+func SetCredentialProvider(provider CredentialProvider) {
+	credentialProviderLock.Lock()
+	defer credentialProviderLock.Unlock()
+
+	if provider == nil {
+		provider = &ConfigCredentialProvider{}
+	}
+
+	credentialProvider = provider
+}
+
+// getCredentialProvider returns the current provider of the bind credentials
+func getCredentialProvider() CredentialProvider {
+	credentialProviderLock.RLock()
+	defer credentialProviderLock.RUnlock()
+
+	return credentialProvider
+}
+
+// shouldAdminBind checks if we should use
+// admin username & password for LDAP bind
+func (credentials *Credentials) shouldAdminBind() bool {
+	return credentials.BindPassword != ""
+}
+
+// singleBindDN combines the bind with the username
+// in order to get the proper path
+func (credentials *Credentials) singleBindDN(username string) string {
+	return fmt.Sprintf(credentials.BindDN, username)
+}
+
+// shouldAnonymousBind checks if the user should be searched anonymously,
+// its password is then verified by binding as the user
+func (credentials *Credentials) shouldAnonymousBind() bool {
+	return credentials.BindDN == "" && credentials.BindPassword == ""
+}
+
+// shouldSingleBind checks if we can use "single bind" approach
+func (credentials *Credentials) shouldSingleBind() bool {
+	return strings.Contains(credentials.BindDN, "%s")
+}
+
+// SearchesAsUser checks if the server is searched bound as the user logging in, its configured bind DN holding
+// the username, so the user can't be searched on it without its password
+func (config *ServerConfig) SearchesAsUser() bool {
+	return (&Credentials{BindDN: config.BindDN}).shouldSingleBind()
+}
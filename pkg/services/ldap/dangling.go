@@ -0,0 +1,42 @@
+package ldap
+
+import (
+	"errors"
+
+	"gopkg.in/ldap.v3"
+)
+
+// ErrGroupNotDN is returned when the group of a mapping isn't a DN, like the group names of the POSIX schema
+var ErrGroupNotDN = errors.New("LDAP group is not a DN")
+
+// IsCheckable checks if the group DN of the mapping names a single group, which can be looked up in the directory.
+// The patterns and the "*" wildcard can't be.
+func (group *GroupToOrgRole) IsCheckable() bool {
+	return !group.IsPattern() && group.GroupDN != "*"
+}
+
+// GroupExists checks if the group DN exists in the directory, with a base scope search of the DN itself
+func (server *Server) GroupExists(dn string) (bool, error) {
+	request := &ldap.SearchRequest{
+		BaseDN:       dn,
+		Scope:        ldap.ScopeBaseObject,
+		DerefAliases: ldap.NeverDerefAliases,
+		Attributes:   []string{noAttributes},
+		Filter:       "(objectClass=*)",
+	}
+
+	result, _, err := server.search(request)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+		return false, nil
+	}
+
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidDNSyntax) {
+		return false, ErrGroupNotDN
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return len(result.Entries) > 0, nil
+}
@@ -0,0 +1,69 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+)
+
+func TestGroupExists(t *testing.T) {
+	Convey("GroupExists()", t, func() {
+		connection := &MockConnection{}
+		server := &Server{
+			Config:     &ServerConfig{},
+			Connection: connection,
+			log:        log.New("test-logger"),
+		}
+
+		Convey("Should look up the DN itself", func() {
+			connection.setSearchResult(&ldap.SearchResult{Entries: []*ldap.Entry{{DN: "cn=admins,dc=grafana,dc=org"}}})
+
+			exists, err := server.GroupExists("cn=admins,dc=grafana,dc=org")
+
+			So(err, ShouldBeNil)
+			So(exists, ShouldBeTrue)
+
+			request := connection.SearchRequests[0]
+			So(request.BaseDN, ShouldEqual, "cn=admins,dc=grafana,dc=org")
+			So(request.Scope, ShouldEqual, ldap.ScopeBaseObject)
+			So(request.Attributes, ShouldResemble, []string{noAttributes})
+		})
+
+		Convey("Should not find a missing group", func() {
+			connection.setSearchError(&ldap.Error{ResultCode: ldap.LDAPResultNoSuchObject})
+
+			exists, err := server.GroupExists("cn=old-admins,dc=grafana,dc=org")
+
+			So(err, ShouldBeNil)
+			So(exists, ShouldBeFalse)
+		})
+
+		Convey("Should tell the groups which aren't DNs", func() {
+			connection.setSearchError(&ldap.Error{ResultCode: ldap.LDAPResultInvalidDNSyntax})
+
+			_, err := server.GroupExists("admins")
+
+			So(err, ShouldEqual, ErrGroupNotDN)
+		})
+
+		Convey("Should return the other errors", func() {
+			expected := errors.New("Search error")
+			connection.setSearchError(expected)
+
+			_, err := server.GroupExists("cn=admins,dc=grafana,dc=org")
+
+			So(err, ShouldEqual, expected)
+		})
+	})
+
+	Convey("IsCheckable()", t, func() {
+		So((&GroupToOrgRole{GroupDN: "cn=admins,dc=grafana,dc=org"}).IsCheckable(), ShouldBeTrue)
+		So((&GroupToOrgRole{GroupDN: "*"}).IsCheckable(), ShouldBeFalse)
+		So((&GroupToOrgRole{GroupDN: "cn=proj-*", MatchType: GroupMatchGlob}).IsCheckable(), ShouldBeFalse)
+		So((&GroupToOrgRole{GroupDN: "^cn=proj-.*$", MatchType: GroupMatchRegex}).IsCheckable(), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,198 @@
+package ldap
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	m "github.com/grafana/grafana/pkg/models"
+)
+
+// ConfigDiff is what changed between two LDAP configs, the servers are identified by their "host:port"
+type ConfigDiff struct {
+	ServersAdded         []string              `json:"serversAdded"`
+	ServersRemoved       []string              `json:"serversRemoved"`
+	GroupMappingsAdded   []*GroupMappingChange `json:"groupMappingsAdded"`
+	GroupMappingsRemoved []*GroupMappingChange `json:"groupMappingsRemoved"`
+	GroupMappingsChanged []*GroupMappingChange `json:"groupMappingsChanged"`
+	AttributesChanged    []*AttributeMapChange `json:"attributesChanged"`
+}
+
+// GroupMappingChange is a group mapping of a server added, removed or changed between two configs.
+// A mapping is identified by its group DN and org, Previous is only set for a changed mapping.
+type GroupMappingChange struct {
+	Server  string `json:"server"`
+	GroupDN string `json:"groupDN"`
+	OrgID   int64  `json:"orgId"`
+	GroupMappingGrant
+
+	Previous *GroupMappingGrant `json:"previous,omitempty"`
+}
+
+// GroupMappingGrant is what a group mapping gives to the members of the group
+type GroupMappingGrant struct {
+	OrgRole        m.RoleType `json:"orgRole"`
+	IsGrafanaAdmin *bool      `json:"grafanaAdmin"`
+	MatchType      string     `json:"matchType"`
+}
+
+func newGroupMappingChange(server string, group *GroupToOrgRole) *GroupMappingChange {
+	return &GroupMappingChange{
+		Server:            server,
+		GroupDN:           group.GroupDN,
+		OrgID:             group.OrgID,
+		GroupMappingGrant: newGroupMappingGrant(group),
+	}
+}
+
+func newGroupMappingGrant(group *GroupToOrgRole) GroupMappingGrant {
+	return GroupMappingGrant{
+		OrgRole:        group.OrgRole,
+		IsGrafanaAdmin: group.IsGrafanaAdmin,
+		MatchType:      group.MatchType,
+	}
+}
+
+// AttributeMapChange is an attribute of the "attributes" section of a server changed between two configs
+type AttributeMapChange struct {
+	Server    string `json:"server"`
+	Attribute string `json:"attribute"`
+	Before    string `json:"before"`
+	After     string `json:"after"`
+}
+
+// IsEmpty checks if nothing changed
+func (diff *ConfigDiff) IsEmpty() bool {
+	return len(diff.ServersAdded) == 0 && len(diff.ServersRemoved) == 0 &&
+		len(diff.GroupMappingsAdded) == 0 && len(diff.GroupMappingsRemoved) == 0 && len(diff.GroupMappingsChanged) == 0 &&
+		len(diff.AttributesChanged) == 0
+}
+
+// DiffConfigs compares the servers, their group mappings and their attributes between the previous and the current config.
+// A nil previous config, when none was loaded yet, adds every server of the current one.
+func DiffConfigs(previous, current *Config) *ConfigDiff {
+	diff := &ConfigDiff{
+		ServersAdded:         []string{},
+		ServersRemoved:       []string{},
+		GroupMappingsAdded:   []*GroupMappingChange{},
+		GroupMappingsRemoved: []*GroupMappingChange{},
+		GroupMappingsChanged: []*GroupMappingChange{},
+		AttributesChanged:    []*AttributeMapChange{},
+	}
+
+	previousServers := configServers(previous)
+	currentServers := configServers(current)
+
+	for _, key := range sortedServerKeys(currentServers) {
+		before, ok := previousServers[key]
+		if !ok {
+			diff.ServersAdded = append(diff.ServersAdded, key)
+			continue
+		}
+
+		diff.diffGroupMappings(key, before, currentServers[key])
+		diff.diffAttributes(key, before, currentServers[key])
+	}
+
+	for _, key := range sortedServerKeys(previousServers) {
+		if _, ok := currentServers[key]; !ok {
+			diff.ServersRemoved = append(diff.ServersRemoved, key)
+		}
+	}
+
+	return diff
+}
+
+// groupMappingKey identifies a group mapping of a server
+type groupMappingKey struct {
+	groupDN string
+	orgID   int64
+}
+
+// diffGroupMappings compares the group mappings of a server kept by the current config,
+// the group DNs are compared regardless of the case, as the group memberships are
+func (diff *ConfigDiff) diffGroupMappings(server string, before, after *ServerConfig) {
+	previous := map[groupMappingKey]*GroupToOrgRole{}
+	for _, group := range before.Groups {
+		previous[groupMappingKey{strings.ToLower(group.GroupDN), group.OrgID}] = group
+	}
+
+	current := map[groupMappingKey]bool{}
+	for _, group := range after.Groups {
+		key := groupMappingKey{strings.ToLower(group.GroupDN), group.OrgID}
+		current[key] = true
+
+		change := newGroupMappingChange(server, group)
+
+		old, ok := previous[key]
+		switch {
+		case !ok:
+			diff.GroupMappingsAdded = append(diff.GroupMappingsAdded, change)
+		case !sameGroupMapping(old, group):
+			previousGrant := newGroupMappingGrant(old)
+			change.Previous = &previousGrant
+			diff.GroupMappingsChanged = append(diff.GroupMappingsChanged, change)
+		}
+	}
+
+	for _, group := range before.Groups {
+		if current[groupMappingKey{strings.ToLower(group.GroupDN), group.OrgID}] {
+			continue
+		}
+
+		diff.GroupMappingsRemoved = append(diff.GroupMappingsRemoved, newGroupMappingChange(server, group))
+	}
+}
+
+// sameGroupMapping checks if both mappings give the same role and Grafana admin status the same way
+func sameGroupMapping(before, after *GroupToOrgRole) bool {
+	return before.GroupDN == after.GroupDN &&
+		before.OrgRole == after.OrgRole &&
+		before.MatchType == after.MatchType &&
+		reflect.DeepEqual(before.IsGrafanaAdmin, after.IsGrafanaAdmin)
+}
+
+// diffAttributes compares the attributes of a server kept by the current config, by their name in the config file
+func (diff *ConfigDiff) diffAttributes(server string, before, after *ServerConfig) {
+	previous := reflect.ValueOf(before.Attr)
+	current := reflect.ValueOf(after.Attr)
+	attrType := previous.Type()
+
+	for i := 0; i < attrType.NumField(); i++ {
+		beforeValue, afterValue := previous.Field(i).String(), current.Field(i).String()
+		if beforeValue == afterValue {
+			continue
+		}
+
+		diff.AttributesChanged = append(diff.AttributesChanged, &AttributeMapChange{
+			Server:    server,
+			Attribute: attrType.Field(i).Tag.Get("toml"),
+			Before:    beforeValue,
+			After:     afterValue,
+		})
+	}
+}
+
+// configServers indexes the servers of the config by their "host:port"
+func configServers(config *Config) map[string]*ServerConfig {
+	servers := map[string]*ServerConfig{}
+	if config == nil {
+		return servers
+	}
+
+	for _, server := range config.Servers {
+		servers[serverKey(server)] = server
+	}
+
+	return servers
+}
+
+func sortedServerKeys(servers map[string]*ServerConfig) []string {
+	keys := []string{}
+	for key := range servers {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,145 @@
+package ldap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestDiffConfigs(t *testing.T) {
+	Convey("DiffConfigs()", t, func() {
+		isGrafanaAdmin := true
+
+		previous := &Config{Servers: []*ServerConfig{
+			{
+				Host: "ldap.example.org",
+				Port: 389,
+				Attr: AttributeMap{Username: "cn", Email: "email"},
+				Groups: []*GroupToOrgRole{
+					{GroupDN: "cn=admins,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_ADMIN},
+					{GroupDN: "cn=editors,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_EDITOR},
+					{GroupDN: "cn=viewers,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_VIEWER},
+				},
+			},
+			{Host: "old.example.org", Port: 389},
+		}}
+
+		Convey("Should report nothing for the same config", func() {
+			diff := DiffConfigs(previous, previous)
+
+			So(diff.IsEmpty(), ShouldBeTrue)
+		})
+
+		Convey("Should report the servers, group mappings and attributes which changed", func() {
+			current := &Config{Servers: []*ServerConfig{
+				{
+					Host: "ldap.example.org",
+					Port: 389,
+					Attr: AttributeMap{Username: "uid", Email: "email", MemberOf: "memberOf"},
+					Groups: []*GroupToOrgRole{
+						{GroupDN: "CN=Admins,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_ADMIN, IsGrafanaAdmin: &isGrafanaAdmin},
+						{GroupDN: "cn=editors,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_EDITOR},
+						{GroupDN: "cn=editors,dc=grafana,dc=org", OrgID: 2, OrgRole: models.ROLE_VIEWER},
+					},
+				},
+				{Host: "ad.example.org", Port: 636},
+			}}
+
+			diff := DiffConfigs(previous, current)
+
+			So(diff.IsEmpty(), ShouldBeFalse)
+			So(diff.ServersAdded, ShouldResemble, []string{"ad.example.org:636"})
+			So(diff.ServersRemoved, ShouldResemble, []string{"old.example.org:389"})
+
+			So(diff.GroupMappingsAdded, ShouldResemble, []*GroupMappingChange{{
+				Server:            "ldap.example.org:389",
+				GroupDN:           "cn=editors,dc=grafana,dc=org",
+				OrgID:             2,
+				GroupMappingGrant: GroupMappingGrant{OrgRole: models.ROLE_VIEWER},
+			}})
+			So(diff.GroupMappingsRemoved, ShouldResemble, []*GroupMappingChange{{
+				Server:            "ldap.example.org:389",
+				GroupDN:           "cn=viewers,dc=grafana,dc=org",
+				OrgID:             1,
+				GroupMappingGrant: GroupMappingGrant{OrgRole: models.ROLE_VIEWER},
+			}})
+			So(diff.GroupMappingsChanged, ShouldResemble, []*GroupMappingChange{{
+				Server:            "ldap.example.org:389",
+				GroupDN:           "CN=Admins,dc=grafana,dc=org",
+				OrgID:             1,
+				GroupMappingGrant: GroupMappingGrant{OrgRole: models.ROLE_ADMIN, IsGrafanaAdmin: &isGrafanaAdmin},
+				Previous:          &GroupMappingGrant{OrgRole: models.ROLE_ADMIN},
+			}})
+
+			So(diff.AttributesChanged, ShouldResemble, []*AttributeMapChange{
+				{Server: "ldap.example.org:389", Attribute: "username", Before: "cn", After: "uid"},
+				{Server: "ldap.example.org:389", Attribute: "member_of", Before: "", After: "memberOf"},
+			})
+		})
+
+		Convey("Should add every server without previous config", func() {
+			diff := DiffConfigs(nil, previous)
+
+			So(diff.ServersAdded, ShouldResemble, []string{"ldap.example.org:389", "old.example.org:389"})
+			So(diff.GroupMappingsAdded, ShouldBeEmpty)
+		})
+	})
+
+	Convey("ReloadConfig()", t, func() {
+		dir, err := ioutil.TempDir("", "ldap")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "ldap.toml")
+		writeConfig := func(content string) {
+			So(ioutil.WriteFile(path, []byte(content), 0644), ShouldBeNil)
+		}
+
+		enabled, configFile, loaded := setting.LDAPEnabled, setting.LDAPConfigFile, config
+		defer func() { setting.LDAPEnabled, setting.LDAPConfigFile, config = enabled, configFile, loaded }()
+
+		setting.LDAPEnabled = true
+		setting.LDAPConfigFile = path
+		config = nil
+
+		server := `
+[[servers]]
+host = "ldap.example.org"
+port = 389
+search_filter = "(cn=%s)"
+search_base_dns = ["dc=grafana,dc=org"]
+
+[[servers.group_mappings]]
+group_dn = "cn=admins,dc=grafana,dc=org"
+org_role = `
+
+		writeConfig(server + `"Admin"`)
+		_, err = ReloadConfig()
+		So(err, ShouldBeNil)
+
+		Convey("Should report what changed since the previous config", func() {
+			writeConfig(server + `"Editor"
+
+[[servers]]
+host = "ad.example.org"
+port = 636
+search_filter = "(sAMAccountName=%s)"
+search_base_dns = ["dc=example,dc=org"]
+`)
+
+			diff, err := ReloadConfig()
+
+			So(err, ShouldBeNil)
+			So(diff.ServersAdded, ShouldResemble, []string{"ad.example.org:636"})
+			So(diff.GroupMappingsChanged, ShouldHaveLength, 1)
+			So(diff.GroupMappingsChanged[0].OrgRole, ShouldEqual, models.ROLE_EDITOR)
+			So(diff.GroupMappingsChanged[0].Previous.OrgRole, ShouldEqual, models.ROLE_ADMIN)
+		})
+	})
+}
@@ -0,0 +1,43 @@
+package ldap
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/util"
+)
+
+// Policies for the LDAP emails which aren't valid addresses
+const (
+	// InvalidEmailWarn logs the invalid emails, the users can still log in
+	InvalidEmailWarn = "warn"
+
+	// InvalidEmailReject denies the login of the users with an invalid email
+	InvalidEmailReject = "reject"
+)
+
+// ErrInvalidEmail is returned by ValidateEmail when the email isn't a valid address
+var ErrInvalidEmail = errors.New("LDAP email is not a valid address")
+
+// normalizeEmail trims and lowercases the email when the server asks for it
+func (config *ServerConfig) normalizeEmail(email string) string {
+	if !config.NormalizeEmail {
+		return email
+	}
+
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// ValidateEmail checks the email is a valid address, unless the server has no invalid_email policy.
+// Users without email aren't validated.
+func (config *ServerConfig) ValidateEmail(email string) error {
+	if config.InvalidEmail == "" || email == "" {
+		return nil
+	}
+
+	if !util.IsEmail(email) {
+		return ErrInvalidEmail
+	}
+
+	return nil
+}
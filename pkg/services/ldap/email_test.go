@@ -0,0 +1,132 @@
+package ldap
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+)
+
+func TestEmail(t *testing.T) {
+	Convey("Email normalization and validation", t, func() {
+		newServer := func(normalize bool, policy string) *Server {
+			return &Server{
+				Config: &ServerConfig{
+					Attr: AttributeMap{
+						Username: "username",
+						Email:    "email",
+					},
+					NormalizeEmail: normalize,
+					InvalidEmail:   policy,
+					SearchBaseDNs:  []string{"BaseDNHere"},
+				},
+				Connection: &MockConnection{},
+				log:        log.New("test-logger"),
+			}
+		}
+
+		mapEmail := func(server *Server, email string) (string, error) {
+			entry := ldap.Entry{
+				DN: "dn",
+				Attributes: []*ldap.EntryAttribute{
+					{Name: "username", Values: []string{"roelgerrits"}},
+					{Name: "email", Values: []string{email}},
+				},
+			}
+
+			users, err := server.serializeUsers([]*ldap.Entry{&entry})
+			So(err, ShouldBeNil)
+
+			return users[0].Email, server.validateGrafanaUser(users[0])
+		}
+
+		for _, tc := range []struct {
+			desc       string
+			email      string
+			normalized string
+			valid      bool
+		}{
+			{desc: "valid", email: "roel@example.com", normalized: "roel@example.com", valid: true},
+			{desc: "needing a trim", email: " roel@example.com \t", normalized: "roel@example.com", valid: true},
+			{desc: "uppercase", email: "Roel@Example.COM", normalized: "roel@example.com", valid: true},
+			{desc: "clearly invalid", email: "roel.example.com", normalized: "roel.example.com", valid: false},
+		} {
+			tc := tc
+
+			Convey("Should keep the "+tc.desc+" email as is without normalization", func() {
+				email, err := mapEmail(newServer(false, ""), tc.email)
+
+				So(email, ShouldEqual, tc.email)
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Should normalize the "+tc.desc+" email", func() {
+				email, err := mapEmail(newServer(true, ""), tc.email)
+
+				So(email, ShouldEqual, tc.normalized)
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Should only warn about the "+tc.desc+" email", func() {
+				server := newServer(true, InvalidEmailWarn)
+				email, err := mapEmail(server, tc.email)
+
+				So(email, ShouldEqual, tc.normalized)
+				So(err, ShouldBeNil)
+
+				if tc.valid {
+					So(server.Config.ValidateEmail(email), ShouldBeNil)
+				} else {
+					So(server.Config.ValidateEmail(email), ShouldEqual, ErrInvalidEmail)
+				}
+			})
+
+			Convey("Should apply the reject policy to the "+tc.desc+" email", func() {
+				email, err := mapEmail(newServer(true, InvalidEmailReject), tc.email)
+
+				So(email, ShouldEqual, tc.normalized)
+				if tc.valid {
+					So(err, ShouldBeNil)
+				} else {
+					So(err, ShouldEqual, ErrInvalidCredentials)
+				}
+			})
+		}
+
+		Convey("Should reject the untrimmed emails when they aren't normalized", func() {
+			_, err := mapEmail(newServer(false, InvalidEmailReject), " roel@example.com")
+
+			So(err, ShouldEqual, ErrInvalidCredentials)
+		})
+
+		Convey("Should not validate the users without email", func() {
+			So(newServer(false, InvalidEmailReject).Config.ValidateEmail(""), ShouldBeNil)
+		})
+	})
+
+	Convey("readConfig()", t, func() {
+		Convey("Should refuse an unknown invalid_email policy", func() {
+			file, err := ioutil.TempFile("", "ldap.toml")
+			So(err, ShouldBeNil)
+			defer os.Remove(file.Name())
+
+			_, err = file.WriteString(`
+[[servers]]
+host = "127.0.0.1"
+search_filter = "(cn=%s)"
+search_base_dns = ["dc=grafana,dc=org"]
+invalid_email = "ignore"
+`)
+			So(err, ShouldBeNil)
+			So(file.Close(), ShouldBeNil)
+
+			_, err = readConfig(file.Name())
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, `unknown policy "ignore"`)
+		})
+	})
+}
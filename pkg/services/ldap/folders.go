@@ -0,0 +1,89 @@
+package ldap
+
+import (
+	"golang.org/x/xerrors"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// folderPermissions are the permissions which can be given by the folder mappings
+var folderPermissions = []models.PermissionType{
+	models.PERMISSION_VIEW,
+	models.PERMISSION_EDIT,
+	models.PERMISSION_ADMIN,
+}
+
+// folderPermissionRoles are the org roles accepted as the folder permissions they are named after,
+// like in the "group_mappings", which name the Admin permission the same
+var folderPermissionRoles = map[models.RoleType]models.PermissionType{
+	models.ROLE_VIEWER: models.PERMISSION_VIEW,
+	models.ROLE_EDITOR: models.PERMISSION_EDIT,
+}
+
+// normalizePermission replaces the org role given as permission by the permission it is named after
+func (mapping *GroupToFolderPermission) normalizePermission() {
+	if permission, ok := folderPermissionRoles[models.RoleType(mapping.Permission)]; ok {
+		mapping.Permission = permission.String()
+	}
+}
+
+// PermissionType returns the folder permission given by the mapping, 0 if it isn't a known permission
+func (mapping *GroupToFolderPermission) PermissionType() models.PermissionType {
+	for _, permission := range folderPermissions {
+		if permission.String() == mapping.Permission {
+			return permission
+		}
+	}
+
+	return 0
+}
+
+// validate checks the mapping names a folder and a known permission
+func (mapping *GroupToFolderPermission) validate() error {
+	if mapping.FolderID <= 0 {
+		return xerrors.Errorf("invalid folder_id %d for group %q", mapping.FolderID, mapping.GroupDN)
+	}
+
+	if mapping.PermissionType() == 0 {
+		return xerrors.Errorf("unknown permission %q for group %q", mapping.Permission, mapping.GroupDN)
+	}
+
+	return nil
+}
+
+// Matches checks if one of the groups is the group of the mapping
+func (mapping *GroupToFolderPermission) Matches(memberOf []string) bool {
+	return isMemberOf(memberOf, mapping.GroupDN)
+}
+
+// getFolderPermissions returns the permissions given by the folder mappings matching the groups of the user.
+// The highest permission wins when several mappings match the same folder.
+func (server *Server) getFolderPermissions(memberOf []string) []models.ExternalFolderPermission {
+	permissions := []models.ExternalFolderPermission{}
+	indices := map[int64]int{}
+
+	for _, mapping := range server.Config.FolderMappings {
+		if !mapping.Matches(memberOf) {
+			continue
+		}
+
+		permission := models.ExternalFolderPermission{
+			OrgId:      mapping.OrgID,
+			FolderId:   mapping.FolderID,
+			Permission: mapping.PermissionType(),
+		}
+
+		i, ok := indices[mapping.FolderID]
+		if !ok {
+			indices[mapping.FolderID] = len(permissions)
+			permissions = append(permissions, permission)
+			continue
+		}
+
+		if permission.Permission > permissions[i].Permission {
+			permissions[i] = permission
+		}
+	}
+
+	return permissions
+}
@@ -0,0 +1,124 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestFolderMappings(t *testing.T) {
+	Convey("Folder mappings", t, func() {
+		newServer := func(mappings ...*GroupToFolderPermission) *Server {
+			return &Server{
+				Config: &ServerConfig{
+					Attr: AttributeMap{
+						Username: "username",
+						MemberOf: "memberof",
+					},
+					FolderMappings: mappings,
+					SearchBaseDNs:  []string{"BaseDNHere"},
+				},
+				Connection: &MockConnection{},
+				log:        log.New("test-logger"),
+			}
+		}
+
+		buildUser := func(server *Server, memberOf ...string) *models.ExternalUserInfo {
+			entry := ldap.Entry{
+				DN: "dn",
+				Attributes: []*ldap.EntryAttribute{
+					{Name: "username", Values: []string{"roelgerrits"}},
+					{Name: "memberof", Values: memberOf},
+				},
+			}
+
+			users, err := server.serializeUsers([]*ldap.Entry{&entry})
+			So(err, ShouldBeNil)
+
+			return users[0]
+		}
+
+		Convey("Should not sync the folder permissions without folder mappings", func() {
+			user := buildUser(newServer(), "cn=ops")
+
+			So(user.FolderPermissions, ShouldBeNil)
+		})
+
+		Convey("Should give the permissions of the matched groups", func() {
+			server := newServer(
+				&GroupToFolderPermission{GroupDN: "cn=ops", OrgID: 1, FolderID: 10, Permission: "View"},
+				&GroupToFolderPermission{GroupDN: "cn=admins", OrgID: 1, FolderID: 10, Permission: "Admin"},
+				&GroupToFolderPermission{GroupDN: "CN=Ops", OrgID: 2, FolderID: 20, Permission: "Edit"},
+				&GroupToFolderPermission{GroupDN: "cn=devs", OrgID: 1, FolderID: 30, Permission: "Edit"},
+			)
+
+			So(buildUser(server, "cn=ops").FolderPermissions, ShouldResemble, []models.ExternalFolderPermission{
+				{OrgId: 1, FolderId: 10, Permission: models.PERMISSION_VIEW},
+				{OrgId: 2, FolderId: 20, Permission: models.PERMISSION_EDIT},
+			})
+
+			Convey("The highest permission wins on the same folder", func() {
+				So(buildUser(server, "cn=ops", "cn=admins").FolderPermissions[0].Permission, ShouldEqual, models.PERMISSION_ADMIN)
+			})
+
+			Convey("No permission is given when no group matches", func() {
+				So(buildUser(server, "cn=guests").FolderPermissions, ShouldBeEmpty)
+				So(buildUser(server, "cn=guests").FolderPermissions, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("ParseConfig()", t, func() {
+		parse := func(mapping string) (*Config, error) {
+			return ParseConfig(`
+[[servers]]
+host = "127.0.0.1"
+search_filter = "(cn=%s)"
+search_base_dns = ["dc=grafana,dc=org"]
+
+[[servers.folder_mappings]]
+group_dn = "cn=ops"
+` + mapping)
+		}
+
+		Convey("Should default to the view permission in the main org", func() {
+			config, err := parse(`folder_id = 10`)
+
+			So(err, ShouldBeNil)
+			So(config.Servers[0].FolderMappings[0].OrgID, ShouldEqual, 1)
+			So(config.Servers[0].FolderMappings[0].PermissionType(), ShouldEqual, models.PERMISSION_VIEW)
+		})
+
+		Convey("Should accept the org roles the permissions are named after", func() {
+			for role, permission := range map[string]models.PermissionType{
+				"Viewer": models.PERMISSION_VIEW,
+				"Editor": models.PERMISSION_EDIT,
+				"Admin":  models.PERMISSION_ADMIN,
+			} {
+				config, err := parse("folder_id = 10\npermission = \"" + role + "\"")
+
+				So(err, ShouldBeNil)
+				So(config.Servers[0].FolderMappings[0].Permission, ShouldEqual, permission.String())
+				So(config.Servers[0].FolderMappings[0].PermissionType(), ShouldEqual, permission)
+			}
+		})
+
+		Convey("Should refuse an unknown permission", func() {
+			_, err := parse("folder_id = 10\npermission = \"Write\"")
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, `unknown permission "Write"`)
+		})
+
+		Convey("Should refuse a mapping without folder", func() {
+			_, err := parse(`permission = "Edit"`)
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "invalid folder_id 0")
+		})
+	})
+}
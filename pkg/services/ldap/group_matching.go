@@ -0,0 +1,105 @@
+package ldap
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	// GroupMatchExact matches the group DN literally, it is the default
+	GroupMatchExact = "exact"
+
+	// GroupMatchGlob matches the group DN as a glob pattern, where "*" matches any sequence of characters and "?" a single one
+	GroupMatchGlob = "glob"
+
+	// GroupMatchRegex matches the group DN as a regular expression
+	GroupMatchRegex = "regex"
+)
+
+// compileMatcher validates the match type of the group mapping and compiles its pattern
+func (group *GroupToOrgRole) compileMatcher() error {
+	matcher, err := group.newMatcher()
+	if err != nil {
+		return err
+	}
+
+	group.matcher = matcher
+
+	return nil
+}
+
+// newMatcher compiles the pattern of the group mapping, it returns nil for the exact matching
+func (group *GroupToOrgRole) newMatcher() (*regexp.Regexp, error) {
+	var expr string
+
+	switch group.MatchType {
+	case "", GroupMatchExact:
+		return nil, nil
+	case GroupMatchGlob:
+		expr = "^" + globToRegex(group.GroupDN) + "$"
+	case GroupMatchRegex:
+		expr = group.GroupDN
+	default:
+		return nil, xerrors.Errorf(
+			"Unknown match_type %q for group_dn %q, expected %q, %q or %q",
+			group.MatchType, group.GroupDN, GroupMatchExact, GroupMatchGlob, GroupMatchRegex,
+		)
+	}
+
+	// group DNs are case-insensitive
+	matcher, err := regexp.Compile("(?i)" + expr)
+	if err != nil {
+		return nil, xerrors.Errorf("Invalid %s group_dn %q: %w", group.MatchType, group.GroupDN, err)
+	}
+
+	return matcher, nil
+}
+
+// IsPattern checks if the group DN of the mapping is a glob or a regex
+func (group *GroupToOrgRole) IsPattern() bool {
+	return group.MatchType == GroupMatchGlob || group.MatchType == GroupMatchRegex
+}
+
+// MatchedGroup returns the first of the given groups matched by the group mapping
+func (group *GroupToOrgRole) MatchedGroup(memberOf []string) (string, bool) {
+	if !group.IsPattern() {
+		return group.GroupDN, isMemberOf(memberOf, group.GroupDN)
+	}
+
+	matcher := group.matcher
+	if matcher == nil {
+		// The mapping wasn't read from the config file
+		var err error
+		if matcher, err = group.newMatcher(); err != nil {
+			return "", false
+		}
+	}
+
+	for _, member := range memberOf {
+		if matcher.MatchString(member) {
+			return member, true
+		}
+	}
+
+	return "", false
+}
+
+// globToRegex converts a glob pattern to a regular expression
+func globToRegex(glob string) string {
+	var expr strings.Builder
+
+	for _, char := range glob {
+		switch char {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(char)))
+		}
+	}
+
+	return expr.String()
+}
@@ -0,0 +1,134 @@
+package ldap
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGroupMatching(t *testing.T) {
+	memberOf := []string{
+		"cn=admins,ou=groups,dc=grafana,dc=org",
+		"cn=proj-apollo-viewers,ou=groups,dc=grafana,dc=org",
+	}
+
+	Convey("MatchedGroup()", t, func() {
+		Convey("Literal", func() {
+			group := &GroupToOrgRole{GroupDN: "CN=admins,ou=groups,dc=grafana,dc=org"}
+
+			matched, ok := group.MatchedGroup(memberOf)
+			So(ok, ShouldBeTrue)
+			So(matched, ShouldEqual, "CN=admins,ou=groups,dc=grafana,dc=org")
+
+			group = &GroupToOrgRole{GroupDN: "cn=proj-*-viewers,ou=groups,dc=grafana,dc=org"}
+
+			_, ok = group.MatchedGroup(memberOf)
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("Wildcard", func() {
+			group := &GroupToOrgRole{GroupDN: "*"}
+
+			_, ok := group.MatchedGroup([]string{})
+			So(ok, ShouldBeTrue)
+		})
+
+		Convey("Glob", func() {
+			group := &GroupToOrgRole{
+				GroupDN:   "cn=proj-*-viewers,ou=groups,dc=grafana,dc=org",
+				MatchType: GroupMatchGlob,
+			}
+			So(group.compileMatcher(), ShouldBeNil)
+
+			matched, ok := group.MatchedGroup(memberOf)
+			So(ok, ShouldBeTrue)
+			So(matched, ShouldEqual, "cn=proj-apollo-viewers,ou=groups,dc=grafana,dc=org")
+
+			Convey("Should match the whole DN", func() {
+				group := &GroupToOrgRole{
+					GroupDN:   "cn=proj-*-viewers",
+					MatchType: GroupMatchGlob,
+				}
+
+				_, ok := group.MatchedGroup(memberOf)
+				So(ok, ShouldBeFalse)
+			})
+
+			Convey("Should not interpret the regex characters", func() {
+				group := &GroupToOrgRole{
+					GroupDN:   "cn=proj-.+-viewers,ou=groups,dc=grafana,dc=org",
+					MatchType: GroupMatchGlob,
+				}
+
+				_, ok := group.MatchedGroup(memberOf)
+				So(ok, ShouldBeFalse)
+			})
+		})
+
+		Convey("Regex", func() {
+			group := &GroupToOrgRole{
+				GroupDN:   `^cn=proj-[a-z]+-viewers,`,
+				MatchType: GroupMatchRegex,
+			}
+			So(group.compileMatcher(), ShouldBeNil)
+
+			matched, ok := group.MatchedGroup(memberOf)
+			So(ok, ShouldBeTrue)
+			So(matched, ShouldEqual, "cn=proj-apollo-viewers,ou=groups,dc=grafana,dc=org")
+
+			group = &GroupToOrgRole{
+				GroupDN:   `^cn=proj-[0-9]+-viewers,`,
+				MatchType: GroupMatchRegex,
+			}
+
+			_, ok = group.MatchedGroup(memberOf)
+			So(ok, ShouldBeFalse)
+		})
+	})
+
+	Convey("compileMatcher()", t, func() {
+		Convey("Should refuse an invalid regex", func() {
+			group := &GroupToOrgRole{GroupDN: "cn=(admins", MatchType: GroupMatchRegex}
+
+			err := group.compileMatcher()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, `Invalid regex group_dn "cn=(admins"`)
+		})
+
+		Convey("Should refuse an unknown match type", func() {
+			group := &GroupToOrgRole{GroupDN: "cn=admins", MatchType: "fuzzy"}
+
+			err := group.compileMatcher()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, `Unknown match_type "fuzzy"`)
+		})
+	})
+
+	Convey("readConfig()", t, func() {
+		Convey("Should refuse a config with an invalid regex", func() {
+			file, err := ioutil.TempFile("", "ldap.toml")
+			So(err, ShouldBeNil)
+			defer os.Remove(file.Name())
+
+			_, err = file.WriteString(`
+[[servers]]
+host = "127.0.0.1"
+search_filter = "(cn=%s)"
+search_base_dns = ["dc=grafana,dc=org"]
+
+[[servers.group_mappings]]
+group_dn = "cn=(admins"
+match_type = "regex"
+org_role = "Admin"
+`)
+			So(err, ShouldBeNil)
+			So(file.Close(), ShouldBeNil)
+
+			_, err = readConfig(file.Name())
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, `Invalid regex group_dn "cn=(admins"`)
+		})
+	})
+}
@@ -0,0 +1,28 @@
+package ldap
+
+import (
+	"gopkg.in/ldap.v3"
+)
+
+// CheckSearch checks the bound connection can search the directory, with a base scope search of the first
+// search base DN. The bind with the service account may succeed while its searches are refused, for example
+// once its password expired and the server only lets it change the password.
+func (server *Server) CheckSearch() error {
+	base := ""
+	if len(server.Config.SearchBaseDNs) > 0 {
+		base = server.Config.SearchBaseDNs[0]
+	}
+
+	request := &ldap.SearchRequest{
+		BaseDN:       base,
+		Scope:        ldap.ScopeBaseObject,
+		DerefAliases: ldap.NeverDerefAliases,
+		SizeLimit:    1,
+		Attributes:   []string{noAttributes},
+		Filter:       "(objectClass=*)",
+	}
+
+	_, _, err := server.search(request)
+
+	return err
+}
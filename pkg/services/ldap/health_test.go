@@ -0,0 +1,45 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+)
+
+func TestCheckSearch(t *testing.T) {
+	Convey("CheckSearch()", t, func() {
+		connection := &MockConnection{}
+		server := &Server{
+			Config: &ServerConfig{
+				SearchBaseDNs: []string{"ou=people,dc=grafana,dc=org", "ou=contractors,dc=grafana,dc=org"},
+			},
+			Connection: connection,
+			log:        log.New("test-logger"),
+		}
+
+		Convey("Should search the first search base DN itself", func() {
+			connection.setSearchResult(&ldap.SearchResult{Entries: []*ldap.Entry{{DN: "ou=people,dc=grafana,dc=org"}}})
+
+			err := server.CheckSearch()
+
+			So(err, ShouldBeNil)
+			So(connection.SearchRequests, ShouldHaveLength, 1)
+
+			request := connection.SearchRequests[0]
+			So(request.BaseDN, ShouldEqual, "ou=people,dc=grafana,dc=org")
+			So(request.Scope, ShouldEqual, ldap.ScopeBaseObject)
+			So(request.Attributes, ShouldResemble, []string{noAttributes})
+		})
+
+		Convey("Should return the refused search", func() {
+			connection.setSearchError(&ldap.Error{ResultCode: ldap.LDAPResultInsufficientAccessRights})
+
+			err := server.CheckSearch()
+
+			So(ldap.IsErrorWithCode(err, ldap.LDAPResultInsufficientAccessRights), ShouldBeTrue)
+		})
+	})
+}
@@ -1,8 +1,12 @@
 package ldap
 
 import (
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/grafana/grafana/pkg/models"
+	"golang.org/x/xerrors"
 	"gopkg.in/ldap.v3"
 )
 
@@ -28,6 +32,24 @@ func appendIfNotEmpty(slice []string, values ...string) []string {
 	return slice
 }
 
+// uniqueStrings removes case-insensitive duplicates, preserving the order
+func uniqueStrings(values []string) []string {
+	seen := map[string]bool{}
+	result := []string{}
+
+	for _, v := range values {
+		key := strings.ToLower(v)
+		if seen[key] {
+			continue
+		}
+
+		seen[key] = true
+		result = append(result, v)
+	}
+
+	return result
+}
+
 func getAttribute(name string, entry *ldap.Entry) string {
 	if strings.ToLower(name) == "dn" {
 		return entry.DN
@@ -55,3 +77,47 @@ func getArrayAttribute(name string, entry *ldap.Entry) []string {
 	}
 	return []string{}
 }
+
+// parseTeamIdentifier parses a value of the teams attribute, either "<team_id>"
+// for a team of the default org or "<org_id>:<team_id>"
+func parseTeamIdentifier(value string) (int64, int64, error) {
+	orgID := int64(1)
+
+	parts := strings.SplitN(strings.TrimSpace(value), ":", 2)
+	if len(parts) == 2 {
+		id, err := strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 64)
+		if err != nil || id <= 0 {
+			return 0, 0, xerrors.Errorf("invalid org id %q", parts[0])
+		}
+
+		orgID = id
+		parts = parts[1:]
+	}
+
+	teamID, err := strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 64)
+	if err != nil || teamID <= 0 {
+		return 0, 0, xerrors.Errorf("invalid team id %q", parts[0])
+	}
+
+	return orgID, teamID, nil
+}
+
+// generalizedTimeLayout is the layout of the LDAP generalized time (RFC 4517, section 3.3.13),
+// the optional fraction of second is parsed as well
+const generalizedTimeLayout = "20060102150405Z0700"
+
+// parseGeneralizedTime parses a LDAP generalized time, like "20191015123456.0Z"
+func parseGeneralizedTime(value string) (time.Time, error) {
+	return time.Parse(generalizedTimeLayout, strings.TrimSpace(value))
+}
+
+// hasExternalTeam checks if the team is already part of the teams
+func hasExternalTeam(teams []models.ExternalTeam, team models.ExternalTeam) bool {
+	for _, t := range teams {
+		if t.OrgId == team.OrgId && t.TeamId == team.TeamId {
+			return true
+		}
+	}
+
+	return false
+}
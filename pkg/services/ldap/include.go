@@ -0,0 +1,183 @@
+package ldap
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/grafana/grafana/pkg/util/errutil"
+)
+
+// ConfigConflictError lists the conflicts found while merging the included config files
+type ConfigConflictError struct {
+	Conflicts []string
+}
+
+func (err *ConfigConflictError) Error() string {
+	return "Conflicting LDAP config files: " + strings.Join(err.Conflicts, "; ")
+}
+
+// includedConfig is the content of an included config file, it can't include other files
+type includedConfig struct {
+	Servers       []*ServerConfig           `toml:"servers"`
+	GroupMappings []*includedGroupToOrgRole `toml:"group_mappings"`
+}
+
+// includedGroupToOrgRole is a group mapping added to one of the servers by an included file.
+// The server is identified by its "host:port", it can be omitted when the config has a single server.
+type includedGroupToOrgRole struct {
+	Server string `toml:"server"`
+	GroupToOrgRole
+}
+
+// serverKey identifies the server when merging the config files
+func serverKey(server *ServerConfig) string {
+	return fmt.Sprintf("%s:%d", server.Host, server.Port)
+}
+
+// mergeIncludes merges the files matching the include globs of the config into it,
+// the relative globs are resolved from the directory of the main config file
+func mergeIncludes(result *Config, dir string) (*Config, error) {
+	files, err := includedFiles(result.Include, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files) == 0 {
+		return result, nil
+	}
+
+	conflicts := []string{}
+	definedIn := map[string]string{}
+	for _, server := range result.Servers {
+		definedIn[serverKey(server)] = "the main config file"
+	}
+
+	mappings := map[string][]*includedGroupToOrgRole{}
+	for _, file := range files {
+		logger.Info("Reading included LDAP config file", "file", file)
+
+		included := &includedConfig{}
+		if _, err := toml.DecodeFile(file, included); err != nil {
+			return nil, errutil.Wrapf(err, "Failed to load included LDAP config file %s", file)
+		}
+
+		for _, server := range included.Servers {
+			key := serverKey(server)
+			if other, ok := definedIn[key]; ok {
+				conflicts = append(conflicts, fmt.Sprintf("server %s of %s is already defined in %s", key, file, other))
+				continue
+			}
+
+			definedIn[key] = file
+			result.Servers = append(result.Servers, server)
+		}
+
+		mappings[file] = included.GroupMappings
+	}
+
+	// the mappings are added once every server is known, so they can target the servers of any file
+	for _, file := range files {
+		for _, mapping := range mappings[file] {
+			if conflict := addIncludedMapping(result, mapping); conflict != "" {
+				conflicts = append(conflicts, fmt.Sprintf("group mapping %q of %s %s", mapping.GroupDN, file, conflict))
+			}
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return nil, &ConfigConflictError{Conflicts: conflicts}
+	}
+
+	result.includedFiles = files
+
+	return result, nil
+}
+
+// includedFiles expands the include globs, every file is only included once
+func includedFiles(globs []string, dir string) ([]string, error) {
+	files := []string{}
+	seen := map[string]bool{}
+
+	for _, glob := range globs {
+		if !filepath.IsAbs(glob) {
+			glob = filepath.Join(dir, glob)
+		}
+
+		matches, err := filepath.Glob(glob)
+		if err != nil {
+			return nil, errutil.Wrapf(err, "Failed to expand LDAP config include %q", glob)
+		}
+
+		for _, match := range matches {
+			if !seen[match] {
+				seen[match] = true
+				files = append(files, match)
+			}
+		}
+	}
+
+	return files, nil
+}
+
+// addIncludedMapping adds the mapping to its server, it returns the conflict preventing it if any.
+// A mapping identical to an existing one is only added once.
+func addIncludedMapping(result *Config, mapping *includedGroupToOrgRole) string {
+	server, conflict := mappingServer(result, mapping.Server)
+	if conflict != "" {
+		return conflict
+	}
+
+	if mapping.OrgID == 0 {
+		mapping.OrgID = server.mappingsOrgID()
+	}
+
+	for _, existing := range server.Groups {
+		orgID := existing.OrgID
+		if orgID == 0 {
+			orgID = server.mappingsOrgID()
+		}
+
+		if !strings.EqualFold(existing.GroupDN, mapping.GroupDN) || orgID != mapping.OrgID {
+			continue
+		}
+
+		if existing.OrgRole != mapping.OrgRole || !sameGrafanaAdmin(existing.IsGrafanaAdmin, mapping.IsGrafanaAdmin) {
+			return fmt.Sprintf(
+				"maps org %d to %s while server %s maps it to %s", mapping.OrgID, mapping.OrgRole, serverKey(server), existing.OrgRole,
+			)
+		}
+
+		return ""
+	}
+
+	groupMap := mapping.GroupToOrgRole
+	server.Groups = append(server.Groups, &groupMap)
+
+	return ""
+}
+
+// mappingServer finds the server targeted by an included mapping
+func mappingServer(result *Config, key string) (*ServerConfig, string) {
+	if key == "" {
+		if len(result.Servers) != 1 {
+			return nil, fmt.Sprintf("has no server while the config has %d servers", len(result.Servers))
+		}
+
+		return result.Servers[0], ""
+	}
+
+	for _, server := range result.Servers {
+		if serverKey(server) == key {
+			return server, ""
+		}
+	}
+
+	return nil, fmt.Sprintf("targets the unknown server %s", key)
+}
+
+func sameGrafanaAdmin(first, second *bool) bool {
+	return (first != nil && *first) == (second != nil && *second)
+}
@@ -0,0 +1,152 @@
+package ldap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestIncludes(t *testing.T) {
+	Convey("readConfig() with includes", t, func() {
+		dir, err := ioutil.TempDir("", "ldap")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		So(os.Mkdir(filepath.Join(dir, "ldap.d"), 0755), ShouldBeNil)
+
+		writeFile := func(name string, content string) string {
+			path := filepath.Join(dir, name)
+			So(ioutil.WriteFile(path, []byte(content), 0644), ShouldBeNil)
+			return path
+		}
+
+		main := writeFile("ldap.toml", `
+include = ["ldap.d/*.toml"]
+
+[[servers]]
+host = "ldap.example.org"
+port = 389
+search_filter = "(cn=%s)"
+search_base_dns = ["dc=grafana,dc=org"]
+
+[[servers.group_mappings]]
+group_dn = "cn=admins,dc=grafana,dc=org"
+org_role = "Admin"
+`)
+
+		Convey("Should merge the servers and the mappings of the included files", func() {
+			writeFile("ldap.d/mappings.toml", `
+[[group_mappings]]
+server = "ldap.example.org:389"
+group_dn = "cn=editors,dc=grafana,dc=org"
+org_id = 2
+org_role = "Editor"
+
+[[group_mappings]]
+server = "ldap.example.org:389"
+group_dn = "cn=admins,dc=grafana,dc=org"
+org_role = "Admin"
+`)
+			writeFile("ldap.d/servers.toml", `
+[[servers]]
+host = "ad.example.org"
+port = 636
+search_filter = "(sAMAccountName=%s)"
+search_base_dns = ["dc=example,dc=org"]
+
+[[servers.group_mappings]]
+group_dn = "cn=viewers,dc=example,dc=org"
+org_role = "Viewer"
+`)
+
+			config, err := readConfig(main)
+
+			So(err, ShouldBeNil)
+			So(config.Servers, ShouldHaveLength, 2)
+			So(config.Servers[0].Host, ShouldEqual, "ldap.example.org")
+			So(config.Servers[1].Host, ShouldEqual, "ad.example.org")
+			So(config.Servers[1].Groups[0].OrgRole, ShouldEqual, models.ROLE_VIEWER)
+
+			// the duplicate admins mapping is only kept once
+			groups := config.Servers[0].Groups
+			So(groups, ShouldHaveLength, 2)
+			So(groups[1].GroupDN, ShouldEqual, "cn=editors,dc=grafana,dc=org")
+			So(groups[1].OrgID, ShouldEqual, 2)
+			So(groups[1].OrgRole, ShouldEqual, models.ROLE_EDITOR)
+
+			So(config.Source.File, ShouldEqual, main)
+			So(config.Source.IncludedFiles, ShouldResemble, []string{
+				filepath.Join(dir, "ldap.d/mappings.toml"),
+				filepath.Join(dir, "ldap.d/servers.toml"),
+			})
+			So(config.Source.LoadedAt, ShouldNotBeZeroValue)
+		})
+
+		Convey("Should detect a server defined twice", func() {
+			writeFile("ldap.d/servers.toml", `
+[[servers]]
+host = "ldap.example.org"
+port = 389
+search_filter = "(uid=%s)"
+search_base_dns = ["dc=grafana,dc=org"]
+`)
+
+			_, err := readConfig(main)
+
+			So(err, ShouldNotBeNil)
+			conflictErr, ok := err.(*ConfigConflictError)
+			So(ok, ShouldBeTrue)
+			So(conflictErr.Conflicts, ShouldResemble, []string{
+				"server ldap.example.org:389 of " + filepath.Join(dir, "ldap.d/servers.toml") +
+					" is already defined in the main config file",
+			})
+		})
+
+		Convey("Should detect the conflicting mappings", func() {
+			writeFile("ldap.d/mappings.toml", `
+[[group_mappings]]
+group_dn = "cn=admins,dc=grafana,dc=org"
+org_role = "Viewer"
+
+[[group_mappings]]
+server = "ad.example.org:636"
+group_dn = "cn=viewers,dc=example,dc=org"
+org_role = "Viewer"
+`)
+
+			_, err := readConfig(main)
+
+			So(err, ShouldNotBeNil)
+			conflictErr, ok := err.(*ConfigConflictError)
+			So(ok, ShouldBeTrue)
+			So(conflictErr.Conflicts, ShouldHaveLength, 2)
+			So(conflictErr.Conflicts[0], ShouldContainSubstring, "maps org 1 to Viewer while server ldap.example.org:389 maps it to Admin")
+			So(conflictErr.Conflicts[1], ShouldContainSubstring, "targets the unknown server ad.example.org:636")
+		})
+
+		Convey("Should not change a config without includes", func() {
+			writeFile("ldap.d/servers.toml", `
+[[servers]]
+host = "ldap.example.org"
+port = 389
+`)
+			standalone := writeFile("standalone.toml", `
+[[servers]]
+host = "ldap.example.org"
+port = 389
+search_filter = "(cn=%s)"
+search_base_dns = ["dc=grafana,dc=org"]
+`)
+
+			config, err := readConfig(standalone)
+
+			So(err, ShouldBeNil)
+			So(config.Servers, ShouldHaveLength, 1)
+		})
+	})
+}
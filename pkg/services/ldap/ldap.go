@@ -2,16 +2,17 @@ package ldap
 
 import (
 	"crypto/tls"
-	"crypto/x509"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"math"
+	"net"
 	"strings"
+	"time"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/grafana/grafana/pkg/infra/log"
 	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
 	"gopkg.in/ldap.v3"
 )
 
@@ -29,30 +30,61 @@ type IConnection interface {
 // IServer is interface for LDAP authorization
 type IServer interface {
 	Login(*models.LoginUserQuery) (*models.ExternalUserInfo, error)
+	LoginWithTrace(*models.LoginUserQuery, *Trace) (*models.ExternalUserInfo, error)
 	Users([]string) ([]*models.ExternalUserInfo, error)
+	AllUsers() ([]*models.ExternalUserInfo, bool, error)
+	MatchingUsers(string) ([]*models.ExternalUserInfo, bool, error)
+	UsersPage(*PageCursor, uint32) ([]*models.ExternalUserInfo, *PageCursor, error)
+	ModifiedUsers(time.Time) ([]*models.ExternalUserInfo, bool, error)
+	ChangedUsers(string) ([]*models.ExternalUserInfo, string, bool, error)
+	UserPhoto(string) ([]byte, error)
+	UserAttributes(string) (map[string][]string, error)
+	Groups() ([]string, error)
+	GroupExists(string) (bool, error)
+	Certificate() *Certificate
+	Search(string, string, []string, int) ([]*SearchEntry, bool, error)
+	CheckSearch() error
 	Bind() error
 	UserBind(string, string) error
 	Dial() error
 	Close()
+	Abandoned() bool
 }
 
 // Server is basic struct of LDAP authorization
 type Server struct {
-	Config     *ServerConfig
-	Connection IConnection
-	log        log.Logger
+	Config             *ServerConfig
+	Connection         IConnection
+	CredentialProvider CredentialProvider
+	log                log.Logger
+
+	// abandoned is set once a request was given up on its timeout, see withTimeout
+	abandoned bool
 }
 
 // Bind authenticates the connection with the LDAP server
 // - with the username and password setup in the config
 // - or, anonymously
 func (server *Server) Bind() error {
-	if server.shouldAdminBind() {
-		if err := server.AdminBind(); err != nil {
+	if server.Config.IsExternalBind() {
+		return server.externalBind()
+	}
+
+	credentials, err := server.credentials()
+	if err != nil {
+		return err
+	}
+
+	if credentials.shouldAdminBind() {
+		if err := server.adminBind(credentials); err != nil {
+			return err
+		}
+	} else if credentials.shouldAnonymousBind() {
+		if err := server.anonymousBind(); err != nil {
 			return err
 		}
 	} else {
-		err := server.Connection.UnauthenticatedBind(server.Config.BindDN)
+		err := server.unauthenticatedBind(credentials.BindDN)
 		if err != nil {
 			return err
 		}
@@ -65,6 +97,10 @@ func (server *Server) Bind() error {
 // on how much items can we return in one request
 const UsersMaxRequest = 500
 
+// noAttributes is the special attribute name (RFC 4511, section 4.5.1.8)
+// which requests no attributes to be returned
+const noAttributes = "1.1"
+
 var (
 
 	// ErrInvalidCredentials is returned if username and password do not match
@@ -72,39 +108,38 @@ var (
 
 	// ErrCouldNotFindUser is returned when username hasn't been found (not username+password)
 	ErrCouldNotFindUser = errors.New("Can't find user in LDAP")
+
+	// ErrBindTimeout is returned when a bind takes longer than the bind_timeout of the server
+	ErrBindTimeout = errors.New("LDAP bind timed out")
+
+	// ErrSearchTimeout is returned when a search takes longer than the search_timeout of the server
+	ErrSearchTimeout = errors.New("LDAP search timed out")
+
+	// ErrGroupSearchNotConfigured is returned when the groups can't be searched
+	ErrGroupSearchNotConfigured = errors.New("LDAP group search requires group_search_filter and group_search_base_dns")
+
+	// ErrAmbiguousUser is returned when the user search matches several entries and the ambiguous users are refused
+	ErrAmbiguousUser = errors.New("The LDAP user search matched several entries")
+
+	// ErrSensitiveAttribute is returned when an ad hoc search asks for a sensitive attribute, like a password
+	ErrSensitiveAttribute = errors.New("The sensitive LDAP attributes, like the passwords, can't be searched")
 )
 
 // New creates the new LDAP connection
 func New(config *ServerConfig) IServer {
 	return &Server{
-		Config: config,
-		log:    log.New("ldap"),
+		Config:             config,
+		CredentialProvider: getCredentialProvider(),
+		log:                log.New("ldap"),
 	}
 }
 
 // Dial dials in the LDAP
 // TODO: decrease cyclomatic complexity
 func (server *Server) Dial() error {
-	var err error
-	var certPool *x509.CertPool
-	if server.Config.RootCACert != "" {
-		certPool = x509.NewCertPool()
-		for _, caCertFile := range strings.Split(server.Config.RootCACert, " ") {
-			pem, err := ioutil.ReadFile(caCertFile)
-			if err != nil {
-				return err
-			}
-			if !certPool.AppendCertsFromPEM(pem) {
-				return errors.New("Failed to append CA certificate " + caCertFile)
-			}
-		}
-	}
-	var clientCert tls.Certificate
-	if server.Config.ClientCert != "" && server.Config.ClientKey != "" {
-		clientCert, err = tls.LoadX509KeyPair(server.Config.ClientCert, server.Config.ClientKey)
-		if err != nil {
-			return err
-		}
+	material, err := loadTLSMaterial(server.Config)
+	if err != nil {
+		return err
 	}
 	for _, host := range strings.Split(server.Config.Host, " ") {
 		address := fmt.Sprintf("%s:%d", host, server.Config.Port)
@@ -112,23 +147,28 @@ func (server *Server) Dial() error {
 			tlsCfg := &tls.Config{
 				InsecureSkipVerify: server.Config.SkipVerifySSL,
 				ServerName:         host,
-				RootCAs:            certPool,
+				RootCAs:            material.rootCAs,
 			}
-			if len(clientCert.Certificate) > 0 {
-				tlsCfg.Certificates = append(tlsCfg.Certificates, clientCert)
+			if len(material.clientCert.Certificate) > 0 {
+				tlsCfg.Certificates = append(tlsCfg.Certificates, material.clientCert)
 			}
 			if server.Config.StartTLS {
-				server.Connection, err = ldap.Dial("tcp", address)
+				server.Connection, err = server.dial(address, nil)
 				if err == nil {
 					if err = server.Connection.StartTLS(tlsCfg); err == nil {
 						return nil
 					}
 				}
+			} else if server.Config.IsExternalBind() {
+				var conn *externalConn
+				if conn, err = dialExternal(address, tlsCfg, server.Config.dialTimeout(), server.Config.bindTimeout()); err == nil {
+					server.Connection = conn
+				}
 			} else {
-				server.Connection, err = ldap.DialTLS("tcp", address, tlsCfg)
+				server.Connection, err = server.dial(address, tlsCfg)
 			}
 		} else {
-			server.Connection, err = ldap.Dial("tcp", address)
+			server.Connection, err = server.dial(address, nil)
 		}
 
 		if err == nil {
@@ -138,6 +178,28 @@ func (server *Server) Dial() error {
 	return err
 }
 
+// dial connects to the address, over TLS with a TLS config, giving up after the dial_timeout of the server
+func (server *Server) dial(address string, tlsCfg *tls.Config) (*ldap.Conn, error) {
+	dialer := &net.Dialer{Timeout: server.Config.dialTimeout()}
+
+	var conn net.Conn
+	var err error
+	if tlsCfg == nil {
+		conn, err = dialer.Dial("tcp", address)
+	} else {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, tlsCfg)
+	}
+
+	if err != nil {
+		return nil, ldap.NewError(ldap.ErrorNetwork, err)
+	}
+
+	ldapConn := ldap.NewConn(conn, tlsCfg != nil)
+	ldapConn.Start()
+
+	return ldapConn, nil
+}
+
 // Close closes the LDAP connection
 func (server *Server) Close() {
 	server.Connection.Close()
@@ -161,73 +223,123 @@ func (server *Server) Close() {
 func (server *Server) Login(query *models.LoginUserQuery) (
 	*models.ExternalUserInfo, error,
 ) {
-	var err error
+	return server.LoginWithTrace(query, nil)
+}
+
+// LoginWithTrace logs in the user like Login does, recording each step in the trace
+func (server *Server) LoginWithTrace(query *models.LoginUserQuery, trace *Trace) (
+	*models.ExternalUserInfo, error,
+) {
 	var authAndBind bool
 
+	host := server.Config.Host
+
+	credentials, err := server.credentials()
+	if err != nil {
+		trace.Add(host, TraceStepBind, "Get the bind credentials", err)
+		return nil, err
+	}
+
 	// Check if we can use a search user
-	if server.shouldAdminBind() {
-		if err := server.AdminBind(); err != nil {
+	if server.Config.IsExternalBind() {
+		err := server.externalBind()
+		trace.Add(host, TraceStepBind, "Bind with the client certificate (SASL EXTERNAL)", err)
+		if err != nil {
 			return nil, err
 		}
-	} else if server.shouldSingleBind() {
+	} else if credentials.shouldAdminBind() {
+		err := server.adminBind(credentials)
+		trace.Add(host, TraceStepBind, "Bind with the service account "+credentials.BindDN, err)
+		if err != nil {
+			return nil, err
+		}
+	} else if credentials.shouldSingleBind() {
 		authAndBind = true
-		err = server.UserBind(
-			server.singleBindDN(query.Username),
-			query.Password,
-		)
+		bindDN := credentials.singleBindDN(query.Username)
+		err = server.UserBind(bindDN, query.Password)
+		trace.Add(host, TraceStepBind, "Bind as the user "+bindDN, err)
+		if err != nil {
+			return nil, err
+		}
+	} else if credentials.shouldAnonymousBind() {
+		// the search is anonymous, the password is verified by the user bind
+		err := server.anonymousBind()
+		trace.Add(host, TraceStepBind, "Bind anonymously to search for the user", err)
 		if err != nil {
 			return nil, err
 		}
 	} else {
-		err := server.Connection.UnauthenticatedBind(server.Config.BindDN)
+		err := server.unauthenticatedBind(credentials.BindDN)
+		trace.Add(host, TraceStepBind, "Bind without a password as "+credentials.BindDN, err)
 		if err != nil {
 			return nil, err
 		}
 	}
 
 	// Find user entry & attributes
+	search := fmt.Sprintf("Search for the user %q", query.Username)
 	users, err := server.Users([]string{query.Username})
 	if err != nil {
+		trace.Add(host, TraceStepSearch, search, err)
 		return nil, err
 	}
 
 	// If we couldn't find the user -
 	// we should show incorrect credentials err
 	if len(users) == 0 {
+		trace.Add(host, TraceStepSearch, search, ErrCouldNotFindUser)
 		return nil, ErrCouldNotFindUser
 	}
 
-	user := users[0]
-	if err := server.validateGrafanaUser(user); err != nil {
+	if len(users) > 1 {
+		server.log.Warn("LDAP user search matched several entries", "username", query.Username, "count", len(users))
+	}
+
+	user, err := PickUser(users)
+	if err != nil {
+		trace.Add(host, TraceStepSearch, fmt.Sprintf("%s matched %d entries", search, len(users)), err)
+		return nil, err
+	}
+
+	trace.Add(host, TraceStepSearch, search+" found "+user.AuthId, nil)
+
+	err = server.validateGrafanaUser(user)
+	trace.Add(host, TraceStepGroupMapping, fmt.Sprintf(
+		"Map the %d group(s) of the user to organization roles, %d organization(s) matched",
+		len(user.Groups), len(user.OrgRoles),
+	), err)
+	if err != nil {
 		return nil, err
 	}
 
 	if !authAndBind {
 		// Authenticate user
 		err = server.UserBind(user.AuthId, query.Password)
+		trace.Add(host, TraceStepUserBind, "Bind as the user "+user.AuthId, err)
 		if err != nil {
 			return nil, err
 		}
+	} else {
+		trace.Add(host, TraceStepUserBind, "Password already verified by the bind as the user", nil)
 	}
 
 	return user, nil
 }
 
-// shouldAdminBind checks if we should use
-// admin username & password for LDAP bind
-func (server *Server) shouldAdminBind() bool {
-	return server.Config.BindPassword != ""
-}
+// credentials fetches the bind credentials from the credential provider of the server
+func (server *Server) credentials() (*Credentials, error) {
+	provider := server.CredentialProvider
+	if provider == nil {
+		provider = &ConfigCredentialProvider{}
+	}
 
-// singleBindDN combines the bind with the username
-// in order to get the proper path
-func (server *Server) singleBindDN(username string) string {
-	return fmt.Sprintf(server.Config.BindDN, username)
-}
+	credentials, err := provider.Credentials(server.Config)
+	if err != nil {
+		server.log.Error("Cannot get the bind credentials for LDAP", "error", err)
+		return nil, err
+	}
 
-// shouldSingleBind checks if we can use "single bind" approach
-func (server *Server) shouldSingleBind() bool {
-	return strings.Contains(server.Config.BindDN, "%s")
+	return credentials, nil
 }
 
 // Users gets LDAP users by logins
@@ -266,6 +378,165 @@ func (server *Server) Users(logins []string) (
 	return serializedUsers, nil
 }
 
+// PickUser picks the user among the users matched by the search of a single login.
+// A search filter matching several entries is most likely too loose, so the pick is deterministic:
+// the first user by DN, unless the "reject" ambiguous_users policy refuses the user with ErrAmbiguousUser.
+func PickUser(users []*models.ExternalUserInfo) (*models.ExternalUserInfo, error) {
+	if len(users) == 0 {
+		return nil, ErrCouldNotFindUser
+	}
+
+	if len(users) == 1 {
+		return users[0], nil
+	}
+
+	if setting.LDAPAmbiguousUsers == setting.LDAPAmbiguousUsersReject {
+		return nil, ErrAmbiguousUser
+	}
+
+	first := users[0]
+	for _, user := range users[1:] {
+		if strings.ToLower(user.AuthId) < strings.ToLower(first.AuthId) {
+			first = user
+		}
+	}
+
+	return first, nil
+}
+
+// AllUsers gets all the LDAP users matching the search filter.
+// It also returns true when the size limit of the server truncated the users.
+func (server *Server) AllUsers() (
+	[]*models.ExternalUserInfo,
+	bool,
+	error,
+) {
+	var users []*ldap.Entry
+	truncatedResults := false
+
+	for _, base := range server.Config.SearchBaseDNs {
+		result, truncated, err := server.search(
+			server.getAllUsersSearchRequest(base),
+		)
+		if err != nil {
+			return nil, false, err
+		}
+
+		truncatedResults = truncatedResults || truncated
+		users = append(users, result.Entries...)
+	}
+
+	if len(users) == 0 {
+		return []*models.ExternalUserInfo{}, truncatedResults, nil
+	}
+
+	serializedUsers, err := server.serializeUsers(users)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return serializedUsers, truncatedResults, nil
+}
+
+// search runs the search request, page by page with the page_size of the server. Hitting the size limit of the server
+// isn't an error, the entries returned until then are kept and the result is flagged as truncated.
+// The referrals returned are followed when the server has follow_referrals.
+func (server *Server) search(request *ldap.SearchRequest) (*ldap.SearchResult, bool, error) {
+	result, truncated, err := server.searchServer(request)
+	if err != nil || !server.Config.FollowReferrals || len(result.Referrals) == 0 {
+		return result, truncated, err
+	}
+
+	referralsTruncated, err := server.followReferrals(request, result, server.Config.referralMaxHops(), map[string]bool{})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return result, truncated || referralsTruncated, nil
+}
+
+// searchServer runs the search request on the server only, without following the referrals, see search
+func (server *Server) searchServer(request *ldap.SearchRequest) (*ldap.SearchResult, bool, error) {
+	var result *ldap.SearchResult
+
+	// the server gives up on the search at its time limit as well, with the search_timeout of the server
+	if server.Config.SearchTimeout > 0 && request.TimeLimit == 0 {
+		limited := *request
+		limited.TimeLimit = server.Config.SearchTimeout
+		request = &limited
+	}
+
+	// the pending search is abandoned, it is released when the connection is closed
+	err := server.withTimeout(server.Config.searchTimeout(), ErrSearchTimeout, func() error {
+		var err error
+
+		// the requests already paged list their pages one by one, see UsersPage
+		if server.Config.PageSize > 0 && ldap.FindControl(request.Controls, ldap.ControlTypePaging) == nil {
+			result, err = server.searchPages(request)
+		} else {
+			result, err = server.Connection.Search(request)
+		}
+
+		return err
+	})
+
+	// the entries found before the time limit aren't all the entries, they aren't returned
+	if err == ErrSearchTimeout || ldap.IsErrorWithCode(err, ldap.LDAPResultTimeLimitExceeded) {
+		return nil, false, ErrSearchTimeout
+	}
+
+	if !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return result, false, err
+	}
+
+	server.log.Warn(
+		"LDAP search exceeded the size limit of the server, the results are truncated",
+		"base", request.BaseDN,
+		"filter", request.Filter,
+	)
+
+	// some connections drop the entries along with the size limit error
+	if result == nil {
+		result = &ldap.SearchResult{}
+	}
+
+	return result, true, nil
+}
+
+// searchPages runs the search request with the paged results control (RFC 2696), requesting the pages until the
+// server returns no cookie. It returns the entries of all the pages, including the ones before an error.
+func (server *Server) searchPages(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	result := &ldap.SearchResult{}
+	paged := *request
+
+	var cookie []byte
+	for {
+		paged.Controls = append(append([]ldap.Control{}, request.Controls...), &ldap.ControlPaging{
+			PagingSize: uint32(server.Config.PageSize),
+			Cookie:     cookie,
+		})
+
+		page, err := server.Connection.Search(&paged)
+		if page == nil {
+			return result, err
+		}
+
+		result.Entries = append(result.Entries, page.Entries...)
+		result.Referrals = append(result.Referrals, page.Referrals...)
+
+		if err != nil {
+			return result, err
+		}
+
+		control, ok := ldap.FindControl(page.Controls, ldap.ControlTypePaging).(*ldap.ControlPaging)
+		if !ok || len(control.Cookie) == 0 {
+			return result, nil
+		}
+
+		cookie = control.Cookie
+	}
+}
+
 // getUsersIteration is a helper function for Users() method.
 // It divides the users by equal parts for the anticipated requests
 func getUsersIteration(logins []string, fn func(int, int) error) error {
@@ -299,7 +570,7 @@ func (server *Server) users(logins []string) (
 	var err error
 
 	for _, base := range Config.SearchBaseDNs {
-		result, err = server.Connection.Search(
+		result, _, err = server.search(
 			server.getSearchRequest(base, logins),
 		)
 		if err != nil {
@@ -316,7 +587,8 @@ func (server *Server) users(logins []string) (
 
 // validateGrafanaUser validates user access.
 // If there are no ldap group mappings access is true
-// otherwise a single group must match
+// otherwise a single group must match.
+// The users with an invalid email are denied by the "reject" invalid_email policy
 func (server *Server) validateGrafanaUser(user *models.ExternalUserInfo) error {
 	if len(server.Config.Groups) > 0 && len(user.OrgRoles) < 1 {
 		server.log.Error(
@@ -327,6 +599,15 @@ func (server *Server) validateGrafanaUser(user *models.ExternalUserInfo) error {
 		return ErrInvalidCredentials
 	}
 
+	if err := server.Config.ValidateEmail(user.Email); err != nil {
+		if server.Config.InvalidEmail == InvalidEmailReject {
+			server.log.Error("User email is not a valid address", "username", user.Login, "email", user.Email)
+			return ErrInvalidCredentials
+		}
+
+		server.log.Warn("User email is not a valid address", "username", user.Login, "email", user.Email)
+	}
+
 	return nil
 }
 
@@ -335,25 +616,22 @@ func (server *Server) getSearchRequest(
 	base string,
 	logins []string,
 ) *ldap.SearchRequest {
-	attributes := []string{}
-
-	inputs := server.Config.Attr
-	attributes = appendIfNotEmpty(
-		attributes,
-		inputs.Username,
-		inputs.Surname,
-		inputs.Email,
-		inputs.Name,
-		inputs.MemberOf,
-
-		// In case for the POSIX LDAP schema server
-		server.Config.GroupSearchFilterUserAttribute,
-	)
+	return &ldap.SearchRequest{
+		BaseDN:       base,
+		Scope:        ldap.ScopeWholeSubtree,
+		DerefAliases: ldap.NeverDerefAliases,
+		Attributes:   SearchAttributes(server.Config),
+		Filter:       UserSearchFilter(server.Config, logins),
+	}
+}
 
+// UserSearchFilter returns the filter of the search of the users by their logins, the search_filter of the server
+// with "%s" replaced by each escaped login
+func UserSearchFilter(config *ServerConfig, logins []string) string {
 	search := ""
 	for _, login := range logins {
 		query := strings.Replace(
-			server.Config.SearchFilter,
+			config.SearchFilter,
 			"%s", ldap.EscapeFilter(login),
 			-1,
 		)
@@ -361,17 +639,70 @@ func (server *Server) getSearchRequest(
 		search = search + query
 	}
 
-	filter := fmt.Sprintf("(|%s)", search)
+	return fmt.Sprintf("(|%s)", search)
+}
+
+// getAllUsersSearchRequest returns LDAP search request for all of the users
+func (server *Server) getAllUsersSearchRequest(base string) *ldap.SearchRequest {
+	return server.getUsersSearchRequest(base, "*")
+}
+
+// getUsersSearchRequest returns LDAP search request for the users matching the escaped filter value
+func (server *Server) getUsersSearchRequest(base string, value string) *ldap.SearchRequest {
+	filter := strings.Replace(server.Config.SearchFilter, "%s", value, -1)
 
 	return &ldap.SearchRequest{
 		BaseDN:       base,
 		Scope:        ldap.ScopeWholeSubtree,
 		DerefAliases: ldap.NeverDerefAliases,
-		Attributes:   attributes,
+		Attributes:   SearchAttributes(server.Config),
 		Filter:       filter,
 	}
 }
 
+// SearchAttributes returns the list of attributes requested by the user search.
+// Only the attributes Grafana actually maps are requested, so we don't transfer
+// (potentially sensitive) attributes we have no use for.
+func SearchAttributes(config *ServerConfig) []string {
+	inputs := config.Attr
+	attributes := appendIfNotEmpty(
+		[]string{},
+		inputs.Username,
+		inputs.Surname,
+		inputs.Email,
+		inputs.Name,
+		inputs.MemberOf,
+		inputs.Phone,
+		inputs.Title,
+		inputs.Teams,
+		inputs.UpdatedAt,
+		inputs.ChangeMarker,
+		inputs.Theme,
+		inputs.Timezone,
+		inputs.HomeDashboard,
+
+		// In case for the POSIX LDAP schema server
+		config.GroupSearchFilterUserAttribute,
+	)
+
+	for _, override := range config.RoleOverrides {
+		attributes = appendIfNotEmpty(attributes, override.Attribute)
+	}
+
+	for _, mapping := range config.MetadataMappings {
+		attributes = appendIfNotEmpty(attributes, mapping.Attribute)
+	}
+
+	attributes = uniqueStrings(attributes)
+
+	// An empty list would make the server return every attribute
+	if len(attributes) == 0 {
+		return []string{noAttributes}
+	}
+
+	return attributes
+}
+
 // buildGrafanaUser extracts info from UserInfo model to ExternalUserInfo
 func (server *Server) buildGrafanaUser(user *ldap.Entry) (*models.ExternalUserInfo, error) {
 	memberOf, err := server.getMemberOf(user)
@@ -391,28 +722,114 @@ func (server *Server) buildGrafanaUser(user *ldap.Entry) (*models.ExternalUserIn
 			),
 		),
 		Login:    getAttribute(attrs.Username, user),
-		Email:    getAttribute(attrs.Email, user),
+		Email:    server.Config.normalizeEmail(getAttribute(attrs.Email, user)),
+		Phone:    getAttribute(attrs.Phone, user),
+		Title:    getAttribute(attrs.Title, user),
 		Groups:   memberOf,
 		OrgRoles: map[int64]models.RoleType{},
+
+		LockedFields: setting.LDAPLockedFields,
+		Metadata:     server.Config.userMetadata(user),
+		Preferences:  server.userPreferences(user),
+	}
+
+	if server.Config.GroupSearchFilter != "" {
+		extUser.GroupSearchFilter = server.groupSearchFilter(user)
 	}
 
+	if value := getAttribute(attrs.UpdatedAt, user); value != "" {
+		updatedAt, err := parseGeneralizedTime(value)
+		if err != nil {
+			server.log.Warn("Ignoring invalid updated at time", "user", user.DN, "value", value, "error", err)
+		} else {
+			extUser.UpdatedAt = updatedAt
+		}
+	}
+
+	// only use the winning match for each org, see role_conflict
+	winners := server.Config.winningGroups(memberOf)
 	for _, group := range server.Config.Groups {
-		// only use the first match for each org
-		if extUser.OrgRoles[group.OrgID] != "" {
+		if winners[group.OrgID] != group {
 			continue
 		}
 
-		if isMemberOf(memberOf, group.GroupDN) {
-			extUser.OrgRoles[group.OrgID] = group.OrgRole
-			if extUser.IsGrafanaAdmin == nil || !*extUser.IsGrafanaAdmin {
-				extUser.IsGrafanaAdmin = group.IsGrafanaAdmin
+		extUser.OrgRoles[group.OrgID] = group.OrgRole
+		if extUser.IsGrafanaAdmin == nil || !*extUser.IsGrafanaAdmin {
+			extUser.IsGrafanaAdmin = group.IsGrafanaAdmin
+		}
+	}
+
+	// users get a baseline role in the default org of the server, unless a group gave them one
+	if orgID := server.Config.DefaultOrgID; orgID > 0 && extUser.OrgRoles[orgID] == "" {
+		extUser.OrgRoles[orgID] = server.Config.defaultOrgRole()
+	}
+
+	extUser.StaleOrgRole = server.Config.staleOrgRole()
+
+	server.applyRoleOverrides(user, extUser)
+
+	for _, team := range server.Config.DefaultTeams {
+		extUser.Teams = append(extUser.Teams, models.ExternalTeam{
+			OrgId:     team.OrgID,
+			TeamId:    team.TeamID,
+			IsDefault: true,
+		})
+	}
+
+	for _, team := range server.getAttributeTeams(user) {
+		if hasExternalTeam(extUser.Teams, team) {
+			continue
+		}
+
+		extUser.Teams = append(extUser.Teams, team)
+	}
+
+	// the teams are synced by the servers with team mappings, even when the user is in none of them anymore
+	if len(server.Config.TeamMappings) > 0 {
+		if extUser.Teams == nil {
+			extUser.Teams = []models.ExternalTeam{}
+		}
+
+		for _, team := range server.getMappedTeams(memberOf, extUser.OrgRoles) {
+			if !hasExternalTeam(extUser.Teams, team) {
+				extUser.Teams = append(extUser.Teams, team)
 			}
 		}
 	}
 
+	// the folder permissions aren't synced by the servers without folder mappings
+	if len(server.Config.FolderMappings) > 0 {
+		extUser.FolderPermissions = server.getFolderPermissions(memberOf)
+	}
+
 	return extUser, nil
 }
 
+// getAttributeTeams returns the teams listed by the teams attribute of the user,
+// the values which aren't team identifiers are logged and ignored
+func (server *Server) getAttributeTeams(user *ldap.Entry) []models.ExternalTeam {
+	if server.Config.Attr.Teams == "" {
+		return nil
+	}
+
+	teams := []models.ExternalTeam{}
+	for _, value := range getArrayAttribute(server.Config.Attr.Teams, user) {
+		orgID, teamID, err := parseTeamIdentifier(value)
+		if err != nil {
+			server.log.Warn("Ignoring invalid team identifier", "user", user.DN, "value", value, "error", err)
+			continue
+		}
+
+		teams = append(teams, models.ExternalTeam{
+			OrgId:           orgID,
+			TeamId:          teamID,
+			IsFromAttribute: true,
+		})
+	}
+
+	return teams
+}
+
 // UserBind binds the user with the LDAP server
 func (server *Server) UserBind(username, password string) error {
 	err := server.userBind(username, password)
@@ -430,7 +847,70 @@ func (server *Server) UserBind(username, password string) error {
 
 // AdminBind binds "admin" user with LDAP
 func (server *Server) AdminBind() error {
-	err := server.userBind(server.Config.BindDN, server.Config.BindPassword)
+	credentials, err := server.credentials()
+	if err != nil {
+		return err
+	}
+
+	return server.adminBind(credentials)
+}
+
+// anonymousBind binds with LDAP without any DN, for the servers which allow anonymous searches
+func (server *Server) anonymousBind() error {
+	err := server.withBindTimeout(func() error {
+		return server.Connection.UnauthenticatedBind("")
+	})
+	if err != nil {
+		server.log.Error("Cannot bind anonymously with LDAP", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// unauthenticatedBind binds with LDAP as the DN, without a password
+func (server *Server) unauthenticatedBind(dn string) error {
+	return server.withBindTimeout(func() error {
+		return server.Connection.UnauthenticatedBind(dn)
+	})
+}
+
+// withBindTimeout runs the bind, giving up on it after the bind_timeout of the server.
+// The pending bind is abandoned, it is released when the connection is closed.
+func (server *Server) withBindTimeout(bind func() error) error {
+	return server.withTimeout(server.Config.bindTimeout(), ErrBindTimeout, bind)
+}
+
+// withTimeout runs the request, giving up on it with the timeout error after the timeout. It isn't bounded if 0.
+func (server *Server) withTimeout(timeout time.Duration, timeoutErr error, request func() error) error {
+	if timeout <= 0 {
+		return request()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- request()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		server.log.Warn(timeoutErr.Error(), "host", server.Config.Host, "timeout", timeout)
+		server.abandoned = true
+		return timeoutErr
+	}
+}
+
+// Abandoned reports whether a request was given up on its timeout. The connection may still run it,
+// a late bind could change its identity, so it must be closed instead of being reused.
+func (server *Server) Abandoned() bool {
+	return server.abandoned
+}
+
+// adminBind binds "admin" user with LDAP using the given credentials
+func (server *Server) adminBind(credentials *Credentials) error {
+	err := server.userBind(credentials.BindDN, credentials.BindPassword)
 	if err != nil {
 		server.log.Error(
 			"Cannot authentificate admin user in LDAP",
@@ -445,7 +925,9 @@ func (server *Server) AdminBind() error {
 
 // userBind binds the user with the LDAP server
 func (server *Server) userBind(path, password string) error {
-	err := server.Connection.Bind(path, password)
+	err := server.withBindTimeout(func() error {
+		return server.Connection.Bind(path, password)
+	})
 	if err != nil {
 		if ldapErr, ok := err.(*ldap.Error); ok {
 			if ldapErr.ResultCode == 49 {
@@ -458,6 +940,57 @@ func (server *Server) userBind(path, password string) error {
 	return nil
 }
 
+// Groups lists the groups matched by the group search filter in the group search base DNs
+func (server *Server) Groups() ([]string, error) {
+	config := server.Config
+
+	if config.GroupSearchFilter == "" || len(config.GroupSearchBaseDNs) == 0 {
+		return nil, ErrGroupSearchNotConfigured
+	}
+
+	filter := strings.Replace(config.GroupSearchFilter, "%s", "*", -1)
+	groupIDAttribute := server.groupIDAttribute()
+	groups := []string{}
+
+	for _, groupSearchBase := range config.GroupSearchBaseDNs {
+		result, _, err := server.search(
+			server.getGroupSearchRequest(groupSearchBase, filter),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, group := range result.Entries {
+			groups = append(groups, getAttribute(groupIDAttribute, group))
+		}
+	}
+
+	return uniqueStrings(groups), nil
+}
+
+// groupIDAttribute returns the attribute identifying the groups found by the group search
+func (server *Server) groupIDAttribute() string {
+	// support old way of reading settings
+	groupIDAttribute := server.Config.Attr.MemberOf
+	// but prefer dn attribute if default settings are used
+	if groupIDAttribute == "" || groupIDAttribute == "memberOf" {
+		groupIDAttribute = "dn"
+	}
+
+	return groupIDAttribute
+}
+
+// getGroupSearchRequest returns the request searching the groups in the base DN
+func (server *Server) getGroupSearchRequest(base string, filter string) *ldap.SearchRequest {
+	return &ldap.SearchRequest{
+		BaseDN:       base,
+		Scope:        ldap.ScopeWholeSubtree,
+		DerefAliases: ldap.NeverDerefAliases,
+		Attributes:   []string{server.groupIDAttribute()},
+		Filter:       filter,
+	}
+}
+
 // requestMemberOf use this function when POSIX LDAP
 // schema does not support memberOf, so it manually search the groups
 func (server *Server) requestMemberOf(entry *ldap.Entry) ([]string, error) {
@@ -465,40 +998,15 @@ func (server *Server) requestMemberOf(entry *ldap.Entry) ([]string, error) {
 	var config = server.Config
 
 	for _, groupSearchBase := range config.GroupSearchBaseDNs {
-		var filterReplace string
-		if config.GroupSearchFilterUserAttribute == "" {
-			filterReplace = getAttribute(config.Attr.Username, entry)
-		} else {
-			filterReplace = getAttribute(
-				config.GroupSearchFilterUserAttribute,
-				entry,
-			)
-		}
-
-		filter := strings.Replace(
-			config.GroupSearchFilter, "%s",
-			ldap.EscapeFilter(filterReplace),
-			-1,
-		)
+		filter := server.groupSearchFilter(entry)
 
 		server.log.Info("Searching for user's groups", "filter", filter)
 
-		// support old way of reading settings
-		groupIDAttribute := config.Attr.MemberOf
-		// but prefer dn attribute if default settings are used
-		if groupIDAttribute == "" || groupIDAttribute == "memberOf" {
-			groupIDAttribute = "dn"
-		}
+		groupIDAttribute := server.groupIDAttribute()
 
-		groupSearchReq := ldap.SearchRequest{
-			BaseDN:       groupSearchBase,
-			Scope:        ldap.ScopeWholeSubtree,
-			DerefAliases: ldap.NeverDerefAliases,
-			Attributes:   []string{groupIDAttribute},
-			Filter:       filter,
-		}
-
-		groupSearchResult, err := server.Connection.Search(&groupSearchReq)
+		groupSearchResult, _, err := server.search(
+			server.getGroupSearchRequest(groupSearchBase, filter),
+		)
 		if err != nil {
 			return nil, err
 		}
@@ -518,6 +1026,28 @@ func (server *Server) requestMemberOf(entry *ldap.Entry) ([]string, error) {
 	return memberOf, nil
 }
 
+// groupSearchFilter returns the filter of the search of the groups of the user, the group_search_filter of the server
+// with "%s" replaced by the escaped value of the group_search_filter_user_attribute of the user, or else of its username
+func (server *Server) groupSearchFilter(entry *ldap.Entry) string {
+	var config = server.Config
+
+	var filterReplace string
+	if config.GroupSearchFilterUserAttribute == "" {
+		filterReplace = getAttribute(config.Attr.Username, entry)
+	} else {
+		filterReplace = getAttribute(
+			config.GroupSearchFilterUserAttribute,
+			entry,
+		)
+	}
+
+	return strings.Replace(
+		config.GroupSearchFilter, "%s",
+		ldap.EscapeFilter(filterReplace),
+		-1,
+	)
+}
+
 // serializeUsers serializes the users
 // from LDAP result to ExternalInfo struct
 func (server *Server) serializeUsers(
@@ -537,19 +1067,32 @@ func (server *Server) serializeUsers(
 	return serialized, nil
 }
 
-// getMemberOf finds memberOf property or request it
+// getMemberOf finds memberOf property or request it, along with the Active Directory and nested groups when they are resolved
 func (server *Server) getMemberOf(result *ldap.Entry) (
 	[]string, error,
 ) {
+	var memberOf []string
+
 	if server.Config.GroupSearchFilter == "" {
-		memberOf := getArrayAttribute(server.Config.Attr.MemberOf, result)
+		memberOf = getArrayAttribute(server.Config.Attr.MemberOf, result)
+	} else {
+		var err error
+		memberOf, err = server.requestMemberOf(result)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-		return memberOf, nil
+	if server.Config.ActiveDirectoryGroups {
+		var err error
+		memberOf, err = server.resolveActiveDirectoryGroups(result.DN, memberOf)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	memberOf, err := server.requestMemberOf(result)
-	if err != nil {
-		return nil, err
+	if server.Config.NestedGroups != "" {
+		return server.resolveNestedGroups(result.DN, memberOf)
 	}
 
 	return memberOf, nil
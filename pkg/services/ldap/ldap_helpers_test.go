@@ -2,6 +2,7 @@ package ldap
 
 import (
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 	"gopkg.in/ldap.v3"
@@ -187,4 +188,52 @@ func TestLDAPHelpers(t *testing.T) {
 			So(result, ShouldResemble, []string{})
 		})
 	})
+
+	Convey("parseTeamIdentifier()", t, func() {
+		Convey("Should default to the default org", func() {
+			orgID, teamID, err := parseTeamIdentifier("3")
+
+			So(err, ShouldBeNil)
+			So(orgID, ShouldEqual, 1)
+			So(teamID, ShouldEqual, 3)
+		})
+
+		Convey("Should parse the org of the team", func() {
+			orgID, teamID, err := parseTeamIdentifier(" 2:4 ")
+
+			So(err, ShouldBeNil)
+			So(orgID, ShouldEqual, 2)
+			So(teamID, ShouldEqual, 4)
+		})
+
+		Convey("Should reject invalid identifiers", func() {
+			for _, value := range []string{"", "devs", "0", "devs:4", "2:", "2:devs"} {
+				_, _, err := parseTeamIdentifier(value)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+
+	Convey("parseGeneralizedTime()", t, func() {
+		Convey("Should parse the times in UTC, with or without fraction", func() {
+			for _, value := range []string{"20191015123456Z", "20191015123456.0Z"} {
+				result, err := parseGeneralizedTime(value)
+
+				So(err, ShouldBeNil)
+				So(result.Equal(time.Date(2019, 10, 15, 12, 34, 56, 0, time.UTC)), ShouldBeTrue)
+			}
+		})
+
+		Convey("Should parse the times with an offset", func() {
+			result, err := parseGeneralizedTime("20191015143456+0200")
+
+			So(err, ShouldBeNil)
+			So(result.Equal(time.Date(2019, 10, 15, 12, 34, 56, 0, time.UTC)), ShouldBeTrue)
+		})
+
+		Convey("Should reject invalid times", func() {
+			_, err := parseGeneralizedTime("yesterday")
+			So(err, ShouldNotBeNil)
+		})
+	})
 }
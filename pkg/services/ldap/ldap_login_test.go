@@ -9,6 +9,7 @@ import (
 
 	"github.com/grafana/grafana/pkg/infra/log"
 	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
 )
 
 func TestLDAPLogin(t *testing.T) {
@@ -231,4 +232,249 @@ func TestLDAPLogin(t *testing.T) {
 			So(connection.BindCalled, ShouldBeTrue)
 		})
 	})
+
+	Convey("LoginWithTrace()", t, func() {
+		newServer := func(connection *MockConnection) *Server {
+			return &Server{
+				Config: &ServerConfig{
+					Host:         "ldap.example.org",
+					BindDN:       "cn=admin,dc=grafana,dc=org",
+					BindPassword: "grafana",
+					Attr: AttributeMap{
+						Username: "username",
+						MemberOf: "memberof",
+					},
+					Groups: []*GroupToOrgRole{
+						{GroupDN: "admins", OrgID: 1, OrgRole: models.ROLE_ADMIN},
+					},
+					SearchBaseDNs: []string{"BaseDNHere"},
+				},
+				Connection: connection,
+				log:        log.New("test-logger"),
+			}
+		}
+
+		steps := func(trace *Trace) []string {
+			result := []string{}
+			for _, step := range trace.Steps {
+				result = append(result, step.Step)
+			}
+			return result
+		}
+
+		entry := ldap.Entry{
+			DN: "cn=user,dc=grafana,dc=org", Attributes: []*ldap.EntryAttribute{
+				{Name: "username", Values: []string{"user"}},
+				{Name: "memberof", Values: []string{"admins"}},
+			},
+		}
+
+		Convey("Should trace every step of a successful login", func() {
+			connection := &MockConnection{}
+			connection.setSearchResult(&ldap.SearchResult{Entries: []*ldap.Entry{&entry}})
+			connection.BindProvider = func(username, password string) error {
+				return nil
+			}
+
+			trace := NewTrace()
+			user, err := newServer(connection).LoginWithTrace(defaultLogin, trace)
+
+			So(err, ShouldBeNil)
+			So(user.Login, ShouldEqual, "user")
+			So(steps(trace), ShouldResemble, []string{
+				TraceStepBind, TraceStepSearch, TraceStepGroupMapping, TraceStepUserBind,
+			})
+
+			for _, step := range trace.Steps {
+				So(step.Server, ShouldEqual, "ldap.example.org")
+				So(step.Success, ShouldBeTrue)
+				So(step.Error, ShouldBeEmpty)
+			}
+
+			So(trace.Steps[0].Message, ShouldEqual, "Bind with the service account cn=admin,dc=grafana,dc=org")
+			So(trace.Steps[1].Message, ShouldEqual, `Search for the user "user" found cn=user,dc=grafana,dc=org`)
+			So(trace.Steps[3].Message, ShouldEqual, "Bind as the user cn=user,dc=grafana,dc=org")
+		})
+
+		Convey("Should trace a failed bind", func() {
+			connection := &MockConnection{}
+			connection.BindProvider = func(username, password string) error {
+				return &ldap.Error{ResultCode: 49}
+			}
+
+			trace := NewTrace()
+			_, err := newServer(connection).LoginWithTrace(defaultLogin, trace)
+
+			So(err, ShouldEqual, ErrInvalidCredentials)
+			So(steps(trace), ShouldResemble, []string{TraceStepBind})
+			So(trace.Steps[0].Success, ShouldBeFalse)
+			So(trace.Steps[0].Error, ShouldEqual, ErrInvalidCredentials.Error())
+		})
+
+		Convey("Should trace a search which didn't find the user", func() {
+			connection := &MockConnection{}
+			connection.setSearchResult(&ldap.SearchResult{Entries: []*ldap.Entry{}})
+			connection.BindProvider = func(username, password string) error {
+				return nil
+			}
+
+			trace := NewTrace()
+			_, err := newServer(connection).LoginWithTrace(defaultLogin, trace)
+
+			So(err, ShouldEqual, ErrCouldNotFindUser)
+			So(steps(trace), ShouldResemble, []string{TraceStepBind, TraceStepSearch})
+			So(trace.Steps[1].Success, ShouldBeFalse)
+			So(trace.Steps[1].Error, ShouldEqual, ErrCouldNotFindUser.Error())
+		})
+
+		Convey("Should log in the first user by DN when the search matches several entries", func() {
+			other := ldap.Entry{
+				DN: "cn=user,ou=archive,dc=grafana,dc=org", Attributes: []*ldap.EntryAttribute{
+					{Name: "username", Values: []string{"user"}},
+					{Name: "memberof", Values: []string{"admins"}},
+				},
+			}
+
+			connection := &MockConnection{}
+			connection.setSearchResult(&ldap.SearchResult{Entries: []*ldap.Entry{&entry, &other}})
+
+			binds := []string{}
+			connection.BindProvider = func(username, password string) error {
+				binds = append(binds, username)
+				return nil
+			}
+
+			trace := NewTrace()
+			user, err := newServer(connection).LoginWithTrace(defaultLogin, trace)
+
+			So(err, ShouldBeNil)
+			So(user.AuthId, ShouldEqual, "cn=user,dc=grafana,dc=org")
+			So(binds[len(binds)-1], ShouldEqual, "cn=user,dc=grafana,dc=org")
+		})
+
+		Convey("Should refuse a search matching several entries with the reject policy", func() {
+			policy := setting.LDAPAmbiguousUsers
+			setting.LDAPAmbiguousUsers = setting.LDAPAmbiguousUsersReject
+			defer func() { setting.LDAPAmbiguousUsers = policy }()
+
+			connection := &MockConnection{}
+			connection.setSearchResult(&ldap.SearchResult{Entries: []*ldap.Entry{&entry, &entry}})
+			connection.BindProvider = func(username, password string) error {
+				return nil
+			}
+
+			trace := NewTrace()
+			_, err := newServer(connection).LoginWithTrace(defaultLogin, trace)
+
+			So(err, ShouldEqual, ErrAmbiguousUser)
+			So(steps(trace), ShouldResemble, []string{TraceStepBind, TraceStepSearch})
+			So(trace.Steps[1].Message, ShouldEqual, `Search for the user "user" matched 2 entries`)
+			So(trace.Steps[1].Success, ShouldBeFalse)
+		})
+
+		Convey("Should trace a user without matching groups", func() {
+			connection := &MockConnection{}
+			other := ldap.Entry{
+				DN: "cn=user,dc=grafana,dc=org", Attributes: []*ldap.EntryAttribute{
+					{Name: "username", Values: []string{"user"}},
+					{Name: "memberof", Values: []string{"viewers"}},
+				},
+			}
+			connection.setSearchResult(&ldap.SearchResult{Entries: []*ldap.Entry{&other}})
+			connection.BindProvider = func(username, password string) error {
+				return nil
+			}
+
+			trace := NewTrace()
+			_, err := newServer(connection).LoginWithTrace(defaultLogin, trace)
+
+			So(err, ShouldEqual, ErrInvalidCredentials)
+			So(steps(trace), ShouldResemble, []string{TraceStepBind, TraceStepSearch, TraceStepGroupMapping})
+			So(trace.Steps[2].Success, ShouldBeFalse)
+			So(trace.Steps[2].Message, ShouldContainSubstring, "0 organization(s) matched")
+		})
+
+		Convey("Should trace a wrong password", func() {
+			connection := &MockConnection{}
+			connection.setSearchResult(&ldap.SearchResult{Entries: []*ldap.Entry{&entry}})
+			connection.BindProvider = func(username, password string) error {
+				if username == "cn=user,dc=grafana,dc=org" {
+					return &ldap.Error{ResultCode: 49}
+				}
+				return nil
+			}
+
+			trace := NewTrace()
+			_, err := newServer(connection).LoginWithTrace(defaultLogin, trace)
+
+			So(err, ShouldEqual, ErrInvalidCredentials)
+			So(steps(trace), ShouldResemble, []string{
+				TraceStepBind, TraceStepSearch, TraceStepGroupMapping, TraceStepUserBind,
+			})
+			So(trace.Steps[3].Success, ShouldBeFalse)
+		})
+
+		Convey("Should search anonymously and verify the password with the user bind", func() {
+			connection := &MockConnection{}
+			connection.setSearchResult(&ldap.SearchResult{Entries: []*ldap.Entry{&entry}})
+
+			bindUser := ""
+			bindPassword := ""
+			connection.BindProvider = func(username, password string) error {
+				bindUser = username
+				bindPassword = password
+				return nil
+			}
+
+			server := newServer(connection)
+			server.Config.BindDN = ""
+			server.Config.BindPassword = ""
+
+			trace := NewTrace()
+			user, err := server.LoginWithTrace(defaultLogin, trace)
+
+			So(err, ShouldBeNil)
+			So(user.Login, ShouldEqual, "user")
+			So(connection.UnauthenticatedBindCalled, ShouldBeTrue)
+			So(bindUser, ShouldEqual, "cn=user,dc=grafana,dc=org")
+			So(bindPassword, ShouldEqual, "pwd")
+
+			So(trace.Steps[0].Message, ShouldEqual, "Bind anonymously to search for the user")
+			So(trace.Steps[3].Step, ShouldEqual, TraceStepUserBind)
+			So(trace.Steps[3].Success, ShouldBeTrue)
+		})
+
+		Convey("Should reject a wrong password after an anonymous search", func() {
+			connection := &MockConnection{}
+			connection.setSearchResult(&ldap.SearchResult{Entries: []*ldap.Entry{&entry}})
+			connection.BindProvider = func(username, password string) error {
+				return &ldap.Error{ResultCode: 49}
+			}
+
+			server := newServer(connection)
+			server.Config.BindDN = ""
+			server.Config.BindPassword = ""
+
+			trace := NewTrace()
+			_, err := server.LoginWithTrace(defaultLogin, trace)
+
+			So(err, ShouldEqual, ErrInvalidCredentials)
+			So(connection.UnauthenticatedBindCalled, ShouldBeTrue)
+			So(trace.Steps[0].Success, ShouldBeTrue)
+			So(trace.Steps[3].Step, ShouldEqual, TraceStepUserBind)
+			So(trace.Steps[3].Success, ShouldBeFalse)
+		})
+
+		Convey("Should not record anything without a trace", func() {
+			connection := &MockConnection{}
+			connection.setSearchResult(&ldap.SearchResult{Entries: []*ldap.Entry{&entry}})
+			connection.BindProvider = func(username, password string) error {
+				return nil
+			}
+
+			_, err := newServer(connection).LoginWithTrace(defaultLogin, nil)
+
+			So(err, ShouldBeNil)
+		})
+	})
 }
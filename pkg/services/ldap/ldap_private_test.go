@@ -2,12 +2,14 @@ package ldap
 
 import (
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 	"gopkg.in/ldap.v3"
 
 	"github.com/grafana/grafana/pkg/infra/log"
 	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
 )
 
 func TestLDAPPrivateMethods(t *testing.T) {
@@ -49,6 +51,86 @@ func TestLDAPPrivateMethods(t *testing.T) {
 		})
 	})
 
+	Convey("UserSearchFilter()", t, func() {
+		Convey("Should escape each login in the search filter", func() {
+			config := &ServerConfig{SearchFilter: "(uid=%s)"}
+
+			filter := UserSearchFilter(config, []string{"roelgerrits", "hack*(er)"})
+
+			So(filter, ShouldEqual, `(|(uid=roelgerrits)(uid=hack\2a\28er\29))`)
+		})
+	})
+
+	Convey("SearchAttributes()", t, func() {
+		Convey("requests only the mapped attributes", func() {
+			config := &ServerConfig{
+				Attr: AttributeMap{
+					Username: "uid",
+					Email:    "mail",
+					MemberOf: "memberOf",
+					Teams:    "grafanaTeam",
+				},
+				GroupSearchFilterUserAttribute: "uid",
+			}
+
+			So(SearchAttributes(config), ShouldResemble, []string{
+				"uid",
+				"mail",
+				"memberOf",
+				"grafanaTeam",
+			})
+		})
+
+		Convey("does not request all attributes when nothing is mapped", func() {
+			So(SearchAttributes(&ServerConfig{}), ShouldResemble, []string{"1.1"})
+		})
+	})
+
+	Convey("requestMemberOf()", t, func() {
+		Convey("Should use the configured group search filter and base DNs", func() {
+			connection := &MockConnection{}
+			connection.SearchProvider = func(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+				if request.BaseDN != "ou=groups,dc=grafana,dc=org" {
+					return &ldap.SearchResult{}, nil
+				}
+
+				return &ldap.SearchResult{Entries: []*ldap.Entry{
+					{DN: "cn=admins,ou=groups,dc=grafana,dc=org"},
+				}}, nil
+			}
+
+			server := &Server{
+				Config: &ServerConfig{
+					Attr: AttributeMap{
+						Username: "username",
+					},
+					GroupSearchFilter:              "(&(objectClass=posixGroup)(memberUid=%s))",
+					GroupSearchFilterUserAttribute: "uid",
+					GroupSearchBaseDNs:             []string{"ou=teams,dc=grafana,dc=org", "ou=groups,dc=grafana,dc=org"},
+				},
+				Connection: connection,
+				log:        log.New("test-logger"),
+			}
+
+			entry := &ldap.Entry{
+				DN: "cn=roel,ou=users,dc=grafana,dc=org",
+				Attributes: []*ldap.EntryAttribute{
+					{Name: "username", Values: []string{"roel"}},
+					{Name: "uid", Values: []string{"roel(1)"}},
+				},
+			}
+
+			memberOf, err := server.getMemberOf(entry)
+
+			So(err, ShouldBeNil)
+			So(memberOf, ShouldResemble, []string{"cn=admins,ou=groups,dc=grafana,dc=org"})
+			So(len(connection.SearchRequests), ShouldEqual, 2)
+			So(connection.SearchRequests[0].BaseDN, ShouldEqual, "ou=teams,dc=grafana,dc=org")
+			So(connection.SearchRequests[1].BaseDN, ShouldEqual, "ou=groups,dc=grafana,dc=org")
+			So(connection.SearchRequests[1].Filter, ShouldEqual, `(&(objectClass=posixGroup)(memberUid=roel\281\29))`)
+		})
+	})
+
 	Convey("serializeUsers()", t, func() {
 		Convey("simple case", func() {
 			server := &Server{
@@ -85,6 +167,275 @@ func TestLDAPPrivateMethods(t *testing.T) {
 			So(result[0].Groups, ShouldContain, "admins")
 		})
 
+		Convey("with phone and title", func() {
+			server := &Server{
+				Config: &ServerConfig{
+					Attr: AttributeMap{
+						Username: "username",
+						Phone:    "telephoneNumber",
+						Title:    "title",
+					},
+					SearchBaseDNs: []string{"BaseDNHere"},
+				},
+				Connection: &MockConnection{},
+				log:        log.New("test-logger"),
+			}
+
+			entry := ldap.Entry{
+				DN: "dn",
+				Attributes: []*ldap.EntryAttribute{
+					{Name: "username", Values: []string{"roelgerrits"}},
+					{Name: "telephoneNumber", Values: []string{"+31 20 123 4567"}},
+					{Name: "title", Values: []string{"Engineer"}},
+				},
+			}
+
+			result, err := server.serializeUsers([]*ldap.Entry{&entry})
+
+			So(err, ShouldBeNil)
+			So(result[0].Phone, ShouldEqual, "+31 20 123 4567")
+			So(result[0].Title, ShouldEqual, "Engineer")
+		})
+
+		Convey("with locked fields", func() {
+			lockedFields := setting.LDAPLockedFields
+			setting.LDAPLockedFields = []string{"email", "name"}
+			defer func() { setting.LDAPLockedFields = lockedFields }()
+
+			server := &Server{
+				Config: &ServerConfig{
+					Attr: AttributeMap{
+						Username: "username",
+					},
+					SearchBaseDNs: []string{"BaseDNHere"},
+				},
+				Connection: &MockConnection{},
+				log:        log.New("test-logger"),
+			}
+
+			entry := ldap.Entry{
+				DN: "dn",
+				Attributes: []*ldap.EntryAttribute{
+					{Name: "username", Values: []string{"roelgerrits"}},
+				},
+			}
+
+			result, err := server.serializeUsers([]*ldap.Entry{&entry})
+
+			So(err, ShouldBeNil)
+			So(result[0].LockedFields, ShouldResemble, []string{"email", "name"})
+		})
+
+		Convey("without phone and title", func() {
+			server := &Server{
+				Config: &ServerConfig{
+					Attr: AttributeMap{
+						Username: "username",
+						Phone:    "telephoneNumber",
+						Title:    "title",
+					},
+					SearchBaseDNs: []string{"BaseDNHere"},
+				},
+				Connection: &MockConnection{},
+				log:        log.New("test-logger"),
+			}
+
+			entry := ldap.Entry{
+				DN: "dn",
+				Attributes: []*ldap.EntryAttribute{
+					{Name: "username", Values: []string{"roelgerrits"}},
+				},
+			}
+
+			result, err := server.serializeUsers([]*ldap.Entry{&entry})
+
+			So(err, ShouldBeNil)
+			So(result[0].Phone, ShouldBeEmpty)
+			So(result[0].Title, ShouldBeEmpty)
+		})
+
+		Convey("with updated at", func() {
+			server := &Server{
+				Config: &ServerConfig{
+					Attr: AttributeMap{
+						Username:  "username",
+						UpdatedAt: "whenChanged",
+					},
+					SearchBaseDNs: []string{"BaseDNHere"},
+				},
+				Connection: &MockConnection{},
+				log:        log.New("test-logger"),
+			}
+
+			changed := ldap.Entry{
+				DN: "dn",
+				Attributes: []*ldap.EntryAttribute{
+					{Name: "username", Values: []string{"roelgerrits"}},
+					{Name: "whenChanged", Values: []string{"20191015123456.0Z"}},
+				},
+			}
+
+			invalid := ldap.Entry{
+				DN: "dn",
+				Attributes: []*ldap.EntryAttribute{
+					{Name: "username", Values: []string{"roelgerrits"}},
+					{Name: "whenChanged", Values: []string{"yesterday"}},
+				},
+			}
+
+			result, err := server.serializeUsers([]*ldap.Entry{&changed, &invalid})
+
+			So(err, ShouldBeNil)
+			So(result[0].UpdatedAt.Equal(time.Date(2019, 10, 15, 12, 34, 56, 0, time.UTC)), ShouldBeTrue)
+			So(result[1].UpdatedAt.IsZero(), ShouldBeTrue)
+		})
+
+		Convey("with default teams", func() {
+			server := &Server{
+				Config: &ServerConfig{
+					Attr: AttributeMap{
+						Username: "username",
+						MemberOf: "memberof",
+					},
+					DefaultTeams: []*DefaultTeam{
+						{OrgID: 1, TeamID: 2},
+					},
+					SearchBaseDNs: []string{"BaseDNHere"},
+				},
+				Connection: &MockConnection{},
+				log:        log.New("test-logger"),
+			}
+
+			entry := ldap.Entry{
+				DN: "dn",
+				Attributes: []*ldap.EntryAttribute{
+					{Name: "username", Values: []string{"roelgerrits"}},
+				},
+			}
+
+			result, err := server.serializeUsers([]*ldap.Entry{&entry})
+
+			So(err, ShouldBeNil)
+			So(result[0].Teams, ShouldResemble, []models.ExternalTeam{
+				{OrgId: 1, TeamId: 2, IsDefault: true},
+			})
+		})
+
+		Convey("with teams attribute", func() {
+			server := &Server{
+				Config: &ServerConfig{
+					Attr: AttributeMap{
+						Username: "username",
+						MemberOf: "memberof",
+						Teams:    "grafanateam",
+					},
+					DefaultTeams: []*DefaultTeam{
+						{OrgID: 1, TeamID: 2},
+					},
+					SearchBaseDNs: []string{"BaseDNHere"},
+				},
+				Connection: &MockConnection{},
+				log:        log.New("test-logger"),
+			}
+
+			entry := ldap.Entry{
+				DN: "dn",
+				Attributes: []*ldap.EntryAttribute{
+					{Name: "username", Values: []string{"roelgerrits"}},
+					{Name: "memberof", Values: []string{"cn=users"}},
+					{Name: "grafanateam", Values: []string{"3", "2:4", "1:2", "not-a-team"}},
+				},
+			}
+
+			result, err := server.serializeUsers([]*ldap.Entry{&entry})
+
+			So(err, ShouldBeNil)
+			So(result[0].Groups, ShouldResemble, []string{"cn=users"})
+			So(result[0].Teams, ShouldResemble, []models.ExternalTeam{
+				{OrgId: 1, TeamId: 2, IsDefault: true},
+				{OrgId: 1, TeamId: 3, IsFromAttribute: true},
+				{OrgId: 2, TeamId: 4, IsFromAttribute: true},
+			})
+		})
+
+		Convey("with default orgs for two servers", func() {
+			newServer := func(defaultOrgID int64, defaultOrgRole models.RoleType) *Server {
+				return &Server{
+					Config: &ServerConfig{
+						Attr: AttributeMap{
+							Username: "username",
+							MemberOf: "memberof",
+						},
+						Groups: []*GroupToOrgRole{
+							{GroupDN: "cn=admins", OrgID: 3, OrgRole: models.ROLE_ADMIN},
+						},
+						DefaultOrgID:   defaultOrgID,
+						DefaultOrgRole: defaultOrgRole,
+						SearchBaseDNs:  []string{"BaseDNHere"},
+					},
+					Connection: &MockConnection{},
+					log:        log.New("test-logger"),
+				}
+			}
+
+			serverA := newServer(1, "")
+			serverB := newServer(2, models.ROLE_EDITOR)
+
+			entry := ldap.Entry{
+				DN: "dn",
+				Attributes: []*ldap.EntryAttribute{
+					{Name: "username", Values: []string{"roelgerrits"}},
+					{Name: "memberof", Values: []string{"cn=users"}},
+				},
+			}
+
+			resultA, err := serverA.serializeUsers([]*ldap.Entry{&entry})
+			So(err, ShouldBeNil)
+			So(resultA[0].OrgRoles, ShouldResemble, map[int64]models.RoleType{
+				1: models.ROLE_VIEWER,
+			})
+
+			resultB, err := serverB.serializeUsers([]*ldap.Entry{&entry})
+			So(err, ShouldBeNil)
+			So(resultB[0].OrgRoles, ShouldResemble, map[int64]models.RoleType{
+				2: models.ROLE_EDITOR,
+			})
+			So(serverB.validateGrafanaUser(resultB[0]), ShouldBeNil)
+		})
+
+		Convey("with a group mapping to the default org", func() {
+			server := &Server{
+				Config: &ServerConfig{
+					Attr: AttributeMap{
+						Username: "username",
+						MemberOf: "memberof",
+					},
+					Groups: []*GroupToOrgRole{
+						{GroupDN: "cn=admins", OrgID: 2, OrgRole: models.ROLE_ADMIN},
+					},
+					DefaultOrgID:  2,
+					SearchBaseDNs: []string{"BaseDNHere"},
+				},
+				Connection: &MockConnection{},
+				log:        log.New("test-logger"),
+			}
+
+			entry := ldap.Entry{
+				DN: "dn",
+				Attributes: []*ldap.EntryAttribute{
+					{Name: "username", Values: []string{"roelgerrits"}},
+					{Name: "memberof", Values: []string{"cn=admins"}},
+				},
+			}
+
+			result, err := server.serializeUsers([]*ldap.Entry{&entry})
+
+			So(err, ShouldBeNil)
+			So(result[0].OrgRoles, ShouldResemble, map[int64]models.RoleType{
+				2: models.ROLE_ADMIN,
+			})
+		})
+
 		Convey("without lastname", func() {
 			server := &Server{
 				Config: &ServerConfig{
@@ -184,61 +535,69 @@ func TestLDAPPrivateMethods(t *testing.T) {
 
 	Convey("shouldAdminBind()", t, func() {
 		Convey("it should require admin userBind", func() {
-			server := &Server{
-				Config: &ServerConfig{
-					BindPassword: "test",
-				},
+			credentials := &Credentials{
+				BindPassword: "test",
 			}
 
-			result := server.shouldAdminBind()
+			result := credentials.shouldAdminBind()
 			So(result, ShouldBeTrue)
 		})
 
 		Convey("it should not require admin userBind", func() {
-			server := &Server{
-				Config: &ServerConfig{
-					BindPassword: "",
-				},
+			credentials := &Credentials{
+				BindPassword: "",
 			}
 
-			result := server.shouldAdminBind()
+			result := credentials.shouldAdminBind()
 			So(result, ShouldBeFalse)
 		})
 	})
 
 	Convey("shouldSingleBind()", t, func() {
 		Convey("it should allow single bind", func() {
-			server := &Server{
-				Config: &ServerConfig{
-					BindDN: "cn=%s,dc=grafana,dc=org",
-				},
+			credentials := &Credentials{
+				BindDN: "cn=%s,dc=grafana,dc=org",
 			}
 
-			result := server.shouldSingleBind()
+			result := credentials.shouldSingleBind()
 			So(result, ShouldBeTrue)
 		})
 
 		Convey("it should not allow single bind", func() {
-			server := &Server{
-				Config: &ServerConfig{
-					BindDN: "cn=admin,dc=grafana,dc=org",
-				},
+			credentials := &Credentials{
+				BindDN: "cn=admin,dc=grafana,dc=org",
 			}
 
-			result := server.shouldSingleBind()
+			result := credentials.shouldSingleBind()
+			So(result, ShouldBeFalse)
+		})
+	})
+
+	Convey("shouldAnonymousBind()", t, func() {
+		Convey("it should search anonymously without bind DN", func() {
+			credentials := &Credentials{}
+
+			result := credentials.shouldAnonymousBind()
+			So(result, ShouldBeTrue)
+		})
+
+		Convey("it should not search anonymously with a bind DN", func() {
+			credentials := &Credentials{
+				BindDN: "cn=admin,dc=grafana,dc=org",
+			}
+
+			result := credentials.shouldAnonymousBind()
 			So(result, ShouldBeFalse)
 		})
 	})
 
 	Convey("singleBindDN()", t, func() {
 		Convey("it should allow single bind", func() {
-			server := &Server{
-				Config: &ServerConfig{
-					BindDN: "cn=%s,dc=grafana,dc=org",
-				},
+			credentials := &Credentials{
+				BindDN: "cn=%s,dc=grafana,dc=org",
 			}
 
-			result := server.singleBindDN("test")
+			result := credentials.singleBindDN("test")
 			So(result, ShouldEqual, "cn=test,dc=grafana,dc=org")
 		})
 	})
@@ -2,7 +2,13 @@ package ldap
 
 import (
 	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 	"gopkg.in/ldap.v3"
@@ -102,6 +108,152 @@ func TestPublicAPI(t *testing.T) {
 		})
 	})
 
+	Convey("AllUsers()", t, func() {
+		Convey("Finds all the users in every base DN", func() {
+			connection := &MockConnection{}
+			connection.SearchProvider = func(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+				entry := &ldap.Entry{
+					DN: "cn=user," + request.BaseDN, Attributes: []*ldap.EntryAttribute{
+						{Name: "username", Values: []string{"user-" + request.BaseDN}},
+					}}
+
+				return &ldap.SearchResult{Entries: []*ldap.Entry{entry}}, nil
+			}
+
+			server := &Server{
+				Config: &ServerConfig{
+					Attr: AttributeMap{
+						Username: "username",
+					},
+					SearchFilter:  "(uid=%s)",
+					SearchBaseDNs: []string{"ou=one", "ou=two"},
+				},
+				Connection: connection,
+				log:        log.New("test-logger"),
+			}
+
+			users, truncated, err := server.AllUsers()
+
+			So(err, ShouldBeNil)
+			So(truncated, ShouldBeFalse)
+			So(len(users), ShouldEqual, 2)
+			So(users[0].Login, ShouldEqual, "user-ou=one")
+			So(users[1].Login, ShouldEqual, "user-ou=two")
+			So(connection.SearchRequests[0].Filter, ShouldEqual, "(uid=*)")
+		})
+
+		Convey("Keeps the partial results when the size limit is exceeded", func() {
+			connection := &MockConnection{}
+			connection.SearchProvider = func(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+				if request.BaseDN == "ou=two" {
+					return nil, ldap.NewError(ldap.LDAPResultNoSuchObject, errors.New("no such object"))
+				}
+
+				entry := &ldap.Entry{
+					DN: "cn=user," + request.BaseDN, Attributes: []*ldap.EntryAttribute{
+						{Name: "username", Values: []string{"user-" + request.BaseDN}},
+					}}
+
+				return &ldap.SearchResult{Entries: []*ldap.Entry{entry}},
+					ldap.NewError(ldap.LDAPResultSizeLimitExceeded, errors.New("size limit exceeded"))
+			}
+
+			server := &Server{
+				Config: &ServerConfig{
+					Attr: AttributeMap{
+						Username: "username",
+					},
+					SearchFilter:  "(uid=%s)",
+					SearchBaseDNs: []string{"ou=one"},
+				},
+				Connection: connection,
+				log:        log.New("test-logger"),
+			}
+
+			users, truncated, err := server.AllUsers()
+
+			So(err, ShouldBeNil)
+			So(truncated, ShouldBeTrue)
+			So(len(users), ShouldEqual, 1)
+			So(users[0].Login, ShouldEqual, "user-ou=one")
+
+			Convey("But still fails on the other errors", func() {
+				server.Config.SearchBaseDNs = []string{"ou=one", "ou=two"}
+
+				_, _, err := server.AllUsers()
+
+				So(ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject), ShouldBeTrue)
+			})
+		})
+
+		Convey("Flags the results as truncated when the size limit error comes without entries", func() {
+			connection := &MockConnection{}
+			connection.setSearchError(ldap.NewError(ldap.LDAPResultSizeLimitExceeded, errors.New("size limit exceeded")))
+
+			server := &Server{
+				Config: &ServerConfig{
+					SearchFilter:  "(uid=%s)",
+					SearchBaseDNs: []string{"ou=one"},
+				},
+				Connection: connection,
+				log:        log.New("test-logger"),
+			}
+
+			users, truncated, err := server.AllUsers()
+
+			So(err, ShouldBeNil)
+			So(truncated, ShouldBeTrue)
+			So(users, ShouldBeEmpty)
+		})
+	})
+
+	Convey("Groups()", t, func() {
+		Convey("Finds the groups with the group search filter in every group base DN", func() {
+			connection := &MockConnection{}
+			connection.SearchProvider = func(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+				entry := &ldap.Entry{DN: "cn=devs," + request.BaseDN}
+				return &ldap.SearchResult{Entries: []*ldap.Entry{entry}}, nil
+			}
+
+			server := &Server{
+				Config: &ServerConfig{
+					SearchFilter:       "(uid=%s)",
+					SearchBaseDNs:      []string{"ou=users"},
+					GroupSearchFilter:  "(&(objectClass=posixGroup)(memberUid=%s))",
+					GroupSearchBaseDNs: []string{"ou=groups", "ou=teams"},
+				},
+				Connection: connection,
+				log:        log.New("test-logger"),
+			}
+
+			groups, err := server.Groups()
+
+			So(err, ShouldBeNil)
+			So(groups, ShouldResemble, []string{"cn=devs,ou=groups", "cn=devs,ou=teams"})
+			So(len(connection.SearchRequests), ShouldEqual, 2)
+			So(connection.SearchRequests[0].BaseDN, ShouldEqual, "ou=groups")
+			So(connection.SearchRequests[1].BaseDN, ShouldEqual, "ou=teams")
+			So(connection.SearchRequests[0].Filter, ShouldEqual, "(&(objectClass=posixGroup)(memberUid=*))")
+			So(connection.SearchRequests[0].Attributes, ShouldResemble, []string{"dn"})
+		})
+
+		Convey("Should require the group search settings", func() {
+			connection := &MockConnection{}
+			server := &Server{
+				Config: &ServerConfig{
+					GroupSearchFilter: "(&(objectClass=posixGroup)(memberUid=%s))",
+				},
+				Connection: connection,
+				log:        log.New("test-logger"),
+			}
+
+			_, err := server.Groups()
+
+			So(err, ShouldEqual, ErrGroupSearchNotConfigured)
+			So(connection.SearchCalled, ShouldBeFalse)
+		})
+	})
+
 	Convey("UserBind()", t, func() {
 		Convey("Should use provided DN and password", func() {
 			connection := &MockConnection{}
@@ -197,4 +349,274 @@ func TestPublicAPI(t *testing.T) {
 			So(err, ShouldEqual, expected)
 		})
 	})
+
+	Convey("Bind timeout", t, func() {
+		timeoutUnit = time.Millisecond
+		defer func() { timeoutUnit = time.Second }()
+
+		newServer := func(delay time.Duration) *Server {
+			connection := &MockConnection{}
+			connection.BindProvider = func(username, password string) error {
+				time.Sleep(delay)
+				return nil
+			}
+			connection.UnauthenticatedBindProvider = func() error {
+				time.Sleep(delay)
+				return nil
+			}
+
+			return &Server{
+				Connection: connection,
+				Config: &ServerConfig{
+					BindPassword: "pwd",
+					BindDN:       "cn=admin,dc=grafana,dc=org",
+					BindTimeout:  100,
+				},
+				log: log.New("test-logger"),
+			}
+		}
+
+		Convey("Should bind within the timeout", func() {
+			server := newServer(5 * time.Millisecond)
+
+			err := server.Bind()
+			So(err, ShouldBeNil)
+			So(server.Abandoned(), ShouldBeFalse)
+		})
+
+		Convey("Should give up on a bind beyond the timeout", func() {
+			server := newServer(time.Second)
+
+			start := time.Now()
+			err := server.Bind()
+
+			So(err, ShouldEqual, ErrBindTimeout)
+			So(time.Since(start), ShouldBeLessThan, time.Second)
+			So(server.Abandoned(), ShouldBeTrue)
+		})
+
+		Convey("Should give up on an anonymous bind beyond the timeout", func() {
+			server := newServer(time.Second)
+			server.Config.BindDN = ""
+			server.Config.BindPassword = ""
+
+			err := server.Bind()
+			So(err, ShouldEqual, ErrBindTimeout)
+		})
+
+		Convey("Should not bound the binds without timeout", func() {
+			server := newServer(150 * time.Millisecond)
+			server.Config.BindTimeout = 0
+
+			err := server.Bind()
+			So(err, ShouldBeNil)
+		})
+	})
+
+	Convey("Search timeout", t, func() {
+		timeoutUnit = time.Millisecond
+		defer func() { timeoutUnit = time.Second }()
+
+		newServer := func(delay time.Duration, err error) (*Server, *MockConnection) {
+			connection := &MockConnection{}
+			connection.SearchProvider = func(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+				time.Sleep(delay)
+				return &ldap.SearchResult{}, err
+			}
+
+			return &Server{
+				Connection: connection,
+				Config: &ServerConfig{
+					Attr:          AttributeMap{Username: "uid"},
+					SearchFilter:  "(uid=%s)",
+					SearchBaseDNs: []string{"dc=grafana,dc=org"},
+					SearchTimeout: 100,
+				},
+				log: log.New("test-logger"),
+			}, connection
+		}
+
+		Convey("Should send the timeout as the time limit of the searches", func() {
+			server, connection := newServer(0, nil)
+
+			_, err := server.Users([]string{"roelgerrits"})
+
+			So(err, ShouldBeNil)
+			So(connection.SearchRequests[0].TimeLimit, ShouldEqual, 100)
+		})
+
+		Convey("Should give up on a search beyond the timeout", func() {
+			server, _ := newServer(time.Second, nil)
+
+			start := time.Now()
+			_, err := server.Users([]string{"roelgerrits"})
+
+			So(err, ShouldEqual, ErrSearchTimeout)
+			So(time.Since(start), ShouldBeLessThan, time.Second)
+			So(server.Abandoned(), ShouldBeTrue)
+		})
+
+		Convey("Should fail the searches reaching the time limit of the server", func() {
+			server, _ := newServer(0, ldap.NewError(ldap.LDAPResultTimeLimitExceeded, errors.New("time limit exceeded")))
+
+			_, _, err := server.AllUsers()
+
+			So(err, ShouldEqual, ErrSearchTimeout)
+		})
+
+		Convey("Should not bound the searches without timeout", func() {
+			server, connection := newServer(150*time.Millisecond, nil)
+			server.Config.SearchTimeout = 0
+
+			_, err := server.Users([]string{"roelgerrits"})
+
+			So(err, ShouldBeNil)
+			So(connection.SearchRequests[0].TimeLimit, ShouldEqual, 0)
+		})
+	})
+
+	Convey("Dial timeout", t, func() {
+		Convey("Should default to the timeout of the LDAP library", func() {
+			So((&ServerConfig{}).dialTimeout(), ShouldEqual, ldap.DefaultTimeout)
+			So((&ServerConfig{DialTimeout: 5}).dialTimeout(), ShouldEqual, 5*time.Second)
+		})
+	})
+
+	Convey("CredentialProvider", t, func() {
+		Convey("Should fetch the credentials on every bind", func() {
+			connection := &MockConnection{}
+			var actualUsernames, actualPasswords []string
+			connection.BindProvider = func(username, password string) error {
+				actualUsernames = append(actualUsernames, username)
+				actualPasswords = append(actualPasswords, password)
+				return nil
+			}
+
+			provider := &rotatingCredentialProvider{}
+			server := &Server{
+				Connection:         connection,
+				CredentialProvider: provider,
+				Config: &ServerConfig{
+					BindDN:       "cn=admin,dc=grafana,dc=org",
+					BindPassword: "from-config",
+				},
+			}
+
+			So(server.Bind(), ShouldBeNil)
+			So(server.Bind(), ShouldBeNil)
+
+			So(provider.calls, ShouldEqual, 2)
+			So(actualUsernames, ShouldResemble, []string{"cn=admin-1,dc=grafana,dc=org", "cn=admin-2,dc=grafana,dc=org"})
+			So(actualPasswords, ShouldResemble, []string{"secret-1", "secret-2"})
+		})
+
+		Convey("Should handle a provider error", func() {
+			connection := &MockConnection{}
+			expected := errors.New("secrets manager is down")
+
+			server := &Server{
+				Connection: connection,
+				CredentialProvider: &rotatingCredentialProvider{
+					err: expected,
+				},
+				Config: &ServerConfig{},
+				log:    log.New("test-logger"),
+			}
+
+			err := server.Bind()
+
+			So(err, ShouldEqual, expected)
+			So(connection.BindCalled, ShouldBeFalse)
+			So(connection.UnauthenticatedBindCalled, ShouldBeFalse)
+		})
+
+		Convey("New() should use the registered provider", func() {
+			provider := &rotatingCredentialProvider{}
+			SetCredentialProvider(provider)
+			defer SetCredentialProvider(nil)
+
+			server := New(&ServerConfig{}).(*Server)
+
+			So(server.CredentialProvider, ShouldEqual, provider)
+		})
+
+		Convey("Should default to the configuration", func() {
+			connection := &MockConnection{}
+			var actualUsername, actualPassword string
+			connection.BindProvider = func(username, password string) error {
+				actualUsername = username
+				actualPassword = password
+				return nil
+			}
+
+			server := New(&ServerConfig{
+				BindDN:       "cn=admin,dc=grafana,dc=org",
+				BindPassword: "pwd",
+			}).(*Server)
+			server.Connection = connection
+
+			So(server.Bind(), ShouldBeNil)
+			So(actualUsername, ShouldEqual, "cn=admin,dc=grafana,dc=org")
+			So(actualPassword, ShouldEqual, "pwd")
+		})
+	})
+}
+
+// rotatingCredentialProvider returns new credentials every time they are requested
+type rotatingCredentialProvider struct {
+	calls int
+	err   error
+}
+
+func (provider *rotatingCredentialProvider) Credentials(config *ServerConfig) (*Credentials, error) {
+	if provider.err != nil {
+		return nil, provider.err
+	}
+
+	provider.calls++
+
+	return &Credentials{
+		BindDN:       fmt.Sprintf("cn=admin-%d,dc=grafana,dc=org", provider.calls),
+		BindPassword: fmt.Sprintf("secret-%d", provider.calls),
+	}, nil
+}
+
+func TestDial(t *testing.T) {
+	Convey("Dial() with a self-signed certificate", t, func() {
+		// the test server only presents its self-signed certificate, the TLS handshake is all Dial needs
+		tlsServer := httptest.NewTLSServer(http.NotFoundHandler())
+		Reset(tlsServer.Close)
+
+		host, port, err := net.SplitHostPort(tlsServer.Listener.Addr().String())
+		So(err, ShouldBeNil)
+
+		portNumber, err := strconv.Atoi(port)
+		So(err, ShouldBeNil)
+
+		newServer := func(skipVerify bool) *Server {
+			return &Server{
+				Config: &ServerConfig{
+					Host:          host,
+					Port:          portNumber,
+					UseSSL:        true,
+					SkipVerifySSL: skipVerify,
+				},
+				log: log.New("test-logger"),
+			}
+		}
+
+		Convey("Should connect when the verification is skipped", func() {
+			server := newServer(true)
+
+			So(server.Dial(), ShouldBeNil)
+			server.Close()
+		})
+
+		Convey("Should refuse the certificate otherwise", func() {
+			err := newServer(false).Dial()
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "certificate")
+		})
+	})
 }
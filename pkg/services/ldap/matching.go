@@ -0,0 +1,59 @@
+package ldap
+
+import (
+	"strings"
+
+	"gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// MatchingUsers gets the LDAP users whose login matches the query, in which "*" is a wildcard, i.e. "jo*".
+// The query takes the place of the login in the search filter. It also returns true when the size limit
+// of the server truncated the users.
+func (server *Server) MatchingUsers(query string) (
+	[]*models.ExternalUserInfo,
+	bool,
+	error,
+) {
+	var users []*ldap.Entry
+	truncatedResults := false
+
+	for _, base := range server.Config.SearchBaseDNs {
+		result, truncated, err := server.search(
+			server.getUsersSearchRequest(base, wildcardFilterValue(query)),
+		)
+		if err != nil {
+			return nil, false, err
+		}
+
+		truncatedResults = truncatedResults || truncated
+		users = append(users, result.Entries...)
+	}
+
+	if len(users) == 0 {
+		return []*models.ExternalUserInfo{}, truncatedResults, nil
+	}
+
+	serializedUsers, err := server.serializeUsers(users)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return serializedUsers, truncatedResults, nil
+}
+
+// wildcardFilterValue escapes the query for a search filter, except for its "*" wildcards.
+// An empty query matches every user.
+func wildcardFilterValue(query string) string {
+	if query == "" {
+		return "*"
+	}
+
+	parts := strings.Split(query, "*")
+	for i, part := range parts {
+		parts[i] = ldap.EscapeFilter(part)
+	}
+
+	return strings.Join(parts, "*")
+}
@@ -0,0 +1,62 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+)
+
+func TestMatchingUsers(t *testing.T) {
+	Convey("MatchingUsers()", t, func() {
+		var filters []string
+
+		connection := &MockConnection{}
+		connection.SearchProvider = func(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+			filters = append(filters, request.Filter)
+			entry := &ldap.Entry{
+				DN: "cn=john," + request.BaseDN, Attributes: []*ldap.EntryAttribute{
+					{Name: "username", Values: []string{"john"}},
+				}}
+
+			return &ldap.SearchResult{Entries: []*ldap.Entry{entry}}, nil
+		}
+
+		server := &Server{
+			Config: &ServerConfig{
+				Attr: AttributeMap{
+					Username: "username",
+				},
+				SearchFilter:  "(uid=%s)",
+				SearchBaseDNs: []string{"ou=one", "ou=two"},
+			},
+			Connection: connection,
+			log:        log.New("test-logger"),
+		}
+
+		Convey("Should search the query in every base DN", func() {
+			users, truncated, err := server.MatchingUsers("jo*")
+
+			So(err, ShouldBeNil)
+			So(truncated, ShouldBeFalse)
+			So(len(users), ShouldEqual, 2)
+			So(users[0].Login, ShouldEqual, "john")
+			So(filters, ShouldResemble, []string{"(uid=jo*)", "(uid=jo*)"})
+		})
+
+		Convey("Should escape the query but its wildcards", func() {
+			_, _, err := server.MatchingUsers("*o(h)n*")
+
+			So(err, ShouldBeNil)
+			So(filters[0], ShouldEqual, `(uid=*o\28h\29n*)`)
+		})
+	})
+
+	Convey("wildcardFilterValue()", t, func() {
+		So(wildcardFilterValue(""), ShouldEqual, "*")
+		So(wildcardFilterValue("jo*"), ShouldEqual, "jo*")
+		So(wildcardFilterValue(`a\b`), ShouldEqual, `a\5cb`)
+	})
+}
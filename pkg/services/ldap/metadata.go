@@ -0,0 +1,67 @@
+package ldap
+
+import (
+	"regexp"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/ldap.v3"
+)
+
+// metadataKeyPattern is the pattern of the keys of the metadata, like "department" or "employee_number"
+var metadataKeyPattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*$`)
+
+// MetadataMapping is a struct representation of LDAP config "metadata_mappings" setting.
+// It stores the value of an attribute of the users, like "department", under the key in the metadata of their Grafana user.
+type MetadataMapping struct {
+	Key       string `toml:"key"`
+	Attribute string `toml:"attribute"`
+}
+
+// validate checks the mapping names an attribute and a valid key
+func (mapping *MetadataMapping) validate() error {
+	if !metadataKeyPattern.MatchString(mapping.Key) {
+		return xerrors.Errorf("invalid key %q, it must start with a letter followed by letters, digits or underscores", mapping.Key)
+	}
+
+	if mapping.Attribute == "" {
+		return xerrors.Errorf("missing attribute for the key %q", mapping.Key)
+	}
+
+	return nil
+}
+
+// validateMetadataMappings checks each mapping and that no key is mapped twice
+func (config *ServerConfig) validateMetadataMappings() error {
+	keys := map[string]bool{}
+
+	for _, mapping := range config.MetadataMappings {
+		if err := mapping.validate(); err != nil {
+			return err
+		}
+
+		if keys[mapping.Key] {
+			return xerrors.Errorf("duplicate key %q", mapping.Key)
+		}
+
+		keys[mapping.Key] = true
+	}
+
+	return nil
+}
+
+// userMetadata returns the values of the mapped attributes of the user by their key, the missing attributes are left out.
+// It returns nil when the server has no metadata mappings, so the metadata of the users aren't synced.
+func (config *ServerConfig) userMetadata(user *ldap.Entry) map[string]string {
+	if len(config.MetadataMappings) == 0 {
+		return nil
+	}
+
+	metadata := map[string]string{}
+	for _, mapping := range config.MetadataMappings {
+		if value := getAttribute(mapping.Attribute, user); value != "" {
+			metadata[mapping.Key] = value
+		}
+	}
+
+	return metadata
+}
@@ -0,0 +1,126 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestMetadataMappings(t *testing.T) {
+	Convey("Metadata mappings", t, func() {
+		server := &Server{
+			Config: &ServerConfig{
+				Attr: AttributeMap{
+					Username: "username",
+					MemberOf: "memberof",
+				},
+				MetadataMappings: []*MetadataMapping{
+					{Key: "department", Attribute: "department"},
+					{Key: "employee_number", Attribute: "employeeNumber"},
+				},
+				SearchBaseDNs: []string{"BaseDNHere"},
+			},
+			Connection: &MockConnection{},
+			log:        log.New("test-logger"),
+		}
+
+		buildUser := func(attributes ...*ldap.EntryAttribute) *models.ExternalUserInfo {
+			entry := ldap.Entry{
+				DN: "dn",
+				Attributes: append([]*ldap.EntryAttribute{
+					{Name: "username", Values: []string{"roelgerrits"}},
+				}, attributes...),
+			}
+
+			users, err := server.serializeUsers([]*ldap.Entry{&entry})
+			So(err, ShouldBeNil)
+
+			return users[0]
+		}
+
+		Convey("Should map the attributes by their key", func() {
+			user := buildUser(
+				&ldap.EntryAttribute{Name: "department", Values: []string{"Engineering"}},
+				&ldap.EntryAttribute{Name: "employeeNumber", Values: []string{"1042"}},
+			)
+
+			So(user.Metadata, ShouldResemble, map[string]string{"department": "Engineering", "employee_number": "1042"})
+		})
+
+		Convey("Should leave out the missing attributes", func() {
+			user := buildUser(&ldap.EntryAttribute{Name: "department", Values: []string{"Engineering"}})
+
+			So(user.Metadata, ShouldResemble, map[string]string{"department": "Engineering"})
+		})
+
+		Convey("Should not sync the metadata without mappings", func() {
+			server.Config.MetadataMappings = nil
+
+			So(buildUser().Metadata, ShouldBeNil)
+		})
+
+		Convey("Should request the mapped attributes", func() {
+			So(SearchAttributes(server.Config), ShouldContain, "employeeNumber")
+		})
+	})
+
+	Convey("ParseConfig()", t, func() {
+		parse := func(mappings string) (*Config, error) {
+			return ParseConfig(`
+[[servers]]
+host = "127.0.0.1"
+search_filter = "(cn=%s)"
+search_base_dns = ["dc=grafana,dc=org"]
+` + mappings)
+		}
+
+		Convey("Should accept the mappings", func() {
+			config, err := parse(`
+[[servers.metadata_mappings]]
+key = "department"
+attribute = "department"
+
+[[servers.metadata_mappings]]
+key = "phone"
+attribute = "telephoneNumber"
+`)
+
+			So(err, ShouldBeNil)
+			So(config.Servers[0].MetadataMappings, ShouldHaveLength, 2)
+			So(config.Servers[0].MetadataMappings[1].Attribute, ShouldEqual, "telephoneNumber")
+		})
+
+		Convey("Should refuse an invalid key", func() {
+			_, err := parse("[[servers.metadata_mappings]]\nkey = \"cost center\"\nattribute = \"costCenter\"")
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, `invalid key "cost center"`)
+		})
+
+		Convey("Should refuse a mapping without attribute", func() {
+			_, err := parse("[[servers.metadata_mappings]]\nkey = \"department\"")
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, `missing attribute for the key "department"`)
+		})
+
+		Convey("Should refuse a key mapped twice", func() {
+			_, err := parse(`
+[[servers.metadata_mappings]]
+key = "department"
+attribute = "department"
+
+[[servers.metadata_mappings]]
+key = "department"
+attribute = "departmentNumber"
+`)
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, `duplicate key "department"`)
+		})
+	})
+}
@@ -0,0 +1,55 @@
+package ldap
+
+import (
+	"errors"
+	"time"
+
+	"gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// ErrUpdatedAtUnsupported is returned when the modified users are searched on a server without "updated_at" attribute
+var ErrUpdatedAtUnsupported = errors.New("LDAP server has no updated_at attribute to search the modified users")
+
+// ModifiedUsers searches the users whose entry changed since the given time, by their "updated_at" attribute,
+// like "modifyTimestamp". It also returns true when the size limit of the server truncated the users.
+func (server *Server) ModifiedUsers(since time.Time) (
+	[]*models.ExternalUserInfo, bool, error,
+) {
+	if server.Config.Attr.UpdatedAt == "" {
+		return nil, false, ErrUpdatedAtUnsupported
+	}
+
+	var users []*ldap.Entry
+	truncatedResults := false
+
+	for _, base := range server.Config.SearchBaseDNs {
+		request := server.getAllUsersSearchRequest(base)
+		request.Filter = modifiedSinceFilter(request.Filter, server.Config.Attr.UpdatedAt, since)
+
+		result, truncated, err := server.search(request)
+		if err != nil {
+			return nil, false, err
+		}
+
+		truncatedResults = truncatedResults || truncated
+		users = append(users, result.Entries...)
+	}
+
+	if len(users) == 0 {
+		return []*models.ExternalUserInfo{}, truncatedResults, nil
+	}
+
+	serializedUsers, err := server.serializeUsers(users)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return serializedUsers, truncatedResults, nil
+}
+
+// modifiedSinceFilter restricts the filter to the entries whose attribute is a generalized time after since
+func modifiedSinceFilter(filter string, attribute string, since time.Time) string {
+	return "(&" + filter + "(" + attribute + ">=" + since.UTC().Format("20060102150405Z") + "))"
+}
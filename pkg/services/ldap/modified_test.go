@@ -0,0 +1,72 @@
+package ldap
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+)
+
+func TestModifiedUsers(t *testing.T) {
+	Convey("ModifiedUsers()", t, func() {
+		since := time.Date(2019, 10, 15, 12, 34, 56, 0, time.FixedZone("CEST", 2*60*60))
+
+		connection := &MockConnection{}
+		connection.setSearchResult(&ldap.SearchResult{Entries: []*ldap.Entry{{
+			DN: "cn=alice,ou=one", Attributes: []*ldap.EntryAttribute{
+				{Name: "username", Values: []string{"alice"}},
+				{Name: "modifyTimestamp", Values: []string{"20191015110000Z"}},
+			}},
+		}})
+
+		server := &Server{
+			Config: &ServerConfig{
+				Attr: AttributeMap{
+					Username:  "username",
+					UpdatedAt: "modifyTimestamp",
+				},
+				SearchFilter:  "(uid=%s)",
+				SearchBaseDNs: []string{"ou=one", "ou=two"},
+			},
+			Connection: connection,
+			log:        log.New("test-logger"),
+		}
+
+		Convey("Should restrict the search of every base DN to the modified entries", func() {
+			users, truncated, err := server.ModifiedUsers(since)
+
+			So(err, ShouldBeNil)
+			So(truncated, ShouldBeFalse)
+			So(users, ShouldHaveLength, 2)
+			So(users[0].Login, ShouldEqual, "alice")
+
+			So(connection.SearchRequests, ShouldHaveLength, 2)
+			So(connection.SearchRequests[0].BaseDN, ShouldEqual, "ou=one")
+			So(connection.SearchRequests[1].BaseDN, ShouldEqual, "ou=two")
+
+			// the time is searched in UTC
+			So(connection.SearchRequests[0].Filter, ShouldEqual, "(&(uid=*)(modifyTimestamp>=20191015103456Z))")
+		})
+
+		Convey("Should flag the users truncated by the size limit", func() {
+			connection.setSearchError(&ldap.Error{ResultCode: ldap.LDAPResultSizeLimitExceeded})
+
+			_, truncated, err := server.ModifiedUsers(since)
+
+			So(err, ShouldBeNil)
+			So(truncated, ShouldBeTrue)
+		})
+
+		Convey("Should refuse a server without updated_at attribute", func() {
+			server.Config.Attr.UpdatedAt = ""
+
+			_, _, err := server.ModifiedUsers(since)
+
+			So(err, ShouldEqual, ErrUpdatedAtUnsupported)
+			So(connection.SearchCalled, ShouldBeFalse)
+		})
+	})
+}
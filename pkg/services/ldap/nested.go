@@ -0,0 +1,158 @@
+package ldap
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/ldap.v3"
+)
+
+const (
+	// NestedGroupsInChain resolves the nested groups with a single search per base DN, using the
+	// LDAP_MATCHING_RULE_IN_CHAIN matching rule of Active Directory
+	NestedGroupsInChain = "in_chain"
+
+	// NestedGroupsRecursive resolves the nested groups by searching the groups having the groups of the user
+	// as members, one level at a time, which works with any LDAP server
+	NestedGroupsRecursive = "recursive"
+)
+
+// matchingRuleInChain is the OID of LDAP_MATCHING_RULE_IN_CHAIN
+const matchingRuleInChain = "1.2.840.113556.1.4.1941"
+
+// defaultNestedGroupsMaxDepth is the number of levels of groups the recursive resolution searches by default
+const defaultNestedGroupsMaxDepth = 10
+
+// validateNestedGroups checks the nested_groups mode and its depth
+func (config *ServerConfig) validateNestedGroups() error {
+	if config.NestedGroups != "" && config.NestedGroups != NestedGroupsInChain && config.NestedGroups != NestedGroupsRecursive {
+		return xerrors.Errorf("unknown mode %q", config.NestedGroups)
+	}
+
+	if config.NestedGroupsMaxDepth < 0 {
+		return xerrors.Errorf("negative max depth %d", config.NestedGroupsMaxDepth)
+	}
+
+	return nil
+}
+
+// nestedGroupsMaxDepth returns the number of levels of groups the recursive resolution searches
+func (config *ServerConfig) nestedGroupsMaxDepth() int {
+	if config.NestedGroupsMaxDepth == 0 {
+		return defaultNestedGroupsMaxDepth
+	}
+
+	return config.NestedGroupsMaxDepth
+}
+
+// nestedGroupsMemberAttribute returns the attribute of the groups listing their members
+func (config *ServerConfig) nestedGroupsMemberAttribute() string {
+	if config.NestedGroupsMemberAttribute == "" {
+		return "member"
+	}
+
+	return config.NestedGroupsMemberAttribute
+}
+
+// nestedGroupsBaseDNs returns the base DNs the nested groups are searched in, the ones of the group search
+// or else the ones of the user search
+func (config *ServerConfig) nestedGroupsBaseDNs() []string {
+	if len(config.GroupSearchBaseDNs) > 0 {
+		return config.GroupSearchBaseDNs
+	}
+
+	return config.SearchBaseDNs
+}
+
+// resolveNestedGroups adds to the groups of the user the groups it is a member of through them, see NestedGroups
+func (server *Server) resolveNestedGroups(userDN string, memberOf []string) ([]string, error) {
+	switch server.Config.NestedGroups {
+	case NestedGroupsInChain:
+		groups, err := server.searchGroupDNs(
+			fmt.Sprintf("(%s:%s:=%s)", server.Config.nestedGroupsMemberAttribute(), matchingRuleInChain, ldap.EscapeFilter(userDN)),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		return uniqueStrings(append(memberOf, groups...)), nil
+
+	case NestedGroupsRecursive:
+		return server.recursiveGroups(memberOf)
+	}
+
+	return memberOf, nil
+}
+
+// recursiveGroups searches the parents of the groups level by level, until no new group is found
+// or the max depth is reached. The groups already found are skipped, so the cycles end the search.
+func (server *Server) recursiveGroups(memberOf []string) ([]string, error) {
+	groups := uniqueStrings(memberOf)
+
+	seen := map[string]bool{}
+	for _, group := range groups {
+		seen[strings.ToLower(group)] = true
+	}
+
+	level := groups
+	for depth := 0; len(level) > 0; depth++ {
+		if depth == server.Config.nestedGroupsMaxDepth() {
+			server.log.Warn(
+				"Stopped resolving the nested LDAP groups at the max depth",
+				"depth", depth,
+				"unresolved", level,
+			)
+			break
+		}
+
+		filter := ""
+		for _, group := range level {
+			filter += fmt.Sprintf("(%s=%s)", server.Config.nestedGroupsMemberAttribute(), ldap.EscapeFilter(group))
+		}
+
+		parents, err := server.searchGroupDNs("(|" + filter + ")")
+		if err != nil {
+			return nil, err
+		}
+
+		next := []string{}
+		for _, parent := range parents {
+			if seen[strings.ToLower(parent)] {
+				continue
+			}
+
+			seen[strings.ToLower(parent)] = true
+			next = append(next, parent)
+		}
+
+		groups = append(groups, next...)
+		level = next
+	}
+
+	return groups, nil
+}
+
+// searchGroupDNs returns the DNs of the groups matched by the filter in the nested groups base DNs
+func (server *Server) searchGroupDNs(filter string) ([]string, error) {
+	groups := []string{}
+
+	for _, base := range server.Config.nestedGroupsBaseDNs() {
+		result, _, err := server.search(&ldap.SearchRequest{
+			BaseDN:       base,
+			Scope:        ldap.ScopeWholeSubtree,
+			DerefAliases: ldap.NeverDerefAliases,
+			Attributes:   []string{noAttributes},
+			Filter:       filter,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range result.Entries {
+			groups = append(groups, entry.DN)
+		}
+	}
+
+	return uniqueStrings(groups), nil
+}
@@ -0,0 +1,201 @@
+package ldap
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestNestedGroups(t *testing.T) {
+	Convey("Nested groups", t, func() {
+		// parents are the groups having each group as member
+		parents := map[string][]string{
+			"cn=devs,ou=groups,dc=grafana,dc=org":  {"cn=staff,ou=groups,dc=grafana,dc=org"},
+			"cn=staff,ou=groups,dc=grafana,dc=org": {"cn=everyone,ou=groups,dc=grafana,dc=org"},
+
+			// a cycle between the two groups
+			"cn=everyone,ou=groups,dc=grafana,dc=org": {"cn=devs,ou=groups,dc=grafana,dc=org"},
+		}
+
+		newServer := func(nested string, maxDepth int) (*Server, *MockConnection) {
+			connection := &MockConnection{}
+
+			server := &Server{
+				Config: &ServerConfig{
+					Attr: AttributeMap{
+						Username: "username",
+						MemberOf: "memberof",
+					},
+					SearchBaseDNs:        []string{"dc=grafana,dc=org"},
+					NestedGroups:         nested,
+					NestedGroupsMaxDepth: maxDepth,
+					Groups: []*GroupToOrgRole{
+						{GroupDN: "cn=everyone,ou=groups,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_VIEWER},
+					},
+				},
+				Connection: connection,
+				log:        log.New("test-logger"),
+			}
+
+			return server, connection
+		}
+
+		buildUser := func(server *Server) (*models.ExternalUserInfo, error) {
+			entry := &ldap.Entry{
+				DN: "cn=roelgerrits,ou=users,dc=grafana,dc=org",
+				Attributes: []*ldap.EntryAttribute{
+					{Name: "username", Values: []string{"roelgerrits"}},
+					{Name: "memberof", Values: []string{"cn=devs,ou=groups,dc=grafana,dc=org"}},
+				},
+			}
+
+			return server.buildGrafanaUser(entry)
+		}
+
+		// searchParents answers the searches of the parents of the groups, "(|(member=<group>)...)"
+		searchParents := func(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+			result := &ldap.SearchResult{}
+
+			for group, groupParents := range parents {
+				if !strings.Contains(request.Filter, "(member="+ldap.EscapeFilter(group)+")") {
+					continue
+				}
+
+				for _, parent := range groupParents {
+					result.Entries = append(result.Entries, &ldap.Entry{DN: parent})
+				}
+			}
+
+			return result, nil
+		}
+
+		Convey("Should only match the direct groups by default", func() {
+			server, connection := newServer("", 0)
+
+			user, err := buildUser(server)
+
+			So(err, ShouldBeNil)
+			So(user.Groups, ShouldResemble, []string{"cn=devs,ou=groups,dc=grafana,dc=org"})
+			So(user.OrgRoles, ShouldBeEmpty)
+			So(connection.SearchCalled, ShouldBeFalse)
+		})
+
+		Convey("Should resolve the nested groups with LDAP_MATCHING_RULE_IN_CHAIN", func() {
+			server, connection := newServer(NestedGroupsInChain, 0)
+			server.Config.GroupSearchBaseDNs = []string{"ou=groups,dc=grafana,dc=org"}
+
+			connection.SearchProvider = func(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+				return &ldap.SearchResult{Entries: []*ldap.Entry{
+					{DN: "cn=devs,ou=groups,dc=grafana,dc=org"},
+					{DN: "cn=staff,ou=groups,dc=grafana,dc=org"},
+					{DN: "cn=everyone,ou=groups,dc=grafana,dc=org"},
+				}}, nil
+			}
+
+			user, err := buildUser(server)
+
+			So(err, ShouldBeNil)
+			So(user.Groups, ShouldResemble, []string{
+				"cn=devs,ou=groups,dc=grafana,dc=org",
+				"cn=staff,ou=groups,dc=grafana,dc=org",
+				"cn=everyone,ou=groups,dc=grafana,dc=org",
+			})
+			So(user.OrgRoles, ShouldResemble, map[int64]models.RoleType{1: models.ROLE_VIEWER})
+
+			So(connection.SearchRequests, ShouldHaveLength, 1)
+			So(connection.SearchRequests[0].BaseDN, ShouldEqual, "ou=groups,dc=grafana,dc=org")
+			So(connection.SearchRequests[0].Filter, ShouldEqual,
+				"(member:1.2.840.113556.1.4.1941:=cn=roelgerrits,ou=users,dc=grafana,dc=org)")
+		})
+
+		Convey("Should resolve the nested groups recursively, whatever the cycles", func() {
+			server, connection := newServer(NestedGroupsRecursive, 0)
+			connection.SearchProvider = searchParents
+
+			user, err := buildUser(server)
+
+			So(err, ShouldBeNil)
+			So(user.Groups, ShouldResemble, []string{
+				"cn=devs,ou=groups,dc=grafana,dc=org",
+				"cn=staff,ou=groups,dc=grafana,dc=org",
+				"cn=everyone,ou=groups,dc=grafana,dc=org",
+			})
+			So(user.OrgRoles, ShouldResemble, map[int64]models.RoleType{1: models.ROLE_VIEWER})
+
+			// the last level only finds the group of the cycle, which was already found
+			So(connection.SearchRequests, ShouldHaveLength, 3)
+			So(connection.SearchRequests[0].BaseDN, ShouldEqual, "dc=grafana,dc=org")
+			So(connection.SearchRequests[0].Filter, ShouldEqual, "(|(member=cn=devs,ou=groups,dc=grafana,dc=org))")
+		})
+
+		Convey("Should stop the recursive resolution at the max depth", func() {
+			server, connection := newServer(NestedGroupsRecursive, 1)
+			connection.SearchProvider = searchParents
+
+			user, err := buildUser(server)
+
+			So(err, ShouldBeNil)
+			So(user.Groups, ShouldResemble, []string{
+				"cn=devs,ou=groups,dc=grafana,dc=org",
+				"cn=staff,ou=groups,dc=grafana,dc=org",
+			})
+			So(user.OrgRoles, ShouldBeEmpty)
+			So(connection.SearchRequests, ShouldHaveLength, 1)
+		})
+
+		Convey("Should fail when the search of the groups fails", func() {
+			server, connection := newServer(NestedGroupsRecursive, 0)
+			connection.SearchProvider = func(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+				return nil, errors.New("Search error")
+			}
+
+			_, err := buildUser(server)
+
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("ParseConfig()", t, func() {
+		parse := func(settings string) (*Config, error) {
+			return ParseConfig(`
+[[servers]]
+host = "127.0.0.1"
+search_filter = "(cn=%s)"
+search_base_dns = ["dc=grafana,dc=org"]
+` + settings)
+		}
+
+		Convey("Should accept the nested groups modes", func() {
+			config, err := parse("nested_groups = \"recursive\"\nnested_groups_max_depth = 3")
+
+			So(err, ShouldBeNil)
+			So(config.Servers[0].NestedGroups, ShouldEqual, NestedGroupsRecursive)
+			So(config.Servers[0].nestedGroupsMaxDepth(), ShouldEqual, 3)
+
+			config, err = parse(`nested_groups = "in_chain"`)
+
+			So(err, ShouldBeNil)
+			So(config.Servers[0].nestedGroupsMaxDepth(), ShouldEqual, defaultNestedGroupsMaxDepth)
+		})
+
+		Convey("Should refuse an unknown mode", func() {
+			_, err := parse(`nested_groups = "deep"`)
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, `unknown mode "deep"`)
+		})
+
+		Convey("Should refuse a negative depth", func() {
+			_, err := parse("nested_groups = \"recursive\"\nnested_groups_max_depth = -1")
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "negative max depth -1")
+		})
+	})
+}
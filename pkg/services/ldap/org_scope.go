@@ -0,0 +1,83 @@
+package ldap
+
+import (
+	"golang.org/x/xerrors"
+)
+
+// validateOrgScope checks the mappings of a server scoped to an org with org_id only refer to this org,
+// the ones without org_id are scoped to it
+func (config *ServerConfig) validateOrgScope() error {
+	if config.OrgID < 0 {
+		return xerrors.Errorf("negative org id %d", config.OrgID)
+	}
+
+	if config.OrgID == 0 {
+		return nil
+	}
+
+	// the default org is only set when asked for
+	if config.DefaultOrgID != 0 && config.DefaultOrgID != config.OrgID {
+		return xerrors.Errorf("default_org_id refers to org %d, outside of org %d", config.DefaultOrgID, config.OrgID)
+	}
+
+	sections := []struct {
+		name   string
+		orgIDs []*int64
+	}{{name: "group_mappings"}, {name: "default_teams"}, {name: "team_mappings"}, {name: "folder_mappings"}, {name: "role_overrides"}}
+
+	for _, group := range config.Groups {
+		sections[0].orgIDs = append(sections[0].orgIDs, &group.OrgID)
+	}
+	for _, team := range config.DefaultTeams {
+		sections[1].orgIDs = append(sections[1].orgIDs, &team.OrgID)
+	}
+	for _, team := range config.TeamMappings {
+		sections[2].orgIDs = append(sections[2].orgIDs, &team.OrgID)
+	}
+	for _, folder := range config.FolderMappings {
+		sections[3].orgIDs = append(sections[3].orgIDs, &folder.OrgID)
+	}
+	for _, override := range config.RoleOverrides {
+		sections[4].orgIDs = append(sections[4].orgIDs, &override.OrgID)
+	}
+
+	for _, section := range sections {
+		for _, orgID := range section.orgIDs {
+			if *orgID == 0 {
+				*orgID = config.OrgID
+			}
+
+			if *orgID != config.OrgID {
+				return xerrors.Errorf("%s refers to org %d, outside of org %d", section.name, *orgID, config.OrgID)
+			}
+		}
+	}
+
+	return nil
+}
+
+// mappingsOrgID returns the org of the mappings without org_id, the org of the server or the main org
+func (config *ServerConfig) mappingsOrgID() int64 {
+	if config.OrgID > 0 {
+		return config.OrgID
+	}
+
+	return 1
+}
+
+// ServesOrg checks if the server serves the org, the servers without org_id serve every org
+func (config *ServerConfig) ServesOrg(orgID int64) bool {
+	return config.OrgID == 0 || config.OrgID == orgID
+}
+
+// ServersOfOrg returns the servers serving the org, see ServesOrg
+func (config *Config) ServersOfOrg(orgID int64) []*ServerConfig {
+	servers := []*ServerConfig{}
+	for _, server := range config.Servers {
+		if server.ServesOrg(orgID) {
+			servers = append(servers, server)
+		}
+	}
+
+	return servers
+}
@@ -0,0 +1,71 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOrgScope(t *testing.T) {
+	Convey("ParseConfig()", t, func() {
+		parse := func(settings string) (*Config, error) {
+			return ParseConfig(`
+[[servers]]
+host = "127.0.0.1"
+search_filter = "(cn=%s)"
+search_base_dns = ["dc=grafana,dc=org"]
+org_id = 2
+` + settings)
+		}
+
+		Convey("Should scope the mappings to the org of the server", func() {
+			config, err := parse(`
+[[servers.group_mappings]]
+group_dn = "cn=admins,ou=groups,dc=grafana,dc=org"
+org_role = "Admin"
+
+[[servers.team_mappings]]
+group_dn = "cn=admins,ou=groups,dc=grafana,dc=org"
+team_id = 5
+`)
+
+			So(err, ShouldBeNil)
+			So(config.Servers[0].Groups[0].OrgID, ShouldEqual, 2)
+			So(config.Servers[0].TeamMappings[0].OrgID, ShouldEqual, 2)
+			So(config.Servers[0].DefaultOrgID, ShouldEqual, 0)
+		})
+
+		Convey("Should refuse the mappings of another org", func() {
+			_, err := parse(`
+[[servers.group_mappings]]
+group_dn = "cn=admins,ou=groups,dc=grafana,dc=org"
+org_id = 1
+org_role = "Admin"
+`)
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "group_mappings refers to org 1, outside of org 2")
+
+			_, err = parse("default_org_id = 3")
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "default_org_id refers to org 3, outside of org 2")
+		})
+	})
+
+	Convey("ServersOfOrg()", t, func() {
+		config := &Config{Servers: []*ServerConfig{
+			{Host: "ldap.example.org"},
+			{Host: "ldap.tenant-a.org", OrgID: 2},
+			{Host: "ldap.tenant-b.org", OrgID: 3},
+		}}
+
+		Convey("Should return the servers of the org and the unscoped ones", func() {
+			servers := config.ServersOfOrg(2)
+
+			So(servers, ShouldHaveLength, 2)
+			So(servers[0].Host, ShouldEqual, "ldap.example.org")
+			So(servers[1].Host, ShouldEqual, "ldap.tenant-a.org")
+		})
+	})
+}
@@ -0,0 +1,71 @@
+package ldap
+
+import (
+	"strings"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// RoleOverride is a struct representation of LDAP config "role_overrides" setting.
+// It overrides the org role of the users whose attribute has the value, whatever role their groups give them.
+type RoleOverride struct {
+	Attribute string          `toml:"attribute"`
+	Value     string          `toml:"value"`
+	OrgID     int64           `toml:"org_id"`
+	OrgRole   models.RoleType `toml:"org_role"`
+}
+
+// validate checks the rule names an attribute and a valid role
+func (override *RoleOverride) validate() error {
+	if override.Attribute == "" {
+		return xerrors.Errorf("missing attribute for the value %q", override.Value)
+	}
+
+	if !override.OrgRole.IsValid() {
+		return xerrors.Errorf("invalid role %q for the attribute %q", override.OrgRole, override.Attribute)
+	}
+
+	return nil
+}
+
+// matches checks if one of the values of the attribute is the value of the rule, regardless of the case
+func (override *RoleOverride) matches(values []string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, override.Value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// applyRoleOverrides overrides the org roles of the user with the first matching rule of each org.
+// The rules only adjust the roles given by the groups or the default org, they never give a role in another org.
+func (server *Server) applyRoleOverrides(user *ldap.Entry, extUser *models.ExternalUserInfo) {
+	overridden := map[int64]bool{}
+
+	for i, override := range server.Config.RoleOverrides {
+		role := extUser.OrgRoles[override.OrgID]
+		if role == "" || overridden[override.OrgID] {
+			continue
+		}
+
+		if !override.matches(getArrayAttribute(override.Attribute, user)) {
+			continue
+		}
+
+		overridden[override.OrgID] = true
+		extUser.OrgRoles[override.OrgID] = override.OrgRole
+		extUser.RoleOverrides = append(extUser.RoleOverrides, models.ExternalRoleOverride{
+			OrgId:        override.OrgID,
+			Role:         override.OrgRole,
+			OriginalRole: role,
+			Rule:         i,
+			Attribute:    override.Attribute,
+			Value:        override.Value,
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestRoleOverrides(t *testing.T) {
+	Convey("Role overrides", t, func() {
+		server := &Server{
+			Config: &ServerConfig{
+				Attr: AttributeMap{
+					Username: "username",
+					MemberOf: "memberof",
+				},
+				Groups: []*GroupToOrgRole{
+					{GroupDN: "cn=admins", OrgID: 1, OrgRole: models.ROLE_ADMIN},
+					{GroupDN: "cn=admins", OrgID: 2, OrgRole: models.ROLE_EDITOR},
+				},
+				RoleOverrides: []*RoleOverride{
+					{Attribute: "departmentNumber", Value: "contractors", OrgID: 1, OrgRole: models.ROLE_VIEWER},
+					{Attribute: "departmentNumber", Value: "contractors", OrgID: 3, OrgRole: models.ROLE_VIEWER},
+				},
+				SearchBaseDNs: []string{"BaseDNHere"},
+			},
+			Connection: &MockConnection{},
+			log:        log.New("test-logger"),
+		}
+
+		buildUser := func(department string) *models.ExternalUserInfo {
+			entry := ldap.Entry{
+				DN: "dn",
+				Attributes: []*ldap.EntryAttribute{
+					{Name: "username", Values: []string{"roelgerrits"}},
+					{Name: "memberof", Values: []string{"cn=admins"}},
+					{Name: "departmentNumber", Values: []string{department}},
+				},
+			}
+
+			users, err := server.serializeUsers([]*ldap.Entry{&entry})
+			So(err, ShouldBeNil)
+
+			return users[0]
+		}
+
+		Convey("Should override the role given by the groups", func() {
+			user := buildUser("Contractors")
+
+			So(user.OrgRoles, ShouldResemble, map[int64]models.RoleType{1: models.ROLE_VIEWER, 2: models.ROLE_EDITOR})
+			So(user.RoleOverrides, ShouldResemble, []models.ExternalRoleOverride{{
+				OrgId:        1,
+				Role:         models.ROLE_VIEWER,
+				OriginalRole: models.ROLE_ADMIN,
+				Rule:         0,
+				Attribute:    "departmentNumber",
+				Value:        "contractors",
+			}})
+		})
+
+		Convey("Should keep the role given by the groups when no rule matches", func() {
+			user := buildUser("engineering")
+
+			So(user.OrgRoles, ShouldResemble, map[int64]models.RoleType{1: models.ROLE_ADMIN, 2: models.ROLE_EDITOR})
+			So(user.RoleOverrides, ShouldBeEmpty)
+		})
+
+		Convey("Should request the attributes of the rules", func() {
+			So(SearchAttributes(server.Config), ShouldContain, "departmentNumber")
+		})
+	})
+
+	Convey("ParseConfig()", t, func() {
+		parse := func(override string) (*Config, error) {
+			return ParseConfig(`
+[[servers]]
+host = "127.0.0.1"
+search_filter = "(cn=%s)"
+search_base_dns = ["dc=grafana,dc=org"]
+
+[[servers.role_overrides]]
+` + override)
+		}
+
+		Convey("Should default to the main org", func() {
+			config, err := parse("attribute = \"departmentNumber\"\nvalue = \"contractors\"\norg_role = \"Viewer\"")
+
+			So(err, ShouldBeNil)
+			So(config.Servers[0].RoleOverrides[0].OrgID, ShouldEqual, 1)
+		})
+
+		Convey("Should refuse an invalid role", func() {
+			_, err := parse("attribute = \"departmentNumber\"\nvalue = \"contractors\"\norg_role = \"Guest\"")
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, `invalid role "Guest"`)
+		})
+
+		Convey("Should refuse a rule without attribute", func() {
+			_, err := parse("value = \"contractors\"\norg_role = \"Viewer\"")
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "missing attribute")
+		})
+	})
+}
@@ -0,0 +1,60 @@
+package ldap
+
+import (
+	"errors"
+
+	"gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// ErrInvalidPageCursor is returned when the page cursor doesn't match the search base DNs of the server
+var ErrInvalidPageCursor = errors.New("LDAP page cursor does not match the server")
+
+// PageCursor is the position of a paged listing of the users of a server:
+// the search base DN being listed and the cookie of the paged results control (RFC 2696).
+type PageCursor struct {
+	BaseDN int
+	Cookie []byte
+}
+
+// UsersPage lists a page of at most size users, from the position of the cursor, the first page if nil.
+// A page never spans several search base DNs, so it can hold fewer users than the size.
+// The cursor of the next page is nil once every search base DN is listed.
+func (server *Server) UsersPage(cursor *PageCursor, size uint32) (
+	[]*models.ExternalUserInfo, *PageCursor, error,
+) {
+	if cursor == nil {
+		cursor = &PageCursor{}
+	}
+
+	bases := server.Config.SearchBaseDNs
+	if cursor.BaseDN < 0 || cursor.BaseDN >= len(bases) {
+		return nil, nil, ErrInvalidPageCursor
+	}
+
+	request := server.getAllUsersSearchRequest(bases[cursor.BaseDN])
+	request.Controls = []ldap.Control{&ldap.ControlPaging{PagingSize: size, Cookie: cursor.Cookie}}
+
+	result, _, err := server.search(request)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	users := []*models.ExternalUserInfo{}
+	if len(result.Entries) > 0 {
+		users, err = server.serializeUsers(result.Entries)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var next *PageCursor
+	if control, ok := ldap.FindControl(result.Controls, ldap.ControlTypePaging).(*ldap.ControlPaging); ok && len(control.Cookie) > 0 {
+		next = &PageCursor{BaseDN: cursor.BaseDN, Cookie: control.Cookie}
+	} else if cursor.BaseDN+1 < len(bases) {
+		next = &PageCursor{BaseDN: cursor.BaseDN + 1}
+	}
+
+	return users, next, nil
+}
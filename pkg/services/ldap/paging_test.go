@@ -0,0 +1,212 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestUsersPage(t *testing.T) {
+	Convey("UsersPage()", t, func() {
+		// the directory pages are keyed by base DN and cookie, with the cookie of the next page
+		directory := map[string]map[string]struct {
+			logins []string
+			next   string
+		}{
+			"ou=one": {
+				"":   {logins: []string{"alice", "bob"}, next: "p2"},
+				"p2": {logins: []string{"carol"}},
+			},
+			"ou=two": {
+				"": {logins: []string{"dave"}},
+			},
+		}
+
+		connection := &MockConnection{}
+		connection.SearchProvider = func(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+			paging := ldap.FindControl(request.Controls, ldap.ControlTypePaging).(*ldap.ControlPaging)
+			page := directory[request.BaseDN][string(paging.Cookie)]
+
+			result := &ldap.SearchResult{}
+			for _, login := range page.logins {
+				result.Entries = append(result.Entries, &ldap.Entry{
+					DN: "cn=" + login + "," + request.BaseDN, Attributes: []*ldap.EntryAttribute{
+						{Name: "username", Values: []string{login}},
+					}})
+			}
+
+			result.Controls = []ldap.Control{&ldap.ControlPaging{Cookie: []byte(page.next)}}
+
+			return result, nil
+		}
+
+		server := &Server{
+			Config: &ServerConfig{
+				Attr: AttributeMap{
+					Username: "username",
+				},
+				SearchFilter:  "(uid=%s)",
+				SearchBaseDNs: []string{"ou=one", "ou=two"},
+			},
+			Connection: connection,
+			log:        log.New("test-logger"),
+		}
+
+		Convey("Should page through every base DN with the cookies", func() {
+			logins := []string{}
+			pages := 0
+
+			var cursor *PageCursor
+			for {
+				users, next, err := server.UsersPage(cursor, 2)
+				So(err, ShouldBeNil)
+
+				pages++
+				for _, user := range users {
+					logins = append(logins, user.Login)
+				}
+
+				if next == nil {
+					break
+				}
+
+				cursor = next
+			}
+
+			So(pages, ShouldEqual, 3)
+			So(logins, ShouldResemble, []string{"alice", "bob", "carol", "dave"})
+
+			paging := connection.SearchRequests[0].Controls[0].(*ldap.ControlPaging)
+			So(paging.PagingSize, ShouldEqual, 2)
+			So(connection.SearchRequests[0].Filter, ShouldEqual, "(uid=*)")
+		})
+
+		Convey("Should continue the base DN with the cookie of the cursor", func() {
+			users, next, err := server.UsersPage(&PageCursor{BaseDN: 0, Cookie: []byte("p2")}, 2)
+
+			So(err, ShouldBeNil)
+			So(users, ShouldHaveLength, 1)
+			So(users[0].Login, ShouldEqual, "carol")
+			So(next, ShouldResemble, &PageCursor{BaseDN: 1})
+		})
+
+		Convey("Should refuse a cursor beyond the base DNs", func() {
+			_, _, err := server.UsersPage(&PageCursor{BaseDN: 2}, 2)
+
+			So(err, ShouldEqual, ErrInvalidPageCursor)
+		})
+	})
+}
+
+func TestPagedSearch(t *testing.T) {
+	Convey("Paged searches", t, func() {
+		// the directory pages are keyed by cookie, with the cookie of the next page
+		directory := map[string]struct {
+			logins []string
+			next   string
+			err    error
+		}{
+			"":   {logins: []string{"alice", "bob"}, next: "p2"},
+			"p2": {logins: []string{"carol"}},
+		}
+
+		connection := &MockConnection{}
+		connection.SearchProvider = func(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+			result := &ldap.SearchResult{}
+
+			paging, ok := ldap.FindControl(request.Controls, ldap.ControlTypePaging).(*ldap.ControlPaging)
+			if !ok {
+				// without paging, the server truncates the search at its size limit
+				result.Entries = append(result.Entries, &ldap.Entry{
+					DN: "cn=alice", Attributes: []*ldap.EntryAttribute{{Name: "username", Values: []string{"alice"}}},
+				})
+				return result, ldap.NewError(ldap.LDAPResultSizeLimitExceeded, nil)
+			}
+
+			page := directory[string(paging.Cookie)]
+			for _, login := range page.logins {
+				result.Entries = append(result.Entries, &ldap.Entry{
+					DN: "cn=" + login, Attributes: []*ldap.EntryAttribute{{Name: "username", Values: []string{login}}},
+				})
+			}
+
+			result.Controls = []ldap.Control{&ldap.ControlPaging{Cookie: []byte(page.next)}}
+
+			return result, page.err
+		}
+
+		server := &Server{
+			Config: &ServerConfig{
+				Attr: AttributeMap{
+					Username: "username",
+				},
+				SearchFilter:  "(uid=%s)",
+				SearchBaseDNs: []string{"ou=users"},
+				PageSize:      2,
+			},
+			Connection: connection,
+			log:        log.New("test-logger"),
+		}
+
+		logins := func(users []*models.ExternalUserInfo) []string {
+			result := []string{}
+			for _, user := range users {
+				result = append(result, user.Login)
+			}
+			return result
+		}
+
+		Convey("Should request every page of the search", func() {
+			users, truncated, err := server.AllUsers()
+
+			So(err, ShouldBeNil)
+			So(truncated, ShouldBeFalse)
+			So(logins(users), ShouldResemble, []string{"alice", "bob", "carol"})
+
+			So(connection.SearchRequests, ShouldHaveLength, 2)
+			for _, request := range connection.SearchRequests {
+				paging := ldap.FindControl(request.Controls, ldap.ControlTypePaging).(*ldap.ControlPaging)
+				So(paging.PagingSize, ShouldEqual, 2)
+			}
+		})
+
+		Convey("Should keep the pages before the size limit of the server", func() {
+			directory["p2"] = struct {
+				logins []string
+				next   string
+				err    error
+			}{logins: []string{"carol"}, next: "p3", err: ldap.NewError(ldap.LDAPResultSizeLimitExceeded, nil)}
+
+			users, truncated, err := server.AllUsers()
+
+			So(err, ShouldBeNil)
+			So(truncated, ShouldBeTrue)
+			So(logins(users), ShouldResemble, []string{"alice", "bob", "carol"})
+		})
+
+		Convey("Should not page the searches without page size", func() {
+			server.Config.PageSize = 0
+
+			users, truncated, err := server.AllUsers()
+
+			So(err, ShouldBeNil)
+			So(truncated, ShouldBeTrue)
+			So(logins(users), ShouldResemble, []string{"alice"})
+		})
+
+		Convey("Should keep the page size of the paged listings", func() {
+			users, next, err := server.UsersPage(nil, 5)
+
+			So(err, ShouldBeNil)
+			So(logins(users), ShouldResemble, []string{"alice", "bob"})
+			So(next, ShouldResemble, &PageCursor{BaseDN: 0, Cookie: []byte("p2")})
+
+			So(connection.SearchRequests, ShouldHaveLength, 1)
+			So(connection.SearchRequests[0].Controls, ShouldHaveLength, 1)
+		})
+	})
+}
@@ -0,0 +1,53 @@
+package ldap
+
+import (
+	"strings"
+
+	"gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// UserPhoto returns the raw bytes of the "photo" attribute of the user, like "jpegPhoto", nil when the user has no photo
+// or the server no photo attribute. The bytes are the ones of the directory, they aren't decoded as text.
+// The entry is picked like PickUser does when the search matches several ones.
+func (server *Server) UserPhoto(login string) ([]byte, error) {
+	attribute := server.Config.Attr.Photo
+
+	// the user is still searched without photo attribute, to tell it apart from a missing user
+	attributes := []string{noAttributes}
+	if attribute != "" {
+		attributes = []string{attribute}
+	}
+
+	entry, err := server.findUserEntry(login, attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	if attribute == "" {
+		return nil, nil
+	}
+
+	if photo := entry.GetRawAttributeValue(attribute); len(photo) > 0 {
+		return photo, nil
+	}
+
+	return nil, nil
+}
+
+// pickEntry picks the first entry by DN, unless the "reject" ambiguous_users policy refuses several entries
+func pickEntry(entries []*ldap.Entry) (*ldap.Entry, error) {
+	if len(entries) > 1 && setting.LDAPAmbiguousUsers == setting.LDAPAmbiguousUsersReject {
+		return nil, ErrAmbiguousUser
+	}
+
+	first := entries[0]
+	for _, entry := range entries[1:] {
+		if strings.ToLower(entry.DN) < strings.ToLower(first.DN) {
+			first = entry
+		}
+	}
+
+	return first, nil
+}
@@ -0,0 +1,122 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+)
+
+func TestUserPhoto(t *testing.T) {
+	Convey("UserPhoto()", t, func() {
+		// the start of a JPEG file, which isn't valid UTF-8
+		photo := []byte{0xff, 0xd8, 0xff, 0xe0, 0x00, 0x10, 'J', 'F', 'I', 'F', 0x00, 0x80, 0xfe}
+
+		connection := &MockConnection{}
+		connection.setSearchResult(&ldap.SearchResult{Entries: []*ldap.Entry{{
+			DN: "cn=johndoe,ou=users,dc=grafana,dc=org", Attributes: []*ldap.EntryAttribute{
+				{Name: "jpegPhoto", Values: []string{string(photo)}, ByteValues: [][]byte{photo}},
+			}},
+		}})
+
+		server := &Server{
+			Config: &ServerConfig{
+				Attr: AttributeMap{
+					Username: "cn",
+					Photo:    "jpegPhoto",
+				},
+				SearchFilter:  "(cn=%s)",
+				SearchBaseDNs: []string{"dc=grafana,dc=org"},
+			},
+			Connection: connection,
+			log:        log.New("test-logger"),
+		}
+
+		Convey("Should return the raw bytes of the photo", func() {
+			result, err := server.UserPhoto("johndoe")
+
+			So(err, ShouldBeNil)
+			So(result, ShouldResemble, photo)
+
+			So(connection.SearchRequests[0].Filter, ShouldEqual, "(|(cn=johndoe))")
+			So(connection.SearchRequests[0].Attributes, ShouldResemble, []string{"jpegPhoto"})
+		})
+
+		Convey("Should return no photo when the user has none", func() {
+			connection.setSearchResult(&ldap.SearchResult{Entries: []*ldap.Entry{{DN: "cn=johndoe,ou=users,dc=grafana,dc=org"}}})
+
+			result, err := server.UserPhoto("johndoe")
+
+			So(err, ShouldBeNil)
+			So(result, ShouldBeNil)
+		})
+
+		Convey("Should return no photo without photo attribute", func() {
+			server.Config.Attr.Photo = ""
+
+			result, err := server.UserPhoto("johndoe")
+
+			So(err, ShouldBeNil)
+			So(result, ShouldBeNil)
+			So(connection.SearchRequests[0].Attributes, ShouldResemble, []string{noAttributes})
+		})
+
+		Convey("Should fail for a missing user", func() {
+			connection.setSearchResult(&ldap.SearchResult{})
+
+			_, err := server.UserPhoto("johndoe")
+
+			So(err, ShouldEqual, ErrCouldNotFindUser)
+		})
+	})
+}
+
+func TestUserAttributes(t *testing.T) {
+	Convey("UserAttributes()", t, func() {
+		connection := &MockConnection{}
+		connection.setSearchResult(&ldap.SearchResult{Entries: []*ldap.Entry{{
+			DN: "cn=johndoe,ou=users,dc=grafana,dc=org", Attributes: []*ldap.EntryAttribute{
+				{Name: "mail", Values: []string{"john.doe@example.com"}},
+				{Name: "userPrincipalName", Values: []string{"jdoe@corp.example.com"}},
+				{Name: "userPassword", Values: []string{"{SSHA}secret"}},
+				{Name: "unicodePwd", Values: []string{"secret"}},
+				{Name: "userPassword;binary", Values: []string{"secret"}},
+				{Name: "1.2.840.113556.1.4.90", Values: []string{"secret"}},
+			}},
+		}})
+
+		server := &Server{
+			Config: &ServerConfig{
+				Attr: AttributeMap{
+					Username: "cn",
+				},
+				SearchFilter:  "(cn=%s)",
+				SearchBaseDNs: []string{"dc=grafana,dc=org"},
+			},
+			Connection: connection,
+			log:        log.New("test-logger"),
+		}
+
+		Convey("Should return every attribute but the passwords", func() {
+			result, err := server.UserAttributes("johndoe")
+
+			So(err, ShouldBeNil)
+			So(result, ShouldResemble, map[string][]string{
+				"mail":              {"john.doe@example.com"},
+				"userPrincipalName": {"jdoe@corp.example.com"},
+			})
+
+			So(connection.SearchRequests[0].Attributes, ShouldBeNil)
+		})
+
+		Convey("Should fail for a missing user", func() {
+			connection.setSearchResult(&ldap.SearchResult{})
+
+			_, err := server.UserAttributes("johndoe")
+
+			So(err, ShouldEqual, ErrCouldNotFindUser)
+		})
+	})
+}
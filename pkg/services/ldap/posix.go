@@ -0,0 +1,51 @@
+package ldap
+
+import (
+	"golang.org/x/xerrors"
+)
+
+const (
+	// GroupMembershipMemberOf reads the groups of the users from their memberOf attribute, or searches them
+	// with group_search_filter when it's set. It is the default
+	GroupMembershipMemberOf = "member_of"
+
+	// GroupMembershipPosix searches the posixGroup entries listing the uid of the users in their memberUid attribute
+	GroupMembershipPosix = "posix"
+)
+
+// Defaults of the group search of the posix group membership
+const (
+	posixGroupSearchFilter              = "(&(objectClass=posixGroup)(memberUid=%s))"
+	posixGroupSearchFilterUserAttribute = "uid"
+)
+
+// applyGroupMembership checks the group_membership mode and fills in the group search settings left empty
+// with the ones of the posix mode
+func (config *ServerConfig) applyGroupMembership() error {
+	switch config.GroupMembership {
+	case "", GroupMembershipMemberOf:
+		return nil
+	case GroupMembershipPosix:
+	default:
+		return xerrors.Errorf("unknown mode %q", config.GroupMembership)
+	}
+
+	// memberUid lists the uids of the members, the groups being members of other groups can't be found this way
+	if config.NestedGroups != "" {
+		return xerrors.Errorf("the %q mode can't resolve the nested groups", GroupMembershipPosix)
+	}
+
+	if config.GroupSearchFilter == "" {
+		config.GroupSearchFilter = posixGroupSearchFilter
+	}
+
+	if config.GroupSearchFilterUserAttribute == "" {
+		config.GroupSearchFilterUserAttribute = posixGroupSearchFilterUserAttribute
+	}
+
+	if len(config.GroupSearchBaseDNs) == 0 {
+		config.GroupSearchBaseDNs = append([]string{}, config.SearchBaseDNs...)
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestGroupMembership(t *testing.T) {
+	Convey("ParseConfig()", t, func() {
+		parse := func(settings string) (*Config, error) {
+			return ParseConfig(`
+[[servers]]
+host = "127.0.0.1"
+search_filter = "(uid=%s)"
+search_base_dns = ["dc=grafana,dc=org"]
+` + settings)
+		}
+
+		Convey("Should leave the group search unset by default", func() {
+			config, err := parse("")
+
+			So(err, ShouldBeNil)
+			So(config.Servers[0].GroupSearchFilter, ShouldBeEmpty)
+			So(config.Servers[0].GroupSearchBaseDNs, ShouldBeEmpty)
+		})
+
+		Convey("Should default the group search of the posix mode", func() {
+			config, err := parse(`group_membership = "posix"`)
+
+			So(err, ShouldBeNil)
+			So(config.Servers[0].GroupSearchFilter, ShouldEqual, "(&(objectClass=posixGroup)(memberUid=%s))")
+			So(config.Servers[0].GroupSearchFilterUserAttribute, ShouldEqual, "uid")
+			So(config.Servers[0].GroupSearchBaseDNs, ShouldResemble, []string{"dc=grafana,dc=org"})
+		})
+
+		Convey("Should keep the group search settings of the posix mode", func() {
+			config, err := parse(`
+group_membership = "posix"
+group_search_filter = "(&(objectClass=posixGroup)(memberUid=%s)(cn=grafana-*))"
+group_search_filter_user_attribute = "loginName"
+group_search_base_dns = ["ou=groups,dc=grafana,dc=org"]
+`)
+
+			So(err, ShouldBeNil)
+			So(config.Servers[0].GroupSearchFilter, ShouldEqual, "(&(objectClass=posixGroup)(memberUid=%s)(cn=grafana-*))")
+			So(config.Servers[0].GroupSearchFilterUserAttribute, ShouldEqual, "loginName")
+			So(config.Servers[0].GroupSearchBaseDNs, ShouldResemble, []string{"ou=groups,dc=grafana,dc=org"})
+		})
+
+		Convey("Should refuse an unknown mode", func() {
+			_, err := parse(`group_membership = "uniqueMember"`)
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, `unknown mode "uniqueMember"`)
+		})
+
+		Convey("Should refuse the nested groups with the posix mode", func() {
+			_, err := parse("group_membership = \"posix\"\nnested_groups = \"recursive\"")
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "can't resolve the nested groups")
+		})
+	})
+
+	Convey("Posix group membership", t, func() {
+		config := &ServerConfig{
+			Attr: AttributeMap{
+				Username: "uid",
+				MemberOf: "memberOf",
+			},
+			SearchBaseDNs:   []string{"dc=grafana,dc=org"},
+			GroupMembership: GroupMembershipPosix,
+			Groups: []*GroupToOrgRole{
+				{GroupDN: "cn=editors,ou=groups,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_EDITOR},
+			},
+		}
+		So(config.applyGroupMembership(), ShouldBeNil)
+
+		connection := &MockConnection{}
+		connection.SearchProvider = func(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+			if request.Filter != "(&(objectClass=posixGroup)(memberUid=hmartin))" {
+				return &ldap.SearchResult{}, nil
+			}
+
+			return &ldap.SearchResult{Entries: []*ldap.Entry{
+				{DN: "cn=editors,ou=groups,dc=grafana,dc=org"},
+			}}, nil
+		}
+
+		server := &Server{
+			Config:     config,
+			Connection: connection,
+			log:        log.New("test-logger"),
+		}
+
+		Convey("Should map the groups listing the uid of the user", func() {
+			user, err := server.buildGrafanaUser(&ldap.Entry{
+				DN: "uid=hmartin,ou=people,dc=grafana,dc=org",
+				Attributes: []*ldap.EntryAttribute{
+					{Name: "uid", Values: []string{"hmartin"}},
+				},
+			})
+
+			So(err, ShouldBeNil)
+			So(user.Groups, ShouldResemble, []string{"cn=editors,ou=groups,dc=grafana,dc=org"})
+			So(user.OrgRoles[1], ShouldEqual, models.ROLE_EDITOR)
+			So(user.GroupSearchFilter, ShouldEqual, "(&(objectClass=posixGroup)(memberUid=hmartin))")
+			So(connection.SearchRequests[0].BaseDN, ShouldEqual, "dc=grafana,dc=org")
+		})
+	})
+}
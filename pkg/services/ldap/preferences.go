@@ -0,0 +1,45 @@
+package ldap
+
+import (
+	"strings"
+
+	"gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// preferenceThemes and preferenceTimezones are the values of the preferences page of the users
+var (
+	preferenceThemes    = map[string]bool{"light": true, "dark": true}
+	preferenceTimezones = map[string]bool{"utc": true, "browser": true}
+)
+
+// userPreferences returns the preferences of the mapped attributes of the user, the invalid themes and timezones are
+// ignored, as the missing attributes. It returns nil when none is mapped, so the preferences of the users aren't synced.
+func (server *Server) userPreferences(user *ldap.Entry) *models.ExternalPreferences {
+	attrs := server.Config.Attr
+	if attrs.Theme == "" && attrs.Timezone == "" && attrs.HomeDashboard == "" {
+		return nil
+	}
+
+	return &models.ExternalPreferences{
+		Theme:            server.preference(user, "theme", attrs.Theme, preferenceThemes),
+		Timezone:         server.preference(user, "timezone", attrs.Timezone, preferenceTimezones),
+		HomeDashboardUID: strings.TrimSpace(getAttribute(attrs.HomeDashboard, user)),
+	}
+}
+
+// preference returns the lowercased value of the attribute of the user, when it's one of the valid values
+func (server *Server) preference(user *ldap.Entry, name string, attribute string, valid map[string]bool) string {
+	value := strings.ToLower(strings.TrimSpace(getAttribute(attribute, user)))
+	if value == "" {
+		return ""
+	}
+
+	if !valid[value] {
+		server.log.Warn("Ignoring invalid "+name+" preference", "user", user.DN, "attribute", attribute, "value", value)
+		return ""
+	}
+
+	return value
+}
@@ -0,0 +1,79 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestPreferenceMappings(t *testing.T) {
+	Convey("Preference mappings", t, func() {
+		server := &Server{
+			Config: &ServerConfig{
+				Attr: AttributeMap{
+					Username:      "username",
+					MemberOf:      "memberof",
+					Theme:         "grafanaTheme",
+					Timezone:      "grafanaTimezone",
+					HomeDashboard: "grafanaHomeDashboard",
+				},
+				SearchBaseDNs: []string{"BaseDNHere"},
+			},
+			Connection: &MockConnection{},
+			log:        log.New("test-logger"),
+		}
+
+		buildUser := func(attributes ...*ldap.EntryAttribute) *models.ExternalUserInfo {
+			entry := ldap.Entry{
+				DN: "dn",
+				Attributes: append([]*ldap.EntryAttribute{
+					{Name: "username", Values: []string{"roelgerrits"}},
+				}, attributes...),
+			}
+
+			users, err := server.serializeUsers([]*ldap.Entry{&entry})
+			So(err, ShouldBeNil)
+
+			return users[0]
+		}
+
+		Convey("Should map the preferences", func() {
+			user := buildUser(
+				&ldap.EntryAttribute{Name: "grafanaTheme", Values: []string{"Dark"}},
+				&ldap.EntryAttribute{Name: "grafanaTimezone", Values: []string{"utc"}},
+				&ldap.EntryAttribute{Name: "grafanaHomeDashboard", Values: []string{"ops-overview"}},
+			)
+
+			So(user.Preferences, ShouldResemble, &models.ExternalPreferences{
+				Theme:            "dark",
+				Timezone:         "utc",
+				HomeDashboardUID: "ops-overview",
+			})
+		})
+
+		Convey("Should ignore the invalid theme and timezone", func() {
+			user := buildUser(
+				&ldap.EntryAttribute{Name: "grafanaTheme", Values: []string{"solarized"}},
+				&ldap.EntryAttribute{Name: "grafanaTimezone", Values: []string{"Europe/Paris"}},
+			)
+
+			So(user.Preferences, ShouldResemble, &models.ExternalPreferences{})
+		})
+
+		Convey("Should not sync the preferences without mapped attribute", func() {
+			server.Config.Attr.Theme = ""
+			server.Config.Attr.Timezone = ""
+			server.Config.Attr.HomeDashboard = ""
+
+			So(buildUser().Preferences, ShouldBeNil)
+		})
+
+		Convey("Should request the mapped attributes", func() {
+			So(SearchAttributes(server.Config), ShouldContain, "grafanaTimezone")
+		})
+	})
+}
@@ -0,0 +1,178 @@
+package ldap
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/util/errutil"
+)
+
+const (
+	// ReferralBindReuse binds with the servers of the referrals like with the server itself, the default
+	ReferralBindReuse = "reuse"
+
+	// ReferralBindAnonymous binds anonymously with the servers of the referrals, so the credentials of the server
+	// are never sent to another one
+	ReferralBindAnonymous = "anonymous"
+)
+
+// defaultReferralMaxHops is the number of referrals followed in a row by default
+const defaultReferralMaxHops = 3
+
+// validateReferrals checks the referral_bind policy and the hop limit
+func (config *ServerConfig) validateReferrals() error {
+	if config.ReferralBind != "" && config.ReferralBind != ReferralBindReuse && config.ReferralBind != ReferralBindAnonymous {
+		return xerrors.Errorf("unknown referral_bind policy %q", config.ReferralBind)
+	}
+
+	if config.ReferralMaxHops < 0 {
+		return xerrors.Errorf("negative max hops %d", config.ReferralMaxHops)
+	}
+
+	return nil
+}
+
+// referralMaxHops returns the number of referrals followed in a row
+func (config *ServerConfig) referralMaxHops() int {
+	if config.ReferralMaxHops == 0 {
+		return defaultReferralMaxHops
+	}
+
+	return config.ReferralMaxHops
+}
+
+// referralConfig returns the config of the server the referral URL points to, along with the base DN of the URL.
+// The server is dialed like this one, over TLS if this one is: a "ldap://" referral then uses StartTLS.
+func (config *ServerConfig) referralConfig(referral string) (*ServerConfig, string, error) {
+	u, err := url.Parse(referral)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if u.Hostname() == "" {
+		return nil, "", xerrors.Errorf("no host in the referral %q", referral)
+	}
+
+	referred := *config
+	referred.Host = u.Hostname()
+
+	switch strings.ToLower(u.Scheme) {
+	case "ldap":
+		referred.Port = 389
+		referred.StartTLS = config.UseSSL
+	case "ldaps":
+		referred.Port = 636
+		referred.UseSSL = true
+		referred.StartTLS = false
+	default:
+		return nil, "", xerrors.Errorf("unsupported scheme in the referral %q", referral)
+	}
+
+	if u.Port() != "" {
+		if referred.Port, err = strconv.Atoi(u.Port()); err != nil {
+			return nil, "", err
+		}
+	}
+
+	return &referred, strings.TrimPrefix(u.Path, "/"), nil
+}
+
+// dialReferral connects to the server of a referral, with the credential provider of the server following it
+var dialReferral = func(server *Server, config *ServerConfig) (*Server, error) {
+	referred := &Server{
+		Config:             config,
+		CredentialProvider: server.CredentialProvider,
+		log:                server.log,
+	}
+
+	if err := referred.Dial(); err != nil {
+		return nil, err
+	}
+
+	return referred, nil
+}
+
+// followReferrals runs the search request on the servers the referrals of the result point to, at most hops referrals
+// away, and adds their entries to the result. The referrals already visited aren't followed again.
+// It returns true when the size limit of one of these servers truncated their entries.
+func (server *Server) followReferrals(
+	request *ldap.SearchRequest, result *ldap.SearchResult, hops int, visited map[string]bool,
+) (bool, error) {
+	truncated := false
+
+	for _, referral := range result.Referrals {
+		key := strings.ToLower(referral)
+		if visited[key] {
+			continue
+		}
+		visited[key] = true
+
+		if hops <= 0 {
+			server.log.Warn(
+				"LDAP referral not followed, the hop limit is reached",
+				"referral", referral,
+				"maxHops", server.Config.referralMaxHops(),
+			)
+			continue
+		}
+
+		entries, referralTruncated, err := server.followReferral(request, referral, hops, visited)
+		if err != nil {
+			return false, errutil.Wrapf(err, "Failed to follow the LDAP referral %s", referral)
+		}
+
+		result.Entries = append(result.Entries, entries...)
+		truncated = truncated || referralTruncated
+	}
+
+	return truncated, nil
+}
+
+// followReferral runs the search request on the server the referral points to, in the base DN of the referral,
+// and follows the referrals this server returns in turn
+func (server *Server) followReferral(
+	request *ldap.SearchRequest, referral string, hops int, visited map[string]bool,
+) ([]*ldap.Entry, bool, error) {
+	config, baseDN, err := server.Config.referralConfig(referral)
+	if err != nil {
+		return nil, false, err
+	}
+
+	server.log.Debug("Following LDAP referral", "referral", referral)
+
+	referred, err := dialReferral(server, config)
+	if err != nil {
+		return nil, false, err
+	}
+	defer referred.Close()
+
+	if config.ReferralBind == ReferralBindAnonymous {
+		err = referred.anonymousBind()
+	} else {
+		err = referred.Bind()
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	referredRequest := *request
+	if baseDN != "" {
+		referredRequest.BaseDN = baseDN
+	}
+
+	result, truncated, err := referred.searchServer(&referredRequest)
+	if err != nil {
+		return nil, false, err
+	}
+
+	referralsTruncated, err := referred.followReferrals(&referredRequest, result, hops-1, visited)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return result.Entries, truncated || referralsTruncated, nil
+}
@@ -0,0 +1,186 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+)
+
+func TestReferrals(t *testing.T) {
+	Convey("search() with referrals", t, func() {
+		// the referred directories are keyed by host, with the referrals they return in turn
+		directories := map[string]struct {
+			logins    []string
+			referrals []string
+		}{
+			"child.example.org": {
+				logins:    []string{"carol"},
+				referrals: []string{"ldap://grandchild.example.org/dc=grandchild,dc=example,dc=org"},
+			},
+			"grandchild.example.org": {
+				logins:    []string{"dave"},
+				referrals: []string{"ldap://child.example.org/dc=child,dc=example,dc=org"},
+			},
+		}
+
+		entries := func(base string, logins ...string) []*ldap.Entry {
+			result := []*ldap.Entry{}
+			for _, login := range logins {
+				result = append(result, &ldap.Entry{DN: "cn=" + login + "," + base})
+			}
+			return result
+		}
+
+		dialed := map[string]*MockConnection{}
+		requests := map[string]*ldap.SearchRequest{}
+
+		previousDial := dialReferral
+		defer func() { dialReferral = previousDial }()
+
+		dialReferral = func(server *Server, config *ServerConfig) (*Server, error) {
+			host := config.Host
+			connection := &MockConnection{}
+			connection.SearchProvider = func(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+				requests[host] = request
+				return &ldap.SearchResult{
+					Entries:   entries(request.BaseDN, directories[host].logins...),
+					Referrals: directories[host].referrals,
+				}, nil
+			}
+			dialed[host] = connection
+
+			return &Server{Config: config, Connection: connection, log: server.log}, nil
+		}
+
+		connection := &MockConnection{
+			SearchResult: &ldap.SearchResult{
+				Entries:   entries("dc=example,dc=org", "alice", "bob"),
+				Referrals: []string{"ldap://child.example.org/dc=child,dc=example,dc=org"},
+			},
+		}
+
+		server := &Server{
+			Config: &ServerConfig{
+				Host:            "example.org",
+				BindDN:          "cn=admin,dc=example,dc=org",
+				BindPassword:    "secret",
+				FollowReferrals: true,
+			},
+			Connection: connection,
+			log:        log.New("test-logger"),
+		}
+
+		request := &ldap.SearchRequest{BaseDN: "dc=example,dc=org", Filter: "(objectClass=person)"}
+
+		Convey("Should search the servers of the referrals, once each", func() {
+			result, truncated, err := server.search(request)
+
+			So(err, ShouldBeNil)
+			So(truncated, ShouldBeFalse)
+			So(len(result.Entries), ShouldEqual, 4)
+			So(result.Entries[2].DN, ShouldEqual, "cn=carol,dc=child,dc=example,dc=org")
+			So(result.Entries[3].DN, ShouldEqual, "cn=dave,dc=grandchild,dc=example,dc=org")
+
+			So(requests["child.example.org"].Filter, ShouldEqual, "(objectClass=person)")
+			So(request.BaseDN, ShouldEqual, "dc=example,dc=org")
+		})
+
+		Convey("Should bind with the credentials of the server by default", func() {
+			var bindDN string
+			previousDialMock := dialReferral
+			dialReferral = func(server *Server, config *ServerConfig) (*Server, error) {
+				referred, err := previousDialMock(server, config)
+				referred.Connection.(*MockConnection).BindProvider = func(username, password string) error {
+					bindDN = username
+					return nil
+				}
+				return referred, err
+			}
+
+			_, _, err := server.search(request)
+
+			So(err, ShouldBeNil)
+			So(bindDN, ShouldEqual, "cn=admin,dc=example,dc=org")
+			So(dialed["child.example.org"].UnauthenticatedBindCalled, ShouldBeFalse)
+		})
+
+		Convey("Should bind anonymously with the anonymous policy", func() {
+			server.Config.ReferralBind = ReferralBindAnonymous
+
+			_, _, err := server.search(request)
+
+			So(err, ShouldBeNil)
+			So(dialed["child.example.org"].BindCalled, ShouldBeFalse)
+			So(dialed["child.example.org"].UnauthenticatedBindCalled, ShouldBeTrue)
+		})
+
+		Convey("Should stop at the hop limit", func() {
+			server.Config.ReferralMaxHops = 1
+
+			result, _, err := server.search(request)
+
+			So(err, ShouldBeNil)
+			So(len(result.Entries), ShouldEqual, 3)
+			So(dialed, ShouldContainKey, "child.example.org")
+			So(dialed, ShouldNotContainKey, "grandchild.example.org")
+		})
+
+		Convey("Should fail when a referral can't be followed", func() {
+			connection.SearchResult.Referrals = []string{"http://child.example.org"}
+
+			_, _, err := server.search(request)
+
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Should ignore the referrals without follow_referrals", func() {
+			server.Config.FollowReferrals = false
+
+			result, _, err := server.search(request)
+
+			So(err, ShouldBeNil)
+			So(len(result.Entries), ShouldEqual, 2)
+			So(dialed, ShouldBeEmpty)
+		})
+	})
+
+	Convey("referralConfig()", t, func() {
+		config := &ServerConfig{Host: "example.org", Port: 636, UseSSL: true, BindDN: "cn=admin,dc=example,dc=org"}
+
+		Convey("Should use StartTLS with the ldap referrals of a TLS server", func() {
+			referred, baseDN, err := config.referralConfig("ldap://child.example.org/dc=child,dc=example,dc=org")
+
+			So(err, ShouldBeNil)
+			So(baseDN, ShouldEqual, "dc=child,dc=example,dc=org")
+			So(referred.Host, ShouldEqual, "child.example.org")
+			So(referred.Port, ShouldEqual, 389)
+			So(referred.UseSSL, ShouldBeTrue)
+			So(referred.StartTLS, ShouldBeTrue)
+			So(referred.BindDN, ShouldEqual, config.BindDN)
+		})
+
+		Convey("Should use the port of the referral", func() {
+			referred, baseDN, err := config.referralConfig("ldaps://child.example.org:3269")
+
+			So(err, ShouldBeNil)
+			So(baseDN, ShouldBeEmpty)
+			So(referred.Port, ShouldEqual, 3269)
+			So(referred.StartTLS, ShouldBeFalse)
+		})
+
+		Convey("Should refuse the referrals without host", func() {
+			_, _, err := config.referralConfig("ldap:///dc=child,dc=example,dc=org")
+
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("validateReferrals()", t, func() {
+		So((&ServerConfig{ReferralBind: ReferralBindAnonymous}).validateReferrals(), ShouldBeNil)
+		So((&ServerConfig{ReferralBind: "kerberos"}).validateReferrals(), ShouldNotBeNil)
+		So((&ServerConfig{ReferralMaxHops: -1}).validateReferrals(), ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,50 @@
+package ldap
+
+import (
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	// ReplicaStrategyRoundRobin spreads the requests across the healthy replicas of the group in turn, the default
+	ReplicaStrategyRoundRobin = "round_robin"
+
+	// ReplicaStrategyFailover sends the requests to the replica which last answered, the first one of the group at start,
+	// and only fails over to the next healthy replica when it goes down
+	ReplicaStrategyFailover = "failover"
+
+	// ReplicaStrategyLowestLatency sends the requests to the healthy replica with the lowest dial latency
+	ReplicaStrategyLowestLatency = "lowest_latency"
+)
+
+// defaultQuarantineDuration is how long a server is quarantined by default, in seconds
+const defaultQuarantineDuration = 300
+
+// validateReplicas checks the replica_strategy and the quarantine settings
+func (config *ServerConfig) validateReplicas() error {
+	switch config.ReplicaStrategy {
+	case "", ReplicaStrategyRoundRobin, ReplicaStrategyFailover, ReplicaStrategyLowestLatency:
+	default:
+		return xerrors.Errorf("unknown replica_strategy %q", config.ReplicaStrategy)
+	}
+
+	if config.QuarantineAfter < 0 {
+		return xerrors.Errorf("negative quarantine_after %d", config.QuarantineAfter)
+	}
+
+	if config.QuarantineDuration < 0 {
+		return xerrors.Errorf("negative quarantine_duration %d", config.QuarantineDuration)
+	}
+
+	return nil
+}
+
+// QuarantineFor returns how long the server is quarantined once it failed QuarantineAfter times in a row
+func (config *ServerConfig) QuarantineFor() time.Duration {
+	if config.QuarantineDuration == 0 {
+		return defaultQuarantineDuration * time.Second
+	}
+
+	return time.Duration(config.QuarantineDuration) * time.Second
+}
@@ -0,0 +1,50 @@
+package ldap
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReplicasConfig(t *testing.T) {
+	Convey("ParseConfig()", t, func() {
+		parse := func(settings string) (*Config, error) {
+			return ParseConfig(`
+[[servers]]
+host = "127.0.0.1"
+search_filter = "(cn=%s)"
+search_base_dns = ["dc=grafana,dc=org"]
+replica_group = "main"
+` + settings)
+		}
+
+		Convey("Should accept the replica strategies and the quarantine", func() {
+			config, err := parse("replica_strategy = \"failover\"\nquarantine_after = 3")
+
+			So(err, ShouldBeNil)
+			So(config.Servers[0].ReplicaStrategy, ShouldEqual, ReplicaStrategyFailover)
+			So(config.Servers[0].QuarantineAfter, ShouldEqual, 3)
+			So(config.Servers[0].QuarantineFor(), ShouldEqual, 5*time.Minute)
+
+			config, err = parse("replica_strategy = \"lowest_latency\"\nquarantine_duration = 30")
+
+			So(err, ShouldBeNil)
+			So(config.Servers[0].QuarantineFor(), ShouldEqual, 30*time.Second)
+		})
+
+		Convey("Should refuse an unknown strategy", func() {
+			_, err := parse(`replica_strategy = "random"`)
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, `unknown replica_strategy "random"`)
+		})
+
+		Convey("Should refuse a negative quarantine", func() {
+			_, err := parse("quarantine_after = -1")
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "negative quarantine_after -1")
+		})
+	})
+}
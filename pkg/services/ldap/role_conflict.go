@@ -0,0 +1,64 @@
+package ldap
+
+import (
+	"golang.org/x/xerrors"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+const (
+	// RoleConflictFirstMatch gives the role of the first group mapping of the org matching the user, the default
+	RoleConflictFirstMatch = "first_match"
+
+	// RoleConflictHighestRole gives the highest role of the group mappings of the org matching the user
+	RoleConflictHighestRole = "highest_role"
+
+	// RoleConflictLowestRole gives the lowest role of the group mappings of the org matching the user
+	RoleConflictLowestRole = "lowest_role"
+)
+
+// validateRoleConflict checks the role_conflict policy
+func (config *ServerConfig) validateRoleConflict() error {
+	switch config.RoleConflict {
+	case "", RoleConflictFirstMatch, RoleConflictHighestRole, RoleConflictLowestRole:
+		return nil
+	}
+
+	return xerrors.Errorf("unknown policy %q", config.RoleConflict)
+}
+
+// RoleWins checks if the role of a group mapping matching the user wins over the role of a previous group mapping
+// of the same org, following the role_conflict policy. The first group mapping wins between equal roles.
+func (config *ServerConfig) RoleWins(role, previous models.RoleType) bool {
+	if role == previous {
+		return false
+	}
+
+	switch config.RoleConflict {
+	case RoleConflictHighestRole:
+		return role.Includes(previous)
+	case RoleConflictLowestRole:
+		return previous.Includes(role)
+	}
+
+	return false
+}
+
+// winningGroups returns the group mapping giving its role to the user in each org, among the ones matching its groups
+func (config *ServerConfig) winningGroups(memberOf []string) map[int64]*GroupToOrgRole {
+	winners := map[int64]*GroupToOrgRole{}
+
+	for _, group := range config.Groups {
+		if _, ok := group.MatchedGroup(memberOf); !ok {
+			continue
+		}
+
+		if winner, ok := winners[group.OrgID]; ok && !config.RoleWins(group.OrgRole, winner.OrgRole) {
+			continue
+		}
+
+		winners[group.OrgID] = group
+	}
+
+	return winners
+}
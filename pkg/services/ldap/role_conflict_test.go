@@ -0,0 +1,102 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestRoleConflict(t *testing.T) {
+	Convey("Role conflicts", t, func() {
+		isAdmin := true
+
+		server := &Server{
+			Config: &ServerConfig{
+				Attr: AttributeMap{
+					Username: "username",
+					MemberOf: "memberof",
+				},
+				Groups: []*GroupToOrgRole{
+					{GroupDN: "cn=editors,ou=groups,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_EDITOR},
+					{GroupDN: "cn=admins,ou=groups,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_ADMIN, IsGrafanaAdmin: &isAdmin},
+					{GroupDN: "cn=viewers,ou=groups,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_VIEWER},
+					{GroupDN: "cn=staff,ou=groups,dc=grafana,dc=org", OrgID: 2, OrgRole: models.ROLE_VIEWER},
+				},
+			},
+			Connection: &MockConnection{},
+			log:        log.New("test-logger"),
+		}
+
+		buildUser := func() (*models.ExternalUserInfo, error) {
+			return server.buildGrafanaUser(&ldap.Entry{
+				DN: "cn=roelgerrits,ou=users,dc=grafana,dc=org",
+				Attributes: []*ldap.EntryAttribute{
+					{Name: "username", Values: []string{"roelgerrits"}},
+					{Name: "memberof", Values: []string{
+						"cn=editors,ou=groups,dc=grafana,dc=org",
+						"cn=admins,ou=groups,dc=grafana,dc=org",
+						"cn=viewers,ou=groups,dc=grafana,dc=org",
+						"cn=staff,ou=groups,dc=grafana,dc=org",
+					}},
+				},
+			})
+		}
+
+		Convey("Should give the role of the first match by default", func() {
+			user, err := buildUser()
+
+			So(err, ShouldBeNil)
+			So(user.OrgRoles, ShouldResemble, map[int64]models.RoleType{1: models.ROLE_EDITOR, 2: models.ROLE_VIEWER})
+			So(user.IsGrafanaAdmin, ShouldBeNil)
+		})
+
+		Convey("Should give the highest role with highest_role", func() {
+			server.Config.RoleConflict = RoleConflictHighestRole
+
+			user, err := buildUser()
+
+			So(err, ShouldBeNil)
+			So(user.OrgRoles, ShouldResemble, map[int64]models.RoleType{1: models.ROLE_ADMIN, 2: models.ROLE_VIEWER})
+			So(*user.IsGrafanaAdmin, ShouldBeTrue)
+		})
+
+		Convey("Should give the lowest role with lowest_role", func() {
+			server.Config.RoleConflict = RoleConflictLowestRole
+
+			user, err := buildUser()
+
+			So(err, ShouldBeNil)
+			So(user.OrgRoles, ShouldResemble, map[int64]models.RoleType{1: models.ROLE_VIEWER, 2: models.ROLE_VIEWER})
+			So(user.IsGrafanaAdmin, ShouldBeNil)
+		})
+	})
+
+	Convey("ParseConfig()", t, func() {
+		parse := func(settings string) (*Config, error) {
+			return ParseConfig(`
+[[servers]]
+host = "127.0.0.1"
+search_filter = "(cn=%s)"
+search_base_dns = ["dc=grafana,dc=org"]
+` + settings)
+		}
+
+		Convey("Should accept the role conflict policies", func() {
+			config, err := parse(`role_conflict = "highest_role"`)
+
+			So(err, ShouldBeNil)
+			So(config.Servers[0].RoleConflict, ShouldEqual, RoleConflictHighestRole)
+		})
+
+		Convey("Should refuse an unknown policy", func() {
+			_, err := parse(`role_conflict = "random"`)
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, `unknown policy "random"`)
+		})
+	})
+}
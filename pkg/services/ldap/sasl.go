@@ -0,0 +1,198 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+	ber "gopkg.in/asn1-ber.v1"
+	"gopkg.in/ldap.v3"
+)
+
+// Methods of the bind with the LDAP server
+const (
+	// BindMethodSimple binds with the bind_dn and bind_password, the default
+	BindMethodSimple = "simple"
+
+	// BindMethodSASLExternal binds with the identity of the client certificate of the TLS connection
+	BindMethodSASLExternal = "sasl_external"
+)
+
+// ErrExternalBindNotSupported is returned when the connection can't do a SASL EXTERNAL bind
+var ErrExternalBindNotSupported = errors.New("LDAP connection does not support the SASL EXTERNAL bind")
+
+// errExternalBindNotFirst is returned when the SASL EXTERNAL bind isn't the first request of the connection
+var errExternalBindNotFirst = errors.New("SASL EXTERNAL bind must be the first request of the LDAP connection")
+
+// IsExternalBind checks if the server binds with the identity of the client certificate
+func (config *ServerConfig) IsExternalBind() bool {
+	return config.BindMethod == BindMethodSASLExternal
+}
+
+// validateBindMethod checks the bind method is known and that the SASL EXTERNAL bind
+// is used over LDAPS with a client certificate
+func (config *ServerConfig) validateBindMethod() error {
+	switch config.BindMethod {
+	case "", BindMethodSimple:
+		return nil
+	case BindMethodSASLExternal:
+		if !config.UseSSL || config.StartTLS {
+			return xerrors.New("the sasl_external bind requires use_ssl without start_tls")
+		}
+
+		if config.ClientCert == "" || config.ClientKey == "" {
+			return xerrors.New("the sasl_external bind requires a client_cert and a client_key")
+		}
+
+		return nil
+	default:
+		return xerrors.Errorf("unknown method %q", config.BindMethod)
+	}
+}
+
+// externalBinder is implemented by the connections able to do a SASL EXTERNAL bind
+type externalBinder interface {
+	ExternalBind() error
+}
+
+// externalConn is an LDAPS connection which can do a SASL EXTERNAL bind as its first request.
+// The LDAP library doesn't support SASL binds, so the bind is exchanged on the TLS connection
+// before the library starts reading from it.
+type externalConn struct {
+	*ldap.Conn
+
+	raw       net.Conn
+	timeout   time.Duration
+	startOnce sync.Once
+}
+
+// dialExternal dials the LDAPS server, giving up after the dial timeout, without starting the LDAP connection until
+// it is bound. The bind gives up after the timeout, the default timeout of the library if 0.
+func dialExternal(address string, tlsCfg *tls.Config, dialTimeout time.Duration, timeout time.Duration) (*externalConn, error) {
+	raw, err := tls.DialWithDialer(&net.Dialer{Timeout: dialTimeout}, "tcp", address, tlsCfg)
+	if err != nil {
+		return nil, ldap.NewError(ldap.ErrorNetwork, err)
+	}
+
+	if timeout <= 0 {
+		timeout = ldap.DefaultTimeout
+	}
+
+	return &externalConn{Conn: ldap.NewConn(raw, true), raw: raw, timeout: timeout}, nil
+}
+
+// start hands the connection over to the LDAP library, which then reads all the responses
+func (conn *externalConn) start() {
+	conn.startOnce.Do(conn.Conn.Start)
+}
+
+// ExternalBind binds with the identity the server derives from the client certificate
+func (conn *externalConn) ExternalBind() error {
+	first := false
+	conn.startOnce.Do(func() {
+		first = true
+	})
+
+	if !first {
+		return errExternalBindNotFirst
+	}
+
+	// the library is started even if the bind fails, so the connection can still be closed
+	defer conn.Conn.Start()
+
+	// the deadline also releases a bind abandoned by the bind timeout
+	if err := conn.raw.SetDeadline(time.Now().Add(conn.timeout)); err != nil {
+		return ldap.NewError(ldap.ErrorNetwork, err)
+	}
+	defer conn.raw.SetDeadline(time.Time{})
+
+	if _, err := conn.raw.Write(externalBindRequest(1).Bytes()); err != nil {
+		return ldap.NewError(ldap.ErrorNetwork, err)
+	}
+
+	response, err := ber.ReadPacket(conn.raw)
+	if err != nil {
+		return ldap.NewError(ldap.ErrorNetwork, err)
+	}
+
+	return ldap.GetLDAPError(response)
+}
+
+// externalBindRequest is the bind request with the EXTERNAL SASL mechanism and no credentials (RFC 4513, section 5.2.3)
+func externalBindRequest(messageID int64) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Request")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
+
+	request := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationBindRequest, nil, "Bind Request")
+	request.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, 3, "Version"))
+	request.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "User Name"))
+
+	sasl := ber.Encode(ber.ClassContext, ber.TypeConstructed, 3, nil, "SASL Credentials")
+	sasl.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "EXTERNAL", "Mechanism"))
+	request.AppendChild(sasl)
+
+	packet.AppendChild(request)
+
+	return packet
+}
+
+// Bind binds with the DN and the password, once the connection is started
+func (conn *externalConn) Bind(username, password string) error {
+	conn.start()
+	return conn.Conn.Bind(username, password)
+}
+
+// UnauthenticatedBind binds with the DN without password, once the connection is started
+func (conn *externalConn) UnauthenticatedBind(username string) error {
+	conn.start()
+	return conn.Conn.UnauthenticatedBind(username)
+}
+
+// Add adds the entry, once the connection is started
+func (conn *externalConn) Add(request *ldap.AddRequest) error {
+	conn.start()
+	return conn.Conn.Add(request)
+}
+
+// Del deletes the entry, once the connection is started
+func (conn *externalConn) Del(request *ldap.DelRequest) error {
+	conn.start()
+	return conn.Conn.Del(request)
+}
+
+// Search searches the entries, once the connection is started
+func (conn *externalConn) Search(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	conn.start()
+	return conn.Conn.Search(request)
+}
+
+// StartTLS isn't needed by the already secured connection, it is only there to implement IConnection
+func (conn *externalConn) StartTLS(config *tls.Config) error {
+	conn.start()
+	return conn.Conn.StartTLS(config)
+}
+
+// Close closes the connection, the library has to be started to close it
+func (conn *externalConn) Close() {
+	conn.start()
+	conn.Conn.Close()
+}
+
+// externalBind binds with the identity of the client certificate
+func (server *Server) externalBind() error {
+	binder, ok := server.Connection.(externalBinder)
+	if !ok {
+		return ErrExternalBindNotSupported
+	}
+
+	err := server.withBindTimeout(binder.ExternalBind)
+	if err != nil {
+		server.log.Error("Cannot bind with the client certificate (SASL EXTERNAL) with LDAP", "error", err)
+		return err
+	}
+
+	return nil
+}
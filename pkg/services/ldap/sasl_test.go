@@ -0,0 +1,215 @@
+package ldap
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	ber "gopkg.in/asn1-ber.v1"
+	"gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestSASLExternal(t *testing.T) {
+	Convey("validateConfig() with a bind_method", t, func() {
+		config := func(server string) string {
+			return `
+[[servers]]
+host = "ldap.example.org"
+search_filter = "(cn=%s)"
+search_base_dns = ["dc=grafana,dc=org"]
+` + server
+		}
+
+		Convey("Should accept the sasl_external bind over LDAPS with a client certificate", func() {
+			result, err := ParseConfig(config(`
+use_ssl = true
+client_cert = "/etc/grafana/client.crt"
+client_key = "/etc/grafana/client.key"
+bind_method = "sasl_external"
+`))
+
+			So(err, ShouldBeNil)
+			So(result.Servers[0].IsExternalBind(), ShouldBeTrue)
+		})
+
+		Convey("Should default to the simple bind", func() {
+			result, err := ParseConfig(config(""))
+
+			So(err, ShouldBeNil)
+			So(result.Servers[0].IsExternalBind(), ShouldBeFalse)
+		})
+
+		Convey("Should refuse the sasl_external bind without client certificate", func() {
+			_, err := ParseConfig(config(`
+use_ssl = true
+bind_method = "sasl_external"
+`))
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "requires a client_cert and a client_key")
+		})
+
+		Convey("Should refuse the sasl_external bind with start_tls", func() {
+			_, err := ParseConfig(config(`
+use_ssl = true
+start_tls = true
+client_cert = "/etc/grafana/client.crt"
+client_key = "/etc/grafana/client.key"
+bind_method = "sasl_external"
+`))
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "requires use_ssl without start_tls")
+		})
+
+		Convey("Should refuse an unknown bind method", func() {
+			_, err := ParseConfig(config(`bind_method = "kerberos"`))
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, `unknown method "kerberos"`)
+		})
+	})
+
+	Convey("Bind() with sasl_external", t, func() {
+		newServer := func(connection IConnection) *Server {
+			return &Server{
+				Config: &ServerConfig{
+					BindDN:       "cn=admin,dc=grafana,dc=org",
+					BindPassword: "grafana",
+					BindMethod:   BindMethodSASLExternal,
+					Attr: AttributeMap{
+						Username: "username",
+					},
+					SearchBaseDNs: []string{"BaseDNHere"},
+				},
+				Connection: connection,
+				log:        log.New("test-logger"),
+			}
+		}
+
+		Convey("Should bind with the client certificate instead of the bind DN", func() {
+			connection := &MockConnection{}
+
+			So(newServer(connection).Bind(), ShouldBeNil)
+			So(connection.ExternalBindCalled, ShouldBeTrue)
+			So(connection.BindCalled, ShouldBeFalse)
+		})
+
+		Convey("Should return the error of the bind", func() {
+			expected := &ldap.Error{ResultCode: ldap.LDAPResultInappropriateAuthentication}
+			connection := &MockConnection{
+				ExternalBindProvider: func() error {
+					return expected
+				},
+			}
+
+			So(newServer(connection).Bind(), ShouldEqual, expected)
+		})
+
+		Convey("Should refuse a connection without SASL EXTERNAL bind", func() {
+			connection := struct{ IConnection }{&MockConnection{}}
+
+			So(newServer(connection).Bind(), ShouldEqual, ErrExternalBindNotSupported)
+		})
+
+		Convey("Should still verify the password of the user on login", func() {
+			entry := ldap.Entry{
+				DN: "cn=user,dc=grafana,dc=org", Attributes: []*ldap.EntryAttribute{
+					{Name: "username", Values: []string{"user"}},
+				},
+			}
+
+			binds := []string{}
+			connection := &MockConnection{}
+			connection.setSearchResult(&ldap.SearchResult{Entries: []*ldap.Entry{&entry}})
+			connection.BindProvider = func(username, password string) error {
+				binds = append(binds, username)
+				return nil
+			}
+
+			trace := NewTrace()
+			user, err := newServer(connection).LoginWithTrace(&models.LoginUserQuery{Username: "user", Password: "pwd"}, trace)
+
+			So(err, ShouldBeNil)
+			So(user.Login, ShouldEqual, "user")
+			So(connection.ExternalBindCalled, ShouldBeTrue)
+			So(binds, ShouldResemble, []string{"cn=user,dc=grafana,dc=org"})
+			So(trace.Steps[0].Message, ShouldEqual, "Bind with the client certificate (SASL EXTERNAL)")
+		})
+	})
+
+	Convey("externalConn", t, func() {
+		client, stub := net.Pipe()
+		conn := &externalConn{Conn: ldap.NewConn(client, true), raw: client, timeout: time.Second}
+
+		// serve answers the bind request with the result code, and returns the mechanism of the request
+		serve := func(resultCode int64) chan string {
+			mechanism := make(chan string, 1)
+
+			go func() {
+				request, err := ber.ReadPacket(stub)
+				if err != nil {
+					mechanism <- err.Error()
+					return
+				}
+
+				bind := request.Children[1]
+				mechanism <- bind.Children[2].Children[0].Value.(string)
+
+				response := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+				response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, request.Children[0].Value, "MessageID"))
+				result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationBindResponse, nil, "Bind Response")
+				result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, resultCode, "resultCode"))
+				result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+				result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "no identity", "diagnosticMessage"))
+				response.AppendChild(result)
+
+				_, _ = stub.Write(response.Bytes())
+			}()
+
+			return mechanism
+		}
+
+		Reset(func() {
+			stub.Close()
+			conn.Close()
+		})
+
+		Convey("Should send the EXTERNAL mechanism as the first request", func() {
+			mechanism := serve(ldap.LDAPResultSuccess)
+
+			So(conn.ExternalBind(), ShouldBeNil)
+			So(<-mechanism, ShouldEqual, "EXTERNAL")
+		})
+
+		Convey("Should return the error of the server", func() {
+			serve(ldap.LDAPResultInvalidCredentials)
+
+			err := conn.ExternalBind()
+
+			So(ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials), ShouldBeTrue)
+		})
+
+		Convey("Should refuse to bind once the connection is used", func() {
+			conn.start()
+
+			So(conn.ExternalBind(), ShouldEqual, errExternalBindNotFirst)
+		})
+
+		Convey("Should give up on a server which doesn't answer", func() {
+			conn.timeout = 50 * time.Millisecond
+
+			go func() {
+				_, _ = ber.ReadPacket(stub)
+			}()
+
+			err := conn.ExternalBind()
+
+			So(ldap.IsErrorWithCode(err, ldap.ErrorNetwork), ShouldBeTrue)
+		})
+	})
+}
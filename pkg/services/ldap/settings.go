@@ -1,12 +1,21 @@
 package ldap
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"path/filepath"
+	"regexp"
 	"sync"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"golang.org/x/xerrors"
+	"gopkg.in/ldap.v3"
 
+	"github.com/grafana/grafana/pkg/bus"
 	"github.com/grafana/grafana/pkg/infra/log"
 	m "github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/setting"
@@ -16,6 +25,51 @@ import (
 // Config holds list of connections to LDAP
 type Config struct {
 	Servers []*ServerConfig `toml:"servers"`
+
+	// Include lists the globs of the config files merged into this one, see mergeIncludes.
+	// It isn't part of the hash, only the merged servers are.
+	Include []string `toml:"include" json:"-"`
+
+	// Source is only set for the loaded config, ParseConfig doesn't set it
+	Source        *ConfigSource `toml:"-" json:"-"`
+	includedFiles []string
+}
+
+// Hash computes a hash of the parsed config, identical configs produce the same hash.
+// It is used to detect config drifts across the Grafana instances. The bind passwords and the client keys
+// are only hashed keyed by the secret_key of Grafana, so the hash can't be used to guess them.
+func (config *Config) Hash() (string, error) {
+	hashed := *config
+	hashed.Servers = make([]*ServerConfig, len(config.Servers))
+
+	for i, server := range config.Servers {
+		secured := *server
+		secured.BindPassword = hashSecret(server.BindPassword)
+		secured.ClientKey = hashSecret(server.ClientKey)
+		hashed.Servers[i] = &secured
+	}
+
+	// encoding/json sorts the map keys so the hash doesn't depend on the map ordering
+	data, err := json.Marshal(&hashed)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// hashSecret computes the HMAC of the secret keyed by the secret_key of Grafana, an empty secret stays empty
+func hashSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, []byte(setting.SecretKey))
+	mac.Write([]byte(secret))
+
+	return hex.EncodeToString(mac.Sum(nil))
 }
 
 // ServerConfig holds connection data to LDAP
@@ -32,6 +86,40 @@ type ServerConfig struct {
 	BindPassword  string       `toml:"bind_password"`
 	Attr          AttributeMap `toml:"attributes"`
 
+	// DialTimeout bounds the dials of the server, in seconds. The default timeout of the LDAP library, 60 seconds, applies if 0
+	DialTimeout int `toml:"dial_timeout"`
+
+	// BindTimeout bounds the binds with the server, in seconds. They aren't bounded if 0
+	BindTimeout int `toml:"bind_timeout"`
+
+	// SearchTimeout bounds the searches on the server, in seconds. It's also sent as the time limit of the searches,
+	// so the server gives up on them too. They aren't bounded if 0
+	SearchTimeout int `toml:"search_timeout"`
+
+	// PageSize is the number of entries the server returns at once, the searches are then paged with the paged results
+	// control (RFC 2696) so they aren't truncated at the size limit of the server. They aren't paged if 0
+	PageSize int `toml:"page_size"`
+
+	// FollowReferrals runs the searches on the servers of the referrals the server returns as well,
+	// for example the domain controllers of the child domains of an Active Directory forest
+	FollowReferrals bool `toml:"follow_referrals"`
+
+	// ReferralMaxHops bounds the referrals followed in a row, 3 if 0
+	ReferralMaxHops int `toml:"referral_max_hops"`
+
+	// ReferralBind is how to bind with the servers of the referrals, ReferralBindReuse if empty or ReferralBindAnonymous
+	ReferralBind string `toml:"referral_bind"`
+
+	// BindMethod is either "simple", the default, or "sasl_external" to bind with the client certificate
+	BindMethod string `toml:"bind_method"`
+
+	// NormalizeEmail trims and lowercases the emails of the users
+	NormalizeEmail bool `toml:"normalize_email"`
+
+	// InvalidEmail is the policy for the emails which aren't valid addresses,
+	// see InvalidEmailWarn and InvalidEmailReject. They aren't validated if empty.
+	InvalidEmail string `toml:"invalid_email"`
+
 	SearchFilter  string   `toml:"search_filter"`
 	SearchBaseDNs []string `toml:"search_base_dns"`
 
@@ -39,7 +127,122 @@ type ServerConfig struct {
 	GroupSearchFilterUserAttribute string   `toml:"group_search_filter_user_attribute"`
 	GroupSearchBaseDNs             []string `toml:"group_search_base_dns"`
 
+	// GroupMembership is how the groups of the users are found, GroupMembershipMemberOf if empty.
+	// GroupMembershipPosix defaults the group search to the posixGroup entries matching the uid of the users.
+	GroupMembership string `toml:"group_membership"`
+
+	// NestedGroups also matches the groups the users are members of through their groups, either NestedGroupsInChain
+	// or NestedGroupsRecursive. Only their direct groups are matched if empty.
+	NestedGroups string `toml:"nested_groups"`
+
+	// NestedGroupsMaxDepth bounds the levels of groups searched by the recursive resolution, 10 if 0
+	NestedGroupsMaxDepth int `toml:"nested_groups_max_depth"`
+
+	// NestedGroupsMemberAttribute is the attribute of the groups listing their members, "member" if empty
+	NestedGroupsMemberAttribute string `toml:"nested_groups_member_attribute"`
+
+	// ActiveDirectoryGroups also matches the groups of the tokenGroups of the Active Directory users and their primary group,
+	// which memberOf doesn't list. They are searched like the nested groups.
+	ActiveDirectoryGroups bool `toml:"active_directory_groups"`
+
 	Groups []*GroupToOrgRole `toml:"group_mappings"`
+
+	// RoleConflict decides which of the group mappings of an org matching the user gives its role,
+	// see the RoleConflict* policies. RoleConflictFirstMatch if empty.
+	RoleConflict string `toml:"role_conflict"`
+
+	// OrgID scopes the server to an org, its mappings can only refer to this org and default to it.
+	// The server serves every org if 0.
+	OrgID int64 `toml:"org_id"`
+
+	// DefaultOrgID is the org where the users of this server get
+	// DefaultOrgRole, even if none of their groups match
+	DefaultOrgID   int64      `toml:"default_org_id"`
+	DefaultOrgRole m.RoleType `toml:"default_org_role"`
+
+	// StaleOrgRoles is what the sync does with the orgs the user has no role in anymore, see the StaleOrgRoles*
+	// policies. If empty, the user is removed from them unless it has no role left at all.
+	StaleOrgRoles string `toml:"stale_org_roles"`
+
+	// AllowTeamsWithoutRole keeps the teams of the organizations where the user has no role
+	AllowTeamsWithoutRole bool `toml:"allow_teams_without_role"`
+
+	DefaultTeams []*DefaultTeam `toml:"default_teams"`
+
+	// TeamMappings add the members of the groups to teams
+	TeamMappings []*GroupToTeam `toml:"team_mappings"`
+
+	// FolderMappings give permissions on folders to the members of the groups
+	FolderMappings []*GroupToFolderPermission `toml:"folder_mappings"`
+
+	// RoleOverrides override the org roles of the users by the value of an attribute, whatever their groups
+	RoleOverrides []*RoleOverride `toml:"role_overrides"`
+
+	// MetadataMappings store the values of attributes of the users in the metadata of their Grafana user
+	MetadataMappings []*MetadataMapping `toml:"metadata_mappings"`
+
+	// ReplicaGroup names the group of equivalent servers the requests are spread across
+	ReplicaGroup string `toml:"replica_group"`
+
+	// ReplicaLoginInOrder makes the logins try the replicas in the configured order
+	ReplicaLoginInOrder bool `toml:"replica_login_in_order"`
+
+	// ReplicaStrategy is how the requests are spread across the replicas of the group, see the ReplicaStrategy* strategies.
+	// The first replica of the group setting it decides, ReplicaStrategyRoundRobin if none does.
+	ReplicaStrategy string `toml:"replica_strategy"`
+
+	// QuarantineAfter is the number of failed pings or dials in a row after which the server is quarantined:
+	// the lookups and the logins don't dial it for QuarantineDuration seconds, 300 if 0. It's never quarantined if 0.
+	QuarantineAfter    int `toml:"quarantine_after"`
+	QuarantineDuration int `toml:"quarantine_duration"`
+
+	// copied is set on the copies of the config made for a single request, see Copy
+	copied bool
+}
+
+// Copy returns a copy of the server config for a single request, for example with some of its settings overridden.
+// The connections to the server of the copy aren't kept across the requests, since the copy is never used again.
+func (config *ServerConfig) Copy() *ServerConfig {
+	copied := *config
+	copied.copied = true
+
+	return &copied
+}
+
+// IsCopy reports whether the config is a copy for a single request, see Copy
+func (config *ServerConfig) IsCopy() bool {
+	return config.copied
+}
+
+// timeoutUnit is the unit of the dial_timeout, bind_timeout and search_timeout settings
+var timeoutUnit = time.Second
+
+// dialTimeout returns how long a dial can take
+func (config *ServerConfig) dialTimeout() time.Duration {
+	if config.DialTimeout == 0 {
+		return ldap.DefaultTimeout
+	}
+
+	return time.Duration(config.DialTimeout) * timeoutUnit
+}
+
+// bindTimeout returns how long a bind can take
+func (config *ServerConfig) bindTimeout() time.Duration {
+	return time.Duration(config.BindTimeout) * timeoutUnit
+}
+
+// searchTimeout returns how long a search can take
+func (config *ServerConfig) searchTimeout() time.Duration {
+	return time.Duration(config.SearchTimeout) * timeoutUnit
+}
+
+// defaultOrgRole returns the role given to the users in the default org
+func (config *ServerConfig) defaultOrgRole() m.RoleType {
+	if config.DefaultOrgRole == "" {
+		return m.ROLE_VIEWER
+	}
+
+	return config.DefaultOrgRole
 }
 
 // AttributeMap is a struct representation for LDAP "attributes" setting
@@ -49,6 +252,31 @@ type AttributeMap struct {
 	Surname  string `toml:"surname"`
 	Email    string `toml:"email"`
 	MemberOf string `toml:"member_of"`
+
+	// Phone and Title are only displayed, they aren't synced with Grafana
+	Phone string `toml:"phone"`
+	Title string `toml:"title"`
+
+	// Teams is a multi-valued attribute listing the Grafana teams of the user,
+	// each value is either "<team_id>" (default org) or "<org_id>:<team_id>"
+	Teams string `toml:"teams"`
+
+	// UpdatedAt is the time of the last change of the user entry, like "whenChanged" or "modifyTimestamp",
+	// the sync skips the users which didn't change since they were last synced
+	UpdatedAt string `toml:"updated_at"`
+
+	// ChangeMarker is the change sequence number of the user entry, like "uSNChanged" or "entryCSN",
+	// the incremental sync only searches the users changed since the highest marker it synced
+	ChangeMarker string `toml:"change_marker"`
+
+	// Photo is a binary attribute holding the photo of the user, like "jpegPhoto", it is only served by the photo endpoint
+	Photo string `toml:"photo"`
+
+	// Theme, Timezone and HomeDashboard set the preferences of the user in its orgs, the home dashboard by its UID.
+	// Only the "light" and "dark" themes and the "utc" and "browser" timezones are set, as in the preferences page
+	Theme         string `toml:"theme"`
+	Timezone      string `toml:"timezone"`
+	HomeDashboard string `toml:"home_dashboard"`
 }
 
 // GroupToOrgRole is a struct representation of LDAP
@@ -57,12 +285,42 @@ type GroupToOrgRole struct {
 	GroupDN string `toml:"group_dn"`
 	OrgID   int64  `toml:"org_id"`
 
+	// MatchType specifies how GroupDN is matched: "exact" (default), "glob" or "regex"
+	MatchType string `toml:"match_type"`
+	matcher   *regexp.Regexp
+
 	// This pointer specifies if setting was set (for backwards compatibility)
 	IsGrafanaAdmin *bool `toml:"grafana_admin"`
 
 	OrgRole m.RoleType `toml:"org_role"`
 }
 
+// DefaultTeam is a struct representation of LDAP
+// config "default_teams" setting
+type DefaultTeam struct {
+	OrgID  int64 `toml:"org_id"`
+	TeamID int64 `toml:"team_id"`
+}
+
+// GroupToTeam is a struct representation of LDAP
+// config "team_mappings" setting
+type GroupToTeam struct {
+	GroupDN string `toml:"group_dn"`
+	OrgID   int64  `toml:"org_id"`
+	TeamID  int64  `toml:"team_id"`
+}
+
+// GroupToFolderPermission is a struct representation of LDAP
+// config "folder_mappings" setting
+type GroupToFolderPermission struct {
+	GroupDN  string `toml:"group_dn"`
+	OrgID    int64  `toml:"org_id"`
+	FolderID int64  `toml:"folder_id"`
+
+	// Permission is either "View" (default), "Edit" or "Admin"
+	Permission string `toml:"permission"`
+}
+
 // logger for all LDAP stuff
 var logger = log.New("ldap")
 
@@ -74,24 +332,68 @@ func IsEnabled() bool {
 	return setting.LDAPEnabled
 }
 
-// ReloadConfig reads the config from the disc and caches it.
-func ReloadConfig() error {
+// ReloadConfig reads the config, see loadConfig, and caches it. It returns what changed since the previously loaded config,
+// every server is added when none was loaded. The previous config is kept when the TLS certificates of a server
+// can't be loaded, see checkTLSMaterial.
+func ReloadConfig() (*ConfigDiff, error) {
 	if !IsEnabled() {
-		return nil
+		return nil, nil
 	}
 
 	loadingMutex.Lock()
 	defer loadingMutex.Unlock()
 
-	var err error
-	config, err = readConfig(setting.LDAPConfigFile)
-	return err
+	result, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := result.checkTLSMaterial(); err != nil {
+		return nil, err
+	}
+
+	return DiffConfigs(swapConfig(result), result), nil
 }
 
+// ApplyConfig caches the given config, see ParseConfig, in place of the loaded config, like ReloadConfig, once it is stored
+// by the given function, which returns its version in the database. The config isn't stored when the TLS certificates of
+// a server can't be loaded, see checkTLSMaterial, and the previous config is kept when it can't be stored.
+func ApplyConfig(result *Config, store func() (int64, error)) (*ConfigDiff, error) {
+	if !IsEnabled() {
+		return nil, nil
+	}
+
+	loadingMutex.Lock()
+	defer loadingMutex.Unlock()
+
+	if err := result.checkTLSMaterial(); err != nil {
+		return nil, err
+	}
+
+	version, err := store()
+	if err != nil {
+		return nil, err
+	}
+
+	result.setSource("", version)
+	warnInsecureServers(result)
+
+	return DiffConfigs(swapConfig(result), result), nil
+}
+
+// ErrNoServersConfigured is returned when LDAP is enabled but the config file defines no server
+var ErrNoServersConfigured = xerrors.New("LDAP enabled but no LDAP servers defined in config file")
+
+// ErrIncludeNotAllowed is returned by ParseConfig for a config including files, only the config file can include files
+var ErrIncludeNotAllowed = xerrors.New("Only the LDAP config file can include files, not the config given through the API")
+
 // We need to define in this space so `GetConfig` fn
 // could be defined as singleton
 var config *Config
 
+// configMutex guards the cached config, which is only replaced by a valid config
+var configMutex = &sync.RWMutex{}
+
 // GetConfig returns the LDAP config if LDAP is enabled otherwise it returns nil. It returns either cached value of
 // the config or it reads it and caches it first.
 func GetConfig() (*Config, error) {
@@ -100,17 +402,72 @@ func GetConfig() (*Config, error) {
 	}
 
 	// Make it a singleton
-	if config != nil {
-		return config, nil
+	if cached := cachedConfig(); cached != nil {
+		return cached, nil
 	}
 
 	loadingMutex.Lock()
 	defer loadingMutex.Unlock()
 
-	var err error
-	config, err = readConfig(setting.LDAPConfigFile)
+	// another request may have loaded it meanwhile
+	if cached := cachedConfig(); cached != nil {
+		return cached, nil
+	}
 
-	return config, err
+	result, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	swapConfig(result)
+
+	return result, nil
+}
+
+// cachedConfig returns the cached config, nil when none was loaded yet
+func cachedConfig() *Config {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+
+	return config
+}
+
+// swapConfig caches the config in place of the previous one, which it returns
+func swapConfig(result *Config) *Config {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	previous := config
+	config = result
+
+	return previous
+}
+
+// loadConfig reads the config stored in the database by the LDAP settings API, or else the config file
+func loadConfig() (*Config, error) {
+	query := &m.GetLDAPSettingsQuery{}
+	err := bus.Dispatch(query)
+
+	// the database isn't available to the CLI commands
+	if err == m.ErrLDAPSettingsNotFound || err == bus.ErrHandlerNotFound {
+		return readConfig(setting.LDAPConfigFile)
+	}
+
+	if err != nil {
+		return nil, errutil.Wrap("Failed to load the LDAP config stored in the database", err)
+	}
+
+	logger.Info("LDAP enabled, reading the config stored in the database", "version", query.Result.Version)
+
+	result, err := ParseConfig(query.Result.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	result.setSource("", query.Result.Version)
+	warnInsecureServers(result)
+
+	return result, nil
 }
 
 func readConfig(configFile string) (*Config, error) {
@@ -123,8 +480,59 @@ func readConfig(configFile string) (*Config, error) {
 		return nil, errutil.Wrap("Failed to load LDAP config file", err)
 	}
 
+	result, err = mergeIncludes(result, filepath.Dir(configFile))
+	if err != nil {
+		return nil, err
+	}
+
+	result, err = validateConfig(result)
+	if err != nil {
+		return nil, err
+	}
+
+	result.setSource(configFile, 0)
+	warnInsecureServers(result)
+
+	return result, nil
+}
+
+// warnInsecureServers warns about the servers whose TLS certificate isn't verified
+func warnInsecureServers(result *Config) {
+	for _, server := range result.Servers {
+		if server.IsTLSInsecure() {
+			logger.Warn(
+				"!!! The TLS certificate of the LDAP server is NOT VERIFIED, anyone on the network can impersonate it. "+
+					"Only use ssl_skip_verify in a lab !!!",
+				"host", server.Host,
+			)
+		}
+	}
+}
+
+// ParseConfig parses and validates an LDAP config in the TOML format of the config file,
+// without loading it. It is used to evaluate a proposed config, and to read the config stored in the database.
+// These configs are given through the API, they can't include the files of the server, see ErrIncludeNotAllowed.
+func ParseConfig(data string) (*Config, error) {
+	result := &Config{}
+
+	_, err := toml.Decode(data, result)
+	if err != nil {
+		return nil, errutil.Wrap("Failed to parse LDAP config", err)
+	}
+
+	if len(result.Include) > 0 {
+		return nil, ErrIncludeNotAllowed
+	}
+
+	return validateConfig(result)
+}
+
+// validateConfig validates the servers of the config, setting the default values
+func validateConfig(result *Config) (*Config, error) {
+	var err error
+
 	if len(result.Servers) == 0 {
-		return nil, xerrors.New("LDAP enabled but no LDAP servers defined in config file")
+		return nil, ErrNoServersConfigured
 	}
 
 	// set default org id
@@ -138,16 +546,139 @@ func readConfig(configFile string) (*Config, error) {
 			return nil, errutil.Wrap("Failed to validate SearchBaseDNs section", err)
 		}
 
+		if err := server.validateOrgScope(); err != nil {
+			return nil, errutil.Wrap("Failed to validate org_id section", err)
+		}
+
 		for _, groupMap := range server.Groups {
 			if groupMap.OrgID == 0 {
 				groupMap.OrgID = 1
 			}
+
+			err = groupMap.compileMatcher()
+			if err != nil {
+				return nil, errutil.Wrap("Failed to validate group_mappings section", err)
+			}
+		}
+
+		for _, team := range server.DefaultTeams {
+			if team.OrgID == 0 {
+				team.OrgID = 1
+			}
+		}
+
+		for _, teamMap := range server.TeamMappings {
+			if teamMap.OrgID == 0 {
+				teamMap.OrgID = 1
+			}
+
+			if err := teamMap.validate(); err != nil {
+				return nil, errutil.Wrap("Failed to validate team_mappings section", err)
+			}
+		}
+
+		for _, folderMap := range server.FolderMappings {
+			if folderMap.OrgID == 0 {
+				folderMap.OrgID = 1
+			}
+
+			if folderMap.Permission == "" {
+				folderMap.Permission = m.PERMISSION_VIEW.String()
+			}
+
+			folderMap.normalizePermission()
+
+			if err := folderMap.validate(); err != nil {
+				return nil, errutil.Wrap("Failed to validate folder_mappings section", err)
+			}
+		}
+
+		for _, override := range server.RoleOverrides {
+			if override.OrgID == 0 {
+				override.OrgID = 1
+			}
+
+			if err := override.validate(); err != nil {
+				return nil, errutil.Wrap("Failed to validate role_overrides section", err)
+			}
+		}
+
+		if server.IsTLSInsecure() && setting.LDAPProductionMode {
+			return nil, xerrors.Errorf(
+				"Failed to validate ssl_skip_verify section: the TLS verification of %q can't be skipped in production mode",
+				server.Host,
+			)
+		}
+
+		if err := server.validateMetadataMappings(); err != nil {
+			return nil, errutil.Wrap("Failed to validate metadata_mappings section", err)
+		}
+
+		if err := server.validateBindMethod(); err != nil {
+			return nil, errutil.Wrap("Failed to validate bind_method section", err)
+		}
+
+		if err := server.applyGroupMembership(); err != nil {
+			return nil, errutil.Wrap("Failed to validate group_membership section", err)
+		}
+
+		if err := server.validateNestedGroups(); err != nil {
+			return nil, errutil.Wrap("Failed to validate nested_groups section", err)
+		}
+
+		if err := server.validateReferrals(); err != nil {
+			return nil, errutil.Wrap("Failed to validate follow_referrals section", err)
+		}
+
+		if err := server.validateRoleConflict(); err != nil {
+			return nil, errutil.Wrap("Failed to validate role_conflict section", err)
+		}
+
+		if err := server.validateStaleOrgRoles(); err != nil {
+			return nil, errutil.Wrap("Failed to validate stale_org_roles section", err)
+		}
+
+		if err := server.validateReplicas(); err != nil {
+			return nil, errutil.Wrap("Failed to validate replica_group section", err)
+		}
+
+		if server.DialTimeout < 0 {
+			return nil, xerrors.Errorf("Failed to validate dial_timeout section: negative timeout %d", server.DialTimeout)
+		}
+
+		if server.BindTimeout < 0 {
+			return nil, xerrors.Errorf("Failed to validate bind_timeout section: negative timeout %d", server.BindTimeout)
+		}
+
+		if server.SearchTimeout < 0 {
+			return nil, xerrors.Errorf("Failed to validate search_timeout section: negative timeout %d", server.SearchTimeout)
+		}
+
+		if server.PageSize < 0 {
+			return nil, xerrors.Errorf("Failed to validate page_size section: negative size %d", server.PageSize)
+		}
+
+		if server.InvalidEmail != "" && server.InvalidEmail != InvalidEmailWarn && server.InvalidEmail != InvalidEmailReject {
+			return nil, xerrors.Errorf(
+				"Failed to validate invalid_email section: unknown policy %q", server.InvalidEmail,
+			)
+		}
+
+		if server.DefaultOrgRole != "" && !server.DefaultOrgRole.IsValid() {
+			return nil, xerrors.Errorf(
+				"Failed to validate default_org_role section: invalid role %q", server.DefaultOrgRole,
+			)
 		}
 	}
 
 	return result, nil
 }
 
+// IsTLSInsecure checks if the server is dialed over TLS without verifying its certificate
+func (config *ServerConfig) IsTLSInsecure() bool {
+	return config.UseSSL && config.SkipVerifySSL
+}
+
 func assertNotEmptyCfg(val interface{}, propName string) error {
 	switch v := val.(type) {
 	case string:
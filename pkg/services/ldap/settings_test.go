@@ -0,0 +1,260 @@
+package ldap
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestConfig(t *testing.T) {
+	newConfig := func() *Config {
+		return &Config{
+			Servers: []*ServerConfig{
+				{
+					Host:          "ldap.example.org",
+					Port:          389,
+					BindDN:        "cn=admin,dc=grafana,dc=org",
+					SearchFilter:  "(cn=%s)",
+					SearchBaseDNs: []string{"dc=grafana,dc=org"},
+					Groups: []*GroupToOrgRole{
+						{GroupDN: "cn=admins,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_ADMIN},
+					},
+				},
+			},
+		}
+	}
+
+	Convey("Hash()", t, func() {
+		Convey("Identical configs should produce the same hash", func() {
+			first, err := newConfig().Hash()
+			So(err, ShouldBeNil)
+
+			second, err := newConfig().Hash()
+			So(err, ShouldBeNil)
+
+			So(first, ShouldNotBeEmpty)
+			So(first, ShouldEqual, second)
+		})
+
+		Convey("A changed config should produce a different hash", func() {
+			first, err := newConfig().Hash()
+			So(err, ShouldBeNil)
+
+			changed := newConfig()
+			changed.Servers[0].Groups[0].OrgRole = models.ROLE_VIEWER
+
+			second, err := changed.Hash()
+			So(err, ShouldBeNil)
+
+			So(first, ShouldNotEqual, second)
+		})
+
+		Convey("Should only hash the secrets keyed by the secret key", func() {
+			secretKey := setting.SecretKey
+			defer func() { setting.SecretKey = secretKey }()
+
+			secured := newConfig()
+			secured.Servers[0].BindPassword = "grafana-secret"
+
+			setting.SecretKey = "first-key"
+			first, err := secured.Hash()
+			So(err, ShouldBeNil)
+
+			rotated := newConfig()
+			rotated.Servers[0].BindPassword = "rotated-secret"
+
+			second, err := rotated.Hash()
+			So(err, ShouldBeNil)
+			So(first, ShouldNotEqual, second)
+
+			setting.SecretKey = "second-key"
+			third, err := secured.Hash()
+			So(err, ShouldBeNil)
+			So(first, ShouldNotEqual, third)
+			So(secured.Servers[0].BindPassword, ShouldEqual, "grafana-secret")
+		})
+	})
+
+	Convey("ParseConfig()", t, func() {
+		Convey("Should parse and validate the config", func() {
+			config, err := ParseConfig(`
+[[servers]]
+host = "ldap.example.org"
+search_filter = "(cn=%s)"
+search_base_dns = ["dc=grafana,dc=org"]
+
+[[servers.group_mappings]]
+group_dn = "cn=admins,dc=grafana,dc=org"
+org_role = "Admin"
+`)
+
+			So(err, ShouldBeNil)
+			So(config.Servers, ShouldHaveLength, 1)
+			So(config.Servers[0].Host, ShouldEqual, "ldap.example.org")
+			So(config.Servers[0].Groups[0].OrgID, ShouldEqual, 1)
+		})
+
+		Convey("Should refuse an invalid config", func() {
+			_, err := ParseConfig(`
+[[servers]]
+host = "ldap.example.org"
+`)
+
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Should refuse the negative timeouts", func() {
+			for _, timeout := range []string{"dial_timeout", "bind_timeout", "search_timeout"} {
+				_, err := ParseConfig(`
+[[servers]]
+host = "ldap.example.org"
+search_filter = "(cn=%s)"
+search_base_dns = ["dc=grafana,dc=org"]
+` + timeout + " = -1")
+
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "Failed to validate "+timeout+" section: negative timeout -1")
+			}
+		})
+
+		Convey("Should refuse a config including files", func() {
+			_, err := ParseConfig(`
+include = ["/etc/grafana/ldap.d/*.toml"]
+
+[[servers]]
+host = "ldap.example.org"
+search_filter = "(cn=%s)"
+search_base_dns = ["dc=grafana,dc=org"]
+`)
+
+			So(err, ShouldEqual, ErrIncludeNotAllowed)
+		})
+
+		Convey("Should refuse a config without servers", func() {
+			_, err := ParseConfig(``)
+
+			So(err, ShouldEqual, ErrNoServersConfigured)
+		})
+
+		Convey("ssl_skip_verify", func() {
+			config := `
+[[servers]]
+host = "ldap.example.org"
+use_ssl = true
+ssl_skip_verify = true
+search_filter = "(cn=%s)"
+search_base_dns = ["dc=grafana,dc=org"]
+`
+
+			productionMode := setting.LDAPProductionMode
+			Reset(func() {
+				setting.LDAPProductionMode = productionMode
+			})
+
+			Convey("Should be allowed outside of production mode", func() {
+				setting.LDAPProductionMode = false
+
+				result, err := ParseConfig(config)
+
+				So(err, ShouldBeNil)
+				So(result.Servers[0].IsTLSInsecure(), ShouldBeTrue)
+			})
+
+			Convey("Should be refused in production mode", func() {
+				setting.LDAPProductionMode = true
+
+				_, err := ParseConfig(config)
+
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "can't be skipped in production mode")
+			})
+		})
+	})
+
+	Convey("loadConfig()", t, func() {
+		dir, err := ioutil.TempDir("", "ldap")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		configFile := setting.LDAPConfigFile
+		defer func() { setting.LDAPConfigFile = configFile }()
+
+		setting.LDAPConfigFile = filepath.Join(dir, "ldap.toml")
+		err = ioutil.WriteFile(setting.LDAPConfigFile, []byte(`
+[[servers]]
+host = "file.example.org"
+search_filter = "(cn=%s)"
+search_base_dns = ["dc=grafana,dc=org"]
+`), 0644)
+		So(err, ShouldBeNil)
+
+		bus.ClearBusHandlers()
+		defer bus.ClearBusHandlers()
+
+		Convey("Should read the config stored in the database", func() {
+			bus.AddHandler("test", func(query *models.GetLDAPSettingsQuery) error {
+				query.Result = &models.LDAPSettings{Version: 2, Config: `
+[[servers]]
+host = "stored.example.org"
+search_filter = "(cn=%s)"
+search_base_dns = ["dc=grafana,dc=org"]
+`}
+				return nil
+			})
+
+			result, err := loadConfig()
+
+			So(err, ShouldBeNil)
+			So(result.Servers, ShouldHaveLength, 1)
+			So(result.Servers[0].Host, ShouldEqual, "stored.example.org")
+		})
+
+		Convey("Should refuse an invalid stored config rather than fall back to the file", func() {
+			bus.AddHandler("test", func(query *models.GetLDAPSettingsQuery) error {
+				query.Result = &models.LDAPSettings{Config: `[[servers]]`}
+				return nil
+			})
+
+			_, err := loadConfig()
+
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Should fail when the database fails", func() {
+			bus.AddHandler("test", func(query *models.GetLDAPSettingsQuery) error {
+				return errors.New("database is locked")
+			})
+
+			_, err := loadConfig()
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "database is locked")
+		})
+
+		Convey("Should read the config file without stored config", func() {
+			bus.AddHandler("test", func(query *models.GetLDAPSettingsQuery) error {
+				return models.ErrLDAPSettingsNotFound
+			})
+
+			result, err := loadConfig()
+
+			So(err, ShouldBeNil)
+			So(result.Servers[0].Host, ShouldEqual, "file.example.org")
+		})
+
+		Convey("Should read the config file without database", func() {
+			result, err := loadConfig()
+
+			So(err, ShouldBeNil)
+			So(result.Servers[0].Host, ShouldEqual, "file.example.org")
+		})
+	})
+}
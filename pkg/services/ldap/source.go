@@ -0,0 +1,29 @@
+package ldap
+
+import (
+	"time"
+)
+
+// ConfigSource tells where the loaded config comes from and when it was loaded
+type ConfigSource struct {
+	// File is the config file, it is empty for the config stored in the database
+	File string
+
+	// IncludedFiles are the config files merged into the config, see mergeIncludes
+	IncludedFiles []string
+
+	// DatabaseVersion is the version of the config stored in the database, 0 for the config file
+	DatabaseVersion int64
+
+	LoadedAt time.Time
+}
+
+// setSource records where the config was loaded from, now
+func (config *Config) setSource(file string, databaseVersion int64) {
+	config.Source = &ConfigSource{
+		File:            file,
+		IncludedFiles:   config.includedFiles,
+		DatabaseVersion: databaseVersion,
+		LoadedAt:        time.Now(),
+	}
+}
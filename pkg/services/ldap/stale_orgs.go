@@ -0,0 +1,47 @@
+package ldap
+
+import (
+	"golang.org/x/xerrors"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+const (
+	// StaleOrgRolesRemove removes the user from the orgs it has no role in anymore, even when it has no role left at all
+	StaleOrgRolesRemove = "remove"
+
+	// StaleOrgRolesDowngrade lowers the role of the user to the default_org_role in the orgs it has no role in anymore
+	StaleOrgRolesDowngrade = "downgrade"
+)
+
+// validateStaleOrgRoles checks the stale_org_roles policy, which needs group mappings:
+// the users of the servers without any would lose all their orgs
+func (config *ServerConfig) validateStaleOrgRoles() error {
+	switch config.StaleOrgRoles {
+	case "":
+		return nil
+	case StaleOrgRolesRemove, StaleOrgRolesDowngrade:
+		if len(config.Groups) == 0 {
+			return xerrors.Errorf("policy %q without group_mappings", config.StaleOrgRoles)
+		}
+
+		return nil
+	}
+
+	return xerrors.Errorf("unknown policy %q", config.StaleOrgRoles)
+}
+
+// staleOrgRole returns the role the sync leaves the user in the orgs it has no role in anymore, see ExternalUserInfo
+func (config *ServerConfig) staleOrgRole() *models.RoleType {
+	var role models.RoleType
+
+	switch config.StaleOrgRoles {
+	case StaleOrgRolesRemove:
+		return &role
+	case StaleOrgRolesDowngrade:
+		role = config.defaultOrgRole()
+		return &role
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestStaleOrgRoles(t *testing.T) {
+	Convey("ParseConfig()", t, func() {
+		parse := func(settings string) (*Config, error) {
+			return ParseConfig(`
+[[servers]]
+host = "127.0.0.1"
+search_filter = "(cn=%s)"
+search_base_dns = ["dc=grafana,dc=org"]
+` + settings)
+		}
+
+		groups := `
+[[servers.group_mappings]]
+group_dn = "cn=admins,ou=groups,dc=grafana,dc=org"
+org_role = "Admin"
+`
+
+		Convey("Should downgrade the stale roles to the default org role", func() {
+			config, err := parse("stale_org_roles = \"downgrade\"\ndefault_org_role = \"Editor\"" + groups)
+
+			So(err, ShouldBeNil)
+			So(*config.Servers[0].staleOrgRole(), ShouldEqual, models.ROLE_EDITOR)
+
+			config.Servers[0].DefaultOrgRole = ""
+			So(*config.Servers[0].staleOrgRole(), ShouldEqual, models.ROLE_VIEWER)
+		})
+
+		Convey("Should remove the stale roles", func() {
+			config, err := parse(`stale_org_roles = "remove"` + groups)
+
+			So(err, ShouldBeNil)
+			So(*config.Servers[0].staleOrgRole(), ShouldEqual, models.RoleType(""))
+		})
+
+		Convey("Should leave the stale roles to the sync by default", func() {
+			config, err := parse(groups)
+
+			So(err, ShouldBeNil)
+			So(config.Servers[0].staleOrgRole(), ShouldBeNil)
+		})
+
+		Convey("Should refuse an unknown policy", func() {
+			_, err := parse(`stale_org_roles = "keep"` + groups)
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, `unknown policy "keep"`)
+		})
+
+		Convey("Should refuse a policy without group mappings", func() {
+			_, err := parse(`stale_org_roles = "remove"`)
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, `policy "remove" without group_mappings`)
+		})
+	})
+}
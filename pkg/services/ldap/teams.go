@@ -0,0 +1,49 @@
+package ldap
+
+import (
+	"golang.org/x/xerrors"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// validate checks the mapping names a team
+func (mapping *GroupToTeam) validate() error {
+	if mapping.TeamID <= 0 {
+		return xerrors.Errorf("invalid team_id %d for group %q", mapping.TeamID, mapping.GroupDN)
+	}
+
+	return nil
+}
+
+// Matches checks if one of the groups is the group of the mapping
+func (mapping *GroupToTeam) Matches(memberOf []string) bool {
+	return isMemberOf(memberOf, mapping.GroupDN)
+}
+
+// getMappedTeams returns the teams of the team mappings matching the groups of the user. Like the teams synced with
+// the groups, they are limited to the organizations where the user has a role, unless allow_teams_without_role is set.
+func (server *Server) getMappedTeams(memberOf []string, orgRoles map[int64]models.RoleType) []models.ExternalTeam {
+	teams := []models.ExternalTeam{}
+
+	for _, mapping := range server.Config.TeamMappings {
+		if !mapping.Matches(memberOf) {
+			continue
+		}
+
+		if !server.Config.AllowTeamsWithoutRole && orgRoles[mapping.OrgID] == "" {
+			continue
+		}
+
+		team := models.ExternalTeam{
+			OrgId:       mapping.OrgID,
+			TeamId:      mapping.TeamID,
+			IsFromGroup: true,
+		}
+
+		if !hasExternalTeam(teams, team) {
+			teams = append(teams, team)
+		}
+	}
+
+	return teams
+}
@@ -0,0 +1,125 @@
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestTeamMappings(t *testing.T) {
+	Convey("Team mappings", t, func() {
+		newServer := func(mappings ...*GroupToTeam) *Server {
+			return &Server{
+				Config: &ServerConfig{
+					Attr: AttributeMap{
+						Username: "username",
+						MemberOf: "memberof",
+					},
+					Groups: []*GroupToOrgRole{
+						{GroupDN: "*", OrgID: 1, OrgRole: models.ROLE_VIEWER},
+					},
+					TeamMappings:  mappings,
+					SearchBaseDNs: []string{"BaseDNHere"},
+				},
+				Connection: &MockConnection{},
+				log:        log.New("test-logger"),
+			}
+		}
+
+		buildUser := func(server *Server, memberOf ...string) *models.ExternalUserInfo {
+			entry := ldap.Entry{
+				DN: "dn",
+				Attributes: []*ldap.EntryAttribute{
+					{Name: "username", Values: []string{"roelgerrits"}},
+					{Name: "memberof", Values: memberOf},
+				},
+			}
+
+			users, err := server.serializeUsers([]*ldap.Entry{&entry})
+			So(err, ShouldBeNil)
+
+			return users[0]
+		}
+
+		Convey("Should not sync the teams without team mappings", func() {
+			user := buildUser(newServer(), "cn=ops")
+
+			So(user.Teams, ShouldBeNil)
+		})
+
+		Convey("Should add the teams of the matched groups", func() {
+			server := newServer(
+				&GroupToTeam{GroupDN: "cn=ops", OrgID: 1, TeamID: 10},
+				&GroupToTeam{GroupDN: "CN=Admins", OrgID: 1, TeamID: 10},
+				&GroupToTeam{GroupDN: "cn=admins", OrgID: 1, TeamID: 20},
+				&GroupToTeam{GroupDN: "cn=devs", OrgID: 1, TeamID: 30},
+			)
+
+			So(buildUser(server, "cn=ops", "cn=admins").Teams, ShouldResemble, []models.ExternalTeam{
+				{OrgId: 1, TeamId: 10, IsFromGroup: true},
+				{OrgId: 1, TeamId: 20, IsFromGroup: true},
+			})
+
+			Convey("No team is given when no group matches, so the user is removed from the synced teams", func() {
+				So(buildUser(server, "cn=guests").Teams, ShouldBeEmpty)
+				So(buildUser(server, "cn=guests").Teams, ShouldNotBeNil)
+			})
+		})
+
+		Convey("Should only add the teams of the organizations where the user has a role", func() {
+			server := newServer(
+				&GroupToTeam{GroupDN: "cn=ops", OrgID: 1, TeamID: 10},
+				&GroupToTeam{GroupDN: "cn=ops", OrgID: 2, TeamID: 20},
+			)
+
+			So(buildUser(server, "cn=ops").Teams, ShouldResemble, []models.ExternalTeam{
+				{OrgId: 1, TeamId: 10, IsFromGroup: true},
+			})
+
+			server.Config.AllowTeamsWithoutRole = true
+
+			So(buildUser(server, "cn=ops").Teams, ShouldHaveLength, 2)
+		})
+
+		Convey("Should keep the default teams", func() {
+			server := newServer(&GroupToTeam{GroupDN: "cn=ops", OrgID: 1, TeamID: 10})
+			server.Config.DefaultTeams = []*DefaultTeam{{OrgID: 1, TeamID: 10}}
+
+			So(buildUser(server, "cn=ops").Teams, ShouldResemble, []models.ExternalTeam{
+				{OrgId: 1, TeamId: 10, IsDefault: true},
+			})
+		})
+	})
+
+	Convey("ParseConfig()", t, func() {
+		parse := func(mapping string) (*Config, error) {
+			return ParseConfig(`
+[[servers]]
+host = "127.0.0.1"
+search_filter = "(cn=%s)"
+search_base_dns = ["dc=grafana,dc=org"]
+
+[[servers.team_mappings]]
+group_dn = "cn=ops"
+` + mapping)
+		}
+
+		Convey("Should default to the main org", func() {
+			config, err := parse(`team_id = 10`)
+
+			So(err, ShouldBeNil)
+			So(config.Servers[0].TeamMappings[0].OrgID, ShouldEqual, 1)
+		})
+
+		Convey("Should refuse a mapping without team", func() {
+			_, err := parse(`org_id = 2`)
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "invalid team_id 0")
+		})
+	})
+}
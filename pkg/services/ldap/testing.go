@@ -12,6 +12,8 @@ type MockConnection struct {
 	SearchError      error
 	SearchCalled     bool
 	SearchAttributes []string
+	SearchRequests   []*ldap.SearchRequest
+	SearchProvider   func(*ldap.SearchRequest) (*ldap.SearchResult, error)
 
 	AddParams *ldap.AddRequest
 	AddCalled bool
@@ -21,9 +23,11 @@ type MockConnection struct {
 
 	UnauthenticatedBindCalled bool
 	BindCalled                bool
+	ExternalBindCalled        bool
 
 	BindProvider                func(username, password string) error
 	UnauthenticatedBindProvider func() error
+	ExternalBindProvider        func() error
 }
 
 // Bind mocks Bind connection function
@@ -48,6 +52,17 @@ func (c *MockConnection) UnauthenticatedBind(username string) error {
 	return nil
 }
 
+// ExternalBind mocks the SASL EXTERNAL bind of the connection
+func (c *MockConnection) ExternalBind() error {
+	c.ExternalBindCalled = true
+
+	if c.ExternalBindProvider != nil {
+		return c.ExternalBindProvider()
+	}
+
+	return nil
+}
+
 // Close mocks Close connection function
 func (c *MockConnection) Close() {}
 
@@ -63,6 +78,11 @@ func (c *MockConnection) setSearchError(err error) {
 func (c *MockConnection) Search(sr *ldap.SearchRequest) (*ldap.SearchResult, error) {
 	c.SearchCalled = true
 	c.SearchAttributes = sr.Attributes
+	c.SearchRequests = append(c.SearchRequests, sr)
+
+	if c.SearchProvider != nil {
+		return c.SearchProvider(sr)
+	}
 
 	if c.SearchError != nil {
 		return nil, c.SearchError
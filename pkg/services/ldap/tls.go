@@ -0,0 +1,62 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// tlsMaterial is the CA bundle and the client certificate of a server, read from the files of its config
+type tlsMaterial struct {
+	rootCAs    *x509.CertPool
+	clientCert tls.Certificate
+}
+
+// loadTLSMaterial reads the CA bundle and the client certificate of the server. They're read again for every
+// connection, so a rotated certificate is used by the connections dialed since, see multildap.CycleConnections.
+func loadTLSMaterial(config *ServerConfig) (*tlsMaterial, error) {
+	material := &tlsMaterial{}
+
+	if config.RootCACert != "" {
+		material.rootCAs = x509.NewCertPool()
+		for _, caCertFile := range strings.Split(config.RootCACert, " ") {
+			pem, err := ioutil.ReadFile(caCertFile)
+			if err != nil {
+				return nil, err
+			}
+			if !material.rootCAs.AppendCertsFromPEM(pem) {
+				return nil, errors.New("Failed to append CA certificate " + caCertFile)
+			}
+		}
+	}
+
+	if config.ClientCert != "" && config.ClientKey != "" {
+		var err error
+		material.clientCert, err = tls.LoadX509KeyPair(config.ClientCert, config.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return material, nil
+}
+
+// checkTLSMaterial checks the CA bundles and the client certificates of the servers over TLS can be loaded,
+// so a reload in the middle of a certificate rotation fails instead of the connections to the server
+func (config *Config) checkTLSMaterial() error {
+	for _, server := range config.Servers {
+		if !server.UseSSL {
+			continue
+		}
+
+		if _, err := loadTLSMaterial(server); err != nil {
+			return xerrors.Errorf("Failed to load the TLS certificates of the LDAP server %s: %w", server.Host, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+package ldap
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// writeCertificate writes a self-signed certificate and its key to the directory, and returns their paths
+func writeCertificate(dir string, name string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	So(err, ShouldBeNil)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	So(err, ShouldBeNil)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	So(err, ShouldBeNil)
+
+	certPath, keyPath := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	So(ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644), ShouldBeNil)
+	So(ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600), ShouldBeNil)
+
+	return certPath, keyPath
+}
+
+func TestTLSMaterial(t *testing.T) {
+	Convey("loadTLSMaterial()", t, func() {
+		dir, err := ioutil.TempDir("", "ldap")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		certPath, keyPath := writeCertificate(dir, "client")
+
+		Convey("Should load the CA bundle and the client certificate", func() {
+			material, err := loadTLSMaterial(&ServerConfig{RootCACert: certPath, ClientCert: certPath, ClientKey: keyPath})
+
+			So(err, ShouldBeNil)
+			So(material.rootCAs, ShouldNotBeNil)
+			So(material.clientCert.Certificate, ShouldHaveLength, 1)
+		})
+
+		Convey("Should load nothing without certificates", func() {
+			material, err := loadTLSMaterial(&ServerConfig{})
+
+			So(err, ShouldBeNil)
+			So(material.rootCAs, ShouldBeNil)
+			So(material.clientCert.Certificate, ShouldBeEmpty)
+		})
+
+		Convey("Should fail on a missing or invalid file", func() {
+			_, err := loadTLSMaterial(&ServerConfig{ClientCert: filepath.Join(dir, "missing.crt"), ClientKey: keyPath})
+			So(err, ShouldNotBeNil)
+
+			_, err = loadTLSMaterial(&ServerConfig{RootCACert: keyPath})
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("ReloadConfig() with TLS certificates", t, func() {
+		dir, err := ioutil.TempDir("", "ldap")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "ldap.toml")
+		certPath, keyPath := writeCertificate(dir, "client")
+
+		enabled, configFile, loaded := setting.LDAPEnabled, setting.LDAPConfigFile, config
+		defer func() { setting.LDAPEnabled, setting.LDAPConfigFile, config = enabled, configFile, loaded }()
+
+		setting.LDAPEnabled = true
+		setting.LDAPConfigFile = path
+		config = nil
+
+		writeConfig := func(cert string) {
+			content := `
+[[servers]]
+host = "ldap.example.org"
+port = 636
+use_ssl = true
+client_cert = "` + cert + `"
+client_key = "` + keyPath + `"
+search_filter = "(cn=%s)"
+search_base_dns = ["dc=grafana,dc=org"]
+`
+			So(ioutil.WriteFile(path, []byte(content), 0644), ShouldBeNil)
+		}
+
+		writeConfig(certPath)
+		_, err = ReloadConfig()
+		So(err, ShouldBeNil)
+
+		previous := config
+
+		Convey("Should keep the previous config when the certificates can't be loaded", func() {
+			writeConfig(filepath.Join(dir, "rotated.crt"))
+
+			_, err := ReloadConfig()
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "Failed to load the TLS certificates of the LDAP server ldap.example.org")
+			So(config, ShouldEqual, previous)
+		})
+
+		Convey("Should load the rotated certificates", func() {
+			certPath, keyPath = writeCertificate(dir, "rotated")
+			writeConfig(certPath)
+
+			_, err := ReloadConfig()
+
+			So(err, ShouldBeNil)
+			So(config, ShouldNotEqual, previous)
+			So(config.Servers[0].ClientCert, ShouldEqual, certPath)
+		})
+
+		Convey("Should never serve the invalid config to the concurrent readers", func() {
+			writeConfig(filepath.Join(dir, "rotated.crt"))
+
+			done := make(chan struct{})
+			served := make(chan *Config, 1)
+			go func() {
+				defer close(served)
+				for {
+					select {
+					case <-done:
+						return
+					default:
+						if cached, _ := GetConfig(); cached != previous {
+							served <- cached
+							return
+						}
+					}
+				}
+			}()
+
+			_, err := ReloadConfig()
+			close(done)
+
+			So(err, ShouldNotBeNil)
+			So(<-served, ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,91 @@
+package ldap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+
+	"gopkg.in/ldap.v3"
+)
+
+// Attributes of the Active Directory users read to resolve their groups
+const (
+	// tokenGroupsAttribute is a constructed attribute listing the SIDs of all the groups of the user, the nested ones
+	// and the primary group included. It is only returned by a search of the user entry itself.
+	tokenGroupsAttribute = "tokenGroups"
+
+	objectSidAttribute      = "objectSid"
+	primaryGroupIDAttribute = "primaryGroupID"
+)
+
+// resolveActiveDirectoryGroups adds to the groups of the user the groups of its tokenGroups and its primary group,
+// like "Domain Users", which memberOf never lists. Their SIDs are resolved to DNs by searching the groups.
+func (server *Server) resolveActiveDirectoryGroups(userDN string, memberOf []string) ([]string, error) {
+	result, _, err := server.search(&ldap.SearchRequest{
+		BaseDN:       userDN,
+		Scope:        ldap.ScopeBaseObject,
+		DerefAliases: ldap.NeverDerefAliases,
+		Attributes:   []string{tokenGroupsAttribute, objectSidAttribute, primaryGroupIDAttribute},
+		Filter:       "(objectClass=*)",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Entries) == 0 {
+		return memberOf, nil
+	}
+
+	entry := result.Entries[0]
+
+	sids := entry.GetRawAttributeValues(tokenGroupsAttribute)
+	if sid := primaryGroupSID(entry.GetRawAttributeValue(objectSidAttribute), entry.GetAttributeValue(primaryGroupIDAttribute)); sid != nil {
+		sids = append(sids, sid)
+	}
+
+	if len(sids) == 0 {
+		return memberOf, nil
+	}
+
+	filter := ""
+	for _, sid := range sids {
+		filter += fmt.Sprintf("(%s=%s)", objectSidAttribute, escapeBinaryFilter(sid))
+	}
+
+	groups, err := server.searchGroupDNs("(|" + filter + ")")
+	if err != nil {
+		return nil, err
+	}
+
+	return uniqueStrings(append(memberOf, groups...)), nil
+}
+
+// primaryGroupSID returns the SID of the primary group of the user, the SID of its domain followed by the primary group ID,
+// nil when the user SID or the primary group ID isn't valid. The domain SID is the user SID without its last sub-authority.
+func primaryGroupSID(userSID []byte, primaryGroupID string) []byte {
+	rid, err := strconv.ParseUint(primaryGroupID, 10, 32)
+	if err != nil {
+		return nil
+	}
+
+	// revision, count of sub-authorities, identifier authority on 6 bytes, then the sub-authorities on 4 bytes each
+	if len(userSID) < 12 || len(userSID) != 8+4*int(userSID[1]) {
+		return nil
+	}
+
+	sid := make([]byte, len(userSID))
+	copy(sid, userSID)
+	binary.LittleEndian.PutUint32(sid[len(sid)-4:], uint32(rid))
+
+	return sid
+}
+
+// escapeBinaryFilter escapes every byte of a binary value, like a SID, to compare an attribute with it in a filter
+func escapeBinaryFilter(value []byte) string {
+	escaped := ""
+	for _, b := range value {
+		escaped += fmt.Sprintf("\\%02x", b)
+	}
+
+	return escaped
+}
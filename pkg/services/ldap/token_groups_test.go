@@ -0,0 +1,141 @@
+package ldap
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestActiveDirectoryGroups(t *testing.T) {
+	Convey("Active Directory groups", t, func() {
+		// S-1-5-21-1-2-3 is the SID of the domain, the last sub-authority is the RID
+		sid := func(rid byte) []byte {
+			return []byte{
+				1, 5, 0, 0, 0, 0, 0, 5,
+				21, 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 3, 0, 0, 0,
+				rid, 0, 0, 0,
+			}
+		}
+
+		groupsBySID := map[string]string{
+			escapeBinaryFilter(sid(0x01)): "cn=domain users,cn=users,dc=grafana,dc=org",
+			escapeBinaryFilter(sid(0x10)): "cn=staff,ou=groups,dc=grafana,dc=org",
+		}
+
+		connection := &MockConnection{}
+		server := &Server{
+			Config: &ServerConfig{
+				Attr: AttributeMap{
+					Username: "username",
+					MemberOf: "memberof",
+				},
+				SearchBaseDNs:         []string{"dc=grafana,dc=org"},
+				ActiveDirectoryGroups: true,
+				Groups: []*GroupToOrgRole{
+					{GroupDN: "cn=domain users,cn=users,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_VIEWER},
+				},
+			},
+			Connection: connection,
+			log:        log.New("test-logger"),
+		}
+
+		userEntry := &ldap.Entry{DN: "cn=roelgerrits,ou=users,dc=grafana,dc=org", Attributes: []*ldap.EntryAttribute{
+			{Name: tokenGroupsAttribute, ByteValues: [][]byte{sid(0x10)}},
+			{Name: objectSidAttribute, ByteValues: [][]byte{sid(0x55)}},
+			{Name: primaryGroupIDAttribute, Values: []string{"1"}},
+		}}
+
+		connection.SearchProvider = func(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+			if request.Scope == ldap.ScopeBaseObject {
+				return &ldap.SearchResult{Entries: []*ldap.Entry{userEntry}}, nil
+			}
+
+			result := &ldap.SearchResult{}
+			for escaped, group := range groupsBySID {
+				if strings.Contains(request.Filter, escaped) {
+					result.Entries = append(result.Entries, &ldap.Entry{DN: group})
+				}
+			}
+
+			return result, nil
+		}
+
+		buildUser := func() (*models.ExternalUserInfo, error) {
+			return server.buildGrafanaUser(&ldap.Entry{
+				DN: "cn=roelgerrits,ou=users,dc=grafana,dc=org",
+				Attributes: []*ldap.EntryAttribute{
+					{Name: "username", Values: []string{"roelgerrits"}},
+					{Name: "memberof", Values: []string{"cn=devs,ou=groups,dc=grafana,dc=org"}},
+				},
+			})
+		}
+
+		Convey("Should match the primary group and the token groups", func() {
+			user, err := buildUser()
+
+			So(err, ShouldBeNil)
+			So(user.Groups, ShouldHaveLength, 3)
+			So(user.Groups[0], ShouldEqual, "cn=devs,ou=groups,dc=grafana,dc=org")
+			So(user.Groups, ShouldContain, "cn=domain users,cn=users,dc=grafana,dc=org")
+			So(user.Groups, ShouldContain, "cn=staff,ou=groups,dc=grafana,dc=org")
+			So(user.OrgRoles, ShouldResemble, map[int64]models.RoleType{1: models.ROLE_VIEWER})
+
+			So(connection.SearchRequests, ShouldHaveLength, 2)
+			So(connection.SearchRequests[0].BaseDN, ShouldEqual, "cn=roelgerrits,ou=users,dc=grafana,dc=org")
+			So(connection.SearchRequests[0].Attributes, ShouldResemble, []string{"tokenGroups", "objectSid", "primaryGroupID"})
+			So(connection.SearchRequests[1].BaseDN, ShouldEqual, "dc=grafana,dc=org")
+			So(connection.SearchRequests[1].Filter, ShouldEqual,
+				"(|(objectSid="+escapeBinaryFilter(sid(0x10))+")(objectSid="+escapeBinaryFilter(sid(0x01))+"))")
+		})
+
+		Convey("Should only match the direct groups without Active Directory groups", func() {
+			server.Config.ActiveDirectoryGroups = false
+
+			user, err := buildUser()
+
+			So(err, ShouldBeNil)
+			So(user.Groups, ShouldResemble, []string{"cn=devs,ou=groups,dc=grafana,dc=org"})
+			So(connection.SearchCalled, ShouldBeFalse)
+		})
+
+		Convey("Should skip the groups search when the user has no SID", func() {
+			userEntry.Attributes = nil
+
+			user, err := buildUser()
+
+			So(err, ShouldBeNil)
+			So(user.Groups, ShouldResemble, []string{"cn=devs,ou=groups,dc=grafana,dc=org"})
+			So(connection.SearchRequests, ShouldHaveLength, 1)
+		})
+
+		Convey("Should fail when the search of the user entry fails", func() {
+			connection.SearchProvider = func(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+				return nil, errors.New("Search error")
+			}
+
+			_, err := buildUser()
+
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("primaryGroupSID()", t, func() {
+		userSID := []byte{1, 2, 0, 0, 0, 0, 0, 5, 21, 0, 0, 0, 0x55, 0x04, 0, 0}
+
+		Convey("Should replace the RID of the user SID", func() {
+			So(primaryGroupSID(userSID, "513"), ShouldResemble, []byte{1, 2, 0, 0, 0, 0, 0, 5, 21, 0, 0, 0, 0x01, 0x02, 0, 0})
+		})
+
+		Convey("Should ignore the invalid SIDs and group IDs", func() {
+			So(primaryGroupSID(userSID[:15], "513"), ShouldBeNil)
+			So(primaryGroupSID(nil, "513"), ShouldBeNil)
+			So(primaryGroupSID(userSID, ""), ShouldBeNil)
+		})
+	})
+}
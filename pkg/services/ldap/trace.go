@@ -0,0 +1,58 @@
+package ldap
+
+const (
+	// TraceStepConnect is the connection to the LDAP server
+	TraceStepConnect = "connect"
+
+	// TraceStepBind is the bind before the user search
+	TraceStepBind = "bind"
+
+	// TraceStepSearch is the search of the user entry
+	TraceStepSearch = "search"
+
+	// TraceStepGroupMapping is the mapping of the user groups to organization roles
+	TraceStepGroupMapping = "group mapping"
+
+	// TraceStepUserBind is the verification of the user password
+	TraceStepUserBind = "user bind"
+)
+
+// TraceStep is a step of the login of a user, recorded for debugging
+type TraceStep struct {
+	Server  string `json:"server,omitempty"`
+	Step    string `json:"step"`
+	Message string `json:"message"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Trace records the steps of the login of a user.
+// A nil trace doesn't record anything.
+type Trace struct {
+	Steps []TraceStep
+}
+
+// NewTrace creates an empty trace
+func NewTrace() *Trace {
+	return &Trace{Steps: []TraceStep{}}
+}
+
+// Add records a step of the login, the step failed if err isn't nil
+func (trace *Trace) Add(server, step, message string, err error) {
+	if trace == nil {
+		return
+	}
+
+	traceStep := TraceStep{
+		Server:  server,
+		Step:    step,
+		Message: message,
+		Success: err == nil,
+	}
+
+	if err != nil {
+		traceStep.Error = err.Error()
+	}
+
+	trace.Steps = append(trace.Steps, traceStep)
+}
@@ -0,0 +1,277 @@
+package ldapsync
+
+import (
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// usersPageSize is the amount of Grafana users fetched at once by the bulk sync
+const usersPageSize = 1000
+
+// sleep waits before retrying the sync of a user, replaced in the tests
+var sleep = time.Sleep
+
+// UserResult is the result of the sync of a single user by the bulk sync
+type UserResult struct {
+	UserId   int64    `json:"userId"`
+	Login    string   `json:"login"`
+	Changes  *Changes `json:"changes,omitempty"`
+	Error    string   `json:"error,omitempty"`
+	Attempts int      `json:"attempts,omitempty"`
+
+	// Skipped is set when the user wasn't upserted, for the SkipReason like SkipReasonUnchanged
+	Skipped    bool   `json:"skipped,omitempty"`
+	SkipReason string `json:"skipReason,omitempty"`
+}
+
+// Summary is the summary of the bulk sync.
+// The users still failing after the retries are also listed in the dead letter, for a manual follow-up.
+// Updated and Disabled count the synced users whose roles, teams or state changed, and the ones disabled by the sync.
+type Summary struct {
+	Synced     int           `json:"synced"`
+	Updated    int           `json:"updated"`
+	Disabled   int           `json:"disabled"`
+	Skipped    int           `json:"skipped"`
+	Failed     int           `json:"failed"`
+	Users      []*UserResult `json:"users"`
+	DeadLetter []*UserResult `json:"deadLetter"`
+
+	// Since is only set by an incremental sync, only the users modified since then were synced
+	Since *time.Time `json:"since,omitempty"`
+
+	// ChangedSince is only set by an incremental sync with change markers, only the users changed since the markers
+	// of their server were synced
+	ChangedSince map[string]string `json:"changedSince,omitempty"`
+
+	// DisableThresholdExceeded is set when the users missing from LDAP weren't disabled, as there were more than the
+	// disable threshold, see DisableThreshold. They failed with ErrDisableThreshold instead
+	DisableThresholdExceeded bool `json:"disableThresholdExceeded,omitempty"`
+}
+
+// ProgressFunc is called by the bulk sync after every synced user with its result, one call at a time
+type ProgressFunc func(done, total int, user *UserResult)
+
+// SyncAllUsers synchronizes every Grafana user authenticated with LDAP, reporting the progress to the optional progress func.
+// Nothing is synced when the config doesn't pass the pre-flight checks.
+// The users failing because of a transient error are retried, see syncUserWithRetries.
+// The users missing from LDAP are only disabled once every other user is synced, and not at all when there are more
+// than the disable threshold, unless forced, see DisableThreshold.
+func SyncAllUsers(config *ldap.Config, ldapServer multildap.IMultiLDAP, progress ProgressFunc, force bool) (*Summary, error) {
+	if err := preflight(config); err != nil {
+		return nil, err
+	}
+
+	start := now()
+
+	users, err := getLDAPUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	summary := syncUsers(ldapServer, users, progress, force)
+	advanceWatermark(start, summary)
+
+	return summary, nil
+}
+
+// syncUsers syncs the users with up to sync_concurrency workers and summarizes their syncs.
+// The results keep the order of the users, whatever the order the workers finish in.
+// The users missing from LDAP are disabled last, once the disable threshold is checked, see disableMissingUsers.
+func syncUsers(ldapServer multildap.IMultiLDAP, users []*models.User, progress ProgressFunc, force bool) *Summary {
+	summary := &Summary{
+		Users:      []*UserResult{},
+		DeadLetter: []*UserResult{},
+	}
+
+	results := make([]*UserResult, len(users))
+	indexes := make([]int, len(users))
+	for i := range users {
+		indexes[i] = i
+	}
+
+	var lock sync.Mutex
+	done := 0
+
+	syncEach(ldapServer, users, indexes, true, results, func(i int) {
+		if progress != nil {
+			lock.Lock()
+			done++
+			progress(done, len(users), results[i])
+			lock.Unlock()
+		}
+	})
+
+	summary.DisableThresholdExceeded = !disableMissingUsers(ldapServer, users, results, force)
+
+	for _, result := range results {
+		switch {
+		case result.Error != "":
+			summary.Failed++
+			summary.DeadLetter = append(summary.DeadLetter, result)
+		case result.Skipped:
+			summary.Skipped++
+		default:
+			summary.Synced++
+			tallyChanges(summary, result.Changes)
+		}
+
+		summary.Users = append(summary.Users, result)
+	}
+
+	logger.Info(
+		"Synced the users with LDAP",
+		"synced", summary.Synced,
+		"updated", summary.Updated,
+		"disabled", summary.Disabled,
+		"skipped", summary.Skipped,
+		"failed", summary.Failed,
+	)
+
+	return summary
+}
+
+// syncEach syncs the users of the indexes with up to sync_concurrency workers, storing their results at the same index.
+// The synced func is called after the sync of each user, by the worker which synced it.
+func syncEach(ldapServer multildap.IMultiLDAP, users []*models.User, indexes []int, deferDisable bool, results []*UserResult, synced func(i int)) {
+	queue := make(chan int)
+
+	var workers sync.WaitGroup
+	for worker := 0; worker < syncConcurrency(len(indexes)); worker++ {
+		workers.Add(1)
+
+		go func() {
+			defer workers.Done()
+
+			for i := range queue {
+				results[i] = syncUserResult(ldapServer, users[i], deferDisable)
+
+				if synced != nil {
+					synced(i)
+				}
+			}
+		}()
+	}
+
+	for _, i := range indexes {
+		queue <- i
+	}
+	close(queue)
+	workers.Wait()
+}
+
+// syncConcurrency returns the number of workers syncing the users, sync_concurrency but at least one
+// and no more than the users to sync
+func syncConcurrency(users int) int {
+	concurrency := setting.LDAPSyncConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	if concurrency > users {
+		concurrency = users
+	}
+
+	return concurrency
+}
+
+// syncUserResult syncs the user for the bulk sync, see syncUserWithRetries
+func syncUserResult(ldapServer multildap.IMultiLDAP, user *models.User, deferDisable bool) *UserResult {
+	result := &UserResult{
+		UserId: user.Id,
+		Login:  user.Login,
+	}
+
+	changes, skipReason, attempts, err := syncUserWithRetries(ldapServer, user, deferDisable)
+	result.Attempts = attempts
+
+	switch {
+	case err != nil:
+		logger.Error("Failed to sync the user with LDAP", "user", user.Login, "attempts", attempts, "error", err)
+		result.Error = err.Error()
+	case skipReason != "":
+		result.Skipped = true
+		result.SkipReason = skipReason
+	default:
+		result.Changes = changes
+	}
+
+	return result
+}
+
+// syncUserWithRetries syncs the user unless it didn't change, retrying the transient failures up to sync_retries times
+// with a backoff doubling from sync_retry_backoff. It also returns the reason the sync was skipped and the number of attempts.
+func syncUserWithRetries(ldapServer multildap.IMultiLDAP, user *models.User, deferDisable bool) (*Changes, string, int, error) {
+	backoff := setting.LDAPSyncRetryBackoff
+
+	for attempt := 1; ; attempt++ {
+		changes, skipReason, err := syncChangedUser(ldapServer, user, deferDisable)
+		if err == nil || attempt > setting.LDAPSyncRetries || !isTransient(err) {
+			return changes, skipReason, attempt, err
+		}
+
+		logger.Warn(
+			"Failed to sync the user with LDAP, retrying",
+			"user", user.Login,
+			"attempt", attempt,
+			"backoff", backoff,
+			"error", err,
+		)
+
+		sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// isTransient checks if the sync failed because of an error which may go away by itself
+func isTransient(err error) bool {
+	return err == multildap.ErrUnreachable || err == ErrPartialOutage ||
+		err == ldap.ErrBindTimeout || err == ldap.ErrSearchTimeout
+}
+
+// getLDAPUsers fetches the Grafana users authenticated with LDAP
+func getLDAPUsers() ([]*models.User, error) {
+	users := []*models.User{}
+
+	for page := 1; ; page++ {
+		query := &models.SearchUsersQuery{
+			AuthModule: models.AuthModuleLDAP,
+			Page:       page,
+			Limit:      usersPageSize,
+		}
+
+		if err := bus.Dispatch(query); err != nil {
+			return nil, err
+		}
+
+		for _, hit := range query.Result.Users {
+			users = append(users, &models.User{
+				Id:         hit.Id,
+				Login:      hit.Login,
+				Email:      hit.Email,
+				Name:       hit.Name,
+				IsDisabled: hit.IsDisabled,
+			})
+		}
+
+		if len(query.Result.Users) < usersPageSize {
+			return users, nil
+		}
+	}
+}
+
+// tallyChanges counts the synced user as updated or disabled in the summary
+func tallyChanges(summary *Summary, changes *Changes) {
+	switch {
+	case changes == nil:
+	case changes.Action == ActionDisabled:
+		summary.Disabled++
+	case changes.changed():
+		summary.Updated++
+	}
+}
@@ -0,0 +1,378 @@
+package ldapsync
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mockLDAPUsers(t *testing.T, users []*models.UserSearchHitDTO) {
+	bus.AddHandler("test", func(query *models.SearchUsersQuery) error {
+		assert.Equal(t, models.AuthModuleLDAP, query.AuthModule)
+		query.Result = models.SearchUserQueryResult{Users: users}
+		return nil
+	})
+
+	bus.AddHandler("test", func(query *models.GetUserByIdQuery) error {
+		query.Result = &models.User{Id: query.Id}
+		return nil
+	})
+
+	bus.AddHandler("test", func(query *models.GetUserOrgListQuery) error {
+		query.Result = []*models.UserOrgDTO{}
+		return nil
+	})
+
+	bus.AddHandler("test", func(query *models.GetTeamMembersQuery) error {
+		query.Result = []*models.TeamMemberDTO{}
+		return nil
+	})
+}
+
+func TestSyncAllUsers(t *testing.T) {
+	t.Run("refuses to sync with missing organizations", func(t *testing.T) {
+		bus.ClearBusHandlers()
+		defer bus.ClearBusHandlers()
+
+		mockExistingOrgs(1)
+
+		ldapServer := &multildap.MockMultiLDAP{}
+
+		summary, err := SyncAllUsers(configWithOrgs(1, 2), ldapServer, nil, false)
+
+		assert.Nil(t, summary)
+		assert.Equal(t, &MissingOrgsError{OrgIds: []int64{2}}, err)
+		assert.Equal(t, 0, ldapServer.UserCalledTimes)
+	})
+
+	t.Run("syncs every LDAP user", func(t *testing.T) {
+		bus.ClearBusHandlers()
+		defer bus.ClearBusHandlers()
+
+		mockExistingOrgs(1)
+		mockLDAPUsers(t, []*models.UserSearchHitDTO{
+			{Id: 1, Login: "found"},
+			{Id: 2, Login: "broken"},
+		})
+
+		upserted := []string{}
+		bus.AddHandler("test", func(cmd *models.UpsertUserCommand) error {
+			upserted = append(upserted, cmd.ExternalUser.Login)
+			return nil
+		})
+
+		ldapServer := &multildap.MockMultiLDAP{
+			UserProvider: func(login string) (*models.ExternalUserInfo, ldap.ServerConfig, error) {
+				if login == "broken" {
+					return nil, ldap.ServerConfig{}, multildap.ErrUnreachable
+				}
+
+				return &models.ExternalUserInfo{Login: login}, ldap.ServerConfig{}, nil
+			},
+		}
+
+		progress := [][2]int{}
+		summary, err := SyncAllUsers(configWithOrgs(1), ldapServer, func(done, total int, _ *UserResult) {
+			progress = append(progress, [2]int{done, total})
+		}, false)
+
+		require.Nil(t, err)
+		assert.Equal(t, []string{"found"}, upserted)
+		assert.Equal(t, 1, summary.Synced)
+		assert.Equal(t, 1, summary.Failed)
+		require.Len(t, summary.Users, 2)
+		assert.NotNil(t, summary.Users[0].Changes)
+		assert.Equal(t, multildap.ErrUnreachable.Error(), summary.Users[1].Error)
+		assert.Equal(t, []*UserResult{summary.Users[1]}, summary.DeadLetter)
+		assert.Equal(t, [][2]int{{1, 2}, {2, 2}}, progress)
+	})
+}
+
+func TestTallyChanges(t *testing.T) {
+	summary := &Summary{}
+
+	tallyChanges(summary, &Changes{Action: ActionNone})
+	tallyChanges(summary, nil)
+	tallyChanges(summary, &Changes{Action: ActionNone, TeamsAdded: []TeamChange{{OrgId: 1, TeamId: 2}}})
+	tallyChanges(summary, &Changes{Action: ActionEnabled})
+	tallyChanges(summary, &Changes{Action: ActionDisabled, OrgRolesRemoved: []OrgRoleChange{{OrgId: 1}}})
+
+	assert.Equal(t, 2, summary.Updated)
+	assert.Equal(t, 1, summary.Disabled)
+}
+
+func TestSyncAllUsers_Retries(t *testing.T) {
+	retries, backoff := setting.LDAPSyncRetries, setting.LDAPSyncRetryBackoff
+	setting.LDAPSyncRetries, setting.LDAPSyncRetryBackoff = 2, time.Second
+	defer func() {
+		setting.LDAPSyncRetries, setting.LDAPSyncRetryBackoff = retries, backoff
+		sleep = time.Sleep
+	}()
+
+	// the users fail as many times as their count of failures, a negative count always fails
+	setup := func(t *testing.T, failures map[string]int) (*multildap.MockMultiLDAP, *[]time.Duration) {
+		bus.ClearBusHandlers()
+
+		mockExistingOrgs(1)
+		mockLDAPUsers(t, []*models.UserSearchHitDTO{{Id: 1, Login: "flaky"}})
+
+		bus.AddHandler("test", func(cmd *models.UpsertUserCommand) error {
+			return nil
+		})
+
+		waits := []time.Duration{}
+		sleep = func(d time.Duration) {
+			waits = append(waits, d)
+		}
+
+		ldapServer := &multildap.MockMultiLDAP{
+			UserProvider: func(login string) (*models.ExternalUserInfo, ldap.ServerConfig, error) {
+				if failures[login] != 0 {
+					failures[login]--
+					return nil, ldap.ServerConfig{}, multildap.ErrUnreachable
+				}
+
+				return &models.ExternalUserInfo{Login: login}, ldap.ServerConfig{}, nil
+			},
+		}
+
+		return ldapServer, &waits
+	}
+
+	t.Run("retries a user failing twice", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+
+		ldapServer, waits := setup(t, map[string]int{"flaky": 2})
+
+		summary, err := SyncAllUsers(configWithOrgs(1), ldapServer, nil, false)
+
+		require.Nil(t, err)
+		assert.Equal(t, 1, summary.Synced)
+		assert.Equal(t, 0, summary.Failed)
+		assert.Equal(t, 3, ldapServer.UserCalledTimes)
+		assert.Equal(t, 3, summary.Users[0].Attempts)
+		assert.Empty(t, summary.Users[0].Error)
+		assert.Empty(t, summary.DeadLetter)
+		assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, *waits)
+	})
+
+	t.Run("lists a user always failing in the dead letter", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+
+		ldapServer, waits := setup(t, map[string]int{"flaky": -1})
+
+		summary, err := SyncAllUsers(configWithOrgs(1), ldapServer, nil, false)
+
+		require.Nil(t, err)
+		assert.Equal(t, 0, summary.Synced)
+		assert.Equal(t, 1, summary.Failed)
+		assert.Equal(t, 3, ldapServer.UserCalledTimes)
+		require.Len(t, summary.DeadLetter, 1)
+		assert.Equal(t, "flaky", summary.DeadLetter[0].Login)
+		assert.Equal(t, 3, summary.DeadLetter[0].Attempts)
+		assert.Equal(t, multildap.ErrUnreachable.Error(), summary.DeadLetter[0].Error)
+		assert.Len(t, *waits, 2)
+	})
+
+	t.Run("doesn't retry the other failures", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+
+		ldapServer, waits := setup(t, map[string]int{})
+		bus.AddHandler("test", func(cmd *models.UpsertUserCommand) error {
+			return errors.New("database is locked")
+		})
+
+		summary, err := SyncAllUsers(configWithOrgs(1), ldapServer, nil, false)
+
+		require.Nil(t, err)
+		assert.Equal(t, 1, summary.Failed)
+		assert.Equal(t, 1, ldapServer.UserCalledTimes)
+		require.Len(t, summary.DeadLetter, 1)
+		assert.Equal(t, 1, summary.DeadLetter[0].Attempts)
+		assert.Empty(t, *waits)
+	})
+}
+
+func TestSyncAllUsers_Unchanged(t *testing.T) {
+	defer func() { lastSeen = newSeenUsers() }()
+
+	updatedAt := time.Date(2019, 10, 15, 12, 0, 0, 0, time.UTC)
+
+	// the users are looked up with the roles and updated at time of the directory
+	setup := func(t *testing.T, directory map[string]*models.ExternalUserInfo) (*multildap.MockMultiLDAP, *[]string) {
+		bus.ClearBusHandlers()
+		lastSeen = newSeenUsers()
+
+		mockExistingOrgs(1)
+		mockLDAPUsers(t, []*models.UserSearchHitDTO{{Id: 1, Login: "jdoe"}, {Id: 2, Login: "asmith"}})
+
+		upserted := []string{}
+		bus.AddHandler("test", func(cmd *models.UpsertUserCommand) error {
+			upserted = append(upserted, cmd.ExternalUser.Login)
+			return nil
+		})
+
+		ldapServer := &multildap.MockMultiLDAP{
+			UserProvider: func(login string) (*models.ExternalUserInfo, ldap.ServerConfig, error) {
+				user := *directory[login]
+				return &user, ldap.ServerConfig{}, nil
+			},
+		}
+
+		return ldapServer, &upserted
+	}
+
+	newDirectory := func() map[string]*models.ExternalUserInfo {
+		return map[string]*models.ExternalUserInfo{
+			"jdoe":   {Login: "jdoe", OrgRoles: map[int64]models.RoleType{1: models.ROLE_EDITOR}, UpdatedAt: updatedAt},
+			"asmith": {Login: "asmith", OrgRoles: map[int64]models.RoleType{1: models.ROLE_VIEWER}, UpdatedAt: updatedAt},
+		}
+	}
+
+	t.Run("skips the users unchanged since the last sync", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+
+		ldapServer, upserted := setup(t, newDirectory())
+
+		_, err := SyncAllUsers(configWithOrgs(1), ldapServer, nil, false)
+		require.Nil(t, err)
+		assert.Equal(t, []string{"jdoe", "asmith"}, *upserted)
+
+		summary, err := SyncAllUsers(configWithOrgs(1), ldapServer, nil, false)
+		require.Nil(t, err)
+
+		assert.Equal(t, []string{"jdoe", "asmith"}, *upserted)
+		assert.Equal(t, 0, summary.Synced)
+		assert.Equal(t, 2, summary.Skipped)
+		assert.True(t, summary.Users[0].Skipped)
+		assert.Equal(t, SkipReasonUnchanged, summary.Users[0].SkipReason)
+		assert.Nil(t, summary.Users[0].Changes)
+	})
+
+	t.Run("upserts the users updated or with changed attributes", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+
+		directory := newDirectory()
+		ldapServer, upserted := setup(t, directory)
+
+		_, err := SyncAllUsers(configWithOrgs(1), ldapServer, nil, false)
+		require.Nil(t, err)
+
+		directory["jdoe"].UpdatedAt = updatedAt.Add(time.Hour)
+		directory["asmith"].OrgRoles = map[int64]models.RoleType{1: models.ROLE_ADMIN}
+
+		summary, err := SyncAllUsers(configWithOrgs(1), ldapServer, nil, false)
+		require.Nil(t, err)
+
+		assert.Equal(t, []string{"jdoe", "asmith", "jdoe", "asmith"}, *upserted)
+		assert.Equal(t, 2, summary.Synced)
+		assert.Equal(t, 0, summary.Skipped)
+		assert.False(t, summary.Users[0].Skipped)
+	})
+
+	t.Run("always upserts the users without updated at time", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+
+		directory := newDirectory()
+		directory["jdoe"].UpdatedAt = time.Time{}
+		ldapServer, upserted := setup(t, directory)
+
+		_, err := SyncAllUsers(configWithOrgs(1), ldapServer, nil, false)
+		require.Nil(t, err)
+
+		summary, err := SyncAllUsers(configWithOrgs(1), ldapServer, nil, false)
+		require.Nil(t, err)
+
+		assert.Equal(t, []string{"jdoe", "asmith", "jdoe"}, *upserted)
+		assert.Equal(t, 1, summary.Synced)
+		assert.Equal(t, 1, summary.Skipped)
+	})
+
+	t.Run("never skips the sync of a single user", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+
+		ldapServer, upserted := setup(t, newDirectory())
+
+		_, err := SyncAllUsers(configWithOrgs(1), ldapServer, nil, false)
+		require.Nil(t, err)
+
+		changes, err := SyncUser(ldapServer, &models.User{Id: 1, Login: "jdoe"})
+		require.Nil(t, err)
+
+		assert.NotNil(t, changes)
+		assert.Equal(t, []string{"jdoe", "asmith", "jdoe"}, *upserted)
+	})
+}
+
+func TestSyncAllUsers_Concurrency(t *testing.T) {
+	concurrency := setting.LDAPSyncConcurrency
+	defer func() { setting.LDAPSyncConcurrency = concurrency }()
+	setting.LDAPSyncConcurrency = 3
+
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	hits := []*models.UserSearchHitDTO{}
+	logins := []string{}
+	for id := int64(1); id <= 12; id++ {
+		login := fmt.Sprintf("user%d", id)
+		hits = append(hits, &models.UserSearchHitDTO{Id: id, Login: login})
+		logins = append(logins, login)
+	}
+
+	mockExistingOrgs(1)
+	mockLDAPUsers(t, hits)
+
+	bus.AddHandler("test", func(cmd *models.UpsertUserCommand) error {
+		return nil
+	})
+
+	var inFlight, maxInFlight int32
+	ldapServer := &multildap.MockMultiLDAP{
+		UserProvider: func(login string) (*models.ExternalUserInfo, ldap.ServerConfig, error) {
+			current := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+
+			for {
+				max := atomic.LoadInt32(&maxInFlight)
+				if current <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, current) {
+					break
+				}
+			}
+
+			time.Sleep(10 * time.Millisecond)
+
+			return &models.ExternalUserInfo{Login: login}, ldap.ServerConfig{}, nil
+		},
+	}
+
+	progress := []int{}
+	summary, err := SyncAllUsers(configWithOrgs(1), ldapServer, func(done, total int, _ *UserResult) {
+		assert.Equal(t, 12, total)
+		progress = append(progress, done)
+	}, false)
+	require.Nil(t, err)
+
+	assert.True(t, atomic.LoadInt32(&maxInFlight) <= 3, "no more than sync_concurrency users are synced at once")
+	assert.True(t, atomic.LoadInt32(&maxInFlight) > 1, "the users are synced concurrently")
+
+	assert.Equal(t, 12, summary.Synced)
+
+	synced := []string{}
+	for _, result := range summary.Users {
+		synced = append(synced, result.Login)
+	}
+	assert.Equal(t, logins, synced)
+
+	assert.Equal(t, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}, progress)
+}
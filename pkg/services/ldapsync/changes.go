@@ -0,0 +1,218 @@
+package ldapsync
+
+import (
+	"sort"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+const (
+	// ActionNone is reported when the sync didn't enable nor disable the user
+	ActionNone = "none"
+
+	// ActionEnabled is reported when the sync enabled a disabled user
+	ActionEnabled = "enabled"
+
+	// ActionDisabled is reported when the sync disabled the user
+	ActionDisabled = "disabled"
+
+	// ActionCreated is reported when the sync created the Grafana user of a LDAP user, see SyncNewUser
+	ActionCreated = "created"
+)
+
+// OrgRoleChange is a change of the user role in an organization
+type OrgRoleChange struct {
+	OrgId        int64           `json:"orgId"`
+	Role         models.RoleType `json:"role,omitempty"`
+	PreviousRole models.RoleType `json:"previousRole,omitempty"`
+
+	// Downgrade flags a role lower than the previous one, for the admins to review
+	Downgrade bool `json:"downgrade,omitempty"`
+}
+
+// TeamChange is a change of the user membership of a team
+type TeamChange struct {
+	OrgId  int64 `json:"orgId"`
+	TeamId int64 `json:"teamId"`
+}
+
+// Changes lists the changes actually applied to the user by the sync
+type Changes struct {
+	OrgRolesAdded   []OrgRoleChange `json:"orgRolesAdded"`
+	OrgRolesChanged []OrgRoleChange `json:"orgRolesChanged"`
+	OrgRolesRemoved []OrgRoleChange `json:"orgRolesRemoved"`
+	TeamsAdded      []TeamChange    `json:"teamsAdded"`
+	TeamsRemoved    []TeamChange    `json:"teamsRemoved"`
+	Action          string          `json:"action"`
+
+	// BlockedDowngrades lists the downgrades which weren't applied, see setting.LDAPBlockRoleDowngrades
+	BlockedDowngrades []OrgRoleChange `json:"blockedDowngrades"`
+}
+
+// changed checks if the sync changed anything of the user
+func (changes *Changes) changed() bool {
+	return changes.Action == ActionEnabled ||
+		len(changes.OrgRolesAdded) > 0 ||
+		len(changes.OrgRolesChanged) > 0 ||
+		len(changes.OrgRolesRemoved) > 0 ||
+		len(changes.TeamsAdded) > 0 ||
+		len(changes.TeamsRemoved) > 0
+}
+
+// userState is the state of the Grafana user the sync is able to change
+type userState struct {
+	isDisabled bool
+	orgRoles   map[int64]models.RoleType
+	teams      map[TeamChange]bool
+}
+
+// getUserState fetches the current state of the user from the database
+func getUserState(userId int64) (*userState, error) {
+	userQuery := &models.GetUserByIdQuery{Id: userId}
+	if err := bus.Dispatch(userQuery); err != nil {
+		return nil, err
+	}
+
+	orgsQuery := &models.GetUserOrgListQuery{UserId: userId}
+	if err := bus.Dispatch(orgsQuery); err != nil {
+		return nil, err
+	}
+
+	teamsQuery := &models.GetTeamMembersQuery{UserId: userId}
+	if err := bus.Dispatch(teamsQuery); err != nil {
+		return nil, err
+	}
+
+	state := &userState{
+		isDisabled: userQuery.Result.IsDisabled,
+		orgRoles:   map[int64]models.RoleType{},
+		teams:      map[TeamChange]bool{},
+	}
+
+	for _, org := range orgsQuery.Result {
+		state.orgRoles[org.OrgId] = org.Role
+	}
+
+	for _, member := range teamsQuery.Result {
+		state.teams[TeamChange{OrgId: member.OrgId, TeamId: member.TeamId}] = true
+	}
+
+	return state, nil
+}
+
+// diffUserState computes the changes between the states of the user before and after the sync
+func diffUserState(before, after *userState) *Changes {
+	changes := &Changes{
+		OrgRolesAdded:   []OrgRoleChange{},
+		OrgRolesChanged: []OrgRoleChange{},
+		OrgRolesRemoved: []OrgRoleChange{},
+		TeamsAdded:      []TeamChange{},
+		TeamsRemoved:    []TeamChange{},
+		Action:          ActionNone,
+
+		BlockedDowngrades: []OrgRoleChange{},
+	}
+
+	for orgId, role := range after.orgRoles {
+		previous, ok := before.orgRoles[orgId]
+		if !ok {
+			changes.OrgRolesAdded = append(changes.OrgRolesAdded, OrgRoleChange{OrgId: orgId, Role: role})
+		} else if previous != role {
+			changes.OrgRolesChanged = append(changes.OrgRolesChanged, OrgRoleChange{
+				OrgId:        orgId,
+				Role:         role,
+				PreviousRole: previous,
+				Downgrade:    isDowngrade(previous, role),
+			})
+		}
+	}
+
+	for orgId, previous := range before.orgRoles {
+		if _, ok := after.orgRoles[orgId]; !ok {
+			changes.OrgRolesRemoved = append(changes.OrgRolesRemoved, OrgRoleChange{OrgId: orgId, PreviousRole: previous})
+		}
+	}
+
+	for team := range after.teams {
+		if !before.teams[team] {
+			changes.TeamsAdded = append(changes.TeamsAdded, team)
+		}
+	}
+
+	for team := range before.teams {
+		if !after.teams[team] {
+			changes.TeamsRemoved = append(changes.TeamsRemoved, team)
+		}
+	}
+
+	switch {
+	case before.isDisabled && !after.isDisabled:
+		changes.Action = ActionEnabled
+	case !before.isDisabled && after.isDisabled:
+		changes.Action = ActionDisabled
+	}
+
+	sortOrgRoleChanges(changes.OrgRolesAdded)
+	sortOrgRoleChanges(changes.OrgRolesChanged)
+	sortOrgRoleChanges(changes.OrgRolesRemoved)
+	sortTeamChanges(changes.TeamsAdded)
+	sortTeamChanges(changes.TeamsRemoved)
+
+	return changes
+}
+
+// isDowngrade checks if the role is lower than the previous one
+func isDowngrade(previous, role models.RoleType) bool {
+	return previous != role && previous.Includes(role)
+}
+
+// blockRoleDowngrades keeps the current role of the user in the orgs where LDAP would downgrade it.
+// It returns a copy of the LDAP user with the kept roles and the downgrades it blocked.
+func blockRoleDowngrades(extUser *models.ExternalUserInfo, before *userState) (*models.ExternalUserInfo, []OrgRoleChange) {
+	blocked := []OrgRoleChange{}
+
+	kept := *extUser
+	kept.OrgRoles = map[int64]models.RoleType{}
+
+	for orgId, role := range extUser.OrgRoles {
+		previous, ok := before.orgRoles[orgId]
+		if ok && isDowngrade(previous, role) {
+			kept.OrgRoles[orgId] = previous
+			blocked = append(blocked, OrgRoleChange{OrgId: orgId, Role: role, PreviousRole: previous, Downgrade: true})
+			continue
+		}
+
+		kept.OrgRoles[orgId] = role
+	}
+
+	// the roles downgraded by the stale_org_roles policy are kept too
+	if stale := extUser.StaleOrgRole; stale != nil && *stale != "" {
+		for orgId, previous := range before.orgRoles {
+			if _, ok := extUser.OrgRoles[orgId]; !ok && isDowngrade(previous, *stale) {
+				kept.OrgRoles[orgId] = previous
+				blocked = append(blocked, OrgRoleChange{OrgId: orgId, Role: *stale, PreviousRole: previous, Downgrade: true})
+			}
+		}
+	}
+
+	sortOrgRoleChanges(blocked)
+
+	return &kept, blocked
+}
+
+func sortOrgRoleChanges(changes []OrgRoleChange) {
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].OrgId < changes[j].OrgId
+	})
+}
+
+func sortTeamChanges(changes []TeamChange) {
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].OrgId != changes[j].OrgId {
+			return changes[i].OrgId < changes[j].OrgId
+		}
+
+		return changes[i].TeamId < changes[j].TeamId
+	})
+}
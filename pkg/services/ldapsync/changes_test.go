@@ -0,0 +1,129 @@
+package ldapsync
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffUserState(t *testing.T) {
+	t.Run("no changes", func(t *testing.T) {
+		state := &userState{
+			orgRoles: map[int64]models.RoleType{1: models.ROLE_VIEWER},
+			teams:    map[TeamChange]bool{{OrgId: 1, TeamId: 1}: true},
+		}
+
+		changes := diffUserState(state, state)
+
+		assert.Empty(t, changes.OrgRolesAdded)
+		assert.Empty(t, changes.OrgRolesChanged)
+		assert.Empty(t, changes.OrgRolesRemoved)
+		assert.Empty(t, changes.TeamsAdded)
+		assert.Empty(t, changes.TeamsRemoved)
+		assert.Equal(t, ActionNone, changes.Action)
+	})
+
+	t.Run("changes are sorted", func(t *testing.T) {
+		before := &userState{
+			orgRoles: map[int64]models.RoleType{},
+			teams:    map[TeamChange]bool{},
+		}
+		after := &userState{
+			orgRoles: map[int64]models.RoleType{3: models.ROLE_VIEWER, 1: models.ROLE_ADMIN},
+			teams:    map[TeamChange]bool{{OrgId: 2, TeamId: 1}: true, {OrgId: 1, TeamId: 5}: true, {OrgId: 1, TeamId: 2}: true},
+		}
+
+		changes := diffUserState(before, after)
+
+		assert.Equal(t, []OrgRoleChange{
+			{OrgId: 1, Role: models.ROLE_ADMIN},
+			{OrgId: 3, Role: models.ROLE_VIEWER},
+		}, changes.OrgRolesAdded)
+		assert.Equal(t, []TeamChange{{OrgId: 1, TeamId: 2}, {OrgId: 1, TeamId: 5}, {OrgId: 2, TeamId: 1}}, changes.TeamsAdded)
+	})
+
+	t.Run("enabled user", func(t *testing.T) {
+		before := &userState{isDisabled: true}
+		after := &userState{isDisabled: false}
+
+		assert.Equal(t, ActionEnabled, diffUserState(before, after).Action)
+	})
+
+	t.Run("disabled user", func(t *testing.T) {
+		before := &userState{isDisabled: false}
+		after := &userState{isDisabled: true}
+
+		assert.Equal(t, ActionDisabled, diffUserState(before, after).Action)
+	})
+
+	t.Run("role changes", func(t *testing.T) {
+		before := &userState{
+			orgRoles: map[int64]models.RoleType{1: models.ROLE_VIEWER, 2: models.ROLE_ADMIN, 3: models.ROLE_EDITOR},
+		}
+		after := &userState{
+			orgRoles: map[int64]models.RoleType{1: models.ROLE_EDITOR, 2: models.ROLE_VIEWER, 3: models.ROLE_EDITOR},
+		}
+
+		changes := diffUserState(before, after)
+
+		assert.Equal(t, []OrgRoleChange{
+			{OrgId: 1, Role: models.ROLE_EDITOR, PreviousRole: models.ROLE_VIEWER},
+			{OrgId: 2, Role: models.ROLE_VIEWER, PreviousRole: models.ROLE_ADMIN, Downgrade: true},
+		}, changes.OrgRolesChanged)
+		assert.Empty(t, changes.BlockedDowngrades)
+	})
+}
+
+func TestBlockRoleDowngrades(t *testing.T) {
+	before := &userState{
+		orgRoles: map[int64]models.RoleType{1: models.ROLE_VIEWER, 2: models.ROLE_ADMIN, 3: models.ROLE_EDITOR},
+	}
+
+	extUser := &models.ExternalUserInfo{
+		Login: "johndoe",
+		OrgRoles: map[int64]models.RoleType{
+			1: models.ROLE_ADMIN,
+			2: models.ROLE_EDITOR,
+			3: models.ROLE_EDITOR,
+			4: models.ROLE_VIEWER,
+		},
+	}
+
+	kept, blocked := blockRoleDowngrades(extUser, before)
+
+	assert.Equal(t, "johndoe", kept.Login)
+	assert.Equal(t, map[int64]models.RoleType{
+		1: models.ROLE_ADMIN,
+		2: models.ROLE_ADMIN,
+		3: models.ROLE_EDITOR,
+		4: models.ROLE_VIEWER,
+	}, kept.OrgRoles)
+	assert.Equal(t, []OrgRoleChange{
+		{OrgId: 2, Role: models.ROLE_EDITOR, PreviousRole: models.ROLE_ADMIN, Downgrade: true},
+	}, blocked)
+
+	// the LDAP user is left untouched
+	assert.Equal(t, models.ROLE_EDITOR, extUser.OrgRoles[2])
+}
+
+func TestBlockRoleDowngrades_StaleOrgRole(t *testing.T) {
+	before := &userState{
+		orgRoles: map[int64]models.RoleType{1: models.ROLE_EDITOR, 2: models.ROLE_ADMIN, 3: models.ROLE_VIEWER},
+	}
+
+	stale := models.ROLE_VIEWER
+	extUser := &models.ExternalUserInfo{
+		Login:        "johndoe",
+		OrgRoles:     map[int64]models.RoleType{1: models.ROLE_EDITOR},
+		StaleOrgRole: &stale,
+	}
+
+	kept, blocked := blockRoleDowngrades(extUser, before)
+
+	// the viewer of the third org isn't downgraded, it's left to the sync
+	assert.Equal(t, map[int64]models.RoleType{1: models.ROLE_EDITOR, 2: models.ROLE_ADMIN}, kept.OrgRoles)
+	assert.Equal(t, []OrgRoleChange{
+		{OrgId: 2, Role: models.ROLE_VIEWER, PreviousRole: models.ROLE_ADMIN, Downgrade: true},
+	}, blocked)
+}
@@ -0,0 +1,80 @@
+package ldapsync
+
+import (
+	"errors"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// SkipReasonPendingDisable is reported while the bulk sync runs for the users missing from LDAP,
+// they are disabled once every other user is synced, see disableMissingUsers
+const SkipReasonPendingDisable = "pending_disable"
+
+// ErrDisableThreshold is returned for the users missing from LDAP when the bulk sync would disable more users
+// than the disable threshold
+var ErrDisableThreshold = errors.New("Refusing to disable the user, the sync would disable more users than the disable threshold")
+
+// DisableThreshold returns how many of the synced users the bulk sync may disable at most, with the sync_max_disabled
+// and sync_max_disabled_percent settings, the lowest of both. It isn't limited when neither is set.
+func DisableThreshold(users int) (int, bool) {
+	max, limited := setting.LDAPSyncMaxDisabled, setting.LDAPSyncMaxDisabled > 0
+
+	if percent := setting.LDAPSyncMaxDisabledPercent; percent > 0 {
+		byPercent := users * percent / 100
+		if !limited || byPercent < max {
+			max, limited = byPercent, true
+		}
+	}
+
+	return max, limited
+}
+
+// disableMissingUsers syncs again the users missing from LDAP to disable them, which the bulk sync deferred until
+// the other users were synced. A misconfigured directory, like a wrong search base, reports every user missing:
+// when more users than the disable threshold are missing, none of them is disabled unless forced, they fail with
+// ErrDisableThreshold instead. It returns false when the threshold refused them.
+func disableMissingUsers(ldapServer multildap.IMultiLDAP, users []*models.User, results []*UserResult, force bool) bool {
+	missing := []int{}
+	for i, result := range results {
+		if result.SkipReason == SkipReasonPendingDisable {
+			missing = append(missing, i)
+		}
+	}
+
+	if len(missing) == 0 {
+		return true
+	}
+
+	if max, limited := DisableThreshold(len(users)); limited && len(missing) > max {
+		if !force {
+			logger.Error(
+				"Refusing to disable the users missing from LDAP, there are more than the disable threshold",
+				"missing", len(missing),
+				"threshold", max,
+				"users", len(users),
+			)
+
+			for _, i := range missing {
+				user := users[i]
+				SyncHistory().Record(user.Login, user.Id, nil, ErrDisableThreshold)
+
+				results[i] = &UserResult{
+					UserId:   user.Id,
+					Login:    user.Login,
+					Error:    ErrDisableThreshold.Error(),
+					Attempts: results[i].Attempts,
+				}
+			}
+
+			return false
+		}
+
+		logger.Warn("Forced to disable more users missing from LDAP than the disable threshold", "missing", len(missing), "threshold", max)
+	}
+
+	syncEach(ldapServer, users, missing, false, results, nil)
+
+	return true
+}
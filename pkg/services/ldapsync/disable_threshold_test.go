@@ -0,0 +1,138 @@
+package ldapsync
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDisableThreshold(t *testing.T) {
+	maxDisabled, maxPercent := setting.LDAPSyncMaxDisabled, setting.LDAPSyncMaxDisabledPercent
+	defer func() { setting.LDAPSyncMaxDisabled, setting.LDAPSyncMaxDisabledPercent = maxDisabled, maxPercent }()
+
+	for _, tc := range []struct {
+		maxDisabled, maxPercent, users int
+		threshold                      int
+		limited                        bool
+	}{
+		{users: 100},
+		{maxDisabled: 5, users: 100, threshold: 5, limited: true},
+		{maxPercent: 10, users: 100, threshold: 10, limited: true},
+		{maxDisabled: 5, maxPercent: 10, users: 100, threshold: 5, limited: true},
+		{maxDisabled: 50, maxPercent: 10, users: 100, threshold: 10, limited: true},
+		{maxPercent: 10, users: 5, threshold: 0, limited: true},
+	} {
+		t.Run(fmt.Sprintf("%d users, %d percent of %d users", tc.maxDisabled, tc.maxPercent, tc.users), func(t *testing.T) {
+			setting.LDAPSyncMaxDisabled, setting.LDAPSyncMaxDisabledPercent = tc.maxDisabled, tc.maxPercent
+
+			threshold, limited := DisableThreshold(tc.users)
+
+			assert.Equal(t, tc.threshold, threshold)
+			assert.Equal(t, tc.limited, limited)
+		})
+	}
+}
+
+func TestSyncAllUsers_DisableThreshold(t *testing.T) {
+	maxDisabled, maxPercent := setting.LDAPSyncMaxDisabled, setting.LDAPSyncMaxDisabledPercent
+	defer func() { setting.LDAPSyncMaxDisabled, setting.LDAPSyncMaxDisabledPercent = maxDisabled, maxPercent }()
+
+	// setup mocks a directory in which only the "found" user is, and returns the ids of the users disabled by the sync
+	setup := func(t *testing.T) (*multildap.MockMultiLDAP, *[]int64) {
+		bus.ClearBusHandlers()
+
+		mockExistingOrgs(1)
+		mockLDAPUsers(t, []*models.UserSearchHitDTO{
+			{Id: 1, Login: "found"},
+			{Id: 2, Login: "gone"},
+			{Id: 3, Login: "left"},
+		})
+
+		bus.AddHandler("test", func(cmd *models.UpsertUserCommand) error {
+			return nil
+		})
+
+		bus.AddHandler("test", func(query *models.GetExternalUserInfoByLoginQuery) error {
+			ids := map[string]int64{"gone": 2, "left": 3}
+			query.Result = &models.ExternalUserInfo{UserId: ids[query.LoginOrEmail], Login: query.LoginOrEmail}
+			return nil
+		})
+
+		disabled := []int64{}
+		bus.AddHandler("test", func(cmd *models.DisableUserCommand) error {
+			if cmd.IsDisabled {
+				disabled = append(disabled, cmd.UserId)
+			}
+			return nil
+		})
+
+		ldapServer := &multildap.MockMultiLDAP{
+			UserProvider: func(login string) (*models.ExternalUserInfo, ldap.ServerConfig, error) {
+				if login != "found" {
+					return nil, ldap.ServerConfig{}, multildap.ErrDidNotFindUser
+				}
+
+				return &models.ExternalUserInfo{Login: login}, ldap.ServerConfig{}, nil
+			},
+		}
+
+		return ldapServer, &disabled
+	}
+
+	t.Run("disables the missing users within the threshold", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+		setting.LDAPSyncMaxDisabled, setting.LDAPSyncMaxDisabledPercent = 2, 0
+
+		ldapServer, disabled := setup(t)
+
+		summary, err := SyncAllUsers(configWithOrgs(1), ldapServer, nil, false)
+
+		require.Nil(t, err)
+		assert.ElementsMatch(t, []int64{2, 3}, *disabled)
+		assert.False(t, summary.DisableThresholdExceeded)
+		assert.Equal(t, 3, summary.Synced)
+		assert.Equal(t, 0, summary.Failed)
+	})
+
+	t.Run("refuses to disable the missing users beyond the threshold", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+		setting.LDAPSyncMaxDisabled, setting.LDAPSyncMaxDisabledPercent = 0, 50
+
+		ldapServer, disabled := setup(t)
+
+		progress := []string{}
+		summary, err := SyncAllUsers(configWithOrgs(1), ldapServer, func(done, total int, user *UserResult) {
+			progress = append(progress, user.SkipReason)
+		}, false)
+
+		require.Nil(t, err)
+		assert.Empty(t, *disabled)
+		assert.True(t, summary.DisableThresholdExceeded)
+		assert.Equal(t, 1, summary.Synced)
+		assert.Equal(t, 2, summary.Failed)
+		require.Len(t, summary.DeadLetter, 2)
+		assert.Equal(t, ErrDisableThreshold.Error(), summary.DeadLetter[0].Error)
+		assert.ElementsMatch(t, []string{"", SkipReasonPendingDisable, SkipReasonPendingDisable}, progress)
+	})
+
+	t.Run("disables the missing users beyond the threshold when forced", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+		setting.LDAPSyncMaxDisabled, setting.LDAPSyncMaxDisabledPercent = 1, 0
+
+		ldapServer, disabled := setup(t)
+
+		summary, err := SyncAllUsers(configWithOrgs(1), ldapServer, nil, true)
+
+		require.Nil(t, err)
+		assert.ElementsMatch(t, []int64{2, 3}, *disabled)
+		assert.False(t, summary.DisableThresholdExceeded)
+		assert.Equal(t, 0, summary.Failed)
+	})
+}
@@ -0,0 +1,39 @@
+package ldapsync
+
+import (
+	"errors"
+	"path"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// SkipReasonFiltered is reported when the user is excluded from the sync by the sync_allowlist or sync_denylist settings
+const SkipReasonFiltered = "filtered"
+
+// ErrUserFiltered is returned by the sync of a single user excluded by the sync_allowlist or sync_denylist settings
+var ErrUserFiltered = errors.New("User is excluded from the LDAP sync by the sync_allowlist or sync_denylist settings")
+
+// isFiltered checks if the user is excluded from the sync: the denylist matches it, or the allowlist,
+// when there's one, doesn't
+func isFiltered(login string) bool {
+	login = strings.ToLower(login)
+
+	if matchesLogin(setting.LDAPSyncDenylist, login) {
+		return true
+	}
+
+	return len(setting.LDAPSyncAllowlist) > 0 && !matchesLogin(setting.LDAPSyncAllowlist, login)
+}
+
+// matchesLogin checks if one of the logins or glob patterns matches the lowercased login
+func matchesLogin(patterns []string, login string) bool {
+	for _, pattern := range patterns {
+		// the patterns are validated with the settings
+		if matched, _ := path.Match(pattern, login); matched {
+			return true
+		}
+	}
+
+	return false
+}
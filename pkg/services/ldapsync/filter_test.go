@@ -0,0 +1,139 @@
+package ldapsync
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncAllUsers_Filtered(t *testing.T) {
+	allowlist, denylist := setting.LDAPSyncAllowlist, setting.LDAPSyncDenylist
+	defer func() { setting.LDAPSyncAllowlist, setting.LDAPSyncDenylist = allowlist, denylist }()
+
+	// sync runs the sync of all users and returns the upserted logins and the skip reasons by login
+	sync := func(t *testing.T) ([]string, map[string]string) {
+		bus.ClearBusHandlers()
+		defer bus.ClearBusHandlers()
+
+		mockExistingOrgs(1)
+		mockLDAPUsers(t, []*models.UserSearchHitDTO{
+			{Id: 1, Login: "alice"},
+			{Id: 2, Login: "Team-A-Bob"},
+			{Id: 3, Login: "svc-backup"},
+			{Id: 4, Login: "carol"},
+		})
+
+		upserted := []string{}
+		bus.AddHandler("test", func(cmd *models.UpsertUserCommand) error {
+			upserted = append(upserted, cmd.ExternalUser.Login)
+			return nil
+		})
+
+		ldapServer := &multildap.MockMultiLDAP{
+			UserProvider: func(login string) (*models.ExternalUserInfo, ldap.ServerConfig, error) {
+				return &models.ExternalUserInfo{Login: login}, ldap.ServerConfig{}, nil
+			},
+		}
+
+		summary, err := SyncAllUsers(configWithOrgs(1), ldapServer, nil, false)
+		require.Nil(t, err)
+
+		skipped := map[string]string{}
+		for _, result := range summary.Users {
+			if result.Skipped {
+				skipped[result.Login] = result.SkipReason
+			}
+		}
+
+		assert.Equal(t, len(skipped), summary.Skipped)
+
+		return upserted, skipped
+	}
+
+	t.Run("only syncs the users of the allowlist", func(t *testing.T) {
+		setting.LDAPSyncAllowlist = []string{"alice", "team-a-*"}
+		setting.LDAPSyncDenylist = []string{}
+
+		upserted, skipped := sync(t)
+
+		assert.Equal(t, []string{"alice", "Team-A-Bob"}, upserted)
+		assert.Equal(t, map[string]string{"svc-backup": SkipReasonFiltered, "carol": SkipReasonFiltered}, skipped)
+	})
+
+	t.Run("skips the users of the denylist", func(t *testing.T) {
+		setting.LDAPSyncAllowlist = []string{}
+		setting.LDAPSyncDenylist = []string{"svc-*"}
+
+		upserted, skipped := sync(t)
+
+		assert.Equal(t, []string{"alice", "Team-A-Bob", "carol"}, upserted)
+		assert.Equal(t, map[string]string{"svc-backup": SkipReasonFiltered}, skipped)
+	})
+
+	t.Run("applies the denylist over the allowlist", func(t *testing.T) {
+		setting.LDAPSyncAllowlist = []string{"alice", "svc-?ackup", "carol"}
+		setting.LDAPSyncDenylist = []string{"svc-*", "carol"}
+
+		upserted, skipped := sync(t)
+
+		assert.Equal(t, []string{"alice"}, upserted)
+		assert.Equal(t, map[string]string{
+			"Team-A-Bob": SkipReasonFiltered,
+			"svc-backup": SkipReasonFiltered,
+			"carol":      SkipReasonFiltered,
+		}, skipped)
+	})
+}
+
+func TestSyncUser_Filtered(t *testing.T) {
+	allowlist, denylist := setting.LDAPSyncAllowlist, setting.LDAPSyncDenylist
+	defer func() { setting.LDAPSyncAllowlist, setting.LDAPSyncDenylist = allowlist, denylist }()
+
+	adminUser := setting.AdminUser
+	defer func() { setting.AdminUser = adminUser }()
+	setting.AdminUser = "admin"
+
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	mockLDAPUsers(t, nil)
+
+	upserted := false
+	bus.AddHandler("test", func(cmd *models.UpsertUserCommand) error {
+		upserted = true
+		return nil
+	})
+
+	ldapServer := &multildap.MockMultiLDAP{
+		UserProvider: func(login string) (*models.ExternalUserInfo, ldap.ServerConfig, error) {
+			return nil, ldap.ServerConfig{}, multildap.ErrDidNotFindUser
+		},
+	}
+
+	t.Run("refuses to sync a user excluded by the lists", func(t *testing.T) {
+		setting.LDAPSyncAllowlist = []string{}
+		setting.LDAPSyncDenylist = []string{"svc-*"}
+
+		changes, err := SyncUser(ldapServer, &models.User{Id: 3, Login: "svc-backup"})
+
+		assert.Nil(t, changes)
+		assert.Equal(t, ErrUserFiltered, err)
+		assert.False(t, upserted)
+		assert.Equal(t, 0, ldapServer.UserCalledTimes)
+	})
+
+	t.Run("still protects the super admin of the allowlist", func(t *testing.T) {
+		setting.LDAPSyncAllowlist = []string{"admin"}
+		setting.LDAPSyncDenylist = []string{}
+
+		_, err := SyncUser(ldapServer, &models.User{Id: 1, Login: "admin"})
+
+		assert.Equal(t, ErrGrafanaAdmin, err)
+	})
+}
@@ -0,0 +1,109 @@
+package ldapsync
+
+import (
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// HistoryEntry is the summary of a single user sync
+type HistoryEntry struct {
+	UserId   int64     `json:"userId"`
+	Login    string    `json:"login"`
+	SyncedAt time.Time `json:"syncedAt"`
+	Changes  *Changes  `json:"changes,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// History keeps in memory the last syncs, for the postmortems.
+// The oldest entries are evicted beyond the capacity and forgotten after the retention.
+type History struct {
+	capacity  int
+	retention time.Duration
+	now       func() time.Time
+
+	lock    sync.Mutex
+	entries []*HistoryEntry
+	next    int
+}
+
+// NewHistory creates the history of the syncs, a retention of 0 keeps the entries until they're evicted
+func NewHistory(capacity int, retention time.Duration) *History {
+	if capacity < 0 {
+		capacity = 0
+	}
+
+	return &History{
+		capacity:  capacity,
+		retention: retention,
+		now:       time.Now,
+		entries:   make([]*HistoryEntry, 0, capacity),
+	}
+}
+
+// Record adds the sync of the user to the history, evicting the oldest entry when it is full
+func (history *History) Record(user string, userId int64, changes *Changes, err error) {
+	if history.capacity == 0 {
+		return
+	}
+
+	entry := &HistoryEntry{
+		UserId:   userId,
+		Login:    user,
+		SyncedAt: history.now(),
+		Changes:  changes,
+	}
+
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	history.lock.Lock()
+	defer history.lock.Unlock()
+
+	if len(history.entries) < history.capacity {
+		history.entries = append(history.entries, entry)
+		return
+	}
+
+	history.entries[history.next] = entry
+	history.next = (history.next + 1) % history.capacity
+}
+
+// Entries returns the retained entries, the most recent first
+func (history *History) Entries() []*HistoryEntry {
+	history.lock.Lock()
+	defer history.lock.Unlock()
+
+	now := history.now()
+	entries := []*HistoryEntry{}
+
+	for i := 0; i < len(history.entries); i++ {
+		// walk the ring backwards from the most recent entry
+		index := (history.next - 1 - i + 2*len(history.entries)) % len(history.entries)
+		entry := history.entries[index]
+
+		if history.retention > 0 && now.Sub(entry.SyncedAt) > history.retention {
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+var (
+	syncHistory     *History
+	syncHistoryOnce sync.Once
+)
+
+// SyncHistory returns the history of the syncs, sized by the [auth.ldap] settings
+func SyncHistory() *History {
+	syncHistoryOnce.Do(func() {
+		syncHistory = NewHistory(setting.LDAPSyncHistorySize, setting.LDAPSyncHistoryRetention)
+	})
+
+	return syncHistory
+}
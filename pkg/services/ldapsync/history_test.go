@@ -0,0 +1,68 @@
+package ldapsync
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func historyLogins(entries []*HistoryEntry) []string {
+	logins := []string{}
+	for _, entry := range entries {
+		logins = append(logins, entry.Login)
+	}
+
+	return logins
+}
+
+func TestHistory(t *testing.T) {
+	t.Run("records the syncs, the most recent first", func(t *testing.T) {
+		history := NewHistory(3, 0)
+
+		changes := &Changes{Action: ActionDisabled}
+		history.Record("jdoe", 2, changes, nil)
+		history.Record("asmith", 3, nil, errors.New("None of the LDAP servers are reachable"))
+
+		entries := history.Entries()
+
+		assert.Equal(t, []string{"asmith", "jdoe"}, historyLogins(entries))
+		assert.Equal(t, int64(3), entries[0].UserId)
+		assert.Equal(t, "None of the LDAP servers are reachable", entries[0].Error)
+		assert.Nil(t, entries[0].Changes)
+		assert.Equal(t, changes, entries[1].Changes)
+		assert.Empty(t, entries[1].Error)
+	})
+
+	t.Run("evicts the oldest syncs beyond the capacity", func(t *testing.T) {
+		history := NewHistory(3, 0)
+
+		for _, login := range []string{"a", "b", "c", "d", "e"} {
+			history.Record(login, 1, nil, nil)
+		}
+
+		assert.Equal(t, []string{"e", "d", "c"}, historyLogins(history.Entries()))
+	})
+
+	t.Run("forgets the syncs older than the retention", func(t *testing.T) {
+		history := NewHistory(3, time.Hour)
+
+		now := time.Date(2019, 9, 2, 10, 0, 0, 0, time.UTC)
+		history.now = func() time.Time { return now }
+
+		history.Record("old", 1, nil, nil)
+		now = now.Add(2 * time.Hour)
+		history.Record("recent", 2, nil, nil)
+
+		assert.Equal(t, []string{"recent"}, historyLogins(history.Entries()))
+	})
+
+	t.Run("records nothing without capacity", func(t *testing.T) {
+		history := NewHistory(0, 0)
+
+		history.Record("jdoe", 2, nil, nil)
+
+		assert.Empty(t, history.Entries())
+	})
+}
@@ -0,0 +1,61 @@
+package ldapsync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os/exec"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// HookPayload is the JSON passed on stdin to the post_sync_hook after each successful sync of a user
+type HookPayload struct {
+	UserId  int64    `json:"userId"`
+	Login   string   `json:"login"`
+	Email   string   `json:"email"`
+	Name    string   `json:"name"`
+	Changes *Changes `json:"changes"`
+}
+
+// runPostSyncHook runs the post_sync_hook of the [auth.ldap] section, if any, with the synced user and its changes.
+// The hook is killed after post_sync_hook_timeout. Its failure is only logged, the sync is already done.
+func runPostSyncHook(user *models.User, changes *Changes) {
+	if setting.LDAPPostSyncHook == "" {
+		return
+	}
+
+	payload, err := json.Marshal(&HookPayload{
+		UserId:  user.Id,
+		Login:   user.Login,
+		Email:   user.Email,
+		Name:    user.Name,
+		Changes: changes,
+	})
+	if err != nil {
+		logger.Error("Failed to serialize the LDAP post sync hook payload", "user", user.Login, "error", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), setting.LDAPPostSyncHookTimeout)
+	defer cancel()
+
+	var output bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, setting.LDAPPostSyncHook)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = ctx.Err()
+		}
+
+		logger.Warn(
+			"LDAP post sync hook failed",
+			"hook", setting.LDAPPostSyncHook, "user", user.Login, "error", err, "output", output.String(),
+		)
+	}
+}
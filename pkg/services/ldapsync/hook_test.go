@@ -0,0 +1,132 @@
+package ldapsync
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncUser_PostSyncHook(t *testing.T) {
+	hook, timeout := setting.LDAPPostSyncHook, setting.LDAPPostSyncHookTimeout
+	defer func() { setting.LDAPPostSyncHook, setting.LDAPPostSyncHookTimeout = hook, timeout }()
+	setting.LDAPPostSyncHookTimeout = 5 * time.Second
+
+	dir, err := ioutil.TempDir("", "ldap-hook")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// writeHook writes an executable shell script to the temporary directory
+	writeHook := func(t *testing.T, name string, script string) string {
+		path := filepath.Join(dir, name)
+		require.Nil(t, ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0700))
+		return path
+	}
+
+	setup := func(t *testing.T) (*multildap.MockMultiLDAP, *bool) {
+		bus.ClearBusHandlers()
+
+		mockLDAPUsers(t, nil)
+
+		upserted := false
+		bus.AddHandler("test", func(cmd *models.UpsertUserCommand) error {
+			upserted = true
+			return nil
+		})
+
+		ldapServer := &multildap.MockMultiLDAP{
+			UserProvider: func(login string) (*models.ExternalUserInfo, ldap.ServerConfig, error) {
+				return &models.ExternalUserInfo{Login: login, OrgRoles: map[int64]models.RoleType{}}, ldap.ServerConfig{}, nil
+			},
+		}
+
+		return ldapServer, &upserted
+	}
+
+	user := &models.User{Id: 1, Login: "jdoe", Email: "jdoe@example.org", Name: "John Doe"}
+
+	t.Run("passes the user and its changes to the hook", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+
+		payloadPath := filepath.Join(dir, "payload.json")
+		setting.LDAPPostSyncHook = writeHook(t, "hook.sh", "cat > "+payloadPath)
+
+		ldapServer, upserted := setup(t)
+
+		changes, err := SyncUser(ldapServer, user)
+
+		require.Nil(t, err)
+		assert.True(t, *upserted)
+
+		content, err := ioutil.ReadFile(payloadPath)
+		require.Nil(t, err)
+
+		var payload HookPayload
+		require.Nil(t, json.Unmarshal(content, &payload))
+
+		assert.Equal(t, int64(1), payload.UserId)
+		assert.Equal(t, "jdoe", payload.Login)
+		assert.Equal(t, "jdoe@example.org", payload.Email)
+		assert.Equal(t, "John Doe", payload.Name)
+		require.NotNil(t, payload.Changes)
+		assert.Equal(t, changes.Action, payload.Changes.Action)
+	})
+
+	t.Run("doesn't fail the sync when the hook fails", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+
+		setting.LDAPPostSyncHook = writeHook(t, "failing.sh", "echo failed >&2; exit 1")
+
+		ldapServer, upserted := setup(t)
+
+		changes, err := SyncUser(ldapServer, user)
+
+		assert.Nil(t, err)
+		assert.NotNil(t, changes)
+		assert.True(t, *upserted)
+	})
+
+	t.Run("kills the hook after the timeout", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+
+		setting.LDAPPostSyncHook = writeHook(t, "slow.sh", "exec sleep 10")
+		setting.LDAPPostSyncHookTimeout = 100 * time.Millisecond
+		defer func() { setting.LDAPPostSyncHookTimeout = 5 * time.Second }()
+
+		ldapServer, _ := setup(t)
+
+		start := time.Now()
+		_, err := SyncUser(ldapServer, user)
+
+		assert.Nil(t, err)
+		assert.True(t, time.Since(start) < 5*time.Second)
+	})
+
+	t.Run("doesn't run the hook when the sync fails", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+
+		payloadPath := filepath.Join(dir, "failed-sync.json")
+		setting.LDAPPostSyncHook = writeHook(t, "unexpected.sh", "cat > "+payloadPath)
+
+		ldapServer, _ := setup(t)
+		ldapServer.UserProvider = func(login string) (*models.ExternalUserInfo, ldap.ServerConfig, error) {
+			return nil, ldap.ServerConfig{}, multildap.ErrUnreachable
+		}
+
+		_, err := SyncUser(ldapServer, user)
+
+		assert.Equal(t, multildap.ErrUnreachable, err)
+		_, err = os.Stat(payloadPath)
+		assert.True(t, os.IsNotExist(err))
+	})
+}
@@ -0,0 +1,147 @@
+package ldapsync
+
+import (
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/multildap"
+)
+
+// ImpactReport is the impact of a config change on the existing LDAP users, counted by kind of change.
+// Only the affected users and the ones which couldn't be evaluated are listed.
+type ImpactReport struct {
+	Evaluated        int           `json:"evaluated"`
+	Affected         int           `json:"affected"`
+	GainingOrgs      int           `json:"gainingOrgs"`
+	LosingOrgs       int           `json:"losingOrgs"`
+	ChangingRoles    int           `json:"changingRoles"`
+	BecomingDisabled int           `json:"becomingDisabled"`
+	BecomingEnabled  int           `json:"becomingEnabled"`
+	Failed           int           `json:"failed"`
+	Users            []*UserResult `json:"users"`
+}
+
+// ConfigImpact maps every Grafana user authenticated with LDAP with both the current and the proposed configs,
+// and reports the changes the proposed config would make. Nothing is changed, neither in Grafana nor in LDAP.
+func ConfigImpact(current, proposed multildap.IMultiLDAP) (*ImpactReport, error) {
+	users, err := getLDAPUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ImpactReport{
+		Users: []*UserResult{},
+	}
+
+	for _, user := range users {
+		result := &UserResult{
+			UserId: user.Id,
+			Login:  user.Login,
+		}
+
+		changes, err := userImpact(current, proposed, user.Login)
+		if err != nil {
+			logger.Error("Failed to evaluate the impact of the LDAP config on the user", "user", user.Login, "error", err)
+
+			result.Error = err.Error()
+			report.Failed++
+			report.Users = append(report.Users, result)
+			continue
+		}
+
+		report.Evaluated++
+
+		if !report.count(changes) {
+			continue
+		}
+
+		result.Changes = changes
+		report.Users = append(report.Users, result)
+	}
+
+	return report, nil
+}
+
+// count adds the changes of a user to the totals, it returns false if the user isn't affected
+func (report *ImpactReport) count(changes *Changes) bool {
+	affected := false
+
+	if len(changes.OrgRolesAdded) > 0 {
+		report.GainingOrgs++
+		affected = true
+	}
+
+	if len(changes.OrgRolesRemoved) > 0 {
+		report.LosingOrgs++
+		affected = true
+	}
+
+	if len(changes.OrgRolesChanged) > 0 {
+		report.ChangingRoles++
+		affected = true
+	}
+
+	switch changes.Action {
+	case ActionDisabled:
+		report.BecomingDisabled++
+		affected = true
+	case ActionEnabled:
+		report.BecomingEnabled++
+		affected = true
+	}
+
+	if len(changes.TeamsAdded) > 0 || len(changes.TeamsRemoved) > 0 {
+		affected = true
+	}
+
+	if affected {
+		report.Affected++
+	}
+
+	return affected
+}
+
+// userImpact computes the changes between the mappings of the user with the current and the proposed configs
+func userImpact(current, proposed multildap.IMultiLDAP, login string) (*Changes, error) {
+	before, err := mappedUserState(current, login)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := mappedUserState(proposed, login)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffUserState(before, after), nil
+}
+
+// mappedUserState is the state the sync would give to the user, a user missing from LDAP is disabled, see isMissing
+func mappedUserState(ldapServer multildap.IMultiLDAP, login string) (*userState, error) {
+	state := &userState{
+		orgRoles: map[int64]models.RoleType{},
+		teams:    map[TeamChange]bool{},
+	}
+
+	extUser, _, attempts, err := ldapServer.UserWithAttempts(login)
+	if err == multildap.ErrDidNotFindUser {
+		if !isMissing(attempts) {
+			return nil, ErrPartialOutage
+		}
+
+		state.isDisabled = true
+		return state, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for orgId, role := range extUser.OrgRoles {
+		state.orgRoles[orgId] = role
+	}
+
+	for _, team := range extUser.Teams {
+		state.teams[TeamChange{OrgId: team.OrgId, TeamId: team.TeamId}] = true
+	}
+
+	return state, nil
+}
@@ -0,0 +1,134 @@
+package ldapsync
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// directoryLDAP maps the groups of the users of the directory with the group mappings,
+// the users missing from the directory aren't found and the unreachable ones fail
+func directoryLDAP(directory map[string][]string, unreachable []string, groups []*ldap.GroupToOrgRole) *multildap.MockMultiLDAP {
+	return &multildap.MockMultiLDAP{
+		UserProvider: func(login string) (*models.ExternalUserInfo, ldap.ServerConfig, error) {
+			for _, u := range unreachable {
+				if u == login {
+					return nil, ldap.ServerConfig{}, multildap.ErrUnreachable
+				}
+			}
+
+			memberOf, ok := directory[login]
+			if !ok {
+				return nil, ldap.ServerConfig{}, multildap.ErrDidNotFindUser
+			}
+
+			user := &models.ExternalUserInfo{
+				Login:    login,
+				Groups:   memberOf,
+				OrgRoles: map[int64]models.RoleType{},
+			}
+
+			for _, group := range groups {
+				if user.OrgRoles[group.OrgID] != "" {
+					continue
+				}
+
+				for _, dn := range memberOf {
+					if dn == group.GroupDN {
+						user.OrgRoles[group.OrgID] = group.OrgRole
+					}
+				}
+			}
+
+			return user, ldap.ServerConfig{Groups: groups}, nil
+		},
+	}
+}
+
+func TestConfigImpact(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	mockLDAPUsers(t, []*models.UserSearchHitDTO{
+		{Id: 1, Login: "alice"},
+		{Id: 2, Login: "bob"},
+		{Id: 3, Login: "carol"},
+		{Id: 4, Login: "dave"},
+		{Id: 5, Login: "erin"},
+		{Id: 6, Login: "frank"},
+	})
+
+	upserted := false
+	bus.AddHandler("test", func(cmd *models.UpsertUserCommand) error {
+		upserted = true
+		return nil
+	})
+
+	directory := map[string][]string{
+		"alice": {"cn=admins"},
+		"bob":   {"cn=editors"},
+		"carol": {"cn=contractors"},
+		"erin":  {"cn=editors", "cn=ops"},
+		"frank": {"cn=admins"},
+	}
+
+	current := directoryLDAP(directory, nil, []*ldap.GroupToOrgRole{
+		{GroupDN: "cn=admins", OrgID: 1, OrgRole: models.ROLE_ADMIN},
+		{GroupDN: "cn=editors", OrgID: 1, OrgRole: models.ROLE_EDITOR},
+		{GroupDN: "cn=contractors", OrgID: 1, OrgRole: models.ROLE_VIEWER},
+	})
+
+	// the proposed config no longer finds the contractors, and its server isn't reachable by frank's lookup
+	proposedDirectory := map[string][]string{}
+	for login, memberOf := range directory {
+		if login != "carol" {
+			proposedDirectory[login] = memberOf
+		}
+	}
+
+	proposed := directoryLDAP(proposedDirectory, []string{"frank"}, []*ldap.GroupToOrgRole{
+		{GroupDN: "cn=admins", OrgID: 1, OrgRole: models.ROLE_ADMIN},
+		{GroupDN: "cn=editors", OrgID: 1, OrgRole: models.ROLE_VIEWER},
+		{GroupDN: "cn=ops", OrgID: 2, OrgRole: models.ROLE_EDITOR},
+	})
+
+	report, err := ConfigImpact(current, proposed)
+	require.Nil(t, err)
+
+	assert.False(t, upserted)
+	assert.Equal(t, 5, report.Evaluated)
+	assert.Equal(t, 3, report.Affected)
+	assert.Equal(t, 1, report.GainingOrgs)
+	assert.Equal(t, 1, report.LosingOrgs)
+	assert.Equal(t, 2, report.ChangingRoles)
+	assert.Equal(t, 1, report.BecomingDisabled)
+	assert.Equal(t, 0, report.BecomingEnabled)
+	assert.Equal(t, 1, report.Failed)
+
+	logins := []string{}
+	for _, user := range report.Users {
+		logins = append(logins, user.Login)
+	}
+	require.Equal(t, []string{"bob", "carol", "erin", "frank"}, logins)
+
+	bob := report.Users[0].Changes
+	assert.Equal(t, []OrgRoleChange{
+		{OrgId: 1, Role: models.ROLE_VIEWER, PreviousRole: models.ROLE_EDITOR, Downgrade: true},
+	}, bob.OrgRolesChanged)
+
+	carol := report.Users[1].Changes
+	assert.Equal(t, ActionDisabled, carol.Action)
+	assert.Equal(t, []OrgRoleChange{{OrgId: 1, PreviousRole: models.ROLE_VIEWER}}, carol.OrgRolesRemoved)
+
+	erin := report.Users[2].Changes
+	assert.Equal(t, []OrgRoleChange{{OrgId: 2, Role: models.ROLE_EDITOR}}, erin.OrgRolesAdded)
+	assert.Len(t, erin.OrgRolesChanged, 1)
+
+	assert.Nil(t, report.Users[3].Changes)
+	assert.Equal(t, multildap.ErrUnreachable.Error(), report.Users[3].Error)
+}
@@ -0,0 +1,218 @@
+package ldapsync
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+)
+
+// now is the clock of the bulk syncs, replaced in the tests
+var now = time.Now
+
+// watermark is the start time of the last bulk sync which synced its users without failure
+var watermark = &syncWatermark{}
+
+type syncWatermark struct {
+	sync.Mutex
+	at time.Time
+}
+
+// changeMarkers are the highest change markers of the servers synced by the incremental syncs without failure
+var changeMarkers = &syncChangeMarkers{markers: map[string]string{}}
+
+type syncChangeMarkers struct {
+	sync.Mutex
+	markers map[string]string
+}
+
+// LastSyncWatermark returns the start time of the last bulk sync without failure, the zero time before the first one.
+// An incremental sync since then catches up with every change made in LDAP meanwhile.
+func LastSyncWatermark() time.Time {
+	watermark.Lock()
+	defer watermark.Unlock()
+
+	return watermark.at
+}
+
+// advanceWatermark moves the watermark to the start of the bulk sync, unless a user failed to sync
+// and its changes would be missed by the next incremental sync
+func advanceWatermark(start time.Time, summary *Summary) {
+	if summary.Failed > 0 {
+		return
+	}
+
+	watermark.Lock()
+	defer watermark.Unlock()
+
+	if start.After(watermark.at) {
+		watermark.at = start
+	}
+}
+
+// LastChangeMarkers returns the highest change markers of the servers synced by the incremental syncs without failure,
+// by the "host:port" of their server, see multildap.ChangeMarkerKey. It's empty before the first one.
+func LastChangeMarkers() map[string]string {
+	changeMarkers.Lock()
+	defer changeMarkers.Unlock()
+
+	markers := map[string]string{}
+	for key, marker := range changeMarkers.markers {
+		markers[key] = marker
+	}
+
+	return markers
+}
+
+// advanceChangeMarkers records the highest change markers of the servers synced by the incremental sync,
+// unless a user failed to sync and its changes would be missed by the next one
+func advanceChangeMarkers(highest map[string]string, summary *Summary) {
+	if summary.Failed > 0 {
+		return
+	}
+
+	changeMarkers.Lock()
+	defer changeMarkers.Unlock()
+
+	for key, marker := range highest {
+		changeMarkers.markers[key] = marker
+	}
+}
+
+// hasChangeMarkers checks that every server of the config has a "change_marker" attribute
+func hasChangeMarkers(config *ldap.Config) bool {
+	for _, server := range config.Servers {
+		if server.Attr.ChangeMarker == "" {
+			return false
+		}
+	}
+
+	return len(config.Servers) > 0
+}
+
+// SyncUsersIncrementally synchronizes the Grafana users authenticated with LDAP whose entry changed since the last
+// incremental sync without failure. The changes are tracked with the change markers of the servers when every server
+// has a "change_marker" attribute, see SyncUsersChangedSince, or else with the start time of the last sync without
+// failure, see SyncUsersModifiedSince. Every user is synced before the first sync without failure.
+func SyncUsersIncrementally(config *ldap.Config, ldapServer multildap.IMultiLDAP, progress ProgressFunc, force bool) (*Summary, error) {
+	if hasChangeMarkers(config) {
+		return SyncUsersChangedSince(config, ldapServer, LastChangeMarkers(), progress, force)
+	}
+
+	since := LastSyncWatermark()
+	if since.IsZero() {
+		return SyncAllUsers(config, ldapServer, progress, force)
+	}
+
+	return SyncUsersModifiedSince(config, ldapServer, since, progress, force)
+}
+
+// SyncUsersChangedSince synchronizes the Grafana users authenticated with LDAP whose entry changed since the given change
+// markers of the servers, like SyncAllUsers does for every user, see multildap.MultiLDAP.ChangedUsers. The users of the
+// servers without marker are all synced. The highest markers of the servers are recorded for the next incremental sync.
+// It falls back to the sync of every user when a server has no "change_marker" attribute, or when the search is truncated.
+// The users removed from LDAP have no entry left to be changed, so only the sync of every user disables them.
+func SyncUsersChangedSince(config *ldap.Config, ldapServer multildap.IMultiLDAP, markers map[string]string, progress ProgressFunc, force bool) (*Summary, error) {
+	if err := preflight(config); err != nil {
+		return nil, err
+	}
+
+	start := now()
+
+	changed, highest, truncated, err := ldapServer.ChangedUsers(markers)
+
+	if err == ldap.ErrChangeMarkerUnsupported {
+		logger.Warn("An LDAP server has no change_marker attribute, syncing every user instead of the changed ones")
+		return SyncAllUsers(config, ldapServer, progress, force)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if truncated {
+		logger.Warn("The search of the changed LDAP users was truncated, syncing every user instead of the changed ones")
+		return SyncAllUsers(config, ldapServer, progress, force)
+	}
+
+	changedUsers, err := grafanaUsersOf(changed)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("Syncing the users changed in LDAP", "markers", markers, "changed", len(changed), "users", len(changedUsers))
+
+	summary := syncUsers(ldapServer, changedUsers, progress, force)
+	summary.ChangedSince = markers
+	advanceChangeMarkers(highest, summary)
+	advanceWatermark(start, summary)
+
+	return summary, nil
+}
+
+// SyncUsersModifiedSince synchronizes the Grafana users authenticated with LDAP whose entry was modified since the
+// given time, like SyncAllUsers does for every user. The directory is searched by the "updated_at" attribute of the
+// servers, see multildap.MultiLDAP.ModifiedUsers.
+// It falls back to the sync of every user when a server has no such attribute, or when the search is truncated.
+// The users removed from LDAP have no entry left to be modified, so only the sync of every user disables them.
+func SyncUsersModifiedSince(config *ldap.Config, ldapServer multildap.IMultiLDAP, since time.Time, progress ProgressFunc, force bool) (*Summary, error) {
+	if err := preflight(config); err != nil {
+		return nil, err
+	}
+
+	start := now()
+
+	modified, truncated, err := ldapServer.ModifiedUsers(since)
+
+	if err == ldap.ErrUpdatedAtUnsupported {
+		logger.Warn("An LDAP server has no updated_at attribute, syncing every user instead of the modified ones")
+		return SyncAllUsers(config, ldapServer, progress, force)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if truncated {
+		logger.Warn("The search of the modified LDAP users was truncated, syncing every user instead of the modified ones")
+		return SyncAllUsers(config, ldapServer, progress, force)
+	}
+
+	modifiedUsers, err := grafanaUsersOf(modified)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("Syncing the users modified in LDAP", "since", since, "modified", len(modified), "users", len(modifiedUsers))
+
+	summary := syncUsers(ldapServer, modifiedUsers, progress, force)
+	summary.Since = &since
+	advanceWatermark(start, summary)
+
+	return summary, nil
+}
+
+// grafanaUsersOf returns the Grafana users authenticated with LDAP matching the LDAP users by their login
+func grafanaUsersOf(ldapUsers []*models.ExternalUserInfo) ([]*models.User, error) {
+	users, err := getLDAPUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	logins := map[string]bool{}
+	for _, user := range ldapUsers {
+		logins[strings.ToLower(user.Login)] = true
+	}
+
+	matched := []*models.User{}
+	for _, user := range users {
+		if logins[strings.ToLower(user.Login)] {
+			matched = append(matched, user)
+		}
+	}
+
+	return matched, nil
+}
@@ -0,0 +1,251 @@
+package ldapsync
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncUsersModifiedSince(t *testing.T) {
+	since := time.Date(2019, 10, 15, 0, 0, 0, 0, time.UTC)
+	start := since.Add(24 * time.Hour)
+
+	now = func() time.Time { return start }
+	defer func() { now = time.Now }()
+
+	setup := func(t *testing.T) *[]string {
+		bus.ClearBusHandlers()
+		watermark = &syncWatermark{}
+
+		mockExistingOrgs(1)
+		mockLDAPUsers(t, []*models.UserSearchHitDTO{
+			{Id: 1, Login: "modified"},
+			{Id: 2, Login: "untouched"},
+			{Id: 3, Login: "broken"},
+		})
+
+		upserted := []string{}
+		bus.AddHandler("test", func(cmd *models.UpsertUserCommand) error {
+			upserted = append(upserted, cmd.ExternalUser.Login)
+			return nil
+		})
+
+		return &upserted
+	}
+
+	// newLDAPServer finds every user, except the broken one which fails
+	newLDAPServer := func(modified []*models.ExternalUserInfo, err error) *multildap.MockMultiLDAP {
+		return &multildap.MockMultiLDAP{
+			UserProvider: func(login string) (*models.ExternalUserInfo, ldap.ServerConfig, error) {
+				if login == "broken" {
+					return nil, ldap.ServerConfig{}, errors.New("broken")
+				}
+
+				return &models.ExternalUserInfo{Login: login}, ldap.ServerConfig{}, nil
+			},
+			ModifiedUsersProvider: func(searched time.Time) ([]*models.ExternalUserInfo, bool, error) {
+				assert.Equal(t, since, searched)
+				return modified, false, err
+			},
+		}
+	}
+
+	t.Run("only syncs the modified users and advances the watermark", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+		upserted := setup(t)
+
+		// the users modified in LDAP without Grafana account are left to their first login
+		ldapServer := newLDAPServer([]*models.ExternalUserInfo{{Login: "Modified"}, {Login: "newcomer"}}, nil)
+
+		summary, err := SyncUsersModifiedSince(configWithOrgs(1), ldapServer, since, nil, false)
+
+		require.Nil(t, err)
+		assert.Equal(t, []string{"modified"}, *upserted)
+		assert.Equal(t, 1, summary.Synced)
+		require.Len(t, summary.Users, 1)
+		assert.Equal(t, "modified", summary.Users[0].Login)
+		assert.Equal(t, &since, summary.Since)
+
+		assert.Equal(t, start, LastSyncWatermark())
+	})
+
+	t.Run("doesn't advance the watermark when a user fails", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+		setup(t)
+
+		ldapServer := newLDAPServer([]*models.ExternalUserInfo{{Login: "modified"}, {Login: "broken"}}, nil)
+
+		summary, err := SyncUsersModifiedSince(configWithOrgs(1), ldapServer, since, nil, false)
+
+		require.Nil(t, err)
+		assert.Equal(t, 1, summary.Synced)
+		assert.Equal(t, 1, summary.Failed)
+
+		assert.True(t, LastSyncWatermark().IsZero())
+	})
+
+	t.Run("falls back to the sync of every user without updated_at attribute", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+		upserted := setup(t)
+
+		ldapServer := newLDAPServer(nil, ldap.ErrUpdatedAtUnsupported)
+
+		summary, err := SyncUsersModifiedSince(configWithOrgs(1), ldapServer, since, nil, false)
+
+		require.Nil(t, err)
+		assert.Equal(t, []string{"modified", "untouched"}, *upserted)
+		assert.Len(t, summary.Users, 3)
+		assert.Nil(t, summary.Since)
+	})
+
+	t.Run("fails when the search of the modified users fails", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+		upserted := setup(t)
+
+		ldapServer := newLDAPServer(nil, multildap.ErrUnreachable)
+
+		summary, err := SyncUsersModifiedSince(configWithOrgs(1), ldapServer, since, nil, false)
+
+		assert.Nil(t, summary)
+		assert.Equal(t, multildap.ErrUnreachable, err)
+		assert.Empty(t, *upserted)
+	})
+}
+
+func TestSyncUsersChangedSince(t *testing.T) {
+	markers := map[string]string{"ldap.example.org:389": "12000"}
+
+	setup := func(t *testing.T) *[]string {
+		bus.ClearBusHandlers()
+		watermark = &syncWatermark{}
+		changeMarkers = &syncChangeMarkers{markers: map[string]string{}}
+
+		mockExistingOrgs(1)
+		mockLDAPUsers(t, []*models.UserSearchHitDTO{
+			{Id: 1, Login: "changed"},
+			{Id: 2, Login: "untouched"},
+			{Id: 3, Login: "broken"},
+		})
+
+		upserted := []string{}
+		bus.AddHandler("test", func(cmd *models.UpsertUserCommand) error {
+			upserted = append(upserted, cmd.ExternalUser.Login)
+			return nil
+		})
+
+		return &upserted
+	}
+
+	// configWithMarkers is the config of a server tracking the changes with uSNChanged
+	configWithMarkers := func() *ldap.Config {
+		config := configWithOrgs(1)
+		config.Servers[0].Attr.ChangeMarker = "uSNChanged"
+
+		return config
+	}
+
+	// newLDAPServer finds every user, except the broken one which fails, and records the searched markers
+	newLDAPServer := func(changed []*models.ExternalUserInfo, err error, searched *[]map[string]string) *multildap.MockMultiLDAP {
+		return &multildap.MockMultiLDAP{
+			UserProvider: func(login string) (*models.ExternalUserInfo, ldap.ServerConfig, error) {
+				if login == "broken" {
+					return nil, ldap.ServerConfig{}, errors.New("broken")
+				}
+
+				return &models.ExternalUserInfo{Login: login}, ldap.ServerConfig{}, nil
+			},
+			ChangedUsersProvider: func(since map[string]string) ([]*models.ExternalUserInfo, map[string]string, bool, error) {
+				*searched = append(*searched, since)
+				return changed, map[string]string{"ldap.example.org:389": "12345"}, false, err
+			},
+		}
+	}
+
+	t.Run("only syncs the changed users and records the markers", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+		upserted := setup(t)
+		searched := []map[string]string{}
+
+		ldapServer := newLDAPServer([]*models.ExternalUserInfo{{Login: "Changed"}, {Login: "newcomer"}}, nil, &searched)
+
+		summary, err := SyncUsersChangedSince(configWithMarkers(), ldapServer, markers, nil, false)
+
+		require.Nil(t, err)
+		assert.Equal(t, []string{"changed"}, *upserted)
+		assert.Equal(t, 1, summary.Synced)
+		assert.Equal(t, markers, summary.ChangedSince)
+		assert.Equal(t, []map[string]string{markers}, searched)
+
+		assert.Equal(t, map[string]string{"ldap.example.org:389": "12345"}, LastChangeMarkers())
+		assert.False(t, LastSyncWatermark().IsZero())
+	})
+
+	t.Run("doesn't record the markers when a user fails", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+		setup(t)
+		searched := []map[string]string{}
+
+		ldapServer := newLDAPServer([]*models.ExternalUserInfo{{Login: "changed"}, {Login: "broken"}}, nil, &searched)
+
+		summary, err := SyncUsersChangedSince(configWithMarkers(), ldapServer, markers, nil, false)
+
+		require.Nil(t, err)
+		assert.Equal(t, 1, summary.Failed)
+		assert.Empty(t, LastChangeMarkers())
+	})
+
+	t.Run("falls back to the sync of every user without change_marker attribute", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+		upserted := setup(t)
+		searched := []map[string]string{}
+
+		ldapServer := newLDAPServer(nil, ldap.ErrChangeMarkerUnsupported, &searched)
+
+		summary, err := SyncUsersChangedSince(configWithOrgs(1), ldapServer, markers, nil, false)
+
+		require.Nil(t, err)
+		assert.Equal(t, []string{"changed", "untouched"}, *upserted)
+		assert.Nil(t, summary.ChangedSince)
+		assert.Empty(t, LastChangeMarkers())
+	})
+
+	t.Run("syncs incrementally with the last recorded markers", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+		upserted := setup(t)
+		searched := []map[string]string{}
+
+		ldapServer := newLDAPServer([]*models.ExternalUserInfo{{Login: "changed"}}, nil, &searched)
+
+		// the first sync searches every user of the servers without marker
+		_, err := SyncUsersIncrementally(configWithMarkers(), ldapServer, nil, false)
+		require.Nil(t, err)
+
+		_, err = SyncUsersIncrementally(configWithMarkers(), ldapServer, nil, false)
+		require.Nil(t, err)
+
+		assert.Equal(t, []string{"changed", "changed"}, *upserted)
+		assert.Equal(t, []map[string]string{{}, {"ldap.example.org:389": "12345"}}, searched)
+	})
+
+	t.Run("syncs every user incrementally before the first sync without markers", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+		upserted := setup(t)
+		searched := []map[string]string{}
+
+		ldapServer := newLDAPServer(nil, nil, &searched)
+
+		summary, err := SyncUsersIncrementally(configWithOrgs(1), ldapServer, nil, false)
+
+		require.Nil(t, err)
+		assert.Equal(t, []string{"changed", "untouched"}, *upserted)
+		assert.Nil(t, summary.Since)
+		assert.Empty(t, searched)
+	})
+}
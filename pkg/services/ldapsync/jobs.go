@@ -0,0 +1,190 @@
+package ldapsync
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/util"
+)
+
+const (
+	// JobRunning is the status of a job in progress
+	JobRunning = "running"
+
+	// JobCompleted is the status of a job which succeeded
+	JobCompleted = "completed"
+
+	// JobFailed is the status of a job which failed
+	JobFailed = "failed"
+)
+
+var (
+	// ErrJobRunning is returned when a job is submitted while another one is running
+	ErrJobRunning = errors.New("Another LDAP job is already running")
+
+	// ErrJobNotFound is returned for unknown or expired jobs
+	ErrJobNotFound = errors.New("LDAP job not found")
+)
+
+// JobProgress is the progress of a job
+type JobProgress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+// JobEvent is the progress of a job after the sync of a user, with the result of the sync
+type JobEvent struct {
+	Done  int         `json:"done"`
+	Total int         `json:"total"`
+	User  *UserResult `json:"user"`
+}
+
+// Job is the state of a long-running LDAP operation
+type Job struct {
+	Id         string      `json:"id"`
+	Status     string      `json:"status"`
+	Progress   JobProgress `json:"progress"`
+	Summary    *Summary    `json:"summary,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	StartedAt  time.Time   `json:"startedAt"`
+	FinishedAt *time.Time  `json:"finishedAt,omitempty"`
+
+	// events are the progress of the job user by user, changed is closed and replaced whenever the job changes
+	events  []*JobEvent
+	changed chan struct{}
+}
+
+// JobFunc runs the job, reporting its progress
+type JobFunc func(progress ProgressFunc) (*Summary, error)
+
+// Jobs keeps in memory the state of the LDAP jobs, only one of them can run at a time.
+// The finished jobs are forgotten after the TTL.
+type Jobs struct {
+	ttl  time.Duration
+	now  func() time.Time
+	lock sync.Mutex
+	jobs map[string]*Job
+}
+
+// NewJobs creates the store of the LDAP jobs
+func NewJobs(ttl time.Duration) *Jobs {
+	return &Jobs{
+		ttl:  ttl,
+		now:  time.Now,
+		jobs: map[string]*Job{},
+	}
+}
+
+// Submit starts the job in the background, unless another job is running
+func (jobs *Jobs) Submit(run JobFunc) (*Job, error) {
+	jobs.lock.Lock()
+	defer jobs.lock.Unlock()
+
+	jobs.cleanup()
+
+	for _, job := range jobs.jobs {
+		if job.Status == JobRunning {
+			return nil, ErrJobRunning
+		}
+	}
+
+	job := &Job{
+		Id:        util.GenerateShortUID(),
+		Status:    JobRunning,
+		StartedAt: jobs.now(),
+		changed:   make(chan struct{}),
+	}
+	jobs.jobs[job.Id] = job
+
+	go jobs.run(job.Id, run)
+
+	snapshot := *job
+	return &snapshot, nil
+}
+
+// Get returns a snapshot of the state of the job
+func (jobs *Jobs) Get(id string) (*Job, error) {
+	jobs.lock.Lock()
+	defer jobs.lock.Unlock()
+
+	jobs.cleanup()
+
+	job, ok := jobs.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+
+	snapshot := *job
+	return &snapshot, nil
+}
+
+// Events returns the progress events of the job from the given one on, alongside a snapshot of the job.
+// The returned channel is closed once the job changes, so the caller can wait for the next events while it runs.
+func (jobs *Jobs) Events(id string, from int) ([]*JobEvent, *Job, <-chan struct{}, error) {
+	jobs.lock.Lock()
+	defer jobs.lock.Unlock()
+
+	jobs.cleanup()
+
+	job, ok := jobs.jobs[id]
+	if !ok {
+		return nil, nil, nil, ErrJobNotFound
+	}
+
+	events := []*JobEvent{}
+	if from < len(job.events) {
+		events = append(events, job.events[from:]...)
+	}
+
+	snapshot := *job
+	return events, &snapshot, job.changed, nil
+}
+
+func (jobs *Jobs) run(id string, run JobFunc) {
+	summary, err := run(func(done, total int, user *UserResult) {
+		jobs.lock.Lock()
+		defer jobs.lock.Unlock()
+
+		job := jobs.jobs[id]
+		job.Progress = JobProgress{Done: done, Total: total}
+		job.events = append(job.events, &JobEvent{Done: done, Total: total, User: user})
+		job.notify()
+	})
+
+	jobs.lock.Lock()
+	defer jobs.lock.Unlock()
+
+	job := jobs.jobs[id]
+	finishedAt := jobs.now()
+	job.FinishedAt = &finishedAt
+	defer job.notify()
+
+	if err != nil {
+		logger.Error("LDAP job failed", "job", id, "error", err)
+
+		job.Status = JobFailed
+		job.Error = err.Error()
+		return
+	}
+
+	job.Status = JobCompleted
+	job.Summary = summary
+}
+
+// notify wakes up the callers waiting for the job to change, the lock must be held
+func (job *Job) notify() {
+	close(job.changed)
+	job.changed = make(chan struct{})
+}
+
+// cleanup removes the jobs finished for longer than the TTL, the lock must be held
+func (jobs *Jobs) cleanup() {
+	now := jobs.now()
+
+	for id, job := range jobs.jobs {
+		if job.FinishedAt != nil && now.Sub(*job.FinishedAt) > jobs.ttl {
+			delete(jobs.jobs, id)
+		}
+	}
+}
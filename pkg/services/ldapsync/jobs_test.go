@@ -0,0 +1,162 @@
+package ldapsync
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// waitForJob polls the job until it is finished
+func waitForJob(t *testing.T, jobs *Jobs, id string) *Job {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := jobs.Get(id)
+		require.Nil(t, err)
+
+		if job.Status != JobRunning {
+			return job
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Fatalf("job %s did not finish", id)
+	return nil
+}
+
+func TestJobs(t *testing.T) {
+	t.Run("submit, poll and complete", func(t *testing.T) {
+		jobs := NewJobs(time.Hour)
+
+		proceed := make(chan bool)
+		reported := make(chan bool)
+
+		job, err := jobs.Submit(func(progress ProgressFunc) (*Summary, error) {
+			progress(1, 2, &UserResult{Login: "one"})
+			reported <- true
+			<-proceed
+			progress(2, 2, &UserResult{Login: "two"})
+
+			return &Summary{Synced: 2}, nil
+		})
+		require.Nil(t, err)
+		assert.Equal(t, JobRunning, job.Status)
+
+		<-reported
+
+		running, err := jobs.Get(job.Id)
+		require.Nil(t, err)
+		assert.Equal(t, JobRunning, running.Status)
+		assert.Equal(t, JobProgress{Done: 1, Total: 2}, running.Progress)
+
+		proceed <- true
+
+		completed := waitForJob(t, jobs, job.Id)
+		assert.Equal(t, JobCompleted, completed.Status)
+		assert.Equal(t, JobProgress{Done: 2, Total: 2}, completed.Progress)
+		assert.Equal(t, &Summary{Synced: 2}, completed.Summary)
+		assert.NotNil(t, completed.FinishedAt)
+	})
+
+	t.Run("waits for the events of the running job", func(t *testing.T) {
+		jobs := NewJobs(time.Hour)
+
+		proceed := make(chan bool)
+		job, err := jobs.Submit(func(progress ProgressFunc) (*Summary, error) {
+			<-proceed
+			progress(1, 2, &UserResult{Login: "one"})
+			<-proceed
+			progress(2, 2, &UserResult{Login: "two"})
+
+			return &Summary{Synced: 2}, nil
+		})
+		require.Nil(t, err)
+
+		events, running, changed, err := jobs.Events(job.Id, 0)
+		require.Nil(t, err)
+		assert.Empty(t, events)
+		assert.Equal(t, JobRunning, running.Status)
+
+		proceed <- true
+		<-changed
+
+		events, _, changed, err = jobs.Events(job.Id, 0)
+		require.Nil(t, err)
+		assert.Equal(t, []*JobEvent{{Done: 1, Total: 2, User: &UserResult{Login: "one"}}}, events)
+
+		proceed <- true
+		<-changed
+
+		completed := waitForJob(t, jobs, job.Id)
+		assert.Equal(t, JobCompleted, completed.Status)
+
+		events, _, _, err = jobs.Events(job.Id, 1)
+		require.Nil(t, err)
+		assert.Equal(t, []*JobEvent{{Done: 2, Total: 2, User: &UserResult{Login: "two"}}}, events)
+
+		_, _, _, err = jobs.Events("unknown", 0)
+		assert.Equal(t, ErrJobNotFound, err)
+	})
+
+	t.Run("failed job", func(t *testing.T) {
+		jobs := NewJobs(time.Hour)
+
+		job, err := jobs.Submit(func(progress ProgressFunc) (*Summary, error) {
+			return nil, errors.New("directory is on fire")
+		})
+		require.Nil(t, err)
+
+		failed := waitForJob(t, jobs, job.Id)
+		assert.Equal(t, JobFailed, failed.Status)
+		assert.Equal(t, "directory is on fire", failed.Error)
+		assert.Nil(t, failed.Summary)
+	})
+
+	t.Run("rejects a concurrent job", func(t *testing.T) {
+		jobs := NewJobs(time.Hour)
+
+		proceed := make(chan bool)
+		first, err := jobs.Submit(func(progress ProgressFunc) (*Summary, error) {
+			<-proceed
+			return &Summary{}, nil
+		})
+		require.Nil(t, err)
+
+		_, err = jobs.Submit(func(progress ProgressFunc) (*Summary, error) {
+			t.Error("the concurrent job should not run")
+			return nil, nil
+		})
+		assert.Equal(t, ErrJobRunning, err)
+
+		proceed <- true
+		waitForJob(t, jobs, first.Id)
+
+		second, err := jobs.Submit(func(progress ProgressFunc) (*Summary, error) {
+			return &Summary{}, nil
+		})
+		require.Nil(t, err)
+		waitForJob(t, jobs, second.Id)
+	})
+
+	t.Run("forgets the finished jobs after the TTL", func(t *testing.T) {
+		jobs := NewJobs(time.Minute)
+		now := time.Now()
+		jobs.now = func() time.Time { return now }
+
+		job, err := jobs.Submit(func(progress ProgressFunc) (*Summary, error) {
+			return &Summary{}, nil
+		})
+		require.Nil(t, err)
+		waitForJob(t, jobs, job.Id)
+
+		now = now.Add(2 * time.Minute)
+
+		_, err = jobs.Get(job.Id)
+		assert.Equal(t, ErrJobNotFound, err)
+	})
+}
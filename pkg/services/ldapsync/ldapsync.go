@@ -0,0 +1,155 @@
+package ldapsync
+
+import (
+	"errors"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/login"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// ErrGrafanaAdmin is returned when the sync would disable the Grafana super admin
+var ErrGrafanaAdmin = errors.New("Refusing to sync grafana super admin - it would be disabled")
+
+// ErrPartialOutage is returned when the user isn't found while some of the servers didn't answer, see isMissing
+var ErrPartialOutage = errors.New("Some of the LDAP servers are unreachable, refusing to disable the user")
+
+var logger = log.New("ldap.sync")
+
+// SyncUser synchronizes the Grafana user with its LDAP counterpart and returns the changes actually applied.
+// The user is disabled when none of the LDAP servers have it, see isMissing.
+// A directory outage never disables the user: the sync fails with multildap.ErrUnreachable or ErrPartialOutage instead.
+// Every sync is recorded in the SyncHistory, and the successful ones are passed to the post_sync_hook, if any.
+// The users excluded from the sync by the sync_allowlist or sync_denylist settings fail with ErrUserFiltered.
+func SyncUser(ldapServer multildap.IMultiLDAP, user *models.User) (*Changes, error) {
+	changes, skipReason, err := recordSync(ldapServer, user, false, false)
+
+	if skipReason == SkipReasonFiltered {
+		return nil, ErrUserFiltered
+	}
+
+	return changes, err
+}
+
+// syncChangedUser synchronizes the user like SyncUser, unless it didn't change in LDAP since it was last synced.
+// It then returns the reason the sync was skipped, like SkipReasonUnchanged, or SkipReasonFiltered for an excluded user.
+// With deferDisable, the user missing from LDAP isn't disabled but skipped with SkipReasonPendingDisable.
+func syncChangedUser(ldapServer multildap.IMultiLDAP, user *models.User, deferDisable bool) (*Changes, string, error) {
+	return recordSync(ldapServer, user, true, deferDisable)
+}
+
+// recordSync syncs the user and records it in the SyncHistory, the skipped syncs aren't recorded
+// nor passed to the post_sync_hook
+func recordSync(ldapServer multildap.IMultiLDAP, user *models.User, skipUnchanged bool, deferDisable bool) (*Changes, string, error) {
+	changes, skipReason, err := syncUser(ldapServer, user, skipUnchanged, deferDisable)
+
+	if skipReason == "" {
+		SyncHistory().Record(user.Login, user.Id, changes, err)
+	}
+
+	if skipReason == "" && err == nil {
+		runPostSyncHook(user, changes)
+	}
+
+	return changes, skipReason, err
+}
+
+func syncUser(ldapServer multildap.IMultiLDAP, user *models.User, skipUnchanged bool, deferDisable bool) (*Changes, string, error) {
+	if isFiltered(user.Login) {
+		logger.Debug("User excluded from the LDAP sync, skipping it", "user", user.Login)
+		return nil, SkipReasonFiltered, nil
+	}
+
+	before, err := getUserState(user.Id)
+	if err != nil {
+		return nil, "", err
+	}
+
+	blocked := []OrgRoleChange{}
+
+	extUser, _, attempts, err := ldapServer.UserWithAttempts(user.Login)
+	if err != nil && err != multildap.ErrDidNotFindUser {
+		return nil, "", err
+	}
+
+	if err == multildap.ErrDidNotFindUser {
+		if !isMissing(attempts) {
+			return nil, "", ErrPartialOutage
+		}
+
+		if setting.AdminUser == user.Login {
+			return nil, "", ErrGrafanaAdmin
+		}
+
+		if deferDisable {
+			return nil, SkipReasonPendingDisable, nil
+		}
+
+		logger.Debug("User not found in LDAP, disabling it", "user", user.Login)
+
+		lastSeen.forget(user.Id)
+
+		if err := login.DisableExternalUser(user.Login, models.LDAPSyncSourceSync); err != nil {
+			return nil, "", err
+		}
+	} else {
+		if skipUnchanged && lastSeen.unchanged(user.Id, extUser) {
+			logger.Debug("User unchanged in LDAP since its last sync, skipping it", "user", user.Login)
+			return nil, SkipReasonUnchanged, nil
+		}
+
+		seen := newSeenUser(extUser)
+
+		if setting.LDAPBlockRoleDowngrades {
+			extUser, blocked = blockRoleDowngrades(extUser, before)
+		}
+
+		upsertCmd := &models.UpsertUserCommand{
+			ExternalUser:   extUser,
+			SignupAllowed:  setting.LDAPAllowSignup,
+			LDAPSyncSource: models.LDAPSyncSourceSync,
+		}
+
+		if err := bus.Dispatch(upsertCmd); err != nil {
+			return nil, "", err
+		}
+
+		lastSeen.record(user.Id, seen)
+	}
+
+	after, err := getUserState(user.Id)
+	if err != nil {
+		return nil, "", err
+	}
+
+	changes := diffUserState(before, after)
+	changes.BlockedDowngrades = blocked
+
+	return changes, "", nil
+}
+
+// isMissing checks if the lookup which didn't find the user is authoritative enough to disable it. The user may be on
+// a server which didn't answer, so it's never missing while a server, or every replica of a group, is unreachable or
+// failed, see multildap.UnansweredServers. With the "unanimous" policy, none of the replicas may have failed either.
+func isMissing(attempts []*multildap.ServerAttempt) bool {
+	if unanswered := multildap.UnansweredServers(attempts); len(unanswered) > 0 {
+		logger.Debug("LDAP servers didn't answer the lookup, the user isn't missing", "servers", unanswered)
+		return false
+	}
+
+	if setting.LDAPDisableMissingUsers != setting.LDAPDisableMissingUnanimous {
+		return true
+	}
+
+	for _, attempt := range attempts {
+		switch attempt.Outcome {
+		case multildap.AttemptUnreachable, multildap.AttemptBindFailed, multildap.AttemptSearchFailed:
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,149 @@
+package ldapsync
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncUser_NotFound(t *testing.T) {
+	policy := setting.LDAPDisableMissingUsers
+	defer func() { setting.LDAPDisableMissingUsers = policy }()
+
+	// setup mocks the lookup of the user, and returns the ids of the users disabled by the sync
+	setup := func(t *testing.T, err error, attempts ...string) (*multildap.MockMultiLDAP, *[]int64) {
+		bus.ClearBusHandlers()
+
+		mockLDAPUsers(t, nil)
+
+		disabled := []int64{}
+		bus.AddHandler("test", func(query *models.GetExternalUserInfoByLoginQuery) error {
+			query.Result = &models.ExternalUserInfo{UserId: 1, Login: query.LoginOrEmail}
+			return nil
+		})
+
+		bus.AddHandler("test", func(cmd *models.DisableUserCommand) error {
+			if cmd.IsDisabled {
+				disabled = append(disabled, cmd.UserId)
+			}
+			return nil
+		})
+
+		ldapServer := &multildap.MockMultiLDAP{
+			UserProvider: func(login string) (*models.ExternalUserInfo, ldap.ServerConfig, error) {
+				return nil, ldap.ServerConfig{}, err
+			},
+			UserAttempts: []*multildap.ServerAttempt{},
+		}
+
+		for _, outcome := range attempts {
+			ldapServer.UserAttempts = append(ldapServer.UserAttempts, &multildap.ServerAttempt{Outcome: outcome})
+		}
+
+		return ldapServer, &disabled
+	}
+
+	user := &models.User{Id: 1, Login: "jdoe"}
+
+	t.Run("doesn't disable the user when none of the servers are reachable", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+		setting.LDAPDisableMissingUsers = setting.LDAPDisableMissingAuthoritative
+
+		ldapServer, disabled := setup(t, multildap.ErrUnreachable, multildap.AttemptUnreachable, multildap.AttemptUnreachable)
+
+		changes, err := SyncUser(ldapServer, user)
+
+		assert.Equal(t, multildap.ErrUnreachable, err)
+		assert.Nil(t, changes)
+		assert.Empty(t, *disabled)
+	})
+
+	t.Run("disables the user when every server reports it missing", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+		setting.LDAPDisableMissingUsers = setting.LDAPDisableMissingAuthoritative
+
+		ldapServer, disabled := setup(t, multildap.ErrDidNotFindUser, multildap.AttemptNotFound, multildap.AttemptNotFound)
+
+		_, err := SyncUser(ldapServer, user)
+
+		require.Nil(t, err)
+		assert.Equal(t, []int64{1}, *disabled)
+	})
+
+	for _, policy := range []string{setting.LDAPDisableMissingAuthoritative, setting.LDAPDisableMissingUnanimous} {
+		t.Run("doesn't disable the user during a partial outage with the "+policy+" policy", func(t *testing.T) {
+			defer bus.ClearBusHandlers()
+			setting.LDAPDisableMissingUsers = policy
+
+			ldapServer, disabled := setup(t, multildap.ErrDidNotFindUser, multildap.AttemptUnreachable, multildap.AttemptNotFound)
+
+			_, err := SyncUser(ldapServer, user)
+
+			assert.Equal(t, ErrPartialOutage, err)
+			assert.True(t, isTransient(err))
+			assert.Empty(t, *disabled)
+		})
+
+		t.Run("doesn't disable the user when a server fails with the "+policy+" policy", func(t *testing.T) {
+			defer bus.ClearBusHandlers()
+			setting.LDAPDisableMissingUsers = policy
+
+			ldapServer, disabled := setup(t, multildap.ErrDidNotFindUser, multildap.AttemptNotFound, multildap.AttemptSearchFailed)
+
+			_, err := SyncUser(ldapServer, user)
+
+			assert.Equal(t, ErrPartialOutage, err)
+			assert.Empty(t, *disabled)
+		})
+	}
+
+	// replicaAttempts are the attempts of a group whose first replica is unreachable while the second doesn't have the user
+	replicaAttempts := []*multildap.ServerAttempt{
+		{Host: "10.0.0.1", Port: 389, ReplicaGroup: "main", Outcome: multildap.AttemptUnreachable},
+		{Host: "10.0.0.2", Port: 389, ReplicaGroup: "main", Outcome: multildap.AttemptNotFound},
+	}
+
+	t.Run("disables the user when another replica of the unreachable one reports it missing", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+		setting.LDAPDisableMissingUsers = setting.LDAPDisableMissingAuthoritative
+
+		ldapServer, disabled := setup(t, multildap.ErrDidNotFindUser)
+		ldapServer.UserAttempts = replicaAttempts
+
+		_, err := SyncUser(ldapServer, user)
+
+		require.Nil(t, err)
+		assert.Equal(t, []int64{1}, *disabled)
+	})
+
+	t.Run("doesn't disable the user while a replica is unreachable with the unanimous policy", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+		setting.LDAPDisableMissingUsers = setting.LDAPDisableMissingUnanimous
+
+		ldapServer, disabled := setup(t, multildap.ErrDidNotFindUser)
+		ldapServer.UserAttempts = replicaAttempts
+
+		_, err := SyncUser(ldapServer, user)
+
+		assert.Equal(t, ErrPartialOutage, err)
+		assert.Empty(t, *disabled)
+	})
+
+	t.Run("disables the user when every server reports it missing with the unanimous policy", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+		setting.LDAPDisableMissingUsers = setting.LDAPDisableMissingUnanimous
+
+		ldapServer, disabled := setup(t, multildap.ErrDidNotFindUser, multildap.AttemptNotFound, multildap.AttemptSkipped)
+
+		_, err := SyncUser(ldapServer, user)
+
+		require.Nil(t, err)
+		assert.Equal(t, []int64{1}, *disabled)
+	})
+}
@@ -0,0 +1,58 @@
+package ldapsync
+
+import (
+	"errors"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// ErrSignupNotAllowed is returned by the sync of a LDAP user without Grafana user when allow_sign_up is disabled
+var ErrSignupNotAllowed = errors.New("The user doesn't exist in Grafana and the LDAP allow_sign_up setting is disabled")
+
+// SyncNewUser synchronizes the LDAP user with the given login which has no Grafana user yet, creating it as its
+// first login would. It returns the created user and its changes, with the ActionCreated action.
+// The users missing from LDAP fail with multildap.ErrDidNotFindUser, nothing is disabled, and the creation
+// follows the allow_sign_up, sync_allowlist and sync_denylist settings.
+func SyncNewUser(ldapServer multildap.IMultiLDAP, login string) (*models.User, *Changes, error) {
+	if isFiltered(login) {
+		return nil, nil, ErrUserFiltered
+	}
+
+	if !setting.LDAPAllowSignup {
+		return nil, nil, ErrSignupNotAllowed
+	}
+
+	extUser, _, _, err := ldapServer.UserWithAttempts(login)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	upsertCmd := &models.UpsertUserCommand{
+		ExternalUser:   extUser,
+		SignupAllowed:  true,
+		LDAPSyncSource: models.LDAPSyncSourceSync,
+	}
+
+	if err := bus.Dispatch(upsertCmd); err != nil {
+		return nil, nil, err
+	}
+
+	user := upsertCmd.Result
+	lastSeen.record(user.Id, newSeenUser(extUser))
+
+	after, err := getUserState(user.Id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changes := diffUserState(&userState{orgRoles: map[int64]models.RoleType{}, teams: map[TeamChange]bool{}}, after)
+	changes.Action = ActionCreated
+
+	SyncHistory().Record(user.Login, user.Id, changes, nil)
+	runPostSyncHook(user, changes)
+
+	return user, changes, nil
+}
@@ -0,0 +1,105 @@
+package ldapsync
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncNewUser(t *testing.T) {
+	allowSignup, denylist := setting.LDAPAllowSignup, setting.LDAPSyncDenylist
+	defer func() { setting.LDAPAllowSignup, setting.LDAPSyncDenylist = allowSignup, denylist }()
+
+	// setup mocks the creation of the user, and returns the upserted users
+	setup := func(t *testing.T) *[]*models.UpsertUserCommand {
+		bus.ClearBusHandlers()
+		setting.LDAPAllowSignup, setting.LDAPSyncDenylist = true, nil
+
+		upserted := []*models.UpsertUserCommand{}
+		bus.AddHandler("test", func(cmd *models.UpsertUserCommand) error {
+			upserted = append(upserted, cmd)
+			cmd.Result = &models.User{Id: 7, Login: cmd.ExternalUser.Login}
+			return nil
+		})
+
+		bus.AddHandler("test", func(query *models.GetUserByIdQuery) error {
+			query.Result = &models.User{Id: query.Id, Login: "jdoe"}
+			return nil
+		})
+
+		bus.AddHandler("test", func(query *models.GetUserOrgListQuery) error {
+			query.Result = []*models.UserOrgDTO{{OrgId: 1, Role: models.ROLE_EDITOR}}
+			return nil
+		})
+
+		bus.AddHandler("test", func(query *models.GetTeamMembersQuery) error {
+			query.Result = []*models.TeamMemberDTO{}
+			return nil
+		})
+
+		return &upserted
+	}
+
+	ldapServer := &multildap.MockMultiLDAP{
+		UserProvider: func(login string) (*models.ExternalUserInfo, ldap.ServerConfig, error) {
+			if login != "jdoe" {
+				return nil, ldap.ServerConfig{}, multildap.ErrDidNotFindUser
+			}
+
+			return &models.ExternalUserInfo{Login: login, OrgRoles: map[int64]models.RoleType{1: models.ROLE_EDITOR}}, ldap.ServerConfig{}, nil
+		},
+	}
+
+	t.Run("creates the user", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+		upserted := setup(t)
+
+		user, changes, err := SyncNewUser(ldapServer, "jdoe")
+
+		require.Nil(t, err)
+		assert.Equal(t, int64(7), user.Id)
+		assert.Equal(t, ActionCreated, changes.Action)
+		assert.Equal(t, []OrgRoleChange{{OrgId: 1, Role: models.ROLE_EDITOR}}, changes.OrgRolesAdded)
+		require.Len(t, *upserted, 1)
+		assert.True(t, (*upserted)[0].SignupAllowed)
+		assert.Equal(t, models.LDAPSyncSourceSync, (*upserted)[0].LDAPSyncSource)
+	})
+
+	t.Run("doesn't create the user missing from LDAP", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+		upserted := setup(t)
+
+		_, _, err := SyncNewUser(ldapServer, "ghost")
+
+		assert.Equal(t, multildap.ErrDidNotFindUser, err)
+		assert.Empty(t, *upserted)
+	})
+
+	t.Run("doesn't create the user without allow_sign_up", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+		upserted := setup(t)
+		setting.LDAPAllowSignup = false
+
+		_, _, err := SyncNewUser(ldapServer, "jdoe")
+
+		assert.Equal(t, ErrSignupNotAllowed, err)
+		assert.Empty(t, *upserted)
+	})
+
+	t.Run("doesn't create the user excluded from the sync", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+		upserted := setup(t)
+		setting.LDAPSyncDenylist = []string{"jdoe"}
+
+		_, _, err := SyncNewUser(ldapServer, "jdoe")
+
+		assert.Equal(t, ErrUserFiltered, err)
+		assert.Empty(t, *upserted)
+	})
+}
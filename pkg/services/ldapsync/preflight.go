@@ -0,0 +1,84 @@
+package ldapsync
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+)
+
+// MissingOrgsError is returned when the LDAP config references organizations which don't exist
+type MissingOrgsError struct {
+	OrgIds []int64
+}
+
+func (err *MissingOrgsError) Error() string {
+	ids := make([]string, len(err.OrgIds))
+	for i, id := range err.OrgIds {
+		ids[i] = fmt.Sprintf("%d", id)
+	}
+
+	return fmt.Sprintf("LDAP config references organizations which don't exist: %s", strings.Join(ids, ", "))
+}
+
+// MissingOrgs returns the ids of the organizations referenced by the group mappings of the config
+// which don't exist. Checking it before a bulk sync prevents half-applied syncs.
+func MissingOrgs(config *ldap.Config) ([]int64, error) {
+	orgIds := []int64{}
+	seen := map[int64]bool{}
+
+	for _, server := range config.Servers {
+		for _, group := range server.Groups {
+			if seen[group.OrgID] {
+				continue
+			}
+
+			seen[group.OrgID] = true
+			orgIds = append(orgIds, group.OrgID)
+		}
+	}
+
+	missing := []int64{}
+	if len(orgIds) == 0 {
+		return missing, nil
+	}
+
+	query := &models.SearchOrgsQuery{Ids: orgIds}
+	if err := bus.Dispatch(query); err != nil {
+		return nil, err
+	}
+
+	found := map[int64]bool{}
+	for _, org := range query.Result {
+		found[org.Id] = true
+	}
+
+	for _, orgId := range orgIds {
+		if !found[orgId] {
+			missing = append(missing, orgId)
+		}
+	}
+
+	sort.Slice(missing, func(i, j int) bool {
+		return missing[i] < missing[j]
+	})
+
+	return missing, nil
+}
+
+// preflight checks the config can be used for a bulk sync
+func preflight(config *ldap.Config) error {
+	missing, err := MissingOrgs(config)
+	if err != nil {
+		return err
+	}
+
+	if len(missing) > 0 {
+		return &MissingOrgsError{OrgIds: missing}
+	}
+
+	return nil
+}
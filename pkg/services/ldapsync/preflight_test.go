@@ -0,0 +1,80 @@
+package ldapsync
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func configWithOrgs(orgIds ...int64) *ldap.Config {
+	groups := []*ldap.GroupToOrgRole{}
+	for _, orgId := range orgIds {
+		groups = append(groups, &ldap.GroupToOrgRole{GroupDN: "cn=group", OrgID: orgId, OrgRole: models.ROLE_VIEWER})
+	}
+
+	return &ldap.Config{
+		Servers: []*ldap.ServerConfig{
+			{Groups: groups},
+		},
+	}
+}
+
+func mockExistingOrgs(orgIds ...int64) {
+	bus.AddHandler("test", func(query *models.SearchOrgsQuery) error {
+		query.Result = []*models.OrgDTO{}
+		for _, id := range query.Ids {
+			for _, orgId := range orgIds {
+				if id == orgId {
+					query.Result = append(query.Result, &models.OrgDTO{Id: id})
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+func TestMissingOrgs(t *testing.T) {
+	t.Run("valid config", func(t *testing.T) {
+		bus.ClearBusHandlers()
+		defer bus.ClearBusHandlers()
+
+		mockExistingOrgs(1, 2)
+
+		missing, err := MissingOrgs(configWithOrgs(1, 2, 1))
+
+		require.Nil(t, err)
+		assert.Empty(t, missing)
+		assert.Nil(t, preflight(configWithOrgs(1, 2)))
+	})
+
+	t.Run("invalid config", func(t *testing.T) {
+		bus.ClearBusHandlers()
+		defer bus.ClearBusHandlers()
+
+		mockExistingOrgs(1)
+
+		missing, err := MissingOrgs(configWithOrgs(3, 1, 2))
+
+		require.Nil(t, err)
+		assert.Equal(t, []int64{2, 3}, missing)
+
+		err = preflight(configWithOrgs(3, 1, 2))
+		assert.Equal(t, &MissingOrgsError{OrgIds: []int64{2, 3}}, err)
+		assert.EqualError(t, err, "LDAP config references organizations which don't exist: 2, 3")
+	})
+
+	t.Run("config without group mappings", func(t *testing.T) {
+		bus.ClearBusHandlers()
+		defer bus.ClearBusHandlers()
+
+		missing, err := MissingOrgs(configWithOrgs())
+
+		require.Nil(t, err)
+		assert.Empty(t, missing)
+	})
+}
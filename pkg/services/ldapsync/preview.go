@@ -0,0 +1,142 @@
+package ldapsync
+
+import (
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// FieldChange is a change of a field of the user profile
+type FieldChange struct {
+	Value    string `json:"value"`
+	Previous string `json:"previous"`
+}
+
+// GrafanaAdminChange is a change of the Grafana admin permission of the user
+type GrafanaAdminChange struct {
+	Value    bool `json:"value"`
+	Previous bool `json:"previous"`
+}
+
+// Preview is what the sync of the user would apply, see PreviewSync
+type Preview struct {
+	// Changes are the changes of the organization roles, teams and disabled flag the sync would apply
+	Changes *Changes `json:"changes"`
+
+	// Login, Email and Name are the changes of the user profile, they are nil when unchanged
+	Login *FieldChange `json:"login,omitempty"`
+	Email *FieldChange `json:"email,omitempty"`
+	Name  *FieldChange `json:"name,omitempty"`
+
+	GrafanaAdmin *GrafanaAdminChange `json:"grafanaAdmin,omitempty"`
+}
+
+// PreviewSync computes what SyncUser would apply to the user, without changing anything:
+// the user isn't updated nor disabled, and the sync isn't recorded in the SyncHistory nor passed to the post_sync_hook.
+// It fails like SyncUser does, for example with ErrGrafanaAdmin when the sync would disable the Grafana super admin.
+func PreviewSync(ldapServer multildap.IMultiLDAP, user *models.User) (*Preview, error) {
+	if isFiltered(user.Login) {
+		return nil, ErrUserFiltered
+	}
+
+	before, err := getUserState(user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	extUser, _, attempts, err := ldapServer.UserWithAttempts(user.Login)
+	if err != nil && err != multildap.ErrDidNotFindUser {
+		return nil, err
+	}
+
+	if err == multildap.ErrDidNotFindUser {
+		if !isMissing(attempts) {
+			return nil, ErrPartialOutage
+		}
+
+		if setting.AdminUser == user.Login {
+			return nil, ErrGrafanaAdmin
+		}
+
+		after := *before
+		after.isDisabled = true
+
+		return &Preview{Changes: diffUserState(before, &after)}, nil
+	}
+
+	blocked := []OrgRoleChange{}
+
+	if setting.LDAPBlockRoleDowngrades {
+		extUser, blocked = blockRoleDowngrades(extUser, before)
+	}
+
+	after, err := upsertedUserState(user.Id, before, extUser)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &Preview{
+		Changes: diffUserState(before, after),
+		Login:   fieldChange(user.Login, extUser.Login),
+		Email:   fieldChange(user.Email, extUser.Email),
+		Name:    fieldChange(user.Name, extUser.Name),
+	}
+	preview.Changes.BlockedDowngrades = blocked
+
+	if extUser.IsGrafanaAdmin != nil && *extUser.IsGrafanaAdmin != user.IsAdmin {
+		preview.GrafanaAdmin = &GrafanaAdminChange{Value: *extUser.IsGrafanaAdmin, Previous: user.IsAdmin}
+	}
+
+	return preview, nil
+}
+
+// fieldChange is the change of a profile field the upsert of the LDAP user would apply, the empty values aren't synced
+func fieldChange(previous, value string) *FieldChange {
+	if value == "" || value == previous {
+		return nil
+	}
+
+	return &FieldChange{Value: value, Previous: previous}
+}
+
+// upsertedUserState is the state the upsert of the LDAP user would give to the user, like login.UpsertUser does:
+// the user is enabled, the organization roles are only synced when LDAP maps some, and the teams only when LDAP
+// lists them, in which case only the memberships added by the syncs are removed.
+func upsertedUserState(userId int64, before *userState, extUser *models.ExternalUserInfo) (*userState, error) {
+	after := &userState{
+		orgRoles: before.orgRoles,
+		teams:    before.teams,
+	}
+
+	if len(extUser.OrgRoles) > 0 {
+		after.orgRoles = map[int64]models.RoleType{}
+		for orgId, role := range extUser.OrgRoles {
+			after.orgRoles[orgId] = role
+		}
+	}
+
+	if extUser.Teams == nil {
+		return after, nil
+	}
+
+	externalQuery := &models.GetTeamMembersQuery{UserId: userId, External: true}
+	if err := bus.Dispatch(externalQuery); err != nil {
+		return nil, err
+	}
+
+	after.teams = map[TeamChange]bool{}
+	for team := range before.teams {
+		after.teams[team] = true
+	}
+
+	for _, member := range externalQuery.Result {
+		delete(after.teams, TeamChange{OrgId: member.OrgId, TeamId: member.TeamId})
+	}
+
+	for _, team := range extUser.Teams {
+		after.teams[TeamChange{OrgId: team.OrgId, TeamId: team.TeamId}] = true
+	}
+
+	return after, nil
+}
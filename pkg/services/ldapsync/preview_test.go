@@ -0,0 +1,150 @@
+package ldapsync
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreviewSync(t *testing.T) {
+	blockDowngrades := setting.LDAPBlockRoleDowngrades
+	defer func() { setting.LDAPBlockRoleDowngrades = blockDowngrades }()
+
+	adminUser := setting.AdminUser
+	defer func() { setting.AdminUser = adminUser }()
+	setting.AdminUser = "admin"
+
+	user := &models.User{Id: 1, Login: "jdoe", Email: "jdoe@old.example.org", Name: "John Doe"}
+
+	// setup mocks a user Editor of org 1 and Viewer of org 2, manual member of team 1 and synced member of team 2.
+	// It fails the test on any change of the user.
+	setup := func(t *testing.T, extUser *models.ExternalUserInfo, err error) *multildap.MockMultiLDAP {
+		bus.ClearBusHandlers()
+
+		bus.AddHandler("test", func(query *models.GetUserByIdQuery) error {
+			query.Result = user
+			return nil
+		})
+
+		bus.AddHandler("test", func(query *models.GetUserOrgListQuery) error {
+			query.Result = []*models.UserOrgDTO{
+				{OrgId: 1, Role: models.ROLE_EDITOR},
+				{OrgId: 2, Role: models.ROLE_VIEWER},
+			}
+			return nil
+		})
+
+		bus.AddHandler("test", func(query *models.GetTeamMembersQuery) error {
+			query.Result = []*models.TeamMemberDTO{{OrgId: 1, TeamId: 2}}
+			if !query.External {
+				query.Result = append(query.Result, &models.TeamMemberDTO{OrgId: 1, TeamId: 1})
+			}
+			return nil
+		})
+
+		bus.AddHandler("test", func(cmd *models.UpsertUserCommand) error {
+			t.Error("the user was upserted")
+			return nil
+		})
+
+		bus.AddHandler("test", func(cmd *models.DisableUserCommand) error {
+			t.Error("the user was disabled")
+			return nil
+		})
+
+		return &multildap.MockMultiLDAP{
+			UserProvider: func(login string) (*models.ExternalUserInfo, ldap.ServerConfig, error) {
+				return extUser, ldap.ServerConfig{}, err
+			},
+			UserAttempts: []*multildap.ServerAttempt{{Outcome: multildap.AttemptNotFound}},
+		}
+	}
+
+	t.Run("previews the changes of the user", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+		setting.LDAPBlockRoleDowngrades = false
+
+		isAdmin := true
+		ldapServer := setup(t, &models.ExternalUserInfo{
+			Login:          "jdoe",
+			Email:          "jdoe@example.org",
+			OrgRoles:       map[int64]models.RoleType{1: models.ROLE_VIEWER, 3: models.ROLE_ADMIN},
+			IsGrafanaAdmin: &isAdmin,
+			Teams:          []models.ExternalTeam{{OrgId: 1, TeamId: 3}},
+		}, nil)
+
+		history := SyncHistory().Entries()
+
+		preview, err := PreviewSync(ldapServer, user)
+
+		require.Nil(t, err)
+		assert.Equal(t, []OrgRoleChange{{OrgId: 3, Role: models.ROLE_ADMIN}}, preview.Changes.OrgRolesAdded)
+		assert.Equal(t, []OrgRoleChange{{OrgId: 1, Role: models.ROLE_VIEWER, PreviousRole: models.ROLE_EDITOR, Downgrade: true}}, preview.Changes.OrgRolesChanged)
+		assert.Equal(t, []OrgRoleChange{{OrgId: 2, PreviousRole: models.ROLE_VIEWER}}, preview.Changes.OrgRolesRemoved)
+		assert.Equal(t, []TeamChange{{OrgId: 1, TeamId: 3}}, preview.Changes.TeamsAdded)
+		assert.Equal(t, []TeamChange{{OrgId: 1, TeamId: 2}}, preview.Changes.TeamsRemoved)
+		assert.Equal(t, ActionNone, preview.Changes.Action)
+
+		assert.Nil(t, preview.Login)
+		assert.Nil(t, preview.Name)
+		assert.Equal(t, &FieldChange{Value: "jdoe@example.org", Previous: "jdoe@old.example.org"}, preview.Email)
+		assert.Equal(t, &GrafanaAdminChange{Value: true, Previous: false}, preview.GrafanaAdmin)
+
+		assert.Equal(t, history, SyncHistory().Entries())
+	})
+
+	t.Run("keeps the roles and teams LDAP doesn't map", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+
+		ldapServer := setup(t, &models.ExternalUserInfo{Login: "jdoe"}, nil)
+
+		preview, err := PreviewSync(ldapServer, user)
+
+		require.Nil(t, err)
+		assert.False(t, preview.Changes.changed())
+	})
+
+	t.Run("previews the blocked downgrades", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+		setting.LDAPBlockRoleDowngrades = true
+
+		ldapServer := setup(t, &models.ExternalUserInfo{
+			Login:    "jdoe",
+			OrgRoles: map[int64]models.RoleType{1: models.ROLE_VIEWER, 2: models.ROLE_VIEWER},
+		}, nil)
+
+		preview, err := PreviewSync(ldapServer, user)
+
+		require.Nil(t, err)
+		assert.Empty(t, preview.Changes.OrgRolesChanged)
+		assert.Equal(t, []OrgRoleChange{{OrgId: 1, Role: models.ROLE_VIEWER, PreviousRole: models.ROLE_EDITOR, Downgrade: true}}, preview.Changes.BlockedDowngrades)
+	})
+
+	t.Run("previews the disabling of a user missing from LDAP", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+
+		ldapServer := setup(t, nil, multildap.ErrDidNotFindUser)
+
+		preview, err := PreviewSync(ldapServer, user)
+
+		require.Nil(t, err)
+		assert.Equal(t, ActionDisabled, preview.Changes.Action)
+		assert.Empty(t, preview.Changes.OrgRolesRemoved)
+	})
+
+	t.Run("refuses to preview the disabling of the super admin", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+
+		ldapServer := setup(t, nil, multildap.ErrDidNotFindUser)
+
+		_, err := PreviewSync(ldapServer, &models.User{Id: 1, Login: "admin"})
+
+		assert.Equal(t, ErrGrafanaAdmin, err)
+	})
+}
@@ -0,0 +1,105 @@
+package ldapsync
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/services/multildap"
+)
+
+// ReconciledUser is a user found only in Grafana or only in the directory by the reconciliation
+type ReconciledUser struct {
+	UserId     int64  `json:"userId,omitempty"`
+	Login      string `json:"login"`
+	Email      string `json:"email"`
+	Name       string `json:"name"`
+	IsDisabled bool   `json:"isDisabled"`
+}
+
+// Reconciliation compares the Grafana users authenticated with LDAP with the users of the directory.
+// The users missing from LDAP are the candidates to be disabled, the ones missing from Grafana to be provisioned.
+type Reconciliation struct {
+	GrafanaUsers       int               `json:"grafanaUsers"`
+	LDAPUsers          int               `json:"ldapUsers"`
+	Truncated          bool              `json:"truncated"`
+	MissingFromLDAP    []*ReconciledUser `json:"missingFromLDAP"`
+	MissingFromGrafana []*ReconciledUser `json:"missingFromGrafana"`
+}
+
+// Reconcile lists every user of the directory and every Grafana user authenticated with LDAP, and reports
+// the users found on one side only, matched by case insensitive login. Nothing is changed, neither in Grafana nor in LDAP.
+// When the size limit of a server truncated the directory users, the Grafana users missing from LDAP
+// can't be told apart from the truncated ones, so none are reported.
+func Reconcile(ldapServer multildap.IMultiLDAP) (*Reconciliation, error) {
+	ldapUsers, truncated, err := ldapServer.AllUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := getLDAPUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Reconciliation{
+		GrafanaUsers:       len(users),
+		LDAPUsers:          len(ldapUsers),
+		Truncated:          truncated,
+		MissingFromLDAP:    []*ReconciledUser{},
+		MissingFromGrafana: []*ReconciledUser{},
+	}
+
+	inLDAP := map[string]bool{}
+	for _, user := range ldapUsers {
+		inLDAP[strings.ToLower(user.Login)] = true
+	}
+
+	inGrafana := map[string]bool{}
+	for _, user := range users {
+		inGrafana[strings.ToLower(user.Login)] = true
+
+		if truncated || inLDAP[strings.ToLower(user.Login)] {
+			continue
+		}
+
+		report.MissingFromLDAP = append(report.MissingFromLDAP, &ReconciledUser{
+			UserId:     user.Id,
+			Login:      user.Login,
+			Email:      user.Email,
+			Name:       user.Name,
+			IsDisabled: user.IsDisabled,
+		})
+	}
+
+	for _, user := range ldapUsers {
+		login := strings.ToLower(user.Login)
+		if inGrafana[login] {
+			continue
+		}
+
+		// a user found by several servers is reported once
+		inGrafana[login] = true
+
+		report.MissingFromGrafana = append(report.MissingFromGrafana, &ReconciledUser{
+			Login:      user.Login,
+			Email:      user.Email,
+			Name:       user.Name,
+			IsDisabled: user.IsDisabled,
+		})
+	}
+
+	sortReconciledUsers(report.MissingFromLDAP)
+	sortReconciledUsers(report.MissingFromGrafana)
+
+	if truncated {
+		logger.Warn("The LDAP users are truncated by the size limit of the server(s), not reporting the users missing from LDAP")
+	}
+
+	return report, nil
+}
+
+func sortReconciledUsers(users []*ReconciledUser) {
+	sort.Slice(users, func(i, j int) bool {
+		return strings.ToLower(users[i].Login) < strings.ToLower(users[j].Login)
+	})
+}
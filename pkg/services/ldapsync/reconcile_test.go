@@ -0,0 +1,50 @@
+package ldapsync
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcile(t *testing.T) {
+	bus.ClearBusHandlers()
+	defer bus.ClearBusHandlers()
+
+	mockLDAPUsers(t, []*models.UserSearchHitDTO{
+		{Id: 1, Login: "alice", Email: "alice@example.org", Name: "Alice"},
+		{Id: 2, Login: "Bob", Email: "bob@example.org", Name: "Bob"},
+		{Id: 3, Login: "carol", Email: "carol@example.org", Name: "Carol", IsDisabled: true},
+		{Id: 4, Login: "dave", Email: "dave@example.org", Name: "Dave"},
+	})
+
+	ldapServer := &multildap.MockMultiLDAP{
+		UsersResult: []*models.ExternalUserInfo{
+			{Login: "alice", Email: "alice@example.org", Name: "Alice"},
+			{Login: "bob", Email: "bob@example.org", Name: "Bob"},
+			{Login: "zoe", Email: "zoe@example.org", Name: "Zoe"},
+			{Login: "erin", Email: "erin@example.org", Name: "Erin"},
+			{Login: "Erin", Email: "erin@example.org", Name: "Erin"},
+		},
+	}
+
+	report, err := Reconcile(ldapServer)
+	require.Nil(t, err)
+
+	assert.Equal(t, &Reconciliation{
+		GrafanaUsers: 4,
+		LDAPUsers:    5,
+		MissingFromLDAP: []*ReconciledUser{
+			{UserId: 3, Login: "carol", Email: "carol@example.org", Name: "Carol", IsDisabled: true},
+			{UserId: 4, Login: "dave", Email: "dave@example.org", Name: "Dave"},
+		},
+		MissingFromGrafana: []*ReconciledUser{
+			{Login: "erin", Email: "erin@example.org", Name: "Erin"},
+			{Login: "zoe", Email: "zoe@example.org", Name: "Zoe"},
+		},
+	}, report)
+	assert.Equal(t, 1, ldapServer.AllUsersCalledTimes)
+}
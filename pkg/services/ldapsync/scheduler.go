@@ -0,0 +1,166 @@
+package ldapsync
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"golang.org/x/xerrors"
+
+	"github.com/grafana/grafana/pkg/infra/serverlock"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/registry"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// jobsTTL is how long the state of a finished LDAP job is kept
+const jobsTTL = time.Hour
+
+// SyncJobs are the LDAP jobs started by the API and the scheduler, so a scheduled sync never runs alongside another job
+var SyncJobs = NewJobs(jobsTTL)
+
+// getLDAPConfig and newLDAP are replaced in the tests
+var (
+	getLDAPConfig = multildap.GetConfig
+	newLDAP       = multildap.NewSession
+)
+
+// scheduleParser parses the sync_cron setting, with the seconds field and the descriptors like @daily
+var scheduleParser = cron.NewParser(
+	cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+func init() {
+	registry.RegisterService(&SchedulerService{})
+}
+
+// SchedulerService syncs every LDAP user in the background on the sync_cron schedule of [auth.ldap],
+// when active_sync_enabled is set. Only one of the Grafana instances sharing the database syncs the users.
+type SchedulerService struct {
+	ServerLockService *serverlock.ServerLockService `inject:""`
+	AuthTokenService  models.UserTokenService       `inject:""`
+
+	schedule cron.Schedule
+}
+
+// Init parses the schedule, an invalid one fails the startup
+func (srv *SchedulerService) Init() error {
+	if srv.IsDisabled() {
+		return nil
+	}
+
+	schedule, err := parseSchedule(setting.LDAPSyncCron)
+	if err != nil {
+		return err
+	}
+
+	srv.schedule = schedule
+	return nil
+}
+
+// IsDisabled checks if the LDAP users are synced in the background
+func (srv *SchedulerService) IsDisabled() bool {
+	return !ldap.IsEnabled() || !setting.LDAPActiveSyncEnabled
+}
+
+// parseSchedule parses the cron expression of the sync_cron setting, which may be quoted
+func parseSchedule(spec string) (cron.Schedule, error) {
+	schedule, err := scheduleParser.Parse(strings.Trim(spec, `"`))
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to parse the sync_cron setting of [auth.ldap] %q: %w", spec, err)
+	}
+
+	return schedule, nil
+}
+
+// Run syncs the users at every time of the schedule
+func (srv *SchedulerService) Run(ctx context.Context) error {
+	for {
+		next := srv.schedule.Next(now())
+		logger.Debug("Scheduled the next LDAP sync", "at", next)
+
+		timer := time.NewTimer(time.Until(next))
+
+		select {
+		case <-timer.C:
+			// the instances may not fire at the exact same time, the lock is kept for half of the time until the next run
+			lockInterval := srv.schedule.Next(next).Sub(next) / 2
+
+			err := srv.ServerLockService.LockAndExecute(ctx, "ldap sync", lockInterval, srv.sync)
+			if err != nil {
+				logger.Error("Failed to lock the scheduled LDAP sync", "error", err)
+			}
+
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// sync starts the sync of every user, unless another LDAP job is running
+func (srv *SchedulerService) sync() {
+	job, err := srv.startSync()
+	if err != nil {
+		logger.Warn("Skipping the scheduled LDAP sync", "error", err)
+		return
+	}
+
+	logger.Info("Started the scheduled LDAP sync", "job", job.Id)
+}
+
+// startSync submits the job syncing every user, the disabled users are signed out
+func (srv *SchedulerService) startSync() (*Job, error) {
+	ldapConfig, err := getLDAPConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	ldapServer := newLDAP(ldapConfig.Servers)
+
+	job, err := SyncJobs.Submit(func(progress ProgressFunc) (*Summary, error) {
+		defer ldapServer.Close()
+
+		start := time.Now()
+
+		summary, err := SyncAllUsers(ldapConfig, ldapServer, progress, false)
+		if err != nil {
+			return nil, err
+		}
+
+		RevokeDisabledUsersTokens(srv.AuthTokenService, summary)
+
+		logger.Info(
+			"Scheduled LDAP sync done",
+			"synced", summary.Synced,
+			"skipped", summary.Skipped,
+			"failed", summary.Failed,
+			"duration", time.Since(start),
+		)
+
+		return summary, nil
+	})
+
+	if err != nil {
+		ldapServer.Close()
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// RevokeDisabledUsersTokens signs out the users disabled by the sync
+func RevokeDisabledUsersTokens(tokens models.UserTokenService, summary *Summary) {
+	for _, result := range summary.Users {
+		if result.Changes == nil || result.Changes.Action != ActionDisabled {
+			continue
+		}
+
+		if err := tokens.RevokeAllUserTokens(context.Background(), result.UserId); err != nil {
+			logger.Error("Failed to revoke the tokens of the disabled user", "user", result.Login, "error", err)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package ldapsync
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/auth"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/services/multildap"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSchedule(t *testing.T) {
+	from := time.Date(2019, 10, 15, 10, 30, 0, 0, time.UTC)
+
+	t.Run("parses the quoted default of the setting", func(t *testing.T) {
+		schedule, err := parseSchedule(`"0 0 1 * * *"`)
+
+		require.Nil(t, err)
+		assert.Equal(t, time.Date(2019, 10, 16, 1, 0, 0, 0, time.UTC), schedule.Next(from))
+	})
+
+	t.Run("parses the seconds field", func(t *testing.T) {
+		schedule, err := parseSchedule("*/10 * * * * *")
+
+		require.Nil(t, err)
+		assert.Equal(t, from.Add(10*time.Second), schedule.Next(from))
+	})
+
+	t.Run("parses the descriptors", func(t *testing.T) {
+		schedule, err := parseSchedule("@daily")
+
+		require.Nil(t, err)
+		assert.Equal(t, time.Date(2019, 10, 16, 0, 0, 0, 0, time.UTC), schedule.Next(from))
+	})
+
+	t.Run("rejects an invalid expression", func(t *testing.T) {
+		schedule, err := parseSchedule("every night")
+
+		assert.Nil(t, schedule)
+		require.NotNil(t, err)
+		assert.Contains(t, err.Error(), "sync_cron")
+	})
+}
+
+func TestSchedulerService_Init(t *testing.T) {
+	enabled, activeSync, cron := setting.LDAPEnabled, setting.LDAPActiveSyncEnabled, setting.LDAPSyncCron
+	defer func() {
+		setting.LDAPEnabled, setting.LDAPActiveSyncEnabled, setting.LDAPSyncCron = enabled, activeSync, cron
+	}()
+
+	t.Run("is disabled without LDAP or without active sync", func(t *testing.T) {
+		srv := &SchedulerService{}
+
+		setting.LDAPEnabled, setting.LDAPActiveSyncEnabled = false, true
+		assert.True(t, srv.IsDisabled())
+
+		setting.LDAPEnabled, setting.LDAPActiveSyncEnabled = true, false
+		assert.True(t, srv.IsDisabled())
+
+		setting.LDAPEnabled, setting.LDAPActiveSyncEnabled = true, true
+		assert.False(t, srv.IsDisabled())
+	})
+
+	t.Run("fails the startup with an invalid schedule", func(t *testing.T) {
+		setting.LDAPEnabled, setting.LDAPActiveSyncEnabled = true, true
+		setting.LDAPSyncCron = "every night"
+
+		assert.NotNil(t, (&SchedulerService{}).Init())
+	})
+
+	t.Run("ignores the schedule when disabled", func(t *testing.T) {
+		setting.LDAPEnabled, setting.LDAPActiveSyncEnabled = true, false
+		setting.LDAPSyncCron = "every night"
+
+		assert.Nil(t, (&SchedulerService{}).Init())
+	})
+}
+
+func TestSchedulerService_StartSync(t *testing.T) {
+	syncJobs := SyncJobs
+	defer func() {
+		SyncJobs = syncJobs
+		getLDAPConfig = multildap.GetConfig
+		newLDAP = multildap.NewSession
+	}()
+
+	ldapServer := &multildap.MockMultiLDAP{
+		UserProvider: func(login string) (*models.ExternalUserInfo, ldap.ServerConfig, error) {
+			return &models.ExternalUserInfo{Login: login}, ldap.ServerConfig{}, nil
+		},
+	}
+
+	getLDAPConfig = func() (*ldap.Config, error) { return configWithOrgs(1), nil }
+	newLDAP = func(configs []*ldap.ServerConfig) multildap.IMultiLDAP { return ldapServer }
+
+	srv := &SchedulerService{AuthTokenService: auth.NewFakeUserAuthTokenService()}
+
+	t.Run("syncs every user in a job", func(t *testing.T) {
+		bus.ClearBusHandlers()
+		defer bus.ClearBusHandlers()
+
+		SyncJobs = NewJobs(time.Hour)
+		ldapServer.CloseCalledTimes = 0
+
+		mockExistingOrgs(1)
+		mockLDAPUsers(t, []*models.UserSearchHitDTO{{Id: 1, Login: "alice"}, {Id: 2, Login: "bob"}})
+
+		upserted := []string{}
+		bus.AddHandler("test", func(cmd *models.UpsertUserCommand) error {
+			upserted = append(upserted, cmd.ExternalUser.Login)
+			return nil
+		})
+
+		job, err := srv.startSync()
+		require.Nil(t, err)
+
+		job = waitForJob(t, SyncJobs, job.Id)
+
+		assert.Equal(t, JobCompleted, job.Status)
+		assert.Equal(t, 2, job.Summary.Synced)
+		assert.ElementsMatch(t, []string{"alice", "bob"}, upserted)
+		assert.Equal(t, 1, ldapServer.CloseCalledTimes)
+	})
+
+	t.Run("skips the sync while another job is running", func(t *testing.T) {
+		SyncJobs = NewJobs(time.Hour)
+		ldapServer.CloseCalledTimes = 0
+
+		release := make(chan struct{})
+		defer close(release)
+
+		_, err := SyncJobs.Submit(func(progress ProgressFunc) (*Summary, error) {
+			<-release
+			return &Summary{}, nil
+		})
+		require.Nil(t, err)
+
+		job, err := srv.startSync()
+
+		assert.Nil(t, job)
+		assert.Equal(t, ErrJobRunning, err)
+		assert.Equal(t, 1, ldapServer.CloseCalledTimes)
+	})
+
+	t.Run("fails without configuration", func(t *testing.T) {
+		getLDAPConfig = func() (*ldap.Config, error) { return nil, errors.New("no config") }
+		defer func() { getLDAPConfig = func() (*ldap.Config, error) { return configWithOrgs(1), nil } }()
+
+		job, err := srv.startSync()
+
+		assert.Nil(t, job)
+		assert.EqualError(t, err, "no config")
+	})
+}
+
+func TestRevokeDisabledUsersTokens(t *testing.T) {
+	revoked := []int64{}
+	tokens := auth.NewFakeUserAuthTokenService()
+	tokens.RevokeAllUserTokensProvider = func(ctx context.Context, userId int64) error {
+		revoked = append(revoked, userId)
+		return nil
+	}
+
+	RevokeDisabledUsersTokens(tokens, &Summary{
+		Users: []*UserResult{
+			{UserId: 1, Login: "disabled", Changes: &Changes{Action: ActionDisabled}},
+			{UserId: 2, Login: "enabled", Changes: &Changes{Action: ActionEnabled}},
+			{UserId: 3, Login: "failed"},
+		},
+	})
+
+	assert.Equal(t, []int64{1}, revoked)
+}
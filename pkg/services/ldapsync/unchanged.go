@@ -0,0 +1,84 @@
+package ldapsync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// SkipReasonUnchanged is reported when the user didn't change in LDAP since it was last synced
+const SkipReasonUnchanged = "unchanged"
+
+// seenUser is what the last sync of a user saw in LDAP
+type seenUser struct {
+	updatedAt   time.Time
+	fingerprint string
+}
+
+// newSeenUser summarizes the LDAP user, the fingerprint covers every synced attribute
+func newSeenUser(extUser *models.ExternalUserInfo) *seenUser {
+	attributes := *extUser
+	attributes.UpdatedAt = time.Time{}
+
+	// encoding/json sorts the map keys so the fingerprint doesn't depend on the map ordering
+	data, _ := json.Marshal(&attributes)
+	sum := sha256.Sum256(data)
+
+	return &seenUser{
+		updatedAt:   extUser.UpdatedAt,
+		fingerprint: hex.EncodeToString(sum[:]),
+	}
+}
+
+// seenUsers remembers what the last syncs saw of the users, to skip the users which didn't change since.
+// It is kept in memory, so the first bulk sync after a restart upserts every user.
+type seenUsers struct {
+	lock  sync.Mutex
+	users map[int64]*seenUser
+}
+
+// lastSeen is what the syncs last saw of the users
+var lastSeen = newSeenUsers()
+
+func newSeenUsers() *seenUsers {
+	return &seenUsers{users: map[int64]*seenUser{}}
+}
+
+// unchanged checks if the user is the same as on its last sync: its updated at time isn't newer and
+// its attributes are the same, including the ones mapped from its groups.
+// The users without updated at time, see the "updated_at" attribute, are never unchanged.
+func (seen *seenUsers) unchanged(userId int64, extUser *models.ExternalUserInfo) bool {
+	if extUser.UpdatedAt.IsZero() {
+		return false
+	}
+
+	seen.lock.Lock()
+	last, ok := seen.users[userId]
+	seen.lock.Unlock()
+
+	if !ok || extUser.UpdatedAt.After(last.updatedAt) {
+		return false
+	}
+
+	return newSeenUser(extUser).fingerprint == last.fingerprint
+}
+
+// record remembers the user as synced
+func (seen *seenUsers) record(userId int64, user *seenUser) {
+	seen.lock.Lock()
+	defer seen.lock.Unlock()
+
+	seen.users[userId] = user
+}
+
+// forget forgets the user, its next sync won't be skipped
+func (seen *seenUsers) forget(userId int64) {
+	seen.lock.Lock()
+	defer seen.lock.Unlock()
+
+	delete(seen.users, userId)
+}
@@ -0,0 +1,83 @@
+package login
+
+import (
+	"strconv"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// syncAudit collects the changes an upsert of a LDAP user makes, for the audit trail of the LDAP syncs.
+// It is nil for the other auth modules, which aren't audited.
+type syncAudit struct {
+	source  string
+	entries []*models.LDAPSyncAuditEntry
+}
+
+func newSyncAudit(cmd *models.UpsertUserCommand) *syncAudit {
+	if cmd.ExternalUser.AuthModule != models.AuthModuleLDAP {
+		return nil
+	}
+
+	source := cmd.LDAPSyncSource
+	if source == "" {
+		source = models.LDAPSyncSourceLogin
+	}
+
+	return &syncAudit{source: source}
+}
+
+// record adds a change of the user, orgId is only set for the role changes
+func (audit *syncAudit) record(action string, orgId int64, previous, value string, reason string) {
+	if audit == nil {
+		return
+	}
+
+	audit.entries = append(audit.entries, &models.LDAPSyncAuditEntry{
+		Source:        audit.source,
+		Action:        action,
+		OrgId:         orgId,
+		PreviousValue: previous,
+		NewValue:      value,
+		Reason:        reason,
+	})
+}
+
+func (audit *syncAudit) recordRole(orgId int64, previous, role models.RoleType) {
+	reason := "Role mapped from the LDAP groups"
+	if role == "" {
+		reason = "No role mapped from the LDAP groups"
+	}
+
+	audit.record(models.LDAPSyncAuditRoleChange, orgId, string(previous), string(role), reason)
+}
+
+func (audit *syncAudit) recordStaleRole(orgId int64, previous, role models.RoleType) {
+	audit.record(
+		models.LDAPSyncAuditRoleChange, orgId, string(previous), string(role),
+		"No role mapped from the LDAP groups, downgraded to the stale org role",
+	)
+}
+
+func (audit *syncAudit) recordAdmin(previous, isGrafanaAdmin bool) {
+	audit.record(
+		models.LDAPSyncAuditAdminChange, 0, strconv.FormatBool(previous), strconv.FormatBool(isGrafanaAdmin),
+		"Grafana admin mapped from the LDAP groups",
+	)
+}
+
+// save records the changes of the user in the audit trail, a failure is only logged since the changes are already made
+func (audit *syncAudit) save(user *models.User) {
+	if audit == nil || len(audit.entries) == 0 {
+		return
+	}
+
+	for _, entry := range audit.entries {
+		entry.UserId = user.Id
+		entry.Login = user.Login
+	}
+
+	if err := bus.Dispatch(&models.AddLDAPSyncAuditEntriesCommand{Entries: audit.entries}); err != nil {
+		logger.Warn("Failed to record the LDAP sync audit", "user", user.Login, "error", err)
+	}
+}
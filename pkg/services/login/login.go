@@ -1,6 +1,8 @@
 package login
 
 import (
+	"time"
+
 	"github.com/grafana/grafana/pkg/bus"
 	"github.com/grafana/grafana/pkg/infra/log"
 	"github.com/grafana/grafana/pkg/models"
@@ -29,6 +31,7 @@ func (ls *LoginService) Init() error {
 
 func (ls *LoginService) UpsertUser(cmd *models.UpsertUserCommand) error {
 	extUser := cmd.ExternalUser
+	audit := newSyncAudit(cmd)
 
 	userQuery := &models.GetUserByAuthInfoQuery{
 		AuthModule: extUser.AuthModule,
@@ -65,10 +68,12 @@ func (ls *LoginService) UpsertUser(cmd *models.UpsertUserCommand) error {
 
 		if extUser.AuthModule != "" {
 			cmd2 := &models.SetAuthInfoCommand{
-				UserId:     cmd.Result.Id,
-				AuthModule: extUser.AuthModule,
-				AuthId:     extUser.AuthId,
-				OAuthToken: extUser.OAuthToken,
+				UserId:       cmd.Result.Id,
+				AuthModule:   extUser.AuthModule,
+				AuthId:       extUser.AuthId,
+				OAuthToken:   extUser.OAuthToken,
+				LockedFields: extUser.LockedFields,
+				Metadata:     extUser.Metadata,
 			}
 			if err := ls.Bus.Dispatch(cmd2); err != nil {
 				return err
@@ -83,8 +88,8 @@ func (ls *LoginService) UpsertUser(cmd *models.UpsertUserCommand) error {
 			return err
 		}
 
-		// Always persist the latest token at log-in
-		if extUser.AuthModule != "" && extUser.OAuthToken != nil {
+		// Always persist the latest token at log-in, and the locked fields and the metadata at every sync
+		if extUser.AuthModule != "" && (extUser.OAuthToken != nil || extUser.LockedFields != nil || extUser.Metadata != nil) {
 			err = updateUserAuth(cmd.Result, extUser)
 			if err != nil {
 				return err
@@ -96,10 +101,12 @@ func (ls *LoginService) UpsertUser(cmd *models.UpsertUserCommand) error {
 			if err := ls.Bus.Dispatch(&models.DisableUserCommand{UserId: cmd.Result.Id, IsDisabled: false}); err != nil {
 				return err
 			}
+
+			audit.record(models.LDAPSyncAuditEnable, 0, "disabled", "enabled", "Found in LDAP")
 		}
 	}
 
-	err = syncOrgRoles(cmd.Result, extUser)
+	err = syncOrgRoles(cmd.Result, extUser, audit)
 
 	if err != nil {
 		return err
@@ -110,6 +117,25 @@ func (ls *LoginService) UpsertUser(cmd *models.UpsertUserCommand) error {
 		if err := ls.Bus.Dispatch(&models.UpdateUserPermissionsCommand{UserId: cmd.Result.Id, IsGrafanaAdmin: *extUser.IsGrafanaAdmin}); err != nil {
 			return err
 		}
+
+		audit.recordAdmin(cmd.Result.IsAdmin, *extUser.IsGrafanaAdmin)
+	}
+
+	audit.save(cmd.Result)
+
+	err = syncTeams(cmd.Result, extUser)
+	if err != nil {
+		return err
+	}
+
+	err = syncFolderPermissions(cmd.Result, extUser)
+	if err != nil {
+		return err
+	}
+
+	err = syncPreferences(cmd.Result, extUser)
+	if err != nil {
+		return err
 	}
 
 	err = ls.Bus.Dispatch(&models.SyncTeamsCommand{
@@ -117,11 +143,20 @@ func (ls *LoginService) UpsertUser(cmd *models.UpsertUserCommand) error {
 		ExternalUser: extUser,
 	})
 
-	if err == bus.ErrHandlerNotFound {
-		return nil
+	if err != nil && err != bus.ErrHandlerNotFound {
+		return err
 	}
 
-	return err
+	// the last sync tells the admins whether the roles of a LDAP user are stale
+	if extUser.AuthModule == models.AuthModuleLDAP {
+		return ls.Bus.Dispatch(&models.UpdateAuthSyncedAtCommand{
+			UserId:     cmd.Result.Id,
+			AuthModule: extUser.AuthModule,
+			SyncedAt:   time.Now(),
+		})
+	}
+
+	return nil
 }
 
 func createUser(extUser *models.ExternalUserInfo) (*models.User, error) {
@@ -174,19 +209,23 @@ func updateUser(user *models.User, extUser *models.ExternalUserInfo) error {
 
 func updateUserAuth(user *models.User, extUser *models.ExternalUserInfo) error {
 	updateCmd := &models.UpdateAuthInfoCommand{
-		AuthModule: extUser.AuthModule,
-		AuthId:     extUser.AuthId,
-		UserId:     user.Id,
-		OAuthToken: extUser.OAuthToken,
+		AuthModule:   extUser.AuthModule,
+		AuthId:       extUser.AuthId,
+		UserId:       user.Id,
+		OAuthToken:   extUser.OAuthToken,
+		LockedFields: extUser.LockedFields,
+		Metadata:     extUser.Metadata,
 	}
 
 	logger.Debug("Updating user_auth info", "user_id", user.Id)
 	return bus.Dispatch(updateCmd)
 }
 
-func syncOrgRoles(user *models.User, extUser *models.ExternalUserInfo) error {
-	// don't sync org roles if none are specified
-	if len(extUser.OrgRoles) == 0 {
+// syncOrgRoles gives the user its external org roles. In the orgs it has no external role in, the user
+// is removed, or downgraded to the StaleOrgRole of the external user.
+func syncOrgRoles(user *models.User, extUser *models.ExternalUserInfo, audit *syncAudit) error {
+	// don't sync org roles if none are specified, unless the stale ones are
+	if len(extUser.OrgRoles) == 0 && extUser.StaleOrgRole == nil {
 		return nil
 	}
 
@@ -196,20 +235,35 @@ func syncOrgRoles(user *models.User, extUser *models.ExternalUserInfo) error {
 	}
 
 	handledOrgIds := map[int64]bool{}
-	deleteOrgIds := []int64{}
+	deleteOrgs := []*models.UserOrgDTO{}
 
 	// update existing org roles
 	for _, org := range orgsQuery.Result {
 		handledOrgIds[org.OrgId] = true
 
-		if extUser.OrgRoles[org.OrgId] == "" {
-			deleteOrgIds = append(deleteOrgIds, org.OrgId)
+		if extUser.OrgRoles[org.OrgId] == "" && isStaleRoleKept(extUser.StaleOrgRole) {
+			// downgrade role, the lower roles are kept
+			role := *extUser.StaleOrgRole
+			if org.Role == role || !org.Role.Includes(role) {
+				continue
+			}
+
+			cmd := &models.UpdateOrgUserCommand{OrgId: org.OrgId, UserId: user.Id, Role: role}
+			if err := bus.Dispatch(cmd); err != nil {
+				return err
+			}
+
+			audit.recordStaleRole(org.OrgId, org.Role, role)
+		} else if extUser.OrgRoles[org.OrgId] == "" {
+			deleteOrgs = append(deleteOrgs, org)
 		} else if extUser.OrgRoles[org.OrgId] != org.Role {
 			// update role
 			cmd := &models.UpdateOrgUserCommand{OrgId: org.OrgId, UserId: user.Id, Role: extUser.OrgRoles[org.OrgId]}
 			if err := bus.Dispatch(cmd); err != nil {
 				return err
 			}
+
+			audit.recordRole(org.OrgId, org.Role, cmd.Role)
 		}
 	}
 
@@ -225,18 +279,24 @@ func syncOrgRoles(user *models.User, extUser *models.ExternalUserInfo) error {
 		if err != nil && err != models.ErrOrgNotFound {
 			return err
 		}
+
+		if err == nil {
+			audit.recordRole(orgId, "", orgRole)
+		}
 	}
 
 	// delete any removed org roles
-	for _, orgId := range deleteOrgIds {
-		cmd := &models.RemoveOrgUserCommand{OrgId: orgId, UserId: user.Id}
+	for _, org := range deleteOrgs {
+		cmd := &models.RemoveOrgUserCommand{OrgId: org.OrgId, UserId: user.Id}
 		if err := bus.Dispatch(cmd); err != nil {
 			return err
 		}
+
+		audit.recordRole(org.OrgId, org.Role, "")
 	}
 
 	// update user's default org if needed
-	if _, ok := extUser.OrgRoles[user.OrgId]; !ok {
+	if _, ok := extUser.OrgRoles[user.OrgId]; !ok && len(extUser.OrgRoles) > 0 {
 		for orgId := range extUser.OrgRoles {
 			user.OrgId = orgId
 			break
@@ -250,3 +310,198 @@ func syncOrgRoles(user *models.User, extUser *models.ExternalUserInfo) error {
 
 	return nil
 }
+
+// isStaleRoleKept checks if the user keeps a role in the orgs it has no external role in anymore
+func isStaleRoleKept(role *models.RoleType) bool {
+	return role != nil && *role != ""
+}
+
+// teamMembership identifies a team membership
+type teamMembership struct {
+	orgId  int64
+	teamId int64
+}
+
+// syncTeams adds the user to the teams of the external user and removes
+// the user from the teams it was added to by the previous syncs, but which
+// the external user is no longer member of. The default teams are never removed.
+func syncTeams(user *models.User, extUser *models.ExternalUserInfo) error {
+	// don't sync teams if none are specified
+	if extUser.Teams == nil {
+		return nil
+	}
+
+	membersQuery := &models.GetTeamMembersQuery{UserId: user.Id, External: true}
+	if err := bus.Dispatch(membersQuery); err != nil {
+		return err
+	}
+
+	teams := map[teamMembership]models.ExternalTeam{}
+	for _, team := range extUser.Teams {
+		teams[teamMembership{orgId: team.OrgId, teamId: team.TeamId}] = team
+	}
+
+	handled := map[teamMembership]bool{}
+	for _, member := range membersQuery.Result {
+		membership := teamMembership{orgId: member.OrgId, teamId: member.TeamId}
+		handled[membership] = true
+
+		if _, ok := teams[membership]; ok {
+			continue
+		}
+
+		cmd := &models.RemoveTeamMemberCommand{OrgId: member.OrgId, TeamId: member.TeamId, UserId: user.Id}
+		if err := bus.Dispatch(cmd); err != nil && err != models.ErrTeamMemberNotFound {
+			return err
+		}
+	}
+
+	for membership, team := range teams {
+		if handled[membership] {
+			continue
+		}
+
+		cmd := &models.AddTeamMemberCommand{OrgId: team.OrgId, TeamId: team.TeamId, UserId: user.Id, External: true}
+		err := bus.Dispatch(cmd)
+		if err != nil && err != models.ErrTeamMemberAlreadyAdded && err != models.ErrTeamNotFound {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// syncFolderPermissions gives the user the folder permissions of the external user and removes
+// the ones given by the previous syncs which the external user no longer has. The permissions
+// given manually to the user are never changed.
+func syncFolderPermissions(user *models.User, extUser *models.ExternalUserInfo) error {
+	// don't sync folder permissions if none are specified
+	if extUser.FolderPermissions == nil {
+		return nil
+	}
+
+	aclQuery := &models.GetUserExternalAclQuery{UserId: user.Id}
+	if err := bus.Dispatch(aclQuery); err != nil {
+		return err
+	}
+
+	current := map[int64]*models.DashboardAcl{}
+	for _, item := range aclQuery.Result {
+		current[item.DashboardId] = item
+	}
+
+	wanted := map[int64]bool{}
+	for _, permission := range extUser.FolderPermissions {
+		wanted[permission.FolderId] = true
+
+		if item, ok := current[permission.FolderId]; ok && item.Permission == permission.Permission {
+			continue
+		}
+
+		err := setExternalFolderPermission(user, permission.OrgId, permission.FolderId, permission.Permission)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, item := range current {
+		if wanted[item.DashboardId] {
+			continue
+		}
+
+		if err := setExternalFolderPermission(user, item.OrgId, item.DashboardId, 0); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setExternalFolderPermission replaces the external permission of the user on the folder,
+// or removes it when the permission is 0. The other permissions of the folder are kept.
+func setExternalFolderPermission(user *models.User, orgId, folderId int64, permission models.PermissionType) error {
+	folderQuery := &models.GetDashboardQuery{Id: folderId, OrgId: orgId}
+	err := bus.Dispatch(folderQuery)
+	if err == models.ErrDashboardNotFound || (err == nil && !folderQuery.Result.IsFolder) {
+		logger.Warn("Folder not found, skipping the sync of its permission", "folderId", folderId, "orgId", orgId)
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	cmd := &models.SetExternalDashboardAclCommand{OrgId: orgId, DashboardId: folderId, UserId: user.Id, Permission: permission}
+	err = bus.Dispatch(cmd)
+	if err == models.ErrDashboardAclManualPermission {
+		logger.Debug("Keeping the manual permission of the user on the folder", "user", user.Login, "folderId", folderId)
+		return nil
+	}
+
+	return err
+}
+
+// syncPreferences sets the mapped preferences of the user in the orgs of its roles, or in its current org without roles.
+// The other preferences are kept, as the home dashboard in the orgs without the dashboard of the mapped UID.
+func syncPreferences(user *models.User, extUser *models.ExternalUserInfo) error {
+	// don't sync preferences if none are mapped
+	if extUser.Preferences == nil {
+		return nil
+	}
+
+	orgIds := []int64{}
+	for orgId := range extUser.OrgRoles {
+		orgIds = append(orgIds, orgId)
+	}
+
+	if len(orgIds) == 0 {
+		orgIds = append(orgIds, user.OrgId)
+	}
+
+	for _, orgId := range orgIds {
+		prefsQuery := &models.GetPreferencesQuery{UserId: user.Id, OrgId: orgId}
+		if err := bus.Dispatch(prefsQuery); err != nil {
+			return err
+		}
+
+		current := prefsQuery.Result
+		cmd := &models.SavePreferencesCommand{
+			UserId:          user.Id,
+			OrgId:           orgId,
+			HomeDashboardId: current.HomeDashboardId,
+			Timezone:        current.Timezone,
+			Theme:           current.Theme,
+		}
+
+		if extUser.Preferences.Theme != "" {
+			cmd.Theme = extUser.Preferences.Theme
+		}
+
+		if extUser.Preferences.Timezone != "" {
+			cmd.Timezone = extUser.Preferences.Timezone
+		}
+
+		if uid := extUser.Preferences.HomeDashboardUID; uid != "" {
+			dashQuery := &models.GetDashboardQuery{Uid: uid, OrgId: orgId}
+			err := bus.Dispatch(dashQuery)
+
+			if err == models.ErrDashboardNotFound {
+				logger.Warn("Ignoring the home dashboard of the user, it isn't in the org", "user", user.Login, "orgId", orgId, "uid", uid)
+			} else if err != nil {
+				return err
+			} else {
+				cmd.HomeDashboardId = dashQuery.Result.Id
+			}
+		}
+
+		if cmd.HomeDashboardId == current.HomeDashboardId && cmd.Timezone == current.Timezone && cmd.Theme == current.Theme {
+			continue
+		}
+
+		if err := bus.Dispatch(cmd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,670 @@
+package login
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncTeams(t *testing.T) {
+	setup := func(members []*models.TeamMemberDTO) (*[]*models.AddTeamMemberCommand, *[]*models.RemoveTeamMemberCommand) {
+		bus.ClearBusHandlers()
+
+		added := []*models.AddTeamMemberCommand{}
+		removed := []*models.RemoveTeamMemberCommand{}
+
+		bus.AddHandler("test", func(query *models.GetTeamMembersQuery) error {
+			query.Result = members
+			return nil
+		})
+		bus.AddHandler("test", func(cmd *models.AddTeamMemberCommand) error {
+			added = append(added, cmd)
+			return nil
+		})
+		bus.AddHandler("test", func(cmd *models.RemoveTeamMemberCommand) error {
+			removed = append(removed, cmd)
+			return nil
+		})
+
+		return &added, &removed
+	}
+	defer bus.ClearBusHandlers()
+
+	user := &models.User{Id: 1}
+
+	t.Run("ignores the sync when no teams are specified", func(t *testing.T) {
+		added, removed := setup([]*models.TeamMemberDTO{{OrgId: 1, TeamId: 1}})
+
+		err := syncTeams(user, &models.ExternalUserInfo{})
+
+		require.NoError(t, err)
+		assert.Empty(t, *added)
+		assert.Empty(t, *removed)
+	})
+
+	t.Run("adds the user to the default team", func(t *testing.T) {
+		added, removed := setup([]*models.TeamMemberDTO{})
+
+		err := syncTeams(user, &models.ExternalUserInfo{
+			Teams: []models.ExternalTeam{{OrgId: 1, TeamId: 2, IsDefault: true}},
+		})
+
+		require.NoError(t, err)
+		require.Len(t, *added, 1)
+		assert.Equal(t, &models.AddTeamMemberCommand{OrgId: 1, TeamId: 2, UserId: 1, External: true}, (*added)[0])
+		assert.Empty(t, *removed)
+	})
+
+	t.Run("never removes the user from the default team", func(t *testing.T) {
+		added, removed := setup([]*models.TeamMemberDTO{
+			{OrgId: 1, TeamId: 2, UserId: 1, External: true},
+			{OrgId: 1, TeamId: 3, UserId: 1, External: true},
+		})
+
+		err := syncTeams(user, &models.ExternalUserInfo{
+			Teams: []models.ExternalTeam{{OrgId: 1, TeamId: 2, IsDefault: true}},
+		})
+
+		require.NoError(t, err)
+		assert.Empty(t, *added)
+		require.Len(t, *removed, 1)
+		assert.Equal(t, int64(3), (*removed)[0].TeamId)
+	})
+}
+
+func TestSyncFolderPermissions(t *testing.T) {
+	setup := func(external []*models.DashboardAcl, manual ...int64) *[]*models.SetExternalDashboardAclCommand {
+		bus.ClearBusHandlers()
+
+		set := []*models.SetExternalDashboardAclCommand{}
+
+		bus.AddHandler("test", func(query *models.GetUserExternalAclQuery) error {
+			query.Result = external
+			return nil
+		})
+		bus.AddHandler("test", func(query *models.GetDashboardQuery) error {
+			if query.Id == 404 {
+				return models.ErrDashboardNotFound
+			}
+
+			query.Result = &models.Dashboard{Id: query.Id, OrgId: query.OrgId, IsFolder: true}
+			return nil
+		})
+		bus.AddHandler("test", func(cmd *models.SetExternalDashboardAclCommand) error {
+			for _, folderId := range manual {
+				if cmd.DashboardId == folderId {
+					return models.ErrDashboardAclManualPermission
+				}
+			}
+
+			set = append(set, cmd)
+			return nil
+		})
+
+		return &set
+	}
+	defer bus.ClearBusHandlers()
+
+	user := &models.User{Id: 1, Login: "jdoe"}
+
+	t.Run("ignores the sync when no folder permissions are specified", func(t *testing.T) {
+		set := setup([]*models.DashboardAcl{{OrgId: 1, DashboardId: 10, UserId: 1, Permission: models.PERMISSION_VIEW, External: true}})
+
+		err := syncFolderPermissions(user, &models.ExternalUserInfo{})
+
+		require.NoError(t, err)
+		assert.Empty(t, *set)
+	})
+
+	t.Run("sets the permission of the user on the folder", func(t *testing.T) {
+		set := setup(nil)
+
+		err := syncFolderPermissions(user, &models.ExternalUserInfo{
+			FolderPermissions: []models.ExternalFolderPermission{{OrgId: 1, FolderId: 10, Permission: models.PERMISSION_EDIT}},
+		})
+
+		require.NoError(t, err)
+		require.Len(t, *set, 1)
+		assert.Equal(t, &models.SetExternalDashboardAclCommand{
+			OrgId: 1, DashboardId: 10, UserId: 1, Permission: models.PERMISSION_EDIT,
+		}, (*set)[0])
+	})
+
+	t.Run("doesn't update an unchanged permission", func(t *testing.T) {
+		set := setup([]*models.DashboardAcl{{OrgId: 1, DashboardId: 10, UserId: 1, Permission: models.PERMISSION_EDIT, External: true}})
+
+		err := syncFolderPermissions(user, &models.ExternalUserInfo{
+			FolderPermissions: []models.ExternalFolderPermission{{OrgId: 1, FolderId: 10, Permission: models.PERMISSION_EDIT}},
+		})
+
+		require.NoError(t, err)
+		assert.Empty(t, *set)
+	})
+
+	t.Run("keeps a manual permission", func(t *testing.T) {
+		set := setup(nil, 10)
+
+		err := syncFolderPermissions(user, &models.ExternalUserInfo{
+			FolderPermissions: []models.ExternalFolderPermission{{OrgId: 1, FolderId: 10, Permission: models.PERMISSION_ADMIN}},
+		})
+
+		require.NoError(t, err)
+		assert.Empty(t, *set)
+	})
+
+	t.Run("removes the permissions the user no longer has", func(t *testing.T) {
+		set := setup([]*models.DashboardAcl{{OrgId: 1, DashboardId: 10, UserId: 1, Permission: models.PERMISSION_EDIT, External: true}})
+
+		err := syncFolderPermissions(user, &models.ExternalUserInfo{
+			FolderPermissions: []models.ExternalFolderPermission{},
+		})
+
+		require.NoError(t, err)
+		require.Len(t, *set, 1)
+		assert.Equal(t, int64(10), (*set)[0].DashboardId)
+		assert.Equal(t, models.PermissionType(0), (*set)[0].Permission)
+	})
+
+	t.Run("skips the missing folders", func(t *testing.T) {
+		set := setup(nil)
+
+		err := syncFolderPermissions(user, &models.ExternalUserInfo{
+			FolderPermissions: []models.ExternalFolderPermission{{OrgId: 1, FolderId: 404, Permission: models.PERMISSION_VIEW}},
+		})
+
+		require.NoError(t, err)
+		assert.Empty(t, *set)
+	})
+}
+
+func TestSyncPreferences(t *testing.T) {
+	setup := func(current map[int64]*models.Preferences) *[]*models.SavePreferencesCommand {
+		bus.ClearBusHandlers()
+
+		saved := []*models.SavePreferencesCommand{}
+
+		bus.AddHandler("test", func(query *models.GetPreferencesQuery) error {
+			query.Result = new(models.Preferences)
+			if prefs, ok := current[query.OrgId]; ok {
+				query.Result = prefs
+			}
+			return nil
+		})
+		bus.AddHandler("test", func(query *models.GetDashboardQuery) error {
+			if query.OrgId != 1 {
+				return models.ErrDashboardNotFound
+			}
+
+			query.Result = &models.Dashboard{Id: 42, Uid: query.Uid, OrgId: query.OrgId}
+			return nil
+		})
+		bus.AddHandler("test", func(cmd *models.SavePreferencesCommand) error {
+			saved = append(saved, cmd)
+			return nil
+		})
+
+		return &saved
+	}
+	defer bus.ClearBusHandlers()
+
+	user := &models.User{Id: 1, Login: "jdoe", OrgId: 3}
+
+	t.Run("ignores the sync when no preferences are mapped", func(t *testing.T) {
+		saved := setup(nil)
+
+		err := syncPreferences(user, &models.ExternalUserInfo{OrgRoles: map[int64]models.RoleType{1: models.ROLE_VIEWER}})
+
+		require.NoError(t, err)
+		assert.Empty(t, *saved)
+	})
+
+	t.Run("keeps the preferences which aren't mapped", func(t *testing.T) {
+		saved := setup(map[int64]*models.Preferences{1: {HomeDashboardId: 7, Timezone: "browser", Theme: "light"}})
+
+		err := syncPreferences(user, &models.ExternalUserInfo{
+			OrgRoles:    map[int64]models.RoleType{1: models.ROLE_VIEWER},
+			Preferences: &models.ExternalPreferences{Timezone: "utc"},
+		})
+
+		require.NoError(t, err)
+		require.Len(t, *saved, 1)
+		assert.Equal(t, &models.SavePreferencesCommand{UserId: 1, OrgId: 1, HomeDashboardId: 7, Timezone: "utc", Theme: "light"}, (*saved)[0])
+	})
+
+	t.Run("resolves the home dashboard in each org", func(t *testing.T) {
+		saved := setup(map[int64]*models.Preferences{2: {HomeDashboardId: 7}})
+
+		err := syncPreferences(user, &models.ExternalUserInfo{
+			OrgRoles:    map[int64]models.RoleType{1: models.ROLE_VIEWER, 2: models.ROLE_EDITOR},
+			Preferences: &models.ExternalPreferences{HomeDashboardUID: "ops"},
+		})
+
+		require.NoError(t, err)
+		require.Len(t, *saved, 1)
+		assert.Equal(t, int64(1), (*saved)[0].OrgId)
+		assert.Equal(t, int64(42), (*saved)[0].HomeDashboardId)
+	})
+
+	t.Run("doesn't save the unchanged preferences", func(t *testing.T) {
+		saved := setup(map[int64]*models.Preferences{1: {Theme: "dark"}})
+
+		err := syncPreferences(user, &models.ExternalUserInfo{
+			OrgRoles:    map[int64]models.RoleType{1: models.ROLE_VIEWER},
+			Preferences: &models.ExternalPreferences{Theme: "dark"},
+		})
+
+		require.NoError(t, err)
+		assert.Empty(t, *saved)
+	})
+
+	t.Run("sets the preferences in the current org without org roles", func(t *testing.T) {
+		saved := setup(nil)
+
+		err := syncPreferences(user, &models.ExternalUserInfo{Preferences: &models.ExternalPreferences{Theme: "dark"}})
+
+		require.NoError(t, err)
+		require.Len(t, *saved, 1)
+		assert.Equal(t, int64(3), (*saved)[0].OrgId)
+		assert.Equal(t, "dark", (*saved)[0].Theme)
+	})
+}
+
+func TestUpsertUser_LockedFields(t *testing.T) {
+	setup := func(existing *models.User) (*[]*models.SetAuthInfoCommand, *[]*models.UpdateAuthInfoCommand) {
+		bus.ClearBusHandlers()
+
+		set := []*models.SetAuthInfoCommand{}
+		updated := []*models.UpdateAuthInfoCommand{}
+
+		bus.AddHandler("test", func(query *models.GetUserByAuthInfoQuery) error {
+			if existing == nil {
+				return models.ErrUserNotFound
+			}
+			query.Result = existing
+			return nil
+		})
+		bus.AddHandler("test", func(cmd *models.CreateUserCommand) error {
+			cmd.Result = models.User{Id: 1, Login: cmd.Login}
+			return nil
+		})
+		bus.AddHandler("test", func(cmd *models.UpdateUserCommand) error {
+			return nil
+		})
+		bus.AddHandler("test", func(cmd *models.SetAuthInfoCommand) error {
+			set = append(set, cmd)
+			return nil
+		})
+		bus.AddHandler("test", func(cmd *models.UpdateAuthInfoCommand) error {
+			updated = append(updated, cmd)
+			return nil
+		})
+		bus.AddHandler("test", func(cmd *models.UpdateAuthSyncedAtCommand) error {
+			return nil
+		})
+
+		return &set, &updated
+	}
+	defer bus.ClearBusHandlers()
+
+	t.Run("locks the fields of the created user", func(t *testing.T) {
+		set, updated := setup(nil)
+
+		ls := &LoginService{Bus: bus.GetBus()}
+		err := ls.UpsertUser(&models.UpsertUserCommand{
+			SignupAllowed: true,
+			ExternalUser: &models.ExternalUserInfo{
+				AuthModule:   models.AuthModuleLDAP,
+				AuthId:       "cn=jdoe",
+				Login:        "jdoe",
+				LockedFields: []string{models.UserFieldEmail, models.UserFieldName},
+			},
+		})
+
+		require.NoError(t, err)
+		require.Len(t, *set, 1)
+		assert.Equal(t, []string{"email", "name"}, (*set)[0].LockedFields)
+		assert.Empty(t, *updated)
+	})
+
+	t.Run("locks the fields of the synced user on every sync", func(t *testing.T) {
+		set, updated := setup(&models.User{Id: 1, Login: "jdoe"})
+
+		ls := &LoginService{Bus: bus.GetBus()}
+		err := ls.UpsertUser(&models.UpsertUserCommand{
+			ExternalUser: &models.ExternalUserInfo{
+				AuthModule:   models.AuthModuleLDAP,
+				AuthId:       "cn=jdoe",
+				Login:        "jdoe",
+				LockedFields: []string{models.UserFieldLogin},
+			},
+		})
+
+		require.NoError(t, err)
+		assert.Empty(t, *set)
+		require.Len(t, *updated, 1)
+		assert.Equal(t, int64(1), (*updated)[0].UserId)
+		assert.Equal(t, []string{"login"}, (*updated)[0].LockedFields)
+	})
+
+	t.Run("stores the metadata of the created and the synced user", func(t *testing.T) {
+		set, _ := setup(nil)
+		metadata := map[string]string{"department": "Engineering"}
+
+		ls := &LoginService{Bus: bus.GetBus()}
+		err := ls.UpsertUser(&models.UpsertUserCommand{
+			SignupAllowed: true,
+			ExternalUser: &models.ExternalUserInfo{
+				AuthModule: models.AuthModuleLDAP,
+				AuthId:     "cn=jdoe",
+				Login:      "jdoe",
+				Metadata:   metadata,
+			},
+		})
+
+		require.NoError(t, err)
+		require.Len(t, *set, 1)
+		assert.Equal(t, metadata, (*set)[0].Metadata)
+
+		_, updated := setup(&models.User{Id: 1, Login: "jdoe"})
+
+		err = ls.UpsertUser(&models.UpsertUserCommand{
+			ExternalUser: &models.ExternalUserInfo{
+				AuthModule: models.AuthModuleLDAP,
+				AuthId:     "cn=jdoe",
+				Login:      "jdoe",
+				Metadata:   map[string]string{},
+			},
+		})
+
+		require.NoError(t, err)
+		require.Len(t, *updated, 1)
+		assert.Nil(t, (*updated)[0].LockedFields)
+		assert.Equal(t, map[string]string{}, (*updated)[0].Metadata)
+	})
+
+	t.Run("leaves the auth info of the synced user without locked fields", func(t *testing.T) {
+		_, updated := setup(&models.User{Id: 1, Login: "jdoe"})
+
+		ls := &LoginService{Bus: bus.GetBus()}
+		err := ls.UpsertUser(&models.UpsertUserCommand{
+			ExternalUser: &models.ExternalUserInfo{
+				AuthModule: "oauth_generic",
+				AuthId:     "jdoe",
+				Login:      "jdoe",
+			},
+		})
+
+		require.NoError(t, err)
+		assert.Empty(t, *updated)
+	})
+}
+
+func TestUpsertUser_LastSyncedAt(t *testing.T) {
+	setup := func() *[]*models.UpdateAuthSyncedAtCommand {
+		bus.ClearBusHandlers()
+
+		synced := []*models.UpdateAuthSyncedAtCommand{}
+
+		bus.AddHandler("test", func(query *models.GetUserByAuthInfoQuery) error {
+			query.Result = &models.User{Id: 1, Login: "jdoe"}
+			return nil
+		})
+		bus.AddHandler("test", func(cmd *models.UpdateUserCommand) error {
+			return nil
+		})
+		bus.AddHandler("test", func(cmd *models.UpdateAuthSyncedAtCommand) error {
+			synced = append(synced, cmd)
+			return nil
+		})
+
+		return &synced
+	}
+	defer bus.ClearBusHandlers()
+
+	t.Run("records the sync of a LDAP user", func(t *testing.T) {
+		synced := setup()
+		start := time.Now()
+
+		ls := &LoginService{Bus: bus.GetBus()}
+		err := ls.UpsertUser(&models.UpsertUserCommand{
+			ExternalUser: &models.ExternalUserInfo{
+				AuthModule: models.AuthModuleLDAP,
+				AuthId:     "cn=jdoe",
+				Login:      "jdoe",
+			},
+		})
+
+		require.NoError(t, err)
+		require.Len(t, *synced, 1)
+		assert.Equal(t, int64(1), (*synced)[0].UserId)
+		assert.Equal(t, models.AuthModuleLDAP, (*synced)[0].AuthModule)
+		assert.False(t, (*synced)[0].SyncedAt.Before(start))
+	})
+
+	t.Run("doesn't record the sync of the other auth modules", func(t *testing.T) {
+		synced := setup()
+
+		ls := &LoginService{Bus: bus.GetBus()}
+		err := ls.UpsertUser(&models.UpsertUserCommand{
+			ExternalUser: &models.ExternalUserInfo{
+				AuthModule: "oauth_generic",
+				AuthId:     "jdoe",
+				Login:      "jdoe",
+			},
+		})
+
+		require.NoError(t, err)
+		assert.Empty(t, *synced)
+	})
+}
+
+func TestUpsertUser_Audit(t *testing.T) {
+	setup := func(existing *models.User, orgs []*models.UserOrgDTO) *[]*models.LDAPSyncAuditEntry {
+		bus.ClearBusHandlers()
+
+		entries := []*models.LDAPSyncAuditEntry{}
+
+		bus.AddHandler("test", func(query *models.GetUserByAuthInfoQuery) error {
+			query.Result = existing
+			return nil
+		})
+		bus.AddHandler("test", func(query *models.GetUserOrgListQuery) error {
+			query.Result = orgs
+			return nil
+		})
+		for _, handler := range []interface{}{
+			func(cmd *models.UpdateUserCommand) error { return nil },
+			func(cmd *models.UpdateAuthInfoCommand) error { return nil },
+			func(cmd *models.UpdateAuthSyncedAtCommand) error { return nil },
+			func(cmd *models.DisableUserCommand) error { return nil },
+			func(cmd *models.UpdateOrgUserCommand) error { return nil },
+			func(cmd *models.AddOrgUserCommand) error { return nil },
+			func(cmd *models.RemoveOrgUserCommand) error { return nil },
+			func(cmd *models.SetUsingOrgCommand) error { return nil },
+			func(cmd *models.UpdateUserPermissionsCommand) error { return nil },
+		} {
+			bus.AddHandler("test", handler)
+		}
+		bus.AddHandler("test", func(cmd *models.AddLDAPSyncAuditEntriesCommand) error {
+			entries = append(entries, cmd.Entries...)
+			return nil
+		})
+
+		return &entries
+	}
+	defer bus.ClearBusHandlers()
+
+	isGrafanaAdmin := true
+
+	t.Run("records the changes of a LDAP user", func(t *testing.T) {
+		entries := setup(
+			&models.User{Id: 1, Login: "jdoe", OrgId: 1, IsDisabled: true},
+			[]*models.UserOrgDTO{{OrgId: 1, Role: models.ROLE_VIEWER}, {OrgId: 2, Role: models.ROLE_EDITOR}},
+		)
+
+		ls := &LoginService{Bus: bus.GetBus()}
+		err := ls.UpsertUser(&models.UpsertUserCommand{
+			LDAPSyncSource: models.LDAPSyncSourceSync,
+			ExternalUser: &models.ExternalUserInfo{
+				AuthModule:     models.AuthModuleLDAP,
+				AuthId:         "cn=jdoe",
+				Login:          "jdoe",
+				OrgRoles:       map[int64]models.RoleType{1: models.ROLE_ADMIN, 3: models.ROLE_VIEWER},
+				IsGrafanaAdmin: &isGrafanaAdmin,
+			},
+		})
+
+		require.NoError(t, err)
+		require.Len(t, *entries, 5)
+
+		for _, entry := range *entries {
+			assert.Equal(t, int64(1), entry.UserId)
+			assert.Equal(t, "jdoe", entry.Login)
+			assert.Equal(t, models.LDAPSyncSourceSync, entry.Source)
+		}
+
+		changes := [][]interface{}{}
+		for _, entry := range *entries {
+			changes = append(changes, []interface{}{entry.Action, entry.OrgId, entry.PreviousValue, entry.NewValue})
+		}
+
+		assert.Equal(t, [][]interface{}{
+			{models.LDAPSyncAuditEnable, int64(0), "disabled", "enabled"},
+			{models.LDAPSyncAuditRoleChange, int64(1), "Viewer", "Admin"},
+			{models.LDAPSyncAuditRoleChange, int64(3), "", "Viewer"},
+			{models.LDAPSyncAuditRoleChange, int64(2), "Editor", ""},
+			{models.LDAPSyncAuditAdminChange, int64(0), "false", "true"},
+		}, changes)
+	})
+
+	t.Run("records nothing for an unchanged LDAP user", func(t *testing.T) {
+		entries := setup(
+			&models.User{Id: 1, Login: "jdoe", OrgId: 1},
+			[]*models.UserOrgDTO{{OrgId: 1, Role: models.ROLE_VIEWER}},
+		)
+
+		ls := &LoginService{Bus: bus.GetBus()}
+		err := ls.UpsertUser(&models.UpsertUserCommand{
+			ExternalUser: &models.ExternalUserInfo{
+				AuthModule: models.AuthModuleLDAP,
+				AuthId:     "cn=jdoe",
+				Login:      "jdoe",
+				OrgRoles:   map[int64]models.RoleType{1: models.ROLE_VIEWER},
+			},
+		})
+
+		require.NoError(t, err)
+		assert.Empty(t, *entries)
+	})
+
+	t.Run("doesn't audit the other auth modules", func(t *testing.T) {
+		entries := setup(
+			&models.User{Id: 1, Login: "jdoe", OrgId: 1},
+			[]*models.UserOrgDTO{{OrgId: 1, Role: models.ROLE_VIEWER}},
+		)
+
+		ls := &LoginService{Bus: bus.GetBus()}
+		err := ls.UpsertUser(&models.UpsertUserCommand{
+			ExternalUser: &models.ExternalUserInfo{
+				AuthModule: "oauth_generic",
+				AuthId:     "jdoe",
+				Login:      "jdoe",
+				OrgRoles:   map[int64]models.RoleType{1: models.ROLE_EDITOR},
+			},
+		})
+
+		require.NoError(t, err)
+		assert.Empty(t, *entries)
+	})
+}
+
+func TestSyncOrgRoles_StaleOrgRole(t *testing.T) {
+	setup := func(orgs []*models.UserOrgDTO) (*[]*models.UpdateOrgUserCommand, *[]*models.RemoveOrgUserCommand, *[]*models.SetUsingOrgCommand) {
+		bus.ClearBusHandlers()
+
+		updated := []*models.UpdateOrgUserCommand{}
+		removed := []*models.RemoveOrgUserCommand{}
+		using := []*models.SetUsingOrgCommand{}
+
+		bus.AddHandler("test", func(query *models.GetUserOrgListQuery) error {
+			query.Result = orgs
+			return nil
+		})
+		bus.AddHandler("test", func(cmd *models.UpdateOrgUserCommand) error {
+			updated = append(updated, cmd)
+			return nil
+		})
+		bus.AddHandler("test", func(cmd *models.RemoveOrgUserCommand) error {
+			removed = append(removed, cmd)
+			return nil
+		})
+		bus.AddHandler("test", func(cmd *models.SetUsingOrgCommand) error {
+			using = append(using, cmd)
+			return nil
+		})
+
+		return &updated, &removed, &using
+	}
+	defer bus.ClearBusHandlers()
+
+	user := &models.User{Id: 1, OrgId: 1}
+	orgs := []*models.UserOrgDTO{{OrgId: 1, Role: models.ROLE_ADMIN}, {OrgId: 2, Role: models.ROLE_VIEWER}}
+	remove, downgrade := models.RoleType(""), models.ROLE_EDITOR
+
+	t.Run("ignores the sync when no roles are specified", func(t *testing.T) {
+		updated, removed, using := setup(orgs)
+
+		err := syncOrgRoles(user, &models.ExternalUserInfo{}, nil)
+
+		require.NoError(t, err)
+		assert.Empty(t, *updated)
+		assert.Empty(t, *removed)
+		assert.Empty(t, *using)
+	})
+
+	t.Run("removes the user from every org without role", func(t *testing.T) {
+		updated, removed, using := setup(orgs)
+
+		err := syncOrgRoles(user, &models.ExternalUserInfo{StaleOrgRole: &remove}, nil)
+
+		require.NoError(t, err)
+		assert.Empty(t, *updated)
+		require.Len(t, *removed, 2)
+		assert.Equal(t, int64(1), (*removed)[0].OrgId)
+		assert.Equal(t, int64(2), (*removed)[1].OrgId)
+		assert.Empty(t, *using)
+	})
+
+	t.Run("downgrades the user in the orgs without role", func(t *testing.T) {
+		updated, removed, _ := setup(orgs)
+
+		err := syncOrgRoles(user, &models.ExternalUserInfo{StaleOrgRole: &downgrade}, nil)
+
+		require.NoError(t, err)
+		assert.Empty(t, *removed)
+
+		// the viewer of the second org isn't raised to an editor
+		require.Len(t, *updated, 1)
+		assert.Equal(t, &models.UpdateOrgUserCommand{OrgId: 1, UserId: 1, Role: models.ROLE_EDITOR}, (*updated)[0])
+	})
+
+	t.Run("only downgrades the orgs without role", func(t *testing.T) {
+		updated, removed, using := setup(orgs)
+
+		err := syncOrgRoles(user, &models.ExternalUserInfo{
+			OrgRoles:     map[int64]models.RoleType{2: models.ROLE_VIEWER},
+			StaleOrgRole: &downgrade,
+		}, nil)
+
+		require.NoError(t, err)
+		assert.Empty(t, *removed)
+		require.Len(t, *updated, 1)
+		assert.Equal(t, int64(1), (*updated)[0].OrgId)
+		require.Len(t, *using, 1)
+		assert.Equal(t, int64(2), (*using)[0].OrgId)
+	})
+}
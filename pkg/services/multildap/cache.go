@@ -0,0 +1,190 @@
+package multildap
+
+import (
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// userCache caches the users found by User() and Login() for setting.LDAPUserCacheTTL,
+// so the repeated logins and auth proxy requests don't search the directory every time
+var userCache = newLookupCache()
+
+// CachedUser is a user found by a lookup or a login, served from the cache
+type CachedUser struct {
+	User     *models.ExternalUserInfo
+	Config   ldap.ServerConfig
+	CachedAt time.Time
+
+	config *ldap.ServerConfig
+}
+
+// cacheEntry is a user of the cache with the config of the server it was found on
+type cacheEntry struct {
+	user     *models.ExternalUserInfo
+	config   *ldap.ServerConfig
+	cachedAt time.Time
+}
+
+// lookupCache is an in-memory cache of the users, keyed like the lookups
+type lookupCache struct {
+	mu        sync.Mutex
+	entries   map[string]*cacheEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func newLookupCache() *lookupCache {
+	return &lookupCache{
+		entries: map[string]*cacheEntry{},
+		now:     time.Now,
+	}
+}
+
+// get returns the cached user, unless it expired or its server isn't one of the configs anymore.
+// The configs are replaced by a reload, so the users found with the previous config aren't served.
+func (cache *lookupCache) get(key string, configs []*ldap.ServerConfig) *CachedUser {
+	ttl := setting.LDAPUserCacheTTL
+	if ttl <= 0 {
+		return nil
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	entry, ok := cache.entries[key]
+	if !ok {
+		return nil
+	}
+
+	if cache.now().Sub(entry.cachedAt) >= ttl || !hasConfig(configs, entry.config) {
+		delete(cache.entries, key)
+		return nil
+	}
+
+	return &CachedUser{
+		User:     copyUser(entry.user),
+		Config:   *entry.config,
+		CachedAt: entry.cachedAt,
+		config:   entry.config,
+	}
+}
+
+// put caches the user found on the server, the expired users are swept at most once per TTL
+func (cache *lookupCache) put(key string, user *models.ExternalUserInfo, config *ldap.ServerConfig) {
+	ttl := setting.LDAPUserCacheTTL
+	if ttl <= 0 || config == nil {
+		return
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	now := cache.now()
+	if now.Sub(cache.lastSweep) >= ttl {
+		for key, entry := range cache.entries {
+			if now.Sub(entry.cachedAt) >= ttl {
+				delete(cache.entries, key)
+			}
+		}
+
+		cache.lastSweep = now
+	}
+
+	cache.entries[key] = &cacheEntry{user: copyUser(user), config: config, cachedAt: now}
+}
+
+// hasConfig checks if the config is one of the configs, by identity
+func hasConfig(configs []*ldap.ServerConfig, config *ldap.ServerConfig) bool {
+	for _, candidate := range configs {
+		if candidate == config {
+			return true
+		}
+	}
+
+	return false
+}
+
+// evict removes the user from the cache
+func (cache *lookupCache) evict(key string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	delete(cache.entries, key)
+}
+
+// copyUser copies the user, down to its slices, maps and pointers, so the callers updating it, like the sync,
+// don't update the cache. The nil fields stay nil, they mean the field isn't synced.
+func copyUser(user *models.ExternalUserInfo) *models.ExternalUserInfo {
+	copied := *user
+
+	if user.Groups != nil {
+		copied.Groups = make([]string, len(user.Groups))
+		copy(copied.Groups, user.Groups)
+	}
+
+	if user.OrgRoles != nil {
+		copied.OrgRoles = make(map[int64]models.RoleType, len(user.OrgRoles))
+		for orgID, role := range user.OrgRoles {
+			copied.OrgRoles[orgID] = role
+		}
+	}
+
+	if user.IsGrafanaAdmin != nil {
+		isGrafanaAdmin := *user.IsGrafanaAdmin
+		copied.IsGrafanaAdmin = &isGrafanaAdmin
+	}
+
+	if user.Teams != nil {
+		copied.Teams = make([]models.ExternalTeam, len(user.Teams))
+		copy(copied.Teams, user.Teams)
+	}
+
+	if user.FolderPermissions != nil {
+		copied.FolderPermissions = make([]models.ExternalFolderPermission, len(user.FolderPermissions))
+		copy(copied.FolderPermissions, user.FolderPermissions)
+	}
+
+	if user.StaleOrgRole != nil {
+		staleOrgRole := *user.StaleOrgRole
+		copied.StaleOrgRole = &staleOrgRole
+	}
+
+	if user.LockedFields != nil {
+		copied.LockedFields = make([]string, len(user.LockedFields))
+		copy(copied.LockedFields, user.LockedFields)
+	}
+
+	if user.RoleOverrides != nil {
+		copied.RoleOverrides = make([]models.ExternalRoleOverride, len(user.RoleOverrides))
+		copy(copied.RoleOverrides, user.RoleOverrides)
+	}
+
+	if user.Metadata != nil {
+		copied.Metadata = make(map[string]string, len(user.Metadata))
+		for key, value := range user.Metadata {
+			copied.Metadata[key] = value
+		}
+	}
+
+	if user.Preferences != nil {
+		preferences := *user.Preferences
+		copied.Preferences = &preferences
+	}
+
+	return &copied
+}
+
+// configOf returns the config of the server a user was found on
+func configOf(configs []*ldap.ServerConfig, found ldap.ServerConfig) *ldap.ServerConfig {
+	for _, config := range configs {
+		if config.Host == found.Host && config.Port == found.Port {
+			return config
+		}
+	}
+
+	return nil
+}
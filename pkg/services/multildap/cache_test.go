@@ -0,0 +1,201 @@
+package multildap
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLookupCache(t *testing.T) {
+	Convey("Lookup cache", t, func() {
+		ttl := setting.LDAPUserCacheTTL
+		setting.LDAPUserCacheTTL = time.Minute
+
+		clock := time.Date(2019, 10, 15, 10, 0, 0, 0, time.UTC)
+		cache := newLookupCache()
+		cache.now = func() time.Time { return clock }
+
+		Reset(func() {
+			setting.LDAPUserCacheTTL = ttl
+		})
+
+		config := &ldap.ServerConfig{Host: "10.0.0.1"}
+		configs := []*ldap.ServerConfig{config}
+		user := &models.ExternalUserInfo{
+			Login:    "killa",
+			OrgRoles: map[int64]models.RoleType{1: models.ROLE_EDITOR},
+		}
+
+		Convey("Should serve the user until it expires", func() {
+			cache.put("killa", user, config)
+
+			clock = clock.Add(59 * time.Second)
+			cached := cache.get("killa", configs)
+
+			So(cached, ShouldNotBeNil)
+			So(cached.User.Login, ShouldEqual, "killa")
+			So(cached.Config.Host, ShouldEqual, "10.0.0.1")
+			So(cached.CachedAt, ShouldEqual, clock.Add(-59*time.Second))
+
+			clock = clock.Add(time.Second)
+
+			So(cache.get("killa", configs), ShouldBeNil)
+			So(cache.entries, ShouldBeEmpty)
+		})
+
+		Convey("Should not share the groups, teams and roles of the user with the callers", func() {
+			user.Groups = []string{"cn=admins,dc=grafana,dc=org"}
+			user.Teams = []models.ExternalTeam{{OrgId: 1, TeamId: 1}}
+			cache.put("killa", user, config)
+
+			user.Groups[0] = "cn=editors,dc=grafana,dc=org"
+			user.Teams[0].TeamId = 2
+			user.OrgRoles[1] = models.ROLE_ADMIN
+
+			cached := cache.get("killa", configs)
+			So(cached.User.Groups, ShouldResemble, []string{"cn=admins,dc=grafana,dc=org"})
+			So(cached.User.Teams, ShouldResemble, []models.ExternalTeam{{OrgId: 1, TeamId: 1}})
+			So(cached.User.OrgRoles, ShouldResemble, map[int64]models.RoleType{1: models.ROLE_EDITOR})
+
+			cached.User.Groups[0] = "cn=viewers,dc=grafana,dc=org"
+			cached.User.Teams[0].TeamId = 3
+			cached.User.OrgRoles[1] = models.ROLE_VIEWER
+
+			cached = cache.get("killa", configs)
+			So(cached.User.Groups, ShouldResemble, []string{"cn=admins,dc=grafana,dc=org"})
+			So(cached.User.Teams, ShouldResemble, []models.ExternalTeam{{OrgId: 1, TeamId: 1}})
+			So(cached.User.OrgRoles, ShouldResemble, map[int64]models.RoleType{1: models.ROLE_EDITOR})
+		})
+
+		Convey("Should keep the fields which aren't synced nil", func() {
+			cache.put("killa", &models.ExternalUserInfo{Login: "killa"}, config)
+
+			cached := cache.get("killa", configs)
+			So(cached.User.Teams, ShouldBeNil)
+			So(cached.User.OrgRoles, ShouldBeNil)
+			So(cached.User.IsGrafanaAdmin, ShouldBeNil)
+		})
+
+		Convey("Should not serve the user found with a reloaded config", func() {
+			cache.put("killa", user, config)
+
+			reloaded := []*ldap.ServerConfig{{Host: "10.0.0.1"}}
+
+			So(cache.get("killa", reloaded), ShouldBeNil)
+		})
+
+		Convey("Should not cache anything when disabled", func() {
+			setting.LDAPUserCacheTTL = 0
+			cache.put("killa", user, config)
+
+			So(cache.entries, ShouldBeEmpty)
+			So(cache.get("killa", configs), ShouldBeNil)
+		})
+
+		Convey("Should not share the cached users with the callers", func() {
+			cache.put("killa", user, config)
+			user.OrgRoles[1] = models.ROLE_ADMIN
+
+			cached := cache.get("killa", configs)
+			cached.User.OrgRoles[2] = models.ROLE_VIEWER
+
+			cached = cache.get("killa", configs)
+			So(cached.User.OrgRoles, ShouldResemble, map[int64]models.RoleType{1: models.ROLE_EDITOR})
+		})
+
+		Convey("Should sweep the expired users when caching", func() {
+			cache.put("killa", user, config)
+
+			clock = clock.Add(time.Minute)
+			cache.put("gorilla", &models.ExternalUserInfo{Login: "gorilla"}, config)
+
+			So(cache.entries, ShouldHaveLength, 1)
+			So(cache.entries, ShouldContainKey, "gorilla")
+		})
+	})
+
+	Convey("Cached lookups", t, func() {
+		ttl := setting.LDAPUserCacheTTL
+		setting.LDAPUserCacheTTL = time.Minute
+
+		userCache = newLookupCache()
+		connections = newPool()
+		replicas = newReplicaSet()
+
+		Reset(func() {
+			setting.LDAPUserCacheTTL = ttl
+			userCache = newLookupCache()
+			connections = newPool()
+			teardown()
+		})
+
+		Convey("Should not search the cached user again", func() {
+			mock := setup()
+			mock.usersFirstReturn = []*models.ExternalUserInfo{{Login: "killa"}}
+
+			multi := New([]*ldap.ServerConfig{{Host: "10.0.0.1"}})
+
+			_, _, err := multi.User("killa")
+			So(err, ShouldBeNil)
+
+			user, config, err := multi.User("killa")
+			So(err, ShouldBeNil)
+			So(user.Login, ShouldEqual, "killa")
+			So(config.Host, ShouldEqual, "10.0.0.1")
+			So(mock.usersCalledTimes, ShouldEqual, 1)
+			So(multi.CachedUser("killa"), ShouldNotBeNil)
+		})
+
+		Convey("Should log in the cached user by binding as it", func() {
+			mock := setup()
+			mock.loginReturn = &models.ExternalUserInfo{Login: "killa", AuthId: "cn=killa,dc=grafana,dc=org"}
+
+			multi := New([]*ldap.ServerConfig{{Host: "10.0.0.1"}})
+			query := &models.LoginUserQuery{Username: "killa", Password: "gorilla"}
+
+			_, err := multi.Login(query)
+			So(err, ShouldBeNil)
+
+			user, err := multi.Login(query)
+			So(err, ShouldBeNil)
+			So(user.Login, ShouldEqual, "killa")
+			So(mock.loginCalledTimes, ShouldEqual, 1)
+			So(mock.userBindCalledTimes, ShouldEqual, 1)
+
+			Convey("and search the user again when the bind is refused, the user may have moved", func() {
+				mock.userBindErrReturn = ErrInvalidCredentials
+				mock.loginReturn = &models.ExternalUserInfo{Login: "killa", AuthId: "cn=killa,ou=moved,dc=grafana,dc=org"}
+
+				user, err := multi.Login(query)
+				So(err, ShouldBeNil)
+				So(user.AuthId, ShouldEqual, "cn=killa,ou=moved,dc=grafana,dc=org")
+				So(mock.loginCalledTimes, ShouldEqual, 2)
+				So(multi.CachedUser("killa").User.AuthId, ShouldEqual, "cn=killa,ou=moved,dc=grafana,dc=org")
+			})
+
+			Convey("and reject the invalid credentials once searched again", func() {
+				mock.userBindErrReturn = ErrInvalidCredentials
+				mock.loginReturn = nil
+				mock.loginErrReturn = ErrInvalidCredentials
+
+				_, err := multi.Login(query)
+				So(err, ShouldEqual, ErrInvalidCredentials)
+				So(mock.loginCalledTimes, ShouldEqual, 2)
+				So(multi.CachedUser("killa"), ShouldBeNil)
+			})
+
+			Convey("and search the user again when the server can't tell", func() {
+				mock.userBindErrReturn = errors.New("Killa Gorilla")
+
+				_, err := multi.Login(query)
+				So(err, ShouldBeNil)
+				So(mock.loginCalledTimes, ShouldEqual, 2)
+			})
+		})
+	})
+}
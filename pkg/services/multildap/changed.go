@@ -0,0 +1,82 @@
+package multildap
+
+import (
+	"fmt"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+)
+
+// ChangedUsers gets the users changed since the given change markers from multiple LDAP servers, see ldap.Server.ChangedUsers.
+// The markers are keyed by the "host:port" of their server, as the update sequence numbers of Active Directory are specific to
+// each domain controller: a server without marker, like a replica which didn't answer the last time, returns all its users.
+// Every server must have a "change_marker" attribute, or none is searched and ldap.ErrChangeMarkerUnsupported is returned.
+// It returns the highest marker of each answering server, and true when the size limit of any of them truncated the users.
+func (multiples *MultiLDAP) ChangedUsers(markers map[string]string) (
+	[]*models.ExternalUserInfo, map[string]string, bool, error,
+) {
+	var result []*models.ExternalUserInfo
+	highest := map[string]string{}
+	truncatedResults := false
+
+	if len(multiples.configs) == 0 {
+		return nil, nil, false, ErrNoLDAPServers
+	}
+
+	for _, config := range multiples.configs {
+		if config.Attr.ChangeMarker == "" {
+			return nil, nil, false, ldap.ErrChangeMarkerUnsupported
+		}
+	}
+
+	answered := answeredGroups{}
+	var dialErr error
+	for _, config := range replicas.order(multiples.configs, false) {
+		if answered.skip(config) {
+			continue
+		}
+
+		server, release, err, bindErr := multiples.connect(config, &Timings{})
+
+		if err != nil {
+			// another replica of the group may answer
+			if config.ReplicaGroup != "" {
+				logDialFailure(err, config)
+				dialErr = err
+				continue
+			}
+
+			return nil, nil, false, err
+		}
+
+		defer release()
+		answered.add(config)
+		replicas.markUp(config)
+
+		if bindErr != nil {
+			return nil, nil, false, bindErr
+		}
+
+		key := ChangeMarkerKey(config)
+
+		users, marker, truncated, err := server.ChangedUsers(markers[key])
+		if err != nil {
+			return nil, nil, false, err
+		}
+
+		highest[key] = marker
+		truncatedResults = truncatedResults || truncated
+		result = append(result, users...)
+	}
+
+	if err := multiples.unansweredGroupsError(answered, dialErr); err != nil {
+		return nil, nil, false, err
+	}
+
+	return result, highest, truncatedResults, nil
+}
+
+// ChangeMarkerKey is the key of the change marker of the server, its "host:port"
+func ChangeMarkerKey(config *ldap.ServerConfig) string {
+	return fmt.Sprintf("%s:%d", config.Host, config.Port)
+}
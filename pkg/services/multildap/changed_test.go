@@ -0,0 +1,48 @@
+package multildap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+)
+
+func TestChangedUsers(t *testing.T) {
+	Convey("ChangedUsers()", t, func() {
+		Reset(teardown)
+
+		Convey("Should search each server since its own marker", func() {
+			mock := setup()
+			mock.allUsersReturn = []*models.ExternalUserInfo{{Login: "one"}}
+			mock.changedUsersMarker = "12345"
+
+			multi := New([]*ldap.ServerConfig{
+				{Host: "dc1", Port: 389, Attr: ldap.AttributeMap{ChangeMarker: "uSNChanged"}},
+				{Host: "dc2", Port: 389, Attr: ldap.AttributeMap{ChangeMarker: "uSNChanged"}},
+			})
+			users, highest, truncated, err := multi.ChangedUsers(map[string]string{"dc1:389": "12000"})
+
+			So(err, ShouldBeNil)
+			So(truncated, ShouldBeFalse)
+			So(users, ShouldHaveLength, 2)
+			So(mock.changedUsersMarkers, ShouldResemble, []string{"12000", ""})
+			So(highest, ShouldResemble, map[string]string{"dc1:389": "12345", "dc2:389": "12345"})
+			So(mock.closeCalledTimes, ShouldEqual, 2)
+		})
+
+		Convey("Should not search when a server has no change_marker attribute", func() {
+			mock := setup()
+
+			multi := New([]*ldap.ServerConfig{
+				{Attr: ldap.AttributeMap{ChangeMarker: "uSNChanged"}},
+				{},
+			})
+			_, _, _, err := multi.ChangedUsers(map[string]string{})
+
+			So(err, ShouldEqual, ldap.ErrChangeMarkerUnsupported)
+			So(mock.dialCalledTimes, ShouldEqual, 0)
+		})
+	})
+}
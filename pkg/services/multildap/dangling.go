@@ -0,0 +1,97 @@
+package multildap
+
+import (
+	"github.com/grafana/grafana/pkg/services/ldap"
+)
+
+// GroupMappingsCheck is the result of the lookup of the groups mapped by a server
+type GroupMappingsCheck struct {
+	Host      string
+	Port      int
+	Available bool
+	Error     error
+
+	// Missing lists the group mappings whose group DN doesn't exist in the directory
+	Missing []*ldap.GroupToOrgRole
+
+	// Unchecked lists the group mappings which can't be looked up: the patterns, see GroupToOrgRole.IsCheckable,
+	// and the groups which aren't DNs
+	Unchecked []*ldap.GroupToOrgRole
+}
+
+// DanglingGroupMappings looks up the group DNs mapped by every server in its directory, to find the stale mappings.
+// Each group DN is looked up once per server with a base scope search. The servers which can't be dialed
+// or bound with are reported with their error, and their mappings aren't checked.
+func (multiples *MultiLDAP) DanglingGroupMappings() ([]*GroupMappingsCheck, error) {
+	if len(multiples.configs) == 0 {
+		return nil, ErrNoLDAPServers
+	}
+
+	checks := []*GroupMappingsCheck{}
+	for _, config := range multiples.configs {
+		check := &GroupMappingsCheck{
+			Host:      config.Host,
+			Port:      config.Port,
+			Missing:   []*ldap.GroupToOrgRole{},
+			Unchecked: []*ldap.GroupToOrgRole{},
+		}
+		checks = append(checks, check)
+
+		server := newLDAP(config)
+		if err := server.Dial(); err != nil {
+			logDialFailure(err, config)
+			replicas.markDown(config)
+			check.Error = err
+			continue
+		}
+
+		defer server.Close()
+		replicas.markUp(config)
+		check.Available = true
+
+		if err := server.Bind(); err != nil {
+			check.Error = err
+			continue
+		}
+
+		if err := checkGroupMappings(server, config, check); err != nil {
+			check.Error = err
+		}
+	}
+
+	return checks, nil
+}
+
+// checkGroupMappings looks up the group DNs of the mappings, adding the missing ones to the check
+func checkGroupMappings(server ldap.IServer, config *ldap.ServerConfig, check *GroupMappingsCheck) error {
+	exists := map[string]bool{}
+
+	for _, group := range config.Groups {
+		if !group.IsCheckable() {
+			check.Unchecked = append(check.Unchecked, group)
+			continue
+		}
+
+		found, ok := exists[group.GroupDN]
+		if !ok {
+			var err error
+			found, err = server.GroupExists(group.GroupDN)
+			if err == ldap.ErrGroupNotDN {
+				check.Unchecked = append(check.Unchecked, group)
+				continue
+			}
+
+			if err != nil {
+				return err
+			}
+
+			exists[group.GroupDN] = found
+		}
+
+		if !found {
+			check.Missing = append(check.Missing, group)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package multildap
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+)
+
+func TestDanglingGroupMappings(t *testing.T) {
+	Convey("DanglingGroupMappings()", t, func() {
+		replicas = newReplicaSet()
+
+		admins := &ldap.GroupToOrgRole{GroupDN: "cn=admins,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_ADMIN}
+		oldAdmins := &ldap.GroupToOrgRole{GroupDN: "cn=old-admins,dc=grafana,dc=org", OrgID: 1, OrgRole: models.ROLE_ADMIN}
+		oldViewers := &ldap.GroupToOrgRole{GroupDN: "cn=old-admins,dc=grafana,dc=org", OrgID: 2, OrgRole: models.ROLE_VIEWER}
+		pattern := &ldap.GroupToOrgRole{GroupDN: "cn=proj-*", MatchType: ldap.GroupMatchGlob, OrgID: 2, OrgRole: models.ROLE_VIEWER}
+		everyone := &ldap.GroupToOrgRole{GroupDN: "*", OrgID: 3, OrgRole: models.ROLE_VIEWER}
+
+		Reset(func() {
+			teardown()
+		})
+
+		Convey("Should return error for absent config list", func() {
+			multi := New([]*ldap.ServerConfig{})
+			_, err := multi.DanglingGroupMappings()
+
+			So(err, ShouldEqual, ErrNoLDAPServers)
+		})
+
+		Convey("Should list the mappings of the missing groups", func() {
+			mock := setup()
+
+			lookups := []string{}
+			mock.groupExistsProvider = func(dn string) (bool, error) {
+				lookups = append(lookups, dn)
+				return dn == admins.GroupDN, nil
+			}
+
+			multi := New([]*ldap.ServerConfig{
+				{Host: "10.0.0.1", Groups: []*ldap.GroupToOrgRole{admins, oldAdmins, oldViewers, pattern, everyone}},
+			})
+			checks, err := multi.DanglingGroupMappings()
+
+			So(err, ShouldBeNil)
+			So(checks, ShouldHaveLength, 1)
+			So(checks[0].Available, ShouldBeTrue)
+			So(checks[0].Error, ShouldBeNil)
+			So(checks[0].Missing, ShouldResemble, []*ldap.GroupToOrgRole{oldAdmins, oldViewers})
+			So(checks[0].Unchecked, ShouldResemble, []*ldap.GroupToOrgRole{pattern, everyone})
+			So(lookups, ShouldResemble, []string{admins.GroupDN, oldAdmins.GroupDN})
+			So(mock.bindCalledTimes, ShouldEqual, 1)
+		})
+
+		Convey("Should not check the groups which aren't DNs", func() {
+			mock := setup()
+			mock.groupExistsProvider = func(dn string) (bool, error) {
+				return false, ldap.ErrGroupNotDN
+			}
+
+			posix := &ldap.GroupToOrgRole{GroupDN: "admins", OrgID: 1, OrgRole: models.ROLE_ADMIN}
+
+			multi := New([]*ldap.ServerConfig{
+				{Host: "10.0.0.1", Groups: []*ldap.GroupToOrgRole{posix}},
+			})
+			checks, err := multi.DanglingGroupMappings()
+
+			So(err, ShouldBeNil)
+			So(checks[0].Missing, ShouldBeEmpty)
+			So(checks[0].Unchecked, ShouldResemble, []*ldap.GroupToOrgRole{posix})
+		})
+
+		Convey("Should report the servers which can't be checked", func() {
+			newLDAP = func(config *ldap.ServerConfig) ldap.IServer {
+				mock := &MockLDAP{
+					groupExistsProvider: func(dn string) (bool, error) {
+						return false, nil
+					},
+				}
+
+				switch config.Host {
+				case "10.0.0.1":
+					mock.dialErrReturn = errors.New("Dial error")
+				case "10.0.0.2":
+					mock.bindErrReturn = errors.New("Bind error")
+				}
+
+				return mock
+			}
+
+			multi := New([]*ldap.ServerConfig{
+				{Host: "10.0.0.1", Groups: []*ldap.GroupToOrgRole{oldAdmins}},
+				{Host: "10.0.0.2", Groups: []*ldap.GroupToOrgRole{oldAdmins}},
+				{Host: "10.0.0.3", Groups: []*ldap.GroupToOrgRole{oldAdmins}},
+			})
+			checks, err := multi.DanglingGroupMappings()
+
+			So(err, ShouldBeNil)
+			So(checks, ShouldHaveLength, 3)
+
+			So(checks[0].Available, ShouldBeFalse)
+			So(checks[0].Error.Error(), ShouldEqual, "Dial error")
+			So(checks[0].Missing, ShouldBeEmpty)
+
+			So(checks[1].Available, ShouldBeTrue)
+			So(checks[1].Error.Error(), ShouldEqual, "Bind error")
+			So(checks[1].Missing, ShouldBeEmpty)
+
+			So(checks[2].Available, ShouldBeTrue)
+			So(checks[2].Error, ShouldBeNil)
+			So(checks[2].Missing, ShouldResemble, []*ldap.GroupToOrgRole{oldAdmins})
+		})
+
+		Convey("Should report the failed lookups", func() {
+			mock := setup()
+			mock.groupExistsProvider = func(dn string) (bool, error) {
+				return false, errors.New("Search error")
+			}
+
+			multi := New([]*ldap.ServerConfig{
+				{Host: "10.0.0.1", Groups: []*ldap.GroupToOrgRole{oldAdmins}},
+			})
+			checks, err := multi.DanglingGroupMappings()
+
+			So(err, ShouldBeNil)
+			So(checks[0].Error.Error(), ShouldEqual, "Search error")
+		})
+	})
+}
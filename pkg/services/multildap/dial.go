@@ -0,0 +1,85 @@
+package multildap
+
+import (
+	"crypto/x509"
+	"net"
+	"os"
+	"syscall"
+
+	goldap "gopkg.in/ldap.v3"
+)
+
+// Categories of the errors dialing a server, reported by Ping
+const (
+	// DialErrorDNS is the category of a hostname which couldn't be resolved
+	DialErrorDNS = "dns"
+
+	// DialErrorRefused is the category of a resolved host refusing the connection, nothing listens on the port
+	DialErrorRefused = "connection_refused"
+
+	// DialErrorTimeout is the category of a connection which timed out
+	DialErrorTimeout = "timeout"
+
+	// DialErrorCertificate is the category of a certificate of the server which couldn't be verified,
+	// for example an expired one
+	DialErrorCertificate = "certificate"
+
+	// DialErrorOther is the category of the other errors, like a failed TLS handshake
+	DialErrorOther = "other"
+)
+
+// classifyDialError returns the category of the error dialing a server, see the DialError* categories.
+// The hostname is also returned when it couldn't be resolved.
+func classifyDialError(err error) (string, string) {
+	for err != nil {
+		switch e := err.(type) {
+		case *net.DNSError:
+			return DialErrorDNS, e.Name
+		case *goldap.Error:
+			err = e.Err
+		case *net.OpError:
+			if e.Timeout() {
+				return DialErrorTimeout, ""
+			}
+			err = e.Err
+		case *os.SyscallError:
+			err = e.Err
+		case x509.CertificateInvalidError, x509.HostnameError, x509.UnknownAuthorityError:
+			return DialErrorCertificate, ""
+		case syscall.Errno:
+			if e == syscall.ECONNREFUSED {
+				return DialErrorRefused, ""
+			}
+			return DialErrorOther, ""
+		default:
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				return DialErrorTimeout, ""
+			}
+			return DialErrorOther, ""
+		}
+	}
+
+	return DialErrorOther, ""
+}
+
+// dialErrorCertificate returns the certificate of the server the error of the dial refused, if any
+func dialErrorCertificate(err error) *x509.Certificate {
+	for err != nil {
+		switch e := err.(type) {
+		case *goldap.Error:
+			err = e.Err
+		case *net.OpError:
+			err = e.Err
+		case x509.CertificateInvalidError:
+			return e.Cert
+		case x509.HostnameError:
+			return e.Certificate
+		case x509.UnknownAuthorityError:
+			return e.Cert
+		default:
+			return nil
+		}
+	}
+
+	return nil
+}
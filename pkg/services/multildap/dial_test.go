@@ -0,0 +1,124 @@
+package multildap
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	goldap "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/services/ldap"
+)
+
+func TestPingDialErrors(t *testing.T) {
+	Convey("Ping()", t, func() {
+		replicas = newReplicaSet()
+		newLDAP = ldap.New
+
+		Reset(func() {
+			teardown()
+		})
+
+		Convey("Should report the hostnames which can't be resolved", func() {
+			// the .invalid top-level domain never resolves (RFC 2606)
+			multi := New([]*ldap.ServerConfig{
+				{Host: "ldap.grafana.invalid", Port: 389},
+			})
+			statuses, err := multi.Ping()
+
+			So(err, ShouldBeNil)
+			So(statuses[0].Available, ShouldBeFalse)
+			So(statuses[0].Error, ShouldNotBeNil)
+			So(statuses[0].ErrorCategory, ShouldEqual, DialErrorDNS)
+			So(statuses[0].UnresolvedHost, ShouldEqual, "ldap.grafana.invalid")
+		})
+
+		Convey("Should report the closed ports as refused connections", func() {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			So(err, ShouldBeNil)
+			port := listener.Addr().(*net.TCPAddr).Port
+			listener.Close()
+
+			multi := New([]*ldap.ServerConfig{
+				{Host: "127.0.0.1", Port: port},
+			})
+			statuses, err := multi.Ping()
+
+			So(err, ShouldBeNil)
+			So(statuses[0].Available, ShouldBeFalse)
+			So(statuses[0].ErrorCategory, ShouldEqual, DialErrorRefused)
+			So(statuses[0].UnresolvedHost, ShouldBeEmpty)
+		})
+
+		Convey("Should report the certificate which couldn't be verified", func() {
+			mock := setup()
+			mock.dialErrReturn = goldap.NewError(goldap.ErrorNetwork, x509.CertificateInvalidError{
+				Cert: &x509.Certificate{
+					Subject:  pkix.Name{CommonName: "ldap.example.org"},
+					NotAfter: time.Now().Add(-time.Hour),
+				},
+				Reason: x509.Expired,
+			})
+
+			multi := New([]*ldap.ServerConfig{{Host: "10.0.0.1", Port: 636, UseSSL: true}})
+			statuses, err := multi.Ping()
+
+			So(err, ShouldBeNil)
+			So(statuses[0].Available, ShouldBeFalse)
+			So(statuses[0].ErrorCategory, ShouldEqual, DialErrorCertificate)
+			So(statuses[0].Certificate.Subject, ShouldEqual, "CN=ldap.example.org")
+			So(statuses[0].CertificateExpiring, ShouldBeTrue)
+		})
+
+		Convey("Should report the dial timeout exceeded", func() {
+			mock := setup()
+			mock.dialErrReturn = goldap.NewError(goldap.ErrorNetwork, &net.OpError{Op: "dial", Err: &timeoutError{}})
+
+			multi := New([]*ldap.ServerConfig{{Host: "10.0.0.1", DialTimeout: 5}})
+			statuses, err := multi.Ping()
+
+			So(err, ShouldBeNil)
+			So(statuses[0].Available, ShouldBeFalse)
+			So(statuses[0].ErrorCategory, ShouldEqual, DialErrorTimeout)
+			So(statuses[0].ExceededTimeout, ShouldEqual, TimeoutDial)
+		})
+
+		Convey("Should not classify the available servers", func() {
+			mock := setup()
+			mock.dialErrReturn = nil
+
+			multi := New([]*ldap.ServerConfig{{Host: "10.0.0.1"}})
+			statuses, err := multi.Ping()
+
+			So(err, ShouldBeNil)
+			So(statuses[0].Available, ShouldBeTrue)
+			So(statuses[0].ErrorCategory, ShouldBeEmpty)
+		})
+	})
+
+	Convey("classifyDialError()", t, func() {
+		Convey("Should classify the timeouts", func() {
+			category, host := classifyDialError(&net.OpError{Op: "dial", Err: &timeoutError{}})
+
+			So(category, ShouldEqual, DialErrorTimeout)
+			So(host, ShouldBeEmpty)
+		})
+
+		Convey("Should classify the other errors", func() {
+			category, _ := classifyDialError(errors.New("x509: certificate signed by unknown authority"))
+
+			So(category, ShouldEqual, DialErrorOther)
+		})
+	})
+}
+
+// timeoutError is a network error which timed out
+type timeoutError struct{}
+
+func (err *timeoutError) Error() string   { return "i/o timeout" }
+func (err *timeoutError) Timeout() bool   { return true }
+func (err *timeoutError) Temporary() bool { return true }
@@ -0,0 +1,70 @@
+package multildap
+
+import (
+	"github.com/grafana/grafana/pkg/services/ldap"
+)
+
+// GroupLookup is the lookup of a group DN in the directory of an LDAP server
+type GroupLookup struct {
+	Host      string
+	Port      int
+	Available bool
+	Error     error
+
+	// Checked is false when the group can't be looked up on the server, like the group names of the POSIX schema
+	Checked bool
+	Found   bool
+
+	// Config is the config of the server, whose group mappings apply to the group
+	Config *ldap.ServerConfig
+}
+
+// FindGroup looks up the group DN in the directory of every server, with a base scope search of the DN itself.
+// The servers which can't be dialed or bound with are reported with their error.
+func (multiples *MultiLDAP) FindGroup(dn string) ([]*GroupLookup, error) {
+	if len(multiples.configs) == 0 {
+		return nil, ErrNoLDAPServers
+	}
+
+	lookups := []*GroupLookup{}
+	for _, config := range multiples.configs {
+		lookup := &GroupLookup{
+			Host:   config.Host,
+			Port:   config.Port,
+			Config: config,
+		}
+		lookups = append(lookups, lookup)
+
+		server := newLDAP(config)
+		if err := server.Dial(); err != nil {
+			logDialFailure(err, config)
+			replicas.markDown(config)
+			lookup.Error = err
+			continue
+		}
+
+		defer server.Close()
+		replicas.markUp(config)
+		lookup.Available = true
+
+		if err := server.Bind(); err != nil {
+			lookup.Error = err
+			continue
+		}
+
+		found, err := server.GroupExists(dn)
+		if err == ldap.ErrGroupNotDN {
+			continue
+		}
+
+		if err != nil {
+			lookup.Error = err
+			continue
+		}
+
+		lookup.Checked = true
+		lookup.Found = found
+	}
+
+	return lookups, nil
+}
@@ -0,0 +1,104 @@
+package multildap
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/services/ldap"
+)
+
+func TestFindGroup(t *testing.T) {
+	Convey("FindGroup()", t, func() {
+		replicas = newReplicaSet()
+
+		Reset(func() {
+			teardown()
+		})
+
+		Convey("Should return error for absent config list", func() {
+			multi := New([]*ldap.ServerConfig{})
+			_, err := multi.FindGroup("cn=admins,dc=grafana,dc=org")
+
+			So(err, ShouldEqual, ErrNoLDAPServers)
+		})
+
+		Convey("Should look up the group on every server", func() {
+			newLDAP = func(config *ldap.ServerConfig) ldap.IServer {
+				return &MockLDAP{
+					groupExistsProvider: func(dn string) (bool, error) {
+						return config.Host == "10.0.0.1" && dn == "cn=admins,dc=grafana,dc=org", nil
+					},
+				}
+			}
+
+			configs := []*ldap.ServerConfig{{Host: "10.0.0.1"}, {Host: "10.0.0.2"}}
+
+			multi := New(configs)
+			lookups, err := multi.FindGroup("cn=admins,dc=grafana,dc=org")
+
+			So(err, ShouldBeNil)
+			So(lookups, ShouldHaveLength, 2)
+
+			So(lookups[0].Host, ShouldEqual, "10.0.0.1")
+			So(lookups[0].Available, ShouldBeTrue)
+			So(lookups[0].Checked, ShouldBeTrue)
+			So(lookups[0].Found, ShouldBeTrue)
+			So(lookups[0].Config, ShouldEqual, configs[0])
+
+			So(lookups[1].Checked, ShouldBeTrue)
+			So(lookups[1].Found, ShouldBeFalse)
+		})
+
+		Convey("Should not check the groups which aren't DNs", func() {
+			mock := setup()
+			mock.groupExistsProvider = func(dn string) (bool, error) {
+				return false, ldap.ErrGroupNotDN
+			}
+
+			multi := New([]*ldap.ServerConfig{{Host: "10.0.0.1"}})
+			lookups, err := multi.FindGroup("admins")
+
+			So(err, ShouldBeNil)
+			So(lookups[0].Available, ShouldBeTrue)
+			So(lookups[0].Checked, ShouldBeFalse)
+			So(lookups[0].Error, ShouldBeNil)
+		})
+
+		Convey("Should report the servers which can't be checked", func() {
+			newLDAP = func(config *ldap.ServerConfig) ldap.IServer {
+				mock := &MockLDAP{}
+
+				switch config.Host {
+				case "10.0.0.1":
+					mock.dialErrReturn = errors.New("Dial error")
+				case "10.0.0.2":
+					mock.bindErrReturn = errors.New("Bind error")
+				case "10.0.0.3":
+					mock.groupExistsProvider = func(dn string) (bool, error) {
+						return false, errors.New("Search error")
+					}
+				}
+
+				return mock
+			}
+
+			multi := New([]*ldap.ServerConfig{{Host: "10.0.0.1"}, {Host: "10.0.0.2"}, {Host: "10.0.0.3"}})
+			lookups, err := multi.FindGroup("cn=admins,dc=grafana,dc=org")
+
+			So(err, ShouldBeNil)
+			So(lookups, ShouldHaveLength, 3)
+
+			So(lookups[0].Available, ShouldBeFalse)
+			So(lookups[0].Error.Error(), ShouldEqual, "Dial error")
+
+			So(lookups[1].Available, ShouldBeTrue)
+			So(lookups[1].Error.Error(), ShouldEqual, "Bind error")
+			So(lookups[1].Checked, ShouldBeFalse)
+
+			So(lookups[2].Error.Error(), ShouldEqual, "Search error")
+			So(lookups[2].Checked, ShouldBeFalse)
+		})
+	})
+}
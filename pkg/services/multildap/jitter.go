@@ -0,0 +1,37 @@
+package multildap
+
+import (
+	"math/rand"
+	"time"
+)
+
+var (
+	// sleep and randomDuration are replaced in the tests
+	sleep = time.Sleep
+
+	// randomDuration returns a random duration in [0, max)
+	randomDuration = func(max time.Duration) time.Duration {
+		if max <= 0 {
+			return 0
+		}
+
+		return time.Duration(rand.Int63n(int64(max)))
+	}
+)
+
+// staggerOffsets returns when each of the n servers is pinged, from the start of Ping, so the pings of a fleet of
+// Grafana instances polling on the same cadence don't all hit the directory at once. The window is split in n slots,
+// the i-th server is pinged at a random time of the i-th slot. The offsets are all zero without window.
+func staggerOffsets(n int, window time.Duration) []time.Duration {
+	offsets := make([]time.Duration, n)
+	if window <= 0 || n == 0 {
+		return offsets
+	}
+
+	slot := window / time.Duration(n)
+	for i := range offsets {
+		offsets[i] = time.Duration(i)*slot + randomDuration(slot)
+	}
+
+	return offsets
+}
@@ -0,0 +1,87 @@
+package multildap
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestStaggeredPings(t *testing.T) {
+	Convey("staggerOffsets()", t, func() {
+		Convey("Should spread the offsets over the window, each in its slot", func() {
+			window := 3 * time.Second
+
+			for run := 0; run < 100; run++ {
+				offsets := staggerOffsets(3, window)
+
+				So(offsets, ShouldHaveLength, 3)
+				for i, offset := range offsets {
+					So(offset, ShouldBeGreaterThanOrEqualTo, time.Duration(i)*time.Second)
+					So(offset, ShouldBeLessThan, time.Duration(i+1)*time.Second)
+				}
+			}
+		})
+
+		Convey("Should randomize the offsets", func() {
+			seen := map[time.Duration]bool{}
+			for run := 0; run < 10; run++ {
+				seen[staggerOffsets(1, time.Minute)[0]] = true
+			}
+
+			So(len(seen), ShouldBeGreaterThan, 1)
+		})
+
+		Convey("Should not offset without window", func() {
+			So(staggerOffsets(3, 0), ShouldResemble, []time.Duration{0, 0, 0})
+		})
+	})
+
+	Convey("Ping()", t, func() {
+		window := setting.LDAPJitterWindow
+		replicas = newReplicaSet()
+
+		var waits []time.Duration
+		sleep = func(d time.Duration) {
+			waits = append(waits, d)
+		}
+
+		Reset(func() {
+			setting.LDAPJitterWindow = window
+			sleep = time.Sleep
+			teardown()
+		})
+
+		configs := []*ldap.ServerConfig{{Host: "10.0.0.1"}, {Host: "10.0.0.2"}, {Host: "10.0.0.3"}}
+
+		Convey("Should spread the pings over the jitter window", func() {
+			setup()
+			setting.LDAPJitterWindow = 3 * time.Second
+
+			statuses, err := New(configs).Ping()
+
+			So(err, ShouldBeNil)
+			So(statuses, ShouldHaveLength, 3)
+
+			// the sleeps are skipped, so each server waits for its offset from the start
+			So(waits, ShouldHaveLength, 3)
+			for i, wait := range waits {
+				So(wait, ShouldBeGreaterThan, time.Duration(i)*time.Second-100*time.Millisecond)
+				So(wait, ShouldBeLessThan, time.Duration(i+1)*time.Second)
+			}
+		})
+
+		Convey("Should ping right away without jitter window", func() {
+			setup()
+			setting.LDAPJitterWindow = 0
+
+			_, err := New(configs).Ping()
+
+			So(err, ShouldBeNil)
+			So(waits, ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,64 @@
+package multildap
+
+import (
+	"sync"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+)
+
+// userLookups deduplicates the concurrent lookups of the same user
+var userLookups = &lookupGroup{}
+
+// lookupCall is an in-flight user lookup
+type lookupCall struct {
+	wg sync.WaitGroup
+
+	user   *models.ExternalUserInfo
+	config ldap.ServerConfig
+	err    error
+}
+
+// lookupGroup makes sure there is only one in-flight lookup per key,
+// every other caller with the same key waits for and shares its result
+type lookupGroup struct {
+	mu    sync.Mutex
+	calls map[string]*lookupCall
+}
+
+// do executes the lookup unless the one with the same key is already in-flight
+func (group *lookupGroup) do(
+	key string,
+	lookup func() (*models.ExternalUserInfo, ldap.ServerConfig, error),
+) (*models.ExternalUserInfo, ldap.ServerConfig, error) {
+	group.mu.Lock()
+	if group.calls == nil {
+		group.calls = map[string]*lookupCall{}
+	}
+
+	if call, ok := group.calls[key]; ok {
+		group.mu.Unlock()
+		call.wg.Wait()
+
+		return call.user, call.config, call.err
+	}
+
+	call := &lookupCall{}
+	call.wg.Add(1)
+	group.calls[key] = call
+	group.mu.Unlock()
+
+	// Clear the in-flight entry even if the lookup panics,
+	// so the following lookups are not blocked forever
+	defer func() {
+		group.mu.Lock()
+		delete(group.calls, key)
+		group.mu.Unlock()
+
+		call.wg.Done()
+	}()
+
+	call.user, call.config, call.err = lookup()
+
+	return call.user, call.config, call.err
+}
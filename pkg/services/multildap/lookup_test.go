@@ -0,0 +1,87 @@
+package multildap
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLookupGroup(t *testing.T) {
+	Convey("lookupGroup", t, func() {
+		Convey("Should share a single lookup between concurrent callers", func() {
+			group := &lookupGroup{}
+			release := make(chan struct{})
+
+			var calls int32
+			lookup := func() (*models.ExternalUserInfo, ldap.ServerConfig, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+
+				return &models.ExternalUserInfo{Login: "killa"}, ldap.ServerConfig{Host: "10.0.0.1"}, nil
+			}
+
+			const callers = 10
+			users := make([]*models.ExternalUserInfo, callers)
+
+			var wg sync.WaitGroup
+			for i := 0; i < callers; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					users[i], _, _ = group.do("killa", lookup)
+				}(i)
+			}
+
+			// Give all of the callers a chance to join the in-flight lookup
+			time.Sleep(50 * time.Millisecond)
+			close(release)
+			wg.Wait()
+
+			So(atomic.LoadInt32(&calls), ShouldEqual, 1)
+			for _, user := range users {
+				So(user.Login, ShouldEqual, "killa")
+			}
+			So(group.calls, ShouldBeEmpty)
+		})
+
+		Convey("Should share the error and clear the in-flight lookup afterwards", func() {
+			group := &lookupGroup{}
+			expected := errors.New("Killa Gorilla")
+
+			_, _, err := group.do("killa", func() (*models.ExternalUserInfo, ldap.ServerConfig, error) {
+				return nil, ldap.ServerConfig{}, expected
+			})
+
+			So(err, ShouldEqual, expected)
+			So(group.calls, ShouldBeEmpty)
+
+			user, _, err := group.do("killa", func() (*models.ExternalUserInfo, ldap.ServerConfig, error) {
+				return &models.ExternalUserInfo{Login: "killa"}, ldap.ServerConfig{}, nil
+			})
+
+			So(err, ShouldBeNil)
+			So(user.Login, ShouldEqual, "killa")
+		})
+
+		Convey("Should not share lookups with different keys", func() {
+			group := &lookupGroup{}
+
+			var calls int32
+			lookup := func() (*models.ExternalUserInfo, ldap.ServerConfig, error) {
+				atomic.AddInt32(&calls, 1)
+				return nil, ldap.ServerConfig{}, nil
+			}
+
+			group.do("one", lookup)
+			group.do("two", lookup)
+
+			So(atomic.LoadInt32(&calls), ShouldEqual, 2)
+		})
+	})
+}
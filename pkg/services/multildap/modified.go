@@ -0,0 +1,71 @@
+package multildap
+
+import (
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+)
+
+// ModifiedUsers gets the users modified since the given time from multiple LDAP servers, see ldap.Server.ModifiedUsers.
+// Every server must have an "updated_at" attribute, or none is searched and ldap.ErrUpdatedAtUnsupported is returned.
+// It also returns true when the size limit of any of the servers truncated the users.
+func (multiples *MultiLDAP) ModifiedUsers(since time.Time) (
+	[]*models.ExternalUserInfo, bool, error,
+) {
+	var result []*models.ExternalUserInfo
+	truncatedResults := false
+
+	if len(multiples.configs) == 0 {
+		return nil, false, ErrNoLDAPServers
+	}
+
+	for _, config := range multiples.configs {
+		if config.Attr.UpdatedAt == "" {
+			return nil, false, ldap.ErrUpdatedAtUnsupported
+		}
+	}
+
+	answered := answeredGroups{}
+	var dialErr error
+	for _, config := range replicas.order(multiples.configs, false) {
+		if answered.skip(config) {
+			continue
+		}
+
+		server, release, err, bindErr := multiples.connect(config, &Timings{})
+
+		if err != nil {
+			// another replica of the group may answer
+			if config.ReplicaGroup != "" {
+				logDialFailure(err, config)
+				dialErr = err
+				continue
+			}
+
+			return nil, false, err
+		}
+
+		defer release()
+		answered.add(config)
+		replicas.markUp(config)
+
+		if bindErr != nil {
+			return nil, false, bindErr
+		}
+
+		users, truncated, err := server.ModifiedUsers(since)
+		if err != nil {
+			return nil, false, err
+		}
+
+		truncatedResults = truncatedResults || truncated
+		result = append(result, users...)
+	}
+
+	if err := multiples.unansweredGroupsError(answered, dialErr); err != nil {
+		return nil, false, err
+	}
+
+	return result, truncatedResults, nil
+}
@@ -0,0 +1,49 @@
+package multildap
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+)
+
+func TestModifiedUsers(t *testing.T) {
+	Convey("ModifiedUsers()", t, func() {
+		since := time.Date(2019, 10, 15, 0, 0, 0, 0, time.UTC)
+
+		Reset(teardown)
+
+		Convey("Should get the modified users from all of the servers", func() {
+			mock := setup()
+			mock.allUsersReturn = []*models.ExternalUserInfo{{Login: "one"}}
+
+			multi := New([]*ldap.ServerConfig{
+				{Attr: ldap.AttributeMap{UpdatedAt: "modifyTimestamp"}},
+				{Attr: ldap.AttributeMap{UpdatedAt: "whenChanged"}},
+			})
+			users, truncated, err := multi.ModifiedUsers(since)
+
+			So(err, ShouldBeNil)
+			So(truncated, ShouldBeFalse)
+			So(users, ShouldHaveLength, 2)
+			So(mock.modifiedUsersSince, ShouldResemble, []time.Time{since, since})
+			So(mock.closeCalledTimes, ShouldEqual, 2)
+		})
+
+		Convey("Should not search when a server has no updated_at attribute", func() {
+			mock := setup()
+
+			multi := New([]*ldap.ServerConfig{
+				{Attr: ldap.AttributeMap{UpdatedAt: "modifyTimestamp"}},
+				{},
+			})
+			_, _, err := multi.ModifiedUsers(since)
+
+			So(err, ShouldEqual, ldap.ErrUpdatedAtUnsupported)
+			So(mock.dialCalledTimes, ShouldEqual, 0)
+		})
+	})
+}
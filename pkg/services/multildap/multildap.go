@@ -2,9 +2,13 @@ package multildap
 
 import (
 	"errors"
+	"fmt"
+	"time"
 
+	"github.com/grafana/grafana/pkg/infra/log"
 	"github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/setting"
 )
 
 // GetConfig gets LDAP config
@@ -25,15 +29,188 @@ var ErrCouldNotFindUser = ldap.ErrCouldNotFindUser
 // ErrNoLDAPServers is returned when there is no LDAP servers specified
 var ErrNoLDAPServers = errors.New("No LDAP servers are configured")
 
-// ErrDidNotFindUser if request for user is unsuccessful
+// ErrDidNotFindUser is returned when the servers which could be reached don't have the user,
+// at least one of them answered: ErrUnreachable is returned instead when none of them could be reached
 var ErrDidNotFindUser = errors.New("Did not find a user")
 
+// ErrUnreachable is returned when none of the LDAP servers could be reached
+var ErrUnreachable = errors.New("None of the LDAP servers are reachable")
+
+// logger for the multiple LDAP servers
+var logger = log.New("ldap")
+
 // ServerStatus holds the LDAP server status
 type ServerStatus struct {
 	Host      string
 	Port      int
 	Available bool
 	Error     error
+
+	// ErrorCategory classifies the error of an unavailable server, see the DialError* categories,
+	// UnresolvedHost is the hostname which couldn't be resolved for the DialErrorDNS category
+	ErrorCategory  string
+	UnresolvedHost string
+
+	// ExceededTimeout is the timeout of the server the ping exceeded, see the Timeout* constants,
+	// either dialing an unavailable server or binding with or searching an available one
+	ExceededTimeout string
+
+	// BindStatus, BindLatency and BindError report the bind with the available servers
+	BindStatus  string
+	BindLatency time.Duration
+	BindError   error
+
+	// BindMethod is the method of the bind, either simple or with the client certificate (SASL EXTERNAL)
+	BindMethod string
+
+	// SearchStatus, SearchLatency and SearchError report the search checking the bound connection can search the
+	// directory, see ldap.Server.CheckSearch. It's only run once the bind succeeded.
+	SearchStatus  string
+	SearchLatency time.Duration
+	SearchError   error
+
+	// Latency is how long the dial and the bind with the available servers took
+	Latency time.Duration
+
+	// TLSInsecure is set when the certificate of the server isn't verified, see ssl_skip_verify
+	TLSInsecure bool
+
+	// Certificate is the TLS certificate of the server, either the one of the connection or the one which couldn't
+	// be verified. CertificateExpiring is set when it expires within the cert_expiry_window of the [auth.ldap] section.
+	Certificate         *ldap.Certificate
+	CertificateExpiring bool
+
+	// QuarantinedUntil is the end of the quarantine of an unavailable server failing repeatedly, see quarantine_after
+	QuarantinedUntil time.Time
+}
+
+// Timeouts of the servers exceeded by the pings, named after their setting
+const (
+	// TimeoutDial is exceeded by a dial slower than the dial_timeout of the server, 60 seconds by default
+	TimeoutDial = "dial_timeout"
+
+	// TimeoutBind is exceeded by a bind slower than the bind_timeout of the server
+	TimeoutBind = "bind_timeout"
+
+	// TimeoutSearch is exceeded by a search slower than the search_timeout of the server
+	TimeoutSearch = "search_timeout"
+)
+
+// Statuses of the bind with an available server
+const (
+	// BindStatusOK is the status of a successful bind
+	BindStatusOK = "ok"
+
+	// BindStatusTimeout is the status of a bind slower than the bind_timeout of the server
+	BindStatusTimeout = "timeout"
+
+	// BindStatusFailed is the status of a bind which failed, for example with invalid credentials
+	BindStatusFailed = "failed"
+)
+
+// Statuses of the search checking the bound connection
+const (
+	// SearchStatusOK is the status of a successful search
+	SearchStatusOK = "ok"
+
+	// SearchStatusTimeout is the status of a search slower than the search_timeout of the server
+	SearchStatusTimeout = "timeout"
+
+	// SearchStatusFailed is the status of a search which failed, for example refused to a service account
+	// whose password expired
+	SearchStatusFailed = "failed"
+)
+
+// Timings holds the time spent in each step of a user lookup, summed over the servers
+type Timings struct {
+	Connect time.Duration
+	Bind    time.Duration
+	Search  time.Duration
+}
+
+// ServerAttempt is the outcome of a user lookup on one of the servers, see the Attempt* outcomes
+type ServerAttempt struct {
+	Host    string
+	Port    int
+	Outcome string
+	Error   error
+
+	// ReplicaGroup is the replica group of the server, empty for a standalone server
+	ReplicaGroup string
+
+	// MatchCount is the number of entries matched by the user search, more than one means the search filter is too loose
+	MatchCount int
+
+	// SearchFilter is the filter of the user search, empty when the server wasn't searched
+	SearchFilter string
+}
+
+// Outcomes of the lookup of a user on a server
+const (
+	// AttemptFound is the outcome of the server the user was found on
+	AttemptFound = "found"
+
+	// AttemptNotFound is the outcome of a server which doesn't know the user, the next server is tried
+	AttemptNotFound = "not_found"
+
+	// AttemptUnreachable is the outcome of a server which couldn't be dialed, the next server is tried
+	AttemptUnreachable = "unreachable"
+
+	// AttemptSkipped is the outcome of a replica skipped because another replica of its group answered
+	AttemptSkipped = "skipped"
+
+	// AttemptBindFailed is the outcome of a failed bind, which ends the lookup
+	AttemptBindFailed = "bind_failed"
+
+	// AttemptSearchFailed is the outcome of a failed search, which ends the lookup
+	AttemptSearchFailed = "search_failed"
+
+	// AttemptAmbiguous is the outcome of a search matching several entries refused by the ambiguous_users policy,
+	// which ends the lookup
+	AttemptAmbiguous = "ambiguous"
+)
+
+// answered tells whether the server answered the lookup, whether it found the user or not
+func (attempt *ServerAttempt) answered() bool {
+	switch attempt.Outcome {
+	case AttemptFound, AttemptNotFound, AttemptAmbiguous, AttemptSkipped:
+		return true
+	}
+
+	return false
+}
+
+// UnansweredServers returns the servers which didn't answer the lookup, like an unreachable one, by their "host:port",
+// or by the name of their replica group when none of its replicas answered. A lookup which didn't find the user only
+// tells the user is missing from LDAP when every server answered: the user may be on an unreachable server.
+func UnansweredServers(attempts []*ServerAttempt) []string {
+	answeredGroups := map[string]bool{}
+	for _, attempt := range attempts {
+		if attempt.ReplicaGroup != "" && attempt.answered() {
+			answeredGroups[attempt.ReplicaGroup] = true
+		}
+	}
+
+	unanswered := []string{}
+	seen := map[string]bool{}
+
+	for _, attempt := range attempts {
+		if attempt.answered() || answeredGroups[attempt.ReplicaGroup] {
+			continue
+		}
+
+		server := attempt.ReplicaGroup
+		if server == "" {
+			server = fmt.Sprintf("%s:%d", attempt.Host, attempt.Port)
+		}
+
+		if !seen[server] {
+			seen[server] = true
+			unanswered = append(unanswered, server)
+		}
+	}
+
+	return unanswered
 }
 
 // IMultiLDAP is interface for MultiLDAP
@@ -43,6 +220,10 @@ type IMultiLDAP interface {
 		*models.ExternalUserInfo, error,
 	)
 
+	LoginWithTrace(query *models.LoginUserQuery) (
+		*models.ExternalUserInfo, ldap.ServerConfig, *ldap.Trace, error,
+	)
+
 	Users(logins []string) (
 		[]*models.ExternalUserInfo, error,
 	)
@@ -50,11 +231,56 @@ type IMultiLDAP interface {
 	User(login string) (
 		*models.ExternalUserInfo, ldap.ServerConfig, error,
 	)
+
+	UserWithTimings(login string) (
+		*models.ExternalUserInfo, ldap.ServerConfig, *Timings, error,
+	)
+
+	UserWithAttempts(login string) (
+		*models.ExternalUserInfo, ldap.ServerConfig, []*ServerAttempt, error,
+	)
+
+	CachedUser(login string) *CachedUser
+
+	AllUsers() (
+		[]*models.ExternalUserInfo, bool, error,
+	)
+
+	MatchingUsers(query string) (
+		[]*models.ExternalUserInfo, bool, error,
+	)
+
+	UsersPage(cursor *UsersCursor, limit int) (
+		[]*models.ExternalUserInfo, *UsersCursor, error,
+	)
+
+	ModifiedUsers(since time.Time) (
+		[]*models.ExternalUserInfo, bool, error,
+	)
+
+	ChangedUsers(markers map[string]string) (
+		[]*models.ExternalUserInfo, map[string]string, bool, error,
+	)
+
+	UserPhoto(login string) ([]byte, error)
+
+	UserAttributes(login string) (map[string][]string, error)
+
+	DanglingGroupMappings() ([]*GroupMappingsCheck, error)
+
+	FindGroup(dn string) ([]*GroupLookup, error)
+
+	Search(host, baseDN, filter string, attributes []string, sizeLimit int) (*SearchResult, error)
+
+	Close()
 }
 
 // MultiLDAP is basic struct of LDAP authorization
 type MultiLDAP struct {
 	configs []*ldap.ServerConfig
+
+	// session keeps the bound connections across the lookups, see NewSession
+	session *session
 }
 
 // New creates the new LDAP auth
@@ -65,113 +291,531 @@ func New(configs []*ldap.ServerConfig) IMultiLDAP {
 }
 
 // Ping dials each of the LDAP servers and returns their status. If the server is unavailable, it also returns the error.
+// The pings are spread over the jitter_window of the [auth.ldap] section, if any. The quarantined servers are dialed too,
+// a successful ping ends their quarantine.
 func (multiples *MultiLDAP) Ping() ([]*ServerStatus, error) {
 
 	if len(multiples.configs) == 0 {
 		return nil, ErrNoLDAPServers
 	}
 
+	offsets := staggerOffsets(len(multiples.configs), setting.LDAPJitterWindow)
+	pingStart := time.Now()
+
 	serverStatuses := []*ServerStatus{}
-	for _, config := range multiples.configs {
+	for i, config := range multiples.configs {
+		if wait := offsets[i] - time.Since(pingStart); wait > 0 {
+			sleep(wait)
+		}
 
 		status := &ServerStatus{}
 
 		status.Host = config.Host
 		status.Port = config.Port
+		status.TLSInsecure = config.IsTLSInsecure()
 
 		server := newLDAP(config)
+		dialStart := time.Now()
 		err := server.Dial()
 
 		if err == nil {
+			defer server.Close()
+
 			status.Available = true
 			serverStatuses = append(serverStatuses, status)
+			replicas.recordLatency(config, time.Since(dialStart))
+			replicas.markUp(config)
+
+			status.BindMethod = ldap.BindMethodSimple
+			if config.IsExternalBind() {
+				status.BindMethod = ldap.BindMethodSASLExternal
+			}
+
+			start := time.Now()
+			err = server.Bind()
+			status.BindLatency = time.Since(start)
+			status.BindStatus, status.BindError = bindStatus(err)
+			if status.BindStatus == BindStatusTimeout {
+				status.ExceededTimeout = TimeoutBind
+			}
+			status.Latency = time.Since(dialStart)
+			status.Certificate = server.Certificate()
+
+			if status.BindStatus == BindStatusOK {
+				start = time.Now()
+				err = server.CheckSearch()
+				status.SearchLatency = time.Since(start)
+				status.SearchStatus, status.SearchError = searchStatus(err)
+				if status.SearchStatus == SearchStatusTimeout {
+					status.ExceededTimeout = TimeoutSearch
+				}
+			}
 		} else {
 			status.Available = false
 			status.Error = err
+			status.ErrorCategory, status.UnresolvedHost = classifyDialError(err)
+			if status.ErrorCategory == DialErrorTimeout {
+				status.ExceededTimeout = TimeoutDial
+			}
+			if cert := dialErrorCertificate(err); cert != nil {
+				status.Certificate = ldap.NewCertificate(cert)
+			}
 			serverStatuses = append(serverStatuses, status)
+			replicas.markDown(config)
+			status.QuarantinedUntil = replicas.quarantinedUntil(config)
 		}
 
-		defer server.Close()
+		if status.Certificate != nil {
+			status.CertificateExpiring = status.Certificate.ExpiresWithin(setting.LDAPCertExpiryWindow)
+		}
 	}
 
 	return serverStatuses, nil
 }
 
+// bindStatus classifies the result of a bind, a slow bind is reported distinctly from the failed ones
+func bindStatus(err error) (string, error) {
+	switch {
+	case err == nil:
+		return BindStatusOK, nil
+	case err == ldap.ErrBindTimeout:
+		return BindStatusTimeout, err
+	default:
+		return BindStatusFailed, err
+	}
+}
+
+// searchStatus classifies the result of the search check, a slow search is reported distinctly from the failed ones
+func searchStatus(err error) (string, error) {
+	switch {
+	case err == nil:
+		return SearchStatusOK, nil
+	case err == ldap.ErrSearchTimeout:
+		return SearchStatusTimeout, err
+	default:
+		return SearchStatusFailed, err
+	}
+}
+
 // Login tries to log in the user in multiples LDAP
 func (multiples *MultiLDAP) Login(query *models.LoginUserQuery) (
 	*models.ExternalUserInfo, error,
 ) {
+	user, _, err := multiples.login(query, nil)
+
+	return user, err
+}
+
+// LoginWithTrace logs in the user like Login does, without creating a session.
+// It returns the server which logged in the user and the trace of the login steps, for debugging.
+func (multiples *MultiLDAP) LoginWithTrace(query *models.LoginUserQuery) (
+	*models.ExternalUserInfo, ldap.ServerConfig, *ldap.Trace, error,
+) {
+	trace := ldap.NewTrace()
+	user, config, err := multiples.login(query, trace)
+
+	return user, config, trace, err
+}
+
+func (multiples *MultiLDAP) login(query *models.LoginUserQuery, trace *ldap.Trace) (
+	*models.ExternalUserInfo, ldap.ServerConfig, error,
+) {
 
 	if len(multiples.configs) == 0 {
-		return nil, ErrNoLDAPServers
+		return nil, ldap.ServerConfig{}, ErrNoLDAPServers
 	}
 
-	for _, config := range multiples.configs {
-		server := newLDAP(config)
-
-		if err := server.Dial(); err != nil {
-			return nil, err
+	// the traced logins are for debugging, they always search the user
+	key := multiples.lookupKey(query.Username)
+	if trace == nil {
+		if user, config, ok := multiples.cachedLogin(key, query); ok {
+			return user, config, nil
 		}
+	}
 
-		defer server.Close()
+	// the traced logins are for debugging, the steps of the servers aren't interleaved
+	if setting.LDAPParallelLookups && trace == nil && !multiples.searchAsUser() {
+		return multiples.parallelLogin(key, query)
+	}
 
-		user, err := server.Login(query)
-		if user != nil {
-			return user, nil
+	unreachable := 0
+	answered := answeredGroups{}
+	for _, config := range replicas.order(multiples.configs, true) {
+		if answered.skip(config) {
+			continue
 		}
 
-		// Continue if we couldn't find the user
-		if err == ErrCouldNotFindUser {
+		answer := loginOn(config, query, trace)
+
+		switch answer.outcome {
+		case AttemptUnreachable:
+			unreachable++
+			continue
+		case AttemptNotFound:
+			answered.add(config)
 			continue
 		}
 
-		if err != nil {
-			return nil, err
+		if answer.user != nil && trace == nil {
+			userCache.put(key, answer.user, config)
 		}
+
+		return answer.user, *config, answer.err
+	}
+
+	// We can't tell anything about the credentials if none of the servers answered
+	if unreachable == len(multiples.configs) {
+		return nil, ldap.ServerConfig{}, ErrUnreachable
 	}
 
 	// Return invalid credentials if we couldn't find the user anywhere
-	return nil, ErrInvalidCredentials
+	return nil, ldap.ServerConfig{}, ErrInvalidCredentials
+}
+
+// parallelLogin searches the user on all the servers at once, without its password, see fanOut. The password is
+// then only bound on the first server knowing the user, the one the serial logins would log the user in on.
+func (multiples *MultiLDAP) parallelLogin(key string, query *models.LoginUserQuery) (
+	*models.ExternalUserInfo, ldap.ServerConfig, error,
+) {
+	search := func(config *ldap.ServerConfig) *serverAnswer {
+		return multiples.lookupUser(config, query.Username)
+	}
+
+	found, unreachable := fanOut(replicas.order(multiples.configs, true), search, func(*serverAnswer) {})
+
+	if found == nil {
+		if unreachable == len(multiples.configs) {
+			return nil, ldap.ServerConfig{}, ErrUnreachable
+		}
+
+		return nil, ldap.ServerConfig{}, ErrInvalidCredentials
+	}
+
+	// the server failing to bind or to search ends the login, like the serial logins
+	if found.outcome != AttemptFound {
+		return nil, *found.config, found.err
+	}
+
+	answer := loginOn(found.config, query, nil)
+
+	switch answer.outcome {
+	case AttemptFound:
+		userCache.put(key, answer.user, found.config)
+	case AttemptNotFound:
+		return nil, ldap.ServerConfig{}, ErrInvalidCredentials
+	}
+
+	return answer.user, *found.config, answer.err
+}
+
+// searchAsUser checks if one of the servers can only be searched as the user logging in, the logins then ask
+// the servers one after the other, since the user can't be searched on it before binding its password
+func (multiples *MultiLDAP) searchAsUser() bool {
+	for _, config := range multiples.configs {
+		if config.SearchesAsUser() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// loginOn logs in the user on the server, the answer is AttemptFound with the user, AttemptNotFound
+// when the server doesn't know the user, AttemptUnreachable or AttemptBindFailed with the error
+func loginOn(config *ldap.ServerConfig, query *models.LoginUserQuery, trace *ldap.Trace) *serverAnswer {
+	answer := &serverAnswer{config: config, timings: &Timings{}}
+
+	// the user binds aren't checked by the health check, so the connection is bound again before its reuse
+	server, reused, err, _ := connections.get(config, answer.timings, false)
+	if reused {
+		trace.Add(config.Host, ldap.TraceStepConnect, fmt.Sprintf("Reuse a pooled connection to %s:%d", config.Host, config.Port), nil)
+	} else {
+		trace.Add(config.Host, ldap.TraceStepConnect, fmt.Sprintf("Connect to %s:%d", config.Host, config.Port), err)
+	}
+
+	if err != nil {
+		logDialFailure(err, config)
+		return answer.end(AttemptUnreachable, err)
+	}
+
+	defer connections.put(config, server, true)
+	replicas.markUp(config)
+
+	user, err := server.LoginWithTrace(query, trace)
+	if user != nil {
+		answer.user = user
+		return answer.end(AttemptFound, nil)
+	}
+
+	// Continue if we couldn't find the user
+	if err == nil || err == ErrCouldNotFindUser {
+		return answer.end(AttemptNotFound, nil)
+	}
+
+	return answer.end(AttemptBindFailed, err)
+}
+
+// cachedLogin logs in the cached user by binding as its DN on the server it was found on, without searching it again.
+// It isn't ok when the user isn't cached or the bind fails, the login then searches the user: the user may have been
+// moved to another DN or server since it was cached, so a refused bind evicts it from the cache.
+func (multiples *MultiLDAP) cachedLogin(key string, query *models.LoginUserQuery) (
+	*models.ExternalUserInfo, ldap.ServerConfig, bool,
+) {
+	// an empty password would be an unauthenticated bind, which most servers accept
+	if query.Password == "" {
+		return nil, ldap.ServerConfig{}, false
+	}
+
+	cached := userCache.get(key, multiples.configs)
+	if cached == nil {
+		return nil, ldap.ServerConfig{}, false
+	}
+
+	server, _, dialErr, _ := connections.get(cached.config, &Timings{}, false)
+	if dialErr != nil {
+		return nil, ldap.ServerConfig{}, false
+	}
+
+	// the connection is bound as the user, it's bound again before its reuse
+	defer connections.put(cached.config, server, true)
+
+	err := server.UserBind(cached.User.AuthId, query.Password)
+	if err == ErrInvalidCredentials {
+		userCache.evict(key)
+		return nil, ldap.ServerConfig{}, false
+	}
+
+	if err != nil {
+		return nil, ldap.ServerConfig{}, false
+	}
+
+	return cached.User, cached.Config, true
 }
 
 // User attempts to find an user by login/username by searching into all of the configured LDAP servers. Then, if the user is found it returns the user alongisde the server it was found.
+// Concurrent lookups of the same user share a single request to the LDAP server(s), and the users found are cached, see CachedUser.
 func (multiples *MultiLDAP) User(login string) (
 	*models.ExternalUserInfo,
 	ldap.ServerConfig,
 	error,
 ) {
+	key := multiples.lookupKey(login)
+	if cached := userCache.get(key, multiples.configs); cached != nil {
+		return cached.User, cached.Config, nil
+	}
+
+	return userLookups.do(key, func() (
+		*models.ExternalUserInfo,
+		ldap.ServerConfig,
+		error,
+	) {
+		user, config, err := multiples.user(login, &Timings{}, nil)
+		if err == nil {
+			userCache.put(key, user, configOf(multiples.configs, config))
+		}
+
+		return user, config, err
+	})
+}
+
+// CachedUser returns the user as cached by the previous lookups and logins, nil if it isn't.
+// The users are only cached for the user_cache_ttl setting, and until the config is reloaded.
+func (multiples *MultiLDAP) CachedUser(login string) *CachedUser {
+	return userCache.get(multiples.lookupKey(login), multiples.configs)
+}
+
+// UserWithTimings finds the user like User() does, measuring the time spent connecting, binding and searching.
+// It is meant for debugging, so it doesn't share the lookup with the concurrent ones.
+func (multiples *MultiLDAP) UserWithTimings(login string) (
+	*models.ExternalUserInfo,
+	ldap.ServerConfig,
+	*Timings,
+	error,
+) {
+	timings := &Timings{}
+	user, config, err := multiples.user(login, timings, nil)
+
+	return user, config, timings, err
+}
+
+// UserWithAttempts finds the user like User() does, listing the servers attempted in order with their outcome.
+// The servers following the one which ended the lookup aren't listed.
+func (multiples *MultiLDAP) UserWithAttempts(login string) (
+	*models.ExternalUserInfo,
+	ldap.ServerConfig,
+	[]*ServerAttempt,
+	error,
+) {
+	attempts := []*ServerAttempt{}
+	user, config, err := multiples.user(login, &Timings{}, &attempts)
+
+	return user, config, attempts, err
+}
+
+// lookupKey identifies the lookup of the login against the configured servers
+func (multiples *MultiLDAP) lookupKey(login string) string {
+	key := login
+	for _, config := range multiples.configs {
+		key = fmt.Sprintf("%s|%s:%d", key, config.Host, config.Port)
+	}
+
+	return key
+}
+
+// user is the actual lookup behind User(), the time spent in each step is added to the timings
+// and the servers attempted are appended to the optional attempts
+func (multiples *MultiLDAP) user(login string, timings *Timings, attempts *[]*ServerAttempt) (
+	*models.ExternalUserInfo,
+	ldap.ServerConfig,
+	error,
+) {
 
 	if len(multiples.configs) == 0 {
 		return nil, ldap.ServerConfig{}, ErrNoLDAPServers
 	}
 
-	search := []string{login}
-	for _, config := range multiples.configs {
-		server := newLDAP(config)
+	attempt := func(answer *serverAnswer) {
+		if attempts == nil {
+			return
+		}
 
-		if err := server.Dial(); err != nil {
-			return nil, *config, err
+		serverAttempt := &ServerAttempt{
+			Host:         answer.config.Host,
+			Port:         answer.config.Port,
+			Outcome:      answer.outcome,
+			Error:        answer.err,
+			ReplicaGroup: answer.config.ReplicaGroup,
+			MatchCount:   answer.matches,
 		}
 
-		defer server.Close()
+		switch answer.outcome {
+		case AttemptFound, AttemptNotFound, AttemptSearchFailed, AttemptAmbiguous:
+			serverAttempt.SearchFilter = ldap.UserSearchFilter(answer.config, []string{login})
+		}
 
-		if err := server.Bind(); err != nil {
-			return nil, *config, err
+		*attempts = append(*attempts, serverAttempt)
+	}
+
+	lookup := func(config *ldap.ServerConfig) *serverAnswer {
+		return multiples.lookupUser(config, login)
+	}
+
+	if setting.LDAPParallelLookups {
+		answer, unreachable := fanOut(replicas.order(multiples.configs, false), lookup, func(answer *serverAnswer) {
+			timings.add(answer.timings)
+			attempt(answer)
+		})
+
+		if answer != nil {
+			return answer.user, *answer.config, answer.err
 		}
 
-		users, err := server.Users(search)
-		if err != nil {
-			return nil, *config, err
+		if unreachable == len(multiples.configs) {
+			return nil, ldap.ServerConfig{}, ErrUnreachable
+		}
+
+		return nil, ldap.ServerConfig{}, ErrDidNotFindUser
+	}
+
+	unreachable := 0
+	answered := answeredGroups{}
+	for _, config := range replicas.order(multiples.configs, false) {
+		if answered.skip(config) {
+			attempt(&serverAnswer{config: config, outcome: AttemptSkipped})
+			continue
 		}
 
-		if len(users) != 0 {
-			return users[0], *config, nil
+		answer := lookup(config)
+		timings.add(answer.timings)
+		attempt(answer)
+
+		switch answer.outcome {
+		case AttemptUnreachable:
+			unreachable++
+			continue
+		case AttemptNotFound:
+			answered.add(config)
+			continue
 		}
+
+		return answer.user, *config, answer.err
+	}
+
+	if unreachable == len(multiples.configs) {
+		return nil, ldap.ServerConfig{}, ErrUnreachable
 	}
 
 	return nil, ldap.ServerConfig{}, ErrDidNotFindUser
 }
 
+// lookupUser searches the user by login on the server, the answer has one of the Attempt* outcomes
+func (multiples *MultiLDAP) lookupUser(config *ldap.ServerConfig, login string) *serverAnswer {
+	answer := &serverAnswer{config: config, timings: &Timings{}}
+
+	server, release, dialErr, err := multiples.connect(config, answer.timings)
+
+	if dialErr != nil {
+		logDialFailure(dialErr, config)
+		return answer.end(AttemptUnreachable, dialErr)
+	}
+
+	defer release()
+	replicas.markUp(config)
+
+	if err != nil {
+		return answer.end(AttemptBindFailed, err)
+	}
+
+	start := time.Now()
+	users, err := server.Users([]string{login})
+	answer.timings.Search += time.Since(start)
+
+	if err != nil {
+		return answer.end(AttemptSearchFailed, err)
+	}
+
+	answer.matches = len(users)
+
+	if len(users) > 1 {
+		logger.Warn(
+			"LDAP user search matched several entries",
+			"login", login,
+			"host", config.Host,
+			"count", len(users),
+		)
+	}
+
+	if len(users) == 0 {
+		return answer.end(AttemptNotFound, nil)
+	}
+
+	user, err := ldap.PickUser(users)
+	if err != nil {
+		return answer.end(AttemptAmbiguous, err)
+	}
+
+	answer.user = user
+	return answer.end(AttemptFound, nil)
+}
+
+// logDialFailure logs the failed attempt to dial the server and marks it down. The quarantined servers,
+// which aren't dialed, are already down.
+func logDialFailure(err error, config *ldap.ServerConfig) {
+	if err == ErrQuarantined {
+		logger.Debug("skipped the quarantined LDAP server", "host", config.Host, "port", config.Port)
+		return
+	}
+
+	replicas.markDown(config)
+
+	logger.Error(
+		"unable to dial LDAP server",
+		"host", config.Host,
+		"port", config.Port,
+		"error", err,
+	)
+}
+
 // Users gets users from multiple LDAP servers
 func (multiples *MultiLDAP) Users(logins []string) (
 	[]*models.ExternalUserInfo,
@@ -183,17 +827,32 @@ func (multiples *MultiLDAP) Users(logins []string) (
 		return nil, ErrNoLDAPServers
 	}
 
-	for _, config := range multiples.configs {
-		server := newLDAP(config)
+	answered := answeredGroups{}
+	var dialErr error
+	for _, config := range replicas.order(multiples.configs, false) {
+		if answered.skip(config) {
+			continue
+		}
+
+		server, release, err, bindErr := multiples.connect(config, &Timings{})
+
+		if err != nil {
+			// another replica of the group may answer
+			if config.ReplicaGroup != "" {
+				logDialFailure(err, config)
+				dialErr = err
+				continue
+			}
 
-		if err := server.Dial(); err != nil {
 			return nil, err
 		}
 
-		defer server.Close()
+		defer release()
+		answered.add(config)
+		replicas.markUp(config)
 
-		if err := server.Bind(); err != nil {
-			return nil, err
+		if bindErr != nil {
+			return nil, bindErr
 		}
 
 		users, err := server.Users(logins)
@@ -203,5 +862,101 @@ func (multiples *MultiLDAP) Users(logins []string) (
 		result = append(result, users...)
 	}
 
+	if err := multiples.unansweredGroupsError(answered, dialErr); err != nil {
+		return nil, err
+	}
+
 	return result, nil
 }
+
+// AllUsers gets all of the users from multiple LDAP servers.
+// It also returns true when the size limit of any of the servers truncated the users.
+func (multiples *MultiLDAP) AllUsers() (
+	[]*models.ExternalUserInfo,
+	bool,
+	error,
+) {
+	return multiples.listUsers(func(server ldap.IServer) ([]*models.ExternalUserInfo, bool, error) {
+		return server.AllUsers()
+	})
+}
+
+// MatchingUsers gets the users whose login matches the query from multiple LDAP servers,
+// "*" being a wildcard, i.e. "jo*". It also returns true when the size limit of any of the servers truncated the users.
+func (multiples *MultiLDAP) MatchingUsers(query string) (
+	[]*models.ExternalUserInfo,
+	bool,
+	error,
+) {
+	return multiples.listUsers(func(server ldap.IServer) ([]*models.ExternalUserInfo, bool, error) {
+		return server.MatchingUsers(query)
+	})
+}
+
+// listUsers lists the users of every server with the list func, once per replica group
+func (multiples *MultiLDAP) listUsers(list func(ldap.IServer) ([]*models.ExternalUserInfo, bool, error)) (
+	[]*models.ExternalUserInfo,
+	bool,
+	error,
+) {
+	var result []*models.ExternalUserInfo
+	truncatedResults := false
+
+	if len(multiples.configs) == 0 {
+		return nil, false, ErrNoLDAPServers
+	}
+
+	answered := answeredGroups{}
+	var dialErr error
+	for _, config := range replicas.order(multiples.configs, false) {
+		if answered.skip(config) {
+			continue
+		}
+
+		server := newLDAP(config)
+
+		if err := server.Dial(); err != nil {
+			// another replica of the group may answer
+			if config.ReplicaGroup != "" {
+				logDialFailure(err, config)
+				dialErr = err
+				continue
+			}
+
+			return nil, false, err
+		}
+
+		defer server.Close()
+		answered.add(config)
+		replicas.markUp(config)
+
+		if err := server.Bind(); err != nil {
+			return nil, false, err
+		}
+
+		users, truncated, err := list(server)
+		if err != nil {
+			return nil, false, err
+		}
+
+		truncatedResults = truncatedResults || truncated
+		result = append(result, users...)
+	}
+
+	if err := multiples.unansweredGroupsError(answered, dialErr); err != nil {
+		return nil, false, err
+	}
+
+	return result, truncatedResults, nil
+}
+
+// unansweredGroupsError returns the dial error when none of the replicas of a group could be dialed
+func (multiples *MultiLDAP) unansweredGroupsError(answered answeredGroups, dialErr error) error {
+	for _, config := range multiples.configs {
+		if config.ReplicaGroup != "" && !answered[config.ReplicaGroup] {
+			return dialErr
+		}
+	}
+
+	return nil
+}
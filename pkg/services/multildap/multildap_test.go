@@ -3,9 +3,11 @@ package multildap
 import (
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/setting"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -57,6 +59,198 @@ func TestMultiLDAP(t *testing.T) {
 				So(statuses[0].Port, ShouldEqual, 361)
 				So(statuses[0].Available, ShouldBeTrue)
 				So(statuses[0].Error, ShouldBeNil)
+				So(statuses[0].BindStatus, ShouldEqual, BindStatusOK)
+				So(statuses[0].BindError, ShouldBeNil)
+				So(statuses[0].BindMethod, ShouldEqual, ldap.BindMethodSimple)
+
+				teardown()
+			})
+
+			Convey("Should report the TLS certificates expiring soon", func() {
+				mock := setup()
+				mock.certificate = &ldap.Certificate{Subject: "CN=ldap.example.org", NotAfter: time.Now().Add(24 * time.Hour)}
+
+				window := setting.LDAPCertExpiryWindow
+				defer func() { setting.LDAPCertExpiryWindow = window }()
+
+				multi := New([]*ldap.ServerConfig{
+					{Host: "10.0.0.1", Port: 636, UseSSL: true},
+				})
+
+				setting.LDAPCertExpiryWindow = 48 * time.Hour
+				statuses, err := multi.Ping()
+
+				So(err, ShouldBeNil)
+				So(statuses[0].Certificate, ShouldEqual, mock.certificate)
+				So(statuses[0].CertificateExpiring, ShouldBeTrue)
+
+				setting.LDAPCertExpiryWindow = time.Hour
+				statuses, err = multi.Ping()
+
+				So(err, ShouldBeNil)
+				So(statuses[0].CertificateExpiring, ShouldBeFalse)
+
+				teardown()
+			})
+
+			Convey("Should report how long the dial and the bind took", func() {
+				mock := setup()
+				mock.dialDelay = 10 * time.Millisecond
+
+				multi := New([]*ldap.ServerConfig{
+					{Host: "10.0.0.1", Port: 361},
+				})
+
+				statuses, err := multi.Ping()
+
+				So(err, ShouldBeNil)
+				So(statuses[0].Latency, ShouldBeGreaterThanOrEqualTo, mock.dialDelay)
+				So(statuses[0].Latency, ShouldBeGreaterThanOrEqualTo, statuses[0].BindLatency)
+
+				teardown()
+			})
+
+			Convey("Should report the bind with the client certificate", func() {
+				mock := setup()
+
+				multi := New([]*ldap.ServerConfig{
+					{Host: "10.0.0.1", Port: 636, BindMethod: ldap.BindMethodSASLExternal},
+				})
+
+				statuses, err := multi.Ping()
+
+				So(err, ShouldBeNil)
+				So(mock.bindCalledTimes, ShouldEqual, 1)
+				So(statuses[0].BindStatus, ShouldEqual, BindStatusOK)
+				So(statuses[0].BindMethod, ShouldEqual, ldap.BindMethodSASLExternal)
+
+				teardown()
+			})
+
+			Convey("Should report the servers which don't verify the TLS certificate", func() {
+				setup()
+
+				multi := New([]*ldap.ServerConfig{
+					{Host: "10.0.0.1", Port: 636, UseSSL: true, SkipVerifySSL: true},
+					{Host: "10.0.0.2", Port: 636, UseSSL: true},
+					{Host: "10.0.0.3", Port: 389, SkipVerifySSL: true},
+				})
+
+				statuses, err := multi.Ping()
+
+				So(err, ShouldBeNil)
+				So(statuses[0].TLSInsecure, ShouldBeTrue)
+				So(statuses[1].TLSInsecure, ShouldBeFalse)
+				So(statuses[2].TLSInsecure, ShouldBeFalse)
+
+				teardown()
+			})
+
+			Convey("Should check the bound connection can search", func() {
+				mock := setup()
+
+				multi := New([]*ldap.ServerConfig{
+					{Host: "10.0.0.1", Port: 361},
+				})
+
+				statuses, err := multi.Ping()
+
+				So(err, ShouldBeNil)
+				So(mock.checkSearchCalledTimes, ShouldEqual, 1)
+				So(statuses[0].BindStatus, ShouldEqual, BindStatusOK)
+				So(statuses[0].SearchStatus, ShouldEqual, SearchStatusOK)
+				So(statuses[0].SearchError, ShouldBeNil)
+
+				teardown()
+			})
+
+			Convey("Should report a refused search distinctly from the bind", func() {
+				mock := setup()
+				expected := errors.New("Insufficient access")
+				mock.checkSearchErrReturn = expected
+
+				multi := New([]*ldap.ServerConfig{
+					{Host: "10.0.0.1", Port: 361},
+				})
+
+				statuses, err := multi.Ping()
+
+				So(err, ShouldBeNil)
+				So(statuses[0].Available, ShouldBeTrue)
+				So(statuses[0].BindStatus, ShouldEqual, BindStatusOK)
+				So(statuses[0].SearchStatus, ShouldEqual, SearchStatusFailed)
+				So(statuses[0].SearchError, ShouldEqual, expected)
+
+				mock.checkSearchErrReturn = ldap.ErrSearchTimeout
+
+				statuses, err = multi.Ping()
+
+				So(err, ShouldBeNil)
+				So(statuses[0].SearchStatus, ShouldEqual, SearchStatusTimeout)
+				So(statuses[0].ExceededTimeout, ShouldEqual, TimeoutSearch)
+
+				teardown()
+			})
+
+			Convey("Should not search after a failed bind", func() {
+				mock := setup()
+				mock.bindErrReturn = ldap.ErrInvalidCredentials
+
+				multi := New([]*ldap.ServerConfig{
+					{Host: "10.0.0.1", Port: 361},
+				})
+
+				statuses, err := multi.Ping()
+
+				So(err, ShouldBeNil)
+				So(mock.checkSearchCalledTimes, ShouldEqual, 0)
+				So(statuses[0].SearchStatus, ShouldBeEmpty)
+
+				teardown()
+			})
+
+			Convey("Should report a bind slower than the timeout distinctly from a failed one", func() {
+				mock := setup()
+				mock.bindErrReturn = ldap.ErrBindTimeout
+
+				multi := New([]*ldap.ServerConfig{
+					{Host: "10.0.0.1", Port: 361},
+				})
+
+				statuses, err := multi.Ping()
+
+				So(err, ShouldBeNil)
+				So(mock.bindCalledTimes, ShouldEqual, 1)
+				So(statuses[0].Available, ShouldBeTrue)
+				So(statuses[0].BindStatus, ShouldEqual, BindStatusTimeout)
+				So(statuses[0].BindError, ShouldEqual, ldap.ErrBindTimeout)
+				So(statuses[0].ExceededTimeout, ShouldEqual, TimeoutBind)
+
+				mock.bindErrReturn = ldap.ErrInvalidCredentials
+
+				statuses, err = multi.Ping()
+
+				So(err, ShouldBeNil)
+				So(statuses[0].BindStatus, ShouldEqual, BindStatusFailed)
+				So(statuses[0].BindError, ShouldEqual, ldap.ErrInvalidCredentials)
+				So(statuses[0].ExceededTimeout, ShouldBeEmpty)
+
+				teardown()
+			})
+
+			Convey("Should not bind with an unavailable server", func() {
+				mock := setup()
+				mock.dialErrReturn = errors.New("Dial error")
+
+				multi := New([]*ldap.ServerConfig{
+					{Host: "10.0.0.1", Port: 361},
+				})
+
+				statuses, err := multi.Ping()
+
+				So(err, ShouldBeNil)
+				So(mock.bindCalledTimes, ShouldEqual, 0)
+				So(statuses[0].BindStatus, ShouldBeEmpty)
 
 				teardown()
 			})
@@ -74,7 +268,7 @@ func TestMultiLDAP(t *testing.T) {
 				teardown()
 			})
 
-			Convey("Should return a dial error", func() {
+			Convey("Should return an unreachable error if none of the servers could be dialed", func() {
 				mock := setup()
 
 				expected := errors.New("Dial error")
@@ -86,8 +280,11 @@ func TestMultiLDAP(t *testing.T) {
 
 				_, err := multi.Login(&models.LoginUserQuery{})
 
+				So(mock.dialCalledTimes, ShouldEqual, 2)
+				So(mock.loginCalledTimes, ShouldEqual, 0)
+
 				So(err, ShouldBeError)
-				So(err, ShouldEqual, expected)
+				So(err, ShouldEqual, ErrUnreachable)
 
 				teardown()
 			})
@@ -171,6 +368,52 @@ func TestMultiLDAP(t *testing.T) {
 			})
 		})
 
+		Convey("LoginWithTrace()", func() {
+			Convey("Should trace the servers which couldn't be dialed", func() {
+				mock := setup()
+
+				mock.dialErrReturn = errors.New("Dial error")
+
+				multi := New([]*ldap.ServerConfig{
+					{Host: "10.0.0.1", Port: 389}, {Host: "10.0.0.2", Port: 389},
+				})
+				_, _, trace, err := multi.LoginWithTrace(&models.LoginUserQuery{})
+
+				So(err, ShouldEqual, ErrUnreachable)
+				So(trace.Steps, ShouldHaveLength, 2)
+				So(trace.Steps[0], ShouldResemble, ldap.TraceStep{
+					Server:  "10.0.0.1",
+					Step:    ldap.TraceStepConnect,
+					Message: "Connect to 10.0.0.1:389",
+					Error:   "Dial error",
+				})
+				So(trace.Steps[1].Server, ShouldEqual, "10.0.0.2")
+
+				teardown()
+			})
+
+			Convey("Should return the server which logged in the user", func() {
+				mock := setup()
+
+				mock.loginReturn = &models.ExternalUserInfo{
+					Login: "killa",
+				}
+
+				multi := New([]*ldap.ServerConfig{
+					{Host: "10.0.0.1"}, {Host: "10.0.0.2"},
+				})
+				user, config, trace, err := multi.LoginWithTrace(&models.LoginUserQuery{})
+
+				So(err, ShouldBeNil)
+				So(user.Login, ShouldEqual, "killa")
+				So(config.Host, ShouldEqual, "10.0.0.1")
+				So(trace.Steps[0].Step, ShouldEqual, ldap.TraceStepConnect)
+				So(trace.Steps[0].Success, ShouldBeTrue)
+
+				teardown()
+			})
+		})
+
 		Convey("User()", func() {
 			Convey("Should return error for absent config list", func() {
 				setup()
@@ -184,7 +427,7 @@ func TestMultiLDAP(t *testing.T) {
 				teardown()
 			})
 
-			Convey("Should return a dial error", func() {
+			Convey("Should return an unreachable error if none of the servers could be dialed", func() {
 				mock := setup()
 
 				expected := errors.New("Dial error")
@@ -196,8 +439,11 @@ func TestMultiLDAP(t *testing.T) {
 
 				_, _, err := multi.User("test")
 
+				So(mock.dialCalledTimes, ShouldEqual, 2)
+				So(mock.usersCalledTimes, ShouldEqual, 0)
+
 				So(err, ShouldBeError)
-				So(err, ShouldEqual, expected)
+				So(err, ShouldEqual, ErrUnreachable)
 
 				teardown()
 			})
@@ -266,6 +512,205 @@ func TestMultiLDAP(t *testing.T) {
 
 				teardown()
 			})
+
+			Convey("Should return the config of the server the user was found on", func() {
+				mock := setup()
+
+				mock.usersRestReturn = []*models.ExternalUserInfo{
+					{
+						Login: "test",
+					},
+				}
+
+				multi := New([]*ldap.ServerConfig{
+					{Host: "first", Attr: ldap.AttributeMap{Username: "uid", Email: "mail"}},
+					{Host: "second", Attr: ldap.AttributeMap{Username: "sAMAccountName", Email: "userPrincipalName"}},
+				})
+				user, config, err := multi.User("test")
+
+				So(mock.usersCalledTimes, ShouldEqual, 2)
+
+				So(err, ShouldBeNil)
+				So(user.Login, ShouldEqual, "test")
+				So(config.Host, ShouldEqual, "second")
+				So(config.Attr, ShouldResemble, ldap.AttributeMap{Username: "sAMAccountName", Email: "userPrincipalName"})
+
+				teardown()
+			})
+		})
+
+		Convey("UserWithTimings()", func() {
+			Convey("Should return the user with the timings", func() {
+				mock := setup()
+
+				mock.usersFirstReturn = []*models.ExternalUserInfo{
+					{
+						Login: "one",
+					},
+				}
+
+				multi := New([]*ldap.ServerConfig{
+					{}, {},
+				})
+				user, _, timings, err := multi.UserWithTimings("test")
+
+				So(err, ShouldBeNil)
+				So(user.Login, ShouldEqual, "one")
+				So(timings, ShouldNotBeNil)
+				So(timings.Connect, ShouldBeGreaterThanOrEqualTo, 0)
+				So(timings.Bind, ShouldBeGreaterThanOrEqualTo, 0)
+				So(timings.Search, ShouldBeGreaterThanOrEqualTo, 0)
+
+				teardown()
+			})
+
+			Convey("Should return the timings when the user isn't found", func() {
+				setup()
+
+				multi := New([]*ldap.ServerConfig{
+					{}, {},
+				})
+				_, _, timings, err := multi.UserWithTimings("test")
+
+				So(err, ShouldEqual, ErrDidNotFindUser)
+				So(timings, ShouldNotBeNil)
+
+				teardown()
+			})
+		})
+
+		Convey("UserWithAttempts()", func() {
+			Convey("Should list every server when the user isn't found", func() {
+				setup()
+
+				multi := New([]*ldap.ServerConfig{
+					{Host: "first", Port: 389, SearchFilter: "(cn=%s)"},
+					{Host: "second", Port: 636, SearchFilter: "(uid=%s)"},
+				})
+				_, _, attempts, err := multi.UserWithAttempts("test")
+
+				So(err, ShouldEqual, ErrDidNotFindUser)
+				So(attempts, ShouldResemble, []*ServerAttempt{
+					{Host: "first", Port: 389, Outcome: AttemptNotFound, SearchFilter: "(|(cn=test))"},
+					{Host: "second", Port: 636, Outcome: AttemptNotFound, SearchFilter: "(|(uid=test))"},
+				})
+
+				teardown()
+			})
+
+			Convey("Should stop the list at the server failing the bind", func() {
+				mock := setup()
+
+				expected := errors.New("Bind error")
+				mock.bindErrReturn = expected
+
+				multi := New([]*ldap.ServerConfig{
+					{Host: "first"}, {Host: "second"},
+				})
+				_, _, attempts, err := multi.UserWithAttempts("test")
+
+				So(err, ShouldEqual, expected)
+				So(attempts, ShouldResemble, []*ServerAttempt{
+					{Host: "first", Outcome: AttemptBindFailed, Error: expected},
+				})
+
+				teardown()
+			})
+
+			Convey("Should pick the first user by DN when the search matches several entries", func() {
+				mock := setup()
+
+				mock.usersFirstReturn = []*models.ExternalUserInfo{
+					{Login: "test", AuthId: "cn=test,ou=sales,dc=grafana,dc=org"},
+					{Login: "test", AuthId: "cn=test,ou=engineering,dc=grafana,dc=org"},
+				}
+
+				multi := New([]*ldap.ServerConfig{
+					{Host: "first"}, {Host: "second"},
+				})
+				user, _, attempts, err := multi.UserWithAttempts("test")
+
+				So(err, ShouldBeNil)
+				So(user.AuthId, ShouldEqual, "cn=test,ou=engineering,dc=grafana,dc=org")
+				So(attempts, ShouldResemble, []*ServerAttempt{
+					{Host: "first", Outcome: AttemptFound, MatchCount: 2, SearchFilter: "(|)"},
+				})
+
+				teardown()
+			})
+
+			Convey("Should refuse the user matching several entries with the reject policy", func() {
+				policy := setting.LDAPAmbiguousUsers
+				setting.LDAPAmbiguousUsers = setting.LDAPAmbiguousUsersReject
+				defer func() { setting.LDAPAmbiguousUsers = policy }()
+
+				mock := setup()
+
+				mock.usersFirstReturn = []*models.ExternalUserInfo{
+					{Login: "test", AuthId: "cn=test,ou=sales,dc=grafana,dc=org"},
+					{Login: "test", AuthId: "cn=test,ou=engineering,dc=grafana,dc=org"},
+				}
+
+				multi := New([]*ldap.ServerConfig{
+					{Host: "first"}, {Host: "second"},
+				})
+				user, _, attempts, err := multi.UserWithAttempts("test")
+
+				So(err, ShouldEqual, ldap.ErrAmbiguousUser)
+				So(user, ShouldBeNil)
+				So(attempts, ShouldResemble, []*ServerAttempt{
+					{Host: "first", Outcome: AttemptAmbiguous, Error: ldap.ErrAmbiguousUser, MatchCount: 2, SearchFilter: "(|)"},
+				})
+
+				teardown()
+			})
+
+			Convey("Should report the replica group of the servers", func() {
+				setup()
+
+				multi := New([]*ldap.ServerConfig{
+					{Host: "first", Port: 389, ReplicaGroup: "main"},
+				})
+				_, _, attempts, err := multi.UserWithAttempts("test")
+
+				So(err, ShouldEqual, ErrDidNotFindUser)
+				So(attempts[0].ReplicaGroup, ShouldEqual, "main")
+
+				teardown()
+			})
+		})
+
+		Convey("UnansweredServers()", func() {
+			Convey("Should be empty when every server answered", func() {
+				So(UnansweredServers([]*ServerAttempt{
+					{Host: "first", Port: 389, Outcome: AttemptNotFound},
+					{Host: "second", Port: 389, Outcome: AttemptNotFound},
+				}), ShouldBeEmpty)
+			})
+
+			Convey("Should list the unreachable and failing servers", func() {
+				So(UnansweredServers([]*ServerAttempt{
+					{Host: "first", Port: 389, Outcome: AttemptUnreachable},
+					{Host: "second", Port: 636, Outcome: AttemptNotFound},
+					{Host: "third", Port: 389, Outcome: AttemptSearchFailed},
+				}), ShouldResemble, []string{"first:389", "third:389"})
+			})
+
+			Convey("Should ignore the unreachable replicas of an answered group", func() {
+				So(UnansweredServers([]*ServerAttempt{
+					{Host: "first", Port: 389, Outcome: AttemptUnreachable, ReplicaGroup: "main"},
+					{Host: "second", Port: 389, Outcome: AttemptNotFound, ReplicaGroup: "main"},
+					{Host: "third", Port: 389, Outcome: AttemptSkipped, ReplicaGroup: "main"},
+				}), ShouldBeEmpty)
+			})
+
+			Convey("Should list a group none of whose replicas answered once", func() {
+				So(UnansweredServers([]*ServerAttempt{
+					{Host: "first", Port: 389, Outcome: AttemptUnreachable, ReplicaGroup: "main"},
+					{Host: "second", Port: 389, Outcome: AttemptUnreachable, ReplicaGroup: "main"},
+					{Host: "third", Port: 389, Outcome: AttemptNotFound},
+				}), ShouldResemble, []string{"main"})
+			})
 		})
 
 		Convey("Users()", func() {
@@ -372,5 +817,92 @@ func TestMultiLDAP(t *testing.T) {
 				teardown()
 			})
 		})
+
+		Convey("AllUsers()", func() {
+			Convey("Should return error for absent config list", func() {
+				setup()
+
+				multi := New([]*ldap.ServerConfig{})
+				_, _, err := multi.AllUsers()
+
+				So(err, ShouldEqual, ErrNoLDAPServers)
+
+				teardown()
+			})
+
+			Convey("Should get users from all of the servers", func() {
+				mock := setup()
+
+				mock.allUsersReturn = []*models.ExternalUserInfo{
+					{
+						Login: "one",
+					},
+				}
+
+				multi := New([]*ldap.ServerConfig{
+					{}, {},
+				})
+				users, truncated, err := multi.AllUsers()
+
+				So(mock.dialCalledTimes, ShouldEqual, 2)
+				So(mock.bindCalledTimes, ShouldEqual, 2)
+				So(mock.allUsersCalledTimes, ShouldEqual, 2)
+				So(mock.closeCalledTimes, ShouldEqual, 2)
+
+				So(err, ShouldBeNil)
+				So(truncated, ShouldBeFalse)
+				So(len(users), ShouldEqual, 2)
+
+				teardown()
+			})
+
+			Convey("Should report the users truncated by the size limit of the servers", func() {
+				mock := setup()
+
+				mock.allUsersReturn = []*models.ExternalUserInfo{
+					{
+						Login: "one",
+					},
+				}
+				mock.allUsersTruncatedReturn = true
+
+				multi := New([]*ldap.ServerConfig{
+					{}, {},
+				})
+				users, truncated, err := multi.AllUsers()
+
+				So(err, ShouldBeNil)
+				So(truncated, ShouldBeTrue)
+				So(len(users), ShouldEqual, 2)
+
+				teardown()
+			})
+		})
+
+		Convey("MatchingUsers()", func() {
+			Convey("Should get the matching users from all of the servers", func() {
+				mock := setup()
+
+				mock.allUsersReturn = []*models.ExternalUserInfo{
+					{
+						Login: "john",
+					},
+				}
+
+				multi := New([]*ldap.ServerConfig{
+					{}, {},
+				})
+				users, truncated, err := multi.MatchingUsers("jo*")
+
+				So(err, ShouldBeNil)
+				So(truncated, ShouldBeFalse)
+				So(len(users), ShouldEqual, 2)
+				So(mock.matchingUsersQueries, ShouldResemble, []string{"jo*", "jo*"})
+				So(mock.allUsersCalledTimes, ShouldEqual, 0)
+				So(mock.closeCalledTimes, ShouldEqual, 2)
+
+				teardown()
+			})
+		})
 	})
 }
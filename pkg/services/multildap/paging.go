@@ -0,0 +1,156 @@
+package multildap
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+)
+
+// ErrInvalidCursor is returned when the cursor can't be decoded or doesn't match the configured servers
+var ErrInvalidCursor = errors.New("Invalid LDAP users cursor")
+
+// UsersCursor is the position of a paged listing of the users across the servers, see UsersPage.
+// It is opaque to the clients, which get it encoded.
+type UsersCursor struct {
+	// Slot is the position of the listed server in the listing order, the replicas of a group share a slot
+	Slot int `json:"s"`
+
+	// Server is the index of the configured server listing the slot, the paged search has to continue on it
+	Server int `json:"i"`
+
+	BaseDN int    `json:"b"`
+	Cookie []byte `json:"c,omitempty"`
+}
+
+// Encode encodes the cursor for the clients
+func (cursor *UsersCursor) Encode() string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeUsersCursor decodes the cursor encoded by Encode
+func DecodeUsersCursor(encoded string) (*UsersCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	cursor := &UsersCursor{}
+	if err := json.Unmarshal(data, cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return cursor, nil
+}
+
+// started checks if the cursor is in the middle of the listing of its server
+func (cursor *UsersCursor) started() bool {
+	return cursor.BaseDN > 0 || len(cursor.Cookie) > 0
+}
+
+// listingSlots are the servers to list in order, as indexes of the configs.
+// The replicas of a group hold the same users so they share the slot of the first one.
+func listingSlots(configs []*ldap.ServerConfig) [][]int {
+	slots := [][]int{}
+	groups := map[string]int{}
+
+	for i, config := range configs {
+		if config.ReplicaGroup != "" {
+			if slot, ok := groups[config.ReplicaGroup]; ok {
+				slots[slot] = append(slots[slot], i)
+				continue
+			}
+
+			groups[config.ReplicaGroup] = len(slots)
+		}
+
+		slots = append(slots, []int{i})
+	}
+
+	return slots
+}
+
+// UsersPage lists a page of at most limit users from the position of the cursor, the first page if nil.
+// It relies on the paged results control of the servers, so unlike offsets the pages don't overlap
+// nor skip users when the directory changes. A page never spans several servers, or search base DNs,
+// so it can hold fewer users than the limit. The cursor of the next page is nil once every server is listed.
+func (multiples *MultiLDAP) UsersPage(cursor *UsersCursor, limit int) (
+	[]*models.ExternalUserInfo, *UsersCursor, error,
+) {
+	if len(multiples.configs) == 0 {
+		return nil, nil, ErrNoLDAPServers
+	}
+
+	if cursor == nil {
+		cursor = &UsersCursor{}
+	}
+
+	slots := listingSlots(multiples.configs)
+	if cursor.Slot < 0 || cursor.Slot >= len(slots) {
+		return nil, nil, ErrInvalidCursor
+	}
+
+	members := slots[cursor.Slot]
+	if cursor.started() {
+		// the paged search continues on the server which started it
+		if !containsIndex(members, cursor.Server) {
+			return nil, nil, ErrInvalidCursor
+		}
+
+		members = []int{cursor.Server}
+	}
+
+	var dialErr error
+	for _, index := range members {
+		config := multiples.configs[index]
+		server := newLDAP(config)
+
+		if err := server.Dial(); err != nil {
+			// another replica of the group may answer
+			logDialFailure(err, config)
+			dialErr = err
+			continue
+		}
+
+		defer server.Close()
+		replicas.markUp(config)
+
+		if err := server.Bind(); err != nil {
+			return nil, nil, err
+		}
+
+		users, next, err := server.UsersPage(&ldap.PageCursor{BaseDN: cursor.BaseDN, Cookie: cursor.Cookie}, uint32(limit))
+		if err == ldap.ErrInvalidPageCursor {
+			return nil, nil, ErrInvalidCursor
+		}
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if next != nil {
+			return users, &UsersCursor{Slot: cursor.Slot, Server: index, BaseDN: next.BaseDN, Cookie: next.Cookie}, nil
+		}
+
+		if cursor.Slot+1 < len(slots) {
+			return users, &UsersCursor{Slot: cursor.Slot + 1}, nil
+		}
+
+		return users, nil, nil
+	}
+
+	return nil, nil, dialErr
+}
+
+func containsIndex(indexes []int, index int) bool {
+	for _, i := range indexes {
+		if i == index {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,188 @@
+package multildap
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+)
+
+func TestUsersPage(t *testing.T) {
+	Convey("UsersPage()", t, func() {
+		replicas = newReplicaSet()
+
+		// directories holds the pages of the users of every host, a cookie is the index of the next page
+		directories := map[string][][]string{
+			"10.0.0.1": {{"alice", "bob"}, {"carol"}},
+			"10.0.0.2": {{"alice", "bob"}, {"carol"}},
+			"10.0.1.1": {{"dave"}},
+		}
+
+		// mockServers pages the users of the directories, the hosts listed in down can't be dialed
+		mockServers := func(down ...string) *[]string {
+			dialed := &[]string{}
+
+			newLDAP = func(config *ldap.ServerConfig) ldap.IServer {
+				*dialed = append(*dialed, config.Host)
+
+				mock := &MockLDAP{}
+				mock.usersPageProvider = func(cursor *ldap.PageCursor, size uint32) ([]*models.ExternalUserInfo, *ldap.PageCursor, error) {
+					page := 0
+					if len(cursor.Cookie) > 0 {
+						page = int(cursor.Cookie[0])
+					}
+
+					pages := directories[config.Host]
+					if page >= len(pages) {
+						return nil, nil, ldap.ErrInvalidPageCursor
+					}
+
+					users := []*models.ExternalUserInfo{}
+					for _, login := range pages[page] {
+						users = append(users, &models.ExternalUserInfo{Login: login})
+					}
+
+					if page+1 < len(pages) {
+						return users, &ldap.PageCursor{Cookie: []byte{byte(page + 1)}}, nil
+					}
+
+					return users, nil, nil
+				}
+
+				for _, host := range down {
+					if host == config.Host {
+						mock.dialErrReturn = errors.New("Dial error")
+					}
+				}
+
+				return mock
+			}
+
+			return dialed
+		}
+
+		// list drives the cursors until the last page, and returns the logins of every page
+		list := func(multi IMultiLDAP) ([][]string, error) {
+			pages := [][]string{}
+
+			var cursor *UsersCursor
+			for {
+				users, next, err := multi.UsersPage(cursor, 2)
+				if err != nil {
+					return nil, err
+				}
+
+				logins := []string{}
+				for _, user := range users {
+					logins = append(logins, user.Login)
+				}
+				pages = append(pages, logins)
+
+				if next == nil {
+					return pages, nil
+				}
+
+				// the clients only get the encoded cursor
+				cursor, err = DecodeUsersCursor(next.Encode())
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		Reset(func() {
+			teardown()
+		})
+
+		Convey("Should return error for absent config list", func() {
+			multi := New([]*ldap.ServerConfig{})
+			_, _, err := multi.UsersPage(nil, 2)
+
+			So(err, ShouldEqual, ErrNoLDAPServers)
+		})
+
+		Convey("Should page through the servers without overlap", func() {
+			mockServers()
+
+			multi := New([]*ldap.ServerConfig{
+				{Host: "10.0.0.1"},
+				{Host: "10.0.1.1"},
+			})
+			pages, err := list(multi)
+
+			So(err, ShouldBeNil)
+			So(pages, ShouldResemble, [][]string{{"alice", "bob"}, {"carol"}, {"dave"}})
+		})
+
+		Convey("Should list the users of a replica group once", func() {
+			dialed := mockServers()
+
+			multi := New([]*ldap.ServerConfig{
+				{Host: "10.0.0.1", ReplicaGroup: "main"},
+				{Host: "10.0.0.2", ReplicaGroup: "main"},
+				{Host: "10.0.1.1"},
+			})
+			pages, err := list(multi)
+
+			So(err, ShouldBeNil)
+			So(pages, ShouldResemble, [][]string{{"alice", "bob"}, {"carol"}, {"dave"}})
+			So(*dialed, ShouldResemble, []string{"10.0.0.1", "10.0.0.1", "10.0.1.1"})
+		})
+
+		Convey("Should start the listing of a replica group on the replica up", func() {
+			dialed := mockServers("10.0.0.1")
+
+			multi := New([]*ldap.ServerConfig{
+				{Host: "10.0.0.1", ReplicaGroup: "main"},
+				{Host: "10.0.0.2", ReplicaGroup: "main"},
+			})
+			pages, err := list(multi)
+
+			So(err, ShouldBeNil)
+			So(pages, ShouldResemble, [][]string{{"alice", "bob"}, {"carol"}})
+			So(*dialed, ShouldResemble, []string{"10.0.0.1", "10.0.0.2", "10.0.0.2"})
+		})
+
+		Convey("Should continue the paged search on the replica which started it", func() {
+			mockServers("10.0.0.2")
+
+			multi := New([]*ldap.ServerConfig{
+				{Host: "10.0.0.1", ReplicaGroup: "main"},
+				{Host: "10.0.0.2", ReplicaGroup: "main"},
+			})
+			_, _, err := multi.UsersPage(&UsersCursor{Server: 1, Cookie: []byte{1}}, 2)
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "Dial error")
+		})
+
+		Convey("Should refuse a cursor of another listing", func() {
+			mockServers()
+
+			multi := New([]*ldap.ServerConfig{
+				{Host: "10.0.0.1"},
+				{Host: "10.0.1.1"},
+			})
+
+			_, _, err := multi.UsersPage(&UsersCursor{Slot: 2}, 2)
+			So(err, ShouldEqual, ErrInvalidCursor)
+
+			_, _, err = multi.UsersPage(&UsersCursor{Slot: 0, Server: 1, Cookie: []byte{1}}, 2)
+			So(err, ShouldEqual, ErrInvalidCursor)
+
+			_, _, err = multi.UsersPage(&UsersCursor{Slot: 1, Server: 1, Cookie: []byte{5}}, 2)
+			So(err, ShouldEqual, ErrInvalidCursor)
+		})
+
+		Convey("Should refuse a cursor which can't be decoded", func() {
+			_, err := DecodeUsersCursor("not a cursor")
+			So(err, ShouldEqual, ErrInvalidCursor)
+
+			_, err = DecodeUsersCursor("bm90IGpzb24")
+			So(err, ShouldEqual, ErrInvalidCursor)
+		})
+	})
+}
@@ -0,0 +1,158 @@
+package multildap
+
+import (
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+)
+
+// serverAnswer is the answer of a server to a user lookup or a login, see the Attempt* outcomes
+type serverAnswer struct {
+	config  *ldap.ServerConfig
+	outcome string
+	err     error
+	user    *models.ExternalUserInfo
+
+	// matches is the number of entries matched by the user search
+	matches int
+
+	// timings is the time spent asking the server
+	timings *Timings
+}
+
+// end sets the outcome of the answer and returns it
+func (answer *serverAnswer) end(outcome string, err error) *serverAnswer {
+	answer.outcome = outcome
+	answer.err = err
+
+	return answer
+}
+
+// authoritative checks if the answer ends the lookup, the servers which don't know the user or can't be reached don't
+func (answer *serverAnswer) authoritative() bool {
+	switch answer.outcome {
+	case AttemptNotFound, AttemptUnreachable, AttemptSkipped:
+		return false
+	default:
+		return true
+	}
+}
+
+// add adds the time spent in each step of another lookup
+func (timings *Timings) add(other *Timings) {
+	if other == nil {
+		return
+	}
+
+	timings.Connect += other.Connect
+	timings.Bind += other.Bind
+	timings.Search += other.Search
+}
+
+// fanOut asks all the servers at once, see the parallel_lookups setting, and returns the authoritative answer of the
+// first server in order, like the serial lookups, nil when none of the servers knows the user, along with the number
+// of servers which couldn't be reached. The answer of a server is returned once the servers before it answered, without
+// waiting for the servers after it. The replicas of a group are still asked in order, until one of them can be reached,
+// the others are skipped. The answers are passed to the answered func in the order of the servers, from the calling
+// goroutine. The servers still running once an answer is returned aren't waited for, they give back their connection
+// when they are done, within their own timeouts, like the bind_timeout of the server.
+func fanOut(
+	configs []*ldap.ServerConfig,
+	ask func(*ldap.ServerConfig) *serverAnswer,
+	answered func(*serverAnswer),
+) (*serverAnswer, int) {
+	groups := replicaSlots(configs)
+
+	// buffered, so the servers answering after the lookup ended don't block
+	results := make(chan *groupAnswers, len(groups))
+
+	for slot, group := range groups {
+		go func(slot int, group []*ldap.ServerConfig) {
+			result := askReplicas(group, ask)
+			result.slot = slot
+			results <- result
+		}(slot, group)
+	}
+
+	received := make([]*groupAnswers, len(groups))
+	unreachable := 0
+	next := 0
+
+	for range groups {
+		result := <-results
+		received[result.slot] = result
+
+		for next < len(groups) && received[next] != nil {
+			current := received[next]
+			next++
+
+			for _, answer := range current.answers {
+				answered(answer)
+
+				if answer.outcome == AttemptUnreachable {
+					unreachable++
+				}
+			}
+
+			if current.reached != nil && current.reached.authoritative() {
+				return current.reached, unreachable
+			}
+		}
+	}
+
+	return nil, unreachable
+}
+
+// groupAnswers are the answers of the replicas of a group, in order, and the one of the replica which was reached, if any
+type groupAnswers struct {
+	answers []*serverAnswer
+	reached *serverAnswer
+
+	// slot is the index of the group in the servers asked at once
+	slot int
+}
+
+// askReplicas asks the replicas of a group in order until one of them can be reached, the others are skipped
+func askReplicas(group []*ldap.ServerConfig, ask func(*ldap.ServerConfig) *serverAnswer) *groupAnswers {
+	result := &groupAnswers{}
+
+	for _, config := range group {
+		if result.reached != nil {
+			result.answers = append(result.answers, &serverAnswer{config: config, outcome: AttemptSkipped})
+			continue
+		}
+
+		answer := ask(config)
+		result.answers = append(result.answers, answer)
+
+		if answer.outcome != AttemptUnreachable {
+			result.reached = answer
+		}
+	}
+
+	return result
+}
+
+// replicaSlots splits the ordered servers in the groups asked at once, each server alone
+// but the replicas of a group, which replicas.order keeps together
+func replicaSlots(configs []*ldap.ServerConfig) [][]*ldap.ServerConfig {
+	var groups [][]*ldap.ServerConfig
+	slots := map[string]int{}
+
+	for _, config := range configs {
+		if config.ReplicaGroup == "" {
+			groups = append(groups, []*ldap.ServerConfig{config})
+			continue
+		}
+
+		slot, ok := slots[config.ReplicaGroup]
+		if !ok {
+			slot = len(groups)
+			slots[config.ReplicaGroup] = slot
+			groups = append(groups, nil)
+		}
+
+		groups[slot] = append(groups[slot], config)
+	}
+
+	return groups
+}
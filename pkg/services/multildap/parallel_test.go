@@ -0,0 +1,246 @@
+package multildap
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestParallelLookups(t *testing.T) {
+	Convey("Parallel lookups", t, func() {
+		parallel := setting.LDAPParallelLookups
+		setting.LDAPParallelLookups = true
+		replicas = newReplicaSet()
+
+		// the primary holds its dial until it's opened, the lookups mustn't wait for it when it comes after the answer
+		primary := &gatedLDAP{MockLDAP: &MockLDAP{}, gate: make(chan struct{}), closed: make(chan struct{})}
+
+		mocks := map[string]*MockLDAP{}
+		newLDAP = func(config *ldap.ServerConfig) ldap.IServer {
+			if mocks[config.Host] == nil {
+				return primary
+			}
+
+			return mocks[config.Host]
+		}
+
+		Reset(func() {
+			primary.open()
+			if mocks["primary"] == nil {
+				<-primary.closed
+			}
+
+			setting.LDAPParallelLookups = parallel
+			teardown()
+		})
+
+		Convey("User()", func() {
+			Convey("Should take the answer of a server without waiting for the next ones", func() {
+				mocks["secondary"] = &MockLDAP{
+					usersFirstReturn: []*models.ExternalUserInfo{{Login: "killa"}},
+				}
+
+				user, config, err := New([]*ldap.ServerConfig{
+					{Host: "secondary"}, {Host: "primary"},
+				}).User("killa")
+
+				So(err, ShouldBeNil)
+				So(user.Login, ShouldEqual, "killa")
+				So(config.Host, ShouldEqual, "secondary")
+			})
+
+			Convey("Should take the answer of the first server knowing the user, like the serial lookups", func() {
+				primary.usersFirstReturn = []*models.ExternalUserInfo{{Login: "killa", AuthId: "cn=killa,dc=primary"}}
+				mocks["secondary"] = &MockLDAP{
+					usersFirstReturn: []*models.ExternalUserInfo{{Login: "killa", AuthId: "cn=killa,dc=secondary"}},
+				}
+
+				// the secondary answers first
+				go func() {
+					time.Sleep(20 * time.Millisecond)
+					primary.open()
+				}()
+
+				user, config, err := New([]*ldap.ServerConfig{
+					{Host: "primary"}, {Host: "secondary"},
+				}).User("killa")
+
+				So(err, ShouldBeNil)
+				So(user.AuthId, ShouldEqual, "cn=killa,dc=primary")
+				So(config.Host, ShouldEqual, "primary")
+			})
+
+			Convey("Should end the lookup with a failed bind", func() {
+				expected := errors.New("Bind error")
+				mocks["secondary"] = &MockLDAP{bindErrReturn: expected}
+
+				_, _, attempts, err := New([]*ldap.ServerConfig{
+					{Host: "secondary"}, {Host: "primary"},
+				}).UserWithAttempts("killa")
+
+				So(err, ShouldEqual, expected)
+				So(attempts, ShouldResemble, []*ServerAttempt{
+					{Host: "secondary", Outcome: AttemptBindFailed, Error: expected},
+				})
+			})
+
+			Convey("Should wait for every server when none finds the user", func() {
+				mocks["primary"] = &MockLDAP{}
+				mocks["secondary"] = &MockLDAP{}
+
+				_, _, attempts, err := New([]*ldap.ServerConfig{
+					{Host: "primary"}, {Host: "secondary"},
+				}).UserWithAttempts("killa")
+
+				So(err, ShouldEqual, ErrDidNotFindUser)
+				So(attempts, ShouldHaveLength, 2)
+			})
+
+			Convey("Should return an error when none of the servers are reachable", func() {
+				mocks["primary"] = &MockLDAP{dialErrReturn: errors.New("Dial error")}
+				mocks["secondary"] = &MockLDAP{dialErrReturn: errors.New("Dial error")}
+
+				_, _, err := New([]*ldap.ServerConfig{
+					{Host: "primary"}, {Host: "secondary"},
+				}).User("killa")
+
+				So(err, ShouldEqual, ErrUnreachable)
+			})
+
+			Convey("Should ask the replicas of a group in order", func() {
+				mocks["10.0.0.1"] = &MockLDAP{dialErrReturn: errors.New("Dial error")}
+				mocks["10.0.0.2"] = &MockLDAP{
+					usersFirstReturn: []*models.ExternalUserInfo{{Login: "killa"}},
+				}
+				mocks["10.0.0.3"] = &MockLDAP{}
+
+				group := func(host string) *ldap.ServerConfig {
+					return &ldap.ServerConfig{Host: host, ReplicaGroup: "corp", ReplicaStrategy: ldap.ReplicaStrategyFailover}
+				}
+
+				user, _, attempts, err := New([]*ldap.ServerConfig{
+					group("10.0.0.1"), group("10.0.0.2"), group("10.0.0.3"), {Host: "primary"},
+				}).UserWithAttempts("killa")
+
+				So(err, ShouldBeNil)
+				So(user.Login, ShouldEqual, "killa")
+				So(attempts, ShouldHaveLength, 3)
+				So(attempts[0].Outcome, ShouldEqual, AttemptUnreachable)
+				So(attempts[1].Outcome, ShouldEqual, AttemptFound)
+				So(attempts[2].Outcome, ShouldEqual, AttemptSkipped)
+				So(mocks["10.0.0.3"].dialCalledTimes, ShouldEqual, 0)
+			})
+		})
+
+		Convey("Login()", func() {
+			Convey("Should log in the user without waiting for the next servers", func() {
+				mocks["secondary"] = &MockLDAP{
+					usersFirstReturn: []*models.ExternalUserInfo{{Login: "killa"}},
+					loginReturn:      &models.ExternalUserInfo{Login: "killa"},
+				}
+
+				user, err := New([]*ldap.ServerConfig{
+					{Host: "secondary"}, {Host: "primary"},
+				}).Login(&models.LoginUserQuery{Username: "killa", Password: "secret"})
+
+				So(err, ShouldBeNil)
+				So(user.Login, ShouldEqual, "killa")
+			})
+
+			Convey("Should only bind the password on the first server knowing the user", func() {
+				primary.usersFirstReturn = []*models.ExternalUserInfo{{Login: "killa", AuthId: "cn=killa,dc=primary"}}
+				primary.loginReturn = &models.ExternalUserInfo{Login: "killa", AuthId: "cn=killa,dc=primary"}
+				mocks["secondary"] = &MockLDAP{
+					usersFirstReturn: []*models.ExternalUserInfo{{Login: "killa", AuthId: "cn=killa,dc=secondary"}},
+					loginReturn:      &models.ExternalUserInfo{Login: "killa", AuthId: "cn=killa,dc=secondary"},
+				}
+
+				go func() {
+					time.Sleep(20 * time.Millisecond)
+					primary.open()
+				}()
+
+				user, err := New([]*ldap.ServerConfig{
+					{Host: "primary"}, {Host: "secondary"},
+				}).Login(&models.LoginUserQuery{Username: "killa", Password: "secret"})
+
+				So(err, ShouldBeNil)
+				So(user.AuthId, ShouldEqual, "cn=killa,dc=primary")
+				So(primary.loginCalledTimes, ShouldEqual, 1)
+				So(mocks["secondary"].loginCalledTimes, ShouldEqual, 0)
+			})
+
+			Convey("Should refuse the credentials without binding them when no server knows the user", func() {
+				mocks["primary"] = &MockLDAP{}
+				mocks["secondary"] = &MockLDAP{}
+
+				_, err := New([]*ldap.ServerConfig{
+					{Host: "primary"}, {Host: "secondary"},
+				}).Login(&models.LoginUserQuery{Username: "killa", Password: "secret"})
+
+				So(err, ShouldEqual, ErrInvalidCredentials)
+				So(mocks["primary"].loginCalledTimes, ShouldEqual, 0)
+				So(mocks["secondary"].loginCalledTimes, ShouldEqual, 0)
+			})
+
+			Convey("Should ask the servers one after the other when one is searched as the user", func() {
+				mocks["primary"] = &MockLDAP{loginReturn: &models.ExternalUserInfo{Login: "killa"}}
+				mocks["secondary"] = &MockLDAP{loginReturn: &models.ExternalUserInfo{Login: "killa"}}
+
+				user, err := New([]*ldap.ServerConfig{
+					{Host: "primary", BindDN: "cn=%s,dc=grafana,dc=org"}, {Host: "secondary"},
+				}).Login(&models.LoginUserQuery{Username: "killa", Password: "secret"})
+
+				So(err, ShouldBeNil)
+				So(user.Login, ShouldEqual, "killa")
+				So(mocks["primary"].loginCalledTimes, ShouldEqual, 1)
+				So(mocks["secondary"].dialCalledTimes, ShouldEqual, 0)
+			})
+		})
+	})
+
+	Convey("replicaSlots()", t, func() {
+		Convey("Should keep the replicas of a group together", func() {
+			first := &ldap.ServerConfig{Host: "10.0.0.1", ReplicaGroup: "corp"}
+			other := &ldap.ServerConfig{Host: "10.0.1.1"}
+			second := &ldap.ServerConfig{Host: "10.0.0.2", ReplicaGroup: "corp"}
+
+			So(replicaSlots([]*ldap.ServerConfig{first, other, second}), ShouldResemble, [][]*ldap.ServerConfig{
+				{first, second}, {other},
+			})
+		})
+	})
+}
+
+// gatedLDAP is a server whose dial waits for the gate to be opened
+type gatedLDAP struct {
+	*MockLDAP
+
+	gate   chan struct{}
+	once   sync.Once
+	closed chan struct{}
+
+	// closeOnce closes closed on the first close, the lookup and the login of a user close their own connection
+	closeOnce sync.Once
+}
+
+// open lets the dial through, it can be called several times
+func (server *gatedLDAP) open() {
+	server.once.Do(func() { close(server.gate) })
+}
+
+func (server *gatedLDAP) Dial() error {
+	<-server.gate
+	return nil
+}
+
+func (server *gatedLDAP) Close() {
+	server.closeOnce.Do(func() { close(server.closed) })
+}
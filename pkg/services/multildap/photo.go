@@ -0,0 +1,76 @@
+package multildap
+
+import (
+	"github.com/grafana/grafana/pkg/services/ldap"
+)
+
+// UserPhoto finds the user like User() does and returns the raw bytes of its photo, see ldap.Server.UserPhoto.
+// The photo is nil when the server the user was found on has no photo for it.
+func (multiples *MultiLDAP) UserPhoto(login string) ([]byte, error) {
+	var photo []byte
+
+	err := multiples.onUserServer(func(server ldap.IServer) error {
+		var err error
+		photo, err = server.UserPhoto(login)
+		return err
+	})
+
+	return photo, err
+}
+
+// UserAttributes finds the user like User() does and returns the attributes of its entry, see ldap.Server.UserAttributes
+func (multiples *MultiLDAP) UserAttributes(login string) (map[string][]string, error) {
+	var attributes map[string][]string
+
+	err := multiples.onUserServer(func(server ldap.IServer) error {
+		var err error
+		attributes, err = server.UserAttributes(login)
+		return err
+	})
+
+	return attributes, err
+}
+
+// onUserServer runs the lookup on the servers in turn, until one of them doesn't answer ldap.ErrCouldNotFindUser
+func (multiples *MultiLDAP) onUserServer(lookup func(server ldap.IServer) error) error {
+	if len(multiples.configs) == 0 {
+		return ErrNoLDAPServers
+	}
+
+	unreachable := 0
+	answered := answeredGroups{}
+	for _, config := range replicas.order(multiples.configs, false) {
+		if answered.skip(config) {
+			continue
+		}
+
+		server, release, dialErr, err := multiples.connect(config, &Timings{})
+
+		if dialErr != nil {
+			logDialFailure(dialErr, config)
+			unreachable++
+			continue
+		}
+
+		defer release()
+		answered.add(config)
+		replicas.markUp(config)
+
+		if err != nil {
+			return err
+		}
+
+		err = lookup(server)
+		if err == ldap.ErrCouldNotFindUser {
+			continue
+		}
+
+		return err
+	}
+
+	if unreachable == len(multiples.configs) {
+		return ErrUnreachable
+	}
+
+	return ErrDidNotFindUser
+}
@@ -0,0 +1,86 @@
+package multildap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/services/ldap"
+)
+
+func TestUserPhoto(t *testing.T) {
+	Convey("UserPhoto()", t, func() {
+		Reset(teardown)
+
+		Convey("Should return the photo of the first server having the user", func() {
+			mock := setup()
+
+			calls := 0
+			mock.userPhotoProvider = func(login string) ([]byte, error) {
+				calls++
+				if calls == 1 {
+					return nil, ldap.ErrCouldNotFindUser
+				}
+
+				return []byte{0xff, 0xd8}, nil
+			}
+
+			photo, err := New([]*ldap.ServerConfig{{}, {}}).UserPhoto("johndoe")
+
+			So(err, ShouldBeNil)
+			So(photo, ShouldResemble, []byte{0xff, 0xd8})
+			So(calls, ShouldEqual, 2)
+		})
+
+		Convey("Should report a user missing from every server", func() {
+			setup()
+
+			_, err := New([]*ldap.ServerConfig{{}, {}}).UserPhoto("johndoe")
+
+			So(err, ShouldEqual, ErrDidNotFindUser)
+		})
+
+		Convey("Should report the unreachable servers", func() {
+			mock := setup()
+			mock.dialErrReturn = ErrUnreachable
+
+			_, err := New([]*ldap.ServerConfig{{}, {}}).UserPhoto("johndoe")
+
+			So(err, ShouldEqual, ErrUnreachable)
+		})
+	})
+}
+
+func TestUserAttributes(t *testing.T) {
+	Convey("UserAttributes()", t, func() {
+		Reset(teardown)
+
+		Convey("Should return the attributes of the first server having the user", func() {
+			mock := setup()
+
+			calls := 0
+			mock.userAttributesProvider = func(login string) (map[string][]string, error) {
+				calls++
+				if calls == 1 {
+					return nil, ldap.ErrCouldNotFindUser
+				}
+
+				return map[string][]string{"mail": {"john.doe@example.com"}}, nil
+			}
+
+			attributes, err := New([]*ldap.ServerConfig{{}, {}}).UserAttributes("johndoe")
+
+			So(err, ShouldBeNil)
+			So(attributes, ShouldResemble, map[string][]string{"mail": {"john.doe@example.com"}})
+			So(calls, ShouldEqual, 2)
+		})
+
+		Convey("Should report a user missing from every server", func() {
+			setup()
+
+			_, err := New([]*ldap.ServerConfig{{}, {}}).UserAttributes("johndoe")
+
+			So(err, ShouldEqual, ErrDidNotFindUser)
+		})
+	})
+}
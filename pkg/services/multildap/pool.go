@@ -0,0 +1,282 @@
+package multildap
+
+import (
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// connections are the bound connections to the servers kept across the requests, see the pool_max_idle setting
+var connections = newPool()
+
+// pool keeps up to pool_max_idle idle connections to each server and bounds the open ones to pool_max_open.
+// The connections are keyed by the config of their server, the ones of a reloaded config are closed by cycle.
+// The connections to the servers of the configs copied for a single request are closed once given back.
+type pool struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	idle map[*ldap.ServerConfig][]*pooledServer
+	open map[*ldap.ServerConfig]int
+
+	// retired are the configs cycled while some of their connections were in use, these are closed once given back
+	retired map[*ldap.ServerConfig]bool
+
+	now func() time.Time
+}
+
+// pooledServer is an idle connection of the pool
+type pooledServer struct {
+	server     ldap.IServer
+	releasedAt time.Time
+
+	// rebind is set when the connection was bound as a user by a login, it's bound again before its reuse
+	rebind bool
+}
+
+func newPool() *pool {
+	pool := &pool{
+		idle:    map[*ldap.ServerConfig][]*pooledServer{},
+		open:    map[*ldap.ServerConfig]int{},
+		retired: map[*ldap.ServerConfig]bool{},
+		now:     time.Now,
+	}
+	pool.cond = sync.NewCond(&pool.mu)
+
+	return pool
+}
+
+// get returns an idle connection to the server, or else dials a new one, adding the time spent to the timings.
+// The idle connections are bound again when their health check is due, the ones failing it are closed.
+// The new connections are only bound with bind set. It waits for a connection to be released when pool_max_open
+// connections to the server are open. The connection must be given back with put or discard, unless the dial failed.
+// A quarantined server isn't dialed, ErrQuarantined is returned as dial error instead.
+// The new connections failing because of a transient error are dialed again, see the dial_retries setting.
+func (pool *pool) get(config *ldap.ServerConfig, timings *Timings, bind bool) (
+	server ldap.IServer, reused bool, dialErr error, bindErr error,
+) {
+	if !replicas.quarantinedUntil(config).IsZero() {
+		return nil, false, ErrQuarantined, nil
+	}
+
+	for {
+		pooled := pool.acquire(config)
+		if pooled == nil {
+			break
+		}
+
+		if !pooled.rebind && pool.now().Sub(pooled.releasedAt) < setting.LDAPPoolHealthCheckInterval {
+			return pooled.server, true, nil, nil
+		}
+
+		start := time.Now()
+		err := pooled.server.Bind()
+		timings.Bind += time.Since(start)
+
+		if err == nil {
+			return pooled.server, true, nil, nil
+		}
+
+		logger.Debug("Closing a pooled LDAP connection failing its health check", "host", config.Host, "error", err)
+		pool.discard(config, pooled.server)
+	}
+
+	// the transient failures are retried up to dial_retries times, keeping the slot of the connection
+	for retry := 1; ; retry++ {
+		server = newLDAP(config)
+
+		start := time.Now()
+		dialErr = server.Dial()
+		timings.Connect += time.Since(start)
+
+		if dialErr == nil {
+			replicas.recordLatency(config, time.Since(start))
+
+			if bind {
+				start = time.Now()
+				bindErr = server.Bind()
+				timings.Bind += time.Since(start)
+			}
+		}
+
+		if retry > setting.LDAPDialRetries || !isTransientConnectError(dialErr, bindErr) {
+			break
+		}
+
+		if dialErr == nil {
+			server.Close()
+		}
+
+		backoff := connectRetryBackoff(retry)
+		logger.Debug(
+			"Failed to connect to the LDAP server, retrying",
+			"host", config.Host,
+			"retry", retry,
+			"backoff", backoff,
+			"dialError", dialErr,
+			"bindError", bindErr,
+		)
+
+		sleep(backoff)
+	}
+
+	if dialErr != nil {
+		pool.release(config)
+		return nil, false, dialErr, nil
+	}
+
+	return server, false, nil, bindErr
+}
+
+// acquire takes an idle connection to the server, or else counts the connection about to be dialed and returns nil
+func (pool *pool) acquire(config *ldap.ServerConfig) *pooledServer {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.closeExpired()
+
+	for setting.LDAPPoolMaxOpen > 0 && pool.open[config] >= setting.LDAPPoolMaxOpen && len(pool.idle[config]) == 0 {
+		pool.cond.Wait()
+	}
+
+	idle := pool.idle[config]
+	if len(idle) == 0 {
+		pool.open[config]++
+		return nil
+	}
+
+	// the most recently released connection is the most likely to still work
+	pooled := idle[len(idle)-1]
+	pool.idle[config] = idle[:len(idle)-1]
+
+	return pooled
+}
+
+// put gives back the connection to the server, it's kept idle unless the pool is full.
+// With rebind, the connection was bound as a user and is bound again before its reuse.
+// The connections still running a request given up on its timeout are discarded, see ldap.IServer.Abandoned,
+// as well as the ones to the servers of copied configs, whose key is never looked up again.
+func (pool *pool) put(config *ldap.ServerConfig, server ldap.IServer, rebind bool) {
+	if server.Abandoned() {
+		logger.Debug("Closing an LDAP connection with a request abandoned on its timeout", "host", config.Host)
+		pool.discard(config, server)
+		return
+	}
+
+	if config.IsCopy() {
+		pool.discard(config, server)
+		return
+	}
+
+	pool.mu.Lock()
+
+	if !pool.retired[config] && len(pool.idle[config]) < setting.LDAPPoolMaxIdle {
+		pool.idle[config] = append(pool.idle[config], &pooledServer{
+			server:     server,
+			releasedAt: pool.now(),
+			rebind:     rebind,
+		})
+		pool.cond.Broadcast()
+		pool.mu.Unlock()
+
+		return
+	}
+
+	pool.mu.Unlock()
+	pool.discard(config, server)
+}
+
+// discard closes the connection to the server, for example after a failed bind
+func (pool *pool) discard(config *ldap.ServerConfig, server ldap.IServer) {
+	server.Close()
+	pool.release(config)
+}
+
+// release frees the slot of a closed connection to the server
+func (pool *pool) release(config *ldap.ServerConfig) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.open[config]--
+	if pool.open[config] <= 0 {
+		delete(pool.open, config)
+		delete(pool.retired, config)
+	}
+
+	pool.cond.Broadcast()
+}
+
+// CycleConnections closes the idle connections of the pool, and the ones in use once they're given back.
+// It's called when the config is reloaded, so the connections secured with the previous TLS certificates
+// aren't reused, the new ones load the certificates again.
+func CycleConnections() {
+	connections.cycle()
+}
+
+// cycle closes the idle connections and retires the configs of the connections in use
+func (pool *pool) cycle() {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	closed := 0
+	for config, idle := range pool.idle {
+		for _, pooled := range idle {
+			pooled.server.Close()
+			pool.open[config]--
+			closed++
+		}
+	}
+
+	pool.idle = map[*ldap.ServerConfig][]*pooledServer{}
+
+	inUse := 0
+	for config, open := range pool.open {
+		if open <= 0 {
+			delete(pool.open, config)
+			continue
+		}
+
+		pool.retired[config] = true
+		inUse += open
+	}
+
+	logger.Debug("Cycled the LDAP connections", "closed", closed, "inUse", inUse)
+
+	pool.cond.Broadcast()
+}
+
+// closeExpired closes the connections idle for longer than pool_idle_timeout, it's called with the lock held
+func (pool *pool) closeExpired() {
+	if setting.LDAPPoolIdleTimeout <= 0 {
+		return
+	}
+
+	for config, idle := range pool.idle {
+		kept := idle[:0]
+
+		for _, pooled := range idle {
+			if pool.now().Sub(pooled.releasedAt) < setting.LDAPPoolIdleTimeout {
+				kept = append(kept, pooled)
+				continue
+			}
+
+			pooled.server.Close()
+			pool.open[config]--
+		}
+
+		if len(kept) == 0 {
+			delete(pool.idle, config)
+		} else {
+			pool.idle[config] = kept
+		}
+
+		if pool.open[config] <= 0 {
+			delete(pool.open, config)
+			delete(pool.retired, config)
+		}
+	}
+
+	pool.cond.Broadcast()
+}
@@ -0,0 +1,258 @@
+package multildap
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/setting"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPool(t *testing.T) {
+	Convey("Connection pool", t, func() {
+		maxIdle, maxOpen := setting.LDAPPoolMaxIdle, setting.LDAPPoolMaxOpen
+		idleTimeout, healthCheck := setting.LDAPPoolIdleTimeout, setting.LDAPPoolHealthCheckInterval
+
+		setting.LDAPPoolMaxIdle, setting.LDAPPoolMaxOpen = 2, 0
+		setting.LDAPPoolIdleTimeout, setting.LDAPPoolHealthCheckInterval = 5*time.Minute, 30*time.Second
+
+		clock := time.Date(2019, 10, 15, 10, 0, 0, 0, time.UTC)
+		connections = newPool()
+		connections.now = func() time.Time { return clock }
+		replicas = newReplicaSet()
+
+		Reset(func() {
+			setting.LDAPPoolMaxIdle, setting.LDAPPoolMaxOpen = maxIdle, maxOpen
+			setting.LDAPPoolIdleTimeout, setting.LDAPPoolHealthCheckInterval = idleTimeout, healthCheck
+			connections = newPool()
+			teardown()
+		})
+
+		config := &ldap.ServerConfig{Host: "10.0.0.1"}
+
+		Convey("Should reuse the bound connection across the lookups", func() {
+			mock := setup()
+			mock.usersFirstReturn = []*models.ExternalUserInfo{{Login: "one"}}
+			mock.usersRestReturn = []*models.ExternalUserInfo{{Login: "two"}}
+
+			_, _, err := New([]*ldap.ServerConfig{config}).User("one")
+			So(err, ShouldBeNil)
+
+			_, _, err = New([]*ldap.ServerConfig{config}).User("two")
+			So(err, ShouldBeNil)
+
+			So(mock.dialCalledTimes, ShouldEqual, 1)
+			So(mock.bindCalledTimes, ShouldEqual, 1)
+			So(mock.closeCalledTimes, ShouldEqual, 0)
+		})
+
+		Convey("Should keep the connection of a closed session", func() {
+			mock := setup()
+			mock.usersFirstReturn = []*models.ExternalUserInfo{{Login: "one"}}
+			mock.usersRestReturn = mock.usersFirstReturn
+
+			session := NewSession([]*ldap.ServerConfig{config})
+			_, _, err := session.User("one")
+			So(err, ShouldBeNil)
+			session.Close()
+
+			_, _, err = New([]*ldap.ServerConfig{config}).User("one")
+			So(err, ShouldBeNil)
+
+			So(mock.dialCalledTimes, ShouldEqual, 1)
+			So(mock.closeCalledTimes, ShouldEqual, 0)
+		})
+
+		Convey("Should bind the connection again when its health check is due", func() {
+			mock := setup()
+			mock.usersFirstReturn = []*models.ExternalUserInfo{{Login: "one"}}
+			mock.usersRestReturn = mock.usersFirstReturn
+
+			_, _, err := New([]*ldap.ServerConfig{config}).User("one")
+			So(err, ShouldBeNil)
+
+			clock = clock.Add(time.Minute)
+
+			_, _, err = New([]*ldap.ServerConfig{config}).User("one")
+			So(err, ShouldBeNil)
+
+			So(mock.dialCalledTimes, ShouldEqual, 1)
+			So(mock.bindCalledTimes, ShouldEqual, 2)
+		})
+
+		Convey("Should dial again when the health check fails", func() {
+			mock := setup()
+			mock.usersFirstReturn = []*models.ExternalUserInfo{{Login: "one"}}
+			mock.usersRestReturn = mock.usersFirstReturn
+
+			_, _, err := New([]*ldap.ServerConfig{config}).User("one")
+			So(err, ShouldBeNil)
+
+			clock = clock.Add(time.Minute)
+			mock.bindErrReturn = errors.New("Bind error")
+
+			server, reused, dialErr, bindErr := connections.get(config, &Timings{}, false)
+
+			So(server, ShouldEqual, mock)
+			So(reused, ShouldBeFalse)
+			So(dialErr, ShouldBeNil)
+			So(bindErr, ShouldBeNil)
+			So(mock.dialCalledTimes, ShouldEqual, 2)
+			So(mock.closeCalledTimes, ShouldEqual, 1)
+		})
+
+		Convey("Should bind the connection of a login again before its reuse", func() {
+			mock := setup()
+			mock.loginReturn = &models.ExternalUserInfo{Login: "one"}
+			mock.usersFirstReturn = []*models.ExternalUserInfo{{Login: "one"}}
+			mock.usersRestReturn = mock.usersFirstReturn
+
+			_, err := New([]*ldap.ServerConfig{config}).Login(&models.LoginUserQuery{Username: "one"})
+			So(err, ShouldBeNil)
+			So(mock.bindCalledTimes, ShouldEqual, 0)
+
+			_, _, err = New([]*ldap.ServerConfig{config}).User("one")
+			So(err, ShouldBeNil)
+
+			So(mock.dialCalledTimes, ShouldEqual, 1)
+			So(mock.bindCalledTimes, ShouldEqual, 1)
+		})
+
+		Convey("Should close the connection of a login timing out instead of keeping it", func() {
+			mock := setup()
+			mock.loginErrReturn = ldap.ErrBindTimeout
+			mock.abandonedReturn = true
+
+			_, err := New([]*ldap.ServerConfig{config}).Login(&models.LoginUserQuery{Username: "one"})
+			So(err, ShouldNotBeNil)
+
+			So(mock.dialCalledTimes, ShouldEqual, 1)
+			So(mock.closeCalledTimes, ShouldEqual, 1)
+			So(connections.idle[config], ShouldBeEmpty)
+			So(connections.open[config], ShouldEqual, 0)
+		})
+
+		Convey("Should close the connection to the server of a copied config instead of keeping it", func() {
+			mock := setup()
+			mock.usersFirstReturn = []*models.ExternalUserInfo{{Login: "one"}}
+
+			copied := config.Copy()
+
+			_, _, err := New([]*ldap.ServerConfig{copied}).User("one")
+			So(err, ShouldBeNil)
+
+			So(mock.closeCalledTimes, ShouldEqual, 1)
+			So(connections.idle, ShouldBeEmpty)
+			So(connections.open, ShouldBeEmpty)
+		})
+
+		Convey("Should close the connections idle for too long", func() {
+			mock := setup()
+			mock.usersFirstReturn = []*models.ExternalUserInfo{{Login: "one"}}
+			mock.usersRestReturn = mock.usersFirstReturn
+
+			_, _, err := New([]*ldap.ServerConfig{config}).User("one")
+			So(err, ShouldBeNil)
+
+			clock = clock.Add(10 * time.Minute)
+
+			_, _, err = New([]*ldap.ServerConfig{config}).User("one")
+			So(err, ShouldBeNil)
+
+			So(mock.dialCalledTimes, ShouldEqual, 2)
+			So(mock.closeCalledTimes, ShouldEqual, 1)
+		})
+
+		Convey("Should close the connections beyond pool_max_idle", func() {
+			mock := setup()
+			setting.LDAPPoolMaxIdle = 1
+
+			first, _, _, _ := connections.get(config, &Timings{}, true)
+			second, _, _, _ := connections.get(config, &Timings{}, true)
+
+			connections.put(config, first, false)
+			connections.put(config, second, false)
+
+			So(mock.dialCalledTimes, ShouldEqual, 2)
+			So(mock.closeCalledTimes, ShouldEqual, 1)
+			So(connections.idle[config], ShouldHaveLength, 1)
+		})
+
+		Convey("Should wait for a connection when pool_max_open are open", func() {
+			mock := setup()
+			setting.LDAPPoolMaxOpen = 1
+
+			first, _, _, _ := connections.get(config, &Timings{}, true)
+
+			got := make(chan ldap.IServer)
+			go func() {
+				server, _, _, _ := connections.get(config, &Timings{}, true)
+				got <- server
+			}()
+
+			select {
+			case <-got:
+				t.Fatal("got a connection beyond pool_max_open")
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			connections.put(config, first, false)
+
+			select {
+			case server := <-got:
+				So(server, ShouldEqual, mock)
+			case <-time.After(time.Second):
+				t.Fatal("didn't get the released connection")
+			}
+
+			So(mock.dialCalledTimes, ShouldEqual, 1)
+		})
+
+		Convey("Should close every connection when disabled", func() {
+			mock := setup()
+			setting.LDAPPoolMaxIdle = 0
+			mock.usersFirstReturn = []*models.ExternalUserInfo{{Login: "one"}}
+			mock.usersRestReturn = mock.usersFirstReturn
+
+			_, _, err := New([]*ldap.ServerConfig{config}).User("one")
+			So(err, ShouldBeNil)
+
+			_, _, err = New([]*ldap.ServerConfig{config}).User("one")
+			So(err, ShouldBeNil)
+
+			So(mock.dialCalledTimes, ShouldEqual, 2)
+			So(mock.closeCalledTimes, ShouldEqual, 2)
+			So(connections.open, ShouldBeEmpty)
+		})
+
+		Convey("Should close the connections when cycled", func() {
+			mock := setup()
+
+			idle, _, _, _ := connections.get(config, &Timings{}, true)
+			inUse, _, _, _ := connections.get(config, &Timings{}, true)
+			connections.put(config, idle, false)
+
+			CycleConnections()
+
+			So(mock.closeCalledTimes, ShouldEqual, 1)
+			So(connections.idle, ShouldBeEmpty)
+
+			// the connection in use is closed once given back
+			connections.put(config, inUse, false)
+
+			So(mock.closeCalledTimes, ShouldEqual, 2)
+			So(connections.open, ShouldBeEmpty)
+			So(connections.retired, ShouldBeEmpty)
+
+			// the connections dialed since are pooled again
+			server, _, _, _ := connections.get(config, &Timings{}, true)
+			connections.put(config, server, false)
+
+			So(mock.dialCalledTimes, ShouldEqual, 3)
+			So(connections.idle[config], ShouldHaveLength, 1)
+		})
+	})
+}
@@ -0,0 +1,265 @@
+package multildap
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/services/ldap"
+)
+
+// replicaDownTTL is how long a failed ping or dial marks a server as down
+const replicaDownTTL = time.Minute
+
+// replicas tracks the health of the servers and spreads the requests across the replicas
+var replicas = newReplicaSet()
+
+// ErrQuarantined is the dial error of a quarantined server, which isn't dialed, see quarantine_after
+var ErrQuarantined = errors.New("The LDAP server is quarantined after failing repeatedly")
+
+// replicaSet spreads the requests across the healthy servers of each replica group, following the replica_strategy
+// of the group, and quarantines the servers failing repeatedly
+type replicaSet struct {
+	lock sync.Mutex
+	now  func() time.Time
+
+	// down holds the time each server was last seen down
+	down map[string]time.Time
+
+	// next is the round robin position of each replica group
+	next map[string]int
+
+	// active is the server of each replica group which last answered, for the failover strategy
+	active map[string]string
+
+	// latency is the last dial latency of each server, for the lowest latency strategy
+	latency map[string]time.Duration
+
+	// failures counts the failed pings and dials in a row of each server,
+	// quarantined holds the end of the quarantine of the servers failing repeatedly
+	failures    map[string]int
+	quarantined map[string]time.Time
+}
+
+func newReplicaSet() *replicaSet {
+	return &replicaSet{
+		now:         time.Now,
+		down:        map[string]time.Time{},
+		next:        map[string]int{},
+		active:      map[string]string{},
+		latency:     map[string]time.Duration{},
+		failures:    map[string]int{},
+		quarantined: map[string]time.Time{},
+	}
+}
+
+// serverAddress identifies the server
+func serverAddress(config *ldap.ServerConfig) string {
+	return fmt.Sprintf("%s:%d", config.Host, config.Port)
+}
+
+// markDown records that the server couldn't be reached, it's quarantined once it failed quarantine_after times in a row
+func (set *replicaSet) markDown(config *ldap.ServerConfig) {
+	set.lock.Lock()
+	defer set.lock.Unlock()
+
+	address := serverAddress(config)
+	set.down[address] = set.now()
+	set.failures[address]++
+
+	if config.QuarantineAfter == 0 || set.failures[address] < config.QuarantineAfter || set.isQuarantined(config) {
+		return
+	}
+
+	set.quarantined[address] = set.now().Add(config.QuarantineFor())
+	logger.Warn(
+		"Quarantining the LDAP server failing repeatedly",
+		"host", config.Host,
+		"port", config.Port,
+		"failures", set.failures[address],
+		"duration", config.QuarantineFor(),
+	)
+}
+
+// markUp records that the server was reached, which ends its quarantine.
+// It becomes the active replica of its group unless the active one is still up.
+func (set *replicaSet) markUp(config *ldap.ServerConfig) {
+	set.lock.Lock()
+	defer set.lock.Unlock()
+
+	address := serverAddress(config)
+	delete(set.down, address)
+	delete(set.failures, address)
+	delete(set.quarantined, address)
+
+	if config.ReplicaGroup == "" {
+		return
+	}
+
+	active, ok := set.active[config.ReplicaGroup]
+	if !ok || set.isAddressDown(active) {
+		set.active[config.ReplicaGroup] = address
+	}
+}
+
+// recordLatency records how long the dial of the server took
+func (set *replicaSet) recordLatency(config *ldap.ServerConfig, latency time.Duration) {
+	set.lock.Lock()
+	defer set.lock.Unlock()
+
+	set.latency[serverAddress(config)] = latency
+}
+
+// quarantinedUntil returns the end of the quarantine of the server, the zero time if it isn't quarantined
+func (set *replicaSet) quarantinedUntil(config *ldap.ServerConfig) time.Time {
+	set.lock.Lock()
+	defer set.lock.Unlock()
+
+	if !set.isQuarantined(config) {
+		return time.Time{}
+	}
+
+	return set.quarantined[serverAddress(config)]
+}
+
+// isQuarantined checks if the server is quarantined, the caller holds the lock
+func (set *replicaSet) isQuarantined(config *ldap.ServerConfig) bool {
+	until, ok := set.quarantined[serverAddress(config)]
+
+	return ok && set.now().Before(until)
+}
+
+// isDown checks if the server was seen down recently or is quarantined, the caller holds the lock
+func (set *replicaSet) isDown(config *ldap.ServerConfig) bool {
+	return set.isAddressDown(serverAddress(config)) || set.isQuarantined(config)
+}
+
+// isAddressDown checks if the server at the address was seen down recently, the caller holds the lock
+func (set *replicaSet) isAddressDown(address string) bool {
+	since, ok := set.down[address]
+
+	return ok && set.now().Sub(since) < replicaDownTTL
+}
+
+// order returns the servers in the order they should be tried.
+// The replicas of a group take the position of the first one: the healthy ones
+// first, ordered by the replica_strategy of the group unless the login prefers
+// the configured order, then the ones down, as a last resort.
+func (set *replicaSet) order(configs []*ldap.ServerConfig, login bool) []*ldap.ServerConfig {
+	set.lock.Lock()
+	defer set.lock.Unlock()
+
+	groups := map[string][]*ldap.ServerConfig{}
+	inOrder := map[string]bool{}
+	strategies := map[string]string{}
+
+	for _, config := range configs {
+		if config.ReplicaGroup == "" {
+			continue
+		}
+
+		groups[config.ReplicaGroup] = append(groups[config.ReplicaGroup], config)
+		if config.ReplicaLoginInOrder {
+			inOrder[config.ReplicaGroup] = true
+		}
+
+		if strategies[config.ReplicaGroup] == "" {
+			strategies[config.ReplicaGroup] = config.ReplicaStrategy
+		}
+	}
+
+	if len(groups) == 0 {
+		return configs
+	}
+
+	result := make([]*ldap.ServerConfig, 0, len(configs))
+	placed := map[string]bool{}
+
+	for _, config := range configs {
+		group := config.ReplicaGroup
+		if group == "" {
+			result = append(result, config)
+			continue
+		}
+
+		if placed[group] {
+			continue
+		}
+		placed[group] = true
+
+		healthy := []*ldap.ServerConfig{}
+		down := []*ldap.ServerConfig{}
+
+		for _, replica := range groups[group] {
+			if set.isDown(replica) {
+				down = append(down, replica)
+			} else {
+				healthy = append(healthy, replica)
+			}
+		}
+
+		if len(healthy) > 1 && !(login && inOrder[group]) {
+			healthy = set.applyStrategy(group, strategies[group], healthy)
+		}
+
+		result = append(result, healthy...)
+		result = append(result, down...)
+	}
+
+	return result
+}
+
+// applyStrategy orders the healthy replicas of the group following its strategy, the caller holds the lock
+func (set *replicaSet) applyStrategy(group, strategy string, healthy []*ldap.ServerConfig) []*ldap.ServerConfig {
+	ordered := make([]*ldap.ServerConfig, 0, len(healthy))
+
+	switch strategy {
+	case ldap.ReplicaStrategyFailover:
+		// the active replica first, then the others in the configured order
+		for _, replica := range healthy {
+			if serverAddress(replica) == set.active[group] {
+				ordered = append(ordered, replica)
+			}
+		}
+
+		for _, replica := range healthy {
+			if serverAddress(replica) != set.active[group] {
+				ordered = append(ordered, replica)
+			}
+		}
+
+	case ldap.ReplicaStrategyLowestLatency:
+		// the replicas never dialed have no latency yet, they are tried first to measure it
+		ordered = append(ordered, healthy...)
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return set.latency[serverAddress(ordered[i])] < set.latency[serverAddress(ordered[j])]
+		})
+
+	default:
+		start := set.next[group] % len(healthy)
+		set.next[group]++
+
+		ordered = append(ordered, healthy[start:]...)
+		ordered = append(ordered, healthy[:start]...)
+	}
+
+	return ordered
+}
+
+// answeredGroups remembers the replica groups which answered a request,
+// their other replicas hold the same entries so they are skipped
+type answeredGroups map[string]bool
+
+// skip checks if another replica of the server already answered
+func (groups answeredGroups) skip(config *ldap.ServerConfig) bool {
+	return config.ReplicaGroup != "" && groups[config.ReplicaGroup]
+}
+
+// add records that the server answered
+func (groups answeredGroups) add(config *ldap.ServerConfig) {
+	if config.ReplicaGroup != "" {
+		groups[config.ReplicaGroup] = true
+	}
+}
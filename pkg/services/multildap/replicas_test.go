@@ -0,0 +1,344 @@
+package multildap
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+)
+
+func TestReplicas(t *testing.T) {
+	Convey("Replicas", t, func() {
+		replicas = newReplicaSet()
+
+		replicaA := &ldap.ServerConfig{Host: "10.0.0.1", Port: 389, ReplicaGroup: "main"}
+		replicaB := &ldap.ServerConfig{Host: "10.0.0.2", Port: 389, ReplicaGroup: "main"}
+		other := &ldap.ServerConfig{Host: "10.0.1.1", Port: 389}
+
+		hosts := func(configs []*ldap.ServerConfig) []string {
+			result := []string{}
+			for _, config := range configs {
+				result = append(result, config.Host)
+			}
+			return result
+		}
+
+		// mockServers dials the servers with their own mock, the ones listed in down can't be dialed
+		mockServers := func(down ...string) *[]string {
+			dialed := &[]string{}
+
+			newLDAP = func(config *ldap.ServerConfig) ldap.IServer {
+				*dialed = append(*dialed, config.Host)
+
+				mock := &MockLDAP{
+					usersFirstReturn: []*models.ExternalUserInfo{{Login: "killa"}},
+					allUsersReturn:   []*models.ExternalUserInfo{{Login: "killa"}},
+					loginReturn:      &models.ExternalUserInfo{Login: "killa"},
+				}
+
+				for _, host := range down {
+					if host == config.Host {
+						mock.dialErrReturn = errors.New("Dial error")
+					}
+				}
+
+				return mock
+			}
+
+			return dialed
+		}
+
+		Convey("order()", func() {
+			Convey("Should keep the servers without replica group in place", func() {
+				configs := []*ldap.ServerConfig{other, {Host: "10.0.1.2"}}
+
+				So(replicas.order(configs, false), ShouldResemble, configs)
+			})
+
+			Convey("Should rotate the replicas round robin", func() {
+				configs := []*ldap.ServerConfig{replicaA, other, replicaB}
+
+				So(hosts(replicas.order(configs, false)), ShouldResemble, []string{"10.0.0.1", "10.0.0.2", "10.0.1.1"})
+				So(hosts(replicas.order(configs, false)), ShouldResemble, []string{"10.0.0.2", "10.0.0.1", "10.0.1.1"})
+				So(hosts(replicas.order(configs, false)), ShouldResemble, []string{"10.0.0.1", "10.0.0.2", "10.0.1.1"})
+			})
+
+			Convey("Should try the replicas down last", func() {
+				configs := []*ldap.ServerConfig{replicaA, replicaB}
+				replicas.markDown(replicaA)
+
+				So(hosts(replicas.order(configs, false)), ShouldResemble, []string{"10.0.0.2", "10.0.0.1"})
+				So(hosts(replicas.order(configs, false)), ShouldResemble, []string{"10.0.0.2", "10.0.0.1"})
+			})
+
+			Convey("Should forget a replica down after a while", func() {
+				configs := []*ldap.ServerConfig{replicaA, replicaB}
+				replicas.markDown(replicaB)
+
+				now := time.Now()
+				replicas.now = func() time.Time { return now.Add(replicaDownTTL) }
+
+				So(hosts(replicas.order(configs, false)), ShouldResemble, []string{"10.0.0.1", "10.0.0.2"})
+				So(hosts(replicas.order(configs, false)), ShouldResemble, []string{"10.0.0.2", "10.0.0.1"})
+			})
+
+			Convey("Should keep the configured order for the login if asked to", func() {
+				inOrderA := &ldap.ServerConfig{Host: "10.0.0.1", ReplicaGroup: "main", ReplicaLoginInOrder: true}
+				inOrderB := &ldap.ServerConfig{Host: "10.0.0.2", ReplicaGroup: "main"}
+				configs := []*ldap.ServerConfig{inOrderA, inOrderB}
+
+				So(hosts(replicas.order(configs, true)), ShouldResemble, []string{"10.0.0.1", "10.0.0.2"})
+				So(hosts(replicas.order(configs, true)), ShouldResemble, []string{"10.0.0.1", "10.0.0.2"})
+
+				So(hosts(replicas.order(configs, false)), ShouldResemble, []string{"10.0.0.1", "10.0.0.2"})
+				So(hosts(replicas.order(configs, false)), ShouldResemble, []string{"10.0.0.2", "10.0.0.1"})
+			})
+
+			Convey("Should stick to the replica which last answered with the failover strategy", func() {
+				failoverA := &ldap.ServerConfig{Host: "10.0.0.1", ReplicaGroup: "main", ReplicaStrategy: ldap.ReplicaStrategyFailover}
+				failoverB := &ldap.ServerConfig{Host: "10.0.0.2", ReplicaGroup: "main"}
+				configs := []*ldap.ServerConfig{failoverA, failoverB}
+
+				So(hosts(replicas.order(configs, false)), ShouldResemble, []string{"10.0.0.1", "10.0.0.2"})
+				So(hosts(replicas.order(configs, false)), ShouldResemble, []string{"10.0.0.1", "10.0.0.2"})
+
+				replicas.markDown(failoverA)
+				replicas.markUp(failoverB)
+
+				So(hosts(replicas.order(configs, false)), ShouldResemble, []string{"10.0.0.2", "10.0.0.1"})
+
+				// the first replica is back, the requests stay on the second one
+				replicas.markUp(failoverA)
+
+				So(hosts(replicas.order(configs, false)), ShouldResemble, []string{"10.0.0.2", "10.0.0.1"})
+			})
+
+			Convey("Should prefer the replica with the lowest latency with the lowest latency strategy", func() {
+				fastest := &ldap.ServerConfig{Host: "10.0.0.1", ReplicaGroup: "main", ReplicaStrategy: ldap.ReplicaStrategyLowestLatency}
+				slowest := &ldap.ServerConfig{Host: "10.0.0.2", ReplicaGroup: "main"}
+				unknown := &ldap.ServerConfig{Host: "10.0.0.3", ReplicaGroup: "main"}
+				configs := []*ldap.ServerConfig{fastest, slowest, unknown}
+
+				replicas.recordLatency(fastest, 5*time.Millisecond)
+				replicas.recordLatency(slowest, 50*time.Millisecond)
+
+				So(hosts(replicas.order(configs, false)), ShouldResemble, []string{"10.0.0.3", "10.0.0.1", "10.0.0.2"})
+
+				replicas.recordLatency(unknown, 80*time.Millisecond)
+
+				So(hosts(replicas.order(configs, false)), ShouldResemble, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"})
+				So(hosts(replicas.order(configs, false)), ShouldResemble, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"})
+			})
+		})
+
+		Convey("Quarantine", func() {
+			quarantined := &ldap.ServerConfig{Host: "10.0.0.1", Port: 389, ReplicaGroup: "main", QuarantineAfter: 2, QuarantineDuration: 120}
+			configs := []*ldap.ServerConfig{quarantined, replicaB}
+
+			Convey("Should quarantine a server after the failed pings in a row", func() {
+				dialed := mockServers("10.0.0.1")
+				multi := New(configs)
+
+				statuses, err := multi.Ping()
+				So(err, ShouldBeNil)
+				So(statuses[0].QuarantinedUntil.IsZero(), ShouldBeTrue)
+
+				statuses, err = multi.Ping()
+				So(err, ShouldBeNil)
+				So(statuses[0].QuarantinedUntil.IsZero(), ShouldBeFalse)
+
+				// the quarantined server isn't dialed by the lookups, even once it's no longer down
+				now := time.Now()
+				replicas.now = func() time.Time { return now.Add(replicaDownTTL) }
+
+				*dialed = []string{}
+				for i := 0; i < 2; i++ {
+					_, _, err := multi.User("killa")
+					So(err, ShouldBeNil)
+				}
+
+				So(*dialed, ShouldResemble, []string{"10.0.0.2", "10.0.0.2"})
+			})
+
+			Convey("Should end the quarantine after its duration", func() {
+				replicas.markDown(quarantined)
+				replicas.markDown(quarantined)
+				So(replicas.quarantinedUntil(quarantined).IsZero(), ShouldBeFalse)
+
+				now := time.Now()
+				replicas.now = func() time.Time { return now.Add(2 * time.Minute) }
+
+				So(replicas.quarantinedUntil(quarantined).IsZero(), ShouldBeTrue)
+			})
+
+			Convey("Should end the quarantine when a ping reaches the server", func() {
+				replicas.markDown(quarantined)
+				replicas.markDown(quarantined)
+
+				mockServers()
+				_, err := New(configs).Ping()
+
+				So(err, ShouldBeNil)
+				So(replicas.quarantinedUntil(quarantined).IsZero(), ShouldBeTrue)
+			})
+
+			Convey("Should report the quarantined servers as unreachable", func() {
+				replicas.markDown(quarantined)
+				replicas.markDown(quarantined)
+
+				mockServers()
+				_, _, err := New([]*ldap.ServerConfig{quarantined}).User("killa")
+
+				So(err, ShouldEqual, ErrUnreachable)
+			})
+
+			Convey("Should never quarantine a server without quarantine_after", func() {
+				for i := 0; i < 10; i++ {
+					replicas.markDown(replicaB)
+				}
+
+				So(replicas.quarantinedUntil(replicaB).IsZero(), ShouldBeTrue)
+			})
+		})
+
+		Convey("User()", func() {
+			Convey("Should spread the lookups across the replicas", func() {
+				dialed := mockServers()
+
+				multi := New([]*ldap.ServerConfig{replicaA, replicaB})
+				for i := 0; i < 4; i++ {
+					user, _, err := multi.User("killa")
+
+					So(err, ShouldBeNil)
+					So(user.Login, ShouldEqual, "killa")
+				}
+
+				So(*dialed, ShouldResemble, []string{"10.0.0.1", "10.0.0.2", "10.0.0.1", "10.0.0.2"})
+			})
+
+			Convey("Should avoid the replica marked down by the ping", func() {
+				dialed := mockServers("10.0.0.2")
+
+				multi := New([]*ldap.ServerConfig{replicaA, replicaB})
+				_, err := multi.Ping()
+				So(err, ShouldBeNil)
+
+				*dialed = []string{}
+				for i := 0; i < 3; i++ {
+					_, _, err := multi.User("killa")
+					So(err, ShouldBeNil)
+				}
+
+				So(*dialed, ShouldResemble, []string{"10.0.0.1", "10.0.0.1", "10.0.0.1"})
+			})
+
+			Convey("Should fall back to the other replica when the dial fails", func() {
+				dialed := mockServers("10.0.0.1")
+
+				multi := New([]*ldap.ServerConfig{replicaA, replicaB})
+				user, config, err := multi.User("killa")
+
+				So(err, ShouldBeNil)
+				So(user.Login, ShouldEqual, "killa")
+				So(config.Host, ShouldEqual, "10.0.0.2")
+				So(*dialed, ShouldResemble, []string{"10.0.0.1", "10.0.0.2"})
+
+				*dialed = []string{}
+				_, _, err = multi.User("killa")
+
+				So(err, ShouldBeNil)
+				So(*dialed, ShouldResemble, []string{"10.0.0.2"})
+			})
+
+			Convey("Should list the servers attempted by the failover", func() {
+				mockServers("10.0.0.1")
+
+				multi := New([]*ldap.ServerConfig{replicaA, replicaB, other})
+				_, _, attempts, err := multi.UserWithAttempts("killa")
+
+				So(err, ShouldBeNil)
+				So(len(attempts), ShouldEqual, 2)
+				So(attempts[0].Host, ShouldEqual, "10.0.0.1")
+				So(attempts[0].Outcome, ShouldEqual, AttemptUnreachable)
+				So(attempts[0].Error, ShouldNotBeNil)
+				So(attempts[1], ShouldResemble, &ServerAttempt{Host: "10.0.0.2", Port: 389, Outcome: AttemptFound, ReplicaGroup: "main", MatchCount: 1, SearchFilter: "(|)"})
+			})
+
+			Convey("Should list the replicas skipped after their group answered", func() {
+				newLDAP = func(config *ldap.ServerConfig) ldap.IServer {
+					return &MockLDAP{}
+				}
+
+				multi := New([]*ldap.ServerConfig{replicaA, replicaB, other})
+				_, _, attempts, err := multi.UserWithAttempts("killa")
+
+				So(err, ShouldEqual, ErrDidNotFindUser)
+				So(attempts, ShouldResemble, []*ServerAttempt{
+					{Host: "10.0.0.1", Port: 389, Outcome: AttemptNotFound, ReplicaGroup: "main", SearchFilter: "(|)"},
+					{Host: "10.0.0.2", Port: 389, Outcome: AttemptSkipped, ReplicaGroup: "main"},
+					{Host: "10.0.1.1", Port: 389, Outcome: AttemptNotFound, SearchFilter: "(|)"},
+				})
+				So(UnansweredServers(attempts), ShouldBeEmpty)
+			})
+
+			Convey("Should not search the other replicas when the user isn't found", func() {
+				dialed := &[]string{}
+				newLDAP = func(config *ldap.ServerConfig) ldap.IServer {
+					*dialed = append(*dialed, config.Host)
+					return &MockLDAP{}
+				}
+
+				multi := New([]*ldap.ServerConfig{replicaA, replicaB, other})
+				_, _, err := multi.User("killa")
+
+				So(err, ShouldEqual, ErrDidNotFindUser)
+				So(*dialed, ShouldResemble, []string{"10.0.0.1", "10.0.1.1"})
+			})
+		})
+
+		Convey("Login()", func() {
+			Convey("Should spread the logins across the replicas", func() {
+				dialed := mockServers()
+
+				multi := New([]*ldap.ServerConfig{replicaA, replicaB})
+				for i := 0; i < 2; i++ {
+					_, err := multi.Login(&models.LoginUserQuery{})
+					So(err, ShouldBeNil)
+				}
+
+				So(*dialed, ShouldResemble, []string{"10.0.0.1", "10.0.0.2"})
+			})
+		})
+
+		Convey("AllUsers()", func() {
+			Convey("Should get the users from a single replica", func() {
+				dialed := mockServers()
+
+				multi := New([]*ldap.ServerConfig{replicaA, replicaB})
+				users, _, err := multi.AllUsers()
+
+				So(err, ShouldBeNil)
+				So(users, ShouldHaveLength, 1)
+				So(*dialed, ShouldResemble, []string{"10.0.0.1"})
+			})
+
+			Convey("Should return the dial error when none of the replicas answer", func() {
+				mockServers("10.0.0.1", "10.0.0.2")
+
+				multi := New([]*ldap.ServerConfig{replicaA, replicaB})
+				_, _, err := multi.AllUsers()
+
+				So(err, ShouldBeError, "Dial error")
+			})
+		})
+
+		Reset(func() {
+			replicas = newReplicaSet()
+			teardown()
+		})
+	})
+}
@@ -0,0 +1,49 @@
+package multildap
+
+import (
+	"time"
+
+	goldap "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// isTransientConnectError checks if connecting to a server failed because of an error which may go away by itself,
+// like a dropped connection or a busy server, so connecting again may succeed. A hostname which can't be resolved,
+// an invalid certificate or refused credentials won't get better with a retry.
+func isTransientConnectError(dialErr error, bindErr error) bool {
+	if dialErr != nil {
+		if dialErr == ErrQuarantined {
+			return false
+		}
+
+		category, _ := classifyDialError(dialErr)
+		return category != DialErrorDNS && category != DialErrorCertificate
+	}
+
+	if bindErr == ldap.ErrBindTimeout {
+		return true
+	}
+
+	if ldapErr, ok := bindErr.(*goldap.Error); ok {
+		switch ldapErr.ResultCode {
+		case goldap.ErrorNetwork, goldap.LDAPResultBusy, goldap.LDAPResultUnavailable:
+			return true
+		}
+	}
+
+	return false
+}
+
+// connectRetryBackoff returns how long to wait before the given retry to connect to a server. The backoff doubles
+// from the dial_retry_backoff setting with every retry, and is jittered by up to half of it, so the Grafana instances
+// hit by the same outage don't all retry at once.
+func connectRetryBackoff(retry int) time.Duration {
+	backoff := setting.LDAPDialRetryBackoff
+	for i := 1; i < retry; i++ {
+		backoff *= 2
+	}
+
+	return backoff/2 + randomDuration(backoff/2+1)
+}
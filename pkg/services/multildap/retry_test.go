@@ -0,0 +1,147 @@
+package multildap
+
+import (
+	"crypto/x509"
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	goldap "gopkg.in/ldap.v3"
+
+	"github.com/grafana/grafana/pkg/services/ldap"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestConnectRetries(t *testing.T) {
+	Convey("isTransientConnectError()", t, func() {
+		reset := &net.OpError{Op: "read", Err: &net.OpError{Op: "dial", Err: syscall.ECONNRESET}}
+
+		So(isTransientConnectError(reset, nil), ShouldBeTrue)
+		So(isTransientConnectError(&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, nil), ShouldBeTrue)
+		So(isTransientConnectError(nil, ldap.ErrBindTimeout), ShouldBeTrue)
+		So(isTransientConnectError(nil, &goldap.Error{ResultCode: goldap.LDAPResultBusy}), ShouldBeTrue)
+		So(isTransientConnectError(nil, &goldap.Error{ResultCode: goldap.ErrorNetwork}), ShouldBeTrue)
+
+		So(isTransientConnectError(nil, nil), ShouldBeFalse)
+		So(isTransientConnectError(&net.DNSError{Name: "ldap.example.org"}, nil), ShouldBeFalse)
+		So(isTransientConnectError(x509.UnknownAuthorityError{}, nil), ShouldBeFalse)
+		So(isTransientConnectError(ErrQuarantined, nil), ShouldBeFalse)
+		So(isTransientConnectError(nil, ErrInvalidCredentials), ShouldBeFalse)
+		So(isTransientConnectError(nil, errors.New("Killa Gorilla")), ShouldBeFalse)
+	})
+
+	Convey("connectRetryBackoff()", t, func() {
+		backoff, random := setting.LDAPDialRetryBackoff, randomDuration
+		setting.LDAPDialRetryBackoff = 100 * time.Millisecond
+
+		Reset(func() {
+			setting.LDAPDialRetryBackoff = backoff
+			randomDuration = random
+		})
+
+		Convey("Should double the backoff with every retry, jittered by up to half of it", func() {
+			randomDuration = func(max time.Duration) time.Duration { return 0 }
+
+			So(connectRetryBackoff(1), ShouldEqual, 50*time.Millisecond)
+			So(connectRetryBackoff(2), ShouldEqual, 100*time.Millisecond)
+			So(connectRetryBackoff(3), ShouldEqual, 200*time.Millisecond)
+
+			randomDuration = func(max time.Duration) time.Duration { return max - 1 }
+
+			So(connectRetryBackoff(1), ShouldEqual, 100*time.Millisecond)
+			So(connectRetryBackoff(3), ShouldEqual, 400*time.Millisecond)
+		})
+	})
+
+	Convey("Connecting to a server", t, func() {
+		retries := setting.LDAPDialRetries
+		setting.LDAPDialRetries = 2
+
+		connections = newPool()
+		replicas = newReplicaSet()
+
+		var waits []time.Duration
+		sleep = func(d time.Duration) {
+			waits = append(waits, d)
+		}
+
+		Reset(func() {
+			setting.LDAPDialRetries = retries
+			sleep = time.Sleep
+			connections = newPool()
+			teardown()
+		})
+
+		config := &ldap.ServerConfig{Host: "10.0.0.1"}
+		reset := &net.OpError{Op: "dial", Err: syscall.ECONNRESET}
+
+		Convey("Should dial again after a transient failure", func() {
+			mock := setup()
+			mock.dialErrReturn = reset
+
+			sleep = func(d time.Duration) {
+				waits = append(waits, d)
+				mock.dialErrReturn = nil
+			}
+
+			server, _, dialErr, bindErr := connections.get(config, &Timings{}, true)
+
+			So(dialErr, ShouldBeNil)
+			So(bindErr, ShouldBeNil)
+			So(server, ShouldEqual, mock)
+			So(mock.dialCalledTimes, ShouldEqual, 2)
+			So(waits, ShouldHaveLength, 1)
+		})
+
+		Convey("Should give up after the retries", func() {
+			mock := setup()
+			mock.dialErrReturn = reset
+
+			_, _, dialErr, _ := connections.get(config, &Timings{}, true)
+
+			So(dialErr, ShouldEqual, reset)
+			So(mock.dialCalledTimes, ShouldEqual, 3)
+			So(waits, ShouldHaveLength, 2)
+			So(connections.open, ShouldBeEmpty)
+		})
+
+		Convey("Should dial and bind again when the server is busy", func() {
+			mock := setup()
+			mock.bindErrReturn = &goldap.Error{ResultCode: goldap.LDAPResultBusy}
+
+			_, _, dialErr, bindErr := connections.get(config, &Timings{}, true)
+
+			So(dialErr, ShouldBeNil)
+			So(bindErr, ShouldEqual, mock.bindErrReturn)
+			So(mock.dialCalledTimes, ShouldEqual, 3)
+			So(mock.bindCalledTimes, ShouldEqual, 3)
+			So(mock.closeCalledTimes, ShouldEqual, 2)
+		})
+
+		Convey("Should not retry the failures which won't go away", func() {
+			mock := setup()
+			mock.dialErrReturn = &net.DNSError{Name: "ldap.example.org"}
+
+			_, _, dialErr, _ := connections.get(config, &Timings{}, true)
+
+			So(dialErr, ShouldNotBeNil)
+			So(mock.dialCalledTimes, ShouldEqual, 1)
+			So(waits, ShouldBeEmpty)
+		})
+
+		Convey("Should not retry without dial_retries", func() {
+			setting.LDAPDialRetries = 0
+
+			mock := setup()
+			mock.dialErrReturn = reset
+
+			_, _, dialErr, _ := connections.get(config, &Timings{}, true)
+
+			So(dialErr, ShouldEqual, reset)
+			So(mock.dialCalledTimes, ShouldEqual, 1)
+		})
+	})
+}
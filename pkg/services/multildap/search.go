@@ -0,0 +1,77 @@
+package multildap
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/services/ldap"
+)
+
+// ErrUnknownServer is returned when none of the LDAP servers match the host of an ad hoc search
+var ErrUnknownServer = errors.New("No LDAP server matches the host")
+
+// SearchResult is the result of an ad hoc search on a LDAP server
+type SearchResult struct {
+	Host string
+	Port int
+
+	Entries []*ldap.SearchEntry
+
+	// Truncated is set when the size limit truncated the entries
+	Truncated bool
+}
+
+// Search runs an ad hoc search on the server of the host, either its "host" or its "host:port", the first server
+// if empty. See ldap.Server.Search.
+func (multiples *MultiLDAP) Search(host, baseDN, filter string, attributes []string, sizeLimit int) (*SearchResult, error) {
+	if len(multiples.configs) == 0 {
+		return nil, ErrNoLDAPServers
+	}
+
+	config := findServerConfig(multiples.configs, host)
+	if config == nil {
+		return nil, ErrUnknownServer
+	}
+
+	server := newLDAP(config)
+	if err := server.Dial(); err != nil {
+		logDialFailure(err, config)
+		return nil, ErrUnreachable
+	}
+
+	defer server.Close()
+	replicas.markUp(config)
+
+	if err := server.Bind(); err != nil {
+		return nil, err
+	}
+
+	entries, truncated, err := server.Search(baseDN, filter, attributes, sizeLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SearchResult{
+		Host:      config.Host,
+		Port:      config.Port,
+		Entries:   entries,
+		Truncated: truncated,
+	}, nil
+}
+
+// findServerConfig returns the config of the server of the host, either its "host" or its "host:port",
+// the first one if the host is empty
+func findServerConfig(configs []*ldap.ServerConfig, host string) *ldap.ServerConfig {
+	if host == "" {
+		return configs[0]
+	}
+
+	for _, config := range configs {
+		if strings.EqualFold(config.Host, host) || strings.EqualFold(fmt.Sprintf("%s:%d", config.Host, config.Port), host) {
+			return config
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package multildap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/grafana/grafana/pkg/services/ldap"
+)
+
+func TestSearch(t *testing.T) {
+	Convey("Search()", t, func() {
+		mock := setup()
+		Reset(teardown)
+
+		var searched *ldap.ServerConfig
+		newLDAP = func(config *ldap.ServerConfig) ldap.IServer {
+			searched = config
+			return mock
+		}
+
+		mock.searchProvider = func(baseDN, filter string, attributes []string, sizeLimit int) ([]*ldap.SearchEntry, bool, error) {
+			return []*ldap.SearchEntry{{DN: "cn=john," + baseDN}}, sizeLimit == 1, nil
+		}
+
+		multi := New([]*ldap.ServerConfig{
+			{Host: "10.0.0.1", Port: 389},
+			{Host: "10.0.0.2", Port: 389},
+			{Host: "10.0.0.2", Port: 636},
+		})
+
+		Convey("Should search the first server without host", func() {
+			result, err := multi.Search("", "dc=grafana,dc=org", "(cn=john)", nil, 1)
+
+			So(err, ShouldBeNil)
+			So(searched.Host, ShouldEqual, "10.0.0.1")
+			So(result.Host, ShouldEqual, "10.0.0.1")
+			So(result.Entries[0].DN, ShouldEqual, "cn=john,dc=grafana,dc=org")
+			So(result.Truncated, ShouldBeTrue)
+			So(mock.bindCalledTimes, ShouldEqual, 1)
+			So(mock.closeCalledTimes, ShouldEqual, 1)
+		})
+
+		Convey("Should search the server of the host and port", func() {
+			result, err := multi.Search("10.0.0.2:636", "dc=grafana,dc=org", "(cn=john)", nil, 10)
+
+			So(err, ShouldBeNil)
+			So(result.Port, ShouldEqual, 636)
+			So(result.Truncated, ShouldBeFalse)
+		})
+
+		Convey("Should refuse the unknown hosts", func() {
+			_, err := multi.Search("10.0.0.3", "dc=grafana,dc=org", "(cn=john)", nil, 10)
+
+			So(err, ShouldEqual, ErrUnknownServer)
+			So(mock.dialCalledTimes, ShouldEqual, 0)
+		})
+
+		Convey("Should report the unreachable servers", func() {
+			mock.dialErrReturn = ldap.ErrBindTimeout
+
+			_, err := multi.Search("10.0.0.1", "dc=grafana,dc=org", "(cn=john)", nil, 10)
+
+			So(err, ShouldEqual, ErrUnreachable)
+		})
+	})
+}
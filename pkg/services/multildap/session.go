@@ -0,0 +1,122 @@
+package multildap
+
+import (
+	"sync"
+
+	"github.com/grafana/grafana/pkg/services/ldap"
+)
+
+// session holds the bound connection to each of the servers, reused across the user lookups
+type session struct {
+	mu      sync.Mutex
+	servers map[*ldap.ServerConfig]ldap.IServer
+
+	// dials serializes the dials to each server, so the concurrent lookups share a single connection
+	dials map[*ldap.ServerConfig]*sync.Mutex
+}
+
+// NewSession returns a MultiLDAP reusing a single bound connection to each server for all its user lookups,
+// so a request looking up several users only connects and binds once. The user binds of the logins
+// aren't done on the shared connections. Close() closes the connections, even after a failed lookup.
+func NewSession(configs []*ldap.ServerConfig) IMultiLDAP {
+	return &MultiLDAP{
+		configs: configs,
+		session: &session{
+			servers: map[*ldap.ServerConfig]ldap.IServer{},
+			dials:   map[*ldap.ServerConfig]*sync.Mutex{},
+		},
+	}
+}
+
+// get returns the bound connection to the server, if any
+func (session *session) get(config *ldap.ServerConfig) ldap.IServer {
+	if session == nil {
+		return nil
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	return session.servers[config]
+}
+
+// lockDial waits for the concurrent dial to the server, if any, and returns the func ending the dial
+func (session *session) lockDial(config *ldap.ServerConfig) func() {
+	if session == nil {
+		return func() {}
+	}
+
+	session.mu.Lock()
+	dial, ok := session.dials[config]
+	if !ok {
+		dial = &sync.Mutex{}
+		session.dials[config] = dial
+	}
+	session.mu.Unlock()
+
+	dial.Lock()
+	return dial.Unlock
+}
+
+// put keeps the bound connection to the server, it returns false if a concurrent lookup already kept one
+func (session *session) put(config *ldap.ServerConfig, server ldap.IServer) bool {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	if _, ok := session.servers[config]; ok {
+		return false
+	}
+
+	session.servers[config] = server
+	return true
+}
+
+// close gives back all the connections of the session to the pool, which closes them unless it keeps them idle
+func (session *session) close() {
+	if session == nil {
+		return
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	for config, server := range session.servers {
+		connections.put(config, server, false)
+		delete(session.servers, config)
+	}
+}
+
+// Close closes the connections kept by the session, see NewSession. It's a no-op for the other MultiLDAPs.
+func (multiples *MultiLDAP) Close() {
+	multiples.session.close()
+}
+
+// connect dials and binds the server, adding the time spent to the timings. The connection bound by the session
+// is reused instead, or else an idle one of the pool. The returned release func must be called once done with the
+// server, unless the dial failed: it gives back the connection to the pool, unless the session keeps it.
+// The concurrent lookups of a session wait for the first dial to the server, so they never open more than one connection.
+func (multiples *MultiLDAP) connect(config *ldap.ServerConfig, timings *Timings) (
+	server ldap.IServer, release func(), dialErr error, bindErr error,
+) {
+	endDial := multiples.session.lockDial(config)
+	defer endDial()
+
+	if server := multiples.session.get(config); server != nil {
+		return server, func() {}, nil, nil
+	}
+
+	server, _, dialErr, bindErr = connections.get(config, timings, true)
+	if dialErr != nil {
+		return nil, nil, dialErr, nil
+	}
+
+	if bindErr != nil {
+		return server, func() { connections.discard(config, server) }, nil, bindErr
+	}
+
+	if multiples.session == nil || !multiples.session.put(config, server) {
+		return server, func() { connections.put(config, server, false) }, nil, nil
+	}
+
+	return server, func() {}, nil, nil
+}
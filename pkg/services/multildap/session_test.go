@@ -0,0 +1,136 @@
+package multildap
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSession(t *testing.T) {
+	Convey("NewSession()", t, func() {
+		replicas = newReplicaSet()
+
+		Reset(func() {
+			teardown()
+		})
+
+		Convey("Should connect and bind once for all the lookups", func() {
+			mock := setup()
+			mock.usersFirstReturn = []*models.ExternalUserInfo{{Login: "one"}}
+			mock.usersRestReturn = []*models.ExternalUserInfo{{Login: "two"}}
+
+			multi := NewSession([]*ldap.ServerConfig{{Host: "10.0.0.1"}})
+
+			_, _, err := multi.User("one")
+			So(err, ShouldBeNil)
+
+			_, _, _, err = multi.UserWithAttempts("two")
+			So(err, ShouldBeNil)
+
+			_, err = multi.Users([]string{"one", "two"})
+			So(err, ShouldBeNil)
+
+			So(mock.usersCalledTimes, ShouldEqual, 3)
+			So(mock.dialCalledTimes, ShouldEqual, 1)
+			So(mock.bindCalledTimes, ShouldEqual, 1)
+			So(mock.closeCalledTimes, ShouldEqual, 0)
+
+			multi.Close()
+
+			So(mock.closeCalledTimes, ShouldEqual, 1)
+		})
+
+		Convey("Should close the connection after a failed lookup", func() {
+			mock := setup()
+			mock.usersErrReturn = errors.New("Users error")
+
+			multi := NewSession([]*ldap.ServerConfig{{Host: "10.0.0.1"}})
+
+			_, _, err := multi.User("one")
+			So(err, ShouldNotBeNil)
+
+			multi.Close()
+
+			So(mock.closeCalledTimes, ShouldEqual, 1)
+		})
+
+		Convey("Should not keep the connections which failed to bind", func() {
+			mock := setup()
+			mock.bindErrReturn = errors.New("Bind error")
+
+			multi := NewSession([]*ldap.ServerConfig{{Host: "10.0.0.1"}})
+
+			_, _, err := multi.User("one")
+			So(err, ShouldEqual, mock.bindErrReturn)
+
+			_, _, err = multi.User("two")
+			So(err, ShouldEqual, mock.bindErrReturn)
+
+			So(mock.dialCalledTimes, ShouldEqual, 2)
+			So(mock.closeCalledTimes, ShouldEqual, 2)
+
+			multi.Close()
+
+			So(mock.closeCalledTimes, ShouldEqual, 2)
+		})
+
+		Convey("Should share a single connection between concurrent lookups", func() {
+			var lock sync.Mutex
+			dials := 0
+
+			newLDAP = func(config *ldap.ServerConfig) ldap.IServer {
+				lock.Lock()
+				dials++
+				lock.Unlock()
+
+				// a slow dial, the concurrent lookups would dial meanwhile
+				time.Sleep(10 * time.Millisecond)
+
+				users := []*models.ExternalUserInfo{{Login: "user"}}
+				return &MockLDAP{usersFirstReturn: users, usersRestReturn: users}
+			}
+
+			multi := NewSession([]*ldap.ServerConfig{{Host: "10.0.0.1"}})
+
+			var lookups sync.WaitGroup
+			for i := 0; i < 5; i++ {
+				lookups.Add(1)
+
+				go func(login string) {
+					defer lookups.Done()
+					_, _, _ = multi.User(login)
+				}(fmt.Sprintf("user%d", i))
+			}
+			lookups.Wait()
+
+			So(dials, ShouldEqual, 1)
+		})
+
+		Convey("Should connect for every lookup without a session", func() {
+			mock := setup()
+			mock.usersFirstReturn = []*models.ExternalUserInfo{{Login: "one"}}
+			mock.usersRestReturn = []*models.ExternalUserInfo{{Login: "two"}}
+
+			multi := New([]*ldap.ServerConfig{{Host: "10.0.0.1"}})
+
+			_, _, err := multi.User("one")
+			So(err, ShouldBeNil)
+
+			_, _, err = multi.User("two")
+			So(err, ShouldBeNil)
+
+			So(mock.dialCalledTimes, ShouldEqual, 2)
+			So(mock.closeCalledTimes, ShouldEqual, 2)
+
+			multi.Close()
+
+			So(mock.closeCalledTimes, ShouldEqual, 2)
+		})
+	})
+}
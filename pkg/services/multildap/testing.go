@@ -1,81 +1,260 @@
 package multildap
 
 import (
+	"sync"
+	"time"
+
 	"github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/services/ldap"
 )
 
-// MockLDAP represents testing struct for ldap testing
+// MockLDAP represents testing struct for ldap testing.
+// Its calls are recorded under the mutex, the servers being asked from several goroutines.
 type MockLDAP struct {
-	dialCalledTimes  int
-	loginCalledTimes int
-	closeCalledTimes int
-	usersCalledTimes int
-	bindCalledTimes  int
+	mutex sync.Mutex
+
+	dialCalledTimes     int
+	loginCalledTimes    int
+	closeCalledTimes    int
+	usersCalledTimes    int
+	bindCalledTimes     int
+	allUsersCalledTimes int
 
 	dialErrReturn error
+	dialDelay     time.Duration
 
 	loginErrReturn error
 	loginReturn    *models.ExternalUserInfo
 
 	bindErrReturn error
 
+	userBindCalledTimes int
+	userBindErrReturn   error
+
 	usersErrReturn   error
 	usersFirstReturn []*models.ExternalUserInfo
 	usersRestReturn  []*models.ExternalUserInfo
+
+	allUsersErrReturn       error
+	allUsersReturn          []*models.ExternalUserInfo
+	allUsersTruncatedReturn bool
+
+	matchingUsersQueries []string
+
+	usersPageProvider func(cursor *ldap.PageCursor, size uint32) ([]*models.ExternalUserInfo, *ldap.PageCursor, error)
+
+	modifiedUsersSince []time.Time
+
+	changedUsersMarkers []string
+	changedUsersMarker  string
+
+	userPhotoProvider func(login string) ([]byte, error)
+
+	userAttributesProvider func(login string) (map[string][]string, error)
+
+	groupExistsProvider func(dn string) (bool, error)
+
+	certificate *ldap.Certificate
+
+	searchProvider func(baseDN, filter string, attributes []string, sizeLimit int) ([]*ldap.SearchEntry, bool, error)
+
+	checkSearchCalledTimes int
+	checkSearchErrReturn   error
+
+	abandonedReturn bool
+}
+
+// count increments the counter of the calls, and returns it
+func (mock *MockLDAP) count(counter *int) int {
+	mock.mutex.Lock()
+	defer mock.mutex.Unlock()
+
+	*counter++
+	return *counter
+}
+
+// record records the argument of a call
+func (mock *MockLDAP) record(record func()) {
+	mock.mutex.Lock()
+	defer mock.mutex.Unlock()
+
+	record()
 }
 
 // Login test fn
 func (mock *MockLDAP) Login(*models.LoginUserQuery) (*models.ExternalUserInfo, error) {
-
-	mock.loginCalledTimes = mock.loginCalledTimes + 1
+	mock.count(&mock.loginCalledTimes)
 	return mock.loginReturn, mock.loginErrReturn
 }
 
+// LoginWithTrace test fn
+func (mock *MockLDAP) LoginWithTrace(query *models.LoginUserQuery, trace *ldap.Trace) (*models.ExternalUserInfo, error) {
+	user, err := mock.Login(query)
+	trace.Add("", ldap.TraceStepUserBind, "Login", err)
+	return user, err
+}
+
 // Users test fn
 func (mock *MockLDAP) Users([]string) ([]*models.ExternalUserInfo, error) {
-	mock.usersCalledTimes = mock.usersCalledTimes + 1
-
-	if mock.usersCalledTimes == 1 {
+	if mock.count(&mock.usersCalledTimes) == 1 {
 		return mock.usersFirstReturn, mock.usersErrReturn
 	}
 
 	return mock.usersRestReturn, mock.usersErrReturn
 }
 
+// AllUsers test fn
+func (mock *MockLDAP) AllUsers() ([]*models.ExternalUserInfo, bool, error) {
+	mock.count(&mock.allUsersCalledTimes)
+	return mock.allUsersReturn, mock.allUsersTruncatedReturn, mock.allUsersErrReturn
+}
+
+// MatchingUsers test fn, it returns all the users
+func (mock *MockLDAP) MatchingUsers(query string) ([]*models.ExternalUserInfo, bool, error) {
+	mock.record(func() { mock.matchingUsersQueries = append(mock.matchingUsersQueries, query) })
+	return mock.allUsersReturn, mock.allUsersTruncatedReturn, mock.allUsersErrReturn
+}
+
+// UsersPage test fn
+func (mock *MockLDAP) UsersPage(cursor *ldap.PageCursor, size uint32) ([]*models.ExternalUserInfo, *ldap.PageCursor, error) {
+	if mock.usersPageProvider != nil {
+		return mock.usersPageProvider(cursor, size)
+	}
+
+	return mock.allUsersReturn, nil, mock.allUsersErrReturn
+}
+
+// ModifiedUsers test fn, it returns all the users
+func (mock *MockLDAP) ModifiedUsers(since time.Time) ([]*models.ExternalUserInfo, bool, error) {
+	mock.record(func() { mock.modifiedUsersSince = append(mock.modifiedUsersSince, since) })
+	return mock.allUsersReturn, mock.allUsersTruncatedReturn, mock.allUsersErrReturn
+}
+
+// ChangedUsers test fn, it returns all the users with the changedUsersMarker marker
+func (mock *MockLDAP) ChangedUsers(marker string) ([]*models.ExternalUserInfo, string, bool, error) {
+	mock.record(func() { mock.changedUsersMarkers = append(mock.changedUsersMarkers, marker) })
+	return mock.allUsersReturn, mock.changedUsersMarker, mock.allUsersTruncatedReturn, mock.allUsersErrReturn
+}
+
+// UserPhoto test fn
+func (mock *MockLDAP) UserPhoto(login string) ([]byte, error) {
+	if mock.userPhotoProvider != nil {
+		return mock.userPhotoProvider(login)
+	}
+
+	return nil, ldap.ErrCouldNotFindUser
+}
+
+// UserAttributes test fn
+func (mock *MockLDAP) UserAttributes(login string) (map[string][]string, error) {
+	if mock.userAttributesProvider != nil {
+		return mock.userAttributesProvider(login)
+	}
+
+	return nil, ldap.ErrCouldNotFindUser
+}
+
+// Groups test fn
+func (mock *MockLDAP) Groups() ([]string, error) {
+	return nil, nil
+}
+
+// GroupExists test fn
+func (mock *MockLDAP) GroupExists(dn string) (bool, error) {
+	if mock.groupExistsProvider != nil {
+		return mock.groupExistsProvider(dn)
+	}
+
+	return true, nil
+}
+
+// Certificate test fn
+func (mock *MockLDAP) Certificate() *ldap.Certificate {
+	return mock.certificate
+}
+
+// Search test fn
+func (mock *MockLDAP) Search(baseDN, filter string, attributes []string, sizeLimit int) ([]*ldap.SearchEntry, bool, error) {
+	if mock.searchProvider != nil {
+		return mock.searchProvider(baseDN, filter, attributes, sizeLimit)
+	}
+
+	return []*ldap.SearchEntry{}, false, nil
+}
+
+// CheckSearch test fn
+func (mock *MockLDAP) CheckSearch() error {
+	mock.count(&mock.checkSearchCalledTimes)
+	return mock.checkSearchErrReturn
+}
+
 // UserBind test fn
 func (mock *MockLDAP) UserBind(string, string) error {
-	return nil
+	mock.count(&mock.userBindCalledTimes)
+	return mock.userBindErrReturn
 }
 
 // Dial test fn
 func (mock *MockLDAP) Dial() error {
-	mock.dialCalledTimes = mock.dialCalledTimes + 1
+	mock.count(&mock.dialCalledTimes)
+	time.Sleep(mock.dialDelay)
 	return mock.dialErrReturn
 }
 
 // Close test fn
 func (mock *MockLDAP) Close() {
-	mock.closeCalledTimes = mock.closeCalledTimes + 1
+	mock.count(&mock.closeCalledTimes)
+}
+
+// Abandoned test fn
+func (mock *MockLDAP) Abandoned() bool {
+	mock.mutex.Lock()
+	defer mock.mutex.Unlock()
+
+	return mock.abandonedReturn
 }
 
 func (mock *MockLDAP) Bind() error {
-	mock.bindCalledTimes++
+	mock.count(&mock.bindCalledTimes)
 	return mock.bindErrReturn
 }
 
-// MockMultiLDAP represents testing struct for multildap testing
+// MockMultiLDAP represents testing struct for multildap testing.
+// Its calls are counted under the mutex, the users being synced from several goroutines.
 type MockMultiLDAP struct {
-	LoginCalledTimes int
-	UsersCalledTimes int
-	UserCalledTimes  int
-	PingCalledTimes  int
+	mutex sync.Mutex
+
+	LoginCalledTimes    int
+	UsersCalledTimes    int
+	UserCalledTimes     int
+	PingCalledTimes     int
+	AllUsersCalledTimes int
+	CloseCalledTimes    int
 
 	UsersResult []*models.ExternalUserInfo
+
+	UserProvider func(login string) (*models.ExternalUserInfo, ldap.ServerConfig, error)
+
+	// UserAttempts are the servers reported as attempted by UserWithAttempts
+	UserAttempts []*ServerAttempt
+
+	// ModifiedUsersProvider returns the users modified since the time, ModifiedUsers returns UsersResult without it
+	ModifiedUsersProvider func(since time.Time) ([]*models.ExternalUserInfo, bool, error)
+
+	// ChangedUsersProvider returns the users changed since the markers, ChangedUsers returns UsersResult without it
+	ChangedUsersProvider func(markers map[string]string) ([]*models.ExternalUserInfo, map[string]string, bool, error)
+}
+
+// count increments the counter of the calls
+func (mock *MockMultiLDAP) count(counter *int) {
+	mock.mutex.Lock()
+	defer mock.mutex.Unlock()
+
+	*counter++
 }
 
 func (mock *MockMultiLDAP) Ping() ([]*ServerStatus, error) {
-	mock.PingCalledTimes = mock.PingCalledTimes + 1
+	mock.count(&mock.PingCalledTimes)
 
 	return nil, nil
 }
@@ -84,15 +263,23 @@ func (mock *MockMultiLDAP) Ping() ([]*ServerStatus, error) {
 func (mock *MockMultiLDAP) Login(query *models.LoginUserQuery) (
 	*models.ExternalUserInfo, error,
 ) {
-	mock.LoginCalledTimes = mock.LoginCalledTimes + 1
+	mock.count(&mock.LoginCalledTimes)
 	return nil, nil
 }
 
+// LoginWithTrace test fn
+func (mock *MockMultiLDAP) LoginWithTrace(query *models.LoginUserQuery) (
+	*models.ExternalUserInfo, ldap.ServerConfig, *ldap.Trace, error,
+) {
+	user, err := mock.Login(query)
+	return user, ldap.ServerConfig{}, ldap.NewTrace(), err
+}
+
 // Users test fn
 func (mock *MockMultiLDAP) Users(logins []string) (
 	[]*models.ExternalUserInfo, error,
 ) {
-	mock.UsersCalledTimes = mock.UsersCalledTimes + 1
+	mock.count(&mock.UsersCalledTimes)
 	return mock.UsersResult, nil
 }
 
@@ -100,10 +287,116 @@ func (mock *MockMultiLDAP) Users(logins []string) (
 func (mock *MockMultiLDAP) User(login string) (
 	*models.ExternalUserInfo, ldap.ServerConfig, error,
 ) {
-	mock.UserCalledTimes = mock.UserCalledTimes + 1
+	mock.count(&mock.UserCalledTimes)
+
+	if mock.UserProvider != nil {
+		return mock.UserProvider(login)
+	}
+
 	return nil, ldap.ServerConfig{}, nil
 }
 
+// UserWithTimings test fn
+func (mock *MockMultiLDAP) UserWithTimings(login string) (
+	*models.ExternalUserInfo, ldap.ServerConfig, *Timings, error,
+) {
+	user, config, err := mock.User(login)
+	return user, config, &Timings{}, err
+}
+
+// UserWithAttempts test fn
+func (mock *MockMultiLDAP) UserWithAttempts(login string) (
+	*models.ExternalUserInfo, ldap.ServerConfig, []*ServerAttempt, error,
+) {
+	user, config, err := mock.User(login)
+
+	if mock.UserAttempts != nil {
+		return user, config, mock.UserAttempts, err
+	}
+
+	return user, config, []*ServerAttempt{}, err
+}
+
+// CachedUser test fn
+func (mock *MockMultiLDAP) CachedUser(login string) *CachedUser {
+	return nil
+}
+
+// AllUsers test fn
+func (mock *MockMultiLDAP) AllUsers() (
+	[]*models.ExternalUserInfo, bool, error,
+) {
+	mock.count(&mock.AllUsersCalledTimes)
+	return mock.UsersResult, false, nil
+}
+
+// MatchingUsers test fn, it returns all the users
+func (mock *MockMultiLDAP) MatchingUsers(query string) (
+	[]*models.ExternalUserInfo, bool, error,
+) {
+	return mock.UsersResult, false, nil
+}
+
+// UsersPage test fn, it returns all the users in a single page
+func (mock *MockMultiLDAP) UsersPage(cursor *UsersCursor, limit int) (
+	[]*models.ExternalUserInfo, *UsersCursor, error,
+) {
+	users, _, err := mock.AllUsers()
+	return users, nil, err
+}
+
+// ModifiedUsers test fn
+func (mock *MockMultiLDAP) ModifiedUsers(since time.Time) (
+	[]*models.ExternalUserInfo, bool, error,
+) {
+	if mock.ModifiedUsersProvider != nil {
+		return mock.ModifiedUsersProvider(since)
+	}
+
+	return mock.UsersResult, false, nil
+}
+
+// ChangedUsers test fn
+func (mock *MockMultiLDAP) ChangedUsers(markers map[string]string) (
+	[]*models.ExternalUserInfo, map[string]string, bool, error,
+) {
+	if mock.ChangedUsersProvider != nil {
+		return mock.ChangedUsersProvider(markers)
+	}
+
+	return mock.UsersResult, markers, false, nil
+}
+
+// UserPhoto test fn, the users have no photo
+func (mock *MockMultiLDAP) UserPhoto(login string) ([]byte, error) {
+	return nil, nil
+}
+
+// UserAttributes test fn, the users have no attributes
+func (mock *MockMultiLDAP) UserAttributes(login string) (map[string][]string, error) {
+	return map[string][]string{}, nil
+}
+
+// DanglingGroupMappings test fn
+func (mock *MockMultiLDAP) DanglingGroupMappings() ([]*GroupMappingsCheck, error) {
+	return nil, nil
+}
+
+// FindGroup test fn, the group isn't looked up
+func (mock *MockMultiLDAP) FindGroup(dn string) ([]*GroupLookup, error) {
+	return nil, nil
+}
+
+// Search test fn, nothing is found
+func (mock *MockMultiLDAP) Search(host, baseDN, filter string, attributes []string, sizeLimit int) (*SearchResult, error) {
+	return &SearchResult{Entries: []*ldap.SearchEntry{}}, nil
+}
+
+// Close test fn
+func (mock *MockMultiLDAP) Close() {
+	mock.count(&mock.CloseCalledTimes)
+}
+
 func setup() *MockLDAP {
 	mock := &MockLDAP{}
 
@@ -1,6 +1,8 @@
 package sqlstore
 
 import (
+	"time"
+
 	"github.com/grafana/grafana/pkg/bus"
 	m "github.com/grafana/grafana/pkg/models"
 )
@@ -8,17 +10,33 @@ import (
 func init() {
 	bus.AddHandler("sql", UpdateDashboardAcl)
 	bus.AddHandler("sql", GetDashboardAclInfoList)
+	bus.AddHandler("sql", GetUserExternalAcl)
+	bus.AddHandler("sql", SetExternalDashboardAcl)
 }
 
+// UpdateDashboardAcl replaces the permissions of the dashboard. The external permissions
+// given again to the same user are kept external, unless their permission changed.
 func UpdateDashboardAcl(cmd *m.UpdateDashboardAclCommand) error {
 	return inTransaction(func(sess *DBSession) error {
+		external := []*m.DashboardAcl{}
+		err := sess.Where("dashboard_id=? AND external=?", cmd.DashboardId, dialect.BooleanStr(true)).Find(&external)
+		if err != nil {
+			return err
+		}
+
 		// delete existing items
-		_, err := sess.Exec("DELETE FROM dashboard_acl WHERE dashboard_id=?", cmd.DashboardId)
+		_, err = sess.Exec("DELETE FROM dashboard_acl WHERE dashboard_id=?", cmd.DashboardId)
 		if err != nil {
 			return err
 		}
 
 		for _, item := range cmd.Items {
+			for _, previous := range external {
+				if item.UserId > 0 && item.UserId == previous.UserId && item.Permission == previous.Permission {
+					item.External = true
+				}
+			}
+
 			if item.UserId == 0 && item.TeamId == 0 && (item.Role == nil || !item.Role.IsValid()) {
 				return m.ErrDashboardAclInfoMissing
 			}
@@ -61,6 +79,7 @@ func GetDashboardAclInfoList(query *m.GetDashboardAclInfoListQuery) error {
 		da.role,
 		da.created,
 		da.updated,
+		da.external,
 		'' as user_login,
 		'' as user_email,
 		'' as team,
@@ -88,6 +107,7 @@ func GetDashboardAclInfoList(query *m.GetDashboardAclInfoListQuery) error {
 				da.role,
 				da.created,
 				da.updated,
+				da.external,
 				u.login AS user_login,
 				u.email AS user_email,
 				ug.name AS team,
@@ -125,3 +145,85 @@ func GetDashboardAclInfoList(query *m.GetDashboardAclInfoListQuery) error {
 
 	return err
 }
+
+// GetUserExternalAcl lists the external permissions of the user on every dashboard and folder
+func GetUserExternalAcl(query *m.GetUserExternalAclQuery) error {
+	query.Result = make([]*m.DashboardAcl, 0)
+
+	return x.Where("user_id=? AND external=?", query.UserId, dialect.BooleanStr(true)).Find(&query.Result)
+}
+
+// SetExternalDashboardAcl sets the external permission of the user on the dashboard in place, so the concurrent syncs
+// of other users don't overwrite each other. The dashboard without permissions of its own first gets the default ones.
+func SetExternalDashboardAcl(cmd *m.SetExternalDashboardAclCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		current := []*m.DashboardAcl{}
+		err := sess.Where("dashboard_id=? AND user_id=?", cmd.DashboardId, cmd.UserId).Find(&current)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range current {
+			if !item.External {
+				return m.ErrDashboardAclManualPermission
+			}
+
+			if item.Permission == cmd.Permission {
+				return nil
+			}
+		}
+
+		_, err = sess.Exec("DELETE FROM dashboard_acl WHERE dashboard_id=? AND user_id=?", cmd.DashboardId, cmd.UserId)
+		if err != nil {
+			return err
+		}
+
+		if cmd.Permission == 0 {
+			return nil
+		}
+
+		// only the sync which flags the dashboard copies the default permissions
+		res, err := sess.Exec("UPDATE dashboard SET has_acl=? WHERE id=? AND has_acl=?",
+			dialect.BooleanStr(true), cmd.DashboardId, dialect.BooleanStr(false))
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+
+		if flagged, err := res.RowsAffected(); err != nil {
+			return err
+		} else if flagged > 0 {
+			defaults := []*m.DashboardAcl{}
+			if err := sess.Where("dashboard_id=? AND org_id=?", -1, -1).Find(&defaults); err != nil {
+				return err
+			}
+
+			for _, item := range defaults {
+				item.Id = 0
+				item.OrgId = cmd.OrgId
+				item.DashboardId = cmd.DashboardId
+				item.Created = now
+				item.Updated = now
+
+				sess.Nullable("user_id", "team_id")
+				if _, err := sess.Insert(item); err != nil {
+					return err
+				}
+			}
+		}
+
+		sess.Nullable("user_id", "team_id")
+		_, err = sess.Insert(&m.DashboardAcl{
+			OrgId:       cmd.OrgId,
+			DashboardId: cmd.DashboardId,
+			UserId:      cmd.UserId,
+			Permission:  cmd.Permission,
+			External:    true,
+			Created:     now,
+			Updated:     now,
+		})
+
+		return err
+	})
+}
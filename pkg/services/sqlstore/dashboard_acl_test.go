@@ -178,6 +178,156 @@ func TestDashboardAclDataAccess(t *testing.T) {
 				})
 			})
 
+			Convey("Given an external permission", func() {
+				err := testHelperUpdateDashboardAcl(savedFolder.Id, m.DashboardAcl{
+					OrgId:       1,
+					UserId:      currentUser.Id,
+					DashboardId: savedFolder.Id,
+					Permission:  m.PERMISSION_EDIT,
+					External:    true,
+				})
+				So(err, ShouldBeNil)
+
+				Convey("Should list it as external", func() {
+					q1 := &m.GetDashboardAclInfoListQuery{DashboardId: savedFolder.Id, OrgId: 1}
+					err := GetDashboardAclInfoList(q1)
+					So(err, ShouldBeNil)
+					So(q1.Result[0].External, ShouldBeTrue)
+
+					q2 := &m.GetUserExternalAclQuery{UserId: currentUser.Id}
+					err = GetUserExternalAcl(q2)
+					So(err, ShouldBeNil)
+					So(len(q2.Result), ShouldEqual, 1)
+					So(q2.Result[0].DashboardId, ShouldEqual, savedFolder.Id)
+					So(q2.Result[0].Permission, ShouldEqual, m.PERMISSION_EDIT)
+				})
+
+				Convey("Should keep it external when it is saved again unchanged", func() {
+					err := testHelperUpdateDashboardAcl(savedFolder.Id, m.DashboardAcl{
+						OrgId:       1,
+						UserId:      currentUser.Id,
+						DashboardId: savedFolder.Id,
+						Permission:  m.PERMISSION_EDIT,
+					})
+					So(err, ShouldBeNil)
+
+					q1 := &m.GetUserExternalAclQuery{UserId: currentUser.Id}
+					err = GetUserExternalAcl(q1)
+					So(err, ShouldBeNil)
+					So(len(q1.Result), ShouldEqual, 1)
+				})
+
+				Convey("Should make it manual when its permission is changed", func() {
+					err := testHelperUpdateDashboardAcl(savedFolder.Id, m.DashboardAcl{
+						OrgId:       1,
+						UserId:      currentUser.Id,
+						DashboardId: savedFolder.Id,
+						Permission:  m.PERMISSION_ADMIN,
+					})
+					So(err, ShouldBeNil)
+
+					q1 := &m.GetUserExternalAclQuery{UserId: currentUser.Id}
+					err = GetUserExternalAcl(q1)
+					So(err, ShouldBeNil)
+					So(len(q1.Result), ShouldEqual, 0)
+				})
+			})
+
+			Convey("When setting an external permission", func() {
+				err := SetExternalDashboardAcl(&m.SetExternalDashboardAclCommand{
+					OrgId:       1,
+					DashboardId: savedFolder.Id,
+					UserId:      currentUser.Id,
+					Permission:  m.PERMISSION_EDIT,
+				})
+				So(err, ShouldBeNil)
+
+				Convey("Should keep the default permissions of the folder", func() {
+					q1 := &m.GetDashboardAclInfoListQuery{DashboardId: savedFolder.Id, OrgId: 1}
+					err := GetDashboardAclInfoList(q1)
+					So(err, ShouldBeNil)
+					So(len(q1.Result), ShouldEqual, 3)
+					So(*q1.Result[0].Role, ShouldEqual, m.ROLE_VIEWER)
+					So(q1.Result[0].DashboardId, ShouldEqual, savedFolder.Id)
+					So(q1.Result[2].UserId, ShouldEqual, currentUser.Id)
+					So(q1.Result[2].External, ShouldBeTrue)
+				})
+
+				Convey("Should only replace the permission of the user", func() {
+					otherUser := createUser("editor", "Editor", false)
+					err := SetExternalDashboardAcl(&m.SetExternalDashboardAclCommand{
+						OrgId:       1,
+						DashboardId: savedFolder.Id,
+						UserId:      otherUser.Id,
+						Permission:  m.PERMISSION_VIEW,
+					})
+					So(err, ShouldBeNil)
+
+					err = SetExternalDashboardAcl(&m.SetExternalDashboardAclCommand{
+						OrgId:       1,
+						DashboardId: savedFolder.Id,
+						UserId:      currentUser.Id,
+						Permission:  m.PERMISSION_ADMIN,
+					})
+					So(err, ShouldBeNil)
+
+					q1 := &m.GetDashboardAclInfoListQuery{DashboardId: savedFolder.Id, OrgId: 1}
+					err = GetDashboardAclInfoList(q1)
+					So(err, ShouldBeNil)
+					So(len(q1.Result), ShouldEqual, 4)
+					So(q1.Result[2].UserId, ShouldEqual, otherUser.Id)
+					So(q1.Result[3].UserId, ShouldEqual, currentUser.Id)
+					So(q1.Result[3].Permission, ShouldEqual, m.PERMISSION_ADMIN)
+				})
+
+				Convey("Should remove it with the permission 0", func() {
+					err := SetExternalDashboardAcl(&m.SetExternalDashboardAclCommand{
+						OrgId:       1,
+						DashboardId: savedFolder.Id,
+						UserId:      currentUser.Id,
+					})
+					So(err, ShouldBeNil)
+
+					q1 := &m.GetUserExternalAclQuery{UserId: currentUser.Id}
+					err = GetUserExternalAcl(q1)
+					So(err, ShouldBeNil)
+					So(len(q1.Result), ShouldEqual, 0)
+
+					q2 := &m.GetDashboardAclInfoListQuery{DashboardId: savedFolder.Id, OrgId: 1}
+					err = GetDashboardAclInfoList(q2)
+					So(err, ShouldBeNil)
+					So(len(q2.Result), ShouldEqual, 2)
+				})
+			})
+
+			Convey("When setting an external permission over a manual one", func() {
+				err := testHelperUpdateDashboardAcl(savedFolder.Id, m.DashboardAcl{
+					OrgId:       1,
+					UserId:      currentUser.Id,
+					DashboardId: savedFolder.Id,
+					Permission:  m.PERMISSION_VIEW,
+				})
+				So(err, ShouldBeNil)
+
+				err = SetExternalDashboardAcl(&m.SetExternalDashboardAclCommand{
+					OrgId:       1,
+					DashboardId: savedFolder.Id,
+					UserId:      currentUser.Id,
+					Permission:  m.PERMISSION_ADMIN,
+				})
+
+				Convey("Should keep the manual permission", func() {
+					So(err, ShouldEqual, m.ErrDashboardAclManualPermission)
+
+					q1 := &m.GetDashboardAclInfoListQuery{DashboardId: savedFolder.Id, OrgId: 1}
+					err := GetDashboardAclInfoList(q1)
+					So(err, ShouldBeNil)
+					So(len(q1.Result), ShouldEqual, 1)
+					So(q1.Result[0].Permission, ShouldEqual, m.PERMISSION_VIEW)
+					So(q1.Result[0].External, ShouldBeFalse)
+				})
+			})
+
 			Convey("Given a team", func() {
 				group1 := m.CreateTeamCommand{Name: "group1 name", OrgId: 1}
 				err := CreateTeam(&group1)
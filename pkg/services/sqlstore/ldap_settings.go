@@ -0,0 +1,96 @@
+package sqlstore
+
+import (
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	m "github.com/grafana/grafana/pkg/models"
+)
+
+func init() {
+	bus.AddHandler("sql", GetLDAPSettings)
+	bus.AddHandler("sql", SaveLDAPSettings)
+	bus.AddHandler("sql", DeleteLDAPSettings)
+}
+
+// GetLDAPSettings returns the stored LDAP config, decrypted
+func GetLDAPSettings(query *m.GetLDAPSettingsQuery) error {
+	settings, err := getLDAPSettings(newSession())
+	if err != nil {
+		return err
+	}
+
+	settings.Config, err = decodeAndDecrypt(settings.Config)
+	if err != nil {
+		return err
+	}
+
+	query.Result = settings
+	return nil
+}
+
+func getLDAPSettings(sess *DBSession) (*m.LDAPSettings, error) {
+	var settings m.LDAPSettings
+
+	has, err := sess.Asc("id").Get(&settings)
+	if err != nil {
+		return nil, err
+	} else if !has {
+		return nil, m.ErrLDAPSettingsNotFound
+	}
+
+	return &settings, nil
+}
+
+// SaveLDAPSettings stores the LDAP config encrypted, there's a single stored config
+func SaveLDAPSettings(cmd *m.SaveLDAPSettingsCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		encrypted, err := encryptAndEncode(cmd.Config)
+		if err != nil {
+			return err
+		}
+
+		settings, err := getLDAPSettings(sess)
+		if err != nil && err != m.ErrLDAPSettingsNotFound {
+			return err
+		}
+
+		now := time.Now()
+
+		if settings == nil {
+			settings = &m.LDAPSettings{
+				Config:    encrypted,
+				Version:   1,
+				Created:   now,
+				Updated:   now,
+				UpdatedBy: cmd.UserId,
+			}
+
+			if _, err := sess.Insert(settings); err != nil {
+				return err
+			}
+		} else {
+			settings.Config = encrypted
+			settings.Version++
+			settings.Updated = now
+			settings.UpdatedBy = cmd.UserId
+
+			if _, err := sess.ID(settings.Id).Update(settings); err != nil {
+				return err
+			}
+		}
+
+		settings.Config = cmd.Config
+		cmd.Result = settings
+
+		return nil
+	})
+}
+
+// DeleteLDAPSettings deletes the stored LDAP config
+func DeleteLDAPSettings(cmd *m.DeleteLDAPSettingsCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		_, err := sess.Exec("DELETE FROM ldap_settings")
+		return err
+	})
+}
@@ -0,0 +1,69 @@
+package sqlstore
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	m "github.com/grafana/grafana/pkg/models"
+)
+
+func TestLDAPSettings(t *testing.T) {
+	Convey("Testing LDAP settings", t, func() {
+		InitTestDB(t)
+
+		Convey("Should not find settings before they are saved", func() {
+			err := GetLDAPSettings(&m.GetLDAPSettingsQuery{})
+			So(err, ShouldEqual, m.ErrLDAPSettingsNotFound)
+		})
+
+		Convey("Given saved settings", func() {
+			cmd := m.SaveLDAPSettingsCommand{Config: "[[servers]]\nbind_password = 'secret'\n", UserId: 1}
+			err := SaveLDAPSettings(&cmd)
+			So(err, ShouldBeNil)
+			So(cmd.Result.Version, ShouldEqual, 1)
+			So(cmd.Result.Config, ShouldEqual, cmd.Config)
+
+			Convey("Should encrypt the config in the database", func() {
+				var stored m.LDAPSettings
+				_, err := x.Get(&stored)
+				So(err, ShouldBeNil)
+				So(stored.Config, ShouldNotContainSubstring, "secret")
+			})
+
+			Convey("Should return the decrypted config", func() {
+				query := m.GetLDAPSettingsQuery{}
+				err := GetLDAPSettings(&query)
+				So(err, ShouldBeNil)
+				So(query.Result.Config, ShouldEqual, cmd.Config)
+				So(query.Result.UpdatedBy, ShouldEqual, 1)
+			})
+
+			Convey("Should replace the settings when saved again", func() {
+				update := m.SaveLDAPSettingsCommand{Config: "[[servers]]\n", UserId: 2}
+				err := SaveLDAPSettings(&update)
+				So(err, ShouldBeNil)
+				So(update.Result.Version, ShouldEqual, 2)
+				So(update.Result.Id, ShouldEqual, cmd.Result.Id)
+
+				query := m.GetLDAPSettingsQuery{}
+				err = GetLDAPSettings(&query)
+				So(err, ShouldBeNil)
+				So(query.Result.Config, ShouldEqual, "[[servers]]\n")
+				So(query.Result.UpdatedBy, ShouldEqual, 2)
+
+				count, err := x.Count(&m.LDAPSettings{})
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 1)
+			})
+
+			Convey("Should not find settings once deleted", func() {
+				err := DeleteLDAPSettings(&m.DeleteLDAPSettingsCommand{})
+				So(err, ShouldBeNil)
+
+				err = GetLDAPSettings(&m.GetLDAPSettingsQuery{})
+				So(err, ShouldEqual, m.ErrLDAPSettingsNotFound)
+			})
+		})
+	})
+}
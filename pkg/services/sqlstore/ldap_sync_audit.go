@@ -0,0 +1,80 @@
+package sqlstore
+
+import (
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	m "github.com/grafana/grafana/pkg/models"
+)
+
+func init() {
+	bus.AddHandler("sql", AddLDAPSyncAuditEntries)
+	bus.AddHandler("sql", SearchLDAPSyncAudit)
+}
+
+// AddLDAPSyncAuditEntries records the changes of a LDAP sync in the audit trail
+func AddLDAPSyncAuditEntries(cmd *m.AddLDAPSyncAuditEntriesCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		now := time.Now()
+
+		for _, entry := range cmd.Entries {
+			if entry.Created.IsZero() {
+				entry.Created = now
+			}
+
+			if _, err := sess.Insert(entry); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// SearchLDAPSyncAudit searches the audit trail of the LDAP syncs, the most recent entries first
+func SearchLDAPSyncAudit(query *m.SearchLDAPSyncAuditQuery) error {
+	query.Result = m.SearchLDAPSyncAuditResult{
+		Entries: make([]*m.LDAPSyncAuditEntry, 0),
+	}
+
+	whereConditions := make([]string, 0)
+	whereParams := make([]interface{}, 0)
+
+	if query.UserId > 0 {
+		whereConditions = append(whereConditions, "user_id = ?")
+		whereParams = append(whereParams, query.UserId)
+	}
+
+	if query.Login != "" {
+		whereConditions = append(whereConditions, "login = ?")
+		whereParams = append(whereParams, query.Login)
+	}
+
+	if query.Action != "" {
+		whereConditions = append(whereConditions, "action = ?")
+		whereParams = append(whereParams, query.Action)
+	}
+
+	sess := x.Table("ldap_sync_audit")
+	if len(whereConditions) > 0 {
+		sess.Where(strings.Join(whereConditions, " AND "), whereParams...)
+	}
+
+	offset := query.Limit * (query.Page - 1)
+	sess.Limit(query.Limit, offset)
+	sess.Desc("id")
+	if err := sess.Find(&query.Result.Entries); err != nil {
+		return err
+	}
+
+	countSess := x.Table("ldap_sync_audit")
+	if len(whereConditions) > 0 {
+		countSess.Where(strings.Join(whereConditions, " AND "), whereParams...)
+	}
+
+	count, err := countSess.Count(&m.LDAPSyncAuditEntry{})
+	query.Result.TotalCount = count
+
+	return err
+}
@@ -0,0 +1,55 @@
+package sqlstore
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	m "github.com/grafana/grafana/pkg/models"
+)
+
+func TestLDAPSyncAudit(t *testing.T) {
+	Convey("Testing LDAP sync audit", t, func() {
+		InitTestDB(t)
+
+		err := AddLDAPSyncAuditEntries(&m.AddLDAPSyncAuditEntriesCommand{
+			Entries: []*m.LDAPSyncAuditEntry{
+				{UserId: 1, Login: "jdoe", Source: m.LDAPSyncSourceLogin, Action: m.LDAPSyncAuditRoleChange, OrgId: 1, PreviousValue: "Viewer", NewValue: "Editor"},
+				{UserId: 1, Login: "jdoe", Source: m.LDAPSyncSourceLogin, Action: m.LDAPSyncAuditAdminChange, PreviousValue: "false", NewValue: "true"},
+				{UserId: 2, Login: "jane", Source: m.LDAPSyncSourceSync, Action: m.LDAPSyncAuditDisable, PreviousValue: "enabled", NewValue: "disabled"},
+			},
+		})
+		So(err, ShouldBeNil)
+
+		Convey("Should list the most recent entries first", func() {
+			query := m.SearchLDAPSyncAuditQuery{Page: 1, Limit: 10}
+			err := SearchLDAPSyncAudit(&query)
+
+			So(err, ShouldBeNil)
+			So(query.Result.TotalCount, ShouldEqual, 3)
+			So(len(query.Result.Entries), ShouldEqual, 3)
+			So(query.Result.Entries[0].Login, ShouldEqual, "jane")
+			So(query.Result.Entries[0].Created.IsZero(), ShouldBeFalse)
+			So(query.Result.Entries[2].NewValue, ShouldEqual, "Editor")
+		})
+
+		Convey("Should filter the entries", func() {
+			query := m.SearchLDAPSyncAuditQuery{UserId: 1, Action: m.LDAPSyncAuditAdminChange, Page: 1, Limit: 10}
+			err := SearchLDAPSyncAudit(&query)
+
+			So(err, ShouldBeNil)
+			So(query.Result.TotalCount, ShouldEqual, 1)
+			So(query.Result.Entries[0].PreviousValue, ShouldEqual, "false")
+		})
+
+		Convey("Should page the entries", func() {
+			query := m.SearchLDAPSyncAuditQuery{Login: "jdoe", Page: 2, Limit: 1}
+			err := SearchLDAPSyncAudit(&query)
+
+			So(err, ShouldBeNil)
+			So(query.Result.TotalCount, ShouldEqual, 2)
+			So(len(query.Result.Entries), ShouldEqual, 1)
+			So(query.Result.Entries[0].Action, ShouldEqual, m.LDAPSyncAuditRoleChange)
+		})
+	})
+}
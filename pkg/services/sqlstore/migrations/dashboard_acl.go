@@ -46,4 +46,8 @@ INSERT INTO dashboard_acl
 	`
 
 	mg.AddMigration("save default acl rules in dashboard_acl table", NewRawSqlMigration(rawSQL))
+
+	mg.AddMigration("Add column external to dashboard_acl table", NewAddColumnMigration(dashboardAclV1, &Column{
+		Name: "external", Type: DB_Bool, Nullable: true,
+	}))
 }
@@ -0,0 +1,19 @@
+package migrations
+
+import "github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+
+func addLDAPSettingsMigrations(mg *migrator.Migrator) {
+	ldapSettingsV1 := migrator.Table{
+		Name: "ldap_settings",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "config", Type: migrator.DB_MediumText, Nullable: false},
+			{Name: "version", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "created", Type: migrator.DB_DateTime, Nullable: false},
+			{Name: "updated", Type: migrator.DB_DateTime, Nullable: false},
+			{Name: "updated_by", Type: migrator.DB_BigInt, Nullable: false},
+		},
+	}
+
+	mg.AddMigration("create ldap_settings table", migrator.NewAddTableMigration(ldapSettingsV1))
+}
@@ -0,0 +1,29 @@
+package migrations
+
+import "github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+
+func addLDAPSyncAuditMigrations(mg *migrator.Migrator) {
+	ldapSyncAuditV1 := migrator.Table{
+		Name: "ldap_sync_audit",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "user_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "login", Type: migrator.DB_NVarchar, Length: 190, Nullable: false},
+			{Name: "source", Type: migrator.DB_NVarchar, Length: 20, Nullable: false},
+			{Name: "action", Type: migrator.DB_NVarchar, Length: 20, Nullable: false},
+			{Name: "org_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "previous_value", Type: migrator.DB_NVarchar, Length: 20, Nullable: false},
+			{Name: "new_value", Type: migrator.DB_NVarchar, Length: 20, Nullable: false},
+			{Name: "reason", Type: migrator.DB_NVarchar, Length: 255, Nullable: false},
+			{Name: "created", Type: migrator.DB_DateTime, Nullable: false},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"user_id"}},
+			{Cols: []string{"login"}},
+		},
+	}
+
+	mg.AddMigration("create ldap_sync_audit table", migrator.NewAddTableMigration(ldapSyncAuditV1))
+	mg.AddMigration("add index ldap_sync_audit.user_id", migrator.NewAddIndexMigration(ldapSyncAuditV1, ldapSyncAuditV1.Indices[0]))
+	mg.AddMigration("add index ldap_sync_audit.login", migrator.NewAddIndexMigration(ldapSyncAuditV1, ldapSyncAuditV1.Indices[1]))
+}
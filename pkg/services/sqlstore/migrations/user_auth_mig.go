@@ -42,4 +42,16 @@ func addUserAuthMigrations(mg *Migrator) {
 	mg.AddMigration("Add index to user_id column in user_auth", NewAddIndexMigration(userAuthV1, &Index{
 		Cols: []string{"user_id"},
 	}))
+
+	mg.AddMigration("Add locked fields to user_auth", NewAddColumnMigration(userAuthV1, &Column{
+		Name: "locked_fields", Type: DB_NVarchar, Length: 255, Nullable: true,
+	}))
+
+	mg.AddMigration("Add last synced at to user_auth", NewAddColumnMigration(userAuthV1, &Column{
+		Name: "last_synced_at", Type: DB_DateTime, Nullable: true,
+	}))
+
+	mg.AddMigration("Add metadata to user_auth", NewAddColumnMigration(userAuthV1, &Column{
+		Name: "metadata", Type: DB_Text, Nullable: true,
+	}))
 }
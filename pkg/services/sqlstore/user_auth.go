@@ -2,6 +2,8 @@ package sqlstore
 
 import (
 	"encoding/base64"
+	"encoding/json"
+	"strings"
 	"time"
 
 	"github.com/grafana/grafana/pkg/bus"
@@ -18,6 +20,7 @@ func init() {
 	bus.AddHandler("sql", GetAuthInfo)
 	bus.AddHandler("sql", SetAuthInfo)
 	bus.AddHandler("sql", UpdateAuthInfo)
+	bus.AddHandler("sql", UpdateAuthSyncedAt)
 	bus.AddHandler("sql", DeleteAuthInfo)
 }
 
@@ -177,10 +180,20 @@ func GetAuthInfo(query *models.GetAuthInfoQuery) error {
 func SetAuthInfo(cmd *models.SetAuthInfoCommand) error {
 	return inTransaction(func(sess *DBSession) error {
 		authUser := &models.UserAuth{
-			UserId:     cmd.UserId,
-			AuthModule: cmd.AuthModule,
-			AuthId:     cmd.AuthId,
-			Created:    getTime(),
+			UserId:       cmd.UserId,
+			AuthModule:   cmd.AuthModule,
+			AuthId:       cmd.AuthId,
+			Created:      getTime(),
+			LockedFields: strings.Join(cmd.LockedFields, ","),
+		}
+
+		if cmd.Metadata != nil {
+			metadata, err := json.Marshal(cmd.Metadata)
+			if err != nil {
+				return err
+			}
+
+			authUser.Metadata = string(metadata)
 		}
 
 		if cmd.OAuthToken != nil {
@@ -243,6 +256,44 @@ func UpdateAuthInfo(cmd *models.UpdateAuthInfoCommand) error {
 		}
 		upd, err := sess.Update(authUser, cond)
 		sqlog.Debug("Updated user_auth", "user_id", cmd.UserId, "auth_module", cmd.AuthModule, "rows", upd)
+		if err != nil {
+			return err
+		}
+
+		// updated on their own, as the empty list unlocking every field and the empty metadata
+		// wouldn't be updated with the other columns
+		columns := map[string]interface{}{}
+
+		if cmd.LockedFields != nil {
+			columns["locked_fields"] = strings.Join(cmd.LockedFields, ",")
+		}
+
+		if cmd.Metadata != nil {
+			metadata, err := json.Marshal(cmd.Metadata)
+			if err != nil {
+				return err
+			}
+
+			columns["metadata"] = string(metadata)
+		}
+
+		if len(columns) == 0 {
+			return nil
+		}
+
+		_, err = sess.Table("user_auth").
+			Where("user_id = ? AND auth_module = ?", cmd.UserId, cmd.AuthModule).
+			Update(columns)
+		return err
+	})
+}
+
+// UpdateAuthSyncedAt records the time of the last successful sync of the user, the other columns are left unchanged
+func UpdateAuthSyncedAt(cmd *models.UpdateAuthSyncedAtCommand) error {
+	return inTransaction(func(sess *DBSession) error {
+		_, err := sess.Table("user_auth").
+			Where("user_id = ? AND auth_module = ?", cmd.UserId, cmd.AuthModule).
+			Update(map[string]interface{}{"last_synced_at": cmd.SyncedAt})
 		return err
 	})
 }
@@ -171,6 +171,133 @@ func TestUserAuth(t *testing.T) {
 
 		})
 
+		Convey("Can set, update & unlock the locked fields", func() {
+			login := "loginuser0"
+
+			query := &m.GetUserByLoginQuery{LoginOrEmail: login}
+			err = GetUserByLogin(query)
+			So(err, ShouldBeNil)
+			userId := query.Result.Id
+
+			err = SetAuthInfo(&m.SetAuthInfoCommand{
+				UserId:       userId,
+				AuthModule:   m.AuthModuleLDAP,
+				AuthId:       "cn=loginuser0",
+				LockedFields: []string{m.UserFieldEmail, m.UserFieldName},
+			})
+			So(err, ShouldBeNil)
+
+			getAuthQuery := &m.GetAuthInfoQuery{UserId: userId}
+			err = GetAuthInfo(getAuthQuery)
+
+			So(err, ShouldBeNil)
+			So(getAuthQuery.Result.GetLockedFields(), ShouldResemble, []string{"email", "name"})
+			So(getAuthQuery.Result.IsLocked(m.UserFieldEmail), ShouldBeTrue)
+			So(getAuthQuery.Result.IsLocked(m.UserFieldLogin), ShouldBeFalse)
+
+			// the sync without locked fields leaves them unchanged
+			err = UpdateAuthInfo(&m.UpdateAuthInfoCommand{UserId: userId, AuthModule: m.AuthModuleLDAP, AuthId: "cn=loginuser0"})
+			So(err, ShouldBeNil)
+
+			err = GetAuthInfo(getAuthQuery)
+			So(err, ShouldBeNil)
+			So(getAuthQuery.Result.GetLockedFields(), ShouldResemble, []string{"email", "name"})
+
+			// the sync unlocking every field
+			err = UpdateAuthInfo(&m.UpdateAuthInfoCommand{
+				UserId:       userId,
+				AuthModule:   m.AuthModuleLDAP,
+				AuthId:       "cn=loginuser0",
+				LockedFields: []string{},
+			})
+			So(err, ShouldBeNil)
+
+			err = GetAuthInfo(getAuthQuery)
+			So(err, ShouldBeNil)
+			So(getAuthQuery.Result.GetLockedFields(), ShouldBeEmpty)
+		})
+
+		Convey("Can record the last sync", func() {
+			login := "loginuser0"
+
+			query := &m.GetUserByLoginQuery{LoginOrEmail: login}
+			err = GetUserByLogin(query)
+			So(err, ShouldBeNil)
+			userId := query.Result.Id
+
+			err = SetAuthInfo(&m.SetAuthInfoCommand{UserId: userId, AuthModule: m.AuthModuleLDAP, AuthId: "cn=loginuser0"})
+			So(err, ShouldBeNil)
+
+			getAuthQuery := &m.GetAuthInfoQuery{UserId: userId}
+			err = GetAuthInfo(getAuthQuery)
+			So(err, ShouldBeNil)
+			So(getAuthQuery.Result.LastSyncedAt.IsZero(), ShouldBeTrue)
+
+			syncedAt := time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)
+			err = UpdateAuthSyncedAt(&m.UpdateAuthSyncedAtCommand{UserId: userId, AuthModule: m.AuthModuleLDAP, SyncedAt: syncedAt})
+			So(err, ShouldBeNil)
+
+			err = GetAuthInfo(getAuthQuery)
+			So(err, ShouldBeNil)
+			So(getAuthQuery.Result.LastSyncedAt.Unix(), ShouldEqual, syncedAt.Unix())
+		})
+
+		Convey("Can set, update & clear the metadata", func() {
+			login := "loginuser0"
+
+			query := &m.GetUserByLoginQuery{LoginOrEmail: login}
+			err = GetUserByLogin(query)
+			So(err, ShouldBeNil)
+			userId := query.Result.Id
+
+			err = SetAuthInfo(&m.SetAuthInfoCommand{
+				UserId:     userId,
+				AuthModule: m.AuthModuleLDAP,
+				AuthId:     "cn=loginuser0",
+				Metadata:   map[string]string{"department": "Engineering", "employee_number": "1042"},
+			})
+			So(err, ShouldBeNil)
+
+			getAuthQuery := &m.GetAuthInfoQuery{UserId: userId}
+			err = GetAuthInfo(getAuthQuery)
+
+			So(err, ShouldBeNil)
+			So(getAuthQuery.Result.GetMetadata(), ShouldResemble, map[string]string{"department": "Engineering", "employee_number": "1042"})
+
+			// the sync without metadata leaves them unchanged
+			err = UpdateAuthInfo(&m.UpdateAuthInfoCommand{UserId: userId, AuthModule: m.AuthModuleLDAP, AuthId: "cn=loginuser0"})
+			So(err, ShouldBeNil)
+
+			err = GetAuthInfo(getAuthQuery)
+			So(err, ShouldBeNil)
+			So(getAuthQuery.Result.GetMetadata(), ShouldResemble, map[string]string{"department": "Engineering", "employee_number": "1042"})
+
+			err = UpdateAuthInfo(&m.UpdateAuthInfoCommand{
+				UserId:     userId,
+				AuthModule: m.AuthModuleLDAP,
+				AuthId:     "cn=loginuser0",
+				Metadata:   map[string]string{"department": "Sales"},
+			})
+			So(err, ShouldBeNil)
+
+			err = GetAuthInfo(getAuthQuery)
+			So(err, ShouldBeNil)
+			So(getAuthQuery.Result.GetMetadata(), ShouldResemble, map[string]string{"department": "Sales"})
+
+			// the sync of a user without any of the mapped attributes
+			err = UpdateAuthInfo(&m.UpdateAuthInfoCommand{
+				UserId:     userId,
+				AuthModule: m.AuthModuleLDAP,
+				AuthId:     "cn=loginuser0",
+				Metadata:   map[string]string{},
+			})
+			So(err, ShouldBeNil)
+
+			err = GetAuthInfo(getAuthQuery)
+			So(err, ShouldBeNil)
+			So(getAuthQuery.Result.GetMetadata(), ShouldBeEmpty)
+		})
+
 		Convey("Always return the most recently used auth_module", func() {
 			// Find a user to set tokens on
 			login := "loginuser0"
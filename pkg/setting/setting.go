@@ -46,6 +46,30 @@ var (
 	ERR_TEMPLATE_NAME = "error"
 )
 
+// Policies for the login when none of the LDAP servers are reachable
+const (
+	// LDAPOnUnreachableDeny rejects the login
+	LDAPOnUnreachableDeny = "deny"
+	// LDAPOnUnreachableFallthrough ignores LDAP, as if it wasn't enabled
+	LDAPOnUnreachableFallthrough = "fallthrough"
+)
+
+// Policies for the users the LDAP sync doesn't find
+const (
+	// LDAPDisableMissingAuthoritative disables the users once every server, or a replica of every group, reports them missing
+	LDAPDisableMissingAuthoritative = "authoritative"
+	// LDAPDisableMissingUnanimous only disables the users when every server and every replica is reachable and reports them missing
+	LDAPDisableMissingUnanimous = "unanimous"
+)
+
+// Policies for the LDAP user searches matching several entries
+const (
+	// LDAPAmbiguousUsersFirst picks the first entry by DN
+	LDAPAmbiguousUsersFirst = "first"
+	// LDAPAmbiguousUsersReject refuses the user
+	LDAPAmbiguousUsersReject = "reject"
+)
+
 var (
 	// App settings.
 	Env              = DEV
@@ -179,6 +203,89 @@ var (
 	LDAPSyncCron          string
 	LDAPAllowSignup       bool
 	LDAPActiveSyncEnabled bool
+	LDAPOnUnreachable     string
+
+	// LDAPDisableMissingUsers is the policy for the users the sync doesn't find,
+	// they are never disabled while a server is unreachable
+	LDAPDisableMissingUsers string
+
+	// LDAPAmbiguousUsers is the policy for the user searches matching several entries
+	LDAPAmbiguousUsers string
+
+	// LDAPBlockRoleDowngrades keeps the current org role of the users when the LDAP sync would lower it
+	LDAPBlockRoleDowngrades bool
+
+	// LDAPSyncHistorySize and LDAPSyncHistoryRetention bound the in-memory history of the LDAP syncs
+	LDAPSyncHistorySize      int
+	LDAPSyncHistoryRetention time.Duration
+
+	// LDAPSyncRetries is the number of times the bulk LDAP sync retries a user failing with a transient error,
+	// waiting LDAPSyncRetryBackoff before the first retry and twice as long before every other one
+	LDAPSyncRetries      int
+	LDAPSyncRetryBackoff time.Duration
+
+	// LDAPSyncConcurrency is the number of users the bulk LDAP sync syncs at once
+	LDAPSyncConcurrency int
+
+	// LDAPPoolMaxIdle is the number of bound connections to each LDAP server kept across the requests, 0 disables the pool.
+	// LDAPPoolMaxOpen bounds the connections open to each server at once, they aren't bounded if 0.
+	// The idle connections are closed after LDAPPoolIdleTimeout, and bound again before their reuse when they were
+	// idle for LDAPPoolHealthCheckInterval.
+	LDAPPoolMaxIdle             int
+	LDAPPoolMaxOpen             int
+	LDAPPoolIdleTimeout         time.Duration
+	LDAPPoolHealthCheckInterval time.Duration
+
+	// LDAPProductionMode refuses the LDAP servers skipping the verification of their TLS certificate
+	LDAPProductionMode bool
+
+	// LDAPChangeNotificationSecret is the secret shared with the directory posting its change notifications,
+	// the notifications are refused when it's empty
+	LDAPChangeNotificationSecret string
+
+	// LDAPDialRetries is the number of times a new connection to an LDAP server is dialed and bound again after
+	// a transient failure, before moving to the next server. The backoff doubles from LDAPDialRetryBackoff
+	LDAPDialRetries      int
+	LDAPDialRetryBackoff time.Duration
+
+	// LDAPParallelLookups asks all the LDAP servers at once for the user lookups and the logins, taking the first
+	// authoritative answer, so a server which can't be reached doesn't delay the others by its timeout
+	LDAPParallelLookups bool
+
+	// LDAPJitterWindow is the window the pings of the LDAP servers are spread over, so a fleet of instances
+	// polling the LDAP status on the same cadence don't hit the directory at once
+	LDAPJitterWindow time.Duration
+
+	// LDAPSyncMaxDisabled and LDAPSyncMaxDisabledPercent are the number and the percentage of the synced users the
+	// bulk sync may disable at most, the users missing from LDAP aren't disabled beyond. They aren't limited if 0
+	LDAPSyncMaxDisabled        int
+	LDAPSyncMaxDisabledPercent int
+
+	// LDAPAPIRateLimit is the number of requests per minute each admin may send to the LDAP admin API, and
+	// LDAPAPIConcurrencyLimit the number of requests to it in flight at once. They aren't limited if 0
+	LDAPAPIRateLimit        int
+	LDAPAPIConcurrencyLimit int
+
+	// LDAPUserCacheTTL is how long the users found by the LDAP lookups and logins are cached, they aren't if 0
+	LDAPUserCacheTTL time.Duration
+
+	// LDAPCertExpiryWindow is how long before their expiry the TLS certificates of the LDAP servers are flagged
+	// by the LDAP status
+	LDAPCertExpiryWindow time.Duration
+
+	// LDAPLockedFields are the fields of the LDAP users overwritten by the sync, "login", "email" or "name",
+	// which the users can't edit in their profile
+	LDAPLockedFields []string
+
+	// LDAPPostSyncHook is the executable run after each successful sync of a user, with the user and its changes
+	// as JSON on stdin. It's killed after LDAPPostSyncHookTimeout.
+	LDAPPostSyncHook        string
+	LDAPPostSyncHookTimeout time.Duration
+
+	// LDAPSyncAllowlist and LDAPSyncDenylist are the lowercased logins or glob patterns of the users the LDAP sync
+	// is restricted to, all of them when the allowlist is empty, and of the users it skips
+	LDAPSyncAllowlist []string
+	LDAPSyncDenylist  []string
 
 	// QUOTA
 	Quota QuotaSettings
@@ -1019,6 +1126,23 @@ func valueAsString(section *ini.Section, keyName string, defaultValue string) (v
 	return section.Key(keyName).MustString(defaultValue), nil
 }
 
+// readLoginPatterns reads a comma or space separated list of logins or glob patterns, lowercased.
+// The invalid patterns are ignored and logged as warnings.
+func readLoginPatterns(cfg *Cfg, value string) []string {
+	patterns := []string{}
+
+	for _, pattern := range util.SplitString(value) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			cfg.Logger.Warn("Ignoring invalid login pattern", "pattern", pattern, "error", err)
+			continue
+		}
+
+		patterns = append(patterns, strings.ToLower(pattern))
+	}
+
+	return patterns
+}
+
 type RemoteCacheOptions struct {
 	Name    string
 	ConnStr string
@@ -1031,6 +1155,53 @@ func (cfg *Cfg) readLDAPConfig() {
 	LDAPEnabled = ldapSec.Key("enabled").MustBool(false)
 	LDAPActiveSyncEnabled = ldapSec.Key("active_sync_enabled").MustBool(false)
 	LDAPAllowSignup = ldapSec.Key("allow_sign_up").MustBool(true)
+	LDAPBlockRoleDowngrades = ldapSec.Key("block_role_downgrades").MustBool(false)
+	LDAPSyncHistorySize = ldapSec.Key("sync_history_size").MustInt(100)
+	LDAPSyncHistoryRetention = ldapSec.Key("sync_history_retention").MustDuration(24 * time.Hour)
+	LDAPSyncRetries = ldapSec.Key("sync_retries").MustInt(0)
+	LDAPSyncRetryBackoff = ldapSec.Key("sync_retry_backoff").MustDuration(time.Second)
+	LDAPSyncConcurrency = ldapSec.Key("sync_concurrency").MustInt(4)
+	LDAPPoolMaxIdle = ldapSec.Key("pool_max_idle").MustInt(0)
+	LDAPPoolMaxOpen = ldapSec.Key("pool_max_open").MustInt(0)
+	LDAPPoolIdleTimeout = ldapSec.Key("pool_idle_timeout").MustDuration(5 * time.Minute)
+	LDAPPoolHealthCheckInterval = ldapSec.Key("pool_health_check_interval").MustDuration(30 * time.Second)
+	LDAPProductionMode = ldapSec.Key("production_mode").MustBool(false)
+	LDAPChangeNotificationSecret = ldapSec.Key("change_notification_secret").String()
+	LDAPDialRetries = ldapSec.Key("dial_retries").MustInt(0)
+	LDAPDialRetryBackoff = ldapSec.Key("dial_retry_backoff").MustDuration(100 * time.Millisecond)
+	LDAPJitterWindow = ldapSec.Key("jitter_window").MustDuration(0)
+	LDAPParallelLookups = ldapSec.Key("parallel_lookups").MustBool(false)
+	LDAPUserCacheTTL = ldapSec.Key("user_cache_ttl").MustDuration(0)
+	LDAPSyncMaxDisabled = ldapSec.Key("sync_max_disabled").MustInt(0)
+	LDAPSyncMaxDisabledPercent = ldapSec.Key("sync_max_disabled_percent").MustInt(0)
+	LDAPAPIRateLimit = ldapSec.Key("api_rate_limit").MustInt(0)
+	LDAPAPIConcurrencyLimit = ldapSec.Key("api_concurrency_limit").MustInt(0)
+	LDAPCertExpiryWindow = ldapSec.Key("cert_expiry_window").MustDuration(30 * 24 * time.Hour)
+	LDAPPostSyncHook = ldapSec.Key("post_sync_hook").String()
+	LDAPPostSyncHookTimeout = ldapSec.Key("post_sync_hook_timeout").MustDuration(10 * time.Second)
+	LDAPSyncAllowlist = readLoginPatterns(cfg, ldapSec.Key("sync_allowlist").String())
+	LDAPSyncDenylist = readLoginPatterns(cfg, ldapSec.Key("sync_denylist").String())
+	LDAPLockedFields = []string{}
+	for _, field := range util.SplitString(ldapSec.Key("locked_fields").MustString("login,email,name")) {
+		switch field {
+		case "login", "email", "name":
+			LDAPLockedFields = append(LDAPLockedFields, field)
+		default:
+			cfg.Logger.Warn("Ignoring unknown LDAP locked field", "field", field)
+		}
+	}
+	LDAPOnUnreachable = ldapSec.Key("on_unreachable").In(
+		LDAPOnUnreachableDeny,
+		[]string{LDAPOnUnreachableDeny, LDAPOnUnreachableFallthrough},
+	)
+	LDAPDisableMissingUsers = ldapSec.Key("disable_missing_users").In(
+		LDAPDisableMissingAuthoritative,
+		[]string{LDAPDisableMissingAuthoritative, LDAPDisableMissingUnanimous},
+	)
+	LDAPAmbiguousUsers = ldapSec.Key("ambiguous_users").In(
+		LDAPAmbiguousUsersFirst,
+		[]string{LDAPAmbiguousUsersFirst, LDAPAmbiguousUsersReject},
+	)
 }
 
 func (cfg *Cfg) readSessionConfig() {
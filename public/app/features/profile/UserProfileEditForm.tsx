@@ -48,10 +48,19 @@ export class UserProfileEditForm extends PureComponent<Props, State> {
     this.props.updateProfile({ ...this.state });
   };
 
+  // the fields managed by the auth module of the user are overwritten by its next sync
+  isLocked = (field: string) => {
+    const { lockedFields = [] } = this.props.user;
+    return lockedFields.indexOf(field) !== -1;
+  };
+
   render() {
     const { name, email, login } = this.state;
     const { isSavingUser } = this.props;
     const { disableLoginForm } = config;
+    const nameLocked = this.isLocked('name');
+    const emailLocked = disableLoginForm || this.isLocked('email');
+    const loginLocked = disableLoginForm || this.isLocked('login');
 
     return (
       <>
@@ -59,7 +68,18 @@ export class UserProfileEditForm extends PureComponent<Props, State> {
         <form name="userForm" className="gf-form-group">
           <div className="gf-form max-width-30">
             <FormLabel className="width-8">Name</FormLabel>
-            <Input className="gf-form-input max-width-22" type="text" onChange={this.onNameChange} value={name} />
+            <Input
+              className="gf-form-input max-width-22"
+              type="text"
+              onChange={this.onNameChange}
+              value={name}
+              disabled={nameLocked}
+            />
+            {nameLocked && (
+              <Tooltip content="Name Locked - managed in another system.">
+                <i className="fa fa-lock gf-form-icon--right-absolute" />
+              </Tooltip>
+            )}
           </div>
           <div className="gf-form max-width-30">
             <FormLabel className="width-8">Email</FormLabel>
@@ -68,9 +88,9 @@ export class UserProfileEditForm extends PureComponent<Props, State> {
               type="text"
               onChange={this.onEmailChange}
               value={email}
-              disabled={disableLoginForm}
+              disabled={emailLocked}
             />
-            {disableLoginForm && (
+            {emailLocked && (
               <Tooltip content="Login Details Locked - managed in another system.">
                 <i className="fa fa-lock gf-form-icon--right-absolute" />
               </Tooltip>
@@ -83,9 +103,9 @@ export class UserProfileEditForm extends PureComponent<Props, State> {
               type="text"
               onChange={this.onLoginChange}
               value={login}
-              disabled={disableLoginForm}
+              disabled={loginLocked}
             />
-            {disableLoginForm && (
+            {loginLocked && (
               <Tooltip content="Login Details Locked - managed in another system.">
                 <i className="fa fa-lock gf-form-icon--right-absolute" />
               </Tooltip>
@@ -19,6 +19,7 @@ export interface User {
   email: string;
   name: string;
   orgId?: number;
+  lockedFields?: string[];
 }
 
 export interface Invitee {